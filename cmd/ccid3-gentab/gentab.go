@@ -26,7 +26,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 `)
 	// j is the loss rate inverse
 	for j := 1; j < 3000; j++ {
-		p := 1 / (1+float64(j)) // loss rate
+		p := 1 / float64(j) // loss rate
 		q := (math.Sqrt(2*p/3) + 12*math.Sqrt(3*p/8)*p*(1+32*p*p))
 		fmt.Printf("\t{ % 4d, % 5d\t},\n", j, int64(q*1e3))
 	}
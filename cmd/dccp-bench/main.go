@@ -0,0 +1,403 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+// dccp-bench measures the goodput, packet rate, loss and one-way delay of a DCCP connection,
+// in the manner of iperf. The server, started with -listen, receives the packets that the
+// client sends for the duration of the test. Both print periodic reports, and the client
+// prints the final report of the server when the test is over.
+//
+// The CCID is either 3, whose rate can be fixed with -rate, "fixed", which sends at the -rate
+// in packets per second regardless of network conditions, or "unlimited", which sends as fast
+// as it can. Both ends must use the same CCID. One-way delays are measured between the clocks of the two hosts, so they are only
+// meaningful if these clocks are synchronized.
+package main
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+	"github.com/petar/GoDCCP/dccp"
+	"github.com/petar/GoDCCP/dccp/ccid3"
+)
+
+var (
+	flagListen   *string  = flag.String("listen", "", "Receive tests at this address, instead of sending one")
+	flagCCID     *string  = flag.String("ccid", "3", "CCID of the connection: 3, fixed, unlimited")
+	flagRate     *uint    = flag.Uint("rate", 0, "Send rate in packets per second; zero leaves it to CCID 3")
+	flagSize     *int     = flag.Int("s", 1000, "Size of each packet in bytes")
+	flagTime     *float64 = flag.Float64("t", 10, "Duration of the test in seconds")
+	flagInterval *float64 = flag.Float64("i", 1, "Seconds between periodic reports")
+	flagTrace    *string  = flag.String("trace", "", "Log file for the DCCP trace of the connections")
+)
+
+// Each packet starts with its sequence number and the time it was sent, in nanoseconds.
+// Sequence numbers at or above finSeq mark control packets: The client sends warm-up
+// packets, which the server echoes, until the connection is open. At the end of the test,
+// it sends fin packets, to which the server replies with its final report.
+const (
+	stampLen      = 16
+	finSeq        = 1<<63 - 2
+	warmUpSeq     = 1<<63 - 1
+	reportLen     = stampLen + 7*8
+	controlPeriod = 200e6 // Time between control packets awaiting a reply, in ns
+	replyTimeout  = 30e9  // Time allowed for a reply to control packets, in ns
+)
+
+func usage() {
+	fmt.Printf("%s [optional_flags] host:port\n", os.Args[0])
+	fmt.Printf("%s [optional_flags] -listen host:port\n", os.Args[0])
+	flag.PrintDefaults()
+	os.Exit(1)
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
+
+func main() {
+	flag.Parse()
+	nonflags := flag.Args()
+	switch {
+	case *flagCCID != "3" && *flagCCID != "fixed" && *flagCCID != "unlimited":
+		usage()
+	case *flagCCID == "fixed" && *flagRate == 0:
+		fatalf("CCID fixed requires a -rate")
+	case *flagListen != "":
+		serve(*flagListen)
+	case len(nonflags) == 1:
+		send(nonflags[0])
+	default:
+		usage()
+	}
+}
+
+// newEnv creates the Env of the connections, which writes a trace to the -trace file
+func newEnv() *dccp.Env {
+	if *flagTrace == "" {
+		env := dccp.NewEnv(nil)
+		env.SetTraceFilter("", dccp.LevelOff)
+		return env
+	}
+	return dccp.NewEnv(dccp.NewFileTraceWriter(*flagTrace))
+}
+
+// newConn creates a connection over seg with the CCID given by -ccid and -rate
+func newConn(env *dccp.Env, seg dccp.SegmentConn, server bool) *dccp.Conn {
+	label := "client"
+	if server {
+		label = "server"
+	}
+	amb := dccp.NewAmb(label, env)
+	var ccid dccp.CCID = ccid3.CCID3{}
+	switch {
+	case *flagCCID == "fixed":
+		ccid = dccp.CCFixed{Every: 1e9 / int64(*flagRate)}
+	case *flagCCID == "unlimited":
+		ccid = dccp.CCUnlimited{}
+	case *flagRate > 0:
+		amb.Flags().SetUint32("FixRate", uint32(*flagRate))
+	}
+	hc := dccp.NewHeaderConn(seg)
+	if server {
+		return dccp.NewConnServer(env, amb, hc, ccid.NewSender(env, amb), ccid.NewReceiver(env, amb))
+	}
+	return dccp.NewConnClient(env, amb, hc, ccid.NewSender(env, amb), ccid.NewReceiver(env, amb), 0)
+}
+
+// meter accumulates the measurements of the data packets received by the server
+type meter struct {
+	sync.Mutex
+	first, last int64 // Times of arrival of the first and the latest packet
+	packets     int64
+	bytes       int64
+	maxSeq      int64 // Greatest sequence number received, or -1
+	delaySum    int64
+	delayMin    int64
+	delayMax    int64
+}
+
+func newMeter() *meter {
+	return &meter{maxSeq: -1}
+}
+
+// add records the arrival at time now of packet p, with sequence number seq
+func (m *meter) add(p []byte, seq, now int64) {
+	m.Lock()
+	defer m.Unlock()
+	delay := now - int64(binary.BigEndian.Uint64(p[8:16]))
+	if m.packets == 0 {
+		m.first, m.delayMin, m.delayMax = now, delay, delay
+	}
+	m.last = now
+	m.packets++
+	m.bytes += int64(len(p))
+	if seq > m.maxSeq {
+		m.maxSeq = seq
+	}
+	m.delaySum += delay
+	if delay < m.delayMin {
+		m.delayMin = delay
+	}
+	if delay > m.delayMax {
+		m.delayMax = delay
+	}
+}
+
+// snapshot returns a copy of the measurements so far
+func (m *meter) snapshot() *meter {
+	m.Lock()
+	defer m.Unlock()
+	return &meter{
+		first: m.first, last: m.last, packets: m.packets, bytes: m.bytes, maxSeq: m.maxSeq,
+		delaySum: m.delaySum, delayMin: m.delayMin, delayMax: m.delayMax,
+	}
+}
+
+// lost returns the number of packets that have not arrived, among those up to the greatest
+// sequence number received
+func (m *meter) lost() int64 {
+	return m.maxSeq + 1 - m.packets
+}
+
+// encode writes the measurements into the final report r, after its stamp
+func (m *meter) encode(r []byte) {
+	for i, v := range []int64{m.packets, m.bytes, m.lost(), m.last - m.first, m.delayMin, m.delaySum, m.delayMax} {
+		binary.BigEndian.PutUint64(r[stampLen+8*i:], uint64(v))
+	}
+}
+
+// decodeMeter reads the measurements from the final report r
+func decodeMeter(r []byte) *meter {
+	var v [7]int64
+	for i := range v {
+		v[i] = int64(binary.BigEndian.Uint64(r[stampLen+8*i:]))
+	}
+	return &meter{
+		packets: v[0], bytes: v[1], maxSeq: v[2] + v[0] - 1, last: v[3],
+		delayMin: v[4], delaySum: v[5], delayMax: v[6],
+	}
+}
+
+// printInterval prints the measurements of the interval between snapshots m0 and m1, which
+// were taken at the times t0 and t1, since the start of the test. Delays and losses are
+// printed only if received is true.
+func printInterval(m0, m1 *meter, t0, t1 float64, received bool) {
+	packets, bytes := m1.packets-m0.packets, m1.bytes-m0.bytes
+	seconds := t1 - t0
+	fmt.Printf("[%5.1f-%5.1f s] %9.3f MB %9.3f Mbit/s %8.0f pkt/s",
+		t0, t1, float64(bytes)/1e6, float64(bytes)*8/1e6/seconds, float64(packets)/seconds)
+	if !received {
+		fmt.Printf("\n")
+		return
+	}
+	var delay float64
+	if packets > 0 {
+		delay = float64(m1.delaySum-m0.delaySum) / float64(packets) / 1e6
+	}
+	fmt.Printf("  delay %8.3f ms  lost %d\n", delay, m1.lost()-m0.lost())
+}
+
+// printFinal prints the final report of the test, whose measurements are m
+func printFinal(m *meter) {
+	seconds := float64(m.last-m.first) / 1e9
+	fmt.Printf("--- final report of the server ---\n")
+	fmt.Printf("%d packets, %.3f MB in %.3f s, %d lost (%.2f%%)\n", m.packets, float64(m.bytes)/1e6,
+		seconds, m.lost(), 100*float64(m.lost())/float64(max64(m.maxSeq+1, 1)))
+	if seconds > 0 {
+		fmt.Printf("goodput %.3f Mbit/s, %.0f pkt/s\n", float64(m.bytes)*8/1e6/seconds, float64(m.packets)/seconds)
+	}
+	if m.packets > 0 {
+		fmt.Printf("one-way delay min/avg/max = %.3f/%.3f/%.3f ms\n", float64(m.delayMin)/1e6,
+			float64(m.delaySum)/float64(m.packets)/1e6, float64(m.delayMax)/1e6)
+	}
+}
+
+func max64(x, y int64) int64 {
+	if x > y {
+		return x
+	}
+	return y
+}
+
+// report prints the measurements of m every -i seconds, until done is closed
+func report(m *meter, start time.Time, done chan int, received bool) {
+	interval := time.Duration(*flagInterval * 1e9)
+	m0, t0 := m.snapshot(), 0.0
+	for {
+		select {
+		case <-done:
+			return
+		case <-time.After(interval):
+		}
+		m1, t1 := m.snapshot(), time.Since(start).Seconds()
+		printInterval(m0, m1, t0, t1, received)
+		m0, t0 = m1, t1
+	}
+}
+
+// serve receives tests at addr, on any number of connections
+func serve(addr string) {
+	laddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		fatalf("Error resolving %s (%s)", addr, err)
+	}
+	link, err := dccp.BindUDPLink("udp", laddr)
+	if err != nil {
+		fatalf("Error binding %s (%s)", addr, err)
+	}
+	env, mux := newEnv(), dccp.NewMux(link)
+	defer env.Close()
+	fmt.Printf("Receiving tests at %s, CCID %s\n", addr, *flagCCID)
+	for {
+		seg, err := mux.Accept()
+		if err != nil {
+			fatalf("Error accepting (%s)", err)
+		}
+		go receive(env, newConn(env, seg, true))
+	}
+}
+
+// receive measures the packets of a test on conn
+func receive(env *dccp.Env, conn *dccp.Conn) {
+	m, done := newMeter(), make(chan int)
+	defer close(done)
+	defer conn.Close()
+	var started bool
+	for {
+		p, err := conn.Read()
+		if err != nil {
+			return
+		}
+		if len(p) < stampLen {
+			continue
+		}
+		switch seq := int64(binary.BigEndian.Uint64(p)); seq {
+		case warmUpSeq:
+			conn.Write(p)
+		case finSeq:
+			r := make([]byte, reportLen)
+			copy(r, p[:stampLen])
+			m.snapshot().encode(r)
+			conn.Write(r)
+		default:
+			if !started {
+				started = true
+				fmt.Printf("Test from %s\n", conn.RemoteLabel())
+				go report(m, time.Now(), done, true)
+			}
+			m.add(p, seq, time.Now().UnixNano())
+		}
+	}
+}
+
+// send runs a test towards the server at addr
+func send(addr string) {
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		fatalf("Error resolving %s (%s)", addr, err)
+	}
+	link, err := dccp.BindUDPLink("udp", nil)
+	if err != nil {
+		fatalf("Error binding (%s)", err)
+	}
+	env, mux := newEnv(), dccp.NewMux(link)
+	defer env.Close()
+	seg, err := mux.Dial(raddr)
+	if err != nil {
+		fatalf("Error dialing %s (%s)", addr, err)
+	}
+	conn := newConn(env, seg, false)
+	defer conn.Close()
+	size := *flagSize
+	if size < stampLen {
+		size = stampLen
+	}
+	if mtu := conn.GetMTU(); size > mtu {
+		fatalf("Packet size %d exceeds the MTU of %d bytes", size, mtu)
+	}
+
+	// The server's replies to control packets arrive on replies
+	replies := make(chan []byte, 1)
+	go func() {
+		defer close(replies)
+		for {
+			p, err := conn.Read()
+			if err != nil {
+				return
+			}
+			if len(p) >= stampLen {
+				replies <- p
+			}
+		}
+	}()
+	// CCID 3 starts slowly, so the connection is warmed up before the test
+	fmt.Printf("Connecting to %s\n", addr)
+	if control(conn, warmUpSeq, replies, 0) == nil {
+		fatalf("No response from %s", addr)
+	}
+	fmt.Printf("Sending %d-byte packets to %s for %g s, CCID %s\n", size, addr, *flagTime, *flagCCID)
+
+	// The sender's progress is reported like the server's, without delays and losses
+	sent, done := newMeter(), make(chan int)
+	start := time.Now()
+	go report(sent, start, done, false)
+	deadline := start.Add(time.Duration(*flagTime * 1e9))
+	for seq := int64(0); time.Now().Before(deadline); seq++ {
+		p := newPacket(seq, size)
+		if err := conn.Write(p); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing (%s)\n", err)
+			break
+		}
+		sent.add(p, seq, int64(binary.BigEndian.Uint64(p[8:16])))
+	}
+	close(done)
+	s := sent.snapshot()
+	fmt.Printf("--- sent %d packets, %.3f MB ---\n", s.packets, float64(s.bytes)/1e6)
+
+	// Give the last packets time to arrive, before asking for the final report
+	time.Sleep(time.Duration(max64(conn.Features().RTT, 100e6)))
+	r := control(conn, finSeq, replies, controlPeriod)
+	if r == nil || len(r) < reportLen {
+		fatalf("No final report from %s", addr)
+	}
+	printFinal(decodeMeter(r))
+}
+
+// newPacket returns a packet of size bytes with sequence number seq, stamped with the current time
+func newPacket(seq int64, size int) []byte {
+	p := make([]byte, size)
+	binary.BigEndian.PutUint64(p[0:8], uint64(seq))
+	binary.BigEndian.PutUint64(p[8:16], uint64(time.Now().UnixNano()))
+	return p
+}
+
+// control sends control packets with sequence number seq, every period nanoseconds, until
+// the server replies to one, and returns the reply. It returns nil if the server does not
+// reply within replyTimeout. A zero period sends control packets as fast as the CCID
+// allows, which gets its feedback going.
+func control(conn *dccp.Conn, seq int64, replies <-chan []byte, period int64) []byte {
+	timeout := time.After(replyTimeout)
+	for {
+		if err := conn.Write(newPacket(seq, stampLen)); err != nil {
+			return nil
+		}
+		select {
+		case r, ok := <-replies:
+			if !ok {
+				return nil
+			}
+			if int64(binary.BigEndian.Uint64(r)) == seq {
+				return r
+			}
+		case <-time.After(time.Duration(period)):
+		case <-timeout:
+			return nil
+		}
+	}
+}
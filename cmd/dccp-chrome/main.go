@@ -0,0 +1,59 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+// dccp-chrome converts a DCCP log file into Chrome tracing JSON, which can be
+// viewed on a timeline by loading it into chrome://tracing.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	dccp_gauge "github.com/petar/GoDCCP/dccp/gauge"
+)
+
+var flagOut *string = flag.String("out", "", "Output file; standard output if empty")
+
+func usage() {
+	fmt.Printf("%s [optional_flags] log_file\n", os.Args[0])
+	flag.PrintDefaults()
+	os.Exit(1)
+}
+
+func main() {
+	flag.Parse()
+	nonflags := flag.Args()
+	if len(nonflags) == 0 {
+		usage()
+	}
+
+	// Open and decode log file
+	logFile, err := os.Open(nonflags[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening log (%s)\n", err)
+		os.Exit(1)
+	}
+	defer logFile.Close()
+	emits, err := dccp_gauge.ReadTraces(logFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Terminated unexpectedly (%s).\n", err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *flagOut != "" {
+		f, err := os.Create(*flagOut)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating output (%s)\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err = dccp_gauge.WriteChromeTrace(w, emits); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing trace (%s)\n", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "Converted %d records.\n", len(emits))
+}
@@ -0,0 +1,358 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+// dccp-dissect decodes DCCP packets offline, with the header and option parsers of the dccp
+// package, and prints a readable breakdown of each. It reads the named files, or standard
+// input if there are none, in one of three formats:
+//
+// A pcap capture, whose DCCP packets are carried in IPv4 or IPv6, over Ethernet, Linux
+// cooked capture, loopback or raw IP links. UDP datagrams to or from the -udp port are
+// decoded as well, as DCCP encapsulated in UDP.
+//
+// A hex dump, with one packet per paragraph. Each line may begin with an offset that ends in
+// a colon, as printed by tcpdump -x or xxd, and ends at the first word that is not hex.
+//
+// A binary file, which holds a single packet.
+//
+// Unless -ip is given, hex dumps and binary files hold DCCP packets without an IP header.
+// Each packet is decoded as plain DCCP and as DCCP framed by the flow labels of the GoDCCP
+// multiplexer, whichever passes the checksum. If neither does, the packet is decoded
+// without verifying its checksum.
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"github.com/petar/GoDCCP/dccp"
+	"github.com/petar/GoDCCP/dccp/ccid3"
+)
+
+var (
+	flagFormat *string = flag.String("format", "auto", "Format of the input: auto, pcap, hex, bin")
+	flagIP     *bool   = flag.Bool("ip", false, "Hex dumps and binary files start with an IP header")
+	flagUDP    *uint   = flag.Uint("udp", 0, "Decode UDP datagrams to or from this port as DCCP")
+	flagData   *bool   = flag.Bool("x", false, "Print a hex dump of the application data")
+)
+
+func usage() {
+	fmt.Printf("%s [optional_flags] [file ...]\n", os.Args[0])
+	flag.PrintDefaults()
+	os.Exit(1)
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
+
+// packet is a DCCP packet found in the input, before it is decoded
+type packet struct {
+	Where    string // Position of the packet in the input
+	Info     string // What is known about the packet besides its contents, or empty
+	SourceIP []byte // IP addresses of the packet, or nil if they are not known
+	DestIP   []byte
+	Segment  []byte // DCCP header and data, possibly framed by GoDCCP flow labels
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	switch *flagFormat {
+	case "auto", "pcap", "hex", "bin":
+	default:
+		usage()
+	}
+	names := flag.Args()
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+	for _, name := range names {
+		var p []byte
+		var err error
+		if name == "-" {
+			name = "stdin"
+			p, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			p, err = ioutil.ReadFile(name)
+		}
+		if err != nil {
+			fatalf("Error reading %s (%s)", name, err)
+		}
+		pkts, err := readPackets(name, p)
+		if err != nil {
+			fatalf("Error decoding %s (%s)", name, err)
+		}
+		for _, pkt := range pkts {
+			dissect(os.Stdout, pkt)
+		}
+	}
+}
+
+// readPackets returns the packets in the input p, read from the file name
+func readPackets(name string, p []byte) ([]*packet, error) {
+	format := *flagFormat
+	if format == "auto" {
+		format = detectFormat(p)
+	}
+	var segments [][]byte
+	switch format {
+	case "pcap":
+		return readPcap(name, p)
+	case "hex":
+		var err error
+		if segments, err = readHex(p); err != nil {
+			return nil, err
+		}
+	default:
+		segments = [][]byte{p}
+	}
+	var pkts []*packet
+	for i, seg := range segments {
+		pkt := &packet{Where: fmt.Sprintf("%s #%d", name, i+1), Segment: seg}
+		if *flagIP {
+			var ok bool
+			if pkt, ok = decapIP(pkt, seg); !ok {
+				fmt.Fprintf(os.Stderr, "%s #%d: no DCCP packet in IP packet\n", name, i+1)
+				continue
+			}
+		}
+		pkts = append(pkts, pkt)
+	}
+	return pkts, nil
+}
+
+// detectFormat guesses the format of the input p
+func detectFormat(p []byte) string {
+	if isPcap(p) {
+		return "pcap"
+	}
+	for _, b := range p {
+		if b >= 0x80 || (b < ' ' && b != '\n' && b != '\r' && b != '\t') {
+			return "bin"
+		}
+	}
+	return "hex"
+}
+
+// readHex reads the packets of a hex dump, one per paragraph
+func readHex(p []byte) ([][]byte, error) {
+	var segments [][]byte
+	var seg []byte
+	for i, line := range strings.Split(string(p), "\n") {
+		words := strings.Fields(line)
+		if len(words) == 0 {
+			if len(seg) > 0 {
+				segments = append(segments, seg)
+			}
+			seg = nil
+			continue
+		}
+		if strings.HasSuffix(words[0], ":") {
+			words = words[1:]
+		}
+		for _, w := range words {
+			w = strings.TrimPrefix(w, "0x")
+			b, err := hex.DecodeString(w)
+			if err != nil {
+				break
+			}
+			if len(b) == 0 {
+				return nil, fmt.Errorf("line %d: empty word", i+1)
+			}
+			seg = append(seg, b...)
+		}
+	}
+	if len(seg) > 0 {
+		segments = append(segments, seg)
+	}
+	return segments, nil
+}
+
+// decode decodes the DCCP header of pkt. It returns the header, along with a description of
+// the framing of the packet and of the outcome of the checksum verification.
+func decode(pkt *packet) (h *dccp.Header, framing string, err error) {
+	seg, zero := pkt.Segment, dccp.LabelZero.Bytes()
+	if pkt.SourceIP != nil {
+		if h, err = dccp.ReadHeader(seg, pkt.SourceIP, pkt.DestIP, dccp.IPProtoDCCP, true); err == nil {
+			return h, "DCCP, checksum ok", nil
+		}
+	}
+	if len(seg) > 2*dccp.LabelLen {
+		if h, err = dccp.ReadHeader(seg[2*dccp.LabelLen:], zero, zero, dccp.AnyProto, true); err == nil {
+			source, _, _ := dccp.ReadLabel(seg)
+			sink, _, _ := dccp.ReadLabel(seg[dccp.LabelLen:])
+			return h, fmt.Sprintf("GoDCCP flow %s > %s, checksum ok", source, sink), nil
+		}
+	}
+	if h, err = dccp.ReadHeader(seg, zero, zero, dccp.AnyProto, true); err == nil {
+		return h, "DCCP, checksum ok over GoDCCP's zero pseudo-header", nil
+	}
+	if h, err = dccp.ReadHeaderNoChecksum(seg, true); err != nil {
+		return nil, "", err
+	}
+	if pkt.SourceIP != nil {
+		return h, "DCCP, bad checksum", nil
+	}
+	return h, "DCCP, checksum not verified", nil
+}
+
+// dissect prints a breakdown of pkt to w
+func dissect(w io.Writer, pkt *packet) {
+	fmt.Fprintf(w, "%s: %d bytes", pkt.Where, len(pkt.Segment))
+	if pkt.Info != "" {
+		fmt.Fprintf(w, ", %s", pkt.Info)
+	}
+	fmt.Fprintf(w, "\n")
+	h, framing, err := decode(pkt)
+	if err != nil {
+		fmt.Fprintf(w, "  Undecodable (%s)\n", err)
+		dumpHex(w, pkt.Segment)
+		fmt.Fprintf(w, "\n")
+		return
+	}
+	fmt.Fprintf(w, "  %s\n", framing)
+	x := 0
+	if h.X {
+		x = 1
+	}
+	fmt.Fprintf(w, "  %s, ports %d > %d, X=%d, CCVal %d, CsCov %d\n",
+		dccp.TypeString(h.Type), h.SourcePort, h.DestPort, x, h.CCVal, h.CsCov)
+	switch h.Type {
+	case dccp.Request:
+		fmt.Fprintf(w, "  SeqNo %d\n", h.SeqNo)
+	default:
+		fmt.Fprintf(w, "  SeqNo %d, AckNo %d\n", h.SeqNo, h.AckNo)
+	}
+	switch h.Type {
+	case dccp.Request, dccp.Response:
+		fmt.Fprintf(w, "  Service Code %s\n", dccp.ServiceCodeString(h.ServiceCode))
+	case dccp.Reset:
+		fmt.Fprintf(w, "  Reset Code %s, Reset Data % x\n", dccp.ResetCodeString(h.ResetCode), h.ResetData)
+	}
+	if fault := h.OptionFault(); fault != "" {
+		fmt.Fprintf(w, "  Option fault: %s\n", fault)
+	}
+	opts := h.GetOptions()
+	for i := range opts {
+		o := &opts[i]
+		mandatory := ""
+		if o.Mandatory {
+			mandatory = ", mandatory"
+		}
+		fmt.Fprintf(w, "  Option %d %s%s: %s\n", o.Type, optionName(o.Type), mandatory, optionValue(o))
+	}
+	switch {
+	case h.Type == dccp.Reset && len(h.Data) > 0:
+		fmt.Fprintf(w, "  Error text %q\n", h.Data)
+	case len(h.Data) > 0:
+		fmt.Fprintf(w, "  Data %d bytes\n", len(h.Data))
+		if *flagData {
+			dumpHex(w, h.Data)
+		}
+	}
+	fmt.Fprintf(w, "\n")
+}
+
+// optionName returns the name of the option type typ. Options in the CCID-specific range are
+// named after the options of CCID 3.
+func optionName(typ byte) string {
+	switch typ {
+	case ccid3.OptionLossEventRate:
+		return "LossEventRate"
+	case ccid3.OptionLossIntervals:
+		return "LossIntervals"
+	case ccid3.OptionReceiveRate:
+		return "ReceiveRate"
+	case ccid3.OptionLossDigest:
+		return "LossDigest"
+	case ccid3.OptionRoundtripReport:
+		return "RoundtripReport"
+	case dccp.OptionPadding, dccp.OptionMandatory, dccp.OptionSlowReceiver:
+		return dccp.OptionString(typ)
+	}
+	switch {
+	case typ >= 128:
+		return "CCID-specific"
+	case typ > dccp.OptionDataChecksum:
+		return "Reserved"
+	}
+	return dccp.OptionString(typ)
+}
+
+// optionValue describes the value of the option o. Options in the CCID-specific range are
+// decoded as CCID 3 options.
+func optionValue(o *dccp.Option) string {
+	switch o.Type {
+	case dccp.OptionTimestamp:
+		if t := dccp.DecodeTimestampOption(o); t != nil {
+			return fmt.Sprintf("%d × 10 µs", t.Timestamp)
+		}
+	case dccp.OptionTimestampEcho:
+		if t := dccp.DecodeTimestampEchoOption(o); t != nil {
+			return fmt.Sprintf("%d × 10 µs, elapsed %d × 10 µs", t.Timestamp, t.Elapsed)
+		}
+	case dccp.OptionElapsedTime:
+		if t := dccp.DecodeElapsedTimeOption(o); t != nil {
+			return fmt.Sprintf("%d × 10 µs", t.Elapsed)
+		}
+	case dccp.OptionChangeL, dccp.OptionConfirmL, dccp.OptionChangeR, dccp.OptionConfirmR:
+		if len(o.Data) > 0 {
+			return fmt.Sprintf("feature %d, values % x", o.Data[0], o.Data[1:])
+		}
+	case ccid3.OptionLossEventRate:
+		if r := ccid3.DecodeLossEventRateOption(o); r != nil {
+			return lossEventRate(r.RateInv)
+		}
+	case ccid3.OptionLossIntervals:
+		if r := ccid3.DecodeLossIntervalsOption(o); r != nil {
+			var w bytes.Buffer
+			fmt.Fprintf(&w, "skip length %d", r.SkipLength)
+			for _, li := range r.LossIntervals {
+				fmt.Fprintf(&w, "; lossless %d, loss %d, data %d, ECN %v",
+					li.LosslessLength, li.LossLength, li.DataLength, li.ECNNonceEcho)
+			}
+			return w.String()
+		}
+	case ccid3.OptionReceiveRate:
+		if r := ccid3.DecodeReceiveRateOption(o); r != nil {
+			return fmt.Sprintf("%d bytes/s", r.Rate)
+		}
+	case ccid3.OptionLossDigest:
+		if r := ccid3.DecodeLossDigestOption(o); r != nil {
+			return fmt.Sprintf("%s, %d new loss events", lossEventRate(r.RateInv), r.NewLossCount)
+		}
+	case ccid3.OptionRoundtripReport:
+		if r := ccid3.DecodeRoundtripReportOption(o); r != nil {
+			return fmt.Sprintf("RTT %d × 10 µs", r.Roundtrip)
+		}
+	}
+	if len(o.Data) == 0 {
+		return "no data"
+	}
+	return fmt.Sprintf("% x", o.Data)
+}
+
+func lossEventRate(rateInv uint32) string {
+	if rateInv == ccid3.UnknownLossEventRateInv {
+		return "no loss events"
+	}
+	return fmt.Sprintf("loss event rate 1/%d", rateInv)
+}
+
+// dumpHex prints p to w, 16 bytes per line
+func dumpHex(w io.Writer, p []byte) {
+	for i := 0; i < len(p); i += 16 {
+		j := i + 16
+		if j > len(p) {
+			j = len(p)
+		}
+		fmt.Fprintf(w, "    %04x  % x\n", i, p[i:j])
+	}
+}
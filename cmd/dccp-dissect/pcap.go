@@ -0,0 +1,206 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// Magic numbers of pcap files, in microsecond and nanosecond resolution, and of pcapng files
+const (
+	pcapMagicMicro = 0xa1b2c3d4
+	pcapMagicNano  = 0xa1b23c4d
+	pcapngMagic    = 0x0a0d0d0a
+)
+
+// Link types of pcap files
+const (
+	linkNull     = 0
+	linkEthernet = 1
+	linkRaw      = 101
+	linkLinuxSLL = 113
+	linkLoop     = 108
+	linkIPv4     = 228
+	linkIPv6     = 229
+)
+
+const ipProtoUDP = 17
+
+func isPcap(p []byte) bool {
+	if len(p) < 4 {
+		return false
+	}
+	switch binary.LittleEndian.Uint32(p) {
+	case pcapMagicMicro, pcapMagicNano, pcapngMagic:
+		return true
+	}
+	switch binary.BigEndian.Uint32(p) {
+	case pcapMagicMicro, pcapMagicNano:
+		return true
+	}
+	return false
+}
+
+// readPcap returns the DCCP packets of the pcap capture p, read from the file name
+func readPcap(name string, p []byte) ([]*packet, error) {
+	if len(p) < 24 {
+		return nil, errors.New("pcap header too short")
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	magic := order.Uint32(p)
+	if magic == pcapngMagic {
+		return nil, errors.New("pcapng is not supported; convert the capture with editcap -F pcap")
+	}
+	if magic != pcapMagicMicro && magic != pcapMagicNano {
+		order = binary.BigEndian
+		magic = order.Uint32(p)
+	}
+	if magic != pcapMagicMicro && magic != pcapMagicNano {
+		return nil, errors.New("not a pcap capture")
+	}
+	link := order.Uint32(p[20:24])
+	var pkts []*packet
+	for i, k := 1, 24; k < len(p); i++ {
+		if len(p)-k < 16 {
+			return pkts, fmt.Errorf("record %d truncated", i)
+		}
+		sec, frac, n := int64(order.Uint32(p[k:])), int64(order.Uint32(p[k+4:])), int(order.Uint32(p[k+8:]))
+		k += 16
+		if len(p)-k < n {
+			return pkts, fmt.Errorf("record %d truncated", i)
+		}
+		frame := p[k : k+n]
+		k += n
+		if magic == pcapMagicMicro {
+			frac *= 1e3
+		}
+		pkt := &packet{
+			Where: fmt.Sprintf("%s #%d", name, i),
+			Info:  time.Unix(sec, frac).UTC().Format("15:04:05.000000"),
+		}
+		ip, ok := decapLink(link, frame)
+		if !ok {
+			continue
+		}
+		if pkt, ok = decapIP(pkt, ip); ok {
+			pkts = append(pkts, pkt)
+		}
+	}
+	return pkts, nil
+}
+
+// decapLink returns the IP packet within frame, a frame of the link type link
+func decapLink(link uint32, frame []byte) ([]byte, bool) {
+	switch link {
+	case linkRaw, linkIPv4, linkIPv6:
+		return frame, true
+	case linkNull, linkLoop:
+		// The link header holds the address family, in the byte order of the capturing host
+		// for linkNull, which is not necessarily that of the file
+		if len(frame) < 4 {
+			return nil, false
+		}
+		return frame[4:], true
+	case linkEthernet:
+		k := 12
+		for k+2 <= len(frame) {
+			etherType := binary.BigEndian.Uint16(frame[k:])
+			k += 2
+			switch etherType {
+			case 0x8100, 0x88a8:
+				// Skip the VLAN tag
+				k += 2
+			case 0x0800, 0x86dd:
+				return frame[k:], true
+			default:
+				return nil, false
+			}
+		}
+	case linkLinuxSLL:
+		if len(frame) >= 16 {
+			switch binary.BigEndian.Uint16(frame[14:]) {
+			case 0x0800, 0x86dd:
+				return frame[16:], true
+			}
+		}
+	}
+	return nil, false
+}
+
+// decapIP fills in pkt from the IP packet ip. It returns false if ip does not carry DCCP.
+func decapIP(pkt *packet, ip []byte) (*packet, bool) {
+	if len(ip) < 1 {
+		return nil, false
+	}
+	var proto byte
+	var payload []byte
+	switch ip[0] >> 4 {
+	case 4:
+		if len(ip) < 20 {
+			return nil, false
+		}
+		hlen, total := int(ip[0]&0x0f)*4, int(binary.BigEndian.Uint16(ip[2:]))
+		if hlen < 20 || total < hlen || total > len(ip) {
+			return nil, false
+		}
+		// Only the first fragment holds the DCCP header, and it cannot be decoded on its own
+		if binary.BigEndian.Uint16(ip[6:])&0x3fff != 0 {
+			return nil, false
+		}
+		pkt.SourceIP, pkt.DestIP = ip[12:16], ip[16:20]
+		proto, payload = ip[9], ip[hlen:total]
+	case 6:
+		if len(ip) < 40 {
+			return nil, false
+		}
+		total := 40 + int(binary.BigEndian.Uint16(ip[4:]))
+		if total > len(ip) {
+			return nil, false
+		}
+		pkt.SourceIP, pkt.DestIP = ip[8:24], ip[24:40]
+		proto, payload = ip[6], ip[40:total]
+		// Skip the Hop-by-Hop, Routing and Destination Options extension headers
+		for proto == 0 || proto == 43 || proto == 60 {
+			if len(payload) < 8 || len(payload) < 8+8*int(payload[1]) {
+				return nil, false
+			}
+			proto, payload = payload[0], payload[8+8*int(payload[1]):]
+		}
+	default:
+		return nil, false
+	}
+	addr := func(ip []byte, port uint16) string {
+		return net.JoinHostPort(net.IP(ip).String(), fmt.Sprintf("%d", port))
+	}
+	switch {
+	case proto == dccp.IPProtoDCCP:
+		pkt.Segment = payload
+		info := fmt.Sprintf("IP %s > %s", net.IP(pkt.SourceIP), net.IP(pkt.DestIP))
+		pkt.Info = join(pkt.Info, info)
+		return pkt, true
+	case proto == ipProtoUDP && *flagUDP != 0 && len(payload) >= 8:
+		sp, dp := binary.BigEndian.Uint16(payload), binary.BigEndian.Uint16(payload[2:])
+		if uint(sp) != *flagUDP && uint(dp) != *flagUDP {
+			return nil, false
+		}
+		pkt.Segment = payload[8:]
+		info := fmt.Sprintf("UDP %s > %s", addr(pkt.SourceIP, sp), addr(pkt.DestIP, dp))
+		pkt.Info = join(pkt.Info, info)
+		return pkt, true
+	}
+	return nil, false
+}
+
+func join(s, t string) string {
+	if s == "" {
+		return t
+	}
+	return s + ", " + t
+}
@@ -0,0 +1,315 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+// dccp-ping opens a DCCP connection to a host, sends it timestamped probes and reports the
+// round-trip times and losses of their echoes, along with the features of the connection.
+// The remote host must run dccp-ping with -listen, which echoes the probes back.
+//
+// With -net=udp, which is the default, DCCP is encapsulated in UDP and the host is given as
+// host:port. With -net=ip, DCCP is carried directly in IP and the host is given without a
+// port. This requires the privilege to open raw sockets, at both ends.
+//
+// Since CCID 3 starts out slowly on a connection that carries little data, the send rate of
+// both ends is fixed with -rate, unless it is set to zero.
+package main
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+	"github.com/petar/GoDCCP/dccp"
+	"github.com/petar/GoDCCP/dccp/ccid3"
+)
+
+var (
+	flagNet      *string  = flag.String("net", "udp", "Transport of DCCP packets: udp, ip")
+	flagListen   *string  = flag.String("listen", "", "Echo probes received at this address, instead of pinging")
+	flagCount    *int     = flag.Int("c", 5, "Number of probes to send; zero sends probes until interrupted")
+	flagInterval *float64 = flag.Float64("i", 1, "Seconds between probes")
+	flagSize     *int     = flag.Int("s", 56, "Size of each probe in bytes")
+	flagWait     *float64 = flag.Float64("W", 2, "Seconds to wait for the echoes of the last probes")
+	flagService  *uint    = flag.Uint("service", 0, "Service code of the connection")
+	flagRate     *uint    = flag.Uint("rate", 100, "Fixed send rate in packets per second; zero leaves it to CCID 3")
+	flagTrace    *string  = flag.String("trace", "", "Log file for the DCCP trace of the connections")
+)
+
+// Each probe starts with its sequence number and the time it was sent, in nanoseconds
+const probeHeaderLen = 16
+
+// Before the probes, a warm-up probe with sequence number warmUpSeq waits for the connection
+// to open, so that the handshake does not count towards the round-trip time of the first probe
+const (
+	warmUpSeq   = -1
+	openTimeout = 30e9 // Time allowed for the warm-up probe to return, in ns
+)
+
+func usage() {
+	fmt.Printf("%s [optional_flags] host[:port]\n", os.Args[0])
+	fmt.Printf("%s [optional_flags] -listen host[:port]\n", os.Args[0])
+	flag.PrintDefaults()
+	os.Exit(1)
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
+
+func main() {
+	flag.Parse()
+	nonflags := flag.Args()
+	switch {
+	case *flagNet != "udp" && *flagNet != "ip":
+		usage()
+	case *flagListen != "":
+		serve(*flagListen)
+	case len(nonflags) == 1:
+		ping(nonflags[0])
+	default:
+		usage()
+	}
+}
+
+// resolve returns the address of a DCCP endpoint on the network given by -net
+func resolve(addr string) (net.Addr, error) {
+	if *flagNet == "ip" {
+		return net.ResolveIPAddr("ip", addr)
+	}
+	return net.ResolveUDPAddr("udp", addr)
+}
+
+// bind creates a Link of the kind given by -net. If laddr is nil, the link is bound to an
+// arbitrary local address of the same family as peer.
+func bind(laddr, peer net.Addr) (dccp.Link, error) {
+	if *flagNet == "ip" {
+		netw, ip := "ip4", peer.(*net.IPAddr)
+		if ip.IP.To4() == nil {
+			netw = "ip6"
+		}
+		local, _ := laddr.(*net.IPAddr)
+		return dccp.BindIPLink(netw, local)
+	}
+	local, _ := laddr.(*net.UDPAddr)
+	return dccp.BindUDPLink("udp", local)
+}
+
+// newEnv creates the Env of the connections, which writes a trace to the -trace file
+func newEnv() *dccp.Env {
+	if *flagTrace == "" {
+		return dccp.NewEnv(nil)
+	}
+	return dccp.NewEnv(dccp.NewFileTraceWriter(*flagTrace))
+}
+
+// newConn creates a connection with CCID 3 over seg, whose send rate is fixed by -rate
+func newConn(env *dccp.Env, seg dccp.SegmentConn, server bool) *dccp.Conn {
+	label := "client"
+	if server {
+		label = "server"
+	}
+	amb := dccp.NewAmb(label, env)
+	if *flagRate > 0 {
+		amb.Flags().SetUint32("FixRate", uint32(*flagRate))
+	}
+	hc := dccp.NewHeaderConn(seg)
+	ccid := ccid3.CCID3{}
+	if server {
+		return dccp.NewConnServer(env, amb, hc, ccid.NewSender(env, amb), ccid.NewReceiver(env, amb))
+	}
+	return dccp.NewConnClient(env, amb, hc, ccid.NewSender(env, amb), ccid.NewReceiver(env, amb), uint32(*flagService))
+}
+
+// serve echoes the probes received at addr, on any number of connections
+func serve(addr string) {
+	laddr, err := resolve(addr)
+	if err != nil {
+		fatalf("Error resolving %s (%s)", addr, err)
+	}
+	link, err := bind(laddr, laddr)
+	if err != nil {
+		fatalf("Error binding %s (%s)", addr, err)
+	}
+	env, mux := newEnv(), dccp.NewMux(link)
+	defer env.Close()
+	fmt.Printf("Echoing probes at %s\n", addr)
+	for {
+		seg, err := mux.Accept()
+		if err != nil {
+			fatalf("Error accepting (%s)", err)
+		}
+		go echo(newConn(env, seg, true))
+	}
+}
+
+func echo(c *dccp.Conn) {
+	for {
+		p, err := c.Read()
+		if err != nil {
+			c.Close()
+			return
+		}
+		if err = c.Write(p); err != nil {
+			return
+		}
+	}
+}
+
+// pinger keeps the results of the probes sent so far
+type pinger struct {
+	sync.Mutex
+	sent     int64
+	received map[int64]bool
+	open     chan int  // Closed when the warm-up probe returns
+	rtts     []float64 // Round-trip times in milliseconds
+}
+
+func ping(addr string) {
+	raddr, err := resolve(addr)
+	if err != nil {
+		fatalf("Error resolving %s (%s)", addr, err)
+	}
+	link, err := bind(nil, raddr)
+	if err != nil {
+		fatalf("Error binding (%s)", err)
+	}
+	env, mux := newEnv(), dccp.NewMux(link)
+	defer env.Close()
+	seg, err := mux.Dial(raddr)
+	if err != nil {
+		fatalf("Error dialing %s (%s)", addr, err)
+	}
+	conn := newConn(env, seg, false)
+	size := *flagSize
+	if size < probeHeaderLen {
+		size = probeHeaderLen
+	}
+	if mtu := conn.GetMTU(); size > mtu {
+		fatalf("Probe size %d exceeds the MTU of %d bytes", size, mtu)
+	}
+	fmt.Printf("DCCP PING %s (%s over %s): %d data bytes\n", addr, raddr, *flagNet, size)
+
+	p := &pinger{received: make(map[int64]bool), open: make(chan int)}
+	done := make(chan int)
+	go p.readLoop(conn, done)
+	if err := conn.Write(newProbe(warmUpSeq, size)); err != nil {
+		fatalf("Error writing (%s)", err)
+	}
+	select {
+	case <-p.open:
+	case <-time.After(openTimeout):
+		fatalf("No response from %s", addr)
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	interval := time.Duration(*flagInterval * 1e9)
+	for seq := int64(0); *flagCount <= 0 || seq < int64(*flagCount); seq++ {
+		if err := conn.Write(newProbe(seq, size)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing probe %d (%s)\n", seq, err)
+			break
+		}
+		p.Lock()
+		p.sent++
+		p.Unlock()
+		select {
+		case <-time.After(interval):
+			continue
+		case <-interrupt:
+		}
+		break
+	}
+
+	// Wait for the echoes of the last probes
+	deadline := time.Now().Add(time.Duration(*flagWait * 1e9))
+	for time.Now().Before(deadline) && !p.complete() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	features := conn.Features()
+	stats := conn.Stats()
+	conn.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+	}
+	p.report(addr, features, stats)
+}
+
+// newProbe returns a probe of size bytes with sequence number seq, stamped with the current time
+func newProbe(seq int64, size int) []byte {
+	probe := make([]byte, size)
+	binary.BigEndian.PutUint64(probe[0:8], uint64(seq))
+	binary.BigEndian.PutUint64(probe[8:16], uint64(time.Now().UnixNano()))
+	return probe
+}
+
+// readLoop prints the echoes of the probes as they arrive
+func (p *pinger) readLoop(conn *dccp.Conn, done chan int) {
+	defer close(done)
+	for {
+		b, err := conn.Read()
+		if err != nil {
+			return
+		}
+		if len(b) < probeHeaderLen {
+			continue
+		}
+		seq := int64(binary.BigEndian.Uint64(b[0:8]))
+		if seq == warmUpSeq {
+			close(p.open)
+			continue
+		}
+		rtt := float64(time.Now().UnixNano()-int64(binary.BigEndian.Uint64(b[8:16]))) / 1e6
+		p.Lock()
+		dup := ""
+		if p.received[seq] {
+			dup = " (DUP!)"
+		} else {
+			p.received[seq] = true
+			p.rtts = append(p.rtts, rtt)
+		}
+		p.Unlock()
+		fmt.Printf("%d bytes: seq=%d time=%.3f ms%s\n", len(b), seq, rtt, dup)
+	}
+}
+
+// complete returns true if an echo of every probe sent has arrived
+func (p *pinger) complete() bool {
+	p.Lock()
+	defer p.Unlock()
+	return int64(len(p.received)) >= p.sent
+}
+
+func (p *pinger) report(addr string, features dccp.Features, stats dccp.ConnStats) {
+	p.Lock()
+	defer p.Unlock()
+	fmt.Printf("\n--- %s dccp ping statistics ---\n", addr)
+	var loss float64
+	if p.sent > 0 {
+		loss = 100 * float64(p.sent-int64(len(p.received))) / float64(p.sent)
+	}
+	fmt.Printf("%d probes transmitted, %d received, %.1f%% loss\n", p.sent, len(p.received), loss)
+	if len(p.rtts) > 0 {
+		min, max, sum, sum2 := math.Inf(1), math.Inf(-1), 0.0, 0.0
+		for _, rtt := range p.rtts {
+			min, max = math.Min(min, rtt), math.Max(max, rtt)
+			sum += rtt
+			sum2 += rtt * rtt
+		}
+		n := float64(len(p.rtts))
+		avg := sum / n
+		mdev := math.Sqrt(math.Max(sum2/n-avg*avg, 0))
+		fmt.Printf("rtt min/avg/max/mdev = %.3f/%.3f/%.3f/%.3f ms\n", min, avg, max, mdev)
+	}
+	fmt.Printf("features: service code %d, CCID %d/%d, sequence window %d/%d, MPS %d, RTT estimate %.3f ms\n",
+		features.ServiceCode, features.CCIDA, features.CCIDB, features.SWAF, features.SWBF,
+		features.MPS, float64(features.RTT)/1e6)
+	fmt.Printf("suspect resets %d, suspect packets %d, violations %d\n",
+		stats.SuspectResets, stats.SuspectPackets, stats.Violations)
+}
@@ -0,0 +1,323 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+// dccp-proxy relays UDP datagrams over DCCP connections, so that existing UDP applications
+// gain DCCP congestion control without changes. A pair of proxies is needed, one at each end:
+//
+// The ingress proxy, started with -udp, receives datagrams from applications at a local UDP
+// address. It opens a DCCP connection to the egress proxy for each UDP source address, and
+// sends the replies that arrive over the connection back to that source.
+//
+// The egress proxy, started with -listen, accepts DCCP connections. For each connection, it
+// sends the datagrams to the target UDP address from a new UDP socket, and relays the replies
+// to that socket back over the connection.
+//
+// Datagrams are relayed one per DCCP packet. Like UDP, the proxy drops datagrams rather than
+// delay them: when the congestion control holds back a connection, datagrams beyond the
+// ones already queued are lost, as are datagrams that exceed the MTU of the connection.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+	"github.com/petar/GoDCCP/dccp"
+	"github.com/petar/GoDCCP/dccp/ccid3"
+)
+
+var (
+	flagUDP     *string  = flag.String("udp", "", "Relay datagrams received at this UDP address to the egress proxy")
+	flagListen  *string  = flag.String("listen", "", "Accept DCCP connections at this address, and relay them to the target")
+	flagIdle    *float64 = flag.Float64("idle", 60, "Seconds of inactivity after which a connection is closed; zero keeps it open")
+	flagService *uint    = flag.Uint("service", 0, "Service code of the connections")
+	flagRate    *uint    = flag.Uint("rate", 0, "Fixed send rate in packets per second; zero leaves it to CCID 3")
+	flagVerbose *bool    = flag.Bool("v", false, "Print the opening and closing of connections")
+	flagTrace   *string  = flag.String("trace", "", "Log file for the DCCP trace of the connections")
+)
+
+// queueLen is the number of datagrams that each connection holds, while its congestion
+// control does not allow them to be sent
+const queueLen = 64
+
+func usage() {
+	fmt.Printf("%s [optional_flags] -udp host:port egress_host:port\n", os.Args[0])
+	fmt.Printf("%s [optional_flags] -listen host:port target_host:port\n", os.Args[0])
+	flag.PrintDefaults()
+	os.Exit(1)
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
+
+func main() {
+	flag.Parse()
+	nonflags := flag.Args()
+	switch {
+	case len(nonflags) != 1 || (*flagUDP == "") == (*flagListen == ""):
+		usage()
+	case *flagUDP != "":
+		ingress(*flagUDP, nonflags[0])
+	default:
+		egress(*flagListen, nonflags[0])
+	}
+}
+
+func resolve(addr string) *net.UDPAddr {
+	a, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		fatalf("Error resolving %s (%s)", addr, err)
+	}
+	return a
+}
+
+// newEnv creates the Env of the connections, which writes a trace to the -trace file
+func newEnv() *dccp.Env {
+	if *flagTrace == "" {
+		env := dccp.NewEnv(nil)
+		env.SetTraceFilter("", dccp.LevelOff)
+		return env
+	}
+	return dccp.NewEnv(dccp.NewFileTraceWriter(*flagTrace))
+}
+
+// newConn creates a connection with CCID 3 over seg, whose send rate is fixed by -rate
+func newConn(env *dccp.Env, seg dccp.SegmentConn, server bool) *dccp.Conn {
+	label := "ingress"
+	if server {
+		label = "egress"
+	}
+	amb := dccp.NewAmb(label, env)
+	if *flagRate > 0 {
+		amb.Flags().SetUint32("FixRate", uint32(*flagRate))
+	}
+	hc := dccp.NewHeaderConn(seg)
+	ccid := ccid3.CCID3{}
+	if server {
+		return dccp.NewConnServer(env, amb, hc, ccid.NewSender(env, amb), ccid.NewReceiver(env, amb))
+	}
+	return dccp.NewConnClient(env, amb, hc, ccid.NewSender(env, amb), ccid.NewReceiver(env, amb), uint32(*flagService))
+}
+
+// ingress relays the datagrams received at the UDP address udpAddr over DCCP connections to
+// the egress proxy at egressAddr, one connection per UDP source address
+func ingress(udpAddr, egressAddr string) {
+	raddr := resolve(egressAddr)
+	uc, err := net.ListenUDP("udp", resolve(udpAddr))
+	if err != nil {
+		fatalf("Error binding %s (%s)", udpAddr, err)
+	}
+	link, err := dccp.BindUDPLink("udp", nil)
+	if err != nil {
+		fatalf("Error binding (%s)", err)
+	}
+	env, mux := newEnv(), dccp.NewMux(link)
+	defer env.Close()
+	fmt.Printf("Relaying datagrams from %s to %s\n", udpAddr, egressAddr)
+
+	var lk sync.Mutex
+	sessions := make(map[string]*session)
+	buf := make([]byte, 1<<16)
+	for {
+		n, src, err := uc.ReadFromUDP(buf)
+		if err != nil {
+			fatalf("Error reading %s (%s)", udpAddr, err)
+		}
+		key := src.String()
+		lk.Lock()
+		s := sessions[key]
+		if s == nil {
+			seg, err := mux.Dial(raddr)
+			if err != nil {
+				lk.Unlock()
+				fmt.Fprintf(os.Stderr, "Error dialing %s (%s)\n", egressAddr, err)
+				continue
+			}
+			s = newSession(key, newConn(env, seg, false))
+			sessions[key] = s
+			go func(s *session, src *net.UDPAddr) {
+				s.readLoop(func(p []byte) { uc.WriteToUDP(p, src) })
+				lk.Lock()
+				delete(sessions, s.name)
+				lk.Unlock()
+			}(s, src)
+		}
+		lk.Unlock()
+		s.forward(buf[:n])
+	}
+}
+
+// egress accepts DCCP connections at listenAddr, and relays their datagrams to the UDP
+// address targetAddr
+func egress(listenAddr, targetAddr string) {
+	taddr := resolve(targetAddr)
+	link, err := dccp.BindUDPLink("udp", resolve(listenAddr))
+	if err != nil {
+		fatalf("Error binding %s (%s)", listenAddr, err)
+	}
+	env, mux := newEnv(), dccp.NewMux(link)
+	defer env.Close()
+	fmt.Printf("Relaying connections at %s to %s\n", listenAddr, targetAddr)
+	for {
+		seg, err := mux.Accept()
+		if err != nil {
+			fatalf("Error accepting (%s)", err)
+		}
+		go relay(newConn(env, seg, true), taddr)
+	}
+}
+
+// relay relays the datagrams of conn to and from taddr, from a UDP socket of its own
+func relay(conn *dccp.Conn, taddr *net.UDPAddr) {
+	uc, err := net.DialUDP("udp", nil, taddr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error dialing %s (%s)\n", taddr, err)
+		conn.Close()
+		return
+	}
+	s := newSession(fmt.Sprintf("%s", conn.RemoteLabel()), conn)
+	go func() {
+		buf := make([]byte, 1<<16)
+		for {
+			n, err := uc.Read(buf)
+			if err != nil {
+				// Errors due to ICMP messages from the target do not end the session
+				if s.isClosed() {
+					return
+				}
+				continue
+			}
+			s.forward(buf[:n])
+		}
+	}()
+	s.readLoop(func(p []byte) { uc.Write(p) })
+	uc.Close()
+}
+
+// session relays the datagrams of one UDP flow over a DCCP connection
+type session struct {
+	sync.Mutex
+	name     string
+	conn     *dccp.Conn
+	mtu      int
+	out      chan []byte // Datagrams awaiting their turn to be sent over conn
+	last     time.Time   // Time of the latest datagram in either direction
+	closed   bool
+	relayed  int64 // Datagrams sent over conn
+	returned int64 // Datagrams received over conn
+	dropped  int64 // Datagrams dropped, because the queue was full or they exceeded the MTU
+}
+
+func newSession(name string, conn *dccp.Conn) *session {
+	s := &session{
+		name: name,
+		conn: conn,
+		mtu:  conn.GetMTU(),
+		out:  make(chan []byte, queueLen),
+		last: time.Now(),
+	}
+	if *flagVerbose {
+		fmt.Printf("%s: opened\n", name)
+	}
+	go s.writeLoop()
+	go s.watch()
+	return s
+}
+
+// forward queues the datagram p for sending over the connection, or drops it if the queue is full
+func (s *session) forward(p []byte) {
+	s.Lock()
+	defer s.Unlock()
+	if s.closed {
+		return
+	}
+	s.last = time.Now()
+	if len(p) > s.mtu {
+		s.dropped++
+		return
+	}
+	select {
+	case s.out <- append([]byte(nil), p...):
+	default:
+		s.dropped++
+	}
+}
+
+// writeLoop sends the queued datagrams over the connection, as fast as its congestion
+// control allows
+func (s *session) writeLoop() {
+	for p := range s.out {
+		if err := s.conn.Write(p); err != nil {
+			s.close()
+			return
+		}
+		s.Lock()
+		s.relayed++
+		s.Unlock()
+	}
+}
+
+// readLoop passes the datagrams received over the connection to deliver, until the
+// connection ends
+func (s *session) readLoop(deliver func([]byte)) {
+	for {
+		p, err := s.conn.Read()
+		if err != nil {
+			s.close()
+			return
+		}
+		s.Lock()
+		s.last = time.Now()
+		s.returned++
+		s.Unlock()
+		deliver(p)
+	}
+}
+
+// watch closes the session once it has been idle for -idle seconds
+func (s *session) watch() {
+	idle := time.Duration(*flagIdle * 1e9)
+	if idle <= 0 {
+		return
+	}
+	for {
+		time.Sleep(idle / 4)
+		s.Lock()
+		closed, last := s.closed, s.last
+		s.Unlock()
+		switch {
+		case closed:
+			return
+		case time.Since(last) > idle:
+			s.close()
+			return
+		}
+	}
+}
+
+func (s *session) isClosed() bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.closed
+}
+
+func (s *session) close() {
+	s.Lock()
+	if s.closed {
+		s.Unlock()
+		return
+	}
+	s.closed = true
+	close(s.out)
+	relayed, returned, dropped := s.relayed, s.returned, s.dropped
+	s.Unlock()
+	s.conn.Close()
+	if *flagVerbose {
+		fmt.Printf("%s: closed, %d datagrams relayed, %d returned, %d dropped\n", s.name, relayed, returned, dropped)
+	}
+}
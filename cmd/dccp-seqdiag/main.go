@@ -0,0 +1,55 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+// dccp-seqdiag renders the packets exchanged in a sandbox run, as recorded in a DCCP log
+// file, as a client/server sequence diagram in Mermaid or PlantUML syntax.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	dccp_gauge "github.com/petar/GoDCCP/dccp/gauge"
+)
+
+var flagFormat *string = flag.String("format", "mermaid", "Diagram format: mermaid, plantuml")
+
+func usage() {
+	fmt.Printf("%s [optional_flags] log_file\n", os.Args[0])
+	flag.PrintDefaults()
+	os.Exit(1)
+}
+
+func main() {
+	flag.Parse()
+	nonflags := flag.Args()
+	if len(nonflags) == 0 {
+		usage()
+	}
+
+	var format int
+	switch *flagFormat {
+	case "mermaid":
+		format = dccp_gauge.SeqDiagMermaid
+	case "plantuml":
+		format = dccp_gauge.SeqDiagPlantUML
+	default:
+		usage()
+	}
+
+	logFile, err := os.Open(nonflags[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening log (%s)\n", err)
+		os.Exit(1)
+	}
+	defer logFile.Close()
+	emits, err := dccp_gauge.ReadTraces(logFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Terminated unexpectedly (%s).\n", err)
+	}
+	if err = dccp_gauge.WriteSequenceDiagram(os.Stdout, emits, format); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing diagram (%s)\n", err)
+		os.Exit(1)
+	}
+}
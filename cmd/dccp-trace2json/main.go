@@ -0,0 +1,69 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+// dccp-trace2json converts a binary DCCP log file into the JSON log format, which is read by
+// the inspector and other tools.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+var flagOut *string = flag.String("out", "", "Output file; standard output if empty")
+
+func usage() {
+	fmt.Printf("%s [optional_flags] binary_log_file\n", os.Args[0])
+	flag.PrintDefaults()
+	os.Exit(1)
+}
+
+func main() {
+	flag.Parse()
+	nonflags := flag.Args()
+	if len(nonflags) == 0 {
+		usage()
+	}
+
+	logFile, err := os.Open(nonflags[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening log (%s)\n", err)
+		os.Exit(1)
+	}
+	defer logFile.Close()
+	rd, err := dccp.NewBinaryTraceReader(logFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Not a binary log (%s)\n", err)
+		os.Exit(1)
+	}
+
+	var w io.Writer = os.Stdout
+	if *flagOut != "" {
+		f, err := os.Create(*flagOut)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating output (%s)\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		w = f
+	}
+	jw := dccp.NewJSONTraceWriter(w)
+	var n int
+	for {
+		rec, err := rd.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Terminated unexpectedly (%s).\n", err)
+			break
+		}
+		jw.Write(rec)
+		n++
+	}
+	fmt.Fprintf(os.Stderr, "Converted %d records.\n", n)
+}
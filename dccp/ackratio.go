@@ -0,0 +1,52 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import "fmt"
+
+// Section 11.3: The Ack Ratio feature is located at the HC-Sender and tells the HC-Receiver
+// how many data packets it may receive per Ack. GoDCCP leaves the choice of Ack Ratio to the
+// congestion controls: a sender CCID implementing AckRatioSender sets the local Ack Ratio, and
+// a receiver CCID implementing AckRatioReceiver is told the Ack Ratio of the peer.
+
+// adjustAckRatio renegotiates the local Ack Ratio when the sender CCID wishes another one
+func (c *Conn) adjustAckRatio() {
+	c.AssertLocked()
+	ars, ok := c.scc().(AckRatioSender)
+	if !ok {
+		return
+	}
+	state := c.socket.GetState()
+	if state != OPEN && state != PARTOPEN {
+		return
+	}
+	r := ars.AckRatio()
+	if r <= 0 {
+		return
+	}
+	want := uint64(r)
+	if max := featureInfos[FeatureAckRatio].max; want > max {
+		want = max
+	}
+	k := featureKey{FeatureLocal, FeatureAckRatio}
+	f := c.feature(k)
+	current := f.value
+	if f.state != featureStable {
+		current = f.prefs[0]
+	}
+	if want == current {
+		return
+	}
+	c.amb.E(EventInfo, fmt.Sprintf("Sender CCID wants Ack Ratio %d instead of %d", want, current))
+	c.changeFeature(k, []uint64{want})
+}
+
+// syncAckRatio tells the receiver CCID the current Ack Ratio of the peer
+func (c *Conn) syncAckRatio() {
+	c.AssertLocked()
+	if arr, ok := c.rcc().(AckRatioReceiver); ok {
+		arr.SetAckRatio(int(c.feature(featureKey{FeatureRemote, FeatureAckRatio}).value))
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+// DefaultAckRatio is the Ack Ratio of the half-connection until the Conn sets it, Section 11.3
+const DefaultAckRatio = 2
+
+// AckReceiver acknowledges data packets on behalf of a receiver CCID whose sender learns of
+// the delivered packets from Ack Vectors, and of the round-trip time from Timestamp Echoes.
+// It asks for an Ack every Ack Ratio data packets, and once every round-trip time of idleness,
+// and places on each Ack an echo of the latest Timestamp of the sender, and an Ack Vector when
+// the Send Ack Vector feature is on. AckReceiver does no locking; the CCID must serialize the
+// calls to it. Open must be called before first use.
+type AckReceiver struct {
+	AckVectorRecorder
+	ackRatio      int
+	sendAckVector bool
+	dataSinceAck  int    // Data packets received since the latest Ack was sent
+	echo          uint32 // Latest Timestamp of the sender, to be echoed
+	echoTime      int64  // Time of arrival of echo, or zero if there is nothing to echo
+}
+
+// Open resets the receiver for a new half-connection. The Ack Ratio and the Send Ack Vector
+// setting outlive it, as the Conn may set them before the CCID opens.
+func (x *AckReceiver) Open() {
+	x.AckVectorRecorder = AckVectorRecorder{}
+	if x.ackRatio == 0 {
+		x.ackRatio = DefaultAckRatio
+	}
+	x.dataSinceAck = 0
+	x.echoTime = 0
+}
+
+// SetAckRatio sets the number of data packets received per Ack
+func (x *AckReceiver) SetAckRatio(ratio int) {
+	if ratio > 0 {
+		x.ackRatio = ratio
+	}
+}
+
+// SetSendAckVector turns the Ack Vectors on or off
+func (x *AckReceiver) SetSendAckVector(on bool) {
+	x.sendAckVector = on
+}
+
+// OnWrite places a Timestamp Echo and an Ack Vector on ph, if it is an acknowledgement, and
+// returns whether it is
+func (x *AckReceiver) OnWrite(ph *PreHeader) bool {
+	if ph.Type != Ack && ph.Type != DataAck {
+		return false
+	}
+	x.dataSinceAck = 0
+	if x.echoTime != 0 {
+		elapsed := ph.TimeWrite - x.echoTime
+		if elapsed < 0 {
+			elapsed = 0
+		}
+		(&TimestampEchoOption{ Timestamp: x.echo, Elapsed: TenMicroFromNano(elapsed) }).Place(ph)
+		x.echoTime = 0
+	}
+	if x.sendAckVector {
+		if av := x.AckVectorRecorder.Option(ph.AckNo); av != nil {
+			av.Place(ph)
+		}
+	}
+	return true
+}
+
+// OnRead records the packet for the Ack Vectors and its Timestamp for the echo, and returns
+// CongestionAck once Ack Ratio data packets have arrived since the latest Ack
+func (x *AckReceiver) OnRead(ff *FeedforwardHeader) error {
+	x.AckVectorRecorder.OnRead(ff.SeqNo, ff.ECN)
+	if ts := ff.Timestamp; ts != nil {
+		x.echo, x.echoTime = ts.Timestamp, ff.Time
+	}
+	if ff.Type != Data && ff.Type != DataAck {
+		return nil
+	}
+	x.dataSinceAck++
+	if x.dataSinceAck >= x.ackRatio {
+		return CongestionAck
+	}
+	return nil
+}
+
+// OnIdle returns CongestionAck when data packets have gone unacknowledged
+func (x *AckReceiver) OnIdle() error {
+	if x.dataSinceAck > 0 {
+		return CongestionAck
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+// Ack Vector States, Section 11.4.1
+const (
+	AckVectorReceived    = 0 // Received
+	AckVectorECNMarked   = 1 // Received ECN Marked
+	AckVectorNotReceived = 3 // Not Yet Received
+)
+
+// AckVectorOption, Section 11.4
+// The option reports the states of the packets that its sender has received, in run-length
+// encoded cells that count back from the Acknowledgement Number of the packet carrying it.
+// Each cell describes a run of up to 64 consecutive packets in the same State.
+type AckVectorOption struct {
+	Nonce byte           // ECN Nonce Echo, 0 or 1, which selects Ack Vector option 38 or 39
+	Runs  []AckVectorRun // Runs in decreasing order of sequence number
+}
+
+// AckVectorRun is a cell of an Ack Vector
+type AckVectorRun struct {
+	State byte // Ack Vector State, Section 11.4.1
+	Len   int  // Number of packets in the run, 1 to 64
+}
+
+const (
+	ackVectorMaxRun   = 64  // Maximum number of packets of a cell
+	ackVectorMaxCells = 253 // Maximum number of cells of an option
+)
+
+func (opt *AckVectorOption) Encode() (*Option, error) {
+	if len(opt.Runs) == 0 || len(opt.Runs) > ackVectorMaxCells {
+		return nil, ErrSize
+	}
+	d, err := opt.encode(make([]byte, len(opt.Runs)))
+	if err != nil {
+		return nil, err
+	}
+	return &Option{
+		Type:      OptionAckVectorNonce0 + opt.Nonce,
+		Data:      d,
+		Mandatory: false,
+	}, nil
+}
+
+// Place places the option on the packet of ph, without allocating
+func (opt *AckVectorOption) Place(ph *PreHeader) error {
+	if len(opt.Runs) == 0 || len(opt.Runs) > ackVectorMaxCells {
+		return ErrSize
+	}
+	var d [ackVectorMaxCells]byte
+	data, err := opt.encode(d[:len(opt.Runs)])
+	if err != nil {
+		return err
+	}
+	ph.AddOption(OptionAckVectorNonce0 + opt.Nonce, data, false)
+	return nil
+}
+
+// encode encodes the runs of the option into d, which must have one byte per run
+func (opt *AckVectorOption) encode(d []byte) ([]byte, error) {
+	if opt.Nonce > 1 {
+		return nil, ErrOption
+	}
+	for i, run := range opt.Runs {
+		if run.Len < 1 || run.Len > ackVectorMaxRun || (run.State != AckVectorReceived &&
+			run.State != AckVectorECNMarked && run.State != AckVectorNotReceived) {
+			return nil, ErrOption
+		}
+		d[i] = run.State<<6 | byte(run.Len-1)
+	}
+	return d, nil
+}
+
+func DecodeAckVectorOption(opt *Option) *AckVectorOption {
+	r := &AckVectorOption{}
+	if !decodeAckVectorOption(opt, r) {
+		return nil
+	}
+	return r
+}
+
+// decodeAckVectorOption decodes opt into r, reusing the Runs of r, and returns false if opt
+// is not a valid Ack Vector
+func decodeAckVectorOption(opt *Option, r *AckVectorOption) bool {
+	if (opt.Type != OptionAckVectorNonce0 && opt.Type != OptionAckVectorNonce1) || len(opt.Data) == 0 {
+		return false
+	}
+	r.Nonce, r.Runs = opt.Type - OptionAckVectorNonce0, r.Runs[:0]
+	for _, b := range opt.Data {
+		r.Runs = append(r.Runs, AckVectorRun{ State: b >> 6, Len: int(b&0x3f) + 1 })
+	}
+	return true
+}
+
+// Each calls f with the sequence number and the State of every packet that the option
+// describes, when it is received on a packet with Acknowledgement Number ackNo. The packets
+// are visited in decreasing order of sequence number. Section 11.4.1: The reserved State 2
+// is reported as Not Yet Received.
+func (opt *AckVectorOption) Each(ackNo int64, f func(seqNo int64, state byte)) {
+	seqNo := ackNo
+	for _, run := range opt.Runs {
+		state := run.State
+		if state == 2 {
+			state = AckVectorNotReceived
+		}
+		for n := 0; n < run.Len; n++ {
+			f(seqNo, state)
+			seqNo--
+		}
+	}
+}
+
+// Received returns true if the option, received on a packet with Acknowledgement Number ackNo,
+// reports the packet seqNo as received, ECN marked or not
+func (opt *AckVectorOption) Received(ackNo, seqNo int64) bool {
+	if seqNo > ackNo {
+		return false
+	}
+	back := ackNo - seqNo
+	for _, run := range opt.Runs {
+		if back < int64(run.Len) {
+			return run.State == AckVectorReceived || run.State == AckVectorECNMarked
+		}
+		back -= int64(run.Len)
+	}
+	return false
+}
+
+// AckVectorRecorderLen is the number of packets, up to the greatest sequence number received,
+// whose States an AckVectorRecorder remembers
+const AckVectorRecorderLen = 256
+
+// AckVectorRecorder keeps the States of the packets that an HC-Receiver has received, for the
+// Ack Vectors that it sends. The zero value is ready to use.
+type AckVectorRecorder struct {
+	started bool
+	gsr     int64 // Greatest sequence number recorded
+	low     int64 // Smallest sequence number whose State is remembered
+	states  [AckVectorRecorderLen]byte
+}
+
+// OnRead records the receipt of the packet with sequence number seqNo and ECN codepoint ecn
+func (r *AckVectorRecorder) OnRead(seqNo int64, ecn byte) {
+	state := byte(AckVectorReceived)
+	if ecn == ECNCE {
+		state = AckVectorECNMarked
+	}
+	switch {
+	case !r.started:
+		r.started, r.gsr, r.low = true, seqNo, seqNo
+	case seqNo > r.gsr:
+		// The packets skipped over have not been received yet
+		for s := max64(r.gsr+1, seqNo-AckVectorRecorderLen+1); s < seqNo; s++ {
+			r.states[s%AckVectorRecorderLen] = AckVectorNotReceived
+		}
+		r.gsr = seqNo
+		r.low = max64(r.low, seqNo-AckVectorRecorderLen+1)
+	case seqNo < r.low:
+		return
+	}
+	r.states[seqNo%AckVectorRecorderLen] = state
+}
+
+// Option returns the Ack Vector for a packet with Acknowledgement Number ackNo, which covers
+// the remembered packets up to ackNo, or nil if ackNo has not been recorded
+func (r *AckVectorRecorder) Option(ackNo int64) *AckVectorOption {
+	if !r.started || ackNo > r.gsr || ackNo < r.low {
+		return nil
+	}
+	opt := &AckVectorOption{}
+	for s := ackNo; s >= r.low; s-- {
+		state := r.states[s%AckVectorRecorderLen]
+		if k := len(opt.Runs); k > 0 && opt.Runs[k-1].State == state && opt.Runs[k-1].Len < ackVectorMaxRun {
+			opt.Runs[k-1].Len++
+			continue
+		}
+		if len(opt.Runs) == ackVectorMaxCells {
+			break
+		}
+		opt.Runs = append(opt.Runs, AckVectorRun{ State: state, Len: 1 })
+	}
+	return opt
+}
@@ -0,0 +1,78 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestAckVectorOption(t *testing.T) {
+	runs := []AckVectorRun{
+		{ State: AckVectorReceived, Len: 64 },
+		{ State: AckVectorNotReceived, Len: 2 },
+		{ State: AckVectorECNMarked, Len: 1 },
+	}
+	opt, err := (&AckVectorOption{ Nonce: 1, Runs: runs }).Encode()
+	if err != nil {
+		t.Fatalf("encode (%s)", err)
+	}
+	want := []byte{63, 3<<6 | 1, 1 << 6}
+	if opt.Type != OptionAckVectorNonce1 || !bytes.Equal(opt.Data, want) {
+		t.Errorf("encoded %d % x, expecting % x", opt.Type, opt.Data, want)
+	}
+	dec := DecodeAckVectorOption(opt)
+	if dec == nil || dec.Nonce != 1 || !reflect.DeepEqual(dec.Runs, runs) {
+		t.Errorf("decoded %v, expecting %v", dec, runs)
+	}
+	var seqNos []int64
+	dec.Each(1000, func(seqNo int64, state byte) {
+		if state != AckVectorReceived {
+			seqNos = append(seqNos, seqNo)
+		}
+	})
+	if !reflect.DeepEqual(seqNos, []int64{936, 935, 934}) {
+		t.Errorf("packets not received %v", seqNos)
+	}
+	for seqNo, want := range map[int64]bool{1001: false, 1000: true, 935: false, 934: true, 933: false} {
+		if dec.Received(1000, seqNo) != want {
+			t.Errorf("received %d is %v, expecting %v", seqNo, !want, want)
+		}
+	}
+	if _, err := (&AckVectorOption{ Runs: []AckVectorRun{{ State: 2, Len: 1 }} }).Encode(); err == nil {
+		t.Errorf("encoded the reserved state")
+	}
+}
+
+func TestAckVectorRecorder(t *testing.T) {
+	var r AckVectorRecorder
+	if r.Option(0) != nil {
+		t.Errorf("option before any packet")
+	}
+	for _, s := range []int64{100, 101, 104, 103, 105} {
+		r.OnRead(s, ECNNotECT)
+	}
+	r.OnRead(106, ECNCE)
+	want := []AckVectorRun{
+		{ State: AckVectorECNMarked, Len: 1 },
+		{ State: AckVectorReceived, Len: 3 },
+		{ State: AckVectorNotReceived, Len: 1 },
+		{ State: AckVectorReceived, Len: 2 },
+	}
+	if opt := r.Option(106); opt == nil || !reflect.DeepEqual(opt.Runs, want) {
+		t.Errorf("option %v, expecting %v", opt, want)
+	}
+	// A jump beyond the recorder forgets the old packets
+	r.OnRead(106+AckVectorRecorderLen, ECNNotECT)
+	opt := r.Option(106 + AckVectorRecorderLen)
+	n := 0
+	for _, run := range opt.Runs {
+		n += run.Len
+	}
+	if n != AckVectorRecorderLen || opt.Runs[0].State != AckVectorReceived {
+		t.Errorf("option after jump %v", opt)
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+// Section 11.5: The Send Ack Vector feature is located at the HC-Receiver and tells it whether
+// to send Ack Vectors. GoDCCP leaves Ack Vectors to the congestion controls, and agrees to use
+// them only if the CCID of the respective half-connection implements AckVectorSender or
+// AckVectorReceiver.
+
+// supportsAckVector returns true if the CCID concerned by the Send Ack Vector feature at loc
+// handles Ack Vectors
+func (c *Conn) supportsAckVector(loc FeatureLocation) bool {
+	if loc == FeatureLocal {
+		_, ok := c.rcc().(AckVectorReceiver)
+		return ok
+	}
+	_, ok := c.scc().(AckVectorSender)
+	return ok
+}
+
+// requireAckVector asks the peer with a Mandatory Change to send Ack Vectors, if the sender
+// CCID requires them. It is called before the first handshake packet is sent, and again when
+// CCID negotiation replaces the sender CCID.
+func (c *Conn) requireAckVector() {
+	c.AssertLocked()
+	avs, ok := c.scc().(AckVectorSender)
+	if !ok || !avs.RequiresAckVector() {
+		return
+	}
+	k := featureKey{FeatureRemote, FeatureSendAckVector}
+	f := c.feature(k)
+	if f.mandatory {
+		return // Already asked
+	}
+	f.mandatory = true
+	c.changeFeature(k, []uint64{1})
+}
+
+// syncSendAckVector tells the receiver CCID whether to send Ack Vectors
+func (c *Conn) syncSendAckVector() {
+	c.AssertLocked()
+	if avr, ok := c.rcc().(AckVectorReceiver); ok {
+		avr.SetSendAckVector(c.feature(featureKey{FeatureLocal, FeatureSendAckVector}).value == 1)
+	}
+}
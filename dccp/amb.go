@@ -6,6 +6,7 @@ package dccp
 
 import (
 	"reflect"
+	"sync"
 	"github.com/petar/GoGauge/filter"
 )
 
@@ -24,6 +25,20 @@ type Amb struct {
 	flags  *Flags
 
 	labels []string
+
+	// scope collects the events of this Amb and of the Ambs refined from it, see Conn.Events.
+	// It is shared by all copies of an Amb made with NewAmb.
+	scope  *ambScope
+}
+
+// ambScope holds the buffer of recent events, the correlation ID, the connection number
+// and the state that an Amb and its copies share
+type ambScope struct {
+	sync.Mutex
+	ring  *RingTraceWriter
+	corr  string
+	conn  uint64
+	state string
 }
 
 // A zero-value Amb has the special-case behavior of ignoring all emits
@@ -35,6 +50,7 @@ func NewAmb(label string, env *Env) *Amb {
 		env:    env, 
 		flags:  NewFlags(),
 		labels: []string{label},
+		scope:  &ambScope{},
 	}
 }
 
@@ -67,28 +83,99 @@ func (t *Amb) Push(l string) *Amb {
 	return t
 }
 
+// SetFilter sets the minimum level of events emitted by Ambs of the same Env, whose label
+// stack starts with labelPath. See Env.SetTraceFilter for details.
+func (t *Amb) SetFilter(labelPath string, min Level) {
+	if t.env == nil {
+		return
+	}
+	t.env.SetTraceFilter(labelPath, min)
+}
+
+// setEvents makes the Amb, and every Amb copied from the same NewAmb, record the events
+// they emit in ring. A nil ring stops the recording.
+func (t *Amb) setEvents(ring *RingTraceWriter) {
+	if t.scope == nil {
+		return
+	}
+	t.scope.Lock()
+	defer t.scope.Unlock()
+	t.scope.ring = ring
+}
+
+// events returns the buffer that the events of the Amb are recorded in, or nil
+func (t *Amb) events() *RingTraceWriter {
+	if t.scope == nil {
+		return nil
+	}
+	t.scope.Lock()
+	defer t.scope.Unlock()
+	return t.scope.ring
+}
+
+// SetCorrelation stamps the events of the Amb, and of every Amb copied from the same NewAmb,
+// with the correlation ID corr. Giving the Ambs of both endpoints of a connection the same ID
+// lets tools interleave their traces and match the packets one sends to those the other
+// receives.
+func (t *Amb) SetCorrelation(corr string) {
+	if t.scope == nil {
+		return
+	}
+	t.scope.Lock()
+	defer t.scope.Unlock()
+	t.scope.corr = corr
+}
+
+// Correlation returns the correlation ID set with SetCorrelation
+func (t *Amb) Correlation() string {
+	_, corr, _ := t.scoped()
+	return corr
+}
+
+// setConn stamps the events of the Amb, and of every Amb copied from the same NewAmb, with
+// the number of the connection that owns them
+func (t *Amb) setConn(id uint64) {
+	if t.scope == nil {
+		return
+	}
+	t.scope.Lock()
+	defer t.scope.Unlock()
+	t.scope.conn = id
+}
+
+// scoped returns the event buffer, the correlation ID and the connection number of the Amb
+func (t *Amb) scoped() (*RingTraceWriter, string, uint64) {
+	if t.scope == nil {
+		return nil, "", 0
+	}
+	t.scope.Lock()
+	defer t.scope.Unlock()
+	return t.scope.ring, t.scope.corr, t.scope.conn
+}
+
 func (t *Amb) Filter() *filter.Filter {
 	return t.env.Filter()
 }
 
-// GetState retrieves the state of the owning object, using the runtime value store
+// GetState retrieves the state of the owning object. The state is kept in the scope shared
+// by the Amb and its copies, so connections that share an Env do not see each other's state.
 func (t *Amb) GetState() string {
-	if t.env == nil || len(t.labels) == 0 {
-		return ""
-	}
-	g := t.env.Filter().GetAttr([]string{t.labels[0]}, "state")
-	if g == nil {
+	if t.scope == nil {
 		return ""
 	}
-	return g.(string)
+	t.scope.Lock()
+	defer t.scope.Unlock()
+	return t.scope.state
 }
 
-// SetState saves the state s into the runtime value store
+// SetState saves the state s into the scope of this Amb
 func (t *Amb) SetState(s int) {
-	if t.env == nil {
+	if t.env == nil || t.scope == nil {
 		return
 	}
-	t.env.Filter().SetAttr([]string{t.labels[0]}, "state", StateString(s))
+	t.scope.Lock()
+	defer t.scope.Unlock()
+	t.scope.state = StateString(s)
 }
 
 // E emits a new log record. The arguments args are scanned in turn. The first argument of
@@ -103,38 +190,49 @@ func (t *Amb) EC(skip int, event Event, comment string, args ...interface{}) {
 	if t.env == nil {
 		return
 	}
+	ring, corr, conn := t.scoped()
+	w, x := t.env.TraceWriter(), t.env.expectations()
+	// Expectations see all events, while the trace filters only concern the writers
+	admit := (w != nil || ring != nil) && t.env.admits(t.labels, event)
+	if !admit && x == nil {
+		return
+	}
 	sinceZero, _ := t.env.Snap()
 
 	// Extract header information
 	var hType string = ""
 	var hSeqNo, hAckNo int64
+	var hHeader *Header   // Options of parsed headers are decoded lazily, see below
+	var hOpts []Option
 	logargs := make(map[string]interface{})
 	for _, a := range args {
 		switch t := a.(type) {
 		case *Header:
 			if t != nil {
 				hSeqNo, hAckNo = t.SeqNo, t.AckNo
-				hType = typeString(t.Type)
+				hType = TypeString(t.Type)
+				hHeader = t
 			}
 		case *writeHeader:
 			if t != nil {
 				hSeqNo, hAckNo = t.SeqNo, t.AckNo
-				hType = typeString(t.Type)
+				hType = TypeString(t.Type)
+				hOpts = t.Options
 			}
 		case *PreHeader:
 			if t != nil {
 				hSeqNo, hAckNo = t.SeqNo, t.AckNo
-				hType = typeString(t.Type)
+				hType = TypeString(t.Type)
 			}
 		case *FeedbackHeader:
 			if t != nil {
 				hSeqNo, hAckNo = t.SeqNo, t.AckNo
-				hType = typeString(t.Type)
+				hType = TypeString(t.Type)
 			}
 		case *FeedforwardHeader:
 			if t != nil {
 				hSeqNo = t.SeqNo
-				hType = typeString(t.Type)
+				hType = TypeString(t.Type)
 			}
 		// By default, take the argument's type and use it as a key in the arguments structure
 		default:
@@ -144,24 +242,46 @@ func (t *Amb) EC(skip int, event Event, comment string, args ...interface{}) {
 		}
 	}
 
+	// Expectations do not match options, so they are only formatted for admitted events
+	var hOptions []string
+	if admit {
+		if hHeader != nil {
+			hOpts = hHeader.GetOptions()
+		}
+		hOptions = optionStrings(hOpts)
+	}
+
 	sfile, sline := FetchCaller(1+skip)
 
-	if t.env.TraceWriter() != nil {
-		r := &Trace{
-			Time:       sinceZero,
-			Labels:     t.labels,
-			Event:      event,
-			State:      t.GetState(),
-			Comment:    comment,
-			Args:       logargs,
-			Type:       hType,
-			SeqNo:      hSeqNo,
-			AckNo:      hAckNo,
-			SourceFile: sfile,
-			SourceLine: sline,
-			Trace:      StackTrace(t.labels, skip+2, sfile, sline),
-		}
-		t.env.TraceWriter().Write(r)
+	r := &Trace{
+		Time:       sinceZero,
+		Labels:     t.labels,
+		Corr:       corr,
+		Conn:       conn,
+		Event:      event,
+		State:      t.GetState(),
+		Comment:    comment,
+		Args:       logargs,
+		Type:       hType,
+		SeqNo:      hSeqNo,
+		AckNo:      hAckNo,
+		Options:    hOptions,
+		SourceFile: sfile,
+		SourceLine: sline,
+	}
+	if x != nil {
+		x.observe(r)
+	}
+	if !admit {
+		return
+	}
+	// The stack trace is costly, and only kept for the TraceWriter of the Env
+	if w != nil {
+		r.Trace = StackTrace(t.labels, skip+2, sfile, sline)
+		w.Write(r)
+	}
+	if ring != nil {
+		ring.Write(r)
 	}
 }
 
@@ -0,0 +1,67 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+// AmplificationFactor is the number of bytes that a server sends towards a client, per byte
+// received from it, until the client has shown that it receives packets at its address.
+// Before then, the address may be spoofed, and the server could otherwise be used to reflect
+// an amplified flood of packets towards a victim.
+const AmplificationFactor = 3
+
+// amplifyLimit counts the bytes exchanged with a peer whose address has not been verified.
+// It is guarded by the Conn Mutex.
+type amplifyLimit struct {
+	unverified bool  // True from LISTEN until the client's address is verified on entering OPEN
+	recv, sent int64 // Bytes received from and sent to the unverified address
+}
+
+// wireSize returns the length of the wire format of gh. For headers that were not read from
+// the wire, the length is computed from the options in gh.Options.
+func (gh *Header) wireSize() int {
+	n := len(gh.rawOptions)
+	if n == 0 {
+		n, _ = gh.getOptionsFootprint()
+	}
+	return getFixedHeaderSize(gh.Type, gh.X) + n + len(gh.Data)
+}
+
+// read accounts for n bytes received from the peer
+func (l *amplifyLimit) read(n int) {
+	if l.unverified {
+		l.recv += int64(n)
+	}
+}
+
+// admit accounts for n bytes about to be sent to the peer. It returns false if they would
+// exceed AmplificationFactor times the bytes received from an unverified peer.
+func (l *amplifyLimit) admit(n int) bool {
+	if !l.unverified {
+		return true
+	}
+	if l.sent+int64(n) > AmplificationFactor*l.recv {
+		return false
+	}
+	l.sent += int64(n)
+	return true
+}
+
+// countRead accounts for a packet received from the peer
+func (c *Conn) countRead(h *Header) {
+	c.AssertLocked()
+	c.amplify.read(h.wireSize())
+}
+
+// admitWrite returns false if h may not be sent, because the client's address has not yet
+// been verified and h would exceed the amplification limit. The write path calls it only
+// while the address is unverified, so verified connections do not take the lock here.
+func (c *Conn) admitWrite(h *Header) bool {
+	c.Lock()
+	defer c.Unlock()
+	if !c.amplify.admit(h.wireSize()) {
+		c.stats.AmplifyLimited++
+		return false
+	}
+	return true
+}
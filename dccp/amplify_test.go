@@ -0,0 +1,54 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"testing"
+)
+
+func TestAmplifyLimit(t *testing.T) {
+	l := amplifyLimit{unverified: true}
+	if l.admit(1) {
+		t.Fatalf("admitted bytes before any were received")
+	}
+	l.read(20)
+	if !l.admit(52) {
+		t.Fatalf("Response to a Request not admitted")
+	}
+	if l.admit(20) {
+		t.Fatalf("admitted more than %d times the bytes received", AmplificationFactor)
+	}
+	l.read(20)
+	if !l.admit(20) {
+		t.Fatalf("not admitted after more bytes were received")
+	}
+	l.unverified = false
+	if !l.admit(1e6) {
+		t.Fatalf("not admitted after verification")
+	}
+}
+
+func TestWireSize(t *testing.T) {
+	gh := &Header{
+		Type:    DataAck,
+		X:       true,
+		Options: []Option{Option{Type: OptionInitCookie, Data: make([]byte, cookieParamsLen+cookieMACLen)}},
+		Data:    []byte{1, 2, 3},
+	}
+	p, err := gh.Write(allocTestSourceIP, allocTestDestIP, 34, false)
+	if err != nil {
+		t.Fatalf("write (%s)", err)
+	}
+	if gh.wireSize() != len(p) {
+		t.Errorf("size %d, expecting %d", gh.wireSize(), len(p))
+	}
+	gh2, err := ReadHeader(p, allocTestSourceIP, allocTestDestIP, 34, false)
+	if err != nil {
+		t.Fatalf("read (%s)", err)
+	}
+	if gh2.wireSize() != len(p) {
+		t.Errorf("read size %d, expecting %d", gh2.wireSize(), len(p))
+	}
+}
@@ -34,19 +34,29 @@ func newBackOff(env *Env, firstSleep, timeout, backoffFreq int64) *backOff {
 // BackoffMin is the minimum time before two firings of the backoff timers
 const BackoffMin = 100e6
 
-// Sleep() blocks for the duration of the next sleep interval in the back-off 
-// sequence and return nil. If the maximum total sleep time has been reached,
-// Sleep() returns os.EOF without sleeping.
-func (b *backOff) Sleep() (error, int64) {
-	if b.lifetime >= b.timeout {
-		return io.EOF, 0
+// Go calls f at the end of every sleep interval in the back-off sequence, for as long as f
+// returns true. The waits are timers of the Env, so f runs on the Env's timer wheel and must
+// not block. If the maximum total sleep time has been reached, f is called one last time with
+// err set to io.EOF.
+func (b *backOff) Go(f func(err error, now int64) bool, fmt_ string, args_ ...interface{}) {
+	var fire func()
+	next := func() {
+		if b.lifetime >= b.timeout {
+			b.env.AfterFunc(0, func() { f(io.EOF, 0) }, fmt_, args_...)
+			return
+		}
+		effectiveSleep := max64(BackoffMin, b.sleep)
+		b.lifetime += effectiveSleep
+		if b.lifetime-b.lastBackoff >= b.backoffFreq {
+			b.sleep = (4 * b.sleep) / 3
+			b.lastBackoff = b.lifetime
+		}
+		b.env.AfterFunc(effectiveSleep, fire, fmt_, args_...)
 	}
-	effectiveSleep := max64(BackoffMin, b.sleep)
-	b.env.Sleep(effectiveSleep)
-	b.lifetime += effectiveSleep
-	if b.lifetime-b.lastBackoff >= b.backoffFreq {
-		b.sleep = (4 * b.sleep) / 3
-		b.lastBackoff = b.lifetime
+	fire = func() {
+		if f(nil, b.env.Now()) {
+			next()
+		}
 	}
-	return nil, b.env.Now()
+	next()
 }
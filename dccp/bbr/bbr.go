@@ -0,0 +1,41 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+// Package bbr implements an experimental model-based congestion control for DCCP, in the
+// style of BBR. Rather than reacting to loss, the sender paces its data packets at a multiple
+// of the estimated bottleneck bandwidth, and limits the data in flight to a multiple of the
+// estimated bandwidth-delay product. The bandwidth is estimated from the delivery rate that
+// the Ack Vectors of the receiver reveal, and the round-trip time from the Timestamp options
+// of the sender that the receiver echoes.
+//
+// The model runs through the phases of BBR: Startup doubles the sending rate each round trip
+// until the bandwidth stops growing, Drain empties the queue that Startup built, ProbeBW
+// cycles the pacing gain around 1 to probe for more bandwidth, and ProbeRTT shrinks the
+// flight every ten seconds to refresh the minimum round-trip time. Rates are counted in
+// packets, as the congestion control does not see the sizes of the packets.
+//
+// The congestion control is meant for research and for exercising the generality of the
+// congestion control interface of package dccp. It is registered under the experimental
+// CCID dccp.CCID_BBR and requires both endpoints to run it.
+package bbr
+
+import (
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// BBR is the factory of the experimental model-based congestion control. Importing this
+// package registers it with dccp.RegisterCCID.
+type BBR struct{}
+
+func init() {
+	dccp.RegisterCCID(dccp.CCID_BBR, BBR{})
+}
+
+func (BBR) NewSender(env *dccp.Env, amb *dccp.Amb) dccp.SenderCongestionControl {
+	return newSender(env, amb)
+}
+
+func (BBR) NewReceiver(env *dccp.Env, amb *dccp.Amb) dccp.ReceiverCongestionControl {
+	return newReceiver(env, amb)
+}
@@ -0,0 +1,326 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package bbr
+
+import (
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// Phases of the model
+const (
+	Startup = iota
+	Drain
+	ProbeBW
+	ProbeRTT
+)
+
+const (
+	HighGain        = 2.885  // Gain of Startup, 2/ln(2), which doubles the rate each round trip
+	BwWindow        = 10     // Number of round trips over which the bottleneck bandwidth is the maximum
+	MinRTTWindow    = 10e9   // Time after which the minimum RTT is refreshed by ProbeRTT
+	ProbeRTTTime    = 200e6  // Time that ProbeRTT holds the flight at MinCwnd
+	FullBwGrowth    = 1.25   // Growth of the bandwidth per round trip, below which Startup is over
+	FullBwRounds    = 3      // Number of round trips without growth that end Startup
+	CwndGain        = 2      // Gain of the congestion window in ProbeBW
+	InitCwnd        = 10     // Congestion window, in packets, until the first measurements
+	MinCwnd         = 4      // Smallest congestion window, in packets
+	MinPacingRate   = 4      // Lowest pacing rate, in packets per second
+)
+
+// probeGains are the pacing gains of the eight phases of the ProbeBW cycle
+var probeGains = [8]float64{1.25, 0.75, 1, 1, 1, 1, 1, 1}
+
+// sentPacket records the state of the delivery rate estimation when a data packet was sent
+type sentPacket struct {
+	SeqNo         int64
+	Sent          int64 // Time of sending
+	Delivered     int64 // Packets delivered when the packet was sent
+	DeliveredTime int64 // Time of the latest delivery when the packet was sent
+	FirstSent     int64 // Time of sending of the packet delivered at DeliveredTime
+	AppLimited    bool  // Whether the application left the flow short of the congestion window
+}
+
+// model estimates the bottleneck bandwidth and the minimum round-trip time of the path, and
+// derives the pacing rate and the congestion window from them. Bandwidths are in packets per
+// second and times in nanoseconds.
+type model struct {
+	state      int
+	pacingGain float64
+	cwndGain   float64
+
+	// Delivery rate estimation
+	delivered     int64 // Number of data packets delivered
+	deliveredTime int64 // Time of the latest delivery
+	firstSent     int64 // Time of sending of the latest packet delivered
+	appLimited    int64 // Rate samples are app-limited until delivered reaches appLimited
+
+	// Round trips are counted by delivery: a round trip ends when a packet sent after the
+	// previous one ended is delivered
+	round      int64
+	nextRound  int64
+	roundStart bool
+
+	bw          maxFilter // Bottleneck bandwidth
+	minRTT      int64     // Minimum round-trip time, or zero if not measured yet
+	minRTTStamp int64     // Time when minRTT was measured
+	srtt        int64     // Smoothed round-trip time, or zero if not measured yet
+
+	fullBw      float64 // Bandwidth at the latest growth during Startup
+	fullBwCount int     // Round trips since the latest growth during Startup
+	filled      bool    // Whether Startup has found the bottleneck bandwidth
+
+	cycleIndex int   // Phase of the ProbeBW cycle
+	cycleStamp int64 // Time when the phase of the ProbeBW cycle began
+
+	probeRTTDone  int64 // Time when ProbeRTT may end, or zero if the flight has not shrunk yet
+	probeRTTRound int64 // Round trip during which the flight shrank in ProbeRTT
+}
+
+// Init resets the model for a new connection
+func (m *model) Init() {
+	*m = model{}
+	m.enter(Startup, 0)
+}
+
+// enter moves the model to the phase state at time now
+func (m *model) enter(state int, now int64) {
+	m.state = state
+	switch state {
+	case Startup:
+		m.pacingGain, m.cwndGain = HighGain, HighGain
+	case Drain:
+		m.pacingGain, m.cwndGain = 1/HighGain, HighGain
+	case ProbeBW:
+		m.cycleIndex, m.cycleStamp = 0, now
+		m.pacingGain, m.cwndGain = probeGains[0], CwndGain
+	case ProbeRTT:
+		m.pacingGain, m.cwndGain = 1, 1
+		m.probeRTTDone = 0
+	}
+}
+
+// OnSend returns the record of a data packet with sequence number seqNo that is sent at time
+// now, when inflight packets are in flight
+func (m *model) OnSend(seqNo, now int64, inflight int) sentPacket {
+	if inflight == 0 {
+		m.firstSent, m.deliveredTime = now, now
+	}
+	return sentPacket{
+		SeqNo:         seqNo,
+		Sent:          now,
+		Delivered:     m.delivered,
+		DeliveredTime: m.deliveredTime,
+		FirstSent:     m.firstSent,
+		AppLimited:    m.appLimited != 0,
+	}
+}
+
+// SetAppLimited marks the rate samples as app-limited until the packets in flight are
+// delivered, when the application does not keep the flow busy
+func (m *model) SetAppLimited(inflight int) {
+	m.appLimited = m.delivered + int64(inflight)
+	if m.appLimited == 0 {
+		m.appLimited = 1
+	}
+}
+
+// OnDeliver accounts for the delivery of the data packet p at time now
+func (m *model) OnDeliver(p *sentPacket, now int64) {
+	m.delivered++
+	m.deliveredTime = now
+	m.firstSent = p.Sent
+	if m.appLimited != 0 && m.delivered > m.appLimited {
+		m.appLimited = 0
+	}
+	if p.Delivered >= m.nextRound {
+		m.nextRound = m.delivered
+		m.round++
+		m.roundStart = true
+	}
+}
+
+// OnRateSample takes the delivery rate sample of p, the latest data packet delivered by an
+// acknowledgement received at time now
+func (m *model) OnRateSample(p *sentPacket, now int64) {
+	interval := now - p.DeliveredTime
+	if sendElapsed := p.Sent - p.FirstSent; sendElapsed > interval {
+		interval = sendElapsed
+	}
+	// Samples over less than the minimum RTT are distorted by acknowledgement compression
+	if interval <= 0 || (m.minRTT > 0 && interval < m.minRTT) {
+		return
+	}
+	rate := float64(m.delivered-p.Delivered) * 1e9 / float64(interval)
+	if p.AppLimited && rate < m.bw.Max() {
+		return
+	}
+	m.bw.Update(m.round, rate)
+}
+
+// OnRTT takes the round-trip time sample rtt, measured at time now
+func (m *model) OnRTT(rtt, now int64) {
+	if rtt <= 0 {
+		return
+	}
+	if m.srtt == 0 {
+		m.srtt = rtt
+	} else {
+		m.srtt = (7*m.srtt + rtt) / 8
+	}
+	expired := m.minRTT > 0 && now-m.minRTTStamp > MinRTTWindow
+	if m.minRTT == 0 || rtt < m.minRTT || (expired && m.state != ProbeRTT) {
+		m.minRTT, m.minRTTStamp = rtt, now
+		if expired && m.state != ProbeRTT {
+			m.enter(ProbeRTT, now)
+		}
+	}
+}
+
+// Update advances the phase of the model after an acknowledgement received at time now, when
+// inflight data packets are in flight and lost data packets have been declared lost since the
+// previous update
+func (m *model) Update(now int64, inflight, lost int) {
+	roundStart := m.roundStart
+	m.roundStart = false
+	bdp := m.BDP()
+	switch m.state {
+	case Startup:
+		if roundStart && !m.filled {
+			m.checkFull()
+		}
+		if m.filled {
+			m.enter(Drain, now)
+		}
+	case Drain:
+		if float64(inflight) <= bdp {
+			m.enter(ProbeBW, now)
+		}
+	case ProbeBW:
+		if m.cycleDone(now, inflight, lost, bdp) {
+			m.cycleIndex = (m.cycleIndex + 1) % len(probeGains)
+			m.cycleStamp = now
+			m.pacingGain = probeGains[m.cycleIndex]
+		}
+	case ProbeRTT:
+		switch {
+		case m.probeRTTDone == 0 && inflight <= MinCwnd:
+			m.probeRTTDone = now + ProbeRTTTime
+			m.probeRTTRound = m.round
+		case m.probeRTTDone != 0 && now >= m.probeRTTDone && m.round > m.probeRTTRound:
+			m.minRTTStamp = now
+			if m.filled {
+				m.enter(ProbeBW, now)
+			} else {
+				m.enter(Startup, now)
+			}
+		}
+	}
+}
+
+// checkFull ends Startup once the bandwidth has not grown by FullBwGrowth for FullBwRounds
+// round trips
+func (m *model) checkFull() {
+	if bw := m.bw.Max(); bw >= m.fullBw*FullBwGrowth {
+		m.fullBw, m.fullBwCount = bw, 0
+		return
+	}
+	m.fullBwCount++
+	m.filled = m.fullBwCount >= FullBwRounds
+}
+
+// cycleDone returns true when the current phase of the ProbeBW cycle is over. Each phase lasts
+// a minimum RTT, except that probing for more bandwidth goes on until the flight has grown or
+// packets are lost, and draining the queue that probing built stops early once it is empty.
+func (m *model) cycleDone(now int64, inflight, lost int, bdp float64) bool {
+	long := now-m.cycleStamp > m.minRTT
+	switch {
+	case m.pacingGain > 1:
+		return long && (lost > 0 || float64(inflight) >= m.pacingGain*bdp)
+	case m.pacingGain < 1:
+		return long || float64(inflight) <= bdp
+	}
+	return long
+}
+
+// BDP returns the estimated bandwidth-delay product of the path in packets, or zero if it has
+// not been measured yet
+func (m *model) BDP() float64 {
+	return m.bw.Max() * float64(m.minRTT) / 1e9
+}
+
+// Cwnd returns the maximum number of data packets in flight
+func (m *model) Cwnd() int {
+	if m.state == ProbeRTT {
+		return MinCwnd
+	}
+	bdp := m.BDP()
+	if bdp == 0 {
+		return InitCwnd
+	}
+	cwnd := int(m.cwndGain*bdp + 0.5)
+	if cwnd < MinCwnd {
+		cwnd = MinCwnd
+	}
+	return cwnd
+}
+
+// PacingRate returns the rate, in packets per second, at which data packets are sent
+func (m *model) PacingRate() float64 {
+	bw := m.bw.Max()
+	if bw == 0 {
+		rtt := m.srtt
+		if rtt == 0 {
+			rtt = dccp.RoundtripDefault
+		}
+		bw = InitCwnd * 1e9 / float64(rtt)
+	}
+	rate := m.pacingGain * bw
+	if rate < MinPacingRate {
+		rate = MinPacingRate
+	}
+	return rate
+}
+
+// RTT returns the smoothed round-trip time, or the default if it has not been measured yet
+func (m *model) RTT() int64 {
+	if m.srtt == 0 {
+		return dccp.RoundtripDefault
+	}
+	return m.srtt
+}
+
+// maxFilter keeps the maximum of the samples taken over the latest BwWindow round trips
+type maxFilter struct {
+	samples []bwSample // Samples of decreasing rate and increasing round
+}
+
+type bwSample struct {
+	round int64
+	rate  float64
+}
+
+// Update adds the sample rate, taken during the round trip round
+func (f *maxFilter) Update(round int64, rate float64) {
+	// Samples that are not greater than the new one cannot be the maximum any more
+	k := len(f.samples)
+	for k > 0 && f.samples[k-1].rate <= rate {
+		k--
+	}
+	f.samples = append(f.samples[:k], bwSample{round, rate})
+	// Samples that have left the window are dropped
+	i := 0
+	for i < len(f.samples) && f.samples[i].round <= round-BwWindow {
+		i++
+	}
+	f.samples = f.samples[i:]
+}
+
+// Max returns the maximum sample in the window, or zero
+func (f *maxFilter) Max() float64 {
+	if len(f.samples) == 0 {
+		return 0
+	}
+	return f.samples[0].rate
+}
@@ -0,0 +1,88 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package bbr
+
+import (
+	"testing"
+)
+
+// TestModel runs the model over a simulated path of 100 packets per second and a round-trip
+// time of 100ms, and checks that it passes through all of its phases and finds the path
+func TestModel(t *testing.T) {
+	type packet struct {
+		sentPacket
+		ack int64
+	}
+	var m model
+	m.Init()
+	var (
+		now, nextSend, arrive int64
+		seqNo                 int64
+		flight                []packet
+		visited               = make(map[int]bool)
+	)
+	for now < 12e9 {
+		visited[m.state] = true
+		if len(flight) < m.Cwnd() && (len(flight) == 0 || nextSend <= flight[0].ack) {
+			if nextSend > now {
+				now = nextSend
+			}
+			p := packet{ sentPacket: m.OnSend(seqNo, now, len(flight)) }
+			seqNo++
+			// The bottleneck is halfway along the path
+			arrive = max64(now+50e6, arrive+10e6)
+			p.ack = arrive + 50e6
+			flight = append(flight, p)
+			nextSend = now + int64(1e9/m.PacingRate())
+			continue
+		}
+		p := flight[0]
+		flight = flight[1:]
+		now = p.ack
+		m.OnRTT(now-p.Sent, now)
+		m.OnDeliver(&p.sentPacket, now)
+		m.OnRateSample(&p.sentPacket, now)
+		m.Update(now, len(flight), 0)
+	}
+	for _, phase := range []int{Startup, Drain, ProbeBW, ProbeRTT} {
+		if !visited[phase] {
+			t.Errorf("phase %s not visited", phaseString(phase))
+		}
+	}
+	if m.state != ProbeBW {
+		t.Errorf("ended in phase %s", phaseString(m.state))
+	}
+	if bw := m.bw.Max(); bw < 90 || bw > 110 {
+		t.Errorf("bottleneck bandwidth %g pps, expecting 100", bw)
+	}
+	if m.minRTT != 100e6 {
+		t.Errorf("minimum RTT %d, expecting 100ms", m.minRTT)
+	}
+}
+
+func max64(x, y int64) int64 {
+	if x > y {
+		return x
+	}
+	return y
+}
+
+func TestMaxFilter(t *testing.T) {
+	var f maxFilter
+	if f.Max() != 0 {
+		t.Errorf("empty filter %g", f.Max())
+	}
+	for round, rate := range []float64{5, 9, 7, 8} {
+		f.Update(int64(round), rate)
+	}
+	if f.Max() != 9 {
+		t.Errorf("max %g, expecting 9", f.Max())
+	}
+	// The maximum leaves the window after BwWindow round trips
+	f.Update(1+BwWindow, 6)
+	if f.Max() != 8 {
+		t.Errorf("max %g after round %d, expecting 8", f.Max(), 1+BwWindow)
+	}
+}
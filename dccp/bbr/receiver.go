@@ -0,0 +1,94 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package bbr
+
+import (
+	"github.com/petar/GoDCCP/dccp"
+)
+
+func newReceiver(env *dccp.Env, amb *dccp.Amb) *receiver {
+	return &receiver{ env: env, amb: amb.Refine("bbr-receiver") }
+}
+
+// receiver implements the model-based congestion control receiver. It acknowledges every
+// Ack Ratio data packets, and once every round-trip time of idleness, echoes the Timestamps
+// of the sender, and sends Ack Vectors when the Send Ack Vector feature is on, see
+// dccp.AckReceiver.
+// It conforms to dccp.ReceiverCongestionControl.
+type receiver struct {
+	env *dccp.Env
+	amb *dccp.Amb
+	dccp.Mutex // Locks all fields below
+	acks dccp.AckReceiver
+	open bool // Whether the CC is active
+}
+
+// GetID returns the CCID of this congestion control algorithm
+func (r *receiver) GetID() byte { return dccp.CCID_BBR }
+
+func (r *receiver) Open() {
+	r.Lock()
+	defer r.Unlock()
+	if r.open {
+		panic("opening an open bbr receiver")
+	}
+	r.acks.Open()
+	r.open = true
+}
+
+// SetAckRatio sets the number of data packets received per Ack
+func (r *receiver) SetAckRatio(ratio int) {
+	r.Lock()
+	defer r.Unlock()
+	r.acks.SetAckRatio(ratio)
+}
+
+// SetSendAckVector turns the Ack Vectors on or off
+func (r *receiver) SetSendAckVector(on bool) {
+	r.Lock()
+	defer r.Unlock()
+	r.acks.SetSendAckVector(on)
+}
+
+// OnWrite places a Timestamp Echo and an Ack Vector on acknowledgements
+func (r *receiver) OnWrite(ph *dccp.PreHeader) {
+	r.Lock()
+	defer r.Unlock()
+	if r.open {
+		r.acks.OnWrite(ph)
+	}
+}
+
+// OnRead records the packets received for the Ack Vectors, and asks for an Ack once Ack Ratio
+// data packets have arrived
+func (r *receiver) OnRead(ff *dccp.FeedforwardHeader) error {
+	r.Lock()
+	defer r.Unlock()
+	if !r.open {
+		return nil
+	}
+	return r.acks.OnRead(ff)
+}
+
+// OnIdle asks for an Ack when data packets have gone unacknowledged
+func (r *receiver) OnIdle(now int64) error {
+	r.Lock()
+	defer r.Unlock()
+	if !r.open {
+		return nil
+	}
+	return r.acks.OnIdle()
+}
+
+func (r *receiver) Close() {
+	r.Lock()
+	defer r.Unlock()
+	r.open = false
+}
+
+// UnderstandsOption returns true for the options that the receiver processes
+func (r *receiver) UnderstandsOption(optionType byte) bool {
+	return optionType == dccp.OptionTimestamp
+}
@@ -0,0 +1,252 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package bbr
+
+import (
+	"fmt"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// PollWait is the longest wait for the congestion window to open, before NextSend is asked again
+const PollWait = 1e6
+
+func newSender(env *dccp.Env, amb *dccp.Amb) *sender {
+	return &sender{ env: env, amb: amb.Refine("bbr-sender") }
+}
+
+// sender implements the model-based congestion control sender.
+// It conforms to dccp.SenderCongestionControl.
+type sender struct {
+	env *dccp.Env
+	amb *dccp.Amb
+	dccp.Mutex // Locks all fields below
+	model
+	flight   []sentPacket // Data packets in flight, in increasing order of sequence number
+	nextSend int64        // Earliest time at which the next data packet may be sent
+	lost     int64        // Number of data packets declared lost
+	open     bool         // Whether the CC is active
+}
+
+// GetID returns the CCID of this congestion control algorithm
+func (s *sender) GetID() byte { return dccp.CCID_BBR }
+
+// GetCCMPS returns the Congestion Control Maximum Packet Size. The model counts packets, so
+// it does not limit their size.
+func (s *sender) GetCCMPS() int32 { return 1e9 }
+
+// GetRTT returns the smoothed round-trip time
+func (s *sender) GetRTT() int64 {
+	s.Lock()
+	defer s.Unlock()
+	return s.model.RTT()
+}
+
+// RequiresAckVector returns true, as the delivery rate is measured from the Ack Vectors
+func (s *sender) RequiresAckVector() bool { return true }
+
+func (s *sender) Open() {
+	s.Lock()
+	defer s.Unlock()
+	if s.open {
+		panic("opening an open bbr sender")
+	}
+	s.model.Init()
+	s.flight = nil
+	s.nextSend = 0
+	s.lost = 0
+	s.open = true
+}
+
+// OnWrite stamps data packets with a Timestamp, for the receiver to echo, and paces them
+func (s *sender) OnWrite(ph *dccp.PreHeader) (ccval int8) {
+	s.Lock()
+	defer s.Unlock()
+	if !s.open || (ph.Type != dccp.Data && ph.Type != dccp.DataAck) {
+		return 0
+	}
+	s.flight = append(s.flight, s.model.OnSend(ph.SeqNo, ph.TimeWrite, len(s.flight)))
+	// The schedule absorbs packets that leave late by less than an interval, so that the
+	// wake-up latency of the write loop does not lower the rate
+	interval := s.interval()
+	if s.nextSend < ph.TimeWrite-interval {
+		s.nextSend = ph.TimeWrite
+	}
+	s.nextSend += interval
+	(&dccp.TimestampOption{ Timestamp: dccp.TimestampAt(ph.TimeWrite) }).Place(ph)
+	return 0
+}
+
+// interval returns the time between data packets at the pacing rate
+func (s *sender) interval() int64 {
+	return int64(1e9 / s.model.PacingRate())
+}
+
+// OnRead measures the round-trip time from Timestamp Echo options and the delivery rate from
+// Ack Vectors. Without an Ack Vector, only the packet acknowledged by the Acknowledgement
+// Number is taken for delivered.
+func (s *sender) OnRead(fb *dccp.FeedbackHeader) error {
+	s.Lock()
+	defer s.Unlock()
+	if !s.open || (fb.Type != dccp.Ack && fb.Type != dccp.DataAck) {
+		return nil
+	}
+	av := fb.AckVector
+	echoed := false
+	if echo := fb.TimestampEcho; echo != nil {
+		rtt := int64(dccp.TimestampAt(fb.Time)-echo.Timestamp)*dccp.TenMicroInNano - dccp.NanoFromTenMicro(echo.Elapsed)
+		s.model.OnRTT(rtt, fb.Time)
+		echoed = true
+	}
+
+	// Mark the delivered packets of the flight
+	var latest sentPacket
+	var highest int64 = -1
+	rest := s.flight[:0]
+	for i := range s.flight {
+		p := s.flight[i]
+		if !isDelivered(av, fb.AckNo, p.SeqNo) {
+			rest = append(rest, p)
+			continue
+		}
+		s.model.OnDeliver(&p, fb.Time)
+		if highest < 0 || p.Delivered >= latest.Delivered {
+			latest = p
+		}
+		highest = p.SeqNo
+		if p.SeqNo == fb.AckNo && !echoed {
+			s.model.OnRTT(fb.Time-p.Sent, fb.Time)
+		}
+	}
+	s.flight = rest
+	if highest < 0 {
+		return nil
+	}
+	s.model.OnRateSample(&latest, fb.Time)
+
+	// Packets that dccp.DupThresh later packets have overtaken are lost
+	lost := dccp.FlightOvertaken(len(s.flight), highest, func(i int) int64 { return s.flight[i].SeqNo })
+	s.flight = append(s.flight[:0], s.flight[lost:]...)
+	s.lost += int64(lost)
+	state := s.model.state
+	s.model.Update(fb.Time, len(s.flight), lost)
+	if s.model.state != state {
+		s.amb.E(dccp.EventInfo, fmt.Sprintf("BBR %s —> %s, BtlBw=%.1f pps, MinRTT=%s",
+			phaseString(state), phaseString(s.model.state), s.model.bw.Max(), dccp.Nstoa(s.model.minRTT)), fb)
+	}
+	return nil
+}
+
+// isDelivered returns true if the Ack Vector av, received on a packet with Acknowledgement
+// Number ackNo, reports the packet seqNo as received. Without an Ack Vector, only ackNo is.
+func isDelivered(av *dccp.AckVectorOption, ackNo, seqNo int64) bool {
+	if av == nil {
+		return seqNo == ackNo
+	}
+	return av.Received(ackNo, seqNo)
+}
+
+// expire declares the data packets that have been in flight for too long lost
+func (s *sender) expire(now int64) {
+	n := dccp.FlightExpired(len(s.flight), now, s.model.RTT(), func(i int) int64 { return s.flight[i].Sent })
+	if n > 0 {
+		s.flight = append(s.flight[:0], s.flight[n:]...)
+		s.lost += int64(n)
+	}
+}
+
+// NextSend returns the time when the pacing rate allows the next packet, provided that the
+// congestion window has room for it, which makes the sender a dccp.Pacer. Packets other than
+// data do not advance the pacing schedule, so that Acks are held back little.
+func (s *sender) NextSend(now int64) int64 {
+	s.Lock()
+	defer s.Unlock()
+	if !s.open {
+		return now
+	}
+	s.expire(now)
+	cwnd := s.model.Cwnd()
+	wait := s.nextSend - now
+	if wait < -s.interval() && len(s.flight) < cwnd {
+		// The application has not kept up with the pacing rate
+		s.model.SetAppLimited(len(s.flight))
+	}
+	if wait <= 0 && len(s.flight) >= cwnd {
+		wait = s.interval()
+		if wait > PollWait {
+			wait = PollWait
+		}
+	}
+	if wait <= 0 {
+		return now
+	}
+	return now + wait
+}
+
+// Strobe blocks until NextSend lets the next packet go
+func (s *sender) Strobe() {
+	for {
+		now := s.env.Now()
+		next := s.NextSend(now)
+		if next <= now {
+			return
+		}
+		s.env.Sleep(next - now)
+	}
+}
+
+func (s *sender) OnIdle(now int64) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.open {
+		s.expire(now)
+	}
+	return nil
+}
+
+func (s *sender) SetHeartbeat(interval int64) {}
+
+func (s *sender) Close() {
+	s.Lock()
+	defer s.Unlock()
+	s.open = false
+}
+
+// UnderstandsOption returns true for the options that the sender processes
+func (s *sender) UnderstandsOption(optionType byte) bool {
+	switch optionType {
+	case dccp.OptionTimestampEcho, dccp.OptionAckVectorNonce0, dccp.OptionAckVectorNonce1:
+		return true
+	}
+	return false
+}
+
+// Status reports the estimates of the model and the state of the flight
+func (s *sender) Status() map[string]float64 {
+	s.Lock()
+	defer s.Unlock()
+	return map[string]float64{
+		"Phase":       float64(s.model.state),
+		"BtlBw":       s.model.bw.Max(),
+		"Pacing-Rate": s.model.PacingRate(),
+		"MinRTT":      float64(s.model.minRTT) / 1e6,
+		"Cwnd":        float64(s.model.Cwnd()),
+		"Inflight":    float64(len(s.flight)),
+		"Lost":        float64(s.lost),
+	}
+}
+
+func phaseString(state int) string {
+	switch state {
+	case Startup:
+		return "Startup"
+	case Drain:
+		return "Drain"
+	case ProbeBW:
+		return "ProbeBW"
+	case ProbeRTT:
+		return "ProbeRTT"
+	}
+	return "?"
+}
@@ -0,0 +1,293 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+// Package bench measures the performance of a single DCCP flow: throughput, packet rate,
+// delivery latency percentiles and heap allocations per packet. Flows can run over the
+// sandbox pipe or over UDP on the loopback interface.
+package bench
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"runtime"
+	"sort"
+	"time"
+	"github.com/petar/GoDCCP/dccp"
+	"github.com/petar/GoDCCP/dccp/ccid3"
+	"github.com/petar/GoDCCP/dccp/sandbox"
+)
+
+// DrainTimeout is the time the receiver is given, after the last packet has been written,
+// before packets that have not arrived are considered lost
+const DrainTimeout = 2e9
+
+// stampSize is the size of the header that Run writes at the start of each packet: the
+// packet's sequence number followed by its time of writing
+const stampSize = 16
+
+// warmupSeqNo marks the packets that Run writes until the connection is established
+const warmupSeqNo = 1<<64 - 1
+
+// warmupSpacing is the time between warm-up packets, which keeps them from using up the rate
+// limit of a sandbox pipe before the measured packets are written
+const warmupSpacing = 1e6
+
+// Flow is a client-to-server DCCP connection under measurement
+type Flow struct {
+	env      *dccp.Env
+	client   *dccp.Conn
+	server   *dccp.Conn
+	limiters []rateLimiter
+	close    func()
+}
+
+// rateLimiter is implemented by the sandbox pipe ends
+type rateLimiter interface {
+	SetWriteRate(rateInterval int64, ratePacketsPerInterval uint32)
+}
+
+// newEnv creates an Env that runs in the time framework t and does not trace
+func newEnv(t dccp.Time) *dccp.Env {
+	env := dccp.NewEnvTime(t, nil)
+	env.SetTraceFilter("", dccp.LevelOff)
+	return env
+}
+
+// NewSandboxFlow creates a Flow over a sandbox pipe
+func NewSandboxFlow() *Flow {
+	env := newEnv(dccp.RealTime)
+	client, server, clientToServer, serverToClient := sandbox.NewClientServerPipe(env)
+	return &Flow{
+		env:      env,
+		client:   client,
+		server:   server,
+		limiters: []rateLimiter{clientToServer, serverToClient},
+		close:    func() {},
+	}
+}
+
+// NewSandboxFlowCCID is like NewSandboxFlow, except that both endpoints use the congestion
+// control ccid. With dccp.CCUnlimited, it measures the sandbox and the transport without TFRC.
+func NewSandboxFlowCCID(ccid dccp.CCID) *Flow {
+	return newSandboxFlowCCID(newEnv(dccp.RealTime), ccid)
+}
+
+func newSandboxFlowCCID(env *dccp.Env, ccid dccp.CCID) *Flow {
+	client, server, clientToServer, serverToClient := sandbox.NewFlowPipe(env, "bench", ccid)
+	return &Flow{
+		env:      env,
+		client:   client,
+		server:   server,
+		limiters: []rateLimiter{clientToServer, serverToClient},
+		close:    func() {},
+	}
+}
+
+// NewUDPFlow creates a Flow over two UDP links bound to the loopback interface
+func NewUDPFlow() (*Flow, error) {
+	env := newEnv(dccp.RealTime)
+	loopback := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}
+	clink, err := dccp.BindUDPLink("udp", loopback)
+	if err != nil {
+		return nil, err
+	}
+	slink, err := dccp.BindUDPLink("udp", loopback)
+	if err != nil {
+		clink.Close()
+		return nil, err
+	}
+	cmux, smux := dccp.NewMux(clink), dccp.NewMux(slink)
+	f := &Flow{
+		env: env,
+		close: func() {
+			cmux.Close()
+			smux.Close()
+		},
+	}
+	cseg, err := cmux.Dial(slink.LocalAddr())
+	if err != nil {
+		f.close()
+		return nil, err
+	}
+	ccid := ccid3.CCID3{}
+	clog := dccp.NewAmb("client", env)
+	f.client = dccp.NewConnClient(env, clog, dccp.NewHeaderConn(cseg), ccid.NewSender(env, clog), ccid.NewReceiver(env, clog), 0)
+	// The server flow appears when the client's Request arrives
+	sseg, err := smux.Accept()
+	if err != nil {
+		f.client.Abort()
+		f.close()
+		return nil, err
+	}
+	slog := dccp.NewAmb("server", env)
+	f.server = dccp.NewConnServer(env, slog, dccp.NewHeaderConn(sseg), ccid.NewSender(env, slog), ccid.NewReceiver(env, slog))
+	return f, nil
+}
+
+// SetRate fixes the send rate of both congestion controls at pps packets per second, and
+// raises the rate limit of a sandbox pipe to match
+func (f *Flow) SetRate(pps uint32) {
+	for _, l := range f.limiters {
+		l.SetWriteRate(1e9, pps)
+	}
+	f.client.Amb().Flags().SetUint32("FixRate", pps)
+	f.server.Amb().Flags().SetUint32("FixRate", pps)
+}
+
+// Result holds the measurements of a run
+type Result struct {
+	Sent     int     // Number of packets written by the client
+	Received int     // Number of packets read by the server
+	Bytes    int64   // Number of payload bytes read by the server
+	Duration int64   // Time from the first write to the last read, in nanoseconds
+	Latency  []int64 // Delivery latencies of the received packets in nanoseconds, in increasing order
+	Mallocs  uint64  // Heap allocations made by the process during the run, including one payload block per packet
+}
+
+// Throughput returns the rate of payload delivery in bytes per second
+func (r *Result) Throughput() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Bytes) * 1e9 / float64(r.Duration)
+}
+
+// PacketRate returns the rate of packet delivery in packets per second
+func (r *Result) PacketRate() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Received) * 1e9 / float64(r.Duration)
+}
+
+// Percentile returns the delivery latency in nanoseconds below which the fraction p of the
+// received packets fall. p is between 0 and 1.
+func (r *Result) Percentile(p float64) int64 {
+	if len(r.Latency) == 0 {
+		return 0
+	}
+	i := int(p * float64(len(r.Latency)))
+	if i >= len(r.Latency) {
+		i = len(r.Latency) - 1
+	}
+	return r.Latency[i]
+}
+
+// AllocsPerPacket returns the number of heap allocations per received packet
+func (r *Result) AllocsPerPacket() float64 {
+	if r.Received == 0 {
+		return 0
+	}
+	return float64(r.Mallocs) / float64(r.Received)
+}
+
+func (r *Result) String() string {
+	return fmt.Sprintf("%d/%d packets, %.2f MB/s, %.0f pkt/s, p50 %v, p99 %v, %.1f allocs/pkt",
+		r.Received, r.Sent, r.Throughput()/1e6, r.PacketRate(),
+		time.Duration(r.Percentile(0.5)), time.Duration(r.Percentile(0.99)), r.AllocsPerPacket())
+}
+
+// Run writes count packets of size bytes from the client to the server, measures their
+// delivery and then tears the flow down. Until the first packet arrives at the server, the
+// client writes warm-up packets, so that connection establishment is not measured. A Flow
+// can be run only once.
+func (f *Flow) Run(count, size int) (*Result, error) {
+	if size < stampSize {
+		size = stampSize
+	}
+	if mtu := f.client.GetMTU(); size > mtu {
+		return nil, fmt.Errorf("packet size %d exceeds MTU %d", size, mtu)
+	}
+	r := &Result{Latency: make([]int64, 0, count)}
+
+	// The server records the arrival of every packet until all have been received, or the
+	// connection is torn down after the drain timeout
+	warm, done := make(chan int), make(chan int)
+	var last int64
+	f.env.Go(func() {
+		defer close(done)
+		for r.Received < count {
+			block, err := f.server.Read()
+			if err != nil {
+				return
+			}
+			if len(block) < stampSize {
+				continue
+			}
+			if binary.BigEndian.Uint64(block) == warmupSeqNo {
+				if warm != nil {
+					close(warm)
+					warm = nil
+				}
+				continue
+			}
+			last = f.env.Now()
+			r.Received++
+			r.Bytes += int64(len(block))
+			r.Latency = append(r.Latency, last-int64(binary.BigEndian.Uint64(block[8:])))
+		}
+	}, "bench server")
+
+	var werr error
+	if werr = f.warmup(warm, done, size); werr != nil {
+		count = 0
+	}
+	var m0, m1 runtime.MemStats
+	runtime.ReadMemStats(&m0)
+	t0 := f.env.Now()
+	for i := 0; i < count; i++ {
+		// Write retains the block until it is sent, so each packet gets its own
+		block := make([]byte, size)
+		binary.BigEndian.PutUint64(block, uint64(i))
+		binary.BigEndian.PutUint64(block[8:], uint64(f.env.Now()))
+		if werr = f.client.Write(block); werr != nil {
+			break
+		}
+		r.Sent++
+	}
+	select {
+	case <-done:
+	case <-time.After(DrainTimeout):
+	}
+	runtime.ReadMemStats(&m1)
+
+	f.client.Abort()
+	f.server.Abort()
+	<-done
+	f.env.NewGoJoin("bench", f.client.Joiner(), f.server.Joiner()).Join()
+	f.close()
+
+	r.Mallocs = m1.Mallocs - m0.Mallocs
+	if last > t0 {
+		r.Duration = last - t0
+	}
+	sort.Sort(int64Slice(r.Latency))
+	return r, werr
+}
+
+// warmup writes warm-up packets until warm is closed by the server
+func (f *Flow) warmup(warm, done <-chan int, size int) error {
+	block := make([]byte, size)
+	binary.BigEndian.PutUint64(block, warmupSeqNo)
+	for {
+		select {
+		case <-warm:
+			return nil
+		case <-done:
+			return dccp.ErrIO
+		default:
+		}
+		if err := f.client.Write(block); err != nil {
+			return err
+		}
+		f.env.Sleep(warmupSpacing)
+	}
+}
+
+type int64Slice []int64
+
+func (s int64Slice) Len() int           { return len(s) }
+func (s int64Slice) Less(i, j int) bool { return s[i] < s[j] }
+func (s int64Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
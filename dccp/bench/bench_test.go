@@ -0,0 +1,116 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package bench
+
+import (
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+	"github.com/petar/GoDCCP/dccp/sandbox"
+)
+
+const (
+	benchRate = 1e4  // Fixed send rate of the benchmarks, in packets per second
+	benchSize = 1000 // Payload size of the benchmark packets
+)
+
+func TestSandboxFlow(t *testing.T) {
+	f := NewSandboxFlow()
+	f.SetRate(1000)
+	r, err := f.Run(200, benchSize)
+	if err != nil {
+		t.Fatalf("run (%s)", err)
+	}
+	if r.Received == 0 || r.Received > r.Sent {
+		t.Fatalf("received %d of %d packets", r.Received, r.Sent)
+	}
+	if r.Percentile(0.5) <= 0 || r.Percentile(0.5) > r.Percentile(0.99) {
+		t.Errorf("inconsistent latency percentiles: %s", r)
+	}
+	t.Logf("%s", r)
+}
+
+// TestSandboxFlowUnlimited checks that packets get through without a congestion control. The
+// unlimited sender writes the packets in a burst, of which the pipe, which holds only a few
+// packets for its reader, drops a share that depends on the scheduling of the goroutines, even
+// on virtual time. The loss is therefore only logged; BenchmarkSandboxFlowUnlimited reports it.
+func TestSandboxFlowUnlimited(t *testing.T) {
+	sandbox.Virtual(t, func(t *testing.T, tm dccp.Time) {
+		f := newSandboxFlowCCID(newEnv(tm), dccp.CCUnlimited{})
+		f.SetRate(1000)
+		r, err := f.Run(200, benchSize)
+		f.env.Joiner().Join()
+		if err != nil {
+			t.Fatalf("run (%s)", err)
+		}
+		if r.Received == 0 || r.Received > r.Sent {
+			t.Fatalf("received %d of %d packets", r.Received, r.Sent)
+		}
+		t.Logf("%s, loss %.2f", r, float64(r.Sent-r.Received)/float64(r.Sent))
+	})
+}
+
+func TestUDPFlow(t *testing.T) {
+	f, err := NewUDPFlow()
+	if err != nil {
+		t.Fatalf("udp flow (%s)", err)
+	}
+	f.SetRate(1000)
+	r, err := f.Run(200, benchSize)
+	if err != nil {
+		t.Fatalf("run (%s)", err)
+	}
+	if r.Received == 0 {
+		t.Fatalf("received %d of %d packets", r.Received, r.Sent)
+	}
+	t.Logf("%s", r)
+}
+
+func report(b *testing.B, r *Result) {
+	b.SetBytes(benchSize)
+	b.ReportMetric(r.PacketRate(), "pkt/s")
+	b.ReportMetric(float64(r.Percentile(0.5)), "p50-ns")
+	b.ReportMetric(float64(r.Percentile(0.99)), "p99-ns")
+	b.ReportMetric(r.AllocsPerPacket(), "allocs/pkt")
+	b.ReportMetric(float64(r.Sent-r.Received)/float64(r.Sent), "loss")
+}
+
+func BenchmarkSandboxFlow(b *testing.B) {
+	f := NewSandboxFlow()
+	f.SetRate(benchRate)
+	b.ResetTimer()
+	r, err := f.Run(b.N, benchSize)
+	b.StopTimer()
+	if err != nil {
+		b.Fatalf("run (%s)", err)
+	}
+	report(b, r)
+}
+
+func BenchmarkSandboxFlowUnlimited(b *testing.B) {
+	f := NewSandboxFlowCCID(dccp.CCUnlimited{})
+	f.SetRate(benchRate)
+	b.ResetTimer()
+	r, err := f.Run(b.N, benchSize)
+	b.StopTimer()
+	if err != nil {
+		b.Fatalf("run (%s)", err)
+	}
+	report(b, r)
+}
+
+func BenchmarkUDPFlow(b *testing.B) {
+	f, err := NewUDPFlow()
+	if err != nil {
+		b.Fatalf("udp flow (%s)", err)
+	}
+	f.SetRate(benchRate)
+	b.ResetTimer()
+	r, err := f.Run(b.N, benchSize)
+	b.StopTimer()
+	if err != nil {
+		b.Fatalf("run (%s)", err)
+	}
+	report(b, r)
+}
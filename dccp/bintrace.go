@@ -0,0 +1,295 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// BinaryTraceMagic starts every binary trace stream
+const BinaryTraceMagic = "DCCPTRC1"
+
+// The binary trace format is an append-only sequence of records, following BinaryTraceMagic.
+// Integers are varint-encoded, and times are encoded as deltas from the previous record.
+// Strings that repeat across records (labels, states, header types, option names, source files
+// and stack traces) are interned: the first occurrence is written out and assigned the next
+// index, later occurrences refer to it by index. Args are stored in their JSON encoding.
+// Each record ends with a flags byte; the record carries an interned correlation ID after it
+// if binFlagCorr is set, followed by the connection number if binFlagConn is set.
+
+const (
+	binFlagHighlight = 1 << iota
+	binFlagCorr
+	binFlagConn
+)
+
+// BinaryTraceWriter is a TraceWriter that saves traces to an io.Writer in the compact binary
+// trace format. Use BinaryTraceReader, or the dccp-trace2json tool, to decode them.
+type BinaryTraceWriter struct {
+	sync.Mutex
+	w      io.Writer
+	buf    bytes.Buffer
+	intern map[string]uint64
+	last   int64
+	err    error
+}
+
+// NewBinaryTraceWriter creates a TraceWriter that writes binary trace records to w
+func NewBinaryTraceWriter(w io.Writer) *BinaryTraceWriter {
+	t := &BinaryTraceWriter{ w: w, intern: make(map[string]uint64) }
+	_, t.err = io.WriteString(w, BinaryTraceMagic)
+	return t
+}
+
+func (t *BinaryTraceWriter) putUvarint(x uint64) {
+	var b [binary.MaxVarintLen64]byte
+	t.buf.Write(b[:binary.PutUvarint(b[:], x)])
+}
+
+func (t *BinaryTraceWriter) putVarint(x int64) {
+	var b [binary.MaxVarintLen64]byte
+	t.buf.Write(b[:binary.PutVarint(b[:], x)])
+}
+
+func (t *BinaryTraceWriter) putBytes(b []byte) {
+	t.putUvarint(uint64(len(b)))
+	t.buf.Write(b)
+}
+
+// putInterned writes a reference to an interned string: zero followed by the string
+// on first occurrence, or the one-based index of the string afterwards
+func (t *BinaryTraceWriter) putInterned(s string) {
+	if k, ok := t.intern[s]; ok {
+		t.putUvarint(k)
+		return
+	}
+	t.putUvarint(0)
+	t.putBytes([]byte(s))
+	t.intern[s] = uint64(len(t.intern) + 1)
+}
+
+func (t *BinaryTraceWriter) Write(r *Trace) {
+	t.Lock()
+	defer t.Unlock()
+	if t.err != nil {
+		return
+	}
+	t.buf.Reset()
+	t.putVarint(r.Time - t.last)
+	t.last = r.Time
+	t.putUvarint(uint64(len(r.Labels)))
+	for _, l := range r.Labels {
+		t.putInterned(l)
+	}
+	t.putUvarint(uint64(r.Event))
+	t.putInterned(r.State)
+	t.putBytes([]byte(r.Comment))
+	if len(r.Args) == 0 {
+		t.putBytes(nil)
+	} else {
+		args, err := json.Marshal(r.Args)
+		if err != nil {
+			args = nil
+		}
+		t.putBytes(args)
+	}
+	t.putInterned(r.Type)
+	t.putVarint(r.SeqNo)
+	t.putVarint(r.AckNo)
+	t.putUvarint(uint64(len(r.Options)))
+	for _, o := range r.Options {
+		t.putInterned(o)
+	}
+	t.putInterned(r.SourceFile)
+	t.putUvarint(uint64(r.SourceLine))
+	t.putInterned(r.Trace)
+	var flags byte
+	if r.Highlight {
+		flags |= binFlagHighlight
+	}
+	if r.Corr != "" {
+		flags |= binFlagCorr
+	}
+	if r.Conn != 0 {
+		flags |= binFlagConn
+	}
+	t.buf.WriteByte(flags)
+	if r.Corr != "" {
+		t.putInterned(r.Corr)
+	}
+	if r.Conn != 0 {
+		t.putUvarint(r.Conn)
+	}
+	_, t.err = t.w.Write(t.buf.Bytes())
+}
+
+// Sync flushes the underlying writer, if it supports syncing
+func (t *BinaryTraceWriter) Sync() error {
+	if s, ok := t.w.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+// Close closes the underlying writer, if it supports closing
+func (t *BinaryTraceWriter) Close() error {
+	if c, ok := t.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// BinaryTraceReader decodes traces written by BinaryTraceWriter
+type BinaryTraceReader struct {
+	r      *bufio.Reader
+	intern []string
+	last   int64
+}
+
+// NewBinaryTraceReader creates a reader of the binary trace stream r. It returns ErrSyntax if
+// r does not start with BinaryTraceMagic.
+func NewBinaryTraceReader(r io.Reader) (*BinaryTraceReader, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(BinaryTraceMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return nil, err
+	}
+	if string(magic) != BinaryTraceMagic {
+		return nil, ErrSyntax
+	}
+	return &BinaryTraceReader{ r: br }, nil
+}
+
+func (t *BinaryTraceReader) getBytes() ([]byte, error) {
+	n, err := binary.ReadUvarint(t.r)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(t.r, b)
+	return b, err
+}
+
+func (t *BinaryTraceReader) getInterned() (string, error) {
+	k, err := binary.ReadUvarint(t.r)
+	if err != nil {
+		return "", err
+	}
+	if k == 0 {
+		b, err := t.getBytes()
+		if err != nil {
+			return "", err
+		}
+		t.intern = append(t.intern, string(b))
+		return string(b), nil
+	}
+	if k > uint64(len(t.intern)) {
+		return "", ErrSyntax
+	}
+	return t.intern[k-1], nil
+}
+
+// Read decodes the next trace. It returns io.EOF at the end of the stream, and
+// io.ErrUnexpectedEOF if the stream ends within a record.
+func (t *BinaryTraceReader) Read() (r *Trace, err error) {
+	dt, err := binary.ReadVarint(t.r)
+	if err != nil {
+		return nil, err
+	}
+	// Any error past the start of a record means the record is truncated or corrupt
+	defer func() {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+	}()
+	r = &Trace{}
+	t.last += dt
+	r.Time = t.last
+	n, err := binary.ReadUvarint(t.r)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < n; i++ {
+		l, err := t.getInterned()
+		if err != nil {
+			return nil, err
+		}
+		r.Labels = append(r.Labels, l)
+	}
+	ev, err := binary.ReadUvarint(t.r)
+	if err != nil {
+		return nil, err
+	}
+	r.Event = Event(ev)
+	if r.State, err = t.getInterned(); err != nil {
+		return nil, err
+	}
+	comment, err := t.getBytes()
+	if err != nil {
+		return nil, err
+	}
+	r.Comment = string(comment)
+	args, err := t.getBytes()
+	if err != nil {
+		return nil, err
+	}
+	r.Args = make(map[string]interface{})
+	if len(args) > 0 {
+		if err = json.Unmarshal(args, &r.Args); err != nil {
+			return nil, err
+		}
+	}
+	if r.Type, err = t.getInterned(); err != nil {
+		return nil, err
+	}
+	if r.SeqNo, err = binary.ReadVarint(t.r); err != nil {
+		return nil, err
+	}
+	if r.AckNo, err = binary.ReadVarint(t.r); err != nil {
+		return nil, err
+	}
+	if n, err = binary.ReadUvarint(t.r); err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < n; i++ {
+		o, err := t.getInterned()
+		if err != nil {
+			return nil, err
+		}
+		r.Options = append(r.Options, o)
+	}
+	if r.SourceFile, err = t.getInterned(); err != nil {
+		return nil, err
+	}
+	line, err := binary.ReadUvarint(t.r)
+	if err != nil {
+		return nil, err
+	}
+	r.SourceLine = int(line)
+	if r.Trace, err = t.getInterned(); err != nil {
+		return nil, err
+	}
+	hl, err := t.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	r.Highlight = hl & binFlagHighlight != 0
+	if hl & binFlagCorr != 0 {
+		if r.Corr, err = t.getInterned(); err != nil {
+			return nil, err
+		}
+	}
+	if hl & binFlagConn != 0 {
+		if r.Conn, err = binary.ReadUvarint(t.r); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,53 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestBinaryTrace(t *testing.T) {
+	traces := []*Trace{
+		&Trace{ Time: 1e9, Labels: []string{"client"}, Corr: "c1", Conn: 7, Event: EventWrite, State: "OPEN", Type: "Ack",
+			SeqNo: 100, AckNo: 99, Options: []string{"ElapsedTime"}, SourceFile: "dccp/inj.go",
+			SourceLine: 80, Trace: "stack", Args: map[string]interface{}{} },
+		&Trace{ Time: 2e9, Labels: []string{"client", "sender"}, Event: EventInfo, State: "OPEN",
+			Comment: "Allowed rate", SourceFile: "dccp/inj.go", Trace: "stack", Highlight: true,
+			Args: map[string]interface{}{ SampleType: map[string]interface{}{ "Series": "X", "Value": 1.5, "Unit": "B/s" } } },
+	}
+	var buf bytes.Buffer
+	w := NewBinaryTraceWriter(&buf)
+	for _, r := range traces {
+		w.Write(r)
+	}
+	var jbuf bytes.Buffer
+	j := NewJSONTraceWriter(&jbuf)
+	for _, r := range traces {
+		j.Write(r)
+	}
+	if buf.Len() >= jbuf.Len() {
+		t.Errorf("binary trace (%d bytes) not smaller than JSON (%d bytes)", buf.Len(), jbuf.Len())
+	}
+
+	rd, err := NewBinaryTraceReader(&buf)
+	if err != nil {
+		t.Fatalf("reader (%s)", err)
+	}
+	for i, want := range traces {
+		got, err := rd.Read()
+		if err != nil {
+			t.Fatalf("read %d (%s)", i, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("trace %d: got %#v, want %#v", i, got, want)
+		}
+	}
+	if _, err = rd.Read(); err != io.EOF {
+		t.Errorf("expecting EOF, got %v", err)
+	}
+}
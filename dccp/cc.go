@@ -54,13 +54,19 @@ type SenderCongestionControl interface {
 
 	// Conn calls OnWrite before a packet is sent to give CongestionControl
 	// an opportunity to add CCVal and options to an outgoing packet
-	// NOTE: If the CC is not active, OnWrite should return 0, nil.
-	OnWrite(ph *PreHeader) (ccval int8, options []*Option)
+	// Options are placed on ph, see PreHeader.AddOption.
+	// OnWrite may also set ph.Delay to hold the packet back before it is sent.
+	// NOTE: If the CC is not active, OnWrite should return 0 and place no options.
+	// NOTE: ph is recycled after OnWrite returns and must not be retained.
+	OnWrite(ph *PreHeader) (ccval int8)
 
 	// Conn calls OnRead after a packet has been accepted and validated
+	// fb carries the options of general use already decoded, in fb.CCOptions, as well as the
+	// ECN codepoint of the packet and the time when it was received.
 	// If OnRead returns ErrDrop, the packet will be dropped and no further processing
 	// will occur. If OnRead returns ResetError, the connection will be reset.
 	// NOTE: If the CC is not active, OnRead MUST return nil.
+	// NOTE: fb and its Options slice are recycled after OnRead returns and must not be retained.
 	OnRead(fb *FeedbackHeader) error
 
 	// Strobe blocks until a new packet can be sent without violating the
@@ -94,14 +100,19 @@ type ReceiverCongestionControl interface {
 	Open()
 
 	// Conn calls OnWrite before a packet is sent to give CongestionControl
-	// an opportunity to add CCVal and options to an outgoing packet
-	// NOTE: If the CC is not active, OnWrite MUST return nil.
-	OnWrite(ph *PreHeader) (options []*Option)
+	// an opportunity to add options to an outgoing packet
+	// Options are placed on ph, see PreHeader.AddOption.
+	// NOTE: If the CC is not active, OnWrite MUST place no options.
+	// NOTE: ph is recycled after OnWrite returns and must not be retained.
+	OnWrite(ph *PreHeader)
 
 	// Conn calls OnRead after a packet has been accepted and validated
+	// ff carries the options of general use already decoded, in ff.CCOptions, as well as the
+	// ECN codepoint of the packet and the time when it was received.
 	// If OnRead returns ErrDrop, the packet will be dropped and no further processing
 	// will occur. 
 	// NOTE: If the CC is not active, OnRead MUST return nil.
+	// NOTE: ff and its Options slice are recycled after OnRead returns and must not be retained.
 	OnRead(ff *FeedforwardHeader) error
 
 	// OnIdle behaves identically to the same method of the HC-Sender CCID
@@ -111,6 +122,81 @@ type ReceiverCongestionControl interface {
 	Close()
 }
 
+// OptionUnderstander is implemented by congestion controls that process some of the options
+// passed to OnRead. Section 5.8.2: A received option that is marked Mandatory and that
+// neither the Conn nor its congestion controls understand resets the connection with Reset
+// Code 6, "Mandatory Error". Congestion controls that do not implement OptionUnderstander
+// are taken to understand none of the options.
+type OptionUnderstander interface {
+	// UnderstandsOption returns true if the congestion control processes options of type
+	// optionType
+	UnderstandsOption(optionType byte) bool
+}
+
+// AckRatioSender is implemented by sender congestion controls that adjust the Ack Ratio of
+// their half-connection, like CCID 2, RFC 4341 Section 6.1.2. The Conn polls AckRatio about
+// once per RTT and renegotiates the Ack Ratio feature whenever the wish changes.
+type AckRatioSender interface {
+	// AckRatio returns the Ack Ratio that the sender wants the receiver to use, or zero if
+	// the sender has no preference
+	AckRatio() int
+}
+
+// Pacer is implemented by sender congestion controls that schedule every packet at an exact
+// time, rather than block in Strobe, like the rate-based TFRC of CCID 3. The Conn then calls
+// NextSend instead of Strobe before each packet, and holds the packet back until the time
+// returned, with a high-resolution sleep, see Env.SleepUntil. The pacer learns when the packet
+// actually leaves from the TimeWrite of OnWrite, and advances its schedule there.
+type Pacer interface {
+	// NextSend returns the earliest time at which the next packet may be sent, given that the
+	// time is now. A time not after now lets the packet go right away. A pacer that waits for
+	// something other than the passage of time, like an Ack to open its congestion window,
+	// returns the time at which it wants to be asked again.
+	// NOTE: If the CC is not active, NextSend MUST return now.
+	NextSend(now int64) int64
+}
+
+// AckRatioReceiver is implemented by receiver congestion controls that acknowledge data
+// packets in accordance with the Ack Ratio of the peer, Section 11.3.
+type AckRatioReceiver interface {
+	// SetAckRatio is called when the receiver CCID opens and whenever the Ack Ratio of the
+	// half-connection changes. The receiver should send at least one Ack per ratio data
+	// packets received.
+	SetAckRatio(ratio int)
+}
+
+// AckVectorSender is implemented by sender congestion controls that process the Ack Vectors
+// of the peer. Only then does the Conn agree to the peer sending Ack Vectors, Section 11.5.
+type AckVectorSender interface {
+	// RequiresAckVector returns true if the sender cannot work without Ack Vectors, like
+	// CCID 2, RFC 4341 Section 4. The Conn then asks for them with a Mandatory Change during
+	// the handshake, so that a peer that cannot send them resets the connection.
+	RequiresAckVector() bool
+}
+
+// AckVectorReceiver is implemented by receiver congestion controls that can send Ack Vectors.
+// Only then does the Conn agree to send them, Section 11.5.
+type AckVectorReceiver interface {
+	// SetSendAckVector is called when the receiver CCID opens and whenever the Send Ack
+	// Vector feature changes. The receiver should send Ack Vectors while on is true.
+	SetSendAckVector(on bool)
+}
+
+// StatusReporter is implemented by sender and receiver congestion controls that report their
+// internal state, for display by DebugHandler
+type StatusReporter interface {
+	// Status returns the current values of the internal state of the congestion control,
+	// keyed by name, such as the allowed sending rate or the loss event rate. It is called
+	// without the Conn Mutex held.
+	Status() map[string]float64
+}
+
+// Names of the Status values that DebugHandler lists for every connection
+const (
+	StatusRate = "Rate" // Allowed sending rate of the sender, in bytes per second
+	StatusLoss = "Loss" // Loss event rate estimated by the receiver, in percent
+)
+
 // PreHeader contains information that is shown to the 
 // sender and receiver congesion controls before a packet is sent.
 // PreHeader contains the parts of the DCCP header than are fixed before the
@@ -123,7 +209,7 @@ type PreHeader struct {
 
 	// TimeInject is the time when the packet was injected into the write
 	// queue. This is either in the readLoop in response to a received
-	// packet, in the idleLoop in response to idleness, or in the user
+	// packet, in the idleTick in response to idleness, or in the user
 	// facing Write method. TimeInject is currently commented out,
 	// since it is not used by the CC logic.
 	// TimeInject int64
@@ -136,6 +222,34 @@ type PreHeader struct {
 	// the roundtrip time without factoring rate-related wait times in
 	// endpoint queues.
 	TimeWrite int64
+
+	// Delay may be set by the OnWrite method of the sender congestion control, to hold the
+	// packet back for Delay nanoseconds before it is handed off to the network layer, for
+	// instance to space the packets of a burst. The packet is then taken to be written at
+	// TimeWrite+Delay, which is the TimeWrite that the receiver congestion control sees.
+	Delay int64
+
+	// Options holds the options that the congestion controls place on the packet, with
+	// AddOption or the Place methods of the option types. The PreHeader owns the options and
+	// their data, and reuses them for the next packet, so that placing options does not
+	// allocate once the buffers have grown.
+	Options []Option
+
+	optionData []byte // Backing storage for the Data of Options
+}
+
+// AddOption places an option of type typ with data on the packet. The option is appended to
+// ph.Options with a copy of data, so data may be scratch space of the caller.
+func (ph *PreHeader) AddOption(typ byte, data []byte, mandatory bool) {
+	k := len(ph.optionData)
+	ph.optionData = append(ph.optionData, data...)
+	// If optionData grew, the options placed before keep referring to the old array
+	ph.Options = append(ph.Options, Option{ Type: typ, Data: ph.optionData[k:len(ph.optionData):len(ph.optionData)], Mandatory: mandatory })
+}
+
+// reset clears ph for the next packet, keeping the capacity of its options buffer
+func (ph *PreHeader) reset() {
+	*ph = PreHeader{ Options: clearOptions(ph.Options), optionData: ph.optionData[:0] }
 }
 
 // FeedbackHeader contains information that is shown to the 
@@ -146,10 +260,19 @@ type FeedbackHeader struct {
 	Type    byte
 	X       bool
 	SeqNo   int64
-	Options []*Option
+	Options []Option
 	AckNo   int64
 
-	// Time when header received
+	// Options of general use, decoded from Options
+	CCOptions
+
+	// ECN codepoint of the packet, if reported by the link and the receiver is not ECN
+	// Incapable, Section 12. The marks that the data packets of the sender received are
+	// reported in AckVector.
+	ECN byte
+
+	// Time when header received, as early as the link or the Conn could tell, see
+	// Header.ReadTime
 	Time    int64
 }
 
@@ -164,9 +287,17 @@ type FeedforwardHeader struct {
 	X       bool
 	SeqNo   int64
 	CCVal   int8
-	Options []*Option
+	Options []Option
 
-	// Time when header received
+	// Options of general use, decoded from Options
+	CCOptions
+
+	// ECN codepoint of the packet, if reported by the link and the receiver is not ECN
+	// Incapable, Section 12
+	ECN byte
+
+	// Time when header received, as early as the link or the Conn could tell, see
+	// Header.ReadTime
 	Time int64
 
 	// Length of application data in bytes
@@ -175,11 +306,31 @@ type FeedforwardHeader struct {
 
 // CCID is a factory type that creates instances of sender and receiver CCIDs
 type CCID interface {
-	NewSender(env *Env, amb *Amb, args ...interface{}) SenderCongestionControl
-	NewReceiver(env *Env, amb *Amb, args ...interface{}) ReceiverCongestionControl
+	NewSender(env *Env, amb *Amb) SenderCongestionControl
+	NewReceiver(env *Env, amb *Amb) ReceiverCongestionControl
+}
+
+// HalfCCIDs is a CCID that runs different congestion controls on the two half-connections of
+// a Conn: Sender controls the half-connection from the local to the remote endpoint, and
+// Receiver the one from the remote to the local endpoint. For instance, a media server may
+// send with CCID3 and receive bulk uploads with another CCID. It can be passed wherever a
+// CCID is expected, e.g. to NewStack or Listen.
+type HalfCCIDs struct {
+	Sender   CCID
+	Receiver CCID
+}
+
+func (x HalfCCIDs) NewSender(env *Env, amb *Amb) SenderCongestionControl {
+	return x.Sender.NewSender(env, amb)
+}
+
+func (x HalfCCIDs) NewReceiver(env *Env, amb *Amb) ReceiverCongestionControl {
+	return x.Receiver.NewReceiver(env, amb)
 }
 
 const (
-	CCID2 = 2 // TCP-like Congestion Control, RFC 4341
-	CCID3 = 3 // TCP-Friendly Rate Control (TFRC), RFC 4342
+	CCID2       = 2   // TCP-like Congestion Control, RFC 4341
+	CCID3       = 3   // TCP-Friendly Rate Control (TFRC), RFC 4342
+	CCID_BBR    = 250 // Experimental model-based congestion control of package bbr
+	CCID_LEDBAT = 251 // Experimental background congestion control of package ledbat
 )
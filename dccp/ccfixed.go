@@ -4,12 +4,19 @@
 
 package dccp
 
+// CCFixed is a CCID that sends a packet every Every nanoseconds, regardless of network
+// conditions. A zero Every sends one packet per second. Like CCUnlimited, it is meant for
+// testing and benchmarking.
 type CCFixed struct {
-
+	Every int64
 }
 
-func (CCFixed) NewSender(env *Env, amb *Amb) SenderCongestionControl {
-	return newFixedRateSenderControl(env, 1e9) // one packet per second. sendsPerSecond
+func (x CCFixed) NewSender(env *Env, amb *Amb) SenderCongestionControl {
+	every := x.Every
+	if every <= 0 {
+		every = 1e9
+	}
+	return newFixedRateSenderControl(env, every)
 }
 
 func (CCFixed) NewReceiver(env *Env, amb *Amb) ReceiverCongestionControl {
@@ -19,34 +26,25 @@ func (CCFixed) NewReceiver(env *Env, amb *Amb) ReceiverCongestionControl {
 // ---> Fixed-rate HC-Sender Congestion Control
 
 type fixedRateSenderControl struct {
-	env         *Env
+	env *Env
 	Mutex
-	every       int64 // Strobe every every nanoseconds
-	strobeRead  chan int
-	strobeWrite chan int
+	every int64 // Strobe every every nanoseconds
+	open  bool  // True between Open and Close; otherwise Strobe returns immediately
+	last  int64 // Time of the latest strobe
 }
 
 func newFixedRateSenderControl(env *Env, every int64) *fixedRateSenderControl {
-	strobe := make(chan int)
-	return &fixedRateSenderControl{env: env, every: every, strobeRead: strobe, strobeWrite: strobe}
+	return &fixedRateSenderControl{env: env, every: every}
 }
 
 func (scc *fixedRateSenderControl) Open() {
-	scc.env.Go(func() {
-		for {
-			scc.Lock()
-			if scc.strobeWrite == nil {
-				scc.Unlock()
-				break
-			}
-			scc.strobeWrite <- 1
-			scc.Unlock()
-			scc.env.Sleep(scc.every)
-		}
-	}, "fixedRateSenderControl")
+	scc.Lock()
+	defer scc.Unlock()
+	scc.open = true
 }
 
-const CCID_FIXED = 0xf
+// CCID_FIXED is the experimental CCID of CCFixed, Section 10
+const CCID_FIXED = 248
 
 func (scc *fixedRateSenderControl) GetID() byte { return CCID_FIXED }
 
@@ -54,16 +52,26 @@ func (scc *fixedRateSenderControl) GetCCMPS() int32 { return 1e9 }
 
 func (scc *fixedRateSenderControl) GetRTT() int64 { return RoundtripDefault }
 
-func (scc *fixedRateSenderControl) OnWrite(ph *PreHeader) (ccval int8, options []*Option) {
-	return 0, nil
-}
+func (scc *fixedRateSenderControl) OnWrite(ph *PreHeader) (ccval int8) { return 0 }
 
 func (scc *fixedRateSenderControl) OnRead(fb *FeedbackHeader) error { return nil }
 
 func (scc *fixedRateSenderControl) OnIdle(now int64) error { return nil }
 
 func (scc *fixedRateSenderControl) Strobe() {
-	<-scc.strobeRead
+	scc.Lock()
+	if !scc.open {
+		scc.Unlock()
+		return
+	}
+	delta := scc.every - (scc.env.Now() - scc.last)
+	scc.Unlock()
+	if delta > 0 {
+		scc.env.Sleep(delta)
+	}
+	scc.Lock()
+	scc.last = scc.env.Now()
+	scc.Unlock()
 }
 
 func (scc *fixedRateSenderControl) SetHeartbeat(interval int64) {
@@ -72,10 +80,7 @@ func (scc *fixedRateSenderControl) SetHeartbeat(interval int64) {
 func (scc *fixedRateSenderControl) Close() {
 	scc.Lock()
 	defer scc.Unlock()
-	if scc.strobeWrite != nil {
-		close(scc.strobeWrite)
-		scc.strobeWrite = nil
-	}
+	scc.open = false
 }
 
 // ---> Fixed-rate HC-Receiver Congestion Control
@@ -92,7 +97,7 @@ func (rcc *fixedRateReceiverControl) Open() {}
 
 func (rcc *fixedRateReceiverControl) GetID() byte { return CCID_FIXED }
 
-func (rcc *fixedRateReceiverControl) OnWrite(ph *PreHeader) (options []*Option) { return nil }
+func (rcc *fixedRateReceiverControl) OnWrite(ph *PreHeader) {}
 
 func (rcc *fixedRateReceiverControl) OnRead(ff *FeedforwardHeader) error { return nil }
 
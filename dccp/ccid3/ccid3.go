@@ -8,8 +8,14 @@ import (
 	"github.com/petar/GoDCCP/dccp"
 )
 
+// CCID3 is the factory of the TFRC congestion control, RFC 4342. Importing this package
+// registers it with dccp.RegisterCCID.
 type CCID3 struct {}
 
+func init() {
+	dccp.RegisterCCID(dccp.CCID3, CCID3{})
+}
+
 func (CCID3) NewSender(env *dccp.Env, amb *dccp.Amb) dccp.SenderCongestionControl { 
 	return newSender(env, amb)
 }
@@ -14,13 +14,24 @@ func LossSample(series string, lossRateInv uint32) dccp.Sample {
 	return dccp.NewSample(series, 100 /float64(lossRateInv), "%")
 }
 
+// lossPercent converts the inverse lossRateInv of a loss event rate to percent. Zero, as
+// before initialization, and UnknownLossEventRateInv both signify no loss.
+func lossPercent(lossRateInv uint32) float64 {
+	if lossRateInv == 0 || lossRateInv == UnknownLossEventRateInv {
+		return 0
+	}
+	return 100 / float64(lossRateInv)
+}
+
 const (
 	LossReceiverEstimateSample = "Loss-Receiver"
+	LossIntervalSample         = "Loss-Interval" // Length of each finished loss interval, in packets
 )
 
 // lossRateCalculator calculates the inverse of the loss event rate as
 // specified in Section 5.4, RFC 5348. One instantiation can perform repeated
-// calculations using a fixed nInterval parameter.
+// calculations using a fixed nInterval parameter, which is the n of the RFC:
+// the calculation covers the unfinished interval and nInterval finished ones.
 type lossRateCalculator struct {
 	nInterval int
 	w         []float64
@@ -34,7 +45,7 @@ func (t *lossRateCalculator) Init(nInterval int) {
 	for i, _ := range t.w {
 		t.w[i] = intervalWeight(i, nInterval)
 	}
-	t.h = make([]float64, nInterval)
+	t.h = make([]float64, nInterval+1)
 }
 
 func intervalWeight(i, nInterval int) float64 {
@@ -51,8 +62,8 @@ func intervalWeight(i, nInterval int) float64 {
 // TODO: Remove the most recent unfinished interval from the calculation, if too small. Not crucial.
 func (t *lossRateCalculator) CalcLossEventRateInv(history []*LossIntervalDetail) uint32 {
 
-	// Prepare a slice with interval lengths
-	k := min(len(history), t.nInterval)
+	// Prepare a slice with interval lengths. I_0 through I_n are used, Section 5.4.
+	k := min(len(history), t.nInterval+1)
 	if k < 2 {
 		// Too few loss events are reported as UnknownLossEventRateInv which signifies 'no loss'
 		return UnknownLossEventRateInv
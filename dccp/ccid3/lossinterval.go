@@ -96,13 +96,20 @@ func (t *evolveInterval) OnRead(ff *dccp.FeedforwardHeader, rtt int64) {
 	if ff.SeqNo <= t.lastSeqNo {
 		return
 	}
-	// Packet re-ordering may also occur if a packet is received with a timestamp smaller than
-	// that of the previously received one
-	// XXX: How can this condition occur?
-	if ff.Time < t.lastTime {
+	// A packet that overtook others in the network, and was put back in order by the
+	// re-ordering queue of receiverLossTracker, was received before the previous one. Taking it
+	// for lost would defeat the queue, so it counts as received along with the previous one.
+	now := ff.Time
+	if now < t.lastTime {
 		t.amb.E(dccp.EventTurn, 
 			fmt.Sprintf("Time re-order; SeqNo %06x,%06x", t.lastSeqNo, ff.SeqNo),
 			ff)
+		now = t.lastTime
+	}
+
+	// RFC 4342, Section 6.1: A packet marked Congestion Experienced counts as lost. It leaves
+	// no trace here, so that the next packet received finds it missing.
+	if ff.ECN == dccp.ECNCE {
 		return
 	}
 
@@ -118,14 +125,14 @@ func (t *evolveInterval) OnRead(ff *dccp.FeedforwardHeader, rtt int64) {
 
 	// Update last received event
 	t.lastSeqNo = ff.SeqNo
-	t.lastTime = ff.Time
+	t.lastTime = now
 	t.lastRTT = rtt
 
 	// Only perform updates after the second packet ever received
 	if lastSeqNo > 0 {
 
 		// Prepare tail between previous receive and this one
-		t._tail.Init(lastTime, ff.Time, nlost, lastSeqNo)
+		t._tail.Init(lastTime, now, nlost, lastSeqNo)
 
 		// Perform interval update
 		t.eatTail(&t._tail)
@@ -0,0 +1,31 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package ccid3
+
+import (
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// TestCongestionExperienced checks that a packet marked Congestion Experienced counts as lost
+func TestCongestionExperienced(t *testing.T) {
+	env := dccp.NewEnv(nil)
+	var ei evolveInterval
+	ei.Init(dccp.NewAmb("test", env), func(*LossIntervalDetail) {})
+	for i := int64(1); i <= 10; i++ {
+		ff := &dccp.FeedforwardHeader{ Type: dccp.Data, X: true, SeqNo: i, Time: i * 1e6 }
+		if i == 5 {
+			ff.ECN = dccp.ECNCE
+		}
+		ei.OnRead(ff, 1e8)
+	}
+	lid := ei.Unfinished()
+	if lid == nil {
+		t.Fatalf("no loss interval")
+	}
+	if lid.StartSeqNo != 5 || lid.LossLength != 1 || lid.LosslessLength != 5 {
+		t.Errorf("loss interval %+v, expected one loss at 5 followed by 5 packets", lid)
+	}
+}
@@ -24,17 +24,6 @@ type UnencodedOption interface {
 	Encode() (*dccp.Option, error)
 }
 
-func encodeOption(u UnencodedOption) *dccp.Option {
-	if u == nil {
-		return nil
-	}
-	opt, err := u.Encode()
-	if err != nil {
-		panic("problem encoding unencoded option")
-	}
-	return opt
-}
-
 // RFC 4342, Section 8.5
 type LossEventRateOption struct {
 	// RateInv is the inverse of the loss event rate, rounded UP, as calculated by the receiver.
@@ -110,13 +99,43 @@ func DecodeLossIntervalsOption(opt *dccp.Option) *LossIntervalsOption {
 }
 
 func (opt *LossIntervalsOption) Encode() (*dccp.Option, error) {
-	if opt.SkipLength > NDUPACK {
+	if len(opt.LossIntervals) > MaxLossIntervals {
 		return nil, dccp.ErrOverflow
 	}
+	d, err := opt.encode(make([]byte, 1+lossIntervalFootprint*len(opt.LossIntervals)))
+	if err != nil || d == nil {
+		return nil, err
+	}
+	return &dccp.Option{
+		Type:      OptionLossIntervals,
+		Data:      d,
+		Mandatory: false,
+	}, nil
+}
+
+// Place places the option on the packet of ph, without allocating
+func (opt *LossIntervalsOption) Place(ph *dccp.PreHeader) error {
 	if len(opt.LossIntervals) > MaxLossIntervals {
+		return dccp.ErrOverflow
+	}
+	var d [1 + lossIntervalFootprint*MaxLossIntervals]byte
+	data, err := opt.encode(d[:1+lossIntervalFootprint*len(opt.LossIntervals)])
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return dccp.ErrOverflow
+	}
+	ph.AddOption(OptionLossIntervals, data, false)
+	return nil
+}
+
+// encode encodes the option into d, which must be sized to the loss intervals. It returns
+// nil data if a loss interval does not fit its fields.
+func (opt *LossIntervalsOption) encode(d []byte) ([]byte, error) {
+	if opt.SkipLength > NDUPACK {
 		return nil, dccp.ErrOverflow
 	}
-	d := make([]byte, 1+lossIntervalFootprint*len(opt.LossIntervals))
 	dccp.EncodeUint8(opt.SkipLength, d[0:1])
 	for i, lossInterval := range opt.LossIntervals {
 		j := 1 + i*lossIntervalFootprint
@@ -124,11 +143,7 @@ func (opt *LossIntervalsOption) Encode() (*dccp.Option, error) {
 			return nil, nil
 		}
 	}
-	return &dccp.Option{
-		Type:      OptionLossIntervals,
-		Data:      d,
-		Mandatory: false,
-	}, nil
+	return d, nil
 }
 
 // LossInterval describes an individual loss interval, RFC 4342, Section 8.6.2
@@ -201,6 +216,13 @@ func (opt *ReceiveRateOption) Encode() (*dccp.Option, error) {
 	}, nil
 }
 
+// Place places the option on the packet of ph, without allocating
+func (opt *ReceiveRateOption) Place(ph *dccp.PreHeader) {
+	var d [4]byte
+	dccp.EncodeUint32(opt.Rate, d[:])
+	ph.AddOption(OptionReceiveRate, d[:], false)
+}
+
 // The LossDigest option directly carries, from the receiver to the sender, the types of loss
 // information that a CCID3 sender would have to reconstruct from the LossIntervals option.  This is
 // an extension to the RFC specification.
@@ -257,3 +279,10 @@ func (opt *RoundtripReportOption) Encode() (*dccp.Option, error) {
 		Mandatory: false,
 	}, nil
 }
+
+// Place places the option on the packet of ph, without allocating
+func (opt *RoundtripReportOption) Place(ph *dccp.PreHeader) {
+	var d [4]byte
+	dccp.EncodeUint32(opt.Roundtrip, d[:])
+	ph.AddOption(OptionRoundtripReport, d[:], false)
+}
@@ -84,14 +84,14 @@ func (r *receiver) makeElapsedTimeOption(ackNo int64, timeWrite int64) *dccp.Ela
 
 // Conn calls OnWrite before a packet is sent to give CongestionControl
 // an opportunity to add CCVal and options to an outgoing packet
-func (r *receiver) OnWrite(ph *dccp.PreHeader) (options []*dccp.Option) {
+func (r *receiver) OnWrite(ph *dccp.PreHeader) {
 	r.Lock()
 	defer r.Unlock()
 	rtt, _ := r.receiverRoundtripEstimator.RTT(ph.TimeWrite)
 
 	r.lastWrite = ph.TimeWrite
 	if !r.open {
-		return nil
+		return
 	}
 
 	switch ph.Type {
@@ -102,34 +102,30 @@ func (r *receiver) OnWrite(ph *dccp.PreHeader) (options []*dccp.Option) {
 		r.lastLossEventRateInv = r.receiverLossTracker.LossEventRateInv()
 		r.lastCCVal = r.latestCCVal
 
-		// Prepare feedback options, if we've seen packets before
+		// Place feedback options, if we've seen packets before
 		// XXX: Maybe gsr = 0 should not indicate not seen packets, use something else
 		if r.gsr > 0 {
-			opts := make([]*dccp.Option, 3)
-			opts[0] = encodeOption(r.makeElapsedTimeOption(ph.AckNo, ph.TimeWrite))
-			if opts[0] == nil {
+			n := len(ph.Options)
+			elapsed := r.makeElapsedTimeOption(ph.AckNo, ph.TimeWrite)
+			if elapsed == nil {
 				r.amb.E(dccp.EventWarn, "ElapsedTime option encoding == nil", ph)
+			} else {
+				elapsed.Place(ph)
 			}
-			opts[1] = encodeOption(r.receiverRateCalculator.Flush(rtt, ph.TimeWrite))
-			if opts[1] == nil {
-				r.amb.E(dccp.EventWarn, "ReceiveRate option encoding == nil", ph)
+			receiveRate := r.receiverRateCalculator.Flush(rtt, ph.TimeWrite)
+			receiveRate.Place(ph)
+			lossIntervals := r.receiverLossTracker.LossIntervalsOption(ph.AckNo)
+			if len(lossIntervals.LossIntervals) == 0 {
+				r.env.Deviate(r.amb, devNoLossIntervals, ph)
 			}
-			opts[2] = encodeOption(r.receiverLossTracker.LossIntervalsOption(ph.AckNo))
-			if opts[2] == nil {
+			if lossIntervals.Place(ph) != nil {
 				r.amb.E(dccp.EventWarn, "LossIntervals option encoding == nil", ph)
 			}
-			r.amb.E(dccp.EventInfo, fmt.Sprintf("Placed %d receiver opts", len(opts)), ph)
-			return opts
+			r.amb.E(dccp.EventInfo, fmt.Sprintf("Placed %d receiver opts", len(ph.Options)-n), ph)
+			return
 		}
 		r.amb.E(dccp.EventInfo, "OnWrite, not seen packets before", ph)
-		return nil
-
-	case dccp.Data /*, dccp.DataAck */:
-		return nil
-	default:
-		return nil
 	}
-	panic("unreach")
 }
 
 // Conn calls OnRead after a packet has been accepted and validated
@@ -174,7 +170,7 @@ func (r *receiver) OnRead(ff *dccp.FeedforwardHeader) error {
 	// (Feedback-Condition-III) If receive window counter increases by 4 or more on a data
 	// packet, since last time feedback was sent
 	if ff.Type == dccp.Data || ff.Type == dccp.DataAck {
-		if diffWindowCounter(ff.CCVal, r.lastCCVal) >= 4 {
+		if dccp.DiffWindowCounter(ff.CCVal, r.lastCCVal) >= 4 {
 			return dccp.CongestionAck
 		}
 	}
@@ -208,3 +204,18 @@ func (r *receiver) Close() {
 	defer r.Unlock()
 	r.open = false
 }
+
+// Status implements dccp.StatusReporter. It reports the loss event rate that the receiver
+// sent in its last Ack, in percent.
+func (r *receiver) Status() map[string]float64 {
+	r.Lock()
+	defer r.Unlock()
+	return map[string]float64{
+		dccp.StatusLoss: lossPercent(r.lastLossEventRateInv),
+	}
+}
+
+// UnderstandsOption implements dccp.OptionUnderstander
+func (r *receiver) UnderstandsOption(optionType byte) bool {
+	return optionType == OptionRoundtripReport
+}
@@ -15,8 +15,13 @@ type receiverLossTracker struct {
 
 	amb *dccp.Amb
 
-	// pastHeaders keeps track of the last NDUPACK headers to overcome network re-ordering
-	pastHeaders [NDUPACK]*dccp.FeedforwardHeader
+	// pastHeaders keeps track of the last NDUPACK headers to overcome network re-ordering.
+	// Headers are copied (without their options), since the Conn recycles them after OnRead.
+	pastHeaders [NDUPACK]dccp.FeedforwardHeader
+	pastFull    [NDUPACK]bool
+
+	// popped holds the header most recently returned by pushPopHeader
+	popped dccp.FeedforwardHeader
 
 	// evolveInterval keeps state of the currently evolving loss interval
 	evolveInterval
@@ -31,31 +36,40 @@ type receiverLossTracker struct {
 // Init initializes/resets the receiverLossTracker instance
 func (t *receiverLossTracker) Init(amb *dccp.Amb) {
 	t.amb = amb
-	t.evolveInterval.Init(amb, func(lid *LossIntervalDetail) { t.lossHistory.Push(lid) })
+	t.evolveInterval.Init(amb, func(lid *LossIntervalDetail) {
+		t.lossHistory.Push(lid)
+		t.amb.E(dccp.EventInfo, "Loss interval", dccp.NewSample(LossIntervalSample, float64(lid.SeqLen()), "pkts"))
+	})
 	t.lossHistory.Init(NINTERVAL)
 	t.lossRateCalculator.Init(NINTERVAL)
 }
 
-// pushPopHeader places the newly arrived header ff into pastHeaders and 
+// pushPopHeader places a copy of the newly arrived header ff into pastHeaders and 
 // returns potentially another header (if available) whose SeqNo is no later.
-// Every header is returned exactly once.
+// Every header is returned exactly once. The returned header is valid until the next call.
 func (t *receiverLossTracker) pushPopHeader(ff *dccp.FeedforwardHeader) *dccp.FeedforwardHeader {
 	var popSeqNo int64 = dccp.SEQNOMAX + 1
 	var pop int
-	for i, ge := range t.pastHeaders {
-		if ge == nil {
-			t.pastHeaders[i] = ff
+	for i := range t.pastHeaders {
+		if !t.pastFull[i] {
+			t.storeHeader(i, ff)
 			return nil
 		}
 		// XXX: This must employ circular comparison
-		if ge.SeqNo < popSeqNo {
+		if t.pastHeaders[i].SeqNo < popSeqNo {
 			pop = i
-			popSeqNo = ge.SeqNo
+			popSeqNo = t.pastHeaders[i].SeqNo
 		}
 	}
-	r := t.pastHeaders[pop]
-	t.pastHeaders[pop] = ff
-	return r
+	t.popped = t.pastHeaders[pop]
+	t.storeHeader(pop, ff)
+	return &t.popped
+}
+
+func (t *receiverLossTracker) storeHeader(i int, ff *dccp.FeedforwardHeader) {
+	t.pastHeaders[i] = *ff
+	t.pastHeaders[i].Options = nil
+	t.pastFull[i] = true
 }
 
 // skipLength returns the number of packets, before and including the one being
@@ -64,10 +78,10 @@ func (t *receiverLossTracker) pushPopHeader(ff *dccp.FeedforwardHeader) *dccp.Fe
 func (t *receiverLossTracker) skipLength(ackno int64) byte {
 	var skip byte
 	var dbgGSR int64 = 0
-	for _, ge := range t.pastHeaders {
-		if ge != nil {
+	for i := range t.pastHeaders {
+		if t.pastFull[i] {
 			skip++
-			dbgGSR = max64(dbgGSR, ge.SeqNo)
+			dbgGSR = max64(dbgGSR, t.pastHeaders[i].SeqNo)
 		}
 	}
 	if dbgGSR != ackno {
@@ -108,13 +122,15 @@ func (t *receiverLossTracker) listIntervals() []*LossIntervalDetail {
 	return r
 }
 
-// LossIntervalsOption returns the Loss Intervals option, representing the current state.
-// ackno is the seq no that the Ack packet is acknowledging. It equals the AckNo field of
-// that packet.
-//
 // NOTE: In a deviation from the RFC, we don't send any loss intervals
 // before the first loss event has occured. The sender is supposed to handle
 // this adequately.
+var devNoLossIntervals = dccp.NewDeviation(4342, "8.6",
+	"Loss Intervals options carry no intervals before the first loss event", false)
+
+// LossIntervalsOption returns the Loss Intervals option, representing the current state.
+// ackno is the seq no that the Ack packet is acknowledging. It equals the AckNo field of
+// that packet.
 func (t *receiverLossTracker) LossIntervalsOption(ackno int64) *LossIntervalsOption {
 	return &LossIntervalsOption{
 		SkipLength:    t.skipLength(ackno),
@@ -51,6 +51,11 @@ func (r *receiverRateCalculator) Flush(rtt int64, timeWrite int64) *ReceiveRateO
 	if d0 < d1 {
 		panic("receive rate period")
 	}
+	// Data read at the instant of the feedback, as happens on a virtual clock, leaves no time
+	// to measure over, so the rate is not limited yet
+	if d0 == 0 {
+		return &ReceiveRateOption{X_RECV_MAX}
+	}
 	if d1 < rtt {
 		return &ReceiveRateOption{rate(r.data0, d0)}
 	}
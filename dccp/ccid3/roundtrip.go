@@ -38,12 +38,14 @@ func (t *senderRoundtripReporter) Init() {
 	t.lastReportTime = 0
 }
 
-func (t *senderRoundtripReporter) OnWrite(rtt int64, timeWrite int64) *dccp.Option {
-	if rtt <= 0 || timeWrite - t.lastReportTime < rtt {
-		return nil
+// OnWrite places a RoundtripReport option on the packet of ph, once per RTT
+func (t *senderRoundtripReporter) OnWrite(rtt int64, ph *dccp.PreHeader) {
+	if rtt <= 0 || ph.TimeWrite - t.lastReportTime < rtt {
+		return
 	}
-	t.lastReportTime = timeWrite
-	return encodeOption(&RoundtripReportOption{ Roundtrip: dccp.TenMicroFromNano(rtt) })
+	t.lastReportTime = ph.TimeWrite
+	opt := RoundtripReportOption{ Roundtrip: dccp.TenMicroFromNano(rtt) }
+	opt.Place(ph)
 }
 
 // senderRoundtripEstimator is a data structure that estimates the RTT at the sender end.
@@ -104,12 +106,7 @@ func (t *senderRoundtripEstimator) OnRead(fb *dccp.FeedbackHeader) bool {
 	if fb.Type != dccp.Ack && fb.Type != dccp.DataAck {
 		return false
 	}
-	var elapsed *dccp.ElapsedTimeOption
-	for _, opt := range fb.Options {
-		if elapsed = dccp.DecodeElapsedTimeOption(opt); elapsed != nil {
-			break
-		}
-	}
+	elapsed := fb.ElapsedTime
 	if elapsed == nil {
 		t.amb.E(dccp.EventWarn, "Missing elapsed opt", fb)
 		return false
@@ -185,8 +182,8 @@ func (t *receiverRoundtripEstimator) OnRead(ff *dccp.FeedforwardHeader) bool {
 	// Read RoundtripReportOption
 	// Currently RoundtripReportOption is allowed on any packet type
 	var report *RoundtripReportOption
-	for _, opt := range ff.Options {
-		if report = DecodeRoundtripReportOption(opt); report != nil {
+	for i := range ff.Options {
+		if report = DecodeRoundtripReportOption(&ff.Options[i]); report != nil {
 			break
 		}
 	}
@@ -22,7 +22,7 @@ type sender struct {
 	dccp.Mutex // Locks all fields below
 	senderRoundtripEstimator
 	senderRoundtripReporter
-	senderWindowCounter
+	dccp.WindowCounter
 	senderNoFeedbackTimer
 	senderSegmentSize
 	senderLossTracker
@@ -55,7 +55,7 @@ func (s *sender) Open() {
 	if s.open {
 		panic("opening an open ccid3 sender")
 	}
-	s.senderWindowCounter.Init()
+	s.WindowCounter.Init()
 	s.senderRoundtripEstimator.Init(s.amb)
 	rtt, _ := s.senderRoundtripEstimator.RTT()
 	s.senderRoundtripReporter.Init()
@@ -65,34 +65,36 @@ func (s *sender) Open() {
 	s.senderLossTracker.Init(s.amb)
 	s.senderRateCalculator.Init(s.amb, FixedSegmentSize, rtt)
 	s.senderStrober.Init(s.env, s.amb, s.senderRateCalculator.X(), FixedSegmentSize)
+	// Flag "FixRate", if present, enforces a fixed send rate given in packets per second
+	if flagFixRate, flagFixRatePresent := s.amb.Flags().GetUint32("FixRate"); flagFixRatePresent {
+		s.senderStrober.SetRatePPS(flagFixRate)
+	}
 	s.open = true
 }
 
 // Conn calls OnWrite before a packet is sent to give CongestionControl
 // an opportunity to add CCVal and options to an outgoing packet
-// If the CC is not active, OnWrite should return 0, nil.
-func (s *sender) OnWrite(ph *dccp.PreHeader) (ccval int8, options []*dccp.Option) {
+// If the CC is not active, OnWrite should return 0 and place no options.
+func (s *sender) OnWrite(ph *dccp.PreHeader) (ccval int8) {
 	s.Lock()
 	defer s.Unlock()
 
 	if !s.open {
-		return 0, nil
+		return 0
 	}
 
+	s.senderStrober.Sent(ph.TimeWrite)
 	s.senderNoFeedbackTimer.OnWrite(ph)
 
 	s.senderRoundtripEstimator.OnWrite(ph.SeqNo, ph.TimeWrite)
 	rtt, _ := s.senderRoundtripEstimator.RTT()
 
-	ccval = s.senderWindowCounter.OnWrite(rtt, ph.SeqNo, ph.TimeWrite)
+	ccval = s.WindowCounter.OnWrite(rtt, ph.SeqNo, ph.TimeWrite)
 	s.amb.E(dccp.EventInfo, fmt.Sprintf("CCVAL=%d", ccval))
 
-	reportOpt := s.senderRoundtripReporter.OnWrite(rtt, ph.TimeWrite)
-	if reportOpt != nil {
-		options = []*dccp.Option{ reportOpt }
-	}
+	s.senderRoundtripReporter.OnWrite(rtt, ph)
 
-	return ccval, options
+	return ccval
 }
 
 // Conn calls OnRead after a packet has been accepted and validated
@@ -119,7 +121,7 @@ func (s *sender) OnRead(fb *dccp.FeedbackHeader) error {
 	s.senderNoFeedbackTimer.OnRead(rtt, rttEstimated, fb)
 
 	// Window counter update
-	s.senderWindowCounter.OnRead(fb.AckNo)
+	s.WindowCounter.OnRead(fb.AckNo)
 
 	// Update loss estimates
 	lossFeedback, err := s.senderLossTracker.OnRead(fb)
@@ -133,6 +135,7 @@ func (s *sender) OnRead(fb *dccp.FeedbackHeader) error {
 		s.amb.E(dccp.EventWarn, "Feedback packet with corrupt receive rate option", fb)
 		return nil
 	}
+	s.amb.E(dccp.EventInfo, "Receive rate", dccp.NewSample(XRecvSample, float64(xrecv), "B/s"))
 	xf := &XFeedback{
 		Now:          fb.Time,
 		SS:           FixedSegmentSize,
@@ -141,7 +144,8 @@ func (s *sender) OnRead(fb *dccp.FeedbackHeader) error {
 		LossFeedback: lossFeedback,
 	}
 	x := s.senderRateCalculator.OnRead(xf)
-	// Flag "FixRate", if present, enforces a fixed send rate given in packets per second
+	s.amb.E(dccp.EventInfo, "Allowed rate", dccp.NewSample(XSample, float64(x), "B/s"))
+	// Flag "FixRate" described in Open
 	flagFixRate, flagFixRatePresent := s.amb.Flags().GetUint32("FixRate")
 	if flagFixRatePresent {
 		s.senderStrober.SetRatePPS(flagFixRate)
@@ -157,8 +161,8 @@ func readReceiveRate(fb *dccp.FeedbackHeader) (xrecv uint32, err error) {
 		return 0, ErrNoAck
 	}
 	var receiverRateCalculator *ReceiveRateOption
-	for _, opt := range fb.Options {
-		if receiverRateCalculator = DecodeReceiveRateOption(opt); receiverRateCalculator != nil {
+	for i := range fb.Options {
+		if receiverRateCalculator = DecodeReceiveRateOption(&fb.Options[i]); receiverRateCalculator != nil {
 			break
 		}
 	}
@@ -183,6 +187,18 @@ func (s *sender) Strobe() {
 	s.senderStrober.Strobe()
 }
 
+// NextSend returns the time when the allowed sending rate lets the next packet go, which makes
+// the sender a dccp.Pacer. Packets are then spaced exactly at the rate, RFC 5348 Section 4.6.
+func (s *sender) NextSend(now int64) int64 {
+	s.Lock()
+	open := s.open
+	s.Unlock()
+	if !open {
+		return now
+	}
+	return s.senderStrober.NextSend(now)
+}
+
 // OnIdle is called periodically. If the CC is not active, OnIdle MUST to return nil.
 func (s *sender) OnIdle(now int64) error {
 	s.Lock()
@@ -197,7 +213,7 @@ func (s *sender) OnIdle(now int64) error {
 		_, hasRTT := s.senderRoundtripEstimator.RTT()
 
 		x := s.senderRateCalculator.OnNoFeedback(now, hasRTT, idleSince, nofeedbackSet)
-		// Flag "FixRate" described above
+		// Flag "FixRate" described in Open
 		flagFixRate, flagFixRatePresent := s.amb.Flags().GetUint32("FixRate")
 		if flagFixRatePresent {
 			s.senderStrober.SetRatePPS(flagFixRate)
@@ -223,3 +239,27 @@ func (s *sender) Close() {
 	defer s.Unlock()
 	s.open = false
 }
+
+// Status implements dccp.StatusReporter. It reports the allowed sending rate, the receive
+// rate limit, both in bytes per second, and the loss event rate reported by the receiver, in
+// percent.
+func (s *sender) Status() map[string]float64 {
+	s.Lock()
+	defer s.Unlock()
+	return map[string]float64{
+		dccp.StatusRate: float64(s.senderRateCalculator.x),
+		"X-Recv-Limit":  float64(s.senderRateCalculator.recvLimit),
+		"Loss-Sender":   lossPercent(s.senderRateCalculator.lossRateInv),
+	}
+}
+
+// UnderstandsOption implements dccp.OptionUnderstander. The sender processes the feedback
+// options of RFC 4342, Section 8. It relies on the loss intervals rather than the loss event
+// rate, which it understands nonetheless.
+func (s *sender) UnderstandsOption(optionType byte) bool {
+	switch optionType {
+	case dccp.OptionElapsedTime, OptionLossEventRate, OptionLossIntervals, OptionReceiveRate:
+		return true
+	}
+	return false
+}
@@ -48,8 +48,8 @@ func (t *senderLossTracker) OnRead(fb *dccp.FeedbackHeader) (LossFeedback, error
 	}
 	var lossIntervals *LossIntervalsOption
 	t.amb.E(dccp.EventInfo, fmt.Sprintf("Encoded option count = %d", len(fb.Options)), fb)
-	for i, opt := range fb.Options {
-		if lossIntervals = DecodeLossIntervalsOption(opt); lossIntervals != nil {
+	for i := range fb.Options {
+		if lossIntervals = DecodeLossIntervalsOption(&fb.Options[i]); lossIntervals != nil {
 			break
 		}
 		t.amb.E(dccp.EventInfo, fmt.Sprintf("Decodingd option %d", i), fb)
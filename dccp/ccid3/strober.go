@@ -17,6 +17,7 @@ type senderStrober struct {
 	dccp.Mutex
 	interval int64		// Maximum average time interval between packets, in nanoseconds
 	last     int64
+	slot     int64		// Nominal time of the latest packet, when the Conn paces with NextSend
 }
 
 // BytesPerSecondToPacketsPer64Sec converts a rate in byter per second to
@@ -38,6 +39,7 @@ func (s *senderStrober) SetInterval(interval int64) {
 	defer s.Unlock()
 	s.interval = interval
 	s.last = 0
+	s.slot = 0
 }
 
 // SetRate sets the strobing rate. The argument bps is the desired
@@ -48,7 +50,11 @@ func (s *senderStrober) SetInterval(interval int64) {
 func (s *senderStrober) SetRate(bps uint32, ss uint32) {
 	s.Lock()
 	defer s.Unlock()
-	s.interval = 64e9 / BytesPerSecondToPacketsPer64Sec(bps, ss)
+	pp64 := BytesPerSecondToPacketsPer64Sec(bps, ss)
+	if pp64 == 0 {
+		pp64 = 1
+	}
+	s.interval = 64e9 / pp64
 	if s.interval == 0 {
 		panic("strobe rate infinity")
 	}
@@ -89,3 +95,26 @@ func (s *senderStrober) Strobe() {
 	s.last = s.env.Now()
 	s.Unlock()
 }
+
+// NextSend returns the earliest time at which the allowed rate lets the next packet go, one
+// interval at the current rate after the nominal time of the latest packet. Unlike Strobe, it
+// does not block, and the schedule advances only with Sent.
+func (s *senderStrober) NextSend(now int64) int64 {
+	s.Lock()
+	defer s.Unlock()
+	return s.slot + s.interval
+}
+
+// Sent advances the schedule past a packet sent at time t. The nominal time of the packet is
+// its slot in the schedule, so that packets that leave late by less than an interval, due to
+// wake-up latency, do not lower the rate. After longer idle periods the schedule restarts at
+// t, so that there is no burst.
+func (s *senderStrober) Sent(t int64) {
+	s.Lock()
+	defer s.Unlock()
+	slot := s.slot + s.interval
+	if slot < t - s.interval || slot > t {
+		slot = t
+	}
+	s.slot = slot
+}
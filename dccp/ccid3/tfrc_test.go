@@ -0,0 +1,117 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package ccid3
+
+import (
+	"math"
+	"testing"
+)
+
+// The expected values below are worked out by hand from the formulas of RFC 5348 and RFC 4342,
+// independently of the tables and the integer arithmetic of the implementation.
+
+// RFC 5348, Section 3.1: X = s / (R*sqrt(2*b*p/3) + t_RTO*(3*sqrt(3*b*p/8))*p*(1+32*p^2)),
+// with b = 1 and t_RTO = 4*R
+var thruEqVectors = []struct {
+	SS      uint32  // Segment size s, in bytes
+	RTT     int64   // Round-trip time R, in nanoseconds
+	RateInv uint32  // Inverse of the loss event rate p
+	X       float64 // Allowed sending rate, in bytes per second
+}{
+	{ SS: 1460, RTT: 100e6, RateInv: 100,  X: 164005.1 },
+	{ SS: 1460, RTT: 100e6, RateInv: 10,   X: 25843.5 },
+	{ SS: 1460, RTT: 200e6, RateInv: 1000, X: 280205.9 },
+	{ SS: 1460, RTT: 10e6,  RateInv: 50,   X: 1069434.8 },
+	{ SS: 1000, RTT: 500e6, RateInv: 500,  X: 53803.7 },
+	{ SS: 3000, RTT: 50e6,  RateInv: 2,    X: 2504.2 },
+	{ SS: 3000, RTT: 50e6,  RateInv: 1,    X: 246.6 },
+}
+
+func TestThroughputEquation(t *testing.T) {
+	for _, v := range thruEqVectors {
+		var x senderRateCalculator
+		x.ss, x.rtt, x.lossRateInv = v.SS, v.RTT, v.RateInv
+		// The table of the equation is in thousandths, rounded down
+		if got := float64(x.thruEq()); math.Abs(got - v.X) > 0.01*v.X {
+			t.Errorf("s=%d R=%d p=1/%d: X=%.0f, expecting %.0f", v.SS, v.RTT, v.RateInv, got, v.X)
+		}
+	}
+}
+
+// RFC 5348, Section 4.2: W_init = min(4*s, max(2*s, 4380)), and the initial rate is W_init/R.
+// Section 4.3: the rate is at least s/t_mbi, with t_mbi = 64 seconds.
+func TestInitialAndMinimumRate(t *testing.T) {
+	for _, v := range []struct {
+		SS   uint32
+		RTT  int64
+		Init uint32
+		Min  uint32
+	}{
+		{ SS: 1460, RTT: 100e6, Init: 43800, Min: 22 },
+		{ SS: 500,  RTT: 100e6, Init: 20000, Min: 7 },
+		{ SS: 3000, RTT: 200e6, Init: 30000, Min: 46 },
+	} {
+		if got := initRate(v.SS, v.RTT); got != v.Init {
+			t.Errorf("s=%d R=%d: initial rate %d, expecting %d", v.SS, v.RTT, got, v.Init)
+		}
+		if got := minRate(v.SS); got != v.Min {
+			t.Errorf("s=%d: minimum rate %d, expecting %d", v.SS, got, v.Min)
+		}
+	}
+}
+
+// RFC 5348, Section 5.4: w_i = 1 for 0 <= i < n/2, and w_i = 2*(n-i)/(n+2) for n/2 <= i < n
+func TestIntervalWeights(t *testing.T) {
+	for n, want := range map[int][]float64{
+		8: { 1, 1, 1, 1, 0.8, 0.6, 0.4, 0.2 },
+		4: { 1, 1, 2.0/3, 1.0/3 },
+	} {
+		for i, w := range want {
+			if got := intervalWeight(i, n); math.Abs(got - w) > 1e-9 {
+				t.Errorf("n=%d: w_%d=%g, expecting %g", n, i, got, w)
+			}
+		}
+	}
+}
+
+// RFC 5348, Section 5.4: I_tot0 = sum_{i=0}^{n-1} I_i*w_i, I_tot1 = sum_{i=1}^{n} I_i*w_(i-1),
+// I_mean = max(I_tot0, I_tot1)/W_tot with W_tot = sum_{i=0}^{n-1} w_i, and p = 1/I_mean. The
+// history holds the unfinished interval I_0 first, and then up to n = 8 finished ones, most
+// recent first. Fewer intervals are averaged over the weights that apply to them.
+var lossEventRateVectors = []struct {
+	History []uint32 // Loss interval lengths, RFC 4342 Section 6.1, most recent first
+	RateInv uint32   // Inverse of the loss event rate, rounded down
+}{
+	// No loss yet
+	{ History: []uint32{ 500 }, RateInv: UnknownLossEventRateInv },
+	// A short unfinished interval does not lower I_mean
+	{ History: []uint32{ 50, 100 }, RateInv: 100 },
+	// A long unfinished interval raises it
+	{ History: []uint32{ 200, 100 }, RateInv: 200 },
+	{ History: []uint32{ 100, 100, 100, 100, 100, 100, 100, 100, 100 }, RateInv: 100 },
+	// I_tot0 = 500 + 100*(1+1+1+0.8+0.6+0.4+0.2) = 1000, I_mean = 1000/6
+	{ History: []uint32{ 500, 100, 100, 100, 100, 100, 100, 100, 100 }, RateInv: 166 },
+	// The oldest interval I_8 counts with weight w_7 = 0.2 in I_tot1 = 580 + 200, I_mean = 780/6
+	{ History: []uint32{ 10, 100, 100, 100, 100, 100, 100, 100, 1000 }, RateInv: 130 },
+	// Intervals beyond I_8 do not count
+	{ History: []uint32{ 10, 100, 100, 100, 100, 100, 100, 100, 1000, 5000 }, RateInv: 130 },
+	// With three intervals, W_tot = 2: I_tot0 = 30 + 60, I_tot1 = 60 + 90
+	{ History: []uint32{ 30, 60, 90 }, RateInv: 75 },
+}
+
+func TestLossEventRate(t *testing.T) {
+	var calc lossRateCalculator
+	calc.Init(NINTERVAL)
+	for _, v := range lossEventRateVectors {
+		history := make([]*LossIntervalDetail, len(v.History))
+		for i, n := range v.History {
+			// The sequence length of an interval is its Lossless Length plus its Loss Length
+			history[i] = &LossIntervalDetail{ LossInterval: LossInterval{ LosslessLength: n - 1, LossLength: 1 } }
+		}
+		if got := calc.CalcLossEventRateInv(history); got != v.RateInv {
+			t.Errorf("history %v: 1/p=%d, expecting %d", v.History, got, v.RateInv)
+		}
+	}
+}
@@ -27,6 +27,13 @@ type senderRateCalculator struct {
 	xRecvSet           // Data structure for x_recv_set (see RFC 5348)
 }
 
+// Names of the sample series carrying the allowed sending rate and the receive rate reported
+// by the receiver, both in bytes per second
+const (
+	XSample     = "X-Allowed"
+	XRecvSample = "X-Recv"
+)
+
 const (
 	X_MAX_INIT_WIN          = 4380           // Maximum size of initial window in bytes
 	X_MAX_BACKOFF_INTERVAL  = 64e9           // Maximum backoff interval in ns (See RFC 5348, Section 4.3)
@@ -3,235 +3,235 @@
 package ccid3
 
 var qTable = []struct{ RateInvLo uint32; Q int64 }{
-	{    1,  23960	},
-	{    2,  6913	},
-	{    3,  3163	},
-	{    4,  1863	},
-	{    5,  1277	},
-	{    6,   964	},
-	{    7,   775	},
-	{    8,   651	},
-	{    9,   564	},
-	{   10,   500	},
-	{   11,   451	},
-	{   12,   412	},
-	{   13,   381	},
-	{   14,   355	},
-	{   15,   333	},
-	{   16,   314	},
-	{   17,   298	},
-	{   18,   283	},
-	{   19,   271	},
-	{   20,   260	},
-	{   21,   249	},
-	{   22,   240	},
-	{   23,   232	},
-	{   24,   225	},
-	{   25,   218	},
-	{   26,   211	},
-	{   27,   205	},
-	{   28,   200	},
-	{   29,   195	},
-	{   30,   190	},
-	{   31,   186	},
-	{   32,   182	},
-	{   33,   178	},
-	{   34,   174	},
-	{   35,   170	},
-	{   36,   167	},
-	{   37,   164	},
-	{   38,   161	},
-	{   39,   158	},
-	{   40,   156	},
-	{   41,   153	},
-	{   42,   151	},
-	{   43,   148	},
-	{   44,   146	},
-	{   45,   144	},
-	{   46,   142	},
-	{   47,   140	},
-	{   48,   138	},
-	{   49,   136	},
-	{   50,   134	},
-	{   51,   133	},
-	{   52,   131	},
-	{   53,   129	},
-	{   54,   128	},
-	{   55,   126	},
-	{   56,   125	},
-	{   57,   124	},
-	{   58,   122	},
-	{   59,   121	},
-	{   60,   120	},
-	{   61,   118	},
-	{   62,   117	},
-	{   63,   116	},
-	{   64,   115	},
-	{   65,   114	},
-	{   66,   113	},
-	{   67,   112	},
-	{   68,   111	},
-	{   69,   110	},
-	{   70,   109	},
-	{   71,   108	},
-	{   72,   107	},
-	{   73,   106	},
-	{   74,   105	},
-	{   75,   104	},
-	{   76,   103	},
+	{    1,  243315	},
+	{    2,  23960	},
+	{    3,  6913	},
+	{    4,  3163	},
+	{    5,  1863	},
+	{    6,  1277	},
+	{    7,   964	},
+	{    8,   775	},
+	{    9,   651	},
+	{   10,   564	},
+	{   11,   500	},
+	{   12,   451	},
+	{   13,   412	},
+	{   14,   381	},
+	{   15,   355	},
+	{   16,   333	},
+	{   17,   314	},
+	{   18,   298	},
+	{   19,   283	},
+	{   20,   271	},
+	{   21,   260	},
+	{   22,   249	},
+	{   23,   240	},
+	{   24,   232	},
+	{   25,   225	},
+	{   26,   218	},
+	{   27,   211	},
+	{   28,   205	},
+	{   29,   200	},
+	{   30,   195	},
+	{   31,   190	},
+	{   32,   186	},
+	{   33,   182	},
+	{   34,   178	},
+	{   35,   174	},
+	{   36,   170	},
+	{   37,   167	},
+	{   38,   164	},
+	{   39,   161	},
+	{   40,   158	},
+	{   41,   156	},
+	{   42,   153	},
+	{   43,   151	},
+	{   44,   148	},
+	{   45,   146	},
+	{   46,   144	},
+	{   47,   142	},
+	{   48,   140	},
+	{   49,   138	},
+	{   50,   136	},
+	{   51,   134	},
+	{   52,   133	},
+	{   53,   131	},
+	{   54,   129	},
+	{   55,   128	},
+	{   56,   126	},
+	{   57,   125	},
+	{   58,   124	},
+	{   59,   122	},
+	{   60,   121	},
+	{   61,   120	},
+	{   62,   118	},
+	{   63,   117	},
+	{   64,   116	},
+	{   65,   115	},
+	{   66,   114	},
+	{   67,   113	},
+	{   68,   112	},
+	{   69,   111	},
+	{   70,   110	},
+	{   71,   109	},
+	{   72,   108	},
+	{   73,   107	},
+	{   74,   106	},
+	{   75,   105	},
+	{   76,   104	},
 	{   77,   103	},
-	{   78,   102	},
-	{   79,   101	},
-	{   80,   100	},
+	{   78,   103	},
+	{   79,   102	},
+	{   80,   101	},
 	{   81,   100	},
-	{   82,    99	},
-	{   83,    98	},
-	{   84,    97	},
+	{   82,   100	},
+	{   83,    99	},
+	{   84,    98	},
 	{   85,    97	},
-	{   86,    96	},
-	{   87,    95	},
+	{   86,    97	},
+	{   87,    96	},
 	{   88,    95	},
-	{   89,    94	},
+	{   89,    95	},
 	{   90,    94	},
-	{   91,    93	},
-	{   92,    92	},
+	{   91,    94	},
+	{   92,    93	},
 	{   93,    92	},
-	{   94,    91	},
+	{   94,    92	},
 	{   95,    91	},
-	{   96,    90	},
+	{   96,    91	},
 	{   97,    90	},
-	{   98,    89	},
+	{   98,    90	},
 	{   99,    89	},
-	{  100,    88	},
+	{  100,    89	},
 	{  101,    88	},
-	{  102,    87	},
+	{  102,    88	},
 	{  103,    87	},
-	{  104,    86	},
+	{  104,    87	},
 	{  105,    86	},
-	{  106,    85	},
+	{  106,    86	},
 	{  107,    85	},
-	{  108,    84	},
+	{  108,    85	},
 	{  109,    84	},
-	{  110,    83	},
+	{  110,    84	},
 	{  111,    83	},
-	{  112,    82	},
+	{  112,    83	},
 	{  113,    82	},
 	{  114,    82	},
-	{  115,    81	},
+	{  115,    82	},
 	{  116,    81	},
-	{  117,    80	},
+	{  117,    81	},
 	{  118,    80	},
 	{  119,    80	},
-	{  120,    79	},
+	{  120,    80	},
 	{  121,    79	},
 	{  122,    79	},
-	{  123,    78	},
+	{  123,    79	},
 	{  124,    78	},
-	{  125,    77	},
+	{  125,    78	},
 	{  126,    77	},
 	{  127,    77	},
-	{  128,    76	},
+	{  128,    77	},
 	{  129,    76	},
 	{  130,    76	},
-	{  131,    75	},
+	{  131,    76	},
 	{  132,    75	},
 	{  133,    75	},
-	{  134,    74	},
+	{  134,    75	},
 	{  135,    74	},
 	{  136,    74	},
 	{  137,    74	},
-	{  138,    73	},
+	{  138,    74	},
 	{  139,    73	},
 	{  140,    73	},
-	{  141,    72	},
+	{  141,    73	},
 	{  142,    72	},
 	{  143,    72	},
 	{  144,    72	},
-	{  145,    71	},
+	{  145,    72	},
 	{  146,    71	},
 	{  147,    71	},
-	{  148,    70	},
+	{  148,    71	},
 	{  149,    70	},
 	{  150,    70	},
 	{  151,    70	},
-	{  152,    69	},
+	{  152,    70	},
 	{  153,    69	},
 	{  154,    69	},
 	{  155,    69	},
-	{  156,    68	},
+	{  156,    69	},
 	{  157,    68	},
 	{  158,    68	},
 	{  159,    68	},
-	{  160,    67	},
+	{  160,    68	},
 	{  161,    67	},
 	{  162,    67	},
 	{  163,    67	},
 	{  164,    67	},
-	{  165,    66	},
+	{  165,    67	},
 	{  166,    66	},
 	{  167,    66	},
 	{  168,    66	},
-	{  169,    65	},
+	{  169,    66	},
 	{  170,    65	},
 	{  171,    65	},
 	{  172,    65	},
 	{  173,    65	},
-	{  174,    64	},
+	{  174,    65	},
 	{  175,    64	},
 	{  176,    64	},
 	{  177,    64	},
 	{  178,    64	},
-	{  179,    63	},
+	{  179,    64	},
 	{  180,    63	},
 	{  181,    63	},
 	{  182,    63	},
 	{  183,    63	},
-	{  184,    62	},
+	{  184,    63	},
 	{  185,    62	},
 	{  186,    62	},
 	{  187,    62	},
 	{  188,    62	},
 	{  189,    62	},
-	{  190,    61	},
+	{  190,    62	},
 	{  191,    61	},
 	{  192,    61	},
 	{  193,    61	},
 	{  194,    61	},
 	{  195,    61	},
-	{  196,    60	},
+	{  196,    61	},
 	{  197,    60	},
 	{  198,    60	},
 	{  199,    60	},
 	{  200,    60	},
 	{  201,    60	},
-	{  202,    59	},
+	{  202,    60	},
 	{  203,    59	},
 	{  204,    59	},
 	{  205,    59	},
 	{  206,    59	},
 	{  207,    59	},
-	{  208,    58	},
+	{  208,    59	},
 	{  209,    58	},
 	{  210,    58	},
 	{  211,    58	},
 	{  212,    58	},
 	{  213,    58	},
 	{  214,    58	},
-	{  215,    57	},
+	{  215,    58	},
 	{  216,    57	},
 	{  217,    57	},
 	{  218,    57	},
 	{  219,    57	},
 	{  220,    57	},
 	{  221,    57	},
-	{  222,    56	},
+	{  222,    57	},
 	{  223,    56	},
 	{  224,    56	},
 	{  225,    56	},
 	{  226,    56	},
 	{  227,    56	},
 	{  228,    56	},
-	{  229,    55	},
+	{  229,    56	},
 	{  230,    55	},
 	{  231,    55	},
 	{  232,    55	},
@@ -239,7 +239,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  234,    55	},
 	{  235,    55	},
 	{  236,    55	},
-	{  237,    54	},
+	{  237,    55	},
 	{  238,    54	},
 	{  239,    54	},
 	{  240,    54	},
@@ -247,7 +247,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  242,    54	},
 	{  243,    54	},
 	{  244,    54	},
-	{  245,    53	},
+	{  245,    54	},
 	{  246,    53	},
 	{  247,    53	},
 	{  248,    53	},
@@ -256,7 +256,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  251,    53	},
 	{  252,    53	},
 	{  253,    53	},
-	{  254,    52	},
+	{  254,    53	},
 	{  255,    52	},
 	{  256,    52	},
 	{  257,    52	},
@@ -265,7 +265,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  260,    52	},
 	{  261,    52	},
 	{  262,    52	},
-	{  263,    51	},
+	{  263,    52	},
 	{  264,    51	},
 	{  265,    51	},
 	{  266,    51	},
@@ -275,7 +275,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  270,    51	},
 	{  271,    51	},
 	{  272,    51	},
-	{  273,    50	},
+	{  273,    51	},
 	{  274,    50	},
 	{  275,    50	},
 	{  276,    50	},
@@ -285,7 +285,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  280,    50	},
 	{  281,    50	},
 	{  282,    50	},
-	{  283,    49	},
+	{  283,    50	},
 	{  284,    49	},
 	{  285,    49	},
 	{  286,    49	},
@@ -296,7 +296,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  291,    49	},
 	{  292,    49	},
 	{  293,    49	},
-	{  294,    48	},
+	{  294,    49	},
 	{  295,    48	},
 	{  296,    48	},
 	{  297,    48	},
@@ -308,7 +308,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  303,    48	},
 	{  304,    48	},
 	{  305,    48	},
-	{  306,    47	},
+	{  306,    48	},
 	{  307,    47	},
 	{  308,    47	},
 	{  309,    47	},
@@ -321,7 +321,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  316,    47	},
 	{  317,    47	},
 	{  318,    47	},
-	{  319,    46	},
+	{  319,    47	},
 	{  320,    46	},
 	{  321,    46	},
 	{  322,    46	},
@@ -334,7 +334,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  329,    46	},
 	{  330,    46	},
 	{  331,    46	},
-	{  332,    45	},
+	{  332,    46	},
 	{  333,    45	},
 	{  334,    45	},
 	{  335,    45	},
@@ -348,7 +348,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  343,    45	},
 	{  344,    45	},
 	{  345,    45	},
-	{  346,    44	},
+	{  346,    45	},
 	{  347,    44	},
 	{  348,    44	},
 	{  349,    44	},
@@ -363,7 +363,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  358,    44	},
 	{  359,    44	},
 	{  360,    44	},
-	{  361,    43	},
+	{  361,    44	},
 	{  362,    43	},
 	{  363,    43	},
 	{  364,    43	},
@@ -379,7 +379,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  374,    43	},
 	{  375,    43	},
 	{  376,    43	},
-	{  377,    42	},
+	{  377,    43	},
 	{  378,    42	},
 	{  379,    42	},
 	{  380,    42	},
@@ -397,7 +397,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  392,    42	},
 	{  393,    42	},
 	{  394,    42	},
-	{  395,    41	},
+	{  395,    42	},
 	{  396,    41	},
 	{  397,    41	},
 	{  398,    41	},
@@ -416,7 +416,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  411,    41	},
 	{  412,    41	},
 	{  413,    41	},
-	{  414,    40	},
+	{  414,    41	},
 	{  415,    40	},
 	{  416,    40	},
 	{  417,    40	},
@@ -436,7 +436,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  431,    40	},
 	{  432,    40	},
 	{  433,    40	},
-	{  434,    39	},
+	{  434,    40	},
 	{  435,    39	},
 	{  436,    39	},
 	{  437,    39	},
@@ -457,7 +457,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  452,    39	},
 	{  453,    39	},
 	{  454,    39	},
-	{  455,    38	},
+	{  455,    39	},
 	{  456,    38	},
 	{  457,    38	},
 	{  458,    38	},
@@ -481,7 +481,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  476,    38	},
 	{  477,    38	},
 	{  478,    38	},
-	{  479,    37	},
+	{  479,    38	},
 	{  480,    37	},
 	{  481,    37	},
 	{  482,    37	},
@@ -506,7 +506,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  501,    37	},
 	{  502,    37	},
 	{  503,    37	},
-	{  504,    36	},
+	{  504,    37	},
 	{  505,    36	},
 	{  506,    36	},
 	{  507,    36	},
@@ -533,7 +533,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  528,    36	},
 	{  529,    36	},
 	{  530,    36	},
-	{  531,    35	},
+	{  531,    36	},
 	{  532,    35	},
 	{  533,    35	},
 	{  534,    35	},
@@ -563,7 +563,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  558,    35	},
 	{  559,    35	},
 	{  560,    35	},
-	{  561,    34	},
+	{  561,    35	},
 	{  562,    34	},
 	{  563,    34	},
 	{  564,    34	},
@@ -596,7 +596,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  591,    34	},
 	{  592,    34	},
 	{  593,    34	},
-	{  594,    33	},
+	{  594,    34	},
 	{  595,    33	},
 	{  596,    33	},
 	{  597,    33	},
@@ -631,7 +631,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  626,    33	},
 	{  627,    33	},
 	{  628,    33	},
-	{  629,    32	},
+	{  629,    33	},
 	{  630,    32	},
 	{  631,    32	},
 	{  632,    32	},
@@ -670,7 +670,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  665,    32	},
 	{  666,    32	},
 	{  667,    32	},
-	{  668,    31	},
+	{  668,    32	},
 	{  669,    31	},
 	{  670,    31	},
 	{  671,    31	},
@@ -713,7 +713,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  708,    31	},
 	{  709,    31	},
 	{  710,    31	},
-	{  711,    30	},
+	{  711,    31	},
 	{  712,    30	},
 	{  713,    30	},
 	{  714,    30	},
@@ -760,7 +760,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  755,    30	},
 	{  756,    30	},
 	{  757,    30	},
-	{  758,    29	},
+	{  758,    30	},
 	{  759,    29	},
 	{  760,    29	},
 	{  761,    29	},
@@ -812,7 +812,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  807,    29	},
 	{  808,    29	},
 	{  809,    29	},
-	{  810,    28	},
+	{  810,    29	},
 	{  811,    28	},
 	{  812,    28	},
 	{  813,    28	},
@@ -870,7 +870,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  865,    28	},
 	{  866,    28	},
 	{  867,    28	},
-	{  868,    27	},
+	{  868,    28	},
 	{  869,    27	},
 	{  870,    27	},
 	{  871,    27	},
@@ -934,7 +934,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  929,    27	},
 	{  930,    27	},
 	{  931,    27	},
-	{  932,    26	},
+	{  932,    27	},
 	{  933,    26	},
 	{  934,    26	},
 	{  935,    26	},
@@ -1005,7 +1005,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  1000,    26	},
 	{  1001,    26	},
 	{  1002,    26	},
-	{  1003,    25	},
+	{  1003,    26	},
 	{  1004,    25	},
 	{  1005,    25	},
 	{  1006,    25	},
@@ -1086,7 +1086,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  1081,    25	},
 	{  1082,    25	},
 	{  1083,    25	},
-	{  1084,    24	},
+	{  1084,    25	},
 	{  1085,    24	},
 	{  1086,    24	},
 	{  1087,    24	},
@@ -1177,7 +1177,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  1172,    24	},
 	{  1173,    24	},
 	{  1174,    24	},
-	{  1175,    23	},
+	{  1175,    24	},
 	{  1176,    23	},
 	{  1177,    23	},
 	{  1178,    23	},
@@ -1280,7 +1280,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  1275,    23	},
 	{  1276,    23	},
 	{  1277,    23	},
-	{  1278,    22	},
+	{  1278,    23	},
 	{  1279,    22	},
 	{  1280,    22	},
 	{  1281,    22	},
@@ -1397,7 +1397,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  1392,    22	},
 	{  1393,    22	},
 	{  1394,    22	},
-	{  1395,    21	},
+	{  1395,    22	},
 	{  1396,    21	},
 	{  1397,    21	},
 	{  1398,    21	},
@@ -1531,7 +1531,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  1526,    21	},
 	{  1527,    21	},
 	{  1528,    21	},
-	{  1529,    20	},
+	{  1529,    21	},
 	{  1530,    20	},
 	{  1531,    20	},
 	{  1532,    20	},
@@ -1686,7 +1686,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  1681,    20	},
 	{  1682,    20	},
 	{  1683,    20	},
-	{  1684,    19	},
+	{  1684,    20	},
 	{  1685,    19	},
 	{  1686,    19	},
 	{  1687,    19	},
@@ -1866,7 +1866,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  1861,    19	},
 	{  1862,    19	},
 	{  1863,    19	},
-	{  1864,    18	},
+	{  1864,    19	},
 	{  1865,    18	},
 	{  1866,    18	},
 	{  1867,    18	},
@@ -2077,7 +2077,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  2072,    18	},
 	{  2073,    18	},
 	{  2074,    18	},
-	{  2075,    17	},
+	{  2075,    18	},
 	{  2076,    17	},
 	{  2077,    17	},
 	{  2078,    17	},
@@ -2326,7 +2326,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  2321,    17	},
 	{  2322,    17	},
 	{  2323,    17	},
-	{  2324,    16	},
+	{  2324,    17	},
 	{  2325,    16	},
 	{  2326,    16	},
 	{  2327,    16	},
@@ -2624,7 +2624,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  2619,    16	},
 	{  2620,    16	},
 	{  2621,    16	},
-	{  2622,    15	},
+	{  2622,    16	},
 	{  2623,    15	},
 	{  2624,    15	},
 	{  2625,    15	},
@@ -2982,7 +2982,7 @@ var qTable = []struct{ RateInvLo uint32; Q int64 }{
 	{  2977,    15	},
 	{  2978,    15	},
 	{  2979,    15	},
-	{  2980,    14	},
+	{  2980,    15	},
 	{  2981,    14	},
 	{  2982,    14	},
 	{  2983,    14	},
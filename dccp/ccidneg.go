@@ -0,0 +1,87 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import "fmt"
+
+// Section 10: The CCID of each half-connection is negotiated with the server-priority CCID
+// feature, which is located at the HC-Sender. A client asks for the CCIDs it prefers with a
+// Change L and a Change R in its Request, and the server reconciles them with its own
+// preferences. The preferences of an endpoint are the CCID that its Conn was created with,
+// followed by the other CCIDs registered with RegisterCCID. When the negotiation settles on
+// another CCID, the Conn replaces the respective congestion control with one made by the
+// registered factory. The two half-connections are negotiated independently and may end up
+// with different CCIDs, see HalfCCIDs. The CCIDs cannot change once they are open.
+
+// ccidPair holds the sender and receiver congestion controls of a Conn
+type ccidPair struct {
+	scc SenderCongestionControl
+	rcc ReceiverCongestionControl
+}
+
+// scc returns the sender congestion control of the Conn
+func (c *Conn) scc() SenderCongestionControl {
+	return c.ccids.Load().(*ccidPair).scc
+}
+
+// rcc returns the receiver congestion control of the Conn
+func (c *Conn) rcc() ReceiverCongestionControl {
+	return c.ccids.Load().(*ccidPair).rcc
+}
+
+// ccidPrefs returns the CCIDs that the Conn can use for the half-connection of the CCID
+// feature at loc, most preferred first
+func (c *Conn) ccidPrefs(loc FeatureLocation) []uint64 {
+	prefs := []uint64{c.featureDefault(featureKey{loc, FeatureCCID})}
+	if c.ccidOpen {
+		return prefs
+	}
+	for _, id := range RegisteredCCIDs() {
+		if !containsValue(prefs, uint64(id)) {
+			prefs = append(prefs, uint64(id))
+		}
+	}
+	return prefs
+}
+
+// negotiateCCID asks the peer for the CCIDs of both half-connections. It is called by the
+// client before the Request is sent.
+func (c *Conn) negotiateCCID() {
+	c.AssertLocked()
+	for _, loc := range []FeatureLocation{FeatureLocal, FeatureRemote} {
+		k := featureKey{loc, FeatureCCID}
+		c.changeFeature(k, c.ccidPrefs(loc))
+	}
+}
+
+// switchCCID puts the CCID id into effect for the half-connection of the CCID feature at loc.
+// The congestion control of that half is replaced with one made by the registered factory of
+// id, unless it already has that CCID.
+func (c *Conn) switchCCID(loc FeatureLocation, id byte) {
+	c.AssertLocked()
+	p := *c.ccids.Load().(*ccidPair)
+	if (loc == FeatureLocal && p.scc.GetID() == id) || (loc == FeatureRemote && p.rcc.GetID() == id) {
+		return
+	}
+	factory, ok := LookupCCID(id)
+	if c.ccidOpen || !ok {
+		c.amb.E(EventWarn, fmt.Sprintf("Cannot switch %s CCID to %d", featureLocationString(loc), id))
+		return
+	}
+	if loc == FeatureLocal {
+		p.scc = factory.NewSender(c.env, c.amb)
+		c.socket.SetCCIDA(id)
+	} else {
+		p.rcc = factory.NewReceiver(c.env, c.amb)
+		c.socket.SetCCIDB(id)
+	}
+	c.ccids.Store(&p)
+	c.syncWithCongestionControl()
+	// The new sender CCID may need Ack Vectors that the old one did not
+	if loc == FeatureLocal {
+		c.requireAckVector()
+	}
+	c.amb.E(EventInfo, fmt.Sprintf("CCID at %s switched to %d", featureLocationString(loc), id))
+}
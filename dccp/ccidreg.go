@@ -0,0 +1,73 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// CCIDFactory creates the sender and receiver halves of a congestion control. Every CCID is
+// a CCIDFactory; the halves it creates must report the CCID number it is registered under
+// from their GetID methods.
+type CCIDFactory interface {
+	CCID
+}
+
+// Congestion controls are registered by CCID number, Section 10, so that implementations
+// outside of this package can be plugged in and looked up by number. The test CCIDs CCFixed
+// and CCUnlimited are registered under the experimental numbers CCID_FIXED and CCID_UNLIMITED,
+// and importing package ccid3 registers CCID3.
+var ccidRegistry = struct {
+	sync.Mutex
+	factories map[byte]CCIDFactory
+}{factories: make(map[byte]CCIDFactory)}
+
+func init() {
+	RegisterCCID(CCID_FIXED, CCFixed{})
+	RegisterCCID(CCID_UNLIMITED, CCUnlimited{})
+}
+
+// RegisterCCID makes the congestion control of factory available under the CCID number id.
+// It is meant to be called from the init function of the package that implements the
+// congestion control. RegisterCCID panics if factory is nil, if id is already registered, or
+// if id is reserved, Section 10: CCIDs 0, 1 and 255.
+func RegisterCCID(id byte, factory CCIDFactory) {
+	if factory == nil {
+		panic("registering nil CCID factory")
+	}
+	switch id {
+	case 0, 1, 255:
+		panic(fmt.Sprintf("registering reserved CCID %d", id))
+	}
+	ccidRegistry.Lock()
+	defer ccidRegistry.Unlock()
+	if _, ok := ccidRegistry.factories[id]; ok {
+		panic(fmt.Sprintf("registering CCID %d twice", id))
+	}
+	ccidRegistry.factories[id] = factory
+}
+
+// LookupCCID returns the congestion control registered under the CCID number id
+func LookupCCID(id byte) (factory CCIDFactory, ok bool) {
+	ccidRegistry.Lock()
+	defer ccidRegistry.Unlock()
+	factory, ok = ccidRegistry.factories[id]
+	return factory, ok
+}
+
+// RegisteredCCIDs returns the CCID numbers of the registered congestion controls, in
+// increasing order
+func RegisteredCCIDs() []byte {
+	ccidRegistry.Lock()
+	defer ccidRegistry.Unlock()
+	var ids []byte
+	for id := range ccidRegistry.factories {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
@@ -0,0 +1,42 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"testing"
+)
+
+func TestRegisterCCID(t *testing.T) {
+	const experimental = 254
+	if _, ok := LookupCCID(experimental); ok {
+		t.Fatalf("CCID %d registered before the test", experimental)
+	}
+	RegisterCCID(experimental, CCFixed{Every: 1e6})
+	f, ok := LookupCCID(experimental)
+	if !ok || f.(CCFixed).Every != 1e6 {
+		t.Errorf("lookup of CCID %d: %v, %v", experimental, f, ok)
+	}
+	if _, ok := LookupCCID(CCID_FIXED); !ok {
+		t.Errorf("CCFixed not registered")
+	}
+	if _, ok := LookupCCID(CCID_UNLIMITED); !ok {
+		t.Errorf("CCUnlimited not registered")
+	}
+	ids := RegisteredCCIDs()
+	if len(ids) < 2 || ids[len(ids)-1] != experimental {
+		t.Errorf("registered CCIDs %v", ids)
+	}
+
+	for _, id := range []byte{0, 1, 255, experimental} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("registering CCID %d does not panic", id)
+				}
+			}()
+			RegisterCCID(id, CCFixed{})
+		}()
+	}
+}
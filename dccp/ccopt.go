@@ -0,0 +1,60 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+// CCOptions holds the options of general use to congestion controls, which the Conn decodes
+// once, so that the CCIDs need not parse Options for them. A field is nil if the packet does
+// not carry a valid option of its kind; if it carries several, the last one counts. Like the
+// Options slice, the decoded options are recycled as soon as OnRead returns.
+type CCOptions struct {
+	Timestamp     *TimestampOption     // Section 13.1
+	TimestampEcho *TimestampEchoOption // Section 13.3
+	ElapsedTime   *ElapsedTimeOption   // Section 13.2
+	AckVector     *AckVectorOption     // Section 11.4, on FeedbackHeader only
+	DataDropped   *DataDroppedOption   // Section 11.7, on FeedbackHeader only
+
+	// Backing storage of the decoded options, kept across pool reuse
+	timestamp     TimestampOption
+	timestampEcho TimestampEchoOption
+	elapsedTime   ElapsedTimeOption
+	ackVector     AckVectorOption
+}
+
+// Decode fills in x from opts, which arrived on a packet with Acknowledgement Number ackNo. The
+// Conn decodes the options of the headers that it hands to the CCIDs; Decode is exported for
+// harnesses that drive CCIDs without a Conn.
+func (x *CCOptions) Decode(opts []Option, ackNo int64) {
+	for i := range opts {
+		opt := &opts[i]
+		switch opt.Type {
+		case OptionTimestamp:
+			if decodeTimestampOption(opt, &x.timestamp) {
+				x.Timestamp = &x.timestamp
+			}
+		case OptionTimestampEcho:
+			if decodeTimestampEchoOption(opt, &x.timestampEcho) {
+				x.TimestampEcho = &x.timestampEcho
+			}
+		case OptionElapsedTime:
+			if decodeElapsedTimeOption(opt, &x.elapsedTime) {
+				x.ElapsedTime = &x.elapsedTime
+			}
+		case OptionAckVectorNonce0, OptionAckVectorNonce1:
+			if decodeAckVectorOption(opt, &x.ackVector) {
+				x.AckVector = &x.ackVector
+			}
+		case OptionDataDropped:
+			// Data Dropped options are rare, so they are not worth storage of their own
+			if dd := DecodeDataDroppedOption(opt, ackNo); dd != nil {
+				x.DataDropped = dd
+			}
+		}
+	}
+}
+
+// recycle returns x cleared, except for the storage of the Runs of Ack Vectors
+func (x *CCOptions) recycle() CCOptions {
+	return CCOptions{ ackVector: AckVectorOption{ Runs: x.ackVector.Runs[:0] } }
+}
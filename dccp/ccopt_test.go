@@ -0,0 +1,53 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCCOptions(t *testing.T) {
+	const ackNo = 1000
+	runs := []AckVectorRun{
+		{ State: AckVectorReceived, Len: 3 },
+		{ State: AckVectorNotReceived, Len: 1 },
+	}
+	ts, _ := (&TimestampOption{ Timestamp: 7 }).Encode()
+	echo, _ := (&TimestampEchoOption{ Timestamp: 5, Elapsed: 100 }).Encode()
+	elapsed, _ := (&ElapsedTimeOption{ Elapsed: 200 }).Encode()
+	av, _ := (&AckVectorOption{ Nonce: 1, Runs: runs }).Encode()
+	dd, _ := (&DataDroppedOption{ Drops: []DataDrop{{ SeqNo: 998, State: DropStateCorrupt }} }).Encode(ackNo)
+	bad := &Option{ Type: OptionTimestamp, Data: []byte{1} }
+
+	var x CCOptions
+	x.Decode([]Option{ *ts, *echo, *elapsed, *av, *dd, *bad }, ackNo)
+	if x.Timestamp == nil || x.Timestamp.Timestamp != 7 {
+		t.Errorf("timestamp %v", x.Timestamp)
+	}
+	if x.TimestampEcho == nil || x.TimestampEcho.Timestamp != 5 || x.TimestampEcho.Elapsed != 100 {
+		t.Errorf("timestamp echo %v", x.TimestampEcho)
+	}
+	if x.ElapsedTime == nil || x.ElapsedTime.Elapsed != 200 {
+		t.Errorf("elapsed time %v", x.ElapsedTime)
+	}
+	if x.AckVector == nil || x.AckVector.Nonce != 1 || !reflect.DeepEqual(x.AckVector.Runs, runs) {
+		t.Errorf("ack vector %v, expecting %v", x.AckVector, runs)
+	}
+	if x.DataDropped == nil || len(x.DataDropped.Drops) != 1 || x.DataDropped.Drops[0].SeqNo != 998 {
+		t.Errorf("data dropped %v", x.DataDropped)
+	}
+
+	// A recycled CCOptions forgets the options, and reuses the storage of the Ack Vector
+	store := &x.ackVector.Runs[0]
+	x = x.recycle()
+	x.Decode([]Option{ *av }, ackNo)
+	if x.Timestamp != nil || x.TimestampEcho != nil || x.ElapsedTime != nil || x.DataDropped != nil {
+		t.Errorf("recycled options %v", x)
+	}
+	if x.AckVector == nil || !reflect.DeepEqual(x.AckVector.Runs, runs) || &x.AckVector.Runs[0] != store {
+		t.Errorf("recycled ack vector %v", x.AckVector)
+	}
+}
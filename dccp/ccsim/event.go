@@ -0,0 +1,62 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package ccsim
+
+// virtualTime is a dccp.Time that advances only with the simulation. Sleep runs the events
+// that fall due while sleeping, so that a congestion control that blocks in Strobe sees the
+// feedback that arrives meanwhile.
+type virtualTime struct {
+	now int64
+	sim *Sim
+}
+
+// Now implements dccp.Time.Now
+func (x *virtualTime) Now() int64 { return x.now }
+
+// Sleep implements dccp.Time.Sleep
+func (x *virtualTime) Sleep(ns int64) {
+	x.sim.advance(x.now + ns)
+}
+
+// event is a callback scheduled at time At. Events of the same time run in the order they
+// were scheduled in.
+type event struct {
+	At    int64
+	Order int64
+	F     func()
+}
+
+// eventQueue is a heap of events, earliest first. It implements heap.Interface.
+type eventQueue struct {
+	events []*event
+	order  int64 // Order of the latest event scheduled
+}
+
+func (q *eventQueue) Len() int { return len(q.events) }
+
+func (q *eventQueue) Less(i, j int) bool {
+	a, b := q.events[i], q.events[j]
+	return a.At < b.At || a.At == b.At && a.Order < b.Order
+}
+
+func (q *eventQueue) Swap(i, j int) { q.events[i], q.events[j] = q.events[j], q.events[i] }
+
+func (q *eventQueue) Push(x interface{}) { q.events = append(q.events, x.(*event)) }
+
+func (q *eventQueue) Pop() interface{} {
+	n := len(q.events)
+	e := q.events[n-1]
+	q.events[n-1] = nil
+	q.events = q.events[:n-1]
+	return e
+}
+
+// peek returns the earliest event, or nil if there is none
+func (q *eventQueue) peek() *event {
+	if len(q.events) == 0 {
+		return nil
+	}
+	return q.events[0]
+}
@@ -0,0 +1,141 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package ccsim
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// series records the dynamics of a simulation as rows of named values, taken at regular
+// intervals. It is the dccp.TraceWriter of the Env of the simulation, and retains the latest
+// value of every sample series (such as X, X_recv, RTT and the loss event rate p) emitted by
+// the congestion controls. Columns are named "sender/series" and "receiver/series", like the
+// columns of sandbox.SeriesRecorder, and "sim/..." for the counts of the simulation.
+type series struct {
+	latest map[string]float64
+	rows   []row
+}
+
+// row is a sample of a simulation
+type row struct {
+	Time   int64
+	Values map[string]float64
+}
+
+func newSeries() *series {
+	return &series{ latest: make(map[string]float64) }
+}
+
+// snapshot adds a row at time t, with the latest sample values and the values of status
+func (x *series) snapshot(t int64, status map[string]float64) {
+	r := row{ Time: t, Values: make(map[string]float64) }
+	for k, v := range x.latest {
+		r.Values[k] = v
+	}
+	for k, v := range status {
+		r.Values[k] = v
+	}
+	x.rows = append(x.rows, r)
+}
+
+// Write implements dccp.TraceWriter.Write
+func (x *series) Write(r *dccp.Trace) {
+	sample, ok := r.Sample()
+	if !ok || len(r.Labels) == 0 {
+		return
+	}
+	x.latest[r.Labels[0] + "/" + sample.Series] = sample.Value
+}
+
+func (x *series) Sync() error { return nil }
+
+func (x *series) Close() error { return nil }
+
+// columns returns the sorted names of all columns
+func (x *series) columns() []string {
+	seen := make(map[string]bool)
+	for _, r := range x.rows {
+		for k := range r.Values {
+			seen[k] = true
+		}
+	}
+	var cols []string
+	for k := range seen {
+		cols = append(cols, k)
+	}
+	sort.Strings(cols)
+	return cols
+}
+
+// Point is a value of a column of the series at a time since the start of the simulation
+type Point struct {
+	Time  int64
+	Value float64
+}
+
+// Columns returns the sorted names of the columns of the series recorded so far
+func (s *Sim) Columns() []string {
+	return s.series.columns()
+}
+
+// Series returns the points of column name recorded so far, in order of time. Samples taken
+// before the column had a value are skipped.
+func (s *Sim) Series(name string) []Point {
+	var pp []Point
+	for _, r := range s.series.rows {
+		if v, ok := r.Values[name]; ok {
+			pp = append(pp, Point{ Time: r.Time, Value: v })
+		}
+	}
+	return pp
+}
+
+// WriteCSV writes the series recorded so far as CSV, with a header row and one row per sample,
+// in the format of sandbox.SeriesRecorder. The first column is the time since the start of the
+// simulation in nanoseconds. Values that were not yet known at a sample are left empty.
+func (s *Sim) WriteCSV(w io.Writer) error {
+	cols := s.series.columns()
+	cw := csv.NewWriter(w)
+	if err := cw.Write(append([]string{"time"}, cols...)); err != nil {
+		return err
+	}
+	for _, r := range s.series.rows {
+		rec := []string{ strconv.FormatInt(r.Time, 10) }
+		for _, c := range cols {
+			v, ok := r.Values[c]
+			if !ok {
+				rec = append(rec, "")
+				continue
+			}
+			rec = append(rec, strconv.FormatFloat(v, 'g', -1, 64))
+		}
+		if err := cw.Write(rec); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Mean returns the average value of column name over the points recorded between times from
+// and to since the start of the simulation, and false if there are none
+func (s *Sim) Mean(name string, from, to int64) (float64, bool) {
+	var sum float64
+	var n int
+	for _, p := range s.Series(name) {
+		if p.Time >= from && p.Time <= to {
+			sum += p.Value
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, false
+	}
+	return sum / float64(n), true
+}
@@ -0,0 +1,336 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+// Package ccsim drives the sender and receiver congestion controls of a CCID directly, with
+// synthetic data packets and acknowledgements, without a Conn, a link or any goroutines. Time
+// is virtual and advances from one event to the next, so a minute of a flow simulates in a
+// fraction of a second, and every run with the same Config is identical. This makes it quick
+// to unit-test the dynamics of a congestion control, like the TFRC equation of CCID 3, and to
+// plot them against reference traces.
+package ccsim
+
+import (
+	"container/heap"
+	"errors"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// Epoch is the virtual time at which simulations start. It is not zero, since congestion
+// controls take a zero time to mean that something has not happened yet.
+const Epoch = 1e9
+
+// MaxBurst is the number of data packets that the sender may send at the same instant of virtual
+// time. A sender that exceeds it, like CCUnlimited with an application that always has data,
+// would keep the simulation from ever advancing, and so makes it fail with ErrUnlimited.
+const MaxBurst = 1e6
+
+// ErrUnlimited is returned by Run if the sender exceeds MaxBurst
+var ErrUnlimited = errors.New("sender does not limit an application that always has data")
+
+// maxPacketSize is the size of the largest DCCP packet that fits in an IP datagram
+const maxPacketSize = 65535
+
+// Defaults of Config
+const (
+	DefaultSize   = 1000  // Bytes of application data per packet, if the sender does not limit them
+	DefaultSample = 100e6 // Time between samples of the series
+)
+
+// Config describes the path and the application of a simulation. The path carries data
+// packets from the sender to the receiver, and Acks back, with the same latency both ways.
+type Config struct {
+	Latency int64   // One-way latency of the path
+	Rate    float64 // Data packets per second that the bottleneck of the path forwards, or zero for no bottleneck
+	Queue   int     // Data packets that the bottleneck queues, at most, or zero for no limit
+	Loss    float64 // Probability that a data packet is lost
+	AckLoss float64 // Probability that an Ack is lost
+	Every   int64   // Time between the packets of the application, or zero if it always has data
+	Size    int     // Bytes of application data per packet, or zero for full-sized packets
+	Sample  int64   // Time between samples of the series, or zero for DefaultSample
+	Seed    int64   // Seed of the random losses
+}
+
+// Sim is a simulation of a flow controlled by a CCID. A Sim must not be used concurrently.
+type Sim struct {
+	cfg    Config
+	clock  *virtualTime
+	env    *dccp.Env
+	scc    dccp.SenderCongestionControl
+	rcc    dccp.ReceiverCongestionControl
+	events eventQueue
+	err    error
+
+	appNext int64 // Time when the application has the next packet ready
+	burst   int   // Data packets sent at the current time
+	burstAt int64 // Time of the packets counted in burst
+	seqNo   int64 // Sequence number of the latest data packet
+	ackSeq  int64 // Sequence number of the latest Ack
+	gsr     int64 // Greatest sequence number of data received
+	gar     int64 // Greatest acknowledgement number received by the sender
+	busy    int64 // Time when the bottleneck is done with the packets queued in it
+	queued  int   // Data packets queued in the bottleneck
+
+	stats  Stats
+	series *series
+}
+
+// Stats counts the packets of a simulation
+type Stats struct {
+	Sent      int64 // Data packets sent
+	Delivered int64 // Data packets that reached the receiver
+	Lost      int64 // Data packets lost on the path
+	Dropped   int64 // Data packets dropped by the bottleneck when its queue was full
+	Acks      int64 // Acks sent
+	AckLost   int64 // Acks lost on the path
+}
+
+// New creates a simulation of a flow controlled by ccid, and opens its sender and receiver.
+// Full-sized packets are as large as the CCMPS of the sender, or DefaultSize if the CCMPS
+// exceeds the largest DCCP packet, as it does for congestion controls that count packets.
+func New(ccid dccp.CCID, cfg Config) *Sim {
+	if cfg.Sample <= 0 {
+		cfg.Sample = DefaultSample
+	}
+	s := &Sim{ cfg: cfg, series: newSeries() }
+	s.clock = &virtualTime{ now: Epoch, sim: s }
+	s.env = dccp.NewEnvTime(s.clock, s.series)
+	s.env.SetSeed(cfg.Seed)
+	s.scc = ccid.NewSender(s.env, dccp.NewAmb("sender", s.env))
+	s.rcc = ccid.NewReceiver(s.env, dccp.NewAmb("receiver", s.env))
+	s.appNext = Epoch
+	if s.cfg.Size <= 0 {
+		s.cfg.Size = DefaultSize
+		if ccmps := int(s.scc.GetCCMPS()); ccmps > 0 && ccmps <= maxPacketSize {
+			s.cfg.Size = ccmps
+		}
+	}
+
+	// Agree to the features that the Conn would negotiate on behalf of the CCIDs
+	if avs, ok := s.scc.(dccp.AckVectorSender); ok {
+		if avr, ok := s.rcc.(dccp.AckVectorReceiver); ok && avs.RequiresAckVector() {
+			avr.SetSendAckVector(true)
+		}
+	}
+	s.scc.Open()
+	s.rcc.Open()
+	if ars, ok := s.scc.(dccp.AckRatioSender); ok {
+		if arr, ok := s.rcc.(dccp.AckRatioReceiver); ok && ars.AckRatio() > 0 {
+			arr.SetAckRatio(ars.AckRatio())
+		}
+	}
+	s.at(Epoch, s.idle)
+	s.at(Epoch, s.sample)
+	return s
+}
+
+// Env returns the Env of the simulation, whose Time is virtual
+func (s *Sim) Env() *dccp.Env { return s.env }
+
+// Sender returns the sender congestion control
+func (s *Sim) Sender() dccp.SenderCongestionControl { return s.scc }
+
+// Receiver returns the receiver congestion control
+func (s *Sim) Receiver() dccp.ReceiverCongestionControl { return s.rcc }
+
+// Now returns the time since the start of the simulation
+func (s *Sim) Now() int64 { return s.clock.now - Epoch }
+
+// Stats returns the packet counts so far
+func (s *Sim) Stats() Stats { return s.stats }
+
+// Run continues the simulation for d nanoseconds of virtual time. It returns the error of the
+// first congestion control callback that asked for a reset of the connection, if any, or
+// ErrUnlimited, after which the simulation does not proceed.
+func (s *Sim) Run(d int64) error {
+	end := s.clock.now + d
+	pacer, isPacer := s.scc.(dccp.Pacer)
+	for s.err == nil && s.clock.now < end {
+		if s.appNext > s.clock.now {
+			s.advance(min64(s.appNext, end))
+			continue
+		}
+		if isPacer {
+			if next := pacer.NextSend(s.clock.now); next > s.clock.now {
+				s.advance(min64(next, end))
+				continue
+			}
+		} else {
+			// Strobe sleeps on the virtual time, which runs the simulation meanwhile
+			s.scc.Strobe()
+			if s.err != nil || s.clock.now >= end {
+				break
+			}
+		}
+		if s.clock.now != s.burstAt {
+			s.burst, s.burstAt = 0, s.clock.now
+		}
+		if s.burst++; s.burst > MaxBurst {
+			s.err = ErrUnlimited
+			break
+		}
+		s.writeData()
+	}
+	s.advance(end)
+	return s.err
+}
+
+// Close closes the sender and the receiver
+func (s *Sim) Close() {
+	s.scc.Close()
+	s.rcc.Close()
+}
+
+// advance runs the events that fall due until time t, and then moves the clock to t
+func (s *Sim) advance(t int64) {
+	for s.err == nil && s.events.peek() != nil && s.events.peek().At <= t {
+		e := heap.Pop(&s.events).(*event)
+		if e.At > s.clock.now {
+			s.clock.now = e.At
+		}
+		e.F()
+	}
+	if t > s.clock.now {
+		s.clock.now = t
+	}
+}
+
+// at schedules f to run at time t
+func (s *Sim) at(t int64, f func()) {
+	s.events.order++
+	heap.Push(&s.events, &event{ At: t, Order: s.events.order, F: f })
+}
+
+// fail records the first error of a callback that asks for a reset
+func (s *Sim) fail(err error) {
+	if _, ok := err.(dccp.CongestionReset); ok && s.err == nil {
+		s.err = err
+	}
+}
+
+// writeData sends a data packet of the application
+func (s *Sim) writeData() {
+	if s.cfg.Every > 0 {
+		s.appNext += s.cfg.Every
+	}
+	s.seqNo++
+	ph := &dccp.PreHeader{ Type: dccp.Data, X: true, SeqNo: s.seqNo, AckNo: s.gar, TimeWrite: s.clock.now }
+	ccval := s.scc.OnWrite(ph)
+	if ph.Delay > 0 {
+		// Like the write loop of the Conn, hold back the packet and the ones after it
+		s.advance(s.clock.now + ph.Delay)
+	}
+	now := s.clock.now
+	s.stats.Sent++
+	ff := &dccp.FeedforwardHeader{
+		Type:    dccp.Data,
+		X:       true,
+		SeqNo:   s.seqNo,
+		CCVal:   ccval,
+		Options: ph.Options,
+		DataLen: s.cfg.Size,
+	}
+	if s.cfg.Loss > 0 && s.env.Float64() < s.cfg.Loss {
+		s.stats.Lost++
+		return
+	}
+	leave := now
+	if s.cfg.Rate > 0 {
+		if s.cfg.Queue > 0 && s.queued >= s.cfg.Queue {
+			s.stats.Dropped++
+			return
+		}
+		s.busy = max64(s.busy, now) + int64(1e9 / s.cfg.Rate)
+		leave = s.busy
+		s.queued++
+		s.at(leave, func() { s.queued-- })
+	}
+	s.at(leave + s.cfg.Latency, func() { s.readData(ff) })
+}
+
+// readData hands a data packet to the receiver
+func (s *Sim) readData(ff *dccp.FeedforwardHeader) {
+	s.stats.Delivered++
+	if ff.SeqNo > s.gsr {
+		s.gsr = ff.SeqNo
+	}
+	ff.Time = s.clock.now
+	ff.CCOptions.Decode(ff.Options, 0)
+	err := s.rcc.OnRead(ff)
+	if err == dccp.CongestionAck {
+		s.writeAck()
+		return
+	}
+	s.fail(err)
+}
+
+// writeAck sends an Ack of the receiver
+func (s *Sim) writeAck() {
+	s.ackSeq++
+	ph := &dccp.PreHeader{ Type: dccp.Ack, X: true, SeqNo: s.ackSeq, AckNo: s.gsr, TimeWrite: s.clock.now }
+	s.rcc.OnWrite(ph)
+	s.stats.Acks++
+	if s.cfg.AckLoss > 0 && s.env.Float64() < s.cfg.AckLoss {
+		s.stats.AckLost++
+		return
+	}
+	fb := &dccp.FeedbackHeader{ Type: dccp.Ack, X: true, SeqNo: s.ackSeq, AckNo: s.gsr, Options: ph.Options }
+	s.at(s.clock.now + s.cfg.Latency, func() { s.readAck(fb) })
+}
+
+// readAck hands an Ack to the sender
+func (s *Sim) readAck(fb *dccp.FeedbackHeader) {
+	if fb.AckNo > s.gar {
+		s.gar = fb.AckNo
+	}
+	fb.Time = s.clock.now
+	fb.CCOptions.Decode(fb.Options, fb.AckNo)
+	s.fail(s.scc.OnRead(fb))
+}
+
+// idle polls the congestion controls about once per round-trip time, like the Conn does
+func (s *Sim) idle() {
+	now := s.clock.now
+	s.fail(s.scc.OnIdle(now))
+	if err := s.rcc.OnIdle(now); err == dccp.CongestionAck {
+		s.writeAck()
+	} else {
+		s.fail(err)
+	}
+	rtt := s.scc.GetRTT()
+	s.at(now + max64(dccp.RoundtripMin, min64(rtt, dccp.RoundtripDefault)), s.idle)
+}
+
+// sample takes a row of the series and schedules the next one
+func (s *Sim) sample() {
+	status := make(map[string]float64)
+	if r, ok := s.scc.(dccp.StatusReporter); ok {
+		for k, v := range r.Status() {
+			status["sender/" + k] = v
+		}
+	}
+	if r, ok := s.rcc.(dccp.StatusReporter); ok {
+		for k, v := range r.Status() {
+			status["receiver/" + k] = v
+		}
+	}
+	status["sim/sent"] = float64(s.stats.Sent)
+	status["sim/delivered"] = float64(s.stats.Delivered)
+	status["sim/queue"] = float64(s.queued)
+	s.series.snapshot(s.Now(), status)
+	s.at(s.clock.now + s.cfg.Sample, s.sample)
+}
+
+func min64(x, y int64) int64 {
+	if x < y {
+		return x
+	}
+	return y
+}
+
+func max64(x, y int64) int64 {
+	if x > y {
+		return x
+	}
+	return y
+}
@@ -0,0 +1,102 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package ccsim
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+	"github.com/petar/GoDCCP/dccp/ccid3"
+	"github.com/petar/GoDCCP/dccp/ledbat"
+)
+
+// TestFixed checks the clock and the path of the simulation with a sender of fixed rate
+func TestFixed(t *testing.T) {
+	s := New(dccp.CCFixed{ Every: 10e6 }, Config{ Latency: 25e6 })
+	if err := s.Run(10e9); err != nil {
+		t.Fatalf("run (%s)", err)
+	}
+	st := s.Stats()
+	if st.Sent < 999 || st.Sent > 1001 {
+		t.Errorf("sent %d packets in 10s at 100 per second", st.Sent)
+	}
+	// The packets of the latest 25ms are still on the path
+	if inflight := st.Sent - st.Delivered; inflight < 2 || inflight > 3 {
+		t.Errorf("%d packets in flight", inflight)
+	}
+	if s.Now() != 10e9 {
+		t.Errorf("simulation ended at %d", s.Now())
+	}
+}
+
+// tfrcRate returns the allowed sending rate of the TCP throughput equation of TFRC in bytes
+// per second, RFC 5348 Section 3.1, for segment size ss, round-trip time rtt and loss event
+// rate p, with t_RTO = 4*R and b = 1
+func tfrcRate(ss int, rtt int64, p float64) float64 {
+	r := float64(rtt) / 1e9
+	return float64(ss) / (r*math.Sqrt(2*p/3) + 4*r*(3*math.Sqrt(3*p/8))*p*(1+32*p*p))
+}
+
+// TestTFRC checks that CCID 3 settles at the rate of the TFRC equation over a path with random
+// losses, and that simulations are reproducible
+func TestTFRC(t *testing.T) {
+	const latency, loss = 50e6, 0.01
+	var stats []Stats
+	for i := 0; i < 2; i++ {
+		s := New(ccid3.CCID3{}, Config{ Latency: latency, Loss: loss, Seed: 1 })
+		if err := s.Run(60e9); err != nil {
+			t.Fatalf("run (%s)", err)
+		}
+		stats = append(stats, s.Stats())
+		if i > 0 {
+			continue
+		}
+		x, ok := s.Mean("sender/" + ccid3.XSample, 20e9, 60e9)
+		if !ok {
+			t.Fatalf("no samples of %s among %v", ccid3.XSample, s.Columns())
+		}
+		want := tfrcRate(ccid3.FixedSegmentSize, 2*latency, loss)
+		if x < 0.75*want || x > 1.25*want {
+			t.Errorf("allowed rate %.0f B/s, expecting %.0f B/s", x, want)
+		}
+		var w bytes.Buffer
+		if err := s.WriteCSV(&w); err != nil {
+			t.Fatalf("write csv (%s)", err)
+		}
+		if head := strings.SplitN(w.String(), "\n", 2)[0]; !strings.Contains(head, "sender/" + ccid3.XSample) {
+			t.Errorf("csv header %s", head)
+		}
+	}
+	if stats[0] != stats[1] {
+		t.Errorf("equally seeded simulations differ, %+v and %+v", stats[0], stats[1])
+	}
+}
+
+// TestLEDBATTarget checks that LEDBAT fills the bottleneck of a path while keeping its queueing
+// delay at the target
+func TestLEDBATTarget(t *testing.T) {
+	s := New(ledbat.LEDBAT{}, Config{ Latency: 25e6, Rate: 100 })
+	if err := s.Run(30e9); err != nil {
+		t.Fatalf("run (%s)", err)
+	}
+	d, ok := s.Mean("sender/Queueing-Delay", 10e9, 30e9)
+	if !ok || math.Abs(d - ledbat.Target/1e6) > 20 {
+		t.Errorf("queueing delay %.1f ms, expecting %.0f ms", d, ledbat.Target/1e6)
+	}
+	if st := s.Stats(); st.Delivered < 2900 || st.Dropped > 0 {
+		t.Errorf("delivered %d of 3000 packets, %d dropped", st.Delivered, st.Dropped)
+	}
+}
+
+// TestUnlimited checks that a sender that does not limit an application that always has data
+// fails the simulation, rather than keeping it from advancing
+func TestUnlimited(t *testing.T) {
+	s := New(dccp.CCUnlimited{}, Config{ Latency: 25e6 })
+	if err := s.Run(1e9); err != ErrUnlimited {
+		t.Errorf("run (%v)", err)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+// CCUnlimited is a CCID that never limits the sending rate: packets leave as fast as the
+// application writes them and the link accepts them. It is meant for measuring the transport
+// and the sandbox independently of congestion control, and has no place on a shared network.
+type CCUnlimited struct{}
+
+func (CCUnlimited) NewSender(env *Env, amb *Amb) SenderCongestionControl {
+	return unlimitedSenderControl{}
+}
+
+func (CCUnlimited) NewReceiver(env *Env, amb *Amb) ReceiverCongestionControl {
+	return unlimitedReceiverControl{}
+}
+
+// CCID_UNLIMITED is the experimental CCID of CCUnlimited, Section 10
+const CCID_UNLIMITED = 249
+
+// ---> Unlimited HC-Sender Congestion Control
+
+type unlimitedSenderControl struct{}
+
+func (unlimitedSenderControl) Open() {}
+
+func (unlimitedSenderControl) GetID() byte { return CCID_UNLIMITED }
+
+func (unlimitedSenderControl) GetCCMPS() int32 { return 1e9 }
+
+func (unlimitedSenderControl) GetRTT() int64 { return RoundtripDefault }
+
+func (unlimitedSenderControl) OnWrite(ph *PreHeader) (ccval int8) { return 0 }
+
+func (unlimitedSenderControl) OnRead(fb *FeedbackHeader) error { return nil }
+
+func (unlimitedSenderControl) OnIdle(now int64) error { return nil }
+
+func (unlimitedSenderControl) Strobe() {}
+
+func (unlimitedSenderControl) SetHeartbeat(interval int64) {}
+
+func (unlimitedSenderControl) Close() {}
+
+// ---> Unlimited HC-Receiver Congestion Control
+
+type unlimitedReceiverControl struct{}
+
+func (unlimitedReceiverControl) Open() {}
+
+func (unlimitedReceiverControl) GetID() byte { return CCID_UNLIMITED }
+
+func (unlimitedReceiverControl) OnWrite(ph *PreHeader) {}
+
+func (unlimitedReceiverControl) OnRead(ff *FeedforwardHeader) error { return nil }
+
+func (unlimitedReceiverControl) OnIdle(now int64) error { return nil }
+
+func (unlimitedReceiverControl) Close() {}
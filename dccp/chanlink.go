@@ -51,6 +51,23 @@ func (l *ChanLink) ReadFrom(buf []byte) (n int, addr net.Addr, err error) {
 	return len(p), nil, nil
 }
 
+// ReadBlock implements BlockLink.ReadBlock. Packets are copied once on WriteTo, and the copy is
+// handed to the reader as is.
+func (l *ChanLink) ReadBlock() (block []byte, addr net.Addr, err error) {
+	l.Lock()
+	in := l.in
+	l.Unlock()
+	if in == nil {
+		return nil, nil, ErrBad
+	}
+
+	p, ok := <-in
+	if !ok {
+		return nil, nil, ErrIO
+	}
+	return p, nil, nil
+}
+
 func (l *ChanLink) WriteTo(buf []byte, addr net.Addr) (n int, err error) {
 	l.Lock()
 	out := l.out
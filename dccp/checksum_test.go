@@ -37,3 +37,22 @@ func TestChecksum(t *testing.T) {
 	}
 
 }
+
+func TestReadHeaderNoChecksum(t *testing.T) {
+	gh := &Header{Type: DataAck, X: true, SeqNo: 0x334455667788, AckNo: 0x112233445566, Data: []byte{1, 2, 3}}
+	p, err := gh.Write(allocTestSourceIP, allocTestDestIP, 34, false)
+	if err != nil {
+		t.Fatalf("write (%s)", err)
+	}
+	p[6] ^= 0xff
+	if _, err = ReadHeader(p, allocTestSourceIP, allocTestDestIP, 34, false); err != ErrChecksum {
+		t.Errorf("read with a bad checksum returned %v", err)
+	}
+	gh2, err := ReadHeaderNoChecksum(p, false)
+	if err != nil {
+		t.Fatalf("read without checksum (%s)", err)
+	}
+	if gh2.SeqNo != gh.SeqNo || gh2.AckNo != gh.AckNo || len(gh2.Data) != len(gh.Data) {
+		t.Errorf("read %v, expecting %v", gh2, gh)
+	}
+}
@@ -0,0 +1,278 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// The codec properties below are checked against random headers. A failure reports the seed
+// of its generator, which reproduces the failing header when passed to newCodecGen.
+
+// CODEC_TRIALS is the number of random headers that each codec property is checked against
+const CODEC_TRIALS = 2000
+
+// codecGen generates random headers that are valid for the header codec
+type codecGen struct {
+	*rand.Rand
+	seed int64
+}
+
+func newCodecGen(seed int64) *codecGen {
+	return &codecGen{ Rand: rand.New(rand.NewSource(seed)), seed: seed }
+}
+
+// seqNo returns a random sequence number of 48 or 24 bits, favoring the ends of its range
+func (g *codecGen) seqNo(x bool) int64 {
+	max := int64(1)<<48 - 1
+	if !x {
+		max = 1<<24 - 1
+	}
+	switch g.Intn(5) {
+	case 0:
+		return 0
+	case 1:
+		return 1
+	case 2:
+		return max - 1
+	case 3:
+		return max
+	}
+	return g.Int63n(max + 1)
+}
+
+// bytes returns n random bytes
+func (g *codecGen) bytes(n int) []byte {
+	p := make([]byte, n)
+	for i := range p {
+		p[i] = byte(g.Intn(256))
+	}
+	return p
+}
+
+// option returns a random option that may appear on headers of type Type, and whose
+// footprint does not exceed room, or nil if there is no such option
+func (g *codecGen) option(Type byte, room int) *Option {
+	if room < 1 {
+		return nil
+	}
+	var t byte
+	if Type == Data {
+		// Data packets only carry a few of the options, Section 5.8
+		t = []byte{
+			OptionSlowReceiver,
+			OptionNDPCount,
+			OptionTimestamp,
+			OptionTimestampEcho,
+			OptionDataChecksum,
+		}[g.Intn(5)]
+	} else {
+		// Any option type but Padding and Mandatory, which the codec writes by itself
+		t = byte(2 + g.Intn(254))
+	}
+	// A Mandatory option may not precede an option that is reserved, Section 5.8.2, nor
+	// appear on a Data packet, Section 5.8
+	mandatory := Type != Data && !isOptionReserved(t) && g.Intn(4) == 0
+	o := &Option{ Type: t, Mandatory: mandatory }
+	foot, _ := o.getFootprint()
+	if foot > room {
+		if room < 2 || isOptionSingleByte(t) {
+			return nil
+		}
+		o.Mandatory = false
+		foot, _ = o.getFootprint()
+		if foot > room {
+			return nil
+		}
+	}
+	if !isOptionSingleByte(t) {
+		n := g.Intn(254)
+		if n > room-foot {
+			n = room - foot
+		}
+		o.Data = g.bytes(n)
+	}
+	return o
+}
+
+// header returns a random header of type Type. If maximal is set, the options of the header
+// fill the largest header that the codec accepts.
+func (g *codecGen) header(Type byte, maximal bool) (gh *Header, allowShort bool) {
+	gh = &Header{
+		SourcePort: uint16(g.Intn(1 << 16)),
+		DestPort:   uint16(g.Intn(1 << 16)),
+		CCVal:      int8(g.Intn(16)),
+		Type:       Type,
+		X:          true,
+	}
+	allowShort = g.Intn(2) == 0
+	if allowShort && areTypeAndXCompatible(Type, false, true) && g.Intn(2) == 0 {
+		gh.X = false
+	}
+	gh.SeqNo = g.seqNo(gh.X)
+	if getAckNoSubheaderSize(Type, gh.X) > 0 {
+		gh.AckNo = g.seqNo(gh.X)
+	}
+	switch Type {
+	case Request, Response:
+		gh.ServiceCode = g.Uint32()
+	case Reset:
+		gh.ResetCode = byte(g.Intn(256))
+		gh.ResetData = g.bytes(g.Intn(4))
+	}
+
+	// Options
+	room := 255*4 - getFixedHeaderSize(Type, gh.X)
+	if !maximal {
+		room = g.Intn(room + 1)
+	}
+	for {
+		o := g.option(Type, room)
+		if o == nil {
+			break
+		}
+		foot, _ := o.getFootprint()
+		room -= foot
+		gh.Options = append(gh.Options, *o)
+	}
+	if maximal {
+		// Fill what is left with single-byte options
+		for ; room > 0; room-- {
+			gh.Options = append(gh.Options, Option{ Type: OptionSlowReceiver })
+		}
+	}
+
+	// Application data and checksum coverage
+	gh.Data = g.bytes(g.Intn(64))
+	gh.CsCov = byte(g.Intn(16))
+	if cov, err := getChecksumAppCoverage(gh.CsCov, len(gh.Data)); err != nil || cov > len(gh.Data) {
+		gh.CsCov = CsCovAllData
+	}
+	return gh, allowShort
+}
+
+// expectHeader returns the header that reading the wire format of gh should yield
+func expectHeader(gh *Header) *Header {
+	want := *gh
+	if want.Type != Request && want.Type != Response {
+		want.ServiceCode = 0
+	}
+	if want.Type == Reset {
+		want.ResetData = make([]byte, 3)
+		copy(want.ResetData, gh.ResetData)
+	} else {
+		want.ResetCode, want.ResetData = 0, nil
+	}
+	return &want
+}
+
+// compareHeaders returns a description of the first difference between have and want, or
+// the empty string if the two are the same
+func compareHeaders(have, want *Header) string {
+	switch {
+	case have.SourcePort != want.SourcePort:
+		return fmt.Sprintf("SourcePort = %d want %d", have.SourcePort, want.SourcePort)
+	case have.DestPort != want.DestPort:
+		return fmt.Sprintf("DestPort = %d want %d", have.DestPort, want.DestPort)
+	case have.CCVal != want.CCVal:
+		return fmt.Sprintf("CCVal = %d want %d", have.CCVal, want.CCVal)
+	case have.CsCov != want.CsCov:
+		return fmt.Sprintf("CsCov = %d want %d", have.CsCov, want.CsCov)
+	case have.Type != want.Type:
+		return fmt.Sprintf("Type = %s want %s", TypeString(have.Type), TypeString(want.Type))
+	case have.X != want.X:
+		return fmt.Sprintf("X = %v want %v", have.X, want.X)
+	case have.SeqNo != want.SeqNo:
+		return fmt.Sprintf("SeqNo = %x want %x", have.SeqNo, want.SeqNo)
+	case have.AckNo != want.AckNo:
+		return fmt.Sprintf("AckNo = %x want %x", have.AckNo, want.AckNo)
+	case have.ServiceCode != want.ServiceCode:
+		return fmt.Sprintf("ServiceCode = %d want %d", have.ServiceCode, want.ServiceCode)
+	case have.ResetCode != want.ResetCode:
+		return fmt.Sprintf("ResetCode = %d want %d", have.ResetCode, want.ResetCode)
+	case !bytes.Equal(have.ResetData, want.ResetData):
+		return fmt.Sprintf("ResetData = %v want %v", have.ResetData, want.ResetData)
+	case !bytes.Equal(have.Data, want.Data):
+		return fmt.Sprintf("Data = %v want %v", have.Data, want.Data)
+	}
+	hopts, wopts := have.GetOptions(), want.GetOptions()
+	if len(hopts) != len(wopts) {
+		return fmt.Sprintf("%d options, want %d", len(hopts), len(wopts))
+	}
+	for i, w := range wopts {
+		h := hopts[i]
+		if h.Type != w.Type || h.Mandatory != w.Mandatory || !bytes.Equal(h.Data, w.Data) {
+			return fmt.Sprintf("option %d = %v, want %v", i, h, w)
+		}
+	}
+	return ""
+}
+
+// checkRoundTrip checks that gh reads back as written, and that the header read back writes
+// to the same wire format
+func checkRoundTrip(t *testing.T, g *codecGen, gh *Header, allowShort bool) {
+	p, err := gh.Write(allocTestSourceIP, allocTestDestIP, 34, allowShort)
+	if err != nil {
+		t.Fatalf("seed %d: write %s (%s)", g.seed, TypeString(gh.Type), err)
+	}
+	gh2, err := ReadHeader(p, allocTestSourceIP, allocTestDestIP, 34, allowShort)
+	if err != nil {
+		t.Fatalf("seed %d: read %s (%s)\n%s", g.seed, TypeString(gh.Type), err, dumpBytes(p))
+	}
+	if d := compareHeaders(gh2, expectHeader(gh)); d != "" {
+		t.Fatalf("seed %d: %s: %s\n%s", g.seed, TypeString(gh.Type), d, dumpBytes(p))
+	}
+	q, err := gh2.Write(allocTestSourceIP, allocTestDestIP, 34, allowShort)
+	if err != nil {
+		t.Fatalf("seed %d: rewrite %s (%s)", g.seed, TypeString(gh.Type), err)
+	}
+	if !bytes.Equal(p, q) {
+		t.Fatalf("seed %d: %s rewritten as\n%s\nwant\n%s", g.seed, TypeString(gh.Type), dumpBytes(q), dumpBytes(p))
+	}
+}
+
+// TestCodecRoundTrip checks that random headers of all types survive encoding and decoding
+func TestCodecRoundTrip(t *testing.T) {
+	g := newCodecGen(time.Now().UnixNano())
+	for i := 0; i < CODEC_TRIALS; i++ {
+		gh, allowShort := g.header(byte(i%(SyncAck+1)), false)
+		checkRoundTrip(t, g, gh, allowShort)
+	}
+}
+
+// TestCodecMaximal checks that headers whose options take up all the room that the Data Offset
+// field allows survive encoding and decoding, and that one more option is refused
+func TestCodecMaximal(t *testing.T) {
+	g := newCodecGen(time.Now().UnixNano())
+	for i := 0; i < CODEC_TRIALS/10; i++ {
+		gh, allowShort := g.header(byte(i%(SyncAck+1)), true)
+		checkRoundTrip(t, g, gh, allowShort)
+		p, _ := gh.Write(allocTestSourceIP, allocTestDestIP, 34, allowShort)
+		if n := len(p) - len(gh.Data); n != 255*4 {
+			t.Fatalf("seed %d: maximal %s header of %d bytes", g.seed, TypeString(gh.Type), n)
+		}
+		gh.Options = append(gh.Options, Option{ Type: OptionSlowReceiver })
+		if _, err := gh.Write(allocTestSourceIP, allocTestDestIP, 34, allowShort); err != ErrOversize {
+			t.Fatalf("seed %d: oversize %s header written (%v)", g.seed, TypeString(gh.Type), err)
+		}
+	}
+}
+
+// TestCodecMandatoryData checks that the codec refuses to write a Mandatory option on a Data
+// packet, which the reader would ignore
+func TestCodecMandatoryData(t *testing.T) {
+	gh := &Header{
+		Type:    Data,
+		X:       true,
+		Options: []Option{ { Type: OptionTimestamp, Data: []byte{1, 2, 3, 4}, Mandatory: true } },
+	}
+	if _, err := gh.Write(allocTestSourceIP, allocTestDestIP, 34, false); err != ErrOption {
+		t.Errorf("Mandatory option written on Data packet (%v)", err)
+	}
+}
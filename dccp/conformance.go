@@ -0,0 +1,140 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Deviation describes a place where GoDCCP departs from the behavior that RFC 4340 or, in
+// the case of CCID 3, RFC 4342 requires. Each occurrence of a deviation is logged with the
+// section that it departs from, and counted in the conformance report of the Env.
+type Deviation struct {
+	RFC     int    // Number of the RFC
+	Section string // Section of the RFC
+	Text    string // What GoDCCP does instead
+	Strict  bool   // True if strict RFC mode restores the behavior of the RFC
+}
+
+func (d *Deviation) String() string {
+	return fmt.Sprintf("RFC %d Section %s: %s", d.RFC, d.Section, d.Text)
+}
+
+var (
+	deviationsLk sync.Mutex
+	deviations   []*Deviation // All known deviations, in order of registration
+)
+
+// NewDeviation registers a deviation from the RFCs, so that it is listed in conformance
+// reports even if it never occurs. It is meant to be called during package initialization.
+func NewDeviation(rfc int, section, text string, strict bool) *Deviation {
+	d := &Deviation{RFC: rfc, Section: section, Text: text, Strict: strict}
+	deviationsLk.Lock()
+	defer deviationsLk.Unlock()
+	deviations = append(deviations, d)
+	return d
+}
+
+// Deviations returns all registered deviations, in order of registration
+func Deviations() []*Deviation {
+	deviationsLk.Lock()
+	defer deviationsLk.Unlock()
+	return append([]*Deviation{}, deviations...)
+}
+
+var (
+	devTIMEWAIT = NewDeviation(4340, "8.3",
+		"TIMEWAIT lasts MSL/2, rather than 2MSL", true)
+	devPARTOPENSync = NewDeviation(4340, "8.1.5",
+		"Client sends a Sync on entering PARTOPEN, so that the server's SyncAck moves it to OPEN", true)
+	devSimultaneousOpen = NewDeviation(4340, "8.5",
+		"Crossing Requests are resolved into a single connection, rather than answered with a Reset", true)
+	devInexactReset = NewDeviation(4340, "8.5",
+		"Resets within the window are ignored, unless their sequence number is GSR+1", true)
+	devOptionPolicy = NewDeviation(4340, "5.8",
+		"Faulty options are skipped under OptionsPermissive", true)
+	devViolationPolicy = NewDeviation(4340, "8.5",
+		"Protocol violations are treated according to a ViolationPolicy other than ViolationsRFC", true)
+	devMinCsCov = NewDeviation(4340, "9.2.1",
+		"Partial checksum coverage is sent and accepted while Minimum Checksum Coverage is 0", true)
+	devFeatures = NewDeviation(4340, "6",
+		"The CCIDs cannot be changed by feature negotiation once a connection exists", false)
+)
+
+// conformance holds the strict RFC mode of an Env and counts the deviations that occur
+type conformance struct {
+	sync.Mutex
+	strict bool
+	count  map[*Deviation]int64
+}
+
+// SetStrictRFC enables or disables strict RFC mode. In strict mode, the connections of the
+// Env follow RFC 4340 wherever GoDCCP otherwise departs from it, overriding the option and
+// violation policies of each Conn. Deviations that strict mode cannot remove are still
+// counted in the conformance report.
+func (t *Env) SetStrictRFC(strict bool) {
+	t.rfc.Lock()
+	defer t.rfc.Unlock()
+	t.rfc.strict = strict
+}
+
+// StrictRFC returns true if strict RFC mode is enabled
+func (t *Env) StrictRFC() bool {
+	t.rfc.Lock()
+	defer t.rfc.Unlock()
+	return t.rfc.strict
+}
+
+// Deviate records an occurrence of the deviation d and logs it to amb. The arguments args
+// are passed on to the log record, as in Amb.E.
+func (t *Env) Deviate(amb *Amb, d *Deviation, args ...interface{}) {
+	t.rfc.Lock()
+	if t.rfc.count == nil {
+		t.rfc.count = make(map[*Deviation]int64)
+	}
+	t.rfc.count[d]++
+	t.rfc.Unlock()
+	expStats.Add("deviations", 1)
+	amb.EC(1, EventWarn, "Deviation: "+d.String(), args...)
+}
+
+// DeviationCount returns the number of times that d has occurred
+func (t *Env) DeviationCount(d *Deviation) int64 {
+	t.rfc.Lock()
+	defer t.rfc.Unlock()
+	return t.rfc.count[d]
+}
+
+// WriteConformanceReport writes a report to w, which lists all known deviations from the
+// RFCs along with the number of times that each has occurred in the Env
+func (t *Env) WriteConformanceReport(w io.Writer) error {
+	all := Deviations()
+	strict := "off"
+	if t.StrictRFC() {
+		strict = "on"
+	}
+	if _, err := fmt.Fprintf(w, "RFC conformance report, strict mode %s\n\n", strict); err != nil {
+		return err
+	}
+	var occurred int
+	for _, d := range all {
+		n := t.DeviationCount(d)
+		if n > 0 {
+			occurred++
+		}
+		fix := "permanent"
+		if d.Strict {
+			fix = "strict"
+		}
+		_, err := fmt.Fprintf(w, "%8d  %-9s  RFC %d %-8s  %s\n", n, fix, d.RFC, "§"+d.Section, d.Text)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "\n%d of %d deviations occurred\n", occurred, len(all))
+	return err
+}
@@ -0,0 +1,251 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+// Package conformance checks GoDCCP against the requirements of RFC 4340 and RFC 4342. It
+// holds a catalog of scripted scenarios, in which a peer played by the script exchanges
+// packets with a Conn under test, or two Conns talk to each other while the script observes.
+// Each scenario checks one or more requirements, and the results are reported per requirement.
+//
+// Scenarios run in strict RFC mode, so known deviations that strict mode removes do not
+// cause failures. They run over the transports of the sandbox, in dilated time.
+package conformance
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// Requirement is a requirement of an RFC, which one or more scenarios check
+type Requirement struct {
+	RFC     int    // Number of the RFC
+	Section string // Section of the RFC
+	Text    string // What the RFC requires
+}
+
+func (r *Requirement) String() string {
+	return fmt.Sprintf("RFC %d Section %s: %s", r.RFC, r.Section, r.Text)
+}
+
+var (
+	requirementsLk sync.Mutex
+	requirements   []*Requirement // All requirements of the catalog, in order of registration
+)
+
+// newRequirement registers a requirement, so that it is listed in reports even if no
+// scenario that was run checks it
+func newRequirement(rfc int, section, text string) *Requirement {
+	r := &Requirement{RFC: rfc, Section: section, Text: text}
+	requirementsLk.Lock()
+	defer requirementsLk.Unlock()
+	requirements = append(requirements, r)
+	return r
+}
+
+// Requirements returns the requirements of the catalog, in order of registration
+func Requirements() []*Requirement {
+	requirementsLk.Lock()
+	defer requirementsLk.Unlock()
+	return append([]*Requirement{}, requirements...)
+}
+
+// Scenario is a scripted exchange that checks some requirements
+type Scenario struct {
+	Name string        // Short name, used to label results and traces
+	Text string        // Description of the exchange
+	Run  func(*Script) // Runs the exchange and checks the requirements
+}
+
+// Result is the outcome of checking a requirement in a scenario over a transport. Failures
+// that concern the scenario rather than a requirement, such as a peer that could not
+// complete a handshake or goroutines left running, have a nil Requirement.
+type Result struct {
+	Requirement *Requirement
+	Scenario    string
+	Transport   string
+	Pass        bool
+	Detail      string // Reason of the failure
+}
+
+// Script is the context of a running scenario. It creates the Conns and peers that take
+// part in the scenario, records the results of its checks, and cleans up once it ends.
+type Script struct {
+	Env       *dccp.Env
+	transport *Transport
+	scenario  *Scenario
+	lk        sync.Mutex
+	results   []*Result
+	conns     []*dccp.Conn
+	links     []*link
+}
+
+// Check records whether the requirement req holds. If it does not, format and args describe
+// the failure. Check returns ok, so that a scenario can stop at a failed check.
+func (s *Script) Check(req *Requirement, ok bool, format string, args ...interface{}) bool {
+	r := &Result{Requirement: req, Scenario: s.scenario.Name, Transport: s.transport.Name, Pass: ok}
+	if !ok {
+		r.Detail = fmt.Sprintf(format, args...)
+	}
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.results = append(s.results, r)
+	return ok
+}
+
+// Fatalf records a failure of the scenario itself and ends it. Like testing.T.FailNow, it
+// must be called from the goroutine that runs the scenario.
+func (s *Script) Fatalf(format string, args ...interface{}) {
+	s.Check(nil, false, format, args...)
+	runtime.Goexit()
+}
+
+// Read reads from conn like conn.Read, except that it returns dccp.ErrTimeout if no data
+// arrives within timeout nanoseconds
+func (s *Script) Read(conn *dccp.Conn, timeout int64) ([]byte, error) {
+	type read struct {
+		p   []byte
+		err error
+	}
+	ch, expire := make(chan read, 1), make(chan int)
+	s.Env.Go(func() {
+		p, err := conn.Read()
+		ch <- read{p, err}
+	}, "conformance·Read")
+	s.Env.AfterFunc(timeout, func() { close(expire) }, "conformance·Read expire")
+	select {
+	case r := <-ch:
+		return r.p, r.err
+	case <-expire:
+		return nil, dccp.ErrTimeout
+	}
+}
+
+// dilation is the time dilation of the Envs in which scenarios run
+const dilation = 20
+
+// leakGrace is the time allowed for the goroutines of a scenario to exit once it ends
+const leakGrace = 5e9
+
+// Run runs the scenarios over the transport tr and returns the results of their checks. If
+// trace is not nil, it is called with the name of each scenario to obtain the TraceWriter of
+// the scenario's Env.
+func Run(tr *Transport, scenarios []*Scenario, trace func(name string) dccp.TraceWriter) []*Result {
+	var results []*Result
+	for _, sc := range scenarios {
+		results = append(results, run(tr, sc, trace)...)
+	}
+	return results
+}
+
+func run(tr *Transport, sc *Scenario, trace func(string) dccp.TraceWriter) []*Result {
+	name := "conformance-" + tr.Name + "-" + sc.Name
+	var guzzle dccp.TraceWriter
+	if trace != nil {
+		guzzle = trace(name)
+	}
+	env := dccp.NewEnvTime(dccp.NewDilatedTime(dilation), guzzle)
+	if guzzle == nil {
+		env.SetTraceFilter("", dccp.LevelOff)
+	}
+	env.SetStrictRFC(true)
+	env.SetLeakGrace(leakGrace)
+	s := &Script{Env: env, transport: tr, scenario: sc}
+
+	done := make(chan int)
+	go func() {
+		defer close(done)
+		sc.Run(s)
+	}()
+	<-done
+
+	s.cleanup()
+	if err := env.Close(); err != nil {
+		s.Check(nil, false, "closing the Env (%s)", err)
+	}
+	return s.results
+}
+
+// cleanup aborts the Conns of the scenario and waits for them to finish. The links are closed
+// first, since a Conn does not close its link and its read loop could otherwise be blocked
+// until the read times out.
+func (s *Script) cleanup() {
+	var joiners []dccp.Joiner
+	for _, c := range s.conns {
+		c.Abort()
+		joiners = append(joiners, c.Joiner())
+	}
+	for _, l := range s.links {
+		l.close()
+	}
+	s.Env.NewGoJoin("end-of-scenario", joiners...).Join()
+}
+
+// WriteReport writes a report of results to w, which lists each requirement of the catalog
+// with its status over each transport: PASS if all of its checks passed, FAIL if any failed,
+// and a dash if it was not checked. The reasons of failures follow the status lines.
+func WriteReport(w io.Writer, results []*Result) error {
+	var transports []string
+	byReq := make(map[*Requirement]map[string][]*Result)
+	for _, r := range results {
+		if byReq[r.Requirement] == nil {
+			byReq[r.Requirement] = make(map[string][]*Result)
+		}
+		if !contains(transports, r.Transport) {
+			transports = append(transports, r.Transport)
+		}
+		byReq[r.Requirement][r.Transport] = append(byReq[r.Requirement][r.Transport], r)
+	}
+	if _, err := fmt.Fprintf(w, "RFC conformance suite\n\n"); err != nil {
+		return err
+	}
+	var passed, total int
+	for _, req := range append(Requirements(), nil) {
+		for _, tr := range transports {
+			rs := byReq[req][tr]
+			if req == nil && len(rs) == 0 {
+				continue
+			}
+			status, pass := "-", len(rs) > 0
+			for _, r := range rs {
+				pass = pass && r.Pass
+			}
+			if len(rs) > 0 {
+				total++
+				status = "FAIL"
+				if pass {
+					passed++
+					status = "PASS"
+				}
+			}
+			text := "Scenarios run to completion"
+			if req != nil {
+				text = fmt.Sprintf("RFC %d %-8s  %s", req.RFC, "§"+req.Section, req.Text)
+			}
+			if _, err := fmt.Fprintf(w, "%-4s  %-4s  %s\n", status, tr, text); err != nil {
+				return err
+			}
+			for _, r := range rs {
+				if r.Pass {
+					continue
+				}
+				if _, err := fmt.Fprintf(w, "            %s: %s\n", r.Scenario, r.Detail); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	_, err := fmt.Fprintf(w, "\n%d of %d requirements passed\n", passed, total)
+	return err
+}
+
+func contains(ss []string, s string) bool {
+	for _, t := range ss {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
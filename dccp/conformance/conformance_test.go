@@ -0,0 +1,27 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package conformance
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestConformance runs the catalog of scenarios over all transports, and fails if any
+// requirement does not hold
+func TestConformance(t *testing.T) {
+	for _, tr := range Transports() {
+		results := Run(tr, Scenarios(), nil)
+		var failed bool
+		for _, r := range results {
+			failed = failed || !r.Pass
+		}
+		if failed {
+			var w bytes.Buffer
+			WriteReport(&w, results)
+			t.Errorf("%s transport:\n%s", tr.Name, w.String())
+		}
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package conformance
+
+import (
+	"github.com/petar/GoDCCP/dccp"
+	"github.com/petar/GoDCCP/dccp/ccid3"
+)
+
+// Peer is the remote endpoint of a Conn under test, played by the script. It reads the
+// packets of the Conn and writes packets of its own, keeping track of sequence numbers.
+type Peer struct {
+	s    *Script
+	hc   dccp.HeaderConn
+	wire bool
+	gss  int64 // Sequence number of the latest packet written by the peer
+	gsr  int64 // Greatest sequence number received from the Conn
+}
+
+const (
+	peerISS = 1e6 // Initial sequence number of peers
+
+	// readStep is the read timeout of a single read of a peer. The transport may measure it
+	// in real time, so it is kept short to bound the overshoot in dilated time.
+	readStep = 10e6
+
+	// replyTimeout is the time that a peer waits for an immediate reply of the Conn
+	replyTimeout = 1e9
+
+	// peerRate is the fixed send rate of Conns under test, in packets per second. Peers send
+	// no CCID 3 feedback, which would otherwise slow the Conn down.
+	peerRate = 100
+
+	// ackRate is the fixed send rate of the server of a Pair, which sends only Acks. The
+	// CCID 3 sender paces all packets, so its rate is high enough not to delay feedback.
+	ackRate = 2000
+)
+
+func newPeer(s *Script, hc dccp.HeaderConn, wire bool) *Peer {
+	return &Peer{s: s, hc: hc, wire: wire, gss: peerISS - 1}
+}
+
+// GSS returns the sequence number of the latest packet written by the peer
+func (p *Peer) GSS() int64 {
+	return p.gss
+}
+
+// GSR returns the greatest sequence number received from the Conn
+func (p *Peer) GSR() int64 {
+	return p.gsr
+}
+
+// Send writes h with the next sequence number of the peer
+func (p *Peer) Send(h *dccp.Header) {
+	p.gss++
+	h.SeqNo = p.gss
+	p.Write(h)
+}
+
+// Write writes h with the sequence number that it already has. Unless h is a Request or a
+// Data packet, it acknowledges the greatest sequence number received from the Conn.
+func (p *Peer) Write(h *dccp.Header) {
+	h.X = true
+	if h.Type != dccp.Request && h.Type != dccp.Data {
+		h.AckNo = p.gsr
+	}
+	typ := dccp.TypeString(h.Type)
+	if p.wire {
+		buf, err := h.Write(dccp.LabelZero.Bytes(), dccp.LabelZero.Bytes(), dccp.AnyProto, false)
+		if err != nil {
+			p.s.Fatalf("encoding a %s (%s)", typ, err)
+		}
+		if h, err = dccp.ReadHeader(buf, dccp.LabelZero.Bytes(), dccp.LabelZero.Bytes(), dccp.AnyProto, false); err != nil {
+			p.s.Fatalf("decoding a %s (%s)", typ, err)
+		}
+	}
+	if err := p.hc.Write(h); err != nil {
+		p.s.Fatalf("writing a %s (%s)", typ, err)
+	}
+}
+
+// Read returns the next packet of the Conn, or nil if none arrives within timeout
+// nanoseconds or the Conn has closed the link
+func (p *Peer) Read(timeout int64) *dccp.Header {
+	env := p.s.Env
+	for deadline := env.Now() + timeout; env.Now() < deadline; {
+		p.hc.SetReadExpire(readStep)
+		h, err := p.hc.Read()
+		if err == dccp.ErrTimeout {
+			continue
+		}
+		if err != nil {
+			return nil
+		}
+		if h.SeqNo > p.gsr {
+			p.gsr = h.SeqNo
+		}
+		return h
+	}
+	return nil
+}
+
+// Expect returns the next packet of the Conn that has one of the given types, skipping
+// other packets, or nil if none arrives within timeout nanoseconds
+func (p *Peer) Expect(timeout int64, types ...byte) *dccp.Header {
+	env := p.s.Env
+	for deadline := env.Now() + timeout; env.Now() < deadline; {
+		h := p.Read(deadline - env.Now())
+		if h == nil {
+			return nil
+		}
+		for _, t := range types {
+			if h.Type == t {
+				return h
+			}
+		}
+	}
+	return nil
+}
+
+// Client creates a client Conn under test, which requests serviceCode, and the peer that
+// plays its server
+func (s *Script) Client() (*dccp.Conn, *Peer) {
+	l := s.open()
+	conn := s.newConn("client", l.dial, false, peerRate)
+	hc, err := l.accept()
+	if err != nil {
+		s.Fatalf("accepting the client (%s)", err)
+	}
+	return conn, newPeer(s, hc, l.wire)
+}
+
+// OpenClient is like Client, except that the peer first completes the handshake with the
+// Conn, so that it is OPEN once OpenClient returns
+func (s *Script) OpenClient() (*dccp.Conn, *Peer) {
+	conn, peer := s.Client()
+	req := peer.Expect(replyTimeout, dccp.Request)
+	if req == nil {
+		s.Fatalf("no Request from the client")
+	}
+	peer.Send(&dccp.Header{Type: dccp.Response, ServiceCode: req.ServiceCode})
+	if peer.Expect(replyTimeout, dccp.Ack, dccp.DataAck) == nil {
+		s.Fatalf("no Ack of the Response from the client")
+	}
+	peer.Send(&dccp.Header{Type: dccp.Ack})
+	return conn, peer
+}
+
+// Server creates a peer, which sends first, and the server Conn under test that receives it
+func (s *Script) Server(first *dccp.Header) (*dccp.Conn, *Peer) {
+	l := s.open()
+	peer := newPeer(s, l.dial, l.wire)
+	peer.Send(first)
+	hc, err := l.accept()
+	if err != nil {
+		s.Fatalf("accepting the peer (%s)", err)
+	}
+	return s.newConn("server", hc, true, peerRate), peer
+}
+
+// Pair creates a client and a server Conn, which are connected to each other. The client
+// sends at peerRate and the server at ackRate. If f is not
+// nil, it is called with each header that the server reads or writes, with out set for the
+// headers that it writes.
+func (s *Script) Pair(f func(h *dccp.Header, out bool)) (client, server *dccp.Conn) {
+	l := s.open()
+	client = s.newConn("client", l.dial, false, peerRate)
+	hc, err := l.accept()
+	if err != nil {
+		s.Fatalf("accepting the client (%s)", err)
+	}
+	if f != nil {
+		hc = &tap{hc, f}
+	}
+	return client, s.newConn("server", hc, true, ackRate)
+}
+
+// serviceCode is the service code that client Conns request
+const serviceCode = 0x54455354 // "TEST"
+
+func (s *Script) open() *link {
+	l := s.transport.open(s.Env)
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.links = append(s.links, l)
+	return l
+}
+
+func (s *Script) newConn(label string, hc dccp.HeaderConn, server bool, rate uint32) *dccp.Conn {
+	amb := dccp.NewAmb(label, s.Env)
+	amb.Flags().SetUint32("FixRate", rate)
+	ccid := ccid3.CCID3{}
+	var conn *dccp.Conn
+	if server {
+		conn = dccp.NewConnServer(s.Env, amb, hc, ccid.NewSender(s.Env, amb), ccid.NewReceiver(s.Env, amb))
+	} else {
+		conn = dccp.NewConnClient(s.Env, amb, hc, ccid.NewSender(s.Env, amb), ccid.NewReceiver(s.Env, amb), serviceCode)
+	}
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.conns = append(s.conns, conn)
+	return conn
+}
@@ -0,0 +1,359 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package conformance
+
+import (
+	"bytes"
+	"sync"
+	"github.com/petar/GoDCCP/dccp"
+	"github.com/petar/GoDCCP/dccp/ccid3"
+)
+
+var (
+	reqRequest = newRequirement(4340, "8.1.1",
+		"A client opens a connection with a Request that carries the requested Service Code")
+	reqRequestRetransmit = newRequirement(4340, "8.1.1",
+		"A client retransmits its Request when no Response arrives")
+	reqNewSeqNo = newRequirement(4340, "7",
+		"Every packet, including a retransmitted Request, carries a new sequence number")
+	reqResponse = newRequirement(4340, "8.1.3",
+		"A server answers a Request with a Response that acknowledges it and echoes its Service Code")
+	reqResponseRepeat = newRequirement(4340, "8.5",
+		"A server in RESPOND answers each retransmitted Request with a Response")
+	reqPartopenAck = newRequirement(4340, "8.1.5",
+		"A client in PARTOPEN acknowledges the Response")
+	reqClientOpen = newRequirement(4340, "8.1.5",
+		"A client in PARTOPEN enters OPEN on a packet from the server other than Response, Reset or Sync")
+	reqServerOpen = newRequirement(4340, "8.1.5",
+		"A server in RESPOND enters OPEN on an acknowledgement of its Response")
+	reqListenReset = newRequirement(4340, "8.5",
+		"A server in LISTEN answers a packet other than a Request with a Reset of code No Connection")
+	reqResetResponse = newRequirement(4340, "8.5",
+		"A Reset is never answered with a Reset")
+	reqValidReset = newRequirement(4340, "8.5",
+		"A Reset with a valid sequence number ends the connection")
+	reqInvalidReset = newRequirement(4340, "7.5.4",
+		"A Reset with an invalid sequence number is answered with a Sync that acknowledges GSR")
+	reqInvalidSync = newRequirement(4340, "7.5.4",
+		"Other packets with invalid sequence numbers are answered with a Sync that acknowledges them")
+	reqInvalidIgnored = newRequirement(4340, "7.5.4",
+		"A packet with an invalid sequence number does not disrupt the connection")
+	reqSyncAck = newRequirement(4340, "8.5",
+		"A Sync is answered with a SyncAck that acknowledges it")
+	reqClose = newRequirement(4340, "8.3",
+		"A Close is answered with a Reset of code Closed, and ends the connection")
+	reqMandatory = newRequirement(4340, "5.8.2",
+		"An unknown option marked Mandatory resets the connection with Reset Code Mandatory Error")
+	reqUnknownOption = newRequirement(4340, "5.8",
+		"An unknown option that is not marked Mandatory is ignored")
+	reqFeedbackRate = newRequirement(4342, "8.3",
+		"Feedback packets carry a Receive Rate option")
+	reqFeedbackElapsed = newRequirement(4342, "8.2",
+		"Feedback packets carry an Elapsed Time or a Timestamp Echo option")
+	reqFeedbackLoss = newRequirement(4342, "8.6",
+		"Feedback packets carry a Loss Intervals option")
+	reqFeedbackTiming = newRequirement(4342, "6",
+		"While data arrives, the receiver sends feedback at least once per round-trip time")
+)
+
+// Scenarios returns the catalog of scenarios
+func Scenarios() []*Scenario {
+	return []*Scenario{
+		{"request", "The peer ignores the Requests of a client", runRequest},
+		{"client-handshake", "The peer completes the handshake of a client, then sends it data", runClientHandshake},
+		{"server-handshake", "The peer requests a connection twice from a server, then acknowledges its Response", runServerHandshake},
+		{"listen-data", "The peer sends Data to a server in LISTEN", runListenData},
+		{"listen-reset", "The peer sends a Reset to a server in LISTEN", runListenReset},
+		{"reset", "The peer resets an open connection", runReset},
+		{"invalid-reset", "The peer sends a Reset with a sequence number outside the window", runInvalidReset},
+		{"invalid-ack", "The peer sends an Ack with a sequence number outside the window", runInvalidAck},
+		{"sync", "The peer sends a Sync on an open connection", runSync},
+		{"close", "The peer closes an open connection", runClose},
+		{"mandatory-option", "The peer sends an unknown option marked Mandatory", runMandatoryOption},
+		{"unknown-option", "The peer sends data with an unknown option", runUnknownOption},
+		{"feedback", "A client sends data to a server for several seconds", runFeedback},
+	}
+}
+
+// payload is the application data sent in scenarios
+var payload = []byte{1, 2, 3}
+
+// silence is the time for which a peer waits to ascertain that a Conn sends no reply
+const silence = 1e9
+
+// optionUnknown is the type of the unknown option sent by peers, from the reserved range
+const optionUnknown = 100
+
+func runRequest(s *Script) {
+	_, peer := s.Client()
+	first := peer.Expect(replyTimeout, dccp.Request)
+	if !s.Check(reqRequest, first != nil, "no Request") {
+		return
+	}
+	s.Check(reqRequest, first.ServiceCode == serviceCode,
+		"Request carries Service Code %d, expecting %d", first.ServiceCode, serviceCode)
+	second := peer.Expect(3*dccp.REQUEST_BACKOFF_FIRST, dccp.Request)
+	if !s.Check(reqRequestRetransmit, second != nil, "no Request retransmitted within 3 sec") {
+		return
+	}
+	s.Check(reqRequestRetransmit, second.ServiceCode == first.ServiceCode,
+		"retransmitted Request carries Service Code %d, expecting %d", second.ServiceCode, first.ServiceCode)
+	s.Check(reqNewSeqNo, second.SeqNo > first.SeqNo,
+		"retransmitted Request has SeqNo %d, after %d", second.SeqNo, first.SeqNo)
+}
+
+func runClientHandshake(s *Script) {
+	conn, peer := s.Client()
+	req := peer.Expect(replyTimeout, dccp.Request)
+	if req == nil {
+		s.Fatalf("no Request")
+	}
+	peer.Send(&dccp.Header{Type: dccp.Response, ServiceCode: req.ServiceCode})
+	ack := peer.Expect(replyTimeout, dccp.Ack, dccp.DataAck)
+	if !s.Check(reqPartopenAck, ack != nil, "no Ack of the Response") {
+		return
+	}
+	s.Check(reqPartopenAck, ack.AckNo == peer.GSS(), "Ack acknowledges %d, expecting %d", ack.AckNo, peer.GSS())
+	peer.Send(&dccp.Header{Type: dccp.DataAck, Data: payload})
+	p, err := s.Read(conn, replyTimeout)
+	s.Check(reqClientOpen, err == nil && bytes.Equal(p, payload), "read %v (%v), expecting %v", p, err, payload)
+}
+
+func runServerHandshake(s *Script) {
+	conn, peer := s.Server(&dccp.Header{Type: dccp.Request, ServiceCode: serviceCode})
+	resp := peer.Expect(replyTimeout, dccp.Response)
+	if !s.Check(reqResponse, resp != nil, "no Response") {
+		return
+	}
+	s.Check(reqResponse, resp.AckNo == peer.GSS() && resp.ServiceCode == serviceCode,
+		"Response acknowledges %d with Service Code %d, expecting %d and %d",
+		resp.AckNo, resp.ServiceCode, peer.GSS(), serviceCode)
+
+	peer.Send(&dccp.Header{Type: dccp.Request, ServiceCode: serviceCode})
+	resp = peer.Expect(replyTimeout, dccp.Response)
+	if !s.Check(reqResponseRepeat, resp != nil, "no Response to the retransmitted Request") {
+		return
+	}
+	s.Check(reqResponseRepeat, resp.AckNo == peer.GSS(), "Response acknowledges %d, expecting %d", resp.AckNo, peer.GSS())
+
+	peer.Send(&dccp.Header{Type: dccp.Ack})
+	if err := conn.Write(payload); err != nil {
+		s.Fatalf("server write (%s)", err)
+	}
+	h := peer.Expect(replyTimeout, dccp.Data, dccp.DataAck)
+	s.Check(reqServerOpen, h != nil && bytes.Equal(h.Data, payload), "server sent no data after the handshake")
+}
+
+func runListenData(s *Script) {
+	_, peer := s.Server(&dccp.Header{Type: dccp.Data, Data: payload})
+	h := peer.Expect(replyTimeout, dccp.Reset)
+	if !s.Check(reqListenReset, h != nil, "no Reset") {
+		return
+	}
+	s.Check(reqListenReset, h.ResetCode == dccp.ResetNoConnection && h.AckNo == peer.GSS(),
+		"Reset has code %s and acknowledges %d, expecting %s and %d",
+		dccp.ResetCodeString(h.ResetCode), h.AckNo, dccp.ResetCodeString(dccp.ResetNoConnection), peer.GSS())
+}
+
+func runListenReset(s *Script) {
+	reset := &dccp.Header{}
+	reset.InitResetHeader(dccp.ResetAborted)
+	_, peer := s.Server(reset)
+	h := peer.Expect(silence, dccp.Reset)
+	s.Check(reqResetResponse, h == nil, "server in LISTEN answered a Reset with a Reset")
+}
+
+func runReset(s *Script) {
+	conn, peer := s.OpenClient()
+	reset := &dccp.Header{}
+	reset.InitResetHeader(dccp.ResetAborted)
+	peer.Send(reset)
+	_, err := s.Read(conn, replyTimeout)
+	s.Check(reqValidReset, err != nil && err != dccp.ErrTimeout, "connection still open after the Reset")
+	h := peer.Expect(silence, dccp.Reset)
+	s.Check(reqResetResponse, h == nil, "client answered a Reset with a Reset")
+}
+
+// checkOpen checks that conn still carries data to the peer
+func checkOpen(s *Script, req *Requirement, conn *dccp.Conn, peer *Peer) {
+	if err := conn.Write(payload); err != nil {
+		s.Check(req, false, "write (%s)", err)
+		return
+	}
+	h := peer.Expect(replyTimeout, dccp.Data, dccp.DataAck)
+	s.Check(req, h != nil && bytes.Equal(h.Data, payload), "no data sent")
+}
+
+func runInvalidReset(s *Script) {
+	conn, peer := s.OpenClient()
+	gss := peer.GSS()
+	reset := &dccp.Header{SeqNo: gss + 1000}
+	reset.InitResetHeader(dccp.ResetAborted)
+	peer.Write(reset)
+	h := peer.Expect(replyTimeout, dccp.Sync, dccp.Reset)
+	if !s.Check(reqInvalidReset, h != nil && h.Type == dccp.Sync, "no Sync") {
+		s.Check(reqResetResponse, h == nil, "client answered a Reset with a Reset")
+		return
+	}
+	s.Check(reqInvalidReset, h.AckNo == gss, "Sync acknowledges %d, expecting %d", h.AckNo, gss)
+	checkOpen(s, reqInvalidIgnored, conn, peer)
+}
+
+func runInvalidAck(s *Script) {
+	conn, peer := s.OpenClient()
+	ack := &dccp.Header{Type: dccp.Ack, SeqNo: peer.GSS() + 1000}
+	peer.Write(ack)
+	h := peer.Expect(replyTimeout, dccp.Sync)
+	if !s.Check(reqInvalidSync, h != nil, "no Sync") {
+		return
+	}
+	s.Check(reqInvalidSync, h.AckNo == ack.SeqNo, "Sync acknowledges %d, expecting %d", h.AckNo, ack.SeqNo)
+	checkOpen(s, reqInvalidIgnored, conn, peer)
+}
+
+func runSync(s *Script) {
+	_, peer := s.OpenClient()
+	peer.Send(&dccp.Header{Type: dccp.Sync})
+	h := peer.Expect(replyTimeout, dccp.SyncAck)
+	if !s.Check(reqSyncAck, h != nil, "no SyncAck") {
+		return
+	}
+	s.Check(reqSyncAck, h.AckNo == peer.GSS(), "SyncAck acknowledges %d, expecting %d", h.AckNo, peer.GSS())
+}
+
+func runClose(s *Script) {
+	conn, peer := s.OpenClient()
+	peer.Send(&dccp.Header{Type: dccp.Close})
+	h := peer.Expect(replyTimeout, dccp.Reset)
+	if !s.Check(reqClose, h != nil, "no Reset") {
+		return
+	}
+	s.Check(reqClose, h.ResetCode == dccp.ResetClosed && h.AckNo == peer.GSS(),
+		"Reset has code %s and acknowledges %d, expecting %s and %d",
+		dccp.ResetCodeString(h.ResetCode), h.AckNo, dccp.ResetCodeString(dccp.ResetClosed), peer.GSS())
+	_, err := s.Read(conn, replyTimeout)
+	s.Check(reqClose, err != nil && err != dccp.ErrTimeout, "connection still open after the Close")
+}
+
+func runMandatoryOption(s *Script) {
+	_, peer := s.OpenClient()
+	ack := &dccp.Header{Type: dccp.Ack, Options: []dccp.Option{{Type: optionUnknown, Mandatory: true}}}
+	peer.Send(ack)
+	h := peer.Expect(replyTimeout, dccp.Reset)
+	if !s.Check(reqMandatory, h != nil, "no Reset") {
+		return
+	}
+	s.Check(reqMandatory, h.ResetCode == dccp.ResetMandatoryError, "Reset has code %s, expecting %s",
+		dccp.ResetCodeString(h.ResetCode), dccp.ResetCodeString(dccp.ResetMandatoryError))
+}
+
+func runUnknownOption(s *Script) {
+	conn, peer := s.OpenClient()
+	h := &dccp.Header{Type: dccp.DataAck, Data: payload, Options: []dccp.Option{{Type: optionUnknown, Data: []byte{1, 2}}}}
+	peer.Send(h)
+	p, err := s.Read(conn, replyTimeout)
+	s.Check(reqUnknownOption, err == nil && bytes.Equal(p, payload), "read %v (%v), expecting %v", p, err, payload)
+}
+
+// serverPacket describes a packet that the server reads or writes in the feedback scenario
+type serverPacket struct {
+	time    int64
+	out     bool
+	data    bool
+	options map[byte]bool
+}
+
+// feedbackWarmup is the time that passes from the start of the feedback scenario before
+// feedback packets are checked, which allows for the handshake and the first RTT estimates
+const feedbackWarmup = 1e9
+
+// At most one in feedbackLateRatio data packets may be followed by late feedback
+const feedbackLateRatio = 20
+
+func runFeedback(s *Script) {
+	var lk sync.Mutex
+	var log []*serverPacket
+	t0 := s.Env.Now()
+	client, server := s.Pair(func(h *dccp.Header, out bool) {
+		p := &serverPacket{time: s.Env.Now(), out: out, data: h.Type == dccp.Data || h.Type == dccp.DataAck}
+		if out && h.Type != dccp.Ack && h.Type != dccp.DataAck {
+			return
+		}
+		if out {
+			p.options = make(map[byte]bool)
+			for _, o := range h.Options {
+				p.options[o.Type] = true
+			}
+		}
+		lk.Lock()
+		defer lk.Unlock()
+		log = append(log, p)
+	})
+	s.Env.Go(func() {
+		for {
+			if _, err := server.Read(); err != nil {
+				return
+			}
+		}
+	}, "conformance·feedback reader")
+	for s.Env.Now()-t0 < 4e9 {
+		if err := client.Write(payload); err != nil {
+			s.Fatalf("client write (%s)", err)
+		}
+	}
+	end := s.Env.Now()
+	// The receiver checks whether feedback is due on the ticks of its idle timer, which
+	// cannot be finer than dccp.RoundtripMin, so a delay of up to one tick more is tolerated
+	rtt := max64(client.Features().RTT, dccp.RoundtripMin)
+	due := 2 * rtt
+	lk.Lock()
+	defer lk.Unlock()
+
+	var n, arrivals, late int // Feedback packets, data packets and those followed by late feedback
+	rate, elapsed, loss := true, true, true
+	for i, p := range log {
+		if p.time-t0 < feedbackWarmup {
+			continue
+		}
+		if !p.out {
+			if !p.data || p.time+due > end {
+				continue
+			}
+			arrivals++
+			var answered bool
+			for _, g := range log[i+1:] {
+				if g.out {
+					answered = g.time-p.time <= due
+					break
+				}
+			}
+			if !answered {
+				late++
+			}
+			continue
+		}
+		n++
+		rate = rate && p.options[ccid3.OptionReceiveRate]
+		elapsed = elapsed && (p.options[dccp.OptionElapsedTime] || p.options[dccp.OptionTimestampEcho])
+		loss = loss && p.options[ccid3.OptionLossIntervals]
+	}
+	if n == 0 {
+		s.Fatalf("no feedback")
+	}
+	s.Check(reqFeedbackRate, rate, "feedback without Receive Rate")
+	s.Check(reqFeedbackElapsed, elapsed, "feedback without Elapsed Time or Timestamp Echo")
+	s.Check(reqFeedbackLoss, loss, "feedback without Loss Intervals")
+	// Dilated time magnifies the scheduling jitter of the host, so a few late replies are
+	// tolerated
+	s.Check(reqFeedbackTiming, late*feedbackLateRatio <= arrivals,
+		"no feedback within %d ns of %d of %d data packets, with an RTT of %d ns", due, late, arrivals, rtt)
+}
+
+func max64(x, y int64) int64 {
+	if x > y {
+		return x
+	}
+	return y
+}
@@ -0,0 +1,90 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package conformance
+
+import (
+	"github.com/petar/GoDCCP/dccp"
+	"github.com/petar/GoDCCP/dccp/sandbox"
+)
+
+// Transport carries the packets of the scenarios between their endpoints
+type Transport struct {
+	Name string
+	open func(env *dccp.Env) *link
+}
+
+// link is a transport instance that connects two endpoints
+type link struct {
+	dial   dccp.HeaderConn                 // The end of the link that initiates
+	accept func() (dccp.HeaderConn, error) // Returns the other end, once the first packet is sent
+	wire   bool                            // True if packets are passed as Headers, rather than encoded
+	close  func()
+}
+
+var (
+	// Pipe passes headers over an in-memory sandbox.Pipe, without encoding them. To subject
+	// the packets of peers to the parsing of the wire format, peers encode and decode them
+	// before writing them.
+	Pipe = &Transport{Name: "pipe", open: openPipe}
+
+	// Mux passes encoded packets between two dccp.Mux instances over an in-memory ChanLink
+	Mux = &Transport{Name: "mux", open: openMux}
+)
+
+// Transports returns all transports
+func Transports() []*Transport {
+	return []*Transport{Pipe, Mux}
+}
+
+func openPipe(env *dccp.Env) *link {
+	a, b, _ := sandbox.NewPipe(env, dccp.NewAmb("line", env), "dial", "accept")
+	return &link{
+		dial:   a,
+		accept: func() (dccp.HeaderConn, error) { return b, nil },
+		wire:   true,
+		close:  func() { a.Close(); b.Close() },
+	}
+}
+
+func openMux(env *dccp.Env) *link {
+	dlink, alink := dccp.NewChanPipe()
+	dmux, amux := dccp.NewMux(dlink), dccp.NewMux(alink)
+	l := &link{
+		accept: func() (dccp.HeaderConn, error) {
+			seg, err := amux.Accept()
+			if err != nil {
+				return nil, err
+			}
+			return dccp.NewHeaderConn(seg), nil
+		},
+		close: func() { dmux.Close(); amux.Close() },
+	}
+	seg, err := dmux.Dial(nil)
+	if err != nil {
+		panic("dialing a ChanLink: " + err.Error())
+	}
+	l.dial = dccp.NewHeaderConn(seg)
+	return l
+}
+
+// tap is a HeaderConn that passes each header that it reads or writes to a function, with
+// out set for the headers that it writes
+type tap struct {
+	dccp.HeaderConn
+	f func(h *dccp.Header, out bool)
+}
+
+func (t *tap) Read() (*dccp.Header, error) {
+	h, err := t.HeaderConn.Read()
+	if err == nil {
+		t.f(h, false)
+	}
+	return h, err
+}
+
+func (t *tap) Write(h *dccp.Header) error {
+	t.f(h, true)
+	return t.HeaderConn.Write(h)
+}
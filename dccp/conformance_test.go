@@ -0,0 +1,40 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestConformanceReport(t *testing.T) {
+	env := NewEnvTime(&manualTime{}, nil)
+	amb := NewAmb("test", env)
+	env.Deviate(amb, devTIMEWAIT)
+	env.Deviate(amb, devTIMEWAIT)
+	env.Deviate(amb, devFeatures)
+	if n := env.DeviationCount(devTIMEWAIT); n != 2 {
+		t.Errorf("counted %d deviations, expecting 2", n)
+	}
+
+	var w bytes.Buffer
+	if err := env.WriteConformanceReport(&w); err != nil {
+		t.Fatalf("report (%s)", err)
+	}
+	report := w.String()
+	for _, s := range []string{
+		"strict mode off",
+		fmt.Sprintf("%8d  strict     RFC 4340 §8.3      %s", 2, devTIMEWAIT.Text),
+		fmt.Sprintf("%8d  permanent  RFC 4340 §6        %s", 1, devFeatures.Text),
+		fmt.Sprintf("%8d  strict     RFC 4340 §8.1.5    %s", 0, devPARTOPENSync.Text),
+		fmt.Sprintf("2 of %d deviations occurred", len(Deviations())),
+	} {
+		if !strings.Contains(report, s) {
+			t.Errorf("report lacks %q:\n%s", s, report)
+		}
+	}
+}
@@ -4,34 +4,109 @@
 
 package dccp
 
+import (
+	"sync/atomic"
+)
+
 // Conn 
+//
+// Goroutines: A Conn writes in a write loop of its own, and it polls its CCIDs on the timer
+// wheel of its Env. It reads in a read loop of its own, unless its HeaderConn is a
+// HeaderNotifier, like the flows of a Mux, which hands the packets over from the read loop of
+// the Mux. Such Conns run a single goroutine each. Conns over other HeaderConns, such as the
+// links of the sandbox, still run two goroutines each.
+//
+// Lock hierarchy: The Conn Mutex guards the socket variables and ccidOpen, and it is held by
+// the read loop while it processes a packet. Packets handed over by a Mux are processed with
+// the processLk of the Mux held, which thus comes before the Conn Mutex. The locks readAppLk
+// and errLk, the lock of the writeQueue, and those of the Env and its CookieJar, are leaves:
+// they may be acquired while holding the Conn Mutex, but no other lock may be acquired while
+// holding them. The CCIDs are called with or without the Conn Mutex held, and they must never
+// call back into the Conn. The connection state and RTT are mirrored in atomic variables, so
+// the loops can poll them without taking the Conn Mutex.
 type Conn struct {
 	env   *Env
 	amb   *Amb
 
 	hc    HeaderConn
-	scc   SenderCongestionControl
-	rcc   ReceiverCongestionControl
+	ccids atomic.Value // The *ccidPair in use; replaced when CCID negotiation picks other CCIDs
 
-	Mutex                       // Protects access to socket, ccidOpen and err
+	Mutex                       // Protects access to socket, ccidOpen, features, optionPolicy and the reply limits and stats
 	socket
 	ccidOpen       bool         // True if the sender and receiver CCID's have been opened
+	writeClosed    bool         // Set by CloseWrite; the sender CCID is not opened again
+	padTo          int          // Wire size that outgoing packets are padded to, set by SetPadding
+	mandatory      map[byte]bool // Option types that are marked Mandatory when sent, set by SetMandatory
+	features       map[featureKey]*featureNeg // Features that have been negotiated, or are being negotiated
+	deliverCorrupt bool         // Deliver data that fails its Data Checksum, set by SetDeliverCorrupt
+	seqWinTime     int64        // Time of the last sending rate measurement of adjustSequenceWindow
+	tclass         byte         // Traffic class set by SetTrafficClass
+	tclassMarked   byte         // Traffic class that the HeaderConn marks packets with
+	ecn            bool         // Mark packets ECN-capable, set by SetECN
+	seqWinGSS      int64        // GSS at seqWinTime
+
+	state          int32        // Mirrors socket.State; accessed atomically
+	rtt            int64        // Mirrors socket.RTT; accessed atomically
+
+	errLk          Mutex        // Held, in addition to the Conn Mutex, when writing err; either suffices for reading
 	err            error        // Reason for connection tear down
 
-	readAppLk      Mutex
-	readApp        chan []byte  // readLoop() sends application data to Read()
-	writeDataLk    Mutex
-	writeData      chan []byte  // Write() sends application data to writeLoop()
-	writeNonDataLk Mutex
-	writeNonData   chan *writeHeader // inject() sends wire-format non-Data packets (higher priority) to writeLoop()
+	hooksLk        Mutex
+	sentHooks      []PacketHook // Called with each packet sent, see OnPacketSent; guarded by hooksLk
+	readHooks      []PacketHook // Called with each packet received, see OnPacketReceived; guarded by hooksLk
+	journal        *Journal     // Records the inputs of the Conn, see StartJournal; guarded by hooksLk
 
-	writeTime      monotoneTime
+	readAppLk      Mutex
+	readApp        chan readMsg // readLoop() sends application data to Read()
+	readClosed     bool         // Set by CloseRead; guarded by readAppLk
+	readLimit      int          // Messages queued in readApp before data is dropped; guarded by readAppLk
+	readHighWater  int          // Messages queued in readApp before Slow Receiver is sent; guarded by readAppLk
+	writeQueue     *writeQueue  // Write() and inject() queue application data and non-Data packets for writeLoop()
+	writePH        PreHeader    // Shown to the CCIDs by writeLoop(), which alone uses it; owns the options they place
+	writeOpts      []Option     // Options of the header being written by writeLoop(), reused across packets
+	drops          chan DropReport // Reports dropped application data to the application
+	sent           [SentHistoryLen]sentMsg // Recently sent messages, indexed by sequence number
+	recvSeen       [RecvHistoryLen]int64 // Sequence numbers, plus one, of recently received packets
+	dataDropped    []DataDrop   // Received packets dropped since the last Data Dropped option
+
+	syncLimit      replyLimit   // Rate limits Syncs sent in reply to received packets
+	resetChain     int          // Consecutive received Resets answered with a Sync; see ResetChainLimit
+	resetLimit     replyLimit   // Rate limits Resets sent in reply to received packets
+	stats          ConnStats    // Counts suspect packets and rate-limited replies
+	latency        LatencyStats // Latency breakdown of the application data sent
+	amplify        amplifyLimit // Limits the bytes sent to a client before its address is verified
+	optionPolicy   OptionPolicy // Treatment of received packets with faulty options
+	initCookie     []byte       // Init Cookie received by a client with the Response, echoed in PARTOPEN
+
+	violationPolicy ViolationPolicy  // Treatment of received packets that violate the protocol
+	violationFunc   func(*Violation) // If not nil, called with each violation
+
+	expState       string       // DCCP state of the connection, as last published via expvar
+
+	timewait       *Timer       // Ends TIMEWAIT; stopped if the connection is aborted sooner
+
+	validating     int32        // Nonzero while a path that the Conn migrated to is unconfirmed; accessed atomically
+	migrateGSS     int64        // GSS at the time of the last migration
+
+	id             uint64       // Number of the connection, unique within the process; see Trace.Conn
+	gojoin         *GoJoin      // Goroutines of the connection; they are also added to the GoJoin of the Env
 }
 
+// connSeq numbers the connections of the process
+var connSeq int64
+
 // Joiner returns a Joiner instance that can wait until all goroutines
-// associated with the connection have completed.
+// associated with the connection have completed. Other connections on
+// the same Env are not waited on.
 func (c *Conn) Joiner() Joiner {
-	return c.env.Joiner()
+	return c.gojoin
+}
+
+// goConn runs f in a new goroutine that belongs to the connection
+func (c *Conn) goConn(f func(), fmt_ string, args_ ...interface{}) {
+	g := GoCaller(f, 1, fmt_, args_...)
+	c.gojoin.Add(g)
+	c.env.gojoin.Add(g)
 }
 
 // Amb returns the Amb instance associated with this connection
@@ -41,25 +116,30 @@ func (c *Conn) Amb() *Amb {
 
 func newConn(env *Env, amb *Amb, hc HeaderConn, scc SenderCongestionControl, rcc ReceiverCongestionControl) *Conn {
 	c := &Conn{
-		env:          env,
-		amb:          amb,
-		hc:           hc,
-		scc:          scc,
-		rcc:          rcc,
-		ccidOpen:     false,
-		readApp:      make(chan []byte, 5),
-		writeData:    make(chan []byte),
-		writeNonData: make(chan *writeHeader, 5),
+		env:           env,
+		amb:           amb,
+		hc:            hc,
+		ccidOpen:      false,
+		readApp:       make(chan readMsg, READ_QUEUE_MAX),
+		readLimit:     READ_QUEUE_DEFAULT,
+		writeQueue:    newWriteQueue(),
+		drops:         make(chan DropReport, DropReportQueueLen),
+		gojoin:        env.NewGoJoin("Conn"),
 	}
-	c.writeTime.Init(env)
+	c.ccids.Store(&ccidPair{scc, rcc})
+	c.writeQueue.now = env.Now
+	c.SetEventsLen(ConnEventsLen)
+	c.id = uint64(atomic.AddInt64(&connSeq, 1))
+	c.amb.setConn(c.id)
+	c.liveAdd()
 
 	c.Lock()
-	// Currently, CCID is not negotiated, rather both sides use the same
+	// Each half-connection starts with the CCID of its congestion control, until the CCID
+	// feature is negotiated, Section 10
 	c.socket.SetCCIDA(scc.GetID())
 	c.socket.SetCCIDB(rcc.GetID())
 
-	// REMARK: SWAF/SWBF are currently not implemented. 
-	// Instead, we use wide enough fixed-size windows
+	// The Sequence Windows start wide enough and fixed-size, until ChangeFeature negotiates them
 	c.socket.SetSWAF(SEQWIN_FIXED)
 	c.socket.SetSWBF(SEQWIN_FIXED)
 
@@ -73,15 +153,24 @@ func newConn(env *Env, amb *Amb, hc HeaderConn, scc SenderCongestionControl, rcc
 func NewConnServer(env *Env, amb *Amb, hc HeaderConn, 
 	scc SenderCongestionControl, rcc ReceiverCongestionControl) *Conn {
 
+	return newConnServer(env, amb, hc, scc, rcc, 0)
+}
+
+// newConnServer creates a server Conn that only accepts a Request for the Service Code
+// serviceCode, unless it is zero, Section 8.1.2
+func newConnServer(env *Env, amb *Amb, hc HeaderConn, 
+	scc SenderCongestionControl, rcc ReceiverCongestionControl, serviceCode uint32) *Conn {
+
 	c := newConn(env, amb, hc, scc, rcc)
 
 	c.Lock()
+	c.socket.SetServiceCode(serviceCode)
 	c.gotoLISTEN()
 	c.Unlock()
 
-	c.env.Go(func() { c.writeLoop(c.writeNonData, c.writeData) }, "ConnServer·writLoop")
-	c.env.Go(func() { c.readLoop() }, "ConnServer·readLoop")
-	c.env.Go(func() { c.idleLoop() }, "ConnServer·idleLoop")
+	c.goConn(func() { c.profiled(ProfileWrite, func() { c.writeLoop(c.writeQueue) }) }, "ConnServer·writLoop")
+	c.startReading("ConnServer·readLoop")
+	c.env.AfterFunc(0, c.idleTick, "ConnServer·idleTick")
 	return c
 }
 
@@ -94,8 +183,28 @@ func NewConnClient(env *Env, amb *Amb, hc HeaderConn,
 	c.gotoREQUEST(serviceCode)
 	c.Unlock()
 
-	c.env.Go(func() { c.writeLoop(c.writeNonData, c.writeData) }, "ConnClient·writeLoop")
-	c.env.Go(func() { c.readLoop() }, "ConnClient·readLoop")
-	c.env.Go(func() { c.idleLoop() }, "ConnClient·idleLoop")
+	c.goConn(func() { c.profiled(ProfileWrite, func() { c.writeLoop(c.writeQueue) }) }, "ConnClient·writeLoop")
+	c.startReading("ConnClient·readLoop")
+	c.env.AfterFunc(0, c.idleTick, "ConnClient·idleTick")
 	return c
 }
+
+// setState sets the socket state and its lock-free mirror
+func (c *Conn) setState(state int) {
+	c.AssertLocked()
+	c.socket.SetState(state)
+	atomic.StoreInt32(&c.state, int32(state))
+}
+
+// loadState returns the connection state without locking c
+func (c *Conn) loadState() int { return int(atomic.LoadInt32(&c.state)) }
+
+// setRTT sets the socket RTT and its lock-free mirror
+func (c *Conn) setRTT(rtt int64) {
+	c.AssertLocked()
+	c.socket.SetRTT(rtt)
+	atomic.StoreInt64(&c.rtt, rtt)
+}
+
+// loadRTT returns the round-trip time estimate without locking c
+func (c *Conn) loadRTT() int64 { return atomic.LoadInt64(&c.rtt) }
@@ -0,0 +1,248 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"sort"
+)
+
+const (
+	CookieKeyLifetime = 60e9 // Default time between key rotations of a CookieJar, in ns
+	cookieKeyLen      = 32   // Size of the HMAC keys in bytes
+	cookieMACLen      = 12   // Size of the truncated HMAC in an Init Cookie
+	cookieParamsLen   = 7    // Size of the key generation, service code and CCIDs in an Init Cookie
+)
+
+// InitCookie holds the connection parameters that a server encodes in the Init Cookie
+// option of its Response, and recovers from the client's echo of it, Section 8.1.4
+type InitCookie struct {
+	ServiceCode uint32
+	CCIDA       byte // HC-Sender CCID of the server
+	CCIDB       byte // HC-Receiver CCID of the server
+	Features    []CookieFeature // Features agreed on in the handshake, ordered by number and location
+}
+
+// CookieFeature is the value of a feature, as pinned down by an Init Cookie
+type CookieFeature struct {
+	Location FeatureLocation // Location of the feature, as seen by the server
+	Number   byte
+	Value    uint64
+}
+
+// CookieJar makes and verifies Init Cookies. An Init Cookie carries the InitCookie
+// parameters of a connection in the clear, along with an HMAC over them and over the
+// addresses of both endpoints. The HMAC key is replaced every lifetime nanoseconds. Cookies
+// made with the key preceding the current one remain valid, so that a handshake that spans a
+// key rotation succeeds. A CookieJar keeps no state for the clients whose cookies it makes,
+// so it verifies a cookie from the cookie alone. The server Conns of GoDCCP still keep their
+// state in RESPOND, though, and check the parameters of a verified cookie against it.
+type CookieJar struct {
+	Mutex
+	env      *Env
+	lifetime int64
+	gen      byte     // Generation of the current key, sent in the first byte of each cookie
+	keys     [2][]byte // Current key and, if not nil, the one preceding it
+	rotateAt int64    // Time when the current key is to be replaced
+}
+
+// NewCookieJar creates a CookieJar whose keys rotate every lifetime nanoseconds of env's time
+func NewCookieJar(env *Env, lifetime int64) *CookieJar {
+	j := &CookieJar{env: env, lifetime: lifetime}
+	j.keys[0] = newCookieKey()
+	j.rotateAt = env.Now() + lifetime
+	return j
+}
+
+func newCookieKey() []byte {
+	key := make([]byte, cookieKeyLen)
+	if _, err := rand.Read(key); err != nil {
+		panic("cookie key randomness")
+	}
+	return key
+}
+
+// rotate brings the keys up to date with the current time
+func (j *CookieJar) rotate() {
+	j.AssertLocked()
+	now := j.env.Now()
+	for i := 0; i < 2 && now >= j.rotateAt; i++ {
+		j.keys[1], j.keys[0] = j.keys[0], newCookieKey()
+		j.gen++
+		j.rotateAt += j.lifetime
+	}
+	if now >= j.rotateAt {
+		// Both keys have expired, so no earlier cookie remains valid
+		j.keys[1] = nil
+		j.rotateAt = now + j.lifetime
+	}
+}
+
+// Make returns an Init Cookie for the connection between the local and remote addresses
+// with parameters p
+func (j *CookieJar) Make(p InitCookie, local, remote Bytes) []byte {
+	j.Lock()
+	defer j.Unlock()
+	j.rotate()
+	cookie := make([]byte, cookieParamsLen)
+	cookie[0] = j.gen
+	EncodeUint32(p.ServiceCode, cookie[1:5])
+	cookie[5], cookie[6] = p.CCIDA, p.CCIDB
+	for _, f := range p.Features {
+		cookie = append(cookie, encodeCookieFeature(f)...)
+	}
+	return append(cookie, cookieMAC(j.keys[0], cookie, local, remote)...)
+}
+
+// Open verifies that cookie was made by j, with a current or the preceding key, for the
+// connection between the local and remote addresses. It returns the parameters carried by
+// the cookie.
+func (j *CookieJar) Open(cookie []byte, local, remote Bytes) (p InitCookie, ok bool) {
+	if len(cookie) < cookieParamsLen+cookieMACLen {
+		return InitCookie{}, false
+	}
+	params := cookie[:len(cookie)-cookieMACLen]
+	j.Lock()
+	j.rotate()
+	var key []byte
+	switch cookie[0] {
+	case j.gen:
+		key = j.keys[0]
+	case j.gen - 1:
+		key = j.keys[1]
+	}
+	j.Unlock()
+	if key == nil || !hmac.Equal(cookie[len(params):], cookieMAC(key, params, local, remote)) {
+		return InitCookie{}, false
+	}
+	p.ServiceCode = DecodeUint32(cookie[1:5])
+	p.CCIDA, p.CCIDB = cookie[5], cookie[6]
+	for b := params[cookieParamsLen:]; len(b) > 0; {
+		f, n := decodeCookieFeature(b)
+		if n == 0 {
+			return InitCookie{}, false
+		}
+		p.Features = append(p.Features, f)
+		b = b[n:]
+	}
+	return p, true
+}
+
+// encodeCookieFeature encodes f as the number of the feature, with the top bit set for a
+// remote feature, followed by its value as in a Confirm option
+func encodeCookieFeature(f CookieFeature) []byte {
+	d := encodeFeatureValues(f.Number, []uint64{f.Value})
+	if f.Location == FeatureRemote {
+		d[0] |= 0x80
+	}
+	return d
+}
+
+// decodeCookieFeature decodes the feature at the start of b. It returns the number of bytes
+// that the feature takes up, or zero if b does not start with a valid one.
+func decodeCookieFeature(b []byte) (f CookieFeature, n int) {
+	if len(b) < 2 {
+		return CookieFeature{}, 0
+	}
+	f.Number = b[0] &^ 0x80
+	if b[0]&0x80 != 0 {
+		f.Location = FeatureRemote
+	}
+	info, ok := featureInfos[f.Number]
+	if !ok {
+		return CookieFeature{}, 0
+	}
+	if info.sp {
+		f.Value = uint64(b[1])
+		return f, 2
+	}
+	if len(b) < 1+info.size {
+		return CookieFeature{}, 0
+	}
+	if f.Value, ok = decodeFeatureValue(info, b[1:1+info.size]); !ok {
+		return CookieFeature{}, 0
+	}
+	return f, 1 + info.size
+}
+
+func cookieMAC(key, params []byte, local, remote Bytes) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(params)
+	for _, addr := range []Bytes{local, remote} {
+		b := addr.Bytes()
+		mac.Write([]byte{byte(len(b))})
+		mac.Write(b)
+	}
+	return mac.Sum(nil)[:cookieMACLen]
+}
+
+// initCookieParams returns the InitCookie parameters of the connection. The features are
+// those whose negotiation is complete; a feature that the server is still changing is settled
+// by the Confirm of the client, rather than by the cookie.
+func (c *Conn) initCookieParams() InitCookie {
+	c.AssertLocked()
+	p := InitCookie{
+		ServiceCode: c.socket.GetServiceCode(),
+		CCIDA:       c.socket.GetCCIDA(),
+		CCIDB:       c.socket.GetCCIDB(),
+	}
+	for k, f := range c.features {
+		if f.state == featureStable {
+			p.Features = append(p.Features, CookieFeature{ Location: k.loc, Number: k.number, Value: f.value })
+		}
+	}
+	sort.Slice(p.Features, func(i, j int) bool {
+		if p.Features[i].Number != p.Features[j].Number {
+			return p.Features[i].Number < p.Features[j].Number
+		}
+		return p.Features[i].Location < p.Features[j].Location
+	})
+	return p
+}
+
+// findInitCookie returns the data of the Init Cookie option of h, or nil if there is none
+func findInitCookie(h *Header) []byte {
+	for _, o := range h.GetOptions() {
+		if o.Type == OptionInitCookie {
+			return o.Data
+		}
+	}
+	return nil
+}
+
+// placeInitCookie adds the Init Cookie received with the server's Response to h, if the
+// client is in PARTOPEN and h is an Ack or a DataAck, Section 8.1.5. The option is not
+// allowed on other packets, so a server that sends Init Cookies enters OPEN only on these.
+func (c *Conn) placeInitCookie(h *writeHeader) {
+	c.AssertLocked()
+	if c.initCookie == nil || c.socket.GetState() != PARTOPEN || (h.Type != Ack && h.Type != DataAck) {
+		return
+	}
+	h.Options = append(h.Options, Option{Type: OptionInitCookie, Data: c.initCookie})
+}
+
+// verifyInitCookie checks that h echoes an Init Cookie from jar, which was made for this
+// connection, and that the features pinned down by the cookie still hold. A feature that
+// h itself negotiates anew is exempt.
+func (c *Conn) verifyInitCookie(jar *CookieJar, h *Header) bool {
+	c.AssertLocked()
+	p, ok := jar.Open(findInitCookie(h), c.hc.LocalLabel(), c.hc.RemoteLabel())
+	if !ok || p.ServiceCode != c.socket.GetServiceCode() ||
+		p.CCIDA != c.socket.GetCCIDA() || p.CCIDB != c.socket.GetCCIDB() {
+		return false
+	}
+	for _, cf := range p.Features {
+		f, ok := c.features[featureKey{cf.Location, cf.Number}]
+		if !ok {
+			return false
+		}
+		if f.fgsr != h.SeqNo && f.value != cf.Value {
+			return false
+		}
+	}
+	return true
+}
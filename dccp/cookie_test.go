@@ -0,0 +1,80 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// manualTime is a Time that only advances when it is slept on
+type manualTime struct {
+	sync.Mutex
+	now int64
+}
+
+func (x *manualTime) Now() int64 {
+	x.Lock()
+	defer x.Unlock()
+	return x.now
+}
+
+func (x *manualTime) Sleep(ns int64) {
+	x.Lock()
+	defer x.Unlock()
+	x.now += ns
+}
+
+func TestCookieJar(t *testing.T) {
+	env := NewEnvTime(&manualTime{now: 1e9}, nil)
+	jar := NewCookieJar(env, 10e9)
+	local, remote := ChooseLabel(env), ChooseLabel(env)
+	p := InitCookie{ServiceCode: 0x12345678, CCIDA: CCID3, CCIDB: CCID3, Features: []CookieFeature{
+		{FeatureLocal, FeatureCCID, CCID3},
+		{FeatureRemote, FeatureCCID, CCID3},
+		{FeatureLocal, FeatureSequenceWindow, 1000},
+		{FeatureRemote, FeatureAckRatio, 2},
+	}}
+
+	cookie := jar.Make(p, local, remote)
+	if q, ok := jar.Open(cookie, local, remote); !ok || !reflect.DeepEqual(q, p) {
+		t.Fatalf("open %v, %v, expecting %v", q, ok, p)
+	}
+	if _, ok := jar.Open(cookie, remote, local); ok {
+		t.Errorf("cookie valid for swapped addresses")
+	}
+	for i := range cookie {
+		forged := append([]byte{}, cookie...)
+		forged[i] ^= 0x10
+		if _, ok := jar.Open(forged, local, remote); ok {
+			t.Errorf("cookie valid with byte %d altered", i)
+		}
+	}
+	if _, ok := jar.Open(cookie[:len(cookie)-1], local, remote); ok {
+		t.Errorf("truncated cookie valid")
+	}
+	if _, ok := NewCookieJar(env, 10e9).Open(cookie, local, remote); ok {
+		t.Errorf("cookie valid in another jar")
+	}
+
+	// A cookie survives one key rotation, but not two
+	env.Sleep(10e9)
+	if _, ok := jar.Open(cookie, local, remote); !ok {
+		t.Errorf("cookie invalid after one rotation")
+	}
+	fresh := jar.Make(p, local, remote)
+	env.Sleep(10e9)
+	if _, ok := jar.Open(cookie, local, remote); ok {
+		t.Errorf("cookie valid after two rotations")
+	}
+	if _, ok := jar.Open(fresh, local, remote); !ok {
+		t.Errorf("fresh cookie invalid after one rotation")
+	}
+	env.Sleep(100e9)
+	if _, ok := jar.Open(fresh, local, remote); ok {
+		t.Errorf("cookie valid after a long idle period")
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+// Section 9.2.1: The Minimum Checksum Coverage feature, located at the receiver, declares the
+// least partial checksum coverage that the receiver accepts. At its default of 0, only full
+// coverage is acceptable. GoDCCP let applications use partial coverage before it negotiated
+// the feature, so outside of strict RFC mode, partial coverage is still sent and accepted
+// while the feature is 0.
+
+// acceptsCsCov returns true if the value x of Minimum Checksum Coverage allows the checksum
+// coverage cscov. In strict RFC mode, a value of 0 allows only full coverage. The arguments
+// args are logged with the deviation, if one occurs.
+func (c *Conn) acceptsCsCov(x uint64, cscov byte, args ...interface{}) bool {
+	switch {
+	case cscov == 0:
+		return true
+	case x > 0:
+		return uint64(cscov) >= x
+	case c.env.StrictRFC():
+		return false
+	}
+	c.env.Deviate(c.amb, devMinCsCov, args...)
+	return true
+}
+
+// minCsCov returns the Minimum Checksum Coverage of the endpoint at loc
+func (c *Conn) minCsCov(loc FeatureLocation) uint64 {
+	return c.feature(featureKey{loc, FeatureMinCsCov}).value
+}
+
+// checkSendCsCov returns ErrCsCov if the peer does not accept the checksum coverage cscov
+func (c *Conn) checkSendCsCov(cscov byte) error {
+	c.Lock()
+	defer c.Unlock()
+	if !c.acceptsCsCov(c.minCsCov(FeatureRemote), cscov) {
+		return ErrCsCov
+	}
+	return nil
+}
+
+// placeCsCov sets the checksum coverage of h to that requested for its message. Should the
+// peer not accept it, since its Minimum Checksum Coverage changed after the message was
+// queued, the packet is covered in full.
+func (c *Conn) placeCsCov(h *writeHeader) {
+	c.AssertLocked()
+	h.CsCov = h.Meta.CsCov
+	if !c.acceptsCsCov(c.minCsCov(FeatureRemote), h.CsCov, &h.Header) {
+		c.amb.E(EventWarn, "Checksum coverage below peer minimum", h)
+		h.CsCov = 0
+	}
+}
+
+// readCsCov returns false if the checksum coverage of h is below the Minimum Checksum
+// Coverage of the Conn, in which case the data of h is dropped and reported to the peer
+// with Drop Code 0, "Protocol Constraints"
+func (c *Conn) readCsCov(h *Header) bool {
+	c.AssertLocked()
+	if c.acceptsCsCov(c.minCsCov(FeatureLocal), h.CsCov, h) {
+		return true
+	}
+	c.amb.E(EventDrop, "Checksum coverage below minimum", h)
+	c.markDataDropped(h, DropStateProtocol)
+	return false
+}
@@ -0,0 +1,102 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import "hash/crc32"
+
+// DataChecksumOption, Section 9.3
+// The option carries the CRC-32c of the application data of its packet, in network byte
+// order. It lets a receiver tell corrupt payloads from corrupt headers, when the packet
+// checksum covers only part of the payload. A receiver whose Check Data Checksum feature is
+// 1, Section 9.3.1, requires the option on every packet with application data.
+type DataChecksumOption struct {
+	Checksum uint32
+}
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// NewDataChecksumOption returns the Data Checksum option of the application data data
+func NewDataChecksumOption(data []byte) *DataChecksumOption {
+	return &DataChecksumOption{Checksum: crc32.Checksum(data, crc32c)}
+}
+
+func (opt *DataChecksumOption) Encode() (*Option, error) {
+	d := make([]byte, 4)
+	EncodeUint32(opt.Checksum, d)
+	return &Option{
+		Type:      OptionDataChecksum,
+		Data:      d,
+		Mandatory: false,
+	}, nil
+}
+
+func DecodeDataChecksumOption(opt *Option) *DataChecksumOption {
+	if opt.Type != OptionDataChecksum || len(opt.Data) != 4 {
+		return nil
+	}
+	return &DataChecksumOption{Checksum: DecodeUint32(opt.Data)}
+}
+
+// Verify returns true if the option matches the application data data
+func (opt *DataChecksumOption) Verify(data []byte) bool {
+	return opt.Checksum == crc32.Checksum(data, crc32c)
+}
+
+// placeDataChecksum adds a Data Checksum option to h, if h carries application data and the
+// Check Data Checksum feature of the peer is 1
+func (c *Conn) placeDataChecksum(h *writeHeader) {
+	c.AssertLocked()
+	if (h.Type != Data && h.Type != DataAck) || len(h.Data) == 0 {
+		return
+	}
+	if c.feature(featureKey{FeatureRemote, FeatureCheckDataChecksum}).value == 0 {
+		return
+	}
+	opt, _ := NewDataChecksumOption(h.Data).Encode()
+	h.Options = append(h.Options, *opt)
+}
+
+// readDataChecksum verifies the application data of h against its Data Checksum option. It
+// returns false if the data is not to be delivered. Corrupt data is dropped and reported with
+// Drop Code 3, "Corrupt", unless SetDeliverCorrupt asks for it to be delivered, in which case
+// it is reported with Drop Code 7, "Delivered Corrupt". If the Check Data Checksum feature is
+// 1, data without the option is dropped and reported with Drop Code 0, "Protocol Constraints".
+func (c *Conn) readDataChecksum(h *Header) (deliver, corrupt bool) {
+	c.AssertLocked()
+	if len(h.Data) == 0 {
+		return true, false
+	}
+	var opt *DataChecksumOption
+	opts := h.GetOptions()
+	for i := range opts {
+		if opts[i].Type == OptionDataChecksum {
+			opt = DecodeDataChecksumOption(&opts[i])
+			break
+		}
+	}
+	switch {
+	case opt == nil && c.feature(featureKey{FeatureLocal, FeatureCheckDataChecksum}).value != 0:
+		c.amb.E(EventDrop, "Missing Data Checksum", h)
+		c.markDataDropped(h, DropStateProtocol)
+		return false, false
+	case opt == nil || opt.Verify(h.Data):
+		return true, false
+	case c.deliverCorrupt:
+		c.amb.E(EventWarn, "Delivered corrupt data", h)
+		c.markDataDropped(h, DropStateDeliveredCorrupt)
+		return true, true
+	}
+	c.amb.E(EventDrop, "Corrupt data", h)
+	c.markDataDropped(h, DropStateCorrupt)
+	return false, false
+}
+
+// SetDeliverCorrupt sets whether application data that fails its Data Checksum is delivered,
+// with the Corrupt flag of its ReadMeta set, rather than dropped
+func (c *Conn) SetDeliverCorrupt(deliver bool) {
+	c.Lock()
+	defer c.Unlock()
+	c.deliverCorrupt = deliver
+}
@@ -0,0 +1,34 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import "testing"
+
+func TestDataChecksumOption(t *testing.T) {
+	// The CRC-32c check value, RFC 3720 Appendix B.4
+	data := []byte("123456789")
+	opt := NewDataChecksumOption(data)
+	if opt.Checksum != 0xe3069283 {
+		t.Fatalf("CRC-32c %08x, expected e3069283", opt.Checksum)
+	}
+	o, err := opt.Encode()
+	if err != nil {
+		t.Fatalf("encode (%s)", err)
+	}
+	if o.Type != OptionDataChecksum || len(o.Data) != 4 || o.Data[0] != 0xe3 {
+		t.Fatalf("option %v not in network byte order", o)
+	}
+	opt = DecodeDataChecksumOption(o)
+	if opt == nil || !opt.Verify(data) {
+		t.Fatalf("decoded option does not verify")
+	}
+	data[3] ^= 0x10
+	if opt.Verify(data) {
+		t.Errorf("corrupt data verifies")
+	}
+	if DecodeDataChecksumOption(&Option{ Type: OptionDataChecksum, Data: []byte{1, 2} }) != nil {
+		t.Errorf("short option decoded")
+	}
+}
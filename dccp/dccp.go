@@ -7,32 +7,70 @@ package dccp
 import "net"
 
 type Stack struct {
-	mux  *Mux
-	link Link
-	ccid CCID
+	env         *Env   // Shared by all connections, so that their timers share one timer wheel
+	mux         *Mux
+	link        Link
+	ccid        CCID
+	serviceCode uint32 // Service Code that accepted connections must request, or zero for any
 }
 
 // NewStack creates a new connection-handling object.
 func NewStack(link Link, ccid CCID) *Stack {
+	env := NewEnv(nil)
 	return &Stack{
-		mux:  NewMux(link),
+		env:  env,
+		mux:  NewMuxEnv(env, link),
 		link: link,
 		ccid: ccid,
 	}
 }
 
-// Dial initiates a new connection to the specified Link-layer address.
-func (s *Stack) Dial(addr net.Addr, serviceCode uint32) (c SegmentConn, err error) {
-	bc, err := s.mux.Dial(addr)
+// Listen binds a UDPLink to the IP and port of laddr, and creates a Stack on it that accepts
+// connections for the Service Code of laddr. Requests for other Service Codes are rejected
+// with Reset Code 8, "Bad Service Code". If the Service Code of laddr is zero, connections
+// for any Service Code are accepted. network is "dccp", "dccp4" or "dccp6".
+func Listen(network string, laddr *DCCPAddr, ccid CCID) (*Stack, error) {
+	switch network {
+	case "dccp", "dccp4", "dccp6":
+	default:
+		return nil, net.UnknownNetworkError(network)
+	}
+	link, err := BindUDPLink("udp"+network[len("dccp"):], laddr.UDPAddr())
+	if err != nil {
+		return nil, err
+	}
+	s := NewStack(link, ccid)
+	s.serviceCode = laddr.ServiceCode
+	return s, nil
+}
+
+// Addr returns the address that the Stack accepts connections on
+func (s *Stack) Addr() net.Addr {
+	var addr net.Addr
+	if la, ok := s.link.(interface{ LocalAddr() net.Addr }); ok {
+		addr = la.LocalAddr()
+	}
+	return newDCCPAddr(addr, s.serviceCode)
+}
+
+// SetTrafficClass marks the packets of all connections with the IP traffic class tos, see
+// Mux.SetTrafficClass. Individual connections can override it with Conn.SetTrafficClass.
+func (s *Stack) SetTrafficClass(tos byte) error {
+	return s.mux.SetTrafficClass(tos)
+}
+
+// Dial initiates a new connection to raddr, for the Service Code of raddr.
+func (s *Stack) Dial(raddr *DCCPAddr) (c SegmentConn, err error) {
+	bc, err := s.mux.Dial(raddr)
 	if err != nil {
 		return nil, err
 	}
 	hc := NewHeaderConn(bc)
-	env := NewEnv(nil)
-	c = NewConnClient(env, NoLogging, hc, 
-		s.ccid.NewSender(env, NoLogging),
-		s.ccid.NewReceiver(env, NoLogging), 
-		serviceCode)
+	amb := NewAmb("client", s.env)
+	c = NewConnClient(s.env, amb, hc, 
+		s.ccid.NewSender(s.env, amb),
+		s.ccid.NewReceiver(s.env, amb), 
+		raddr.ServiceCode)
 	return c, nil
 }
 
@@ -44,9 +82,15 @@ func (s *Stack) Accept() (c SegmentConn, err error) {
 		return nil, err
 	}
 	hc := NewHeaderConn(bc)
-	env := NewEnv(nil)
-	c = NewConnServer(env, NoLogging, hc, 
-		s.ccid.NewSender(env, NoLogging), 
-		s.ccid.NewReceiver(env, NoLogging))
+	amb := NewAmb("server", s.env)
+	c = newConnServer(s.env, amb, hc, 
+		s.ccid.NewSender(s.env, amb), 
+		s.ccid.NewReceiver(s.env, amb),
+		s.serviceCode)
 	return c, nil
 }
+
+// Close closes the Stack and the link it runs on
+func (s *Stack) Close() error {
+	return s.mux.Close()
+}
@@ -0,0 +1,154 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"testing"
+	"time"
+)
+
+// stackPair is a client and a server Stack connected over a ChanLink, and the connections
+// between them
+type stackPair struct {
+	t              *testing.T
+	client, server *Stack
+	accepted       chan *Conn
+	conns          []*Conn
+}
+
+func newStackPair(t *testing.T) *stackPair {
+	alink, dlink := NewChanPipe()
+	ccid := CCFixed{Every: 1e6}
+	p := &stackPair{
+		t:        t,
+		client:   NewStack(alink, ccid),
+		server:   NewStack(dlink, ccid),
+		accepted: make(chan *Conn, 1),
+	}
+	go func() {
+		for {
+			c, err := p.server.Accept()
+			if err != nil {
+				return
+			}
+			p.accepted <- c.(*Conn)
+		}
+	}()
+	return p
+}
+
+// connect opens a connection and returns its client and server end, once the server has read
+// a first packet
+func (p *stackPair) connect() (cc, sc *Conn) {
+	c, err := p.client.Dial(&DCCPAddr{})
+	if err != nil {
+		p.t.Fatalf("dial (%s)", err)
+	}
+	cc = c.(*Conn)
+	if err := cc.Write([]byte{1}); err != nil {
+		p.t.Fatalf("write (%s)", err)
+	}
+	sc = <-p.accepted
+	if _, err := sc.Read(); err != nil {
+		p.t.Fatalf("read (%s)", err)
+	}
+	p.conns = append(p.conns, cc, sc)
+	return cc, sc
+}
+
+// close aborts the connections and joins them, so that they do not outlive the test
+func (p *stackPair) close() {
+	join := NewGoJoin("end-of-test")
+	for _, c := range p.conns {
+		c.Abort()
+		join.Add(c.Joiner())
+	}
+	join.Join()
+	p.client.Close()
+	p.server.Close()
+}
+
+// stackWakes opens n connections between two Stacks, lets them idle for d, and returns the
+// wake-ups of the timer wheel of the client Stack in the meantime, and the number of ticks
+// that elapsed. The checks of the handshake timeouts, which fire once per connection, are over
+// before the connections start idling.
+func stackWakes(t *testing.T, n int, d time.Duration) (wakes, ticks int64) {
+	p := newStackPair(t)
+	defer p.close()
+	for i := 0; i < n; i++ {
+		p.connect()
+	}
+
+	time.Sleep(time.Duration(EXPIRE_INTERVAL) + 100*time.Millisecond)
+	w := &p.client.env.wheel
+	w.lk.Lock()
+	wakes0, t0 := w.wakes, p.client.env.Now()
+	w.lk.Unlock()
+	time.Sleep(d)
+	w.lk.Lock()
+	defer w.lk.Unlock()
+	return w.wakes - wakes0, (p.client.env.Now() - t0) / WheelTick
+}
+
+// TestStackWheel checks that the connections of a Stack share one timer wheel, so that its
+// wake-ups grow with the number of ticks at which timers fall due, not with the number of
+// connections
+func TestStackWheel(t *testing.T) {
+	const n = 50
+	one, _ := stackWakes(t, 1, 500*time.Millisecond)
+	many, ticks := stackWakes(t, n, 500*time.Millisecond)
+	if one == 0 {
+		t.Fatalf("idle connection did not wake up the timer wheel")
+	}
+	// Idle ticks fall due at multiples of the alignment of their slack, so at most one in align
+	// ticks is occupied
+	align := alignTicks(RoundtripDefault / IdleTickSlack)
+	if many > ticks/align+2*one {
+		t.Errorf("%d connections took %d wake-ups in %d ticks, one took %d", n, many, ticks, one)
+	}
+	t.Logf("1 connection: %d wake-ups; %d connections: %d wake-ups in %d ticks", one, n, many, ticks)
+}
+
+// TestStackSlowConn checks that a connection whose application does not read does not hold up
+// the other connections of the Mux, whose read loop processes the packets of all of them
+func TestStackSlowConn(t *testing.T) {
+	p := newStackPair(t)
+	defer p.close()
+	slowc, slows := p.connect()
+	fastc, fasts := p.connect()
+
+	// The packets of the slow connection fill its read queue, and those that follow are dropped
+	go func() {
+		for i := 0; i < 4*READ_QUEUE_MAX; i++ {
+			if slowc.Write([]byte{byte(i)}) != nil {
+				return
+			}
+		}
+	}()
+	for deadline := time.Now().Add(2 * time.Second); slows.readQueued() < READ_QUEUE_DEFAULT; {
+		if time.Now().After(deadline) {
+			t.Fatalf("read queue of the slow connection not filled")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < 20; i++ {
+		if err := fastc.Write([]byte{byte(i)}); err != nil {
+			t.Fatalf("write (%s)", err)
+		}
+		read := make(chan error, 1)
+		go func() {
+			_, err := fasts.Read()
+			read <- err
+		}()
+		select {
+		case err := <-read:
+			if err != nil {
+				t.Fatalf("read (%s)", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("connection held up by a connection that does not read, after %d packets", i)
+		}
+	}
+}
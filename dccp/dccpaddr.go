@@ -0,0 +1,98 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// DCCPAddr is the address of a DCCP endpoint: an IP address, a port and a Service Code,
+// Section 8.1.2. It implements net.Addr. Over a UDPLink the port is the UDP port of the
+// encapsulation, RFC 6773, while over an IPLink it is unused.
+type DCCPAddr struct {
+	IP          net.IP
+	Port        int
+	Zone        string // IPv6 scoped addressing zone
+	ServiceCode uint32
+}
+
+// Network implements net.Addr.Network
+func (a *DCCPAddr) Network() string { return "dccp" }
+
+// String implements net.Addr.String. The address is written as host:port, followed by a
+// slash and the text form of the Service Code, as written by ServiceCodeString, if the
+// Service Code is not zero.
+func (a *DCCPAddr) String() string {
+	if a == nil {
+		return "<nil>"
+	}
+	ip := ""
+	if len(a.IP) != 0 {
+		ip = a.IP.String()
+		if a.Zone != "" {
+			ip += "%" + a.Zone
+		}
+	}
+	s := net.JoinHostPort(ip, strconv.Itoa(a.Port))
+	if a.ServiceCode != 0 {
+		s += "/" + ServiceCodeString(a.ServiceCode)
+	}
+	return s
+}
+
+// ResolveDCCPAddr parses address, in the form written by DCCPAddr.String, and resolves its
+// host name. network is "dccp", "dccp4" or "dccp6".
+func ResolveDCCPAddr(network, address string) (*DCCPAddr, error) {
+	switch network {
+	case "dccp", "dccp4", "dccp6":
+	default:
+		return nil, net.UnknownNetworkError(network)
+	}
+	var sc uint32
+	if i := strings.Index(address, "/"); i >= 0 {
+		var err error
+		if sc, err = ParseServiceCode([]byte(address[i+1:])); err != nil {
+			return nil, err
+		}
+		address = address[:i]
+	}
+	u, err := net.ResolveUDPAddr("udp"+network[len("dccp"):], address)
+	if err != nil {
+		return nil, err
+	}
+	return &DCCPAddr{ IP: u.IP, Port: u.Port, Zone: u.Zone, ServiceCode: sc }, nil
+}
+
+// UDPAddr returns the UDP address of the encapsulation of DCCP at a
+func (a *DCCPAddr) UDPAddr() *net.UDPAddr {
+	return &net.UDPAddr{ IP: a.IP, Port: a.Port, Zone: a.Zone }
+}
+
+// IPAddr returns the IP address of a
+func (a *DCCPAddr) IPAddr() *net.IPAddr {
+	return &net.IPAddr{ IP: a.IP, Zone: a.Zone }
+}
+
+// newDCCPAddr returns the address of the DCCP endpoint at the Link-level address addr, with
+// Service Code sc. Link-level addresses other than UDP and IP addresses leave the IP unset.
+func newDCCPAddr(addr net.Addr, sc uint32) *DCCPAddr {
+	switch t := addr.(type) {
+	case *net.UDPAddr:
+		return &DCCPAddr{ IP: t.IP, Port: t.Port, Zone: t.Zone, ServiceCode: sc }
+	case *net.IPAddr:
+		return &DCCPAddr{ IP: t.IP, Zone: t.Zone, ServiceCode: sc }
+	}
+	return &DCCPAddr{ ServiceCode: sc }
+}
+
+// linkAddr returns the Link-level address of a on link
+func linkAddr(link Link, a *DCCPAddr) net.Addr {
+	if _, ok := link.(*IPLink); ok {
+		return a.IPAddr()
+	}
+	return a.UDPAddr()
+}
@@ -0,0 +1,117 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDCCPAddr(t *testing.T) {
+	a, err := ResolveDCCPAddr("dccp", "127.0.0.1:5004/SC:RTP")
+	if err != nil {
+		t.Fatalf("resolve (%s)", err)
+	}
+	sc, _ := ParseServiceCode([]byte("SC:RTP"))
+	if !a.IP.Equal(net.IPv4(127, 0, 0, 1)) || a.Port != 5004 || a.ServiceCode != sc {
+		t.Errorf("resolved %+v", a)
+	}
+	if s := a.String(); s != "127.0.0.1:5004/SC:RTP" {
+		t.Errorf("string %s", s)
+	}
+	if a, err = ResolveDCCPAddr("dccp6", "[::1]:7"); err != nil || a.ServiceCode != 0 || a.String() != "[::1]:7" {
+		t.Errorf("resolved %v (%v)", a, err)
+	}
+	if _, err = ResolveDCCPAddr("udp", "127.0.0.1:7"); err == nil {
+		t.Errorf("resolved an address of another network")
+	}
+}
+
+// TestStackServiceCode connects to a Stack listening on a Service Code over UDP, and checks
+// the addresses of the connection, and that a Request for another Service Code is rejected
+func TestStackServiceCode(t *testing.T) {
+	sc, _ := ParseServiceCode([]byte("SC:TEST"))
+	ccid := CCFixed{Every: 1e6}
+	server, err := Listen("dccp", &DCCPAddr{IP: net.IPv4(127, 0, 0, 1), ServiceCode: sc}, ccid)
+	if err != nil {
+		t.Fatalf("listen (%s)", err)
+	}
+	defer server.Close()
+	link, err := BindUDPLink("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("bind (%s)", err)
+	}
+	client := NewStack(link, ccid)
+	defer client.Close()
+
+	accepted := make(chan *Conn, 2)
+	go func() {
+		for {
+			c, err := server.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- c.(*Conn)
+		}
+	}()
+
+	raddr := server.Addr().(*DCCPAddr)
+	c, err := client.Dial(raddr)
+	if err != nil {
+		t.Fatalf("dial (%s)", err)
+	}
+	cc := c.(*Conn)
+	if err := cc.Write([]byte{1}); err != nil {
+		t.Fatalf("write (%s)", err)
+	}
+	sconn := <-accepted
+	if p, err := sconn.Read(); err != nil || len(p) != 1 {
+		t.Fatalf("read %v (%v)", p, err)
+	}
+	if s := cc.RemoteAddr().String(); s != raddr.String() {
+		t.Errorf("client remote address %s, expecting %s", s, raddr)
+	}
+	if s := sconn.LocalAddr().String(); s != raddr.String() {
+		t.Errorf("server local address %s, expecting %s", s, raddr)
+	}
+	if s, want := sconn.RemoteAddr().String(), newDCCPAddr(link.LocalAddr(), sc).String(); s != want {
+		t.Errorf("server remote address %s, expecting %s", s, want)
+	}
+
+	bad := *raddr
+	bad.ServiceCode = sc + 1
+	if c, err = client.Dial(&bad); err != nil {
+		t.Fatalf("dial (%s)", err)
+	}
+	read := make(chan error, 1)
+	go func() {
+		_, err := c.Read()
+		read <- err
+	}()
+	select {
+	case err := <-read:
+		if err == nil {
+			t.Errorf("connection for a bad Service Code was established")
+		}
+	case <-time.After(10 * time.Second):
+		t.Errorf("connection for a bad Service Code not reset")
+	}
+
+	// The connections are joined so that they do not outlive the test
+	conns := []*Conn{cc, sconn, c.(*Conn)}
+	select {
+	case rejected := <-accepted:
+		conns = append(conns, rejected)
+	case <-time.After(time.Second):
+		t.Errorf("connection for a bad Service Code not accepted")
+	}
+	join := NewGoJoin("end-of-test")
+	for _, conn := range conns {
+		conn.Abort()
+		join.Add(conn.Joiner())
+	}
+	join.Join()
+}
@@ -0,0 +1,142 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"path"
+	"strconv"
+)
+
+// DebugHandler serves HTML pages that show the live state of the connections of the process,
+// for operating DCCP services in production. It is optional: mount it with a trailing slash,
+// e.g.
+//
+//   http.Handle("/debug/dccp/", dccp.DebugHandler)
+//
+// The index page lists the active connections, the same ones that are published via expvar,
+// with their state, RTT, sending rate, loss event rate and queue depths. Each connection links
+// to a page of its own, which adds the negotiated features, the counters of ConnStats and
+// LatencyStats, the status of its congestion controls and its most recent events.
+var DebugHandler http.Handler = debugHandler{}
+
+// debugInfo is a snapshot of a connection, as shown by DebugHandler
+type debugInfo struct {
+	*ConnDump
+	ID       uint64
+	Role     string
+	Rate     string // Allowed sending rate, if the sender CCID reports it
+	Loss     string // Loss event rate estimated by the receiver CCID, if it reports it
+	Features Features
+	Events   []*Trace
+}
+
+// debugSnapshot takes a snapshot of c. The events are only included if events is true.
+func (c *Conn) debugSnapshot(events bool) *debugInfo {
+	d := &debugInfo{
+		ConnDump: c.Dump(),
+		ID:       c.id,
+		Features: c.Features(),
+	}
+	d.Role = ServerString(d.Server)
+	if x, ok := d.Sender[StatusRate]; ok {
+		d.Rate = fmt.Sprintf("%.0f B/s", x)
+	}
+	if p, ok := d.Receiver[StatusLoss]; ok {
+		d.Loss = fmt.Sprintf("%.3f%%", p)
+	}
+	if events {
+		d.Events = c.Events()
+	}
+	return d
+}
+
+func (debugHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if id, err := strconv.ParseUint(path.Base(req.URL.Path), 10, 64); err == nil {
+		c := liveLookup(id)
+		if c == nil {
+			http.NotFound(w, req)
+			return
+		}
+		debugConnPage.Execute(w, c.debugSnapshot(true))
+		return
+	}
+	var dd []*debugInfo
+	for _, c := range liveActive() {
+		dd = append(dd, c.debugSnapshot(false))
+	}
+	debugIndexPage.Execute(w, dd)
+}
+
+type debugHandler struct{}
+
+var debugFuncs = template.FuncMap{
+	"ms": func(ns int64) string { return fmt.Sprintf("%.3f ms", float64(ns)/1e6) },
+}
+
+var debugIndexPage = template.Must(template.New("index").Funcs(debugFuncs).Parse(`<html>
+<head><title>DCCP connections</title></head>
+<body>
+<h1>DCCP connections</h1>
+<table border="1" cellpadding="4">
+<tr><th>#</th><th>Conn</th><th>Role</th><th>State</th><th>RTT</th><th>Rate</th><th>Loss</th><th>Write queue</th><th>Read queue</th></tr>
+{{range .}}<tr><td><a href="{{.ID}}">{{.ID}}</a></td><td>{{.Label}}</td><td>{{.Role}}</td><td>{{.State}}</td><td>{{ms .RTT}}</td><td>{{.Rate}}</td><td>{{.Loss}}</td><td>{{.WriteQueue}}</td><td>{{.ReadQueue}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+var debugConnPage = template.Must(template.New("conn").Funcs(debugFuncs).Parse(`<html>
+<head><title>DCCP connection {{.ID}}</title></head>
+<body>
+<h1>DCCP connection {{.ID}}: {{.Label}}</h1>
+<p><a href=".">All connections</a></p>
+<table border="1" cellpadding="4">
+<tr><td>Role</td><td>{{.Role}}</td></tr>
+<tr><td>State</td><td>{{.State}}</td></tr>
+<tr><td>Error</td><td>{{.Err}}</td></tr>
+<tr><td>RTT</td><td>{{ms .RTT}}</td></tr>
+<tr><td>ISS / ISR / OSR</td><td>{{.ISS}} / {{.ISR}} / {{.OSR}}</td></tr>
+<tr><td>GSS / GSR / GAR</td><td>{{.GSS}} / {{.GSR}} / {{.GAR}}</td></tr>
+<tr><td>PMTU / CCMPS</td><td>{{.PMTU}} / {{.CCMPS}}</td></tr>
+<tr><td>Write queue</td><td>{{.WriteQueue}}</td></tr>
+<tr><td>Read queue</td><td>{{.ReadQueue}}</td></tr>
+<tr><td>Drop reports</td><td>{{.DropReports}}</td></tr>
+<tr><td>Data Dropped pending</td><td>{{.Pending}}</td></tr>
+</table>
+<h2>Features</h2>
+<table border="1" cellpadding="4">
+<tr><td>Service Code</td><td>{{.Features.ServiceCode}}</td></tr>
+<tr><td>CCID A/B</td><td>{{.Features.CCIDA}} / {{.Features.CCIDB}}</td></tr>
+<tr><td>Sequence Window A/B</td><td>{{.Features.SWAF}} / {{.Features.SWBF}}</td></tr>
+<tr><td>Allow Short Seqnos A/B</td><td>{{.Features.ShortSeqNosA}} / {{.Features.ShortSeqNosB}}</td></tr>
+<tr><td>MPS</td><td>{{.Features.MPS}}</td></tr>
+</table>
+<h2>Sender CCID</h2>
+<table border="1" cellpadding="4">
+{{range $name, $value := .Sender}}<tr><td>{{$name}}</td><td>{{$value}}</td></tr>
+{{end}}</table>
+<h2>Receiver CCID</h2>
+<table border="1" cellpadding="4">
+{{range $name, $value := .Receiver}}<tr><td>{{$name}}</td><td>{{$value}}</td></tr>
+{{end}}</table>
+<h2>Latency</h2>
+<table border="1" cellpadding="4">
+<tr><th>Stage</th><th>Count</th><th>Mean</th><th>Max</th></tr>
+<tr><td>Queue</td><td>{{.Latency.Queue.Count}}</td><td>{{ms .Latency.Queue.Mean}}</td><td>{{ms .Latency.Queue.Max}}</td></tr>
+<tr><td>Gate</td><td>{{.Latency.Gate.Count}}</td><td>{{ms .Latency.Gate.Mean}}</td><td>{{ms .Latency.Gate.Max}}</td></tr>
+<tr><td>Flight</td><td>{{.Latency.Flight.Count}}</td><td>{{ms .Latency.Flight.Mean}}</td><td>{{ms .Latency.Flight.Max}}</td></tr>
+</table>
+<h2>Stats</h2>
+<pre>{{printf "%+v" .Stats}}</pre>
+<h2>Recent events</h2>
+<pre>{{range .Events}}{{.Time}} {{.LabelString}} {{.Event}} {{.State}} {{.Type}} {{.Comment}}
+{{end}}</pre>
+</body>
+</html>
+`))
@@ -0,0 +1,176 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"fmt"
+	"sort"
+)
+
+// DropReportQueueLen is the number of drop reports that a Conn holds for the application.
+// Further reports are discarded until the application receives some.
+const DropReportQueueLen = 16
+
+// DropReason tells why application data was dropped
+type DropReason int
+
+const (
+	// DropExpired is reported for a message that was still waiting to be sent at its
+	// deadline, see WriteMeta.Deadline
+	DropExpired DropReason = iota
+
+	// DropOverflow is reported for a queued message that the queue policy dropped to make
+	// room for a newer one, see QueuePolicy
+	DropOverflow
+
+	// DropRemote is reported for a message that the peer received but did not deliver to its
+	// application, as reported by the peer in a Data Dropped option, Section 11.7
+	DropRemote
+
+	// DropTooLarge is reported for a message whose packet, with the options placed on it
+	// when it was sent, would have exceeded the maximum packet size, see GetMTU
+	DropTooLarge
+)
+
+// String returns the name of the drop reason
+func (r DropReason) String() string {
+	switch r {
+	case DropExpired:
+		return "Expired"
+	case DropOverflow:
+		return "Overflow"
+	case DropRemote:
+		return "Remote"
+	case DropTooLarge:
+		return "TooLarge"
+	}
+	return "Unknown"
+}
+
+// DropReport describes a message of the application that was dropped
+type DropReport struct {
+	Reason DropReason
+	Time   int64     // Env time of the drop, in nanoseconds
+	Data   []byte    // The message, as passed to Write or WriteMsg
+	Meta   WriteMeta // Metadata of the message
+	State  byte      // For DropRemote, the Drop State reported by the peer, Section 11.7.2
+}
+
+const (
+	// SentHistoryLen is the number of most recently sent messages that a Conn remembers, in
+	// order to report the ones that the peer drops. Drops of older messages are not reported.
+	SentHistoryLen = 64
+
+	// dataDroppedPendingLen is the number of received packets dropped by a Conn that it
+	// remembers until it reports them to the peer in a Data Dropped option
+	dataDroppedPendingLen = 32
+)
+
+// sentMsg is a message remembered by a Conn in case the peer drops it
+type sentMsg struct {
+	SeqNo int64
+	Data  []byte
+	Meta  WriteMeta
+	Time  int64 // Time when the message was sent, until its first Ack arrives
+}
+
+// Drops returns the channel on which the Conn reports messages that it dropped instead of
+// sending, so that the application can adapt. Reporting does not block the Conn: if the
+// application does not receive the reports, they are discarded once DropReportQueueLen are
+// pending. The channel is never closed.
+func (c *Conn) Drops() <-chan DropReport {
+	return c.drops
+}
+
+// reportDrop logs the drop of a message and reports it to the application
+func (c *Conn) reportDrop(reason DropReason, data []byte, meta WriteMeta, args ...interface{}) {
+	c.sendDropReport(DropReport{ Reason: reason, Data: data, Meta: meta }, args...)
+}
+
+// sendDropReport logs the dropped message of r and passes r to the application, filling in
+// the time of the drop
+func (c *Conn) sendDropReport(r DropReport, args ...interface{}) {
+	c.amb.E(EventDrop, r.Reason.String() + " message", args...)
+	r.Time = c.env.Now()
+	select {
+	case c.drops <- r:
+	default:
+	}
+}
+
+// recordSent remembers the message carried by h, which has just been assigned its sequence
+// number, in case the peer reports it dropped
+func (c *Conn) recordSent(h *writeHeader) {
+	c.AssertLocked()
+	if h.Type != Data && h.Type != DataAck {
+		return
+	}
+	c.sent[h.SeqNo%SentHistoryLen] = sentMsg{ SeqNo: h.SeqNo, Data: h.Data, Meta: h.Meta, Time: c.env.Now() }
+}
+
+// markDataDropped remembers that the data of the received packet h was not delivered to
+// the application, so that the drop is reported to the peer
+func (c *Conn) markDataDropped(h *Header, state byte) {
+	c.AssertLocked()
+	if len(c.dataDropped) == dataDroppedPendingLen {
+		c.dataDropped = c.dataDropped[1:]
+	}
+	c.dataDropped = append(c.dataDropped, DataDrop{ SeqNo: h.SeqNo, State: state })
+}
+
+// placeDataDropped adds a Data Dropped option to the Ack h, reporting the received packets
+// dropped since the last such option. Each drop is reported once, so a drop goes unreported
+// if the Ack carrying it is lost.
+func (c *Conn) placeDataDropped(h *writeHeader) {
+	c.AssertLocked()
+	if h.Type != Ack || len(c.dataDropped) == 0 {
+		return
+	}
+	drops := make([]DataDrop, 0, len(c.dataDropped))
+	for _, d := range c.dataDropped {
+		if d.SeqNo <= h.AckNo {
+			drops = append(drops, d)
+		}
+	}
+	sort.Sort(dataDropsByDecreasingSeqNo(drops))
+	c.dataDropped = c.dataDropped[:0]
+	opt, err := (&DataDroppedOption{ Drops: drops }).Encode(h.AckNo)
+	if err != nil {
+		c.amb.E(EventWarn, fmt.Sprintf("Data Dropped option not placed (%s)", err), h)
+		return
+	}
+	h.Options = append(h.Options, *opt)
+}
+
+// readDataDropped reports the sent messages that the peer reports dropped in the Data
+// Dropped options of h
+func (c *Conn) readDataDropped(h *Header) {
+	c.AssertLocked()
+	if !h.HasAckNo() {
+		return
+	}
+	opts := h.GetOptions()
+	for i := range opts {
+		opt := DecodeDataDroppedOption(&opts[i], h.AckNo)
+		if opt == nil {
+			continue
+		}
+		for _, d := range opt.Drops {
+			m := &c.sent[d.SeqNo%SentHistoryLen]
+			if d.SeqNo <= 0 || m.SeqNo != d.SeqNo {
+				continue
+			}
+			c.sendDropReport(DropReport{ Reason: DropRemote, Data: m.Data, Meta: m.Meta, State: d.State }, h)
+			*m = sentMsg{}
+		}
+	}
+}
+
+// dataDropsByDecreasingSeqNo sorts drops in the order of the Data Dropped option
+type dataDropsByDecreasingSeqNo []DataDrop
+
+func (s dataDropsByDecreasingSeqNo) Len() int           { return len(s) }
+func (s dataDropsByDecreasingSeqNo) Less(i, j int) bool { return s[i].SeqNo > s[j].SeqNo }
+func (s dataDropsByDecreasingSeqNo) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,88 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+// Drop States of the Data Dropped option, Section 11.7.2
+const (
+	DropStateProtocol         = 0 // Protocol Constraints
+	DropStateNotListening     = 1 // Application Not Listening
+	DropStateReceiveBuffer    = 2 // Receive Buffer
+	DropStateCorrupt          = 3 // Corrupt
+	DropStateDeliveredCorrupt = 7 // Delivered Corrupt
+)
+
+// DataDroppedOption, Section 11.7
+// The option reports received packets whose data was not delivered to the application. Its
+// Blocks count back from the Acknowledgement Number of the packet carrying the option: a
+// Normal Block covers up to 127 packets that were not dropped, and a Drop Block covers up to
+// 16 packets that were dropped with the same Drop State.
+type DataDroppedOption struct {
+	Drops []DataDrop // Dropped packets, in decreasing order of sequence number
+}
+
+// DataDrop is a packet reported in a Data Dropped option
+type DataDrop struct {
+	SeqNo int64
+	State byte // Drop State, Section 11.7.2
+}
+
+const (
+	dataDroppedMaxNormal = 127 // Maximum Run Length of a Normal Block
+	dataDroppedMaxDrop   = 16  // Maximum number of packets in a Drop Block
+)
+
+// Encode encodes the option for a packet with Acknowledgement Number ackNo. The sequence
+// numbers of the drops must not exceed ackNo.
+func (opt *DataDroppedOption) Encode(ackNo int64) (*Option, error) {
+	var d []byte
+	next := ackNo // Sequence number of the packet described by the next Block
+	for i := 0; i < len(opt.Drops); {
+		drop := opt.Drops[i]
+		if drop.SeqNo > next || drop.State > 7 {
+			return nil, ErrOption
+		}
+		for gap := next - drop.SeqNo; gap > 0; gap -= dataDroppedMaxNormal {
+			d = append(d, byte(min64(gap, dataDroppedMaxNormal)))
+		}
+		// Extend the run over consecutive drops with the same Drop State
+		n := 1
+		for i+n < len(opt.Drops) && n < dataDroppedMaxDrop &&
+			opt.Drops[i+n].SeqNo == drop.SeqNo-int64(n) && opt.Drops[i+n].State == drop.State {
+			n++
+		}
+		d = append(d, 0x80|drop.State<<4|byte(n-1))
+		next = drop.SeqNo - int64(n)
+		i += n
+	}
+	if len(d) == 0 || len(d) > 253 {
+		return nil, ErrSize
+	}
+	return &Option{
+		Type:      OptionDataDropped,
+		Data:      d,
+		Mandatory: false,
+	}, nil
+}
+
+// DecodeDataDroppedOption decodes opt, received on a packet with Acknowledgement Number ackNo
+func DecodeDataDroppedOption(opt *Option, ackNo int64) *DataDroppedOption {
+	if opt.Type != OptionDataDropped || len(opt.Data) == 0 {
+		return nil
+	}
+	r := &DataDroppedOption{}
+	next := ackNo
+	for _, b := range opt.Data {
+		if b&0x80 == 0 {
+			next -= int64(b)
+			continue
+		}
+		state := (b >> 4) & 0x7
+		for n := int(b&0xf) + 1; n > 0; n-- {
+			r.Drops = append(r.Drops, DataDrop{ SeqNo: next, State: state })
+			next--
+		}
+	}
+	return r
+}
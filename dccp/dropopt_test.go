@@ -0,0 +1,37 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestDataDroppedOption(t *testing.T) {
+	const ackNo = 1000
+	var drops []DataDrop
+	// A run longer than a Drop Block, a change of Drop State, and a gap longer than a Normal Block
+	for s := int64(998); s > 978; s-- {
+		drops = append(drops, DataDrop{SeqNo: s, State: DropStateReceiveBuffer})
+	}
+	drops = append(drops, DataDrop{SeqNo: 978, State: DropStateCorrupt})
+	drops = append(drops, DataDrop{SeqNo: 700, State: DropStateReceiveBuffer})
+	opt, err := (&DataDroppedOption{Drops: drops}).Encode(ackNo)
+	if err != nil {
+		t.Fatalf("encode (%s)", err)
+	}
+	want := []byte{2, 0x80 | 2<<4 | 15, 0x80 | 2<<4 | 3, 0x80 | 3<<4, 127, 127, 23, 0x80 | 2<<4}
+	if !bytes.Equal(opt.Data, want) {
+		t.Errorf("encoded % x, expecting % x", opt.Data, want)
+	}
+	dec := DecodeDataDroppedOption(opt, ackNo)
+	if dec == nil || !reflect.DeepEqual(dec.Drops, drops) {
+		t.Errorf("decoded %v, expecting %v", dec, drops)
+	}
+	if _, err := (&DataDroppedOption{Drops: []DataDrop{{SeqNo: ackNo + 1}}}).Encode(ackNo); err == nil {
+		t.Errorf("encoded a drop beyond the acknowledgement number")
+	}
+}
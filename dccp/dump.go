@@ -0,0 +1,124 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// ConnDump is a snapshot of the internals of a Conn: its socket variables, the status of its
+// congestion controls and the lengths of its queues. It is shown by DebugHandler, and printed
+// in panics of the Conn and in the failure messages of tests.
+type ConnDump struct {
+	Label       string // First label of the Amb of the connection
+	State       string
+	Server      bool
+	ServiceCode uint32
+
+	ISS, ISR, OSR int64 // Initial Sequence numbers Sent and Received, first OPEN Sequence number Received
+	GSS, GSR, GAR int64 // Greatest Sequence numbers Sent and Received, greatest Acknowledgement number Received
+	SWAF, SWBF    int64 // Sequence Windows
+	CCIDA, CCIDB  byte
+	PMTU, CCMPS   int32
+	RTT           int64
+
+	Sender   map[string]float64 // Status of the sender CCID, if it is a StatusReporter
+	Receiver map[string]float64 // Status of the receiver CCID, if it is a StatusReporter
+
+	WriteQueue  int // Application data blocks waiting to be sent
+	ReadQueue   int // Received messages waiting for ReadMsg
+	DropReports int // Drop reports waiting for the application
+	Pending     int // Received packets dropped, waiting to be reported in a Data Dropped option
+
+	Stats   ConnStats
+	Latency LatencyStats
+	Err     error // Reason for connection tear down, or nil
+}
+
+// Dump returns a snapshot of the internals of the connection
+func (c *Conn) Dump() *ConnDump {
+	c.Lock()
+	defer c.Unlock()
+	return c.dump()
+}
+
+// dump is like Dump, but it is called with the Conn Mutex held
+func (c *Conn) dump() *ConnDump {
+	c.AssertLocked()
+	s := &c.socket
+	d := &ConnDump{
+		State:       StateString(s.State),
+		Server:      s.Server,
+		ServiceCode: s.ServiceCode,
+		ISS:         s.ISS,
+		ISR:         s.ISR,
+		OSR:         s.OSR,
+		GSS:         s.GSS,
+		GSR:         s.GSR,
+		GAR:         s.GAR,
+		SWAF:        s.SWAF,
+		SWBF:        s.SWBF,
+		CCIDA:       s.CCIDA,
+		CCIDB:       s.CCIDB,
+		PMTU:        s.PMTU,
+		CCMPS:       s.CCMPS,
+		RTT:         s.RTT,
+		Sender:      ccStatus(c.scc()),
+		Receiver:    ccStatus(c.rcc()),
+		WriteQueue:  c.writeQueue.dataQueued(),
+		ReadQueue:   c.readQueued(),
+		DropReports: len(c.drops),
+		Pending:     len(c.dataDropped),
+		Stats:       c.stats,
+		Latency:     c.latency,
+		Err:         c.err,
+	}
+	if l := c.amb.Labels(); len(l) > 0 {
+		d.Label = l[0]
+	}
+	return d
+}
+
+// ccStatus returns the status of the congestion control cc, or nil if it is not a StatusReporter
+func ccStatus(cc interface{}) map[string]float64 {
+	if r, ok := cc.(StatusReporter); ok {
+		return r.Status()
+	}
+	return nil
+}
+
+// String prints the dump on several lines
+func (d *ConnDump) String() string {
+	var w bytes.Buffer
+	fmt.Fprintf(&w, "%s: %s:%s %s, Err=%v\n", d.Label, d.State, ServerString(d.Server), ServiceCodeString(d.ServiceCode), d.Err)
+	fmt.Fprintf(&w, "  ISS=%d, ISR=%d, OSR=%d, GSS=%d, GSR=%d, GAR=%d, SWAF=%d, SWBF=%d\n",
+		d.ISS, d.ISR, d.OSR, d.GSS, d.GSR, d.GAR, d.SWAF, d.SWBF)
+	fmt.Fprintf(&w, "  CCIDA=%d, CCIDB=%d, PMTU=%d, CCMPS=%d, RTT=%d\n", d.CCIDA, d.CCIDB, d.PMTU, d.CCMPS, d.RTT)
+	fmt.Fprintf(&w, "  Sender: %s\n", statusString(d.Sender))
+	fmt.Fprintf(&w, "  Receiver: %s\n", statusString(d.Receiver))
+	fmt.Fprintf(&w, "  WriteQueue=%d, ReadQueue=%d, DropReports=%d, Pending=%d\n", d.WriteQueue, d.ReadQueue, d.DropReports, d.Pending)
+	fmt.Fprintf(&w, "  %+v\n", d.Stats)
+	fmt.Fprintf(&w, "  Queue=%+v, Gate=%+v, Flight=%+v", d.Latency.Queue, d.Latency.Gate, d.Latency.Flight)
+	return string(w.Bytes())
+}
+
+// statusString prints the status of a congestion control, ordered by name
+func statusString(status map[string]float64) string {
+	var names []string
+	for name := range status {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var w bytes.Buffer
+	for i, name := range names {
+		if i > 0 {
+			w.WriteString(", ")
+		}
+		fmt.Fprintf(&w, "%s=%g", name, status[name])
+	}
+	return string(w.Bytes())
+}
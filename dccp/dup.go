@@ -0,0 +1,31 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+// Every DCCP packet, including Acks, consumes a sequence number, Section 7.1, so a packet that
+// arrives with the sequence number of one received before is a copy made by the network. A
+// copy that passes the sequence number checks of step 6 would count twice towards the receive
+// rate and the loss intervals of the congestion controls, and would be delivered twice to the
+// application, so the Conn drops it before step 7. GSR is not affected either way, since it
+// only ever moves forward.
+
+// RecvHistoryLen is the number of most recently received sequence numbers that a Conn
+// remembers, in order to recognize duplicates. A duplicate of an older packet is not recognized.
+const RecvHistoryLen = 64
+
+// dropDuplicate returns true, and counts the packet in ConnStats.Duplicates, if h has the
+// sequence number of a recently received packet
+func (c *Conn) dropDuplicate(h *Header) bool {
+	c.AssertLocked()
+	// Slots hold the sequence number plus one, so that a zero slot is never a match
+	slot := &c.recvSeen[h.SeqNo%RecvHistoryLen]
+	if *slot == h.SeqNo+1 {
+		c.stats.Duplicates++
+		c.amb.E(EventDrop, "Duplicate", h)
+		return true
+	}
+	*slot = h.SeqNo + 1
+	return false
+}
@@ -0,0 +1,71 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+// Section 12: ECN is used on a half-connection unless its receiver is ECN Incapable,
+// Section 12.1. The local ECN Incapable feature stops the Conn from reading the ECN
+// codepoints that the link reports, and the remote one stops it from marking its packets
+// ECN-capable. A Conn marks its packets only after SetECN, since it needs a link that can set
+// the traffic class, and a CCID that responds to Congestion Experienced marks.
+
+// SetECN sets whether the packets of the connection are marked ECN-capable, with the ECT(0)
+// codepoint in their traffic class, for as long as the peer is not ECN Incapable. It returns
+// ErrUnsupported unless the underlying HeaderConn implements TrafficClassConn.
+func (c *Conn) SetECN(on bool) error {
+	if _, ok := c.hc.(TrafficClassConn); !ok {
+		return ErrUnsupported
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.ecn = on
+	return nil
+}
+
+// ecnSend returns true if the packets of the Conn are marked ECN-capable
+func (c *Conn) ecnSend() bool {
+	c.AssertLocked()
+	return c.ecn && c.feature(featureKey{FeatureRemote, FeatureECNIncapable}).value == 0
+}
+
+// trafficClass returns the traffic class of the packets of the Conn: The one set by
+// SetTrafficClass, with the ECN codepoint in its lower two bits
+func (c *Conn) trafficClass() byte {
+	c.AssertLocked()
+	tos := c.tclass &^ 3
+	if c.ecnSend() {
+		tos |= ECNECT0
+	}
+	return tos
+}
+
+// placeTrafficClass returns the traffic class that the next packet is to be marked with, and
+// false if the underlying HeaderConn is marking with it already
+func (c *Conn) placeTrafficClass() (tos byte, change bool) {
+	c.AssertLocked()
+	tos = c.trafficClass()
+	if tos == c.tclassMarked {
+		return tos, false
+	}
+	c.tclassMarked = tos
+	return tos, true
+}
+
+// markTrafficClass marks the packets written subsequently with traffic class tos
+func (c *Conn) markTrafficClass(tos byte) error {
+	tc, ok := c.hc.(TrafficClassConn)
+	if !ok {
+		return ErrUnsupported
+	}
+	return tc.SetTrafficClass(tos)
+}
+
+// readECN clears the ECN codepoint of h if the Conn is ECN Incapable, so that neither the
+// CCIDs nor the application see it
+func (c *Conn) readECN(h *Header) {
+	c.AssertLocked()
+	if h.ECN != ECNNotECT && c.feature(featureKey{FeatureLocal, FeatureECNIncapable}).value != 0 {
+		h.ECN = ECNNotECT
+	}
+}
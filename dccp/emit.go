@@ -23,7 +23,15 @@ func (c *Conn) emitCatchSeqNo(h *Header, seqNos ...int64) {
 	}
 }
 
+// emitSetState publishes the state of the socket. A change of state is logged with a
+// StateChange argument.
 func (c *Conn) emitSetState() {
 	c.AssertLocked()
-	c.amb.SetState(c.socket.GetState())
+	state := c.socket.GetState()
+	from, to := c.amb.GetState(), StateString(state)
+	c.amb.SetState(state)
+	c.expSetState(state)
+	if from != to {
+		c.amb.E(EventInfo, "State", StateChange{From: from, To: to})
+	}
 }
@@ -5,36 +5,105 @@
 package dccp
 
 import (
+	"bytes"
+	"fmt"
+	"math/rand"
 	"sync"
-	"time"
 	"github.com/petar/GoGauge/filter"
 )
 
 // Env encapsulates the runtime environment of a DCCP endpoint.  It includes a pluggable
 // time interface, in order to allow for use of real as well as synthetic (accelerated) time
-// (for testing purposes), as well as a amb interface.
+// (for testing purposes), as well as a amb interface. The DCCP logic reads the time through
+// the Clock of the Env, which never runs backwards.
 type Env struct {
+	clock   monoClock // First, since it is accessed atomically
+	time    Time
 	guzzle  TraceWriter
 	filter  *filter.Filter
 	gojoin  *GoJoin
+	grace   int64 // Time allowed for goroutines to exit on Close; zero disables leak detection
+	cookies *CookieJar // Init Cookies of server connections; see SetCookieJar
+	isn     isnChooser // Chooses the Initial Sequence Numbers of connections
+	rfc     conformance // Strict RFC mode and deviation counts; see SetStrictRFC
+	wheel   timerWheel // Fires the timers scheduled with AfterFunc
+	expect  *Expectations // Checked on Close; see Expect
 
 	sync.Mutex
 	timeZero int64 // Time when execution started
 	timeLast int64 // Time of last log message
+
+	traceFilterLk sync.Mutex    // Locks traceFilters and traceLimits
+	traceFilters  []traceFilter // Filters applied to all emits; see SetTraceFilter
+	traceLimits   map[Event]*traceLimit // Sampling and rate limits; see SetTraceSampling
+	traceFiltered int32         // Non-zero while filters or limits are set, accessed atomically
+
+	randLk   sync.Mutex // Locks the fields below; rand.Rand is not safe for concurrent use
+	seed     int64      // Seed of the pseudo-random number generator
+	rand     *rand.Rand // All randomness in the DCCP logic is drawn from this source
 }
 
+// NewEnv creates a new Env which runs in real time
 func NewEnv(guzzle TraceWriter) *Env {
-	now := time.Now().UnixNano()
+	return NewEnvTime(RealTime, guzzle)
+}
+
+// NewEnvTime creates a new Env whose notion of time is given by t
+func NewEnvTime(t Time, guzzle TraceWriter) *Env {
 	r := &Env{
+		time:     t,
 		guzzle:   guzzle,
 		filter:   filter.NewFilter(),
 		gojoin:   NewGoJoin("Env"),
-		timeZero: now,
-		timeLast: now,
 	}
+	r.clock.Init(t)
+	now := r.clock.Now()
+	r.timeZero, r.timeLast = now, now
+	r.wheel.env = r
+	r.clock.sleeper.env = r
+	r.seedRand(now)
 	return r
 }
 
+// SetSeed re-seeds the pseudo-random number generator of the Env. Two runs that use the
+// same seed draw identical sequences of random numbers, which makes it possible to reproduce
+// a failing sandbox run exactly. To this end, an Env that has been seeded explicitly also
+// draws its ISNs from the generator, rather than from a cryptographic source.
+func (t *Env) SetSeed(seed int64) {
+	t.seedRand(seed)
+	t.isn.Lock()
+	defer t.isn.Unlock()
+	t.isn.seeded = true
+}
+
+func (t *Env) seedRand(seed int64) {
+	t.randLk.Lock()
+	defer t.randLk.Unlock()
+	t.seed = seed
+	t.rand = rand.New(rand.NewSource(seed))
+}
+
+// Seed returns the seed that the pseudo-random number generator was last seeded with
+func (t *Env) Seed() int64 {
+	t.randLk.Lock()
+	defer t.randLk.Unlock()
+	return t.seed
+}
+
+// Int63n returns a pseudo-random number in [0,n), drawn from the Env's generator
+func (t *Env) Int63n(n int64) int64 {
+	t.randLk.Lock()
+	defer t.randLk.Unlock()
+	return t.rand.Int63n(n)
+}
+
+// Float64 returns a pseudo-random number in [0,1), drawn from the Env's generator
+func (t *Env) Float64() float64 {
+	t.randLk.Lock()
+	defer t.randLk.Unlock()
+	return t.rand.Float64()
+}
+
 // Go runs f in a new GoRoutine. The GoRoutine is also added to the GoJoin of the Env.
 func (t *Env) Go(f func(), fmt_ string, args_ ...interface{}) {
 	t.gojoin.Go(f, fmt_, args_...)
@@ -60,16 +129,117 @@ func (t *Env) Sync() error {
 	return t.guzzle.Sync()
 }
 
+// SetLeakGrace enables goroutine leak detection. On Close, all goroutines started with Go
+// are given grace nanoseconds to exit, after which the remaining ones are reported as leaked.
+// A grace of zero disables leak detection.
+func (t *Env) SetLeakGrace(grace int64) {
+	t.Lock()
+	defer t.Unlock()
+	t.grace = grace
+}
+
+// SetCookieJar makes the server connections of the Env send an Init Cookie from jar with
+// their Responses, and enter OPEN only when the client echoes a valid one. A nil jar,
+// which is the default, disables Init Cookies.
+func (t *Env) SetCookieJar(jar *CookieJar) {
+	t.Lock()
+	defer t.Unlock()
+	t.cookies = jar
+}
+
+// CookieJar returns the CookieJar set with SetCookieJar
+func (t *Env) CookieJar() *CookieJar {
+	t.Lock()
+	defer t.Unlock()
+	return t.cookies
+}
+
+// Close closes the TraceWriter of the Env. If leak detection is enabled, Close first waits
+// for all goroutines of the Env to exit and returns a *LeakError if some of them do not.
+// Otherwise, if expectations were declared with Expect, Close returns an *ExpectError if they
+// were not met.
 func (t *Env) Close() error {
-	return t.guzzle.Close()
+	leakErr := t.checkLeaks()
+	if t.guzzle != nil {
+		if err := t.guzzle.Close(); err != nil {
+			return err
+		}
+	}
+	if leakErr != nil {
+		return leakErr
+	}
+	if x := t.expectations(); x != nil {
+		return x.check()
+	}
+	return nil
+}
+
+func (t *Env) checkLeaks() *LeakError {
+	t.Lock()
+	grace := t.grace
+	t.Unlock()
+	if grace <= 0 {
+		return nil
+	}
+	deadline := t.Now() + grace
+	for {
+		pending := t.gojoin.Pending()
+		if len(pending) == 0 {
+			return nil
+		}
+		if t.Now() >= deadline {
+			return &LeakError{Pending: pending}
+		}
+		t.Sleep(min64(grace/10, 10e6))
+	}
+}
+
+// LeakError reports goroutines that did not exit by the time their Env was closed
+type LeakError struct {
+	Pending []Joiner
+}
+
+func (e *LeakError) Error() string {
+	var w bytes.Buffer
+	fmt.Fprintf(&w, "%d goroutine(s) leaked", len(e.Pending))
+	for _, u := range e.Pending {
+		fmt.Fprintf(&w, "\n%s", u.String())
+		if g, ok := u.(*GoRoutine); ok {
+			fmt.Fprintf(&w, "\n%s", g.Stack())
+		}
+	}
+	return w.String()
+}
+
+// Time returns the time framework of this Env
+func (t *Env) Time() Time {
+	return t.time
+}
+
+// Clock returns the monotone clock of this Env, which reads its Time
+func (t *Env) Clock() Clock {
+	return &t.clock
 }
 
+// ClockSteps returns the number of times the Time of this Env was found to have gone back.
+// The Clock holds still meanwhile, rather than following it.
+func (t *Env) ClockSteps() int64 {
+	return t.clock.Steps()
+}
+
+// Now returns the time of the Clock. Consecutive calls never return decreasing times.
 func (t *Env) Now() int64 {
-	return time.Now().UnixNano()
+	return t.clock.Now()
 }
 
 func (t *Env) Sleep(ns int64) {
-	time.Sleep(time.Duration(ns))
+	t.clock.Sleep(ns)
+}
+
+// SleepUntil blocks until time deadline. If the Time of the Env is a PreciseTime, it wakes up
+// at deadline more precisely than Sleep would.
+func (t *Env) SleepUntil(deadline int64) {
+	t.clock.SleepUntil(deadline)
 }
 
 func (t *Env) Snap() (sinceZero int64, sinceLast int64) {
@@ -84,19 +254,24 @@ func (t *Env) Snap() (sinceZero int64, sinceLast int64) {
 
 // Expire periodically, on every interval duration, checks if the test condition has been met. If
 // the condition is met within the timeout period, no further action is taken. Otherwise, the
-// onexpire function is invoked.
+// onexpire function is invoked. The checks run on the Env's timer wheel, so test and onexpire
+// must not block.
 func (t *Env) Expire(test func()bool, onexpire func(), timeout, interval int64, fmt_ string, args_ ...interface{}) {
-	t.Go(func() {
-		k := timeout / interval
-		if k <= 0 {
-			panic("frequency too small")
+	k := timeout / interval
+	if k <= 0 {
+		panic("frequency too small")
+	}
+	var i int64
+	var check func()
+	check = func() {
+		if test() {
+			return
 		}
-		for i := int64(0); i < k; i++ {
-			t.Sleep(interval)
-			if test() {
-				return
-			}
+		if i++; i >= k {
+			onexpire()
+			return
 		}
-		onexpire()
-	}, fmt_, args_...)
+		t.AfterFunc(interval, check, fmt_, args_...)
+	}
+	t.AfterFunc(interval, check, fmt_, args_...)
 }
@@ -0,0 +1,147 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEnvSeed(t *testing.T) {
+	env0, env1 := NewEnv(nil), NewEnv(nil)
+	env0.SetSeed(1234)
+	env1.SetSeed(1234)
+	var s0, s1 socket
+	for i := 0; i < 10; i++ {
+		if s0.ChooseISS(env0, nil, nil) != s1.ChooseISS(env1, nil, nil) {
+			t.Fatalf("equally seeded envs produce different ISS")
+		}
+	}
+	if env0.Seed() != 1234 {
+		t.Errorf("seed not retained")
+	}
+}
+
+func TestEnvSleepUntil(t *testing.T) {
+	// A Time that is not precise falls back to Sleep
+	manual := NewEnvTime(&manualTime{now: 1e9}, nil)
+	manual.SleepUntil(1e9 + 5e6)
+	if now := manual.Now(); now != 1e9 + 5e6 {
+		t.Errorf("manual time woke up at %d", now)
+	}
+	manual.SleepUntil(0)
+	if now := manual.Now(); now != 1e9 + 5e6 {
+		t.Errorf("manual time slept past the deadline, until %d", now)
+	}
+	env := NewEnvTime(NewDilatedTime(10), nil)
+	for i := 0; i < 10; i++ {
+		deadline := env.Now() + 3e6
+		env.SleepUntil(deadline)
+		if now := env.Now(); now < deadline || now > deadline + 100e6 {
+			t.Errorf("woke up %d ns after the deadline", now - deadline)
+		}
+	}
+}
+
+func TestEnvClock(t *testing.T) {
+	mt := &manualTime{now: 1e9}
+	env := NewEnvTime(mt, nil)
+	mt.Sleep(10e6)
+	if now := env.Now(); now != 1e9 + 10e6 {
+		t.Errorf("clock at %d", now)
+	}
+	// A step back of the Time holds the clock still until the Time catches up
+	mt.Lock()
+	mt.now = 1e9
+	mt.Unlock()
+	if now := env.Now(); now != 1e9 + 10e6 {
+		t.Errorf("clock went back to %d", now)
+	}
+	if env.ClockSteps() != 1 {
+		t.Errorf("%d steps back, expecting 1", env.ClockSteps())
+	}
+	mt.Sleep(15e6)
+	if now := env.Clock().Now(); now != 1e9 + 15e6 {
+		t.Errorf("clock at %d after catching up", now)
+	}
+	real := NewEnv(nil)
+	for i, last := 0, real.Now(); i < 1000; i++ {
+		now := real.Now()
+		if now < last {
+			t.Fatalf("real clock went back by %d ns", last - now)
+		}
+		last = now
+	}
+}
+
+func TestEnvLeak(t *testing.T) {
+	env := NewEnv(nil)
+	env.SetLeakGrace(100e6)
+	quit := make(chan int)
+	env.Go(func() { <-quit }, "lingering")
+	env.Go(func() {}, "exiting")
+	err := env.Close()
+	close(quit)
+	leak, ok := err.(*LeakError)
+	if !ok {
+		t.Fatalf("expecting leak error, got %v", err)
+	}
+	if len(leak.Pending) != 1 || !strings.Contains(leak.Error(), "lingering") {
+		t.Errorf("unexpected leak report: %s", leak)
+	}
+	if !strings.Contains(leak.Error(), "TestEnvLeak") {
+		t.Errorf("leak report lacks stack trace: %s", leak)
+	}
+}
+
+func TestTraceFilter(t *testing.T) {
+	ring := NewRingTraceWriter(10)
+	env := NewEnv(ring)
+	conn := NewAmb("client", env)
+	sender, receiver := conn.Refine("sender"), conn.Refine("receiver")
+
+	conn.SetFilter("", LevelWarn)
+	conn.SetFilter("*/receiver", LevelDetail)
+	sender.E(EventInfo, "filtered")
+	receiver.Refine("estimator").E(EventRead, "admitted")
+	conn.E(EventWarn, "admitted")
+	conn.E(EventDrop, "filtered")
+
+	// Filters can be changed while in use
+	conn.SetFilter("*/receiver", LevelOff)
+	receiver.E(EventError, "filtered")
+	env.ClearTraceFilters()
+	sender.E(EventIdle, "admitted")
+
+	for _, r := range ring.Traces() {
+		if r.Comment != "admitted" {
+			t.Errorf("%s event from %v should be filtered", r.Event, r.Labels)
+		}
+	}
+	if ring.Total() != 3 {
+		t.Errorf("expecting 3 admitted events, got %d", ring.Total())
+	}
+}
+
+func TestTraceSampling(t *testing.T) {
+	ring := NewRingTraceWriter(100)
+	env := NewEnv(ring)
+	amb := NewAmb("conn", env)
+	env.SetTraceSampling(EventRead, 10)
+	env.SetTraceRateLimit(EventWrite, 5)
+	env.SetTraceSampling(EventWarn, 10)
+	for i := 0; i < 50; i++ {
+		amb.E(EventRead, "read")
+		amb.E(EventWrite, "write")
+		amb.E(EventWarn, "warn")
+	}
+	count := make(map[string]int)
+	for _, r := range ring.Traces() {
+		count[r.Comment]++
+	}
+	if count["read"] != 5 || count["write"] != 5 || count["warn"] != 50 {
+		t.Errorf("unexpected admitted counts %v", count)
+	}
+}
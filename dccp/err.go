@@ -4,6 +4,8 @@
 
 package dccp
 
+import "strconv"
+
 // ProtoError is a type that wraps all DCCP-specific errors.
 // It is utilized to distinguish these errors from others, using type checks.
 type ProtoError string
@@ -33,8 +35,21 @@ var (
 	ErrReset         = NewError("reset")
 	ErrTooBig        = NewError("too big")
 	ErrOverflow      = NewError("overflow")
+	ErrTooLarge      = NewError("too large")
 )
 
+// TooLargeError is returned by Write and WriteMsg for a block that does not fit into a packet
+// of the current maximum packet size, Section 14. The block is not sent. Max is the size of
+// the largest block that fits. errors.Is(err, ErrTooLarge) holds for any TooLargeError err.
+type TooLargeError struct {
+	Max int
+}
+
+func (e TooLargeError) Error() string { return "too large (max " + strconv.Itoa(e.Max) + ")" }
+
+// Is makes a TooLargeError match ErrTooLarge
+func (e TooLargeError) Is(target error) bool { return target == ErrTooLarge }
+
 // Connection errors
 var (
 	ErrEOF     = NewError("i/o eof")
@@ -50,7 +65,7 @@ var (
 // the connection must be reset. CongestionReset encloses the desired Reset Code.
 type CongestionReset byte
 
-func (ce CongestionReset) Error() string { return "cc-reset(" + resetCodeString(byte(ce)) + ")" }
+func (ce CongestionReset) Error() string { return "cc-reset(" + ResetCodeString(byte(ce)) + ")" }
 
 func (ce CongestionReset) ResetCode() byte { return byte(ce) }
 
@@ -0,0 +1,32 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+// Every Conn keeps the most recent events emitted by its Amb, and by the Ambs refined from it,
+// such as those of its congestion controls, whether or not its Env has a TraceWriter. A server
+// that handles many flows can thus pull the trace of the one that misbehaved, without logging
+// all of them. The events are subject to the trace filters of the Env, see SetTraceFilter, and
+// carry no stack trace unless the Env has a TraceWriter.
+
+// ConnEventsLen is the number of most recent events that a new Conn keeps for Events
+const ConnEventsLen = 256
+
+// Events returns the most recent events of the connection, oldest first
+func (c *Conn) Events() []*Trace {
+	if ring := c.amb.events(); ring != nil {
+		return ring.Traces()
+	}
+	return nil
+}
+
+// SetEventsLen sets the number of most recent events that the connection keeps for Events,
+// and discards the events kept so far. Zero stops keeping events.
+func (c *Conn) SetEventsLen(n int) {
+	if n <= 0 {
+		c.amb.setEvents(nil)
+		return
+	}
+	c.amb.setEvents(NewRingTraceWriter(n))
+}
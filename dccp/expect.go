@@ -0,0 +1,236 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Expectations turn the EventMatch records of a run into test assertions. A test declares
+// the events it expects with Matchers, in sequences that must occur in order or in sets that
+// may occur in any order, as well as events that must never occur. The Env checks every
+// record emitted by its Ambs against the declarations, regardless of trace filters, and Close
+// reports the expectations that were not met and the events that were not expected with an
+// *ExpectError.
+type Expectations struct {
+	sync.Mutex
+	seqs       []*expectSeq
+	sets       []*expected
+	never      []*expected
+	strict     bool     // Set by Strict
+	unexpected []string // Descriptions of the records that violated an expectation
+}
+
+// expectSeq is a sequence of matchers that must match in order
+type expectSeq struct {
+	list []*expected
+	next int // Index of the first matcher that has not matched yet
+}
+
+type expected struct {
+	m     *Matcher
+	count int // Number of records matched
+}
+
+// Matcher recognizes the trace records of one expected event
+type Matcher struct {
+	desc  string
+	match func(*Trace) bool
+}
+
+// String returns the description of the matcher
+func (m *Matcher) String() string {
+	return m.desc
+}
+
+// Match returns true if r is an event that m recognizes
+func (m *Matcher) Match(r *Trace) bool {
+	return m.match(r)
+}
+
+// MatchFunc returns a Matcher that recognizes the records for which f returns true, and
+// which is described by desc
+func MatchFunc(desc string, f func(r *Trace) bool) *Matcher {
+	return &Matcher{ desc: desc, match: f }
+}
+
+// MatchComment returns a Matcher that recognizes the EventMatch records with the given
+// comment, whose label stack begins with label. An empty label matches any label stack.
+func MatchComment(label, comment string) *Matcher {
+	return MatchFunc(fmt.Sprintf("%s%q", labelPrefix(label), comment), func(r *Trace) bool {
+		return r.Event == EventMatch && hasLabel(r, label) && r.Comment == comment
+	})
+}
+
+// MatchPrefix is like MatchComment, except that it recognizes the records whose comment
+// begins with prefix
+func MatchPrefix(label, prefix string) *Matcher {
+	return MatchFunc(fmt.Sprintf("%s%q…", labelPrefix(label), prefix), func(r *Trace) bool {
+		return r.Event == EventMatch && hasLabel(r, label) && strings.HasPrefix(r.Comment, prefix)
+	})
+}
+
+// MatchState returns a Matcher that recognizes the state changes to state of the Conn
+// labeled label
+func MatchState(label, state string) *Matcher {
+	return MatchFunc(fmt.Sprintf("%sstate %s", labelPrefix(label), state), func(r *Trace) bool {
+		if !hasLabel(r, label) {
+			return false
+		}
+		a := r.ArgOfType(StateChange{})
+		return a != nil && a.(StateChange).To == state
+	})
+}
+
+func hasLabel(r *Trace, label string) bool {
+	return label == "" || (len(r.Labels) > 0 && r.Labels[0] == label)
+}
+
+func labelPrefix(label string) string {
+	if label == "" {
+		return ""
+	}
+	return label + "·"
+}
+
+// Expect returns the Expectations of the Env, which Close checks
+func (t *Env) Expect() *Expectations {
+	t.Lock()
+	defer t.Unlock()
+	if t.expect == nil {
+		t.expect = &Expectations{}
+	}
+	return t.expect
+}
+
+// expectations returns the Expectations of the Env, or nil if none were declared
+func (t *Env) expectations() *Expectations {
+	t.Lock()
+	defer t.Unlock()
+	return t.expect
+}
+
+// InOrder expects events that match m, in the given order. An event that matches one of
+// the matchers before its predecessors have matched is unexpected. Sequences declared with
+// separate calls are independent of one another.
+func (x *Expectations) InOrder(m ...*Matcher) {
+	x.Lock()
+	defer x.Unlock()
+	s := &expectSeq{}
+	for _, m := range m {
+		s.list = append(s.list, &expected{ m: m })
+	}
+	x.seqs = append(x.seqs, s)
+}
+
+// Unordered expects events that match each of m at least once, in any order
+func (x *Expectations) Unordered(m ...*Matcher) {
+	x.Lock()
+	defer x.Unlock()
+	for _, m := range m {
+		x.sets = append(x.sets, &expected{ m: m })
+	}
+}
+
+// Never declares every event that matches one of m unexpected
+func (x *Expectations) Never(m ...*Matcher) {
+	x.Lock()
+	defer x.Unlock()
+	for _, m := range m {
+		x.never = append(x.never, &expected{ m: m })
+	}
+}
+
+// Strict declares unexpected every EventMatch record that no expectation matches
+func (x *Expectations) Strict() {
+	x.Lock()
+	defer x.Unlock()
+	x.strict = true
+}
+
+// observe checks the record r against the expectations
+func (x *Expectations) observe(r *Trace) {
+	x.Lock()
+	defer x.Unlock()
+	matched := false
+	for _, s := range x.seqs {
+		for i := s.next; i < len(s.list); i++ {
+			if !s.list[i].m.Match(r) {
+				continue
+			}
+			matched = true
+			s.list[i].count++
+			if i == s.next {
+				s.next++
+			} else {
+				x.unexpect(r, fmt.Sprintf("before %s", s.list[s.next].m))
+			}
+			break
+		}
+	}
+	for _, e := range x.sets {
+		if e.m.Match(r) {
+			matched = true
+			e.count++
+		}
+	}
+	for _, e := range x.never {
+		if e.m.Match(r) {
+			matched = true
+			e.count++
+			x.unexpect(r, fmt.Sprintf("never %s", e.m))
+		}
+	}
+	if x.strict && !matched && r.Event == EventMatch {
+		x.unexpect(r, "strict")
+	}
+}
+
+func (x *Expectations) unexpect(r *Trace, why string) {
+	x.unexpected = append(x.unexpected, fmt.Sprintf("%s %s%q (%s)", Nstoa(r.Time), labelString(r.Labels), r.Comment, why))
+}
+
+// check returns an *ExpectError if an expectation was not met or an event was unexpected
+func (x *Expectations) check() error {
+	x.Lock()
+	defer x.Unlock()
+	err := &ExpectError{ Unexpected: x.unexpected }
+	for _, s := range x.seqs {
+		for _, e := range s.list[s.next:] {
+			err.Unmet = append(err.Unmet, e.m.String())
+		}
+	}
+	for _, e := range x.sets {
+		if e.count == 0 {
+			err.Unmet = append(err.Unmet, e.m.String())
+		}
+	}
+	if len(err.Unmet) == 0 && len(err.Unexpected) == 0 {
+		return nil
+	}
+	return err
+}
+
+// ExpectError lists the expectations that were not met by the time the Env was closed, and
+// the events that were not expected
+type ExpectError struct {
+	Unmet      []string
+	Unexpected []string
+}
+
+func (e *ExpectError) Error() string {
+	var w bytes.Buffer
+	fmt.Fprintf(&w, "%d unmet expectation(s), %d unexpected event(s)", len(e.Unmet), len(e.Unexpected))
+	for _, s := range e.Unmet {
+		fmt.Fprintf(&w, "\nunmet: %s", s)
+	}
+	for _, s := range e.Unexpected {
+		fmt.Fprintf(&w, "\nunexpected: %s", s)
+	}
+	return w.String()
+}
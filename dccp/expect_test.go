@@ -0,0 +1,58 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpect(t *testing.T) {
+	env := NewEnv(nil)
+	x := env.Expect()
+	x.InOrder(MatchComment("a", "one"), MatchComment("a", "two"))
+	x.Unordered(MatchPrefix("", "any"), MatchComment("b", "missing"))
+	x.Never(MatchComment("b", "bad"))
+	a, b := NewAmb("a", env), NewAmb("b", env)
+	b.E(EventMatch, "any b")
+	a.E(EventMatch, "one")
+	a.E(EventInfo, "two")
+	b.E(EventMatch, "two")
+	a.E(EventMatch, "two")
+	a.E(EventMatch, "one")
+	b.E(EventMatch, "bad")
+	err, ok := env.Close().(*ExpectError)
+	if !ok {
+		t.Fatalf("expecting an expectation error")
+	}
+	if len(err.Unmet) != 1 || !strings.Contains(err.Unmet[0], "missing") {
+		t.Errorf("unmet %v", err.Unmet)
+	}
+	if len(err.Unexpected) != 1 || !strings.Contains(err.Unexpected[0], "bad") {
+		t.Errorf("unexpected %v", err.Unexpected)
+	}
+}
+
+func TestExpectOrder(t *testing.T) {
+	env := NewEnv(nil)
+	env.SetTraceFilter("", LevelError)
+	x := env.Expect()
+	x.InOrder(MatchComment("a", "one"), MatchComment("a", "two"))
+	x.Strict()
+	a := NewAmb("a", env)
+	a.E(EventMatch, "two")
+	a.E(EventMatch, "one")
+	a.E(EventMatch, "three")
+	err, ok := env.Close().(*ExpectError)
+	if !ok {
+		t.Fatalf("expecting an expectation error")
+	}
+	if len(err.Unmet) != 1 || len(err.Unexpected) != 2 {
+		t.Errorf("filtered events not checked: %s", err)
+	}
+	if !strings.Contains(err.Unexpected[0], "before") || !strings.Contains(err.Unexpected[1], "strict") {
+		t.Errorf("unexpected %v", err.Unexpected)
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"expvar"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Endpoint statistics, aggregated over all connections in the process, are published via
+// expvar under the "godccp" map:
+//
+//   conns     Number of connections created
+//   state     Number of connections currently in each DCCP state
+//   pkts_in   Packets read
+//   pkts_out  Packets written
+//   bytes_in  Application data bytes read
+//   bytes_out Application data bytes written
+//   resets_in, resets_out  Reset packets read and written
+//   injections  Packets ignored as suspected off-path injections, see Conn.Stats
+//   ccid      Status of the congestion controls of each active connection, by connection
+//             number: its label, and the status maps of its sender and receiver CCIDs
+//
+var expStats = expvar.NewMap("godccp")
+
+var expStates = new(expvar.Map).Init()
+
+func init() {
+	expStats.Set("state", expStates)
+	expStats.Set("ccid", expvar.Func(expCCIDs))
+}
+
+// liveConns tracks the connections of the process that have not reached CLOSED, for the
+// "ccid" variable and for DebugHandler
+var liveConns = struct {
+	sync.Mutex
+	conns map[uint64]*Conn
+}{conns: make(map[uint64]*Conn)}
+
+// liveAdd adds c to the active connections
+func (c *Conn) liveAdd() {
+	liveConns.Lock()
+	defer liveConns.Unlock()
+	liveConns.conns[c.id] = c
+}
+
+// liveRemove removes c from the active connections
+func (c *Conn) liveRemove() {
+	liveConns.Lock()
+	defer liveConns.Unlock()
+	delete(liveConns.conns, c.id)
+}
+
+// liveActive returns the active connections, ordered by number
+func liveActive() []*Conn {
+	liveConns.Lock()
+	defer liveConns.Unlock()
+	var cc []*Conn
+	for _, c := range liveConns.conns {
+		cc = append(cc, c)
+	}
+	sort.Slice(cc, func(i, j int) bool { return cc[i].id < cc[j].id })
+	return cc
+}
+
+// liveLookup returns the active connection with number id, or nil
+func liveLookup(id uint64) *Conn {
+	liveConns.Lock()
+	defer liveConns.Unlock()
+	return liveConns.conns[id]
+}
+
+// expCCID is the published status of the congestion controls of a connection
+type expCCID struct {
+	Label    string
+	Sender   map[string]float64 `json:",omitempty"`
+	Receiver map[string]float64 `json:",omitempty"`
+}
+
+// expCCIDs returns the status of the congestion controls of the active connections
+func expCCIDs() interface{} {
+	m := make(map[string]expCCID)
+	for _, c := range liveActive() {
+		m[strconv.FormatUint(c.id, 10)] = expCCID{
+			Label:    c.amb.Labels()[0],
+			Sender:   ccStatus(c.scc()),
+			Receiver: ccStatus(c.rcc()),
+		}
+	}
+	return m
+}
+
+// expSetState moves the connection to state in the published per-state connection counts.
+// Connections that reach CLOSED are dropped from the counts, so that CLOSED stays at zero
+// instead of growing with every connection the process has ever had.
+func (c *Conn) expSetState(state int) {
+	s := StateString(state)
+	if s == c.expState {
+		return
+	}
+	if c.expState != "" {
+		expStates.Add(c.expState, -1)
+	} else {
+		expStats.Add("conns", 1)
+	}
+	c.expState = s
+	if state == CLOSED {
+		return
+	}
+	expStates.Add(s, 1)
+}
+
+func expCountHeader(h *Header, dir string) {
+	expStats.Add("pkts_" + dir, 1)
+	expStats.Add("bytes_" + dir, int64(len(h.Data)))
+	if h.Type == Reset {
+		expStats.Add("resets_" + dir, 1)
+	}
+}
@@ -0,0 +1,523 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Feature numbers, Section 6.4
+const (
+	FeatureCCID              = 1
+	FeatureAllowShortSeqNos  = 2
+	FeatureSequenceWindow    = 3
+	FeatureECNIncapable      = 4
+	FeatureAckRatio          = 5
+	FeatureSendAckVector     = 6
+	FeatureSendNDPCount      = 7
+	FeatureMinCsCov          = 8
+	FeatureCheckDataChecksum = 9
+)
+
+// FeatureLocation tells which endpoint keeps the value of a feature, Section 6. The other
+// endpoint is the feature remote.
+type FeatureLocation int
+
+const (
+	FeatureLocal  FeatureLocation = iota // The feature is located at the local endpoint
+	FeatureRemote                        // The feature is located at the remote endpoint
+)
+
+const (
+	FEATURE_BACKOFF_FIRST      = 400e6    // Initial re-send period of an unconfirmed Change, 400 miliseconds in ns
+	FEATURE_BACKOFF_FREQ       = 1e9      // Back-off Change resend every sec, in ns
+	FEATURE_BACKOFF_TIMEOUT    = 30e9     // Give up on a negotiation after 30 sec, in ns
+)
+
+// Negotiation states of a feature, Section 6.6.2
+const (
+	featureStable   = iota // The feature has its expected value
+	featureChanging        // A Change was sent and its Confirm is awaited
+	featureUnstable        // The preferences changed while a Confirm was awaited
+)
+
+// featureInfo describes a feature of Table 4. Server-priority features have one-byte values
+// and are reconciled from preference lists, Section 6.3.1. Non-negotiable features have
+// values of size bytes, which only the feature location changes, Section 6.3.2.
+type featureInfo struct {
+	sp       bool
+	size     int
+	min, max uint64 // Valid values of a non-negotiable feature
+}
+
+var featureInfos = map[byte]featureInfo{
+	FeatureCCID:              {sp: true},
+	FeatureAllowShortSeqNos:  {sp: true},
+	FeatureSequenceWindow:    {size: 6, min: 32, max: 1<<46 - 1},
+	FeatureECNIncapable:      {sp: true},
+	FeatureAckRatio:          {size: 2, min: 1, max: 1<<16 - 1},
+	FeatureSendAckVector:     {sp: true},
+	FeatureSendNDPCount:      {sp: true},
+	FeatureMinCsCov:          {sp: true},
+	FeatureCheckDataChecksum: {sp: true},
+}
+
+type featureKey struct {
+	loc    FeatureLocation
+	number byte
+}
+
+// featureNeg holds the value of a feature and the state of its negotiation
+type featureNeg struct {
+	value uint64
+	prefs []uint64 // Preference list set by ChangeFeature, most preferred first
+	state int
+
+	// Section 6.6.1: Feature options on packets with sequence numbers up to fgsr, and
+	// Confirms that acknowledge packets before the last Change, are reordered and ignored
+	fgsr int64 // Greatest sequence number received on a packet with an option for the feature
+	fgss int64 // Sequence number of the packet that carried the last Change
+
+	due     bool   // Set when the Change is to be sent on the next packet
+	confirm []byte // Data of the Confirm to be sent on the next packet, if any
+	backoff int    // Incremented on each negotiation, so that stale re-send timers quit
+
+	// Section 6.6.9: A Mandatory Change resets the connection, rather than keep the old value,
+	// if the negotiation fails
+	mandatory bool
+}
+
+// feature returns the negotiation state of the feature of key k, creating it with the value
+// that GoDCCP assumes for the feature
+func (c *Conn) feature(k featureKey) *featureNeg {
+	c.AssertLocked()
+	if f, ok := c.features[k]; ok {
+		return f
+	}
+	if c.features == nil {
+		c.features = make(map[featureKey]*featureNeg)
+	}
+	f := &featureNeg{ value: c.featureDefault(k), fgsr: -1, fgss: -1 }
+	c.features[k] = f
+	return f
+}
+
+// featureDefault returns the value that GoDCCP assumes for the feature of key k until it is
+// negotiated. The CCIDs are those of the Conn, and the Sequence Window is SEQWIN_FIXED.
+func (c *Conn) featureDefault(k featureKey) uint64 {
+	switch k.number {
+	case FeatureCCID:
+		if k.loc == FeatureLocal {
+			return uint64(c.scc().GetID())
+		}
+		return uint64(c.rcc().GetID())
+	case FeatureSequenceWindow:
+		return SEQWIN_FIXED
+	case FeatureAckRatio:
+		return 2
+	}
+	return 0
+}
+
+// featureSupported returns the values of the server-priority feature of key k that GoDCCP
+// can work with, most preferred first. The CCIDs are those registered, see ccidneg.go, Ack
+// Vectors are left to CCIDs that handle them, and NDP Count options are accepted, but not sent.
+func (c *Conn) featureSupported(k featureKey) []uint64 {
+	switch k.number {
+	case FeatureCCID:
+		return c.ccidPrefs(k.loc)
+	case FeatureAllowShortSeqNos, FeatureECNIncapable, FeatureCheckDataChecksum:
+		return []uint64{0, 1}
+	case FeatureSendAckVector:
+		if c.supportsAckVector(k.loc) {
+			return []uint64{0, 1}
+		}
+	case FeatureSendNDPCount:
+		if k.loc == FeatureRemote {
+			return []uint64{0, 1}
+		}
+	case FeatureMinCsCov:
+		return []uint64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+	}
+	return []uint64{0}
+}
+
+// featurePrefs returns the preference list of the local endpoint for the server-priority
+// feature of key k
+func (c *Conn) featurePrefs(k featureKey) []uint64 {
+	if f := c.feature(k); f.prefs != nil {
+		return f.prefs
+	}
+	return c.featureSupported(k)
+}
+
+// Feature returns the current value of feature number, located at loc. It returns false if
+// GoDCCP does not know the feature.
+func (c *Conn) Feature(loc FeatureLocation, number byte) (uint64, bool) {
+	c.Lock()
+	defer c.Unlock()
+	if _, ok := featureInfos[number]; !ok {
+		return 0, false
+	}
+	return c.feature(featureKey{loc, number}).value, true
+}
+
+// ChangeFeature starts the negotiation of feature number, located at loc, Section 6.6. The
+// values of a server-priority feature are a preference list, most preferred first, and the
+// server's preferences prevail. A non-negotiable feature takes a single value, and only its
+// feature location can change it. The Change is sent again, with exponential backoff, until
+// the peer confirms it or FEATURE_BACKOFF_TIMEOUT passes. A negotiation that fails leaves the
+// value unchanged. ChangeFeature returns ErrUnsupported for unknown features and for values
+// that GoDCCP cannot work with, and ErrBad for invalid arguments.
+func (c *Conn) ChangeFeature(loc FeatureLocation, number byte, values ...uint64) error {
+	info, ok := featureInfos[number]
+	if !ok {
+		return ErrUnsupported
+	}
+	k := featureKey{loc, number}
+	c.Lock()
+	defer c.Unlock()
+	if info.sp {
+		if len(values) == 0 {
+			return ErrBad
+		}
+		supported := c.featureSupported(k)
+		for _, v := range values {
+			if !containsValue(supported, v) {
+				return ErrUnsupported
+			}
+		}
+	} else if loc != FeatureLocal || len(values) != 1 || values[0] < info.min || values[0] > info.max {
+		return ErrBad
+	}
+	switch c.socket.GetState() {
+	case CLOSEREQ, CLOSING, TIMEWAIT, CLOSED:
+		return ErrBad
+	}
+
+	c.changeFeature(k, append([]uint64(nil), values...))
+	return nil
+}
+
+// changeFeature sets the preferences of the feature of key k to prefs, and starts their
+// negotiation
+func (c *Conn) changeFeature(k featureKey, prefs []uint64) {
+	c.AssertLocked()
+	f := c.feature(k)
+	f.prefs = prefs
+	switch f.state {
+	case featureStable:
+		f.state = featureChanging
+		c.sendChange(k, f)
+	case featureChanging:
+		// The new preferences are sent once the pending Change is confirmed
+		f.state = featureUnstable
+	}
+}
+
+// sendChange sends the Change for the feature of key k on the next packet, and re-sends it
+// with exponential backoff until it is confirmed
+func (c *Conn) sendChange(k featureKey, f *featureNeg) {
+	c.AssertLocked()
+	f.due = true
+	f.backoff++
+	c.injectFeatureCarrier()
+	backoff := f.backoff
+	b := newBackOff(c.env, FEATURE_BACKOFF_FIRST, FEATURE_BACKOFF_TIMEOUT, FEATURE_BACKOFF_FREQ)
+	b.Go(func(err error, _ int64) bool {
+		c.Lock()
+		defer c.Unlock()
+		if f.backoff != backoff || f.state == featureStable {
+			return false
+		}
+		if err != nil || c.socket.GetState() == CLOSED {
+			c.amb.E(EventWarn, fmt.Sprintf("Feature %d negotiation timeout", k.number))
+			f.state = featureStable
+			return false
+		}
+		// Section 6.6.2: On timeout, an unstable feature sends its new preferences
+		f.state = featureChanging
+		f.due = true
+		c.injectFeatureCarrier()
+		return true
+	}, "Feature")
+}
+
+// injectFeatureCarrier queues an Ack that carries pending feature options, once the
+// connection is established. Before then, the handshake packets carry them.
+func (c *Conn) injectFeatureCarrier() {
+	switch c.socket.GetState() {
+	case PARTOPEN, OPEN:
+		c.inject(c.generateAck())
+	}
+}
+
+// placeFeatures adds to h the Changes that are due and the Confirms that are pending.
+// Section 5.8: Feature options are not allowed on Data packets, which leave them pending.
+func (c *Conn) placeFeatures(h *writeHeader) {
+	c.AssertLocked()
+	if len(c.features) == 0 || h.Type == Data {
+		return
+	}
+	// The options are placed in the order of the feature keys, so that packets do not vary
+	// with the iteration order of the map
+	var keys []featureKey
+	for k, f := range c.features {
+		if f.confirm != nil || f.due {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].number != keys[j].number {
+			return keys[i].number < keys[j].number
+		}
+		return keys[i].loc < keys[j].loc
+	})
+	for _, k := range keys {
+		f := c.features[k]
+		if f.confirm != nil {
+			t := byte(OptionConfirmL)
+			if k.loc == FeatureRemote {
+				t = OptionConfirmR
+			}
+			h.Options = append(h.Options, Option{ Type: t, Data: f.confirm })
+			f.confirm = nil
+		}
+		if f.due {
+			t := byte(OptionChangeL)
+			if k.loc == FeatureRemote {
+				t = OptionChangeR
+			}
+			h.Options = append(h.Options, Option{ Type: t, Data: encodeFeatureValues(k.number, f.prefs), Mandatory: f.mandatory })
+			f.fgss = h.SeqNo
+			f.due = false
+		}
+	}
+}
+
+// encodeFeatureValues returns the data of a Change or Confirm option for feature number
+// with values, encoded according to the type of the feature
+func encodeFeatureValues(number byte, values []uint64) []byte {
+	info := featureInfos[number]
+	d := []byte{number}
+	if info.sp {
+		for _, v := range values {
+			d = append(d, byte(v))
+		}
+		return d
+	}
+	for _, v := range values {
+		for i := info.size - 1; i >= 0; i-- {
+			d = append(d, byte(v>>(8*uint(i))))
+		}
+	}
+	return d
+}
+
+// decodeFeatureValue decodes the value of a non-negotiable feature from b
+func decodeFeatureValue(info featureInfo, b []byte) (uint64, bool) {
+	if len(b) != info.size {
+		return 0, false
+	}
+	var v uint64
+	for _, x := range b {
+		v = v<<8 | uint64(x)
+	}
+	return v, v >= info.min && v <= info.max
+}
+
+// readFeatures processes the Change and Confirm options of h. It returns a Mandatory Change
+// that could not be honored, or the Confirm that failed a Mandatory Change of the Conn, which
+// call for a Reset, Section 6.6.9.
+func (c *Conn) readFeatures(h *Header) *Option {
+	c.AssertLocked()
+	if h.Type == Reset {
+		return nil
+	}
+	opts := h.GetOptions()
+	for i := range opts {
+		o := &opts[i]
+		if o.Type < OptionChangeL || o.Type > OptionConfirmR || len(o.Data) == 0 {
+			continue
+		}
+		// Change L and Confirm L options concern features located at their sender
+		loc := FeatureLocal
+		if o.Type == OptionChangeL || o.Type == OptionConfirmL {
+			loc = FeatureRemote
+		}
+		k := featureKey{loc, o.Data[0]}
+		if o.Type == OptionChangeL || o.Type == OptionChangeR {
+			if !c.readChange(k, o, h) && o.Mandatory {
+				return o
+			}
+		} else if !c.readConfirm(k, o, h) && c.feature(k).mandatory {
+			return o
+		}
+	}
+	return nil
+}
+
+// readChange reconciles the feature of key k with the Change o and queues the Confirm. It
+// returns false if the Change could not be honored.
+func (c *Conn) readChange(k featureKey, o *Option, h *Header) bool {
+	info, ok := featureInfos[k.number]
+	if !ok || (!info.sp && k.loc == FeatureLocal) {
+		// Section 6.6.7: Unknown features, and Change R options for non-negotiable features,
+		// are answered with an empty Confirm
+		c.queueConfirm(k, []byte{k.number})
+		return false
+	}
+	f := c.feature(k)
+	if h.SeqNo <= f.fgsr {
+		c.amb.E(EventDrop, "Reordered Change", h)
+		return true
+	}
+	f.fgsr = h.SeqNo
+
+	var v uint64
+	if info.sp {
+		// Section 6.3.1: The first value of the server's preference list that the client
+		// also prefers
+		server, client := c.featurePrefs(k), bytesToValues(o.Data[1:])
+		if !c.socket.IsServer() {
+			server, client = client, server
+		}
+		if v, ok = reconcile(server, client); !ok {
+			if k.number == FeatureCCID {
+				c.env.Deviate(c.amb, devFeatures, h)
+			}
+			c.amb.E(EventWarn, fmt.Sprintf("Feature %d reconciliation failed", k.number), h)
+			c.queueConfirm(k, []byte{k.number})
+			return false
+		}
+		c.queueConfirm(k, encodeFeatureValues(k.number, append([]uint64{v}, c.featurePrefs(k)...)))
+	} else {
+		if v, ok = decodeFeatureValue(info, o.Data[1:]); !ok {
+			c.amb.E(EventWarn, fmt.Sprintf("Feature %d value invalid", k.number), h)
+			c.queueConfirm(k, []byte{k.number})
+			return false
+		}
+		c.queueConfirm(k, encodeFeatureValues(k.number, []uint64{v}))
+	}
+	c.setFeature(k, f, v)
+
+	// Section 6.6.2: A Change of the peer settles a feature that is changing, since both
+	// endpoints reconcile to the same value. An unstable feature sends its new preferences.
+	switch f.state {
+	case featureChanging:
+		f.state = featureStable
+	case featureUnstable:
+		f.state = featureChanging
+		c.sendChange(k, f)
+	}
+	return true
+}
+
+// readConfirm completes the negotiation of the feature of key k with the Confirm o. It
+// returns false if the negotiation failed.
+func (c *Conn) readConfirm(k featureKey, o *Option, h *Header) bool {
+	info, ok := featureInfos[k.number]
+	if !ok {
+		return true
+	}
+	f := c.feature(k)
+	if h.SeqNo <= f.fgsr || !h.HasAckNo() || h.AckNo < f.fgss {
+		c.amb.E(EventDrop, "Reordered Confirm", h)
+		return true
+	}
+	f.fgsr = h.SeqNo
+	switch f.state {
+	case featureStable:
+		return true
+	case featureUnstable:
+		f.state = featureChanging
+		c.sendChange(k, f)
+		return true
+	}
+	f.state = featureStable
+
+	var v uint64
+	if info.sp {
+		ok = len(o.Data) >= 2 && containsValue(f.prefs, uint64(o.Data[1]))
+		if ok {
+			v = uint64(o.Data[1])
+		}
+	} else {
+		v, ok = decodeFeatureValue(info, o.Data[1:])
+		ok = ok && v == f.prefs[0]
+	}
+	if !ok {
+		c.amb.E(EventWarn, fmt.Sprintf("Feature %d negotiation failed", k.number), h)
+		return false
+	}
+	c.setFeature(k, f, v)
+	return true
+}
+
+// queueConfirm queues a Confirm with data d for the feature of key k, and makes sure that a
+// packet carries it
+func (c *Conn) queueConfirm(k featureKey, d []byte) {
+	c.feature(k).confirm = d
+	c.injectFeatureCarrier()
+}
+
+// setFeature sets the value of the feature of key k to v, and puts it into effect
+func (c *Conn) setFeature(k featureKey, f *featureNeg, v uint64) {
+	if f.value != v {
+		c.amb.E(EventInfo, fmt.Sprintf("Feature %d at %s = %d", k.number, featureLocationString(k.loc), v))
+	}
+	f.value = v
+	if k.number == FeatureCCID {
+		c.switchCCID(k.loc, byte(v))
+	}
+	if k.number == FeatureSequenceWindow {
+		if k.loc == FeatureLocal {
+			c.socket.SetSWAF(int64(v))
+		} else {
+			c.socket.SetSWBF(int64(v))
+		}
+	}
+	if k.number == FeatureAckRatio && k.loc == FeatureRemote && c.ccidOpen {
+		c.syncAckRatio()
+	}
+	if k.number == FeatureSendAckVector && k.loc == FeatureLocal && c.ccidOpen {
+		c.syncSendAckVector()
+	}
+}
+
+// reconcile returns the first value of server that is also in client, Section 6.3.1
+func reconcile(server, client []uint64) (uint64, bool) {
+	for _, v := range server {
+		if containsValue(client, v) {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+func containsValue(values []uint64, v uint64) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func bytesToValues(b []byte) []uint64 {
+	values := make([]uint64, len(b))
+	for i, x := range b {
+		values[i] = uint64(x)
+	}
+	return values
+}
+
+func featureLocationString(loc FeatureLocation) string {
+	if loc == FeatureLocal {
+		return "local"
+	}
+	return "remote"
+}
@@ -7,16 +7,13 @@ package dccp
 import (
 	"fmt"
 	"runtime"
-	"encoding/json"
 	"os"
-	"sync"
 )
 
 // FileTraceWriter saves all log entries to a file in JSON format
 type FileTraceWriter struct {
-	sync.Mutex
 	f   *os.File
-	enc *json.Encoder
+	enc *JSONTraceWriter
 	dup TraceWriter
 }
 
@@ -27,7 +24,7 @@ func NewFileTraceWriterDup(filename string, dup TraceWriter) *FileTraceWriter {
 	if err != nil {
 		panic(fmt.Sprintf("cannot create log file '%s'", filename))
 	}
-	w := &FileTraceWriter{ f:f, enc:json.NewEncoder(f), dup:dup }
+	w := &FileTraceWriter{ f:f, enc:NewJSONTraceWriter(f), dup:dup }
 	runtime.SetFinalizer(w, func(w *FileTraceWriter) { 
 		w.f.Close() 
 	})
@@ -39,12 +36,7 @@ func NewFileTraceWriter(filename string) *FileTraceWriter {
 }
 
 func (t *FileTraceWriter) Write(r *Trace) {
-	t.Lock()
-	err := t.enc.Encode(r)
-	t.Unlock()
-	if err != nil {
-		panic(fmt.Sprintf("error encoding log entry (%s)", err))
-	}
+	t.enc.Write(r)
 	if t.dup != nil {
 		t.dup.Write(r)
 	}
@@ -11,17 +11,21 @@ import (
 
 // flow is an implementation of SegmentConn
 type flow struct {
-	addr net.Addr
 	m    *Mux
 	ch   chan muxHeader
 	mtu  int
 
 	Mutex        // protects the variables below
+	addr         net.Addr
+	link         Link     // Link of the flow after a migration; the link of the Mux if nil
+	tos          int      // Traffic class of the packets of the flow, or -1 for that of the link
+	lastReadAddr net.Addr // Link-level address that the last read packet was received from
 	local        *Label
 	remote       *Label
 	lastRead     time.Time
 	lastWrite    time.Time
 	readDeadline time.Time
+	notify       func([]byte, error) // Receives the blocks of the flow, once NotifyBlocks is called
 
 	rlk Mutex // synchronizes calls to Read()
 }
@@ -34,6 +38,7 @@ func newFlow(addr net.Addr, m *Mux, ch chan muxHeader, mtu int, local, remote *L
 	now := time.Now()
 	return &flow{
 		addr:         addr,
+		tos:          -1,
 		local:        local,
 		remote:       remote,
 		lastRead:     now,
@@ -107,12 +112,12 @@ func (f *flow) String() string {
 // Write implements SegmentConn.Write
 func (f *flow) Write(block []byte) error {
 	f.Lock()
-	m := f.m
+	m, addr, link, tos := f.m, f.addr, f.link, f.tos
 	f.Unlock()
 	if m == nil {
 		return ErrBad
 	}
-	err := m.write(&muxMsg{f.getLocal(), f.getRemote()}, block, f.addr)
+	err := m.write(&muxMsg{f.getLocal(), f.getRemote()}, block, addr, link, tos)
 	if err != nil {
 		f.Lock()
 		f.lastWrite = time.Now()
@@ -154,21 +159,173 @@ func (f *flow) Read() (block []byte, err error) {
 		return nil, ErrTimeout
 	}
 
+	f.received(header.Addr)
+	return header.Cargo, nil
+}
+
+// received records that a block was received from addr
+func (f *flow) received(addr net.Addr) {
 	f.Lock()
+	defer f.Unlock()
 	f.lastRead = time.Now()
+	f.lastReadAddr = addr
+}
+
+// NotifyBlocks implements SegmentNotifier.NotifyBlocks. The blocks are handed to fn by the
+// read loop of the Mux, which serializes them with the blocks of all other flows.
+func (f *flow) NotifyBlocks(fn func(block []byte, err error)) {
+	f.Lock()
+	m := f.m
 	f.Unlock()
+	if m == nil {
+		fn(nil, ErrBad)
+		return
+	}
+	// Holding processLk keeps the Mux from queueing blocks on the flow meanwhile
+	m.processLk.Lock()
+	defer m.processLk.Unlock()
+	f.Lock()
+	f.notify = fn
+	ch := f.ch
+	f.Unlock()
+	for ch != nil {
+		select {
+		case header, ok := <-ch:
+			if !ok {
+				// The flow was foreclosed before
+				f.Lock()
+				f.notify = nil
+				f.Unlock()
+				fn(nil, ErrIO)
+				return
+			}
+			f.received(header.Addr)
+			fn(header.Cargo, nil)
+		default:
+			return
+		}
+	}
+}
 
-	return header.Cargo, nil
+// deliver hands a block received by the Mux to the notify function of the flow, or queues it
+// to be read. It is called with the processLk of the Mux held, so it must not block: if the
+// queue of the flow is full, the block is dropped, like a datagram that overflows a socket.
+func (f *flow) deliver(header muxHeader) {
+	f.Lock()
+	fn, ch := f.notify, f.ch
+	f.Unlock()
+	if fn != nil {
+		f.received(header.Addr)
+		fn(header.Cargo, nil)
+		return
+	}
+	if ch == nil {
+		return
+	}
+	select {
+	case ch <- header:
+	default:
+	}
 }
 
-func (f *flow) foreclose() {
+// setLink makes the flow send on link and returns its previous link, if any
+func (f *flow) setLink(link Link) Link {
+	f.Lock()
+	defer f.Unlock()
+	old := f.link
+	f.link = link
+	return old
+}
+
+// Migrate implements PathConn.Migrate
+func (f *flow) Migrate(laddr net.Addr) error {
+	f.Lock()
+	m := f.m
+	f.Unlock()
+	if m == nil {
+		return ErrBad
+	}
+	return m.migrate(f, laddr)
+}
+
+// LocalAddr implements AddrConn.LocalAddr
+func (f *flow) LocalAddr() net.Addr {
+	f.Lock()
+	m, link := f.m, f.link
+	f.Unlock()
+	if m == nil {
+		return nil
+	}
+	if link == nil {
+		m.Lock()
+		link = m.link
+		m.Unlock()
+	}
+	if la, ok := link.(interface{ LocalAddr() net.Addr }); ok {
+		return la.LocalAddr()
+	}
+	return nil
+}
+
+// RemoteAddr implements AddrConn.RemoteAddr
+func (f *flow) RemoteAddr() net.Addr {
+	f.Lock()
+	defer f.Unlock()
+	return f.addr
+}
+
+// SetTrafficClass implements TrafficClassConn.SetTrafficClass
+func (f *flow) SetTrafficClass(tos byte) error {
+	f.Lock()
+	m := f.m
+	f.Unlock()
+	if m == nil {
+		return ErrBad
+	}
+	if !m.canSetTrafficClass() {
+		return ErrUnsupported
+	}
+	f.Lock()
+	f.tos = int(tos)
+	f.Unlock()
+	return nil
+}
+
+// ConfirmPath implements PathConn.ConfirmPath
+func (f *flow) ConfirmPath() bool {
 	f.Lock()
 	defer f.Unlock()
+	if f.lastReadAddr == nil || sameAddr(f.lastReadAddr, f.addr) {
+		return false
+	}
+	f.addr = f.lastReadAddr
+	return true
+}
 
+// sameAddr returns true if a and b are the same Link-level address
+func sameAddr(a, b net.Addr) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Network() == b.Network() && a.String() == b.String()
+}
+
+// foreclose ends the flow on the side of the Mux. A notify function is told so from a new
+// goroutine, since the Mux is usually locked meanwhile.
+func (f *flow) foreclose() {
+	f.Lock()
+	m := f.m
 	if f.ch != nil {
 		close(f.ch)
 		f.ch = nil
 	}
+	fn := f.notify
+	f.notify = nil
+	f.Unlock()
+
+	if fn != nil && m != nil {
+		m.env.Go(func() { fn(nil, ErrIO) }, "foreclose flow")
+	}
 }
 
 // Close implements SegmentConn.Close
@@ -178,12 +335,16 @@ func (f *flow) Close() error {
 		close(f.ch)
 		f.ch = nil
 	}
-	m := f.m
-	f.m = nil
+	f.notify = nil
+	m, link := f.m, f.link
+	f.m, f.link = nil, nil
 	f.Unlock()
 	if m == nil {
 		return ErrBad
 	}
+	if link != nil {
+		m.closeLink(link)
+	}
 	m.del(f.getLocal(), f.getRemote())
 	return nil
 }
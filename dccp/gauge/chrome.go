@@ -0,0 +1,162 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package gauge
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// chromeEvent is a record in the Chrome tracing (trace_event) format
+type chromeEvent struct {
+	Name string                 `json:"name"`
+	Cat  string                 `json:"cat,omitempty"`
+	Ph   string                 `json:"ph"`
+	Ts   float64                `json:"ts"`
+	Dur  float64                `json:"dur,omitempty"`
+	Pid  int                    `json:"pid"`
+	Tid  int                    `json:"tid"`
+	S    string                 `json:"s,omitempty"`
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+// chromeTrace is the top-level object of a Chrome trace file
+type chromeTrace struct {
+	TraceEvents     []*chromeEvent `json:"traceEvents"`
+	DisplayTimeUnit string         `json:"displayTimeUnit"`
+}
+
+// chromeStateTrack is the thread id of the track holding DCCP state spans in each process
+const chromeStateTrack = 0
+
+// WriteChromeTrace converts the traces of a run into a Chrome tracing JSON document, which can
+// be loaded into chrome://tracing. Each connection, identified by the first label of a trace,
+// becomes a process. Each subsystem, identified by the second label, becomes a track within it,
+// and traces emitted directly by the connection go to a "conn" track. DCCP states are drawn as
+// spans on a separate "state" track, which makes handshakes and teardowns easy to spot.
+func WriteChromeTrace(w io.Writer, traces []*dccp.Trace) error {
+	sorted := make([]*dccp.Trace, len(traces))
+	copy(sorted, traces)
+	sort.Stable(TraceChrono(sorted))
+
+	x := &chromeExport{
+		pids: make(map[string]int),
+		tids: make(map[[2]string]int),
+		span: make(map[int]*chromeEvent),
+	}
+	for _, r := range sorted {
+		x.add(r)
+	}
+	x.closeSpans()
+	return json.NewEncoder(w).Encode(&chromeTrace{ TraceEvents: x.events, DisplayTimeUnit: "ns" })
+}
+
+type chromeExport struct {
+	events []*chromeEvent
+	pids   map[string]int
+	tids   map[[2]string]int
+	span   map[int]*chromeEvent // Open state span of each process
+	last   float64              // Timestamp of the latest trace
+}
+
+func chromeTime(ns int64) float64 {
+	return float64(ns) / 1e3
+}
+
+func (x *chromeExport) pid(conn string) int {
+	pid, ok := x.pids[conn]
+	if !ok {
+		pid = len(x.pids) + 1
+		x.pids[conn] = pid
+		x.meta("process_name", pid, chromeStateTrack, conn)
+		x.meta("thread_name", pid, chromeStateTrack, "state")
+	}
+	return pid
+}
+
+func (x *chromeExport) tid(pid int, conn, sub string) int {
+	key := [2]string{conn, sub}
+	tid, ok := x.tids[key]
+	if !ok {
+		tid = len(x.tids) + 1
+		x.tids[key] = tid
+		x.meta("thread_name", pid, tid, sub)
+	}
+	return tid
+}
+
+func (x *chromeExport) meta(kind string, pid, tid int, name string) {
+	x.events = append(x.events, &chromeEvent{
+		Name: kind,
+		Ph:   "M",
+		Pid:  pid,
+		Tid:  tid,
+		Args: map[string]interface{}{ "name": name },
+	})
+}
+
+func (x *chromeExport) add(r *dccp.Trace) {
+	conn, sub := "", "conn"
+	if len(r.Labels) > 0 {
+		conn = r.Labels[0]
+	}
+	if len(r.Labels) > 1 {
+		sub = r.Labels[1]
+	}
+	pid := x.pid(conn)
+	ts := chromeTime(r.Time)
+	x.last = ts
+
+	// Extend or switch the state span of the connection
+	if r.State != "" {
+		if open := x.span[pid]; open == nil || open.Name != r.State {
+			x.closeSpan(pid, ts)
+			x.span[pid] = &chromeEvent{ Name: r.State, Cat: "state", Ph: "X", Ts: ts, Pid: pid, Tid: chromeStateTrack }
+		}
+	}
+
+	name := r.Event.String()
+	if r.Type != "" {
+		name += " " + r.Type
+	}
+	args := map[string]interface{}{ "source": r.SourceFile }
+	if r.Comment != "" {
+		args["comment"] = r.Comment
+	}
+	if r.Type != "" {
+		args["seqno"], args["ackno"] = r.SeqNo, r.AckNo
+	}
+	for k, a := range r.Args {
+		args[k] = a
+	}
+	x.events = append(x.events, &chromeEvent{
+		Name: name,
+		Cat:  r.Event.String(),
+		Ph:   "i",
+		Ts:   ts,
+		Pid:  pid,
+		Tid:  x.tid(pid, conn, sub),
+		S:    "t",
+		Args: args,
+	})
+}
+
+func (x *chromeExport) closeSpan(pid int, ts float64) {
+	if open := x.span[pid]; open != nil {
+		open.Dur = ts - open.Ts
+		x.events = append(x.events, open)
+		delete(x.span, pid)
+	}
+}
+
+// closeSpans closes the open state spans in the order of their processes, so that the output
+// is deterministic
+func (x *chromeExport) closeSpans() {
+	for pid := 1; pid <= len(x.pids); pid++ {
+		x.closeSpan(pid, x.last)
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package gauge
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+// TestChromeTrace converts the short handshake log testdata/chrome-short.log, as dccp-chrome
+// does, and compares the indented result with testdata/chrome-short.golden. Set the
+// environment variable DCCPGOLDEN to "update" to record the golden file anew.
+func TestChromeTrace(t *testing.T) {
+	in, err := os.Open(path.Join("testdata", "chrome-short.log"))
+	if err != nil {
+		t.Fatalf("open log (%s)", err)
+	}
+	defer in.Close()
+	traces, err := ReadTraces(in)
+	if err != nil {
+		t.Fatalf("read log (%s)", err)
+	}
+	var out, got bytes.Buffer
+	if err = WriteChromeTrace(&out, traces); err != nil {
+		t.Fatalf("write trace (%s)", err)
+	}
+	if err = json.Indent(&got, out.Bytes(), "", "  "); err != nil {
+		t.Fatalf("indent (%s)", err)
+	}
+
+	file := path.Join("testdata", "chrome-short.golden")
+	if os.Getenv("DCCPGOLDEN") == "update" {
+		if err = ioutil.WriteFile(file, got.Bytes(), 0644); err != nil {
+			t.Fatalf("golden write (%s)", err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("golden read (%s); set DCCPGOLDEN=update to record it", err)
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Errorf("Chrome trace differs from %s:\n%s", file, got.String())
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package gauge
+
+import (
+	"sort"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// MergeTraces interleaves the traces of several logs, such as those of the client and the
+// server of a connection, in chronological order. Traces with equal times keep the order of
+// the logs.
+func MergeTraces(logs ...[]*dccp.Trace) []*dccp.Trace {
+	var merged []*dccp.Trace
+	for _, l := range logs {
+		merged = append(merged, l...)
+	}
+	sort.Stable(TraceChrono(merged))
+	return merged
+}
+
+// PacketMatch pairs the trace of a packet written by one endpoint of a connection with the
+// trace of the same packet read by the other endpoint
+type PacketMatch struct {
+	Corr  string      // Correlation ID of the connection
+	Write *dccp.Trace // Packet written
+	Read  *dccp.Trace // Packet read, or nil if it never arrived
+}
+
+// Latency returns the time the packet took from the writer to the reader, or -1 if it was
+// not read
+func (m *PacketMatch) Latency() int64 {
+	if m.Read == nil {
+		return -1
+	}
+	return m.Read.Time - m.Write.Time
+}
+
+type packetKey struct {
+	corr  string
+	typ   string
+	seqNo int64
+}
+
+// MatchPackets matches the packets that the endpoints of each connection write with those
+// that the respective peers read, using the correlation IDs of the traces, see
+// dccp.Amb.SetCorrelation. Traces without a correlation ID are ignored. The matches are
+// returned in the order of the writes; a packet written more than once on the same
+// connection is matched with its reads in order.
+func MatchPackets(traces []*dccp.Trace) []*PacketMatch {
+	sorted := MergeTraces(traces)
+	var matches []*PacketMatch
+	pending := make(map[packetKey][]*PacketMatch)
+	for _, r := range sorted {
+		if r.Corr == "" || r.Type == "" || len(r.Labels) != 1 {
+			continue
+		}
+		k := packetKey{ r.Corr, r.Type, r.SeqNo }
+		switch {
+		case isPacketWrite(r):
+			m := &PacketMatch{ Corr: r.Corr, Write: r }
+			matches = append(matches, m)
+			pending[k] = append(pending[k], m)
+		case r.Event == dccp.EventRead:
+			q := pending[k]
+			for i, m := range q {
+				if m.Write.Labels[0] != r.Labels[0] {
+					m.Read = r
+					pending[k] = append(q[:i], q[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+	return matches
+}
@@ -0,0 +1,162 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package gauge
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// Sequence diagram output formats
+const (
+	SeqDiagMermaid = iota
+	SeqDiagPlantUML
+)
+
+// seqMessage is a packet sent from one endpoint to another
+type seqMessage struct {
+	from, to string
+	r        *dccp.Trace
+	dropped  string // Reason for dropping the packet, if it was dropped
+}
+
+// seqItem is a line of the sequence diagram: either a message or a state note
+type seqItem struct {
+	msg   *seqMessage
+	who   string
+	state string
+}
+
+// WriteSequenceDiagram renders the packets exchanged between the endpoints of a sandbox run as
+// a sequence diagram in the given format. Each packet written by an endpoint becomes an arrow
+// labeled with its type, sequence and acknowledgement numbers and options. Packets dropped on
+// the way, by the sandbox pipe or by the receiving endpoint, are drawn as lost arrows annotated
+// with the reason. State transitions of the endpoints are drawn as notes.
+func WriteSequenceDiagram(w io.Writer, traces []*dccp.Trace, format int) error {
+	sorted := make([]*dccp.Trace, len(traces))
+	copy(sorted, traces)
+	sort.Stable(TraceChrono(sorted))
+
+	// Endpoints are the first labels of Ambs that write packets, other than the pipe
+	var endpoints []string
+	isEndpoint := make(map[string]bool)
+	for _, r := range sorted {
+		if isPacketWrite(r) && !isEndpoint[r.Labels[0]] {
+			isEndpoint[r.Labels[0]] = true
+			endpoints = append(endpoints, r.Labels[0])
+		}
+	}
+	peer := func(who string) string {
+		for _, e := range endpoints {
+			if e != who {
+				return e
+			}
+		}
+		return "peer"
+	}
+
+	var items []*seqItem
+	sent := make(map[string]*seqMessage) // "endpoint/seqno" —> message
+	state := make(map[string]string)
+	for _, r := range sorted {
+		if len(r.Labels) == 0 {
+			continue
+		}
+		who := r.Labels[0]
+		if isEndpoint[who] && r.State != "" && r.State != state[who] {
+			state[who] = r.State
+			items = append(items, &seqItem{ who: who, state: r.State })
+		}
+		switch {
+		case isPacketWrite(r):
+			m := &seqMessage{ from: who, to: peer(who), r: r }
+			sent[fmt.Sprintf("%s/%d", who, r.SeqNo)] = m
+			items = append(items, &seqItem{ msg: m })
+		case r.Event == dccp.EventDrop && r.Type != "":
+			// The pipe labels drops with the name of the writing end; endpoints drop incoming packets
+			from := peer(who)
+			if !isEndpoint[who] && len(r.Labels) > 1 {
+				from = r.Labels[1]
+			}
+			if m, ok := sent[fmt.Sprintf("%s/%d", from, r.SeqNo)]; ok && m.dropped == "" {
+				m.dropped = r.Comment
+			}
+		}
+	}
+
+	var err error
+	switch format {
+	case SeqDiagMermaid:
+		err = writeMermaid(w, endpoints, items)
+	case SeqDiagPlantUML:
+		err = writePlantUML(w, endpoints, items)
+	default:
+		err = dccp.ErrInvalid
+	}
+	return err
+}
+
+// isPacketWrite returns true if r records a packet written by an endpoint onto its link
+func isPacketWrite(r *dccp.Trace) bool {
+	return r.Event == dccp.EventWrite && r.Type != "" && len(r.Labels) == 1 && r.Comment != "Write before drop"
+}
+
+func (m *seqMessage) text() string {
+	s := fmt.Sprintf("%s seq=%d", m.r.Type, m.r.SeqNo)
+	if m.r.Type != "Request" && m.r.Type != "Data" {
+		s += fmt.Sprintf(" ack=%d", m.r.AckNo)
+	}
+	if len(m.r.Options) > 0 {
+		s += " [" + strings.Join(m.r.Options, ",") + "]"
+	}
+	if m.dropped != "" {
+		s += " — dropped: " + m.dropped
+	}
+	return s
+}
+
+func writeMermaid(w io.Writer, endpoints []string, items []*seqItem) error {
+	lines := []string{"sequenceDiagram"}
+	for _, e := range endpoints {
+		lines = append(lines, "    participant " + e)
+	}
+	for _, it := range items {
+		if it.msg == nil {
+			lines = append(lines, fmt.Sprintf("    Note over %s: %s", it.who, it.state))
+			continue
+		}
+		arrow := "->>"
+		if it.msg.dropped != "" {
+			arrow = "-x"
+		}
+		lines = append(lines, fmt.Sprintf("    %s%s%s: %s", it.msg.from, arrow, it.msg.to, it.msg.text()))
+	}
+	_, err := io.WriteString(w, strings.Join(lines, "\n") + "\n")
+	return err
+}
+
+func writePlantUML(w io.Writer, endpoints []string, items []*seqItem) error {
+	lines := []string{"@startuml"}
+	for _, e := range endpoints {
+		lines = append(lines, "participant " + e)
+	}
+	for _, it := range items {
+		if it.msg == nil {
+			lines = append(lines, fmt.Sprintf("hnote over %s : %s", it.who, it.state))
+			continue
+		}
+		arrow := "->"
+		if it.msg.dropped != "" {
+			arrow = "->x"
+		}
+		lines = append(lines, fmt.Sprintf("%s %s %s : %s", it.msg.from, arrow, it.msg.to, it.msg.text()))
+	}
+	lines = append(lines, "@enduml")
+	_, err := io.WriteString(w, strings.Join(lines, "\n") + "\n")
+	return err
+}
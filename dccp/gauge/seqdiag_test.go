@@ -0,0 +1,60 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package gauge
+
+import (
+	"bytes"
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// seqTraces is a handshake whose final Ack is lost by the pipe, given out of order
+var seqTraces = []*dccp.Trace{
+	{ Time: 3, Labels: []string{"client"}, State: "OPEN", Event: dccp.EventWrite, Type: "Ack", SeqNo: 11, AckNo: 20 },
+	{ Time: 1, Labels: []string{"client"}, State: "REQUEST", Event: dccp.EventWrite, Type: "Request", SeqNo: 10 },
+	{ Time: 2, Labels: []string{"server"}, State: "RESPOND", Event: dccp.EventWrite, Type: "Response", SeqNo: 20, AckNo: 10,
+		Options: []string{"Timestamp"} },
+	{ Time: 4, Labels: []string{"line", "client"}, Event: dccp.EventDrop, Type: "Ack", SeqNo: 11, Comment: "Loss" },
+}
+
+func TestSequenceDiagram(t *testing.T) {
+	for _, x := range []struct {
+		format int
+		want   string
+	}{
+		{ SeqDiagMermaid, `sequenceDiagram
+    participant client
+    participant server
+    Note over client: REQUEST
+    client->>server: Request seq=10
+    Note over server: RESPOND
+    server->>client: Response seq=20 ack=10 [Timestamp]
+    Note over client: OPEN
+    client-xserver: Ack seq=11 ack=20 — dropped: Loss
+` },
+		{ SeqDiagPlantUML, `@startuml
+participant client
+participant server
+hnote over client : REQUEST
+client -> server : Request seq=10
+hnote over server : RESPOND
+server -> client : Response seq=20 ack=10 [Timestamp]
+hnote over client : OPEN
+client ->x server : Ack seq=11 ack=20 — dropped: Loss
+@enduml
+` },
+	} {
+		var w bytes.Buffer
+		if err := WriteSequenceDiagram(&w, seqTraces, x.format); err != nil {
+			t.Fatalf("format %d (%s)", x.format, err)
+		}
+		if w.String() != x.want {
+			t.Errorf("format %d:\n%s\nexpecting:\n%s", x.format, w.String(), x.want)
+		}
+	}
+	if WriteSequenceDiagram(&bytes.Buffer{}, seqTraces, -1) != dccp.ErrInvalid {
+		t.Errorf("unknown format accepted")
+	}
+}
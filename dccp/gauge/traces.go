@@ -0,0 +1,53 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package gauge
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// ReadTraces decodes a log file into a slice of traces. Both the JSON format, written by
+// dccp.FileTraceWriter and dccp.JSONTraceWriter, and the binary format, written by
+// dccp.BinaryTraceWriter, are recognized. If decoding stops before the end of the log, the
+// traces decoded so far are returned along with the error.
+func ReadTraces(r io.Reader) ([]*dccp.Trace, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(len(dccp.BinaryTraceMagic)); string(magic) == dccp.BinaryTraceMagic {
+		return readBinaryTraces(br)
+	}
+	dec := json.NewDecoder(br)
+	var traces []*dccp.Trace
+	for {
+		rec := &dccp.Trace{}
+		if err := dec.Decode(rec); err != nil {
+			if err == io.EOF {
+				return traces, nil
+			}
+			return traces, err
+		}
+		traces = append(traces, rec)
+	}
+}
+
+func readBinaryTraces(r io.Reader) ([]*dccp.Trace, error) {
+	br, err := dccp.NewBinaryTraceReader(r)
+	if err != nil {
+		return nil, err
+	}
+	var traces []*dccp.Trace
+	for {
+		rec, err := br.Read()
+		if err != nil {
+			if err == io.EOF {
+				return traces, nil
+			}
+			return traces, err
+		}
+		traces = append(traces, rec)
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package gauge
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"github.com/petar/GoDCCP/dccp"
+	"github.com/petar/GoDCCP/dccp/ccid3"
+)
+
+// vizPanel is a plot of one or more series that share a unit
+type vizPanel struct {
+	Title  string       `json:"title"`
+	Unit   string       `json:"unit"`
+	Series []*vizSeries `json:"series"`
+}
+
+// vizSeries is a series of samples of one connection. Points are pairs of time, in
+// milliseconds, and value.
+type vizSeries struct {
+	Name   string       `json:"name"`
+	Points [][2]float64 `json:"points"`
+}
+
+// vizPanels lists the panels of the congestion control plots, and the sample series that they
+// are drawn from. Samples of other series are drawn on additional panels, one per unit.
+var vizPanels = []struct {
+	title  string
+	series []string
+}{
+	{"Sending rate", []string{ccid3.XSample, ccid3.XRecvSample}},
+	{"Round-trip time", []string{ccid3.RoundtripElapsedSample, ccid3.RoundtripReportSample}},
+	{"Loss event rate", []string{ccid3.LossReceiverEstimateSample}},
+	{"Loss intervals", []string{ccid3.LossIntervalSample}},
+	{"Write queue occupancy", []string{dccp.WriteQueueSample}},
+}
+
+// WriteCongestionPlots renders the samples embedded in the traces of a run as an HTML page of
+// interactive plots over time: the allowed sending rate X and the receive rate X_recv, the
+// round-trip time, the loss event rate, the lengths of loss intervals and the occupancy of the
+// write queue. Each connection, identified by the first label of a trace, contributes its own
+// series to each plot. The page is self-contained. Dragging across a plot zooms all plots to
+// the same time range, double-clicking resets the zoom, and clicking a legend entry hides or
+// shows its series.
+func WriteCongestionPlots(w io.Writer, traces []*dccp.Trace) error {
+	sorted := make([]*dccp.Trace, len(traces))
+	copy(sorted, traces)
+	sort.Stable(TraceChrono(sorted))
+
+	var panels []*vizPanel
+	panelOf := make(map[string]*vizPanel) // Sample series or unit —> panel
+	for _, p := range vizPanels {
+		panel := &vizPanel{ Title: p.title }
+		panels = append(panels, panel)
+		for _, s := range p.series {
+			panelOf[s] = panel
+		}
+	}
+	seriesOf := make(map[string]*vizSeries) // Connection and sample series —> series
+	for _, r := range sorted {
+		sample, ok := traceSample(r)
+		if !ok {
+			continue
+		}
+		panel := panelOf[sample.Series]
+		if panel == nil {
+			if panel = panelOf["unit "+sample.Unit]; panel == nil {
+				panel = &vizPanel{ Title: "Other samples (" + sample.Unit + ")" }
+				panels = append(panels, panel)
+				panelOf["unit "+sample.Unit] = panel
+			}
+		}
+		panel.Unit = sample.Unit
+		name := sample.Series
+		if len(r.Labels) > 0 {
+			name = r.Labels[0] + " " + name
+		}
+		series := seriesOf[name]
+		if series == nil {
+			series = &vizSeries{ Name: name }
+			seriesOf[name] = series
+			panel.Series = append(panel.Series, series)
+		}
+		series.Points = append(series.Points, [2]float64{float64(r.Time) / 1e6, sample.Value})
+	}
+
+	var nonEmpty []*vizPanel
+	for _, p := range panels {
+		if len(p.Series) > 0 {
+			nonEmpty = append(nonEmpty, p)
+		}
+	}
+	data, err := json.Marshal(nonEmpty)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, vizPage, data)
+	return err
+}
+
+// traceSample returns the sample attached to r. Traces decoded from a log file hold their
+// arguments as generic JSON values, rather than as dccp.Sample.
+func traceSample(r *dccp.Trace) (dccp.Sample, bool) {
+	switch a := r.Args[dccp.SampleType].(type) {
+	case dccp.Sample:
+		return a, true
+	case map[string]interface{}:
+		series, _ := a["Series"].(string)
+		value, ok := a["Value"].(float64)
+		unit, _ := a["Unit"].(string)
+		return dccp.Sample{ Series: series, Value: value, Unit: unit }, ok && series != ""
+	}
+	return dccp.Sample{}, false
+}
+
+// vizPage is the HTML page of WriteCongestionPlots, which takes the JSON encoding of the
+// panels as its only argument
+const vizPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>DCCP congestion control</title>
+<style>
+body { font: 13px sans-serif; margin: 20px; }
+h2 { font-size: 15px; margin: 18px 0 4px 0; }
+canvas { border: 1px solid #ccc; cursor: crosshair; }
+.legend span { margin-right: 14px; cursor: pointer; }
+.legend span.off { opacity: 0.3; }
+.readout { color: #555; height: 16px; }
+</style>
+</head>
+<body>
+<div id="plots"></div>
+<script>
+var panels = %s;
+var colors = ["#1f77b4", "#d62728", "#2ca02c", "#ff7f0e", "#9467bd", "#8c564b", "#e377c2", "#17becf"];
+var W = 1000, H = 220, M = 60;
+var full = [Infinity, -Infinity], view;
+panels.forEach(function(p) {
+	p.series.forEach(function(s) {
+		s.points.forEach(function(q) {
+			full[0] = Math.min(full[0], q[0]);
+			full[1] = Math.max(full[1], q[0]);
+		});
+	});
+});
+if (full[0] == full[1]) { full[1] = full[0] + 1; }
+view = full.slice();
+
+function fmt(v) {
+	var a = Math.abs(v);
+	if (a >= 1e6) { return (v / 1e6).toPrecision(3) + "M"; }
+	if (a >= 1e3) { return (v / 1e3).toPrecision(3) + "k"; }
+	return v.toPrecision(3);
+}
+
+function draw(p) {
+	var ctx = p.canvas.getContext("2d"), lo = Infinity, hi = -Infinity;
+	p.series.forEach(function(s) {
+		if (s.off) { return; }
+		s.points.forEach(function(q) {
+			if (q[0] >= view[0] && q[0] <= view[1]) {
+				lo = Math.min(lo, q[1]);
+				hi = Math.max(hi, q[1]);
+			}
+		});
+	});
+	if (lo == Infinity) { lo = 0; hi = 1; }
+	lo = Math.min(lo, 0);
+	if (hi == lo) { hi = lo + 1; }
+	p.x = function(t) { return M + (t - view[0]) / (view[1] - view[0]) * (W - 2 * M); };
+	p.y = function(v) { return H - 20 - (v - lo) / (hi - lo) * (H - 30); };
+	ctx.clearRect(0, 0, W, H);
+	ctx.fillStyle = "#555";
+	ctx.strokeStyle = "#eee";
+	for (var i = 0; i <= 4; i++) {
+		var v = lo + (hi - lo) * i / 4, t = view[0] + (view[1] - view[0]) * i / 4;
+		ctx.beginPath(); ctx.moveTo(M, p.y(v)); ctx.lineTo(W - M, p.y(v)); ctx.stroke();
+		ctx.fillText(fmt(v), 4, p.y(v) + 4);
+		ctx.fillText(fmt(t / 1e3) + "s", p.x(t) - 12, H - 4);
+	}
+	p.series.forEach(function(s, i) {
+		if (s.off) { return; }
+		ctx.strokeStyle = colors[i %% colors.length];
+		ctx.beginPath();
+		s.points.forEach(function(q, j) {
+			if (j == 0) { ctx.moveTo(p.x(q[0]), p.y(q[1])); } else { ctx.lineTo(p.x(q[0]), p.y(q[1])); }
+		});
+		ctx.save();
+		ctx.rect(M, 0, W - 2 * M, H);
+		ctx.clip();
+		ctx.stroke();
+		ctx.restore();
+	});
+	if (p.drag) {
+		ctx.fillStyle = "rgba(0,0,0,0.1)";
+		ctx.fillRect(Math.min(p.drag[0], p.drag[1]), 0, Math.abs(p.drag[1] - p.drag[0]), H - 20);
+	}
+}
+
+function drawAll() { panels.forEach(draw); }
+
+function timeAt(p, px) { return view[0] + (px - M) / (W - 2 * M) * (view[1] - view[0]); }
+
+// readout lists the latest value of each series at time t
+function readout(p, t) {
+	var parts = ["t=" + (t / 1e3).toFixed(3) + "s"];
+	p.series.forEach(function(s) {
+		var last = null;
+		s.points.forEach(function(q) { if (q[0] <= t) { last = q; } });
+		if (last != null && !s.off) { parts.push(s.name + "=" + fmt(last[1]) + " " + p.unit); }
+	});
+	return parts.join("   ");
+}
+
+panels.forEach(function(p) {
+	var div = document.createElement("div");
+	div.innerHTML = "<h2></h2><div class=legend></div><div class=readout></div>";
+	div.firstChild.textContent = p.title + " (" + p.unit + ")";
+	var legend = div.childNodes[1], info = div.childNodes[2];
+	p.series.forEach(function(s, i) {
+		var span = document.createElement("span");
+		span.textContent = "■ " + s.name;
+		span.style.color = colors[i %% colors.length];
+		span.onclick = function() { s.off = !s.off; span.className = s.off ? "off" : ""; draw(p); };
+		legend.appendChild(span);
+	});
+	p.canvas = document.createElement("canvas");
+	p.canvas.width = W;
+	p.canvas.height = H;
+	div.appendChild(p.canvas);
+	document.getElementById("plots").appendChild(div);
+	p.canvas.onmousedown = function(e) { p.drag = [e.offsetX, e.offsetX]; };
+	p.canvas.onmousemove = function(e) {
+		info.textContent = readout(p, timeAt(p, e.offsetX));
+		if (p.drag) { p.drag[1] = e.offsetX; draw(p); }
+	};
+	p.canvas.onmouseup = function() {
+		var d = p.drag;
+		p.drag = null;
+		if (d && Math.abs(d[1] - d[0]) > 3) {
+			view = [timeAt(p, Math.min(d[0], d[1])), timeAt(p, Math.max(d[0], d[1]))];
+		}
+		drawAll();
+	};
+	p.canvas.ondblclick = function() { view = full.slice(); drawAll(); };
+});
+drawAll();
+</script>
+</body>
+</html>
+`
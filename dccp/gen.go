@@ -32,10 +32,13 @@ func (c *Conn) generateReset(resetCode byte) *writeHeader {
 	return h
 }
 
-func (c *Conn) generateSync() *writeHeader {
+// generateSync creates a Sync that acknowledges ackNo, rather than S.GSR at the time of
+// writing, since Section 8.5, Steps 6 and 7, acknowledge the packet that caused the Sync
+func (c *Conn) generateSync(ackNo int64) *writeHeader {
 	h := &writeHeader{}
 	h.Header.InitSyncHeader()
-	h.SeqAckType = seqAckNormal
+	h.Header.AckNo = ackNo
+	h.SeqAckType = seqAckSync
 	return h
 }
 
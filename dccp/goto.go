@@ -30,13 +30,12 @@ const (
 func (c *Conn) gotoLISTEN() {
 	c.AssertLocked()
 	c.socket.SetServer(true)
-	c.socket.SetState(LISTEN)
+	c.amplify.unverified = true
+	c.setState(LISTEN)
 	c.emitSetState()
 	c.env.Expire(
 		func()bool {
-			c.Lock()
-			state := c.socket.GetState()
-			c.Unlock()
+			state := c.loadState()
 			// If we've transitioned away from LISTEN, we are in good shape
 			return state != LISTEN
 		}, 
@@ -49,21 +48,36 @@ func (c *Conn) gotoLISTEN() {
 
 func (c *Conn) gotoRESPOND(hServiceCode uint32, hSeqNo int64) {
 	c.AssertLocked()
-	c.socket.SetState(RESPOND)
+	c.setState(RESPOND)
 	c.emitSetState()
-	iss := c.socket.ChooseISS()
+	iss := c.socket.ChooseISS(c.env, c.hc.LocalLabel(), c.hc.RemoteLabel())
 	c.socket.SetGAR(iss)
 	c.socket.SetISR(hSeqNo)
 	c.socket.SetGSR(hSeqNo)
 	// TODO: To be more prudent, set service code only if it is currently 0,
 	// otherwise check that h.ServiceCode matches socket service code
 	c.socket.SetServiceCode(hServiceCode)
+	c.requireAckVector()
+	c.expireRESPOND()
+}
+
+// gotoRESPONDFromREQUEST turns a client, whose Request has crossed the Request of its peer,
+// into the server of the connection. The client keeps its ISS, so that the packets it has
+// already sent remain in its sequence space.
+func (c *Conn) gotoRESPONDFromREQUEST(hSeqNo int64) {
+	c.AssertLocked()
+	c.socket.SetServer(true)
+	c.setState(RESPOND)
+	c.emitSetState()
+	c.socket.SetISR(hSeqNo)
+	c.socket.SetGSR(hSeqNo)
+	c.expireRESPOND()
+}
 
+func (c *Conn) expireRESPOND() {
 	c.env.Expire(
 		func()bool {
-			c.Lock()
-			state := c.socket.GetState()
-			c.Unlock()
+			state := c.loadState()
 			return state != RESPOND
 		}, 
 		func() {
@@ -75,34 +89,32 @@ func (c *Conn) gotoRESPOND(hServiceCode uint32, hSeqNo int64) {
 func (c *Conn) gotoREQUEST(serviceCode uint32) {
 	c.AssertLocked()
 	c.socket.SetServer(false)
-	c.socket.SetState(REQUEST)
+	c.setState(REQUEST)
 	c.emitSetState()
 	c.socket.SetServiceCode(serviceCode)
-	iss := c.socket.ChooseISS()
+	iss := c.socket.ChooseISS(c.env, c.hc.LocalLabel(), c.hc.RemoteLabel())
 	c.socket.SetGAR(iss)
+	c.negotiateCCID()
+	c.requireAckVector()
 	c.inject(c.generateRequest(serviceCode))
 
 	// Resend Request using exponential backoff, if no response
-	c.env.Go(func() {
-		b := newBackOff(c.env, REQUEST_BACKOFF_FIRST, REQUEST_BACKOFF_TIMEOUT, REQUEST_BACKOFF_FREQ)
-		for {
-			err, _ := b.Sleep()
-			c.Lock()
-			state := c.socket.GetState()
-			c.Unlock()
-			if state != REQUEST {
-				break
-			}
-			// If the back-off timer has reached maximum wait, quit trying
-			if err != nil {
-				c.abort()
-				break
-			}
-			c.Lock()
-			c.amb.E(EventTurn, "Request resend")
-			c.inject(c.generateRequest(serviceCode))
-			c.Unlock()
+	b := newBackOff(c.env, REQUEST_BACKOFF_FIRST, REQUEST_BACKOFF_TIMEOUT, REQUEST_BACKOFF_FREQ)
+	b.Go(func(err error, _ int64) bool {
+		state := c.loadState()
+		if state != REQUEST {
+			return false
+		}
+		// If the back-off timer has reached maximum wait, quit trying
+		if err != nil {
+			c.abort()
+			return false
 		}
+		c.Lock()
+		c.amb.E(EventTurn, "Request resend")
+		c.inject(c.generateRequest(serviceCode))
+		c.Unlock()
+		return true
 	}, "gotoREQUEST")
 }
 
@@ -111,8 +123,14 @@ func (c *Conn) openCCID() {
 	if c.ccidOpen {
 		return
 	}
-	c.scc.Open()
-	c.rcc.Open()
+	if !c.writeClosed {
+		c.scc().Open()
+	}
+	if !c.isReadClosed() {
+		c.rcc().Open()
+		c.syncAckRatio()
+		c.syncSendAckVector()
+	}
 	c.ccidOpen = true
 	c.amb.E(EventMatch, "CCID open")
 }
@@ -122,49 +140,46 @@ func (c *Conn) closeCCID() {
 	if !c.ccidOpen {
 		return
 	}
-	c.scc.Close()
-	c.rcc.Close()
+	c.scc().Close()
+	c.rcc().Close()
 	c.ccidOpen = false
 	c.amb.E(EventMatch, "CCID close")
 }
 
 func (c *Conn) gotoPARTOPEN() {
 	c.AssertLocked()
-	c.socket.SetState(PARTOPEN)
+	c.setState(PARTOPEN)
 	c.emitSetState()
 	c.openCCID()
 	c.inject(nil) // Unblocks the writeLoop select, so it can see the state change
 
 	// Start PARTOPEN timer, according to Section 8.1.5
-	c.env.Go(func() {
-		b := newBackOff(c.env, PARTOPEN_BACKOFF_FIRST, PARTOPEN_BACKOFF_TIMEOUT, PARTOPEN_BACKOFF_FREQ)
-		c.amb.E(EventInfo, "PARTOPEN backoff start")
-		for {
-			err, btm := b.Sleep()
-			c.Lock()
-			state := c.socket.GetState()
-			c.Unlock()
-			if state != PARTOPEN {
-				c.amb.E(EventInfo, "PARTOPEN backoff EXIT via state change")
-				break
-			}
-			// If the back-off timer has reached maximum wait. End the connection.
-			if err != nil {
-				c.abort()
-				break
-			}
-			c.amb.E(EventInfo, fmt.Sprintf("PARTOPEN backoff %d", btm))
-			c.Lock()
-			c.inject(c.generateAck())
-			c.Unlock()
+	b := newBackOff(c.env, PARTOPEN_BACKOFF_FIRST, PARTOPEN_BACKOFF_TIMEOUT, PARTOPEN_BACKOFF_FREQ)
+	c.amb.E(EventInfo, "PARTOPEN backoff start")
+	b.Go(func(err error, btm int64) bool {
+		state := c.loadState()
+		if state != PARTOPEN {
+			c.amb.E(EventInfo, "PARTOPEN backoff EXIT via state change")
+			return false
+		}
+		// If the back-off timer has reached maximum wait. End the connection.
+		if err != nil {
+			c.abort()
+			return false
 		}
+		c.amb.E(EventInfo, fmt.Sprintf("PARTOPEN backoff %d", btm))
+		c.Lock()
+		c.inject(c.generateAck())
+		c.Unlock()
+		return true
 	}, "gotoPARTOPEN")
 }
 
 func (c *Conn) gotoOPEN(hSeqNo int64) {
 	c.AssertLocked()
 	c.socket.SetOSR(hSeqNo)
-	c.socket.SetState(OPEN)
+	c.amplify.unverified = false
+	c.setState(OPEN)
 	c.emitSetState()
 	c.openCCID()
 	c.inject(nil) // Unblocks the writeLoop select, so it can see the state change
@@ -174,48 +189,45 @@ func (c *Conn) gotoTIMEWAIT() {
 	c.AssertLocked()
 	c.setError(ErrEOF)
 	c.teardownUser()
-	c.socket.SetState(TIMEWAIT)
+	c.setState(TIMEWAIT)
 	c.emitSetState()
 	c.closeCCID()
 
-	c.env.Go(func() {
-		c.env.Sleep(TIMEWAIT_TIMEOUT)
-		c.abortQuietly()
-	}, "gotoTIMEWAIT")
+	timeout := int64(TIMEWAIT_TIMEOUT)
+	if c.env.StrictRFC() {
+		timeout = 2*MSL
+	} else {
+		c.env.Deviate(c.amb, devTIMEWAIT)
+	}
+	c.timewait = c.env.AfterFunc(timeout, c.abortQuietly, "gotoTIMEWAIT")
 }
 
 func (c *Conn) gotoCLOSING() {
 	c.AssertLocked()
 	c.setError(ErrEOF)
 	c.teardownUser()
-	c.socket.SetState(CLOSING)
+	c.setState(CLOSING)
 	c.emitSetState()
 	c.closeCCID()
-	c.env.Go(func() {
-		c.Lock()
-		rtt := c.socket.GetRTT()
-		c.Unlock()
-		c.amb.E(EventInfo, fmt.Sprintf("CLOSING RTT=%dns", rtt))
-		b := newBackOff(c.env, 2*rtt, CLOSING_BACKOFF_TIMEOUT, CLOSING_BACKOFF_FREQ)
-		for {
-			err, _ := b.Sleep()
-			c.Lock()
-			state := c.socket.GetState()
-			c.Unlock()
-			if state != CLOSING {
-				break
-			}
-			if err != nil {
-				c.Lock()
-				c.gotoTIMEWAIT()
-				c.Unlock()
-				break
-			}
-			c.amb.E(EventInfo, "Resend Close")
+	rtt := c.loadRTT()
+	c.amb.E(EventInfo, fmt.Sprintf("CLOSING RTT=%dns", rtt))
+	b := newBackOff(c.env, 2*rtt, CLOSING_BACKOFF_TIMEOUT, CLOSING_BACKOFF_FREQ)
+	b.Go(func(err error, _ int64) bool {
+		state := c.loadState()
+		if state != CLOSING {
+			return false
+		}
+		if err != nil {
 			c.Lock()
-			c.inject(c.generateClose())
+			c.gotoTIMEWAIT()
 			c.Unlock()
+			return false
 		}
+		c.amb.E(EventInfo, "Resend Close")
+		c.Lock()
+		c.inject(c.generateClose())
+		c.Unlock()
+		return true
 	}, "gotoCLOSING")
 }
 
@@ -223,9 +235,15 @@ func (c *Conn) gotoCLOSING() {
 func (c *Conn) gotoCLOSED() {
 	c.AssertLocked()
 	c.emitSetState()
-	c.socket.SetState(CLOSED)
+	c.setState(CLOSED)
+	c.expSetState(CLOSED)
+	c.liveRemove()
 	c.setError(ErrAbort)
 	c.teardownUser()
 	c.teardownWriteLoop()
 	c.closeCCID()
+	if c.timewait != nil {
+		c.timewait.Stop()
+		c.timewait = nil
+	}
 }
@@ -0,0 +1,110 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+// Section 7.5.4: Syncs sent in response to sequence-invalid packets, and Resets sent in
+// response to packets that do not belong to the connection, are rate limited. Otherwise an
+// attacker could use a connection to reflect a flood of packets towards its peer.
+const (
+	SyncRateLimit  = 8 // Maximum number of Syncs sent in response to received packets, per second
+	ResetRateLimit = 8 // Maximum number of Resets sent in response to received packets, per second
+	ReplyBurst     = 2 // Number of such Syncs or Resets that may be sent back to back
+
+	// ResetChainLimit is the number of consecutive Resets that are answered with a Sync. Two
+	// confused endpoints, each of which considers the other's Resets invalid, would otherwise
+	// keep exchanging Resets and Syncs at the rate limit. The count restarts whenever a valid
+	// packet other than a Reset arrives.
+	ResetChainLimit = 3
+)
+
+// replyLimit admits reply packets at a limited average rate, allowing bursts of up to
+// ReplyBurst packets. It is guarded by the Conn Mutex.
+type replyLimit struct {
+	next int64 // Time when the next reply would be admitted, if no burst were allowed
+}
+
+// admit returns true if another reply can be sent at time now, given a limit of perSecond
+// replies per second
+func (l *replyLimit) admit(now, perSecond int64) bool {
+	interval := 1e9 / perSecond
+	if l.next < now {
+		l.next = now
+	}
+	if l.next-now > (ReplyBurst-1)*interval {
+		return false
+	}
+	l.next += interval
+	return true
+}
+
+// ConnStats holds counters of the packets that a connection has rejected as suspect or
+// duplicate, or has declined to send due to rate limiting
+type ConnStats struct {
+	SuspectResets  int64 // Resets ignored, because their sequence number was not the next one expected
+	SuspectPackets int64 // Other packets ignored, because they acknowledge sequence numbers that were never sent
+	SyncsLimited   int64 // Reply Syncs not sent due to SyncRateLimit
+	ResetsLimited  int64 // Reply Resets not sent due to ResetRateLimit
+	AmplifyLimited int64 // Packets not sent to an unverified client due to AmplificationFactor
+	ResetStorms    int64 // Replies to Resets not sent due to ResetChainLimit
+	Violations     int64 // Received packets that violate the protocol; see SetViolationPolicy
+	Duplicates     int64 // Received packets dropped as copies of packets received before
+}
+
+// Stats returns the suspected off-path injection attempts, duplicates and rate-limited replies
+// seen so far
+func (c *Conn) Stats() ConnStats {
+	c.Lock()
+	defer c.Unlock()
+	return c.stats
+}
+
+// injectReply is like inject, but it is used for Syncs and Resets that are sent in response
+// to the received packet to, and it drops them when they exceed their rate limit. Section
+// 8.5: The only reply to a Reset is a Sync, sent when the Reset's sequence numbers are
+// invalid. No Reset is ever sent in response to a Reset.
+func (c *Conn) injectReply(h *writeHeader, to *Header) {
+	c.AssertLocked()
+	if to.Type == Reset {
+		if h.Type != Sync {
+			c.amb.E(EventDrop, "Reply to Reset", &h.Header)
+			return
+		}
+		if c.resetChain >= ResetChainLimit {
+			c.stats.ResetStorms++
+			c.amb.E(EventDrop, "Reset storm", &h.Header)
+			return
+		}
+		c.resetChain++
+	}
+	now := c.env.Now()
+	switch h.Type {
+	case Sync:
+		if !c.syncLimit.admit(now, SyncRateLimit) {
+			c.stats.SyncsLimited++
+			c.amb.E(EventDrop, "Sync rate limit", &h.Header)
+			return
+		}
+	case Reset:
+		if !c.resetLimit.admit(now, ResetRateLimit) {
+			c.stats.ResetsLimited++
+			c.amb.E(EventDrop, "Reset rate limit", &h.Header)
+			return
+		}
+	}
+	c.inject(h)
+}
+
+// suspectInjection records that h looks like it was injected by an off-path attacker, who
+// can only guess the sequence numbers of the connection
+func (c *Conn) suspectInjection(h *Header, reason string) {
+	c.AssertLocked()
+	if h.Type == Reset {
+		c.stats.SuspectResets++
+	} else {
+		c.stats.SuspectPackets++
+	}
+	expStats.Add("injections", 1)
+	c.amb.E(EventWarn, "Suspected injection: "+reason, h)
+}
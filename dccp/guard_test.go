@@ -0,0 +1,33 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"testing"
+)
+
+func TestReplyLimit(t *testing.T) {
+	var l replyLimit
+	now := int64(5e9)
+	for i := 0; i < ReplyBurst; i++ {
+		if !l.admit(now, SyncRateLimit) {
+			t.Fatalf("reply %d of burst not admitted", i)
+		}
+	}
+	if l.admit(now, SyncRateLimit) {
+		t.Fatalf("reply beyond burst admitted")
+	}
+	// Over a long period, the admitted replies approach the rate limit
+	admitted := 0
+	for i := 0; i < 10000; i++ {
+		now += 1e6
+		if l.admit(now, SyncRateLimit) {
+			admitted++
+		}
+	}
+	if admitted < 10*SyncRateLimit-1 || admitted > 10*SyncRateLimit+ReplyBurst {
+		t.Errorf("admitted %d replies in 10 sec, want about %d", admitted, 10*SyncRateLimit)
+	}
+}
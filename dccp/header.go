@@ -4,9 +4,8 @@
 
 package dccp
 
-// We use a subset of DCCP, defined as follows:
-//	X=1
-//      allowShortSeqNoFeature=0
+// Short sequence numbers, X=0, are sent and accepted only as the Allow Short Seqnos
+// feature permits, Section 7.6.1
 
 // Any DCCP header has a subset of the following subheaders, in this order:
 // (1a) Generic header
@@ -27,10 +26,66 @@ type Header struct {
 	ServiceCode uint32    // ServiceCode: Applicaton level service (in Req,Resp pkts)
 	ResetCode   byte      // ResetCode: Reason for reset (in Reset pkts)
 	ResetData   []byte    // ResetData: Additional reset info (in Reset pkts)
-	Options     []*Option // Used for feature negotiation, padding, mandatory flags
+	Options     []Option  // Used for feature negotiation, padding, mandatory flags
+	Padding     int       // Number of Padding options written after Options, Section 5.8.1; not set on read
 	Data        []byte    // Application data (in Req, Resp, Data, DataAck pkts) 
 	// Ignored (in Ack, Close, CloseReq, Sync, SyncAck pkts)
 	// Error text (in Reset pkts)
+
+	ECN         byte      // ECN codepoint of the IP header that carried the packet, if reported by the link; not part of the DCCP header
+	ReadTime    int64     // Time when the packet was received, set by the link if it can tell, otherwise by the Conn as soon as the link returns it; not part of the DCCP header
+
+	rawOptions      []byte // Wire-format options of a received header, parsed lazily by GetOptions
+	optionFault     byte   // First fault found in rawOptions by ReadHeader
+	optionFaultType byte   // Type of the option at fault
+}
+
+// GetOptions returns the options of gh. The options of headers decoded by ReadHeader are
+// parsed into gh.Options on the first call.
+func (gh *Header) GetOptions() []Option {
+	if gh.Options == nil && len(gh.rawOptions) > 0 {
+		r := optionReader{buf: gh.rawOptions, typ: gh.Type}
+		var o Option
+		for r.next(&o) {
+			gh.Options = append(gh.Options, o)
+		}
+	}
+	return gh.Options
+}
+
+// Copy returns a copy of gh, with copies of its options and data, which the caller owns
+func (gh *Header) Copy() *Header {
+	h := *gh
+	h.ResetData = append([]byte(nil), gh.ResetData...)
+	h.Data = append([]byte(nil), gh.Data...)
+	h.Options = nil
+	for _, o := range gh.GetOptions() {
+		h.Options = append(h.Options, Option{ Type: o.Type, Data: append([]byte(nil), o.Data...), Mandatory: o.Mandatory })
+	}
+	h.rawOptions = nil
+	return &h
+}
+
+// appendOptions appends to dst the options of gh whose type satisfies accept. Options that have
+// not been parsed yet are decoded straight into dst, so once dst has reached its working size,
+// appendOptions does not allocate.
+func (gh *Header) appendOptions(dst []Option, accept func(byte) bool) []Option {
+	if gh.Options != nil || len(gh.rawOptions) == 0 {
+		for _, o := range gh.Options {
+			if accept(o.Type) {
+				dst = append(dst, o)
+			}
+		}
+		return dst
+	}
+	r := optionReader{buf: gh.rawOptions, typ: gh.Type}
+	var o Option
+	for r.next(&o) {
+		if accept(o.Type) {
+			dst = append(dst, o)
+		}
+	}
+	return dst
 }
 
 const (
@@ -0,0 +1,81 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+// Packet hooks let the application watch every packet that a Conn sends or receives, for
+// monitoring, capture or policy enforcement, without changes to the read and write loops.
+// Hooks run synchronously in the loop that handles the packet, without the Conn lock, so they
+// may call methods of the Conn, such as Abort, but they hold up the connection while they run.
+// The received packets of Conns over a Mux are handled on the read loop of the Mux, with its
+// processLk held, so there a hook that blocks holds up every connection of the Mux.
+
+// PacketHook is a function that is called with each packet that a Conn sends or receives
+type PacketHook func(p PacketView)
+
+// PacketView is a read-only view of the header of a packet, passed to packet hooks. It is only
+// valid for the duration of the call; Copy keeps the header for later.
+type PacketView struct {
+	h    *Header
+	Time int64 // Env time at which the packet was sent or received
+}
+
+func (p PacketView) Type() byte          { return p.h.Type }
+func (p PacketView) X() bool             { return p.h.X }
+func (p PacketView) SeqNo() int64        { return p.h.SeqNo }
+func (p PacketView) AckNo() int64        { return p.h.AckNo }
+func (p PacketView) CCVal() int8         { return p.h.CCVal }
+func (p PacketView) CsCov() byte         { return p.h.CsCov }
+func (p PacketView) ServiceCode() uint32 { return p.h.ServiceCode }
+func (p PacketView) ResetCode() byte     { return p.h.ResetCode }
+func (p PacketView) ECN() byte           { return p.h.ECN }
+func (p PacketView) DataLen() int        { return len(p.h.Data) }
+func (p PacketView) String() string      { return p.h.String() }
+
+// HasAckNo returns true if the packet carries an acknowledgement number
+func (p PacketView) HasAckNo() bool { return p.h.HasAckNo() }
+
+// Options returns copies of the options of the packet
+func (p PacketView) Options() []Option {
+	opts := p.h.GetOptions()
+	r := make([]Option, len(opts))
+	for i, o := range opts {
+		r[i] = Option{ Type: o.Type, Data: append([]byte(nil), o.Data...), Mandatory: o.Mandatory }
+	}
+	return r
+}
+
+// Copy returns a copy of the header of the packet, which the caller owns
+func (p PacketView) Copy() *Header { return p.h.Copy() }
+
+// OnPacketSent adds f to the hooks that are called with each packet the Conn sends, right
+// before it is written to the link
+func (c *Conn) OnPacketSent(f PacketHook) {
+	c.hooksLk.Lock()
+	defer c.hooksLk.Unlock()
+	c.sentHooks = append(c.sentHooks, f)
+}
+
+// OnPacketReceived adds f to the hooks that are called with each packet the Conn receives,
+// right after it is read from the link and before it is processed. f must not block, since
+// over a Mux it runs on the read loop that the Mux shares among its connections.
+func (c *Conn) OnPacketReceived(f PacketHook) {
+	c.hooksLk.Lock()
+	defer c.hooksLk.Unlock()
+	c.readHooks = append(c.readHooks, f)
+}
+
+// callHooks calls the hooks in *hooks with h
+func (c *Conn) callHooks(hooks *[]PacketHook, h *Header) {
+	c.hooksLk.Lock()
+	hh := *hooks
+	c.hooksLk.Unlock()
+	if len(hh) == 0 {
+		return
+	}
+	p := PacketView{ h: h, Time: c.env.Now() }
+	for _, f := range hh {
+		f(p)
+	}
+}
@@ -14,28 +14,20 @@ type writeHeader struct {
 	Header
 	SeqAckType   int
 	InResponseTo *Header
+	Meta         WriteMeta // Metadata of the application data carried by the packet, if any
 }
 
 // inject adds the packet h to the outgoing non-Data pipeline, without blocking.  The
 // pipeline is flushed continuously respecting the CongestionControl's rate-limiting policy.
 //
 // inject is called at most once (currently) from inside readLoop and inside a lock
-// on Conn, so it must not block, hence writeNonData has buffer space
+// on Conn, so it must not block, hence packets are dropped when the non-Data ring is full
 func (c *Conn) inject(h *writeHeader) {
-	c.writeNonDataLk.Lock()
-	defer c.writeNonDataLk.Unlock()
-
-	if c.writeNonData == nil {
-		return
-	}
-
 	// Catch outgoing non-Data packets for debug purposes here
 	// c.emitCatchSeqNo(h, 161019, 161020, 161021)
 
 	// Dropping a nil is OK, since it happens only if there are other packets in the queue
-	if len(c.writeNonData) < cap(c.writeNonData) {
-		c.writeNonData <- h
-	} else {
+	if c.writeQueue.pushNonData(h) == ErrDrop {
 		// This first emit is a workaround. The inspector does not recognize drop events,
 		// unless they have been preceeded by a write event.
 		// TODO: It may help to introduce an inject event to distinguish between write queue
@@ -45,25 +37,67 @@ func (c *Conn) inject(h *writeHeader) {
 	}
 }
 
-func (c *Conn) WriteCC(h *Header, timeWrite int64) {
+// WriteCC lets the CCIDs see h, which is about to be written at time timeWrite, and place their
+// options and CCVal on it. It returns the delay, if any, that the sender CCID asked for before
+// h is handed off to the network layer. WriteCC is called by the write loop only, since the
+// options are placed in a buffer of the Conn, which is reused for the next packet.
+func (c *Conn) WriteCC(h *Header, timeWrite int64) (delay int64) {
 	// HC-Sender CCID
-	ccval, sropts := c.scc.OnWrite(&PreHeader{Type: h.Type, X: h.X, SeqNo: h.SeqNo, AckNo: h.AckNo, TimeWrite: timeWrite})
-	if !validateCCIDSenderToReceiver(sropts) {
+	ph := &c.writePH
+	ph.reset()
+	ph.Type, ph.X, ph.SeqNo, ph.AckNo, ph.TimeWrite = h.Type, h.X, h.SeqNo, h.AckNo, timeWrite
+	h.CCVal = c.scc().OnWrite(ph)
+	nsr := len(ph.Options)
+	if !validateCCIDSenderToReceiver(ph.Options) {
 		panic("sender congestion control writes disallowed options")
 	}
-	h.CCVal = ccval
+	if ph.Delay > 0 {
+		delay = ph.Delay
+	}
 	// HC-Receiver CCID
-	rsopts := c.rcc.OnWrite(&PreHeader{Type: h.Type, X: h.X, SeqNo: h.SeqNo, AckNo: h.AckNo, TimeWrite: timeWrite})
-	if !validateCCIDReceiverToSender(rsopts) {
+	ph.Type, ph.X, ph.SeqNo, ph.AckNo, ph.TimeWrite, ph.Delay = h.Type, h.X, h.SeqNo, h.AckNo, timeWrite+delay, 0
+	c.rcc().OnWrite(ph)
+	if !validateCCIDReceiverToSender(ph.Options[nsr:]) {
 		panic("receiver congestion control writes disallowed options")
 	}
 	// TODO: Also check option compatibility with respect to packet type (Data vs. other)
-	h.Options = append(h.Options, append(sropts, rsopts...)...)
+	if len(ph.Options) > 0 {
+		h.Options = append(append(c.writeOpts[:0], h.Options...), ph.Options...)
+		c.writeOpts = h.Options
+	}
 	c.amb.E(EventInfo, fmt.Sprintf("CC placed %d options", len(h.Options)), h)
+	return delay
+}
+
+// strobe blocks until the sender CCID lets the next packet go. A CCID that is a Pacer is asked
+// for the time of the next packet until the time has come; any other decides in Strobe.
+func (c *Conn) strobe() {
+	scc := c.scc()
+	pacer, ok := scc.(Pacer)
+	if !ok {
+		scc.Strobe()
+		return
+	}
+	for {
+		now := c.env.Now()
+		next := pacer.NextSend(now)
+		if next <= now {
+			return
+		}
+		c.env.SleepUntil(next)
+	}
 }
 
 func (c *Conn) write(h *writeHeader) error {
-	c.scc.Strobe()
+	t0 := c.env.Now()
+	c.strobe()
+	if h.Type == Data || h.Type == DataAck {
+		c.addLatency(GateDelaySample, c.env.Now()-t0)
+	}
+	if h.Meta.Deadline != 0 && c.env.Now() > h.Meta.Deadline {
+		c.reportDrop(DropExpired, h.Data, h.Meta, h)
+		return nil
+	}
 
 	// Tell the CCID about h right before it gets sent, so we can fill in
 	// the nearly exact time of sending.  This way, the roundtrip
@@ -74,78 +108,74 @@ func (c *Conn) write(h *writeHeader) error {
 	// before the CCID gets to see it?
 	c.Lock()
 	c.WriteSeqAck(h)
-	c.WriteCC(&h.Header, c.writeTime.Now())
+	c.placeShortSeqNo(h)
+	c.placeInitCookie(h)
+	c.placeDataDropped(h)
+	c.placeSlowReceiver(h)
+	c.placeFeatures(h)
+	c.placeDataChecksum(h)
+	c.recordSent(h)
+	tos, mark := c.placeTrafficClass()
+	mandatory, padTo, unverified := c.mandatory, c.padTo, c.amplify.unverified
+	mps := int(c.socket.GetMPS())
 	c.Unlock()
+	if mark {
+		if err := c.markTrafficClass(tos); err != nil {
+			c.amb.E(EventWarn, fmt.Sprintf("Traffic class not set (%s)", err), h)
+		}
+	}
+	// The CCIDs lock themselves, so they are consulted without holding the Conn lock
+	delay := c.WriteCC(&h.Header, c.env.Now())
+	placeMandatory(h, mandatory)
+	placePadding(h, padTo, mps)
+	if (h.Type == Data || h.Type == DataAck) && h.wireSize() > mps {
+		c.reportDrop(DropTooLarge, h.Data, h.Meta, h)
+		return nil
+	}
+	if unverified && !c.admitWrite(&h.Header) {
+		c.amb.E(EventDrop, "Amplification limit", h)
+		return nil
+	}
+	if delay > 0 {
+		// The sender CCID holds the packet back, e.g. to pace a burst
+		c.env.Sleep(delay)
+	}
 
 	c.amb.E(EventWrite, "Write to header link", h)
+	expCountHeader(&h.Header, "out")
+	c.callHooks(&c.sentHooks, &h.Header)
 	return c.hc.Write(&h.Header)
 }
 
-// writeLoop() sends headers incoming on the writeData and writeNonData channels, while
-// giving priority to writeNonData. It continues to do so until writeNonData is closed.
-func (c *Conn) writeLoop(writeNonData chan *writeHeader, writeData chan []byte) {
-
-	// The presence of multiple loops below allows user calls to Write to
-	// block in "writeNonData <-" while the connection moves into a state where
-	// it accepts app data (in _Loop_II)
-
-	// This loop is active until state OPEN or PARTOPEN is observed, when a
-	// transition to _Loop II_is made
-	c.amb.E(EventInfo, "Write Loop I")
-_Loop_I:
-
+// writeLoop() sends the packets queued in q, while giving priority to non-Data packets. It
+// continues to do so until q is closed. Application data is dequeued only while the
+// connection is in OPEN or PARTOPEN, and not while the path of a migration is being
+// validated.
+func (c *Conn) writeLoop(q *writeQueue) {
+	c.amb.E(EventInfo, "Write Loop")
 	for {
-		h, ok := <-writeNonData
-		if !ok {
-			// Closing writeNonData means that the Conn is done and dead
-			goto _Exit
+		// Whenever the state changes to OPEN or PARTOPEN, or a path is validated, a nil
+		// header is injected in order to unblock pop, so that the check here can see the change
+		var acceptData bool
+		switch c.loadState() {
+		case OPEN, PARTOPEN:
+			acceptData = !c.isValidating()
 		}
-		// We'll allow nil headers, since they can be used to trigger unblock
-		// from the above send operator and (without resulting into an actual
-		// send) activate the state check after the "if" statement below
-		if h != nil {
-			err := c.write(h)
-			// If the underlying layer is broken, abort
-			if err != nil {
-				c.abortQuietly()
-				goto _Exit
-			}
+		h, appData, meta, queued, isData, ok := q.popMsg(acceptData)
+		if !ok {
+			// Closing the queue means that the Conn is done and dead
+			break
 		}
-		c.Lock()
-		state := c.socket.GetState()
-		c.Unlock()
-		switch state {
-		case OPEN, PARTOPEN:
-			goto _Loop_II
+		if isData && meta.Deadline != 0 && c.env.Now() > meta.Deadline {
+			// Data that expired in the queue is dropped before it takes up a sequence
+			// number and a slot of the sending rate
+			c.reportDrop(DropExpired, appData, meta)
+			continue
 		}
-		continue _Loop_I
-	}
-
-	// This loop is active until writeData is not closed
-	c.amb.E(EventInfo, "Write Loop II")
-_Loop_II:
-
-	for {
-		var h *writeHeader
-		var ok bool
-		var appData []byte
-		select {
-		// Note that non-Data packets take precedence
-		case h, ok = <-writeNonData:
-			if !ok {
-				// Closing writeNonData means that the Conn is done and dead
-				goto _Exit
-			}
-		case appData, ok = <-writeData:
-			if !ok {
-				// When writeData is closed, we transition to the 3rd loop,
-				// which accepts only non-Data packets
-				goto _Loop_III
-			}
-			// By virtue of being in _Loop_II (which implies we have been or are in OPEN
-			// or PARTOPEN), we know that some packets of the other side have been
-			// received, and so AckNo can be filled in meaningfully (below) in the
-			// DataAck packet
+		if isData {
+			// By virtue of being in OPEN or PARTOPEN, we know that some packets of the other
+			// side have been received, and so AckNo can be filled in meaningfully (below) in
+			// the DataAck packet
 
 			// We allow 0-length app data packets. No reason not to.
 			// XXX: I am not sure if Header.Data == nil (rather than
@@ -153,39 +183,22 @@ _Loop_II:
 			// It should be that it doesn't. Must verify this.
 			c.Lock()
 			h = c.generateDataAck(appData)
+			h.Meta = meta
+			c.placeCsCov(h)
 			c.Unlock()
-		}
-		if h != nil {
-			err := c.write(h)
-			if err != nil {
-				c.abortQuietly()
-				goto _Exit
-			}
-		}
-	}
-
-	// This loop is active until writeNonData is not closed
-	c.amb.E(EventInfo, "Write Loop III")
-_Loop_III:
-
-	for {
-		h, ok := <-writeNonData
-		if !ok {
-			// Closing writeNonData means that the Conn is done and dead
-			goto _Exit
+			c.amb.E(EventInfo, "Write queue", NewSample(WriteQueueSample, float64(q.dataQueued()), "pkts"))
+			c.addLatency(QueueDelaySample, queued)
 		}
 		// We'll allow nil headers, since they can be used to trigger unblock
-		// from the above send operator
+		// from pop (without resulting into an actual send)
 		if h != nil {
 			err := c.write(h)
 			// If the underlying layer is broken, abort
 			if err != nil {
 				c.abortQuietly()
-				goto _Exit
+				break
 			}
 		}
 	}
-
-_Exit:
 	c.amb.E(EventInfo, "Write loop EXIT")
 }
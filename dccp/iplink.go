@@ -0,0 +1,77 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// IPProtoDCCP is the IP protocol number of DCCP, Section 19.1
+const IPProtoDCCP = 33
+
+// IPLink binds to the DCCP protocol number of an IP address and acts as a Link. Unlike
+// UDPLink, it carries packets directly in IP datagrams, which requires the privilege to open
+// raw sockets. The packets are framed by the Mux as over UDP, so an IPLink only talks to
+// other GoDCCP endpoints.
+type IPLink struct {
+	c *net.IPConn
+}
+
+// BindIPLink binds to the DCCP protocol number of laddr. netw is either "ip4" or "ip6".
+func BindIPLink(netw string, laddr *net.IPAddr) (link *IPLink, err error) {
+	c, err := net.ListenIP(netw+":"+strconv.Itoa(IPProtoDCCP), laddr)
+	if err != nil {
+		return nil, err
+	}
+	return &IPLink{c: c}, nil
+}
+
+func (u *IPLink) GetMTU() int { return 1500 }
+
+// LocalAddr returns the local IP address that the link is bound to
+func (u *IPLink) LocalAddr() net.Addr { return u.c.LocalAddr() }
+
+func (u *IPLink) SetReadDeadline(t time.Time) error {
+	return u.c.SetReadDeadline(t)
+}
+
+func (u *IPLink) ReadFrom(buf []byte) (n int, addr net.Addr, err error) {
+	return u.c.ReadFrom(buf)
+}
+
+func (u *IPLink) WriteTo(buf []byte, addr net.Addr) (n int, err error) {
+	return u.c.WriteTo(buf, addr)
+}
+
+// SetTrafficClass implements TrafficClassLink.SetTrafficClass, by setting the IP_TOS or
+// IPV6_TCLASS option of the socket. Traffic classes are only supported on Linux.
+func (u *IPLink) SetTrafficClass(tos byte) error {
+	rc, err := u.c.SyscallConn()
+	if err != nil {
+		return err
+	}
+	return setTrafficClass(rc, tos)
+}
+
+// WriteToClass implements TrafficClassLink.WriteToClass
+func (u *IPLink) WriteToClass(buf []byte, addr net.Addr, tos byte) (n int, err error) {
+	ipaddr, ok := addr.(*net.IPAddr)
+	if !ok {
+		return 0, syscall.EINVAL
+	}
+	oob, err := trafficClassOOB(ipaddr.IP, tos)
+	if err != nil {
+		return 0, err
+	}
+	n, _, err = u.c.WriteMsgIP(buf, oob, ipaddr)
+	return n, err
+}
+
+func (u *IPLink) Close() error {
+	return u.c.Close()
+}
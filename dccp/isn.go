@@ -0,0 +1,117 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"crypto/rand"
+	"sync"
+)
+
+const (
+	ISNRange    = 1 << 46 // ISNs are chosen in [1,ISNRange), leaving room for sequence numbers to grow
+	ISNSpacing  = 1 << 24 // Minimum distance of an ISN from those recently chosen for the same endpoints
+	isnMemory   = MSL     // Time for which a chosen ISN is remembered
+	isnMaxTries = 16      // Number of draws before settling for an ISN that is not well spaced
+	isnSweep    = 1024    // Number of remembered endpoint pairs that triggers removal of expired ones
+)
+
+// isnUse records an ISN chosen for a pair of endpoints
+type isnUse struct {
+	iss    int64
+	expire int64 // Time after which the ISN is forgotten
+}
+
+// isnChooser chooses Initial Sequence Numbers. Each ISN is drawn uniformly from
+// [1,ISNRange) using a cryptographic random source, so that an off-path attacker cannot
+// predict it. An ISN is redrawn if it falls within ISNSpacing of an ISN chosen recently for
+// the same pair of endpoints, so that packets of a connection lingering in TIMEWAIT are not
+// mistaken for those of its successor.
+type isnChooser struct {
+	sync.Mutex
+	fixed  func() int64        // If not nil, ISNs are taken from fixed; see Env.SetISNFunc
+	seeded bool                // If true, ISNs are drawn from the Env's seeded generator
+	recent map[string][]isnUse // ISNs chosen recently, keyed by the pair of endpoints
+}
+
+// isnKey returns the key of the pair of endpoints local and remote. Either may be nil.
+func isnKey(local, remote Bytes) string {
+	var k []byte
+	for _, addr := range []Bytes{local, remote} {
+		var b []byte
+		if addr != nil {
+			b = addr.Bytes()
+		}
+		k = append(append(k, byte(len(b))), b...)
+	}
+	return string(k)
+}
+
+func cryptoISN() int64 {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic("ISN randomness")
+	}
+	return int64(DecodeUint48(b[:6])%(ISNRange-1)) + 1
+}
+
+// ChooseISN returns a new Initial Sequence Number for a connection between the local and
+// remote endpoints
+func (t *Env) ChooseISN(local, remote Bytes) int64 {
+	x := &t.isn
+	x.Lock()
+	defer x.Unlock()
+	if x.fixed != nil {
+		return x.fixed()
+	}
+	now := t.Now()
+	key := isnKey(local, remote)
+	if len(x.recent) >= isnSweep {
+		for k, uses := range x.recent {
+			if uses[len(uses)-1].expire <= now {
+				delete(x.recent, k)
+			}
+		}
+	}
+	// Forget expired ISNs of this pair of endpoints; uses are kept in order of expiry
+	uses := x.recent[key]
+	for len(uses) > 0 && uses[0].expire <= now {
+		uses = uses[1:]
+	}
+	var iss int64
+	for i := 0; i < isnMaxTries; i++ {
+		if x.seeded {
+			iss = t.Int63n(ISNRange-1) + 1
+		} else {
+			iss = cryptoISN()
+		}
+		if isnSpaced(iss, uses) {
+			break
+		}
+	}
+	if x.recent == nil {
+		x.recent = make(map[string][]isnUse)
+	}
+	x.recent[key] = append(uses, isnUse{iss: iss, expire: now + isnMemory})
+	return iss
+}
+
+// isnSpaced returns true if iss is at least ISNSpacing away from all ISNs in uses
+func isnSpaced(iss int64, uses []isnUse) bool {
+	for _, u := range uses {
+		if d := iss - u.iss; d > -ISNSpacing && d < ISNSpacing {
+			return false
+		}
+	}
+	return true
+}
+
+// SetISNFunc makes the Env take the Initial Sequence Numbers of its connections from f, as
+// they are, instead of drawing them at random. It is meant for tests that need to fix the
+// ISNs. A nil f restores random ISNs.
+func (t *Env) SetISNFunc(f func() int64) {
+	t.isn.Lock()
+	defer t.isn.Unlock()
+	t.isn.fixed = f
+}
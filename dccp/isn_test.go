@@ -0,0 +1,61 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"testing"
+)
+
+func TestChooseISN(t *testing.T) {
+	env := NewEnvTime(&manualTime{now: 1e9}, nil)
+	local, remote := ChooseLabel(env), ChooseLabel(env)
+	var chosen []int64
+	for i := 0; i < 500; i++ {
+		iss := env.ChooseISN(local, remote)
+		if iss < 1 || iss >= ISNRange {
+			t.Fatalf("ISN %d out of range", iss)
+		}
+		for _, prev := range chosen {
+			if d := iss - prev; d > -ISNSpacing && d < ISNSpacing {
+				t.Fatalf("ISN %d too close to recent ISN %d", iss, prev)
+			}
+		}
+		chosen = append(chosen, iss)
+	}
+	key := isnKey(local, remote)
+	if n := len(env.isn.recent[key]); n != len(chosen) {
+		t.Errorf("remembered %d ISNs, expecting %d", n, len(chosen))
+	}
+
+	// ISNs are forgotten after isnMemory
+	env.Sleep(isnMemory)
+	env.ChooseISN(local, remote)
+	if n := len(env.isn.recent[key]); n != 1 {
+		t.Errorf("remembered %d ISNs after expiry, expecting 1", n)
+	}
+
+	env.SetISNFunc(func() int64 { return 7 })
+	if iss := env.ChooseISN(local, remote); iss != 7 {
+		t.Errorf("fixed ISN %d, expecting 7", iss)
+	}
+}
+
+func TestISNSpaced(t *testing.T) {
+	uses := []isnUse{{iss: 10 * ISNSpacing}}
+	for _, x := range []struct {
+		iss    int64
+		spaced bool
+	}{
+		{10 * ISNSpacing, false},
+		{11*ISNSpacing - 1, false},
+		{9*ISNSpacing + 1, false},
+		{11 * ISNSpacing, true},
+		{9 * ISNSpacing, true},
+	} {
+		if isnSpaced(x.iss, uses) != x.spaced {
+			t.Errorf("ISN %d spaced=%v", x.iss, !x.spaced)
+		}
+	}
+}
@@ -5,9 +5,12 @@
 package dccp
 
 import (
+	"bytes"
 	"fmt"
 	"path"
 	goruntime "runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 )
@@ -27,6 +30,7 @@ type GoRoutine struct {
 	file string
 	line int
 	anno string
+	id   chan int64 // Receives the runtime id of the goroutine once it starts
 }
 
 // Go runs f in a new goroutine and returns a handle object, which can
@@ -39,8 +43,10 @@ func GoCaller(f func(), skip int, fmt_ string, args_ ...interface{}) *GoRoutine
 		file: sfile,
 		line: sline,
 		anno: fmt.Sprintf(fmt_, args_...),
+		id:   make(chan int64, 1),
 	}
 	go func() {
+		g.id <- goroutineID()
 		f()
 		close(ch)
 	}()
@@ -58,6 +64,51 @@ func (g *GoRoutine) Join() {
 	_, _ = <-g.ch
 }
 
+// Done returns true if the goroutine has completed.
+func (g *GoRoutine) Done() bool {
+	select {
+	case <-g.ch:
+		return true
+	default:
+	}
+	return false
+}
+
+// Stack returns the current stack trace of the goroutine, or the empty string if
+// the goroutine has completed.
+func (g *GoRoutine) Stack() string {
+	id := <-g.id
+	g.id <- id
+	buf := make([]byte, 1<<16)
+	for {
+		n := goruntime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	prefix := []byte(fmt.Sprintf("goroutine %d ", id))
+	for _, trace := range bytes.Split(buf, []byte("\n\n")) {
+		if bytes.HasPrefix(trace, prefix) {
+			return string(trace)
+		}
+	}
+	return ""
+}
+
+// goroutineID returns the runtime id of the calling goroutine, as it appears in stack traces
+func goroutineID() int64 {
+	var buf [64]byte
+	line := buf[:goruntime.Stack(buf[:], false)]
+	line = bytes.TrimPrefix(line, []byte("goroutine "))
+	if k := bytes.IndexByte(line, ' '); k >= 0 {
+		line = line[:k]
+	}
+	id, _ := strconv.ParseInt(string(line), 10, 64)
+	return id
+}
+
 // Source returns the file and line where the goroutine was forked.
 func (g *GoRoutine) Source() (sfile string, sline int) {
 	return g.file, g.line
@@ -105,17 +156,18 @@ func TrimFuncName(fname string) (trimmed string, isDCCP bool) {
 }
 
 // GoJoin waits until a set of GoRoutines all complete. It also allows
-// new routines to be added dynamically before the completion event.
+// new routines to be added dynamically, even after a Join has returned.
+// Joiners that have completed are forgotten, so a GoJoin that outlives
+// many short-lived goroutines does not grow.
 type GoJoin struct {
 	srcFile    string
 	srcLine    int
 	annotation string
 
-	lk      sync.Mutex	// Locks the fields below
-	group   []Joiner	// Slice of joiners included in this conjunction sync
-	kdone   int		// Counts the number of Joiners that have already completed
-	ch      chan Joiner
-	slk     sync.Mutex	// Only one Join can be called at a time
+	lk      sync.Mutex        // Locks the fields below
+	cond    sync.Cond         // Signalled when the last pending Joiner completes
+	pending map[int64]Joiner  // Joiners that have not completed yet, by order of addition
+	added   int64             // Number of Joiners added so far
 }
 
 // NewGoJoinCaller creates an object capable of waiting until all supplied GoRoutines complete.
@@ -125,9 +177,9 @@ func NewGoJoinCaller(skip int, annotation string, group ...Joiner) *GoJoin {
 		srcFile:    sfile,
 		srcLine:    sline,
 		annotation: annotation,
-		kdone:      0, 
-		ch:         make(chan Joiner, 10),
+		pending:    make(map[int64]Joiner),
 	}
+	w.cond.L = &w.lk
 	for _, u := range group {
 		w.Add(u)
 	}
@@ -140,27 +192,44 @@ func NewGoJoin(annotation string, group ...Joiner) *GoJoin {
 
 // String returns a unique, readable string representation of this instance.
 func (t *GoJoin) String() string {
-	return fmt.Sprintf("%s:%d %s (%x)", t.srcFile, t.srcLine, t.annotation, t)
+	return fmt.Sprintf("%s:%d %s (%p)", t.srcFile, t.srcLine, t.annotation, t)
 }
 
-// Add adds a Joiner to the group. It can be called at any time
-// as long as the current set of goroutines hasn't completed.
-// For instance, as long as you call Add from a GoRoutine which
-// is waited on by this object, the condtion will be met.
+// Add adds a Joiner to the group. It can be called at any time.
 func (t *GoJoin) Add(u Joiner) {
 	t.lk.Lock()
 	defer t.lk.Unlock()
-	if t.kdone < 0 {
-		panic("adding joiners after conjunction event")
-	}
-	t.group = append(t.group, u)
-	ch := t.ch
+	k := t.added
+	t.added++
+	t.pending[k] = u
 	go func(){
 		u.Join()
-		ch <- u
+		t.lk.Lock()
+		defer t.lk.Unlock()
+		delete(t.pending, k)
+		if len(t.pending) == 0 {
+			t.cond.Broadcast()
+		}
 	}()
 }
 
+// Pending returns the Joiners in the group that have not completed yet, in the order they
+// were added.
+func (t *GoJoin) Pending() []Joiner {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	keys := make([]int64, 0, len(t.pending))
+	for k := range t.pending {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	pending := make([]Joiner, len(keys))
+	for i, k := range keys {
+		pending[i] = t.pending[k]
+	}
+	return pending
+}
+
 // Go is a convenience method which forks f into a new GoRoutine and
 // adds the latter to the waiting queue. fmt is a formatted annotation
 // with arguments args.
@@ -169,42 +238,16 @@ func (t *GoJoin) Go(f func(), fmt_ string, args_ ...interface{}) {
 }
 
 // Join blocks until all goroutines in the group have completed.
-// Join can be called concurrently. If called post-completion of the
-// goroutine group, Join returns immediately.
+// Join can be called concurrently. If no goroutines are pending,
+// Join returns immediately.
 func (t *GoJoin) Join() {
-	t.slk.Lock()
-	defer t.slk.Unlock()
-
-	// Prevent calling Join before any waitees have been added
 	t.lk.Lock()
-	n := len(t.group)
-	ch := t.ch
-	t.lk.Unlock()
-	if n == 0 {
+	defer t.lk.Unlock()
+	// Prevent calling Join before any waitees have been added
+	if t.added == 0 {
 		panic("waiting on 0 goroutines")
 	}
-
-	for t.stillRemain() {
-		_, ok := <-ch
-		if !ok {
-			return
-		}
-		t.lk.Lock()
-		if t.kdone < 0 {
-			panic("no joiners should complete past junction event")
-		}
-		t.kdone++
-		if t.kdone == len(t.group) {
-			// Ensure future calls to Join return immediately
-			t.kdone = -1
-			close(ch)
-		}
-		t.lk.Unlock()
+	for len(t.pending) > 0 {
+		t.cond.Wait()
 	}
 }
-
-func (t* GoJoin) stillRemain() bool {
-	t.lk.Lock()
-	defer t.lk.Unlock()
-	return t.kdone >= 0 && t.kdone < len(t.group)
-}
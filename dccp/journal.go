@@ -0,0 +1,141 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// A Journal records the inputs that drive a Conn from the outside: the packets it receives,
+// the calls of the application and the ticks of its idle timer, each at the time it occurred.
+// The packets that the Conn sends are recorded too, not as inputs, but so that a replay can
+// be checked against them. A Journal taken from a failing connection can be saved, and
+// replayed against a fresh Conn with Replay to reproduce the failure, see replay.go.
+type Journal struct {
+	Server      bool   // Whether the Conn is the server end of the connection
+	ServiceCode uint32 // Service Code of the connection
+	MTU         int    // MTU of the HeaderConn of the Conn
+	Seed        int64  // Seed of the pseudo-random number generator of the Env
+	ISS         int64  // Initial Sequence Number of the Conn, if known
+	Entries     []*JournalEntry
+
+	lk    sync.Mutex
+	env   *Env
+	start int64 // Env time at which the journal was started
+}
+
+// JournalEntry is an input to a Conn, or a packet sent by it
+type JournalEntry struct {
+	Time   int64       // Time since the start of the journal
+	Kind   JournalKind
+	Header *Header     `json:",omitempty"` // Packet received or sent
+	Data   []byte      `json:",omitempty"` // Message written
+	Meta   *WriteMeta  `json:",omitempty"` // Metadata of the message written, with a Deadline relative to the start of the journal
+}
+
+// JournalKind is the kind of a JournalEntry
+type JournalKind int
+
+const (
+	JournalRecv       = JournalKind(iota) // Packet received
+	JournalSent                           // Packet sent; compared, not replayed
+	JournalWrite                          // WriteMsg or Write returned
+	JournalRead                           // ReadMsg or Read returned a message
+	JournalFlush
+	JournalClose
+	JournalCloseRead
+	JournalCloseWrite
+	JournalAbort
+	JournalTick                           // Idle timer; regenerated by the Conn, not replayed
+)
+
+// StartJournal starts recording the inputs of the Conn in a new Journal, which it returns.
+// It should be called right after the Conn is created, since earlier inputs are missed.
+func (c *Conn) StartJournal() *Journal {
+	c.Lock()
+	j := &Journal{
+		Server:      c.socket.IsServer(),
+		ServiceCode: c.socket.GetServiceCode(),
+		MTU:         c.hc.GetMTU(),
+		Seed:        c.env.Seed(),
+		ISS:         c.socket.GetISS(),
+		env:         c.env,
+		start:       c.env.Now(),
+	}
+	c.Unlock()
+	c.hooksLk.Lock()
+	c.journal = j
+	c.hooksLk.Unlock()
+	c.OnPacketReceived(func(p PacketView) {
+		j.add(&JournalEntry{ Kind: JournalRecv, Header: p.Copy() })
+	})
+	c.OnPacketSent(func(p PacketView) {
+		if p.Type() == Request || p.Type() == Response {
+			j.lk.Lock()
+			if j.ISS == 0 {
+				j.ISS = p.SeqNo()
+			}
+			j.lk.Unlock()
+		}
+		j.add(&JournalEntry{ Kind: JournalSent, Header: p.Copy() })
+	})
+	return j
+}
+
+// journalAdd records e in the journal of the Conn, if it has one
+func (c *Conn) journalAdd(e *JournalEntry) {
+	c.hooksLk.Lock()
+	j := c.journal
+	c.hooksLk.Unlock()
+	if j != nil {
+		j.add(e)
+	}
+}
+
+// journalWrite records a message written by the application
+func (c *Conn) journalWrite(data []byte, meta WriteMeta) {
+	c.hooksLk.Lock()
+	j := c.journal
+	c.hooksLk.Unlock()
+	if j == nil {
+		return
+	}
+	if meta.Deadline != 0 {
+		meta.Deadline -= j.start
+	}
+	j.add(&JournalEntry{ Kind: JournalWrite, Data: append([]byte(nil), data...), Meta: &meta })
+}
+
+func (j *Journal) add(e *JournalEntry) {
+	j.lk.Lock()
+	defer j.lk.Unlock()
+	e.Time = j.env.Now() - j.start
+	j.Entries = append(j.Entries, e)
+}
+
+// Len returns the number of entries in the journal
+func (j *Journal) Len() int {
+	j.lk.Lock()
+	defer j.lk.Unlock()
+	return len(j.Entries)
+}
+
+// Save writes the journal to w in JSON format
+func (j *Journal) Save(w io.Writer) error {
+	j.lk.Lock()
+	defer j.lk.Unlock()
+	return json.NewEncoder(w).Encode(j)
+}
+
+// LoadJournal reads a journal saved with Save
+func LoadJournal(r io.Reader) (*Journal, error) {
+	j := &Journal{}
+	if err := json.NewDecoder(r).Decode(j); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// JSONTraceWriter encodes every Trace as a single-line JSON object and writes it to an
+// underlying io.Writer. The output is a stream of records, one per line, which external
+// tools can consume incrementally.
+type JSONTraceWriter struct {
+	sync.Mutex
+	w   io.Writer
+	enc *json.Encoder
+}
+
+// NewJSONTraceWriter creates a TraceWriter that writes JSON records to w
+func NewJSONTraceWriter(w io.Writer) *JSONTraceWriter {
+	return &JSONTraceWriter{ w: w, enc: json.NewEncoder(w) }
+}
+
+// Write encodes r. Arguments of r that have no JSON representation are replaced by their
+// textual representation, so that a record is never lost to an encoding error.
+func (t *JSONTraceWriter) Write(r *Trace) {
+	t.Lock()
+	defer t.Unlock()
+	if err := t.enc.Encode(r); err == nil {
+		return
+	}
+	s := *r
+	s.Args = make(map[string]interface{}, len(r.Args))
+	for k, a := range r.Args {
+		if _, err := json.Marshal(a); err != nil {
+			a = fmt.Sprintf("%v", a)
+		}
+		s.Args[k] = a
+	}
+	if err := t.enc.Encode(&s); err != nil {
+		panic(fmt.Sprintf("error encoding log entry (%s)", err))
+	}
+}
+
+// Sync flushes the underlying writer, if it supports syncing
+func (t *JSONTraceWriter) Sync() error {
+	if s, ok := t.w.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+// Close closes the underlying writer, if it supports closing
+func (t *JSONTraceWriter) Close() error {
+	if c, ok := t.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
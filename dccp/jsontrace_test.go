@@ -0,0 +1,53 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestJSONTraceWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewJSONTraceWriter(&buf)
+	w.Write(&Trace{
+		Labels:  []string{"client"},
+		Event:   EventDrop,
+		Comment: "Slow reader",
+		Args:    map[string]interface{}{"chan": make(chan int)},
+		SeqNo:   7,
+	})
+	if !strings.Contains(buf.String(), `"e":"Drop"`) {
+		t.Errorf("event not encoded by name: %s", buf.String())
+	}
+	var r Trace
+	if err := json.NewDecoder(&buf).Decode(&r); err != nil {
+		t.Fatalf("decode (%s)", err)
+	}
+	if r.Event != EventDrop || r.SeqNo != 7 || r.Comment != "Slow reader" {
+		t.Errorf("round trip mismatch: %#v", r)
+	}
+	if _, ok := r.Args["chan"].(string); !ok {
+		t.Errorf("unencodable argument not replaced by text")
+	}
+
+	// Traces written by older versions encode events by number
+	if err := json.Unmarshal([]byte(`{"e":4}`), &r); err != nil || r.Event != EventWarn {
+		t.Errorf("numeric event not decoded")
+	}
+
+	// The highlight flag keeps the key of older traces
+	r = Trace{}
+	if err := json.Unmarshal([]byte(`{"Highlight":true}`), &r); err != nil || !r.Highlight {
+		t.Errorf("highlight not decoded")
+	}
+	buf.Reset()
+	w.Write(&Trace{ Highlight: true })
+	if !strings.Contains(buf.String(), `"Highlight":true`) {
+		t.Errorf("highlight not encoded under its old key: %s", buf.String())
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"bytes"
 	"errors"
 	"hash/crc64"
-	"math/rand"
 	"strings"
 )
 
@@ -48,11 +47,11 @@ func isZero(bb []byte) bool {
 	return true
 }
 
-// ChooseLabel() creates a new label by choosing its bytes randomly
-func ChooseLabel() *Label {
+// ChooseLabel() creates a new label by choosing its bytes randomly from the generator of env.
+func ChooseLabel(env *Env) *Label {
 	label := &Label{}
 	for i := 0; i < LabelLen/2; i++ {
-		q := rand.Int()
+		q := env.Int63n(1 << 16)
 		label.data[2*i] = byte(q & 0xff)
 		q >>= 8
 		label.data[2*i+1] = byte(q & 0xff)
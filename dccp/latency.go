@@ -0,0 +1,87 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+// The latency of application data is broken down into the stages of the write path: the wait
+// in the write queue, the wait for the sender congestion control to admit the packet, and the
+// flight from sending the packet to the arrival of an Ack of it. The flight is only measured
+// for packets that the peer acknowledges directly, and includes the delay of the peer's Ack.
+// Each stage is emitted as a sample series, in milliseconds, and summed up in LatencyStats.
+
+// Sample series of the latency breakdown
+const (
+	QueueDelaySample = "Queue-Delay" // Time a message waits in the write queue
+	GateDelaySample  = "Gate-Delay"  // Time the sender congestion control holds a packet back
+	FlightSample     = "Flight-Time" // Time from sending a packet to the arrival of its Ack
+)
+
+// LatencyStat summarizes the durations, in nanoseconds, of one stage of the write path
+type LatencyStat struct {
+	Count int64 // Number of packets measured
+	Sum   int64 // Sum of their durations
+	Max   int64 // Longest duration
+}
+
+// Mean returns the average duration, or zero if nothing was measured
+func (s LatencyStat) Mean() int64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Sum / s.Count
+}
+
+func (s *LatencyStat) add(d int64) {
+	s.Count++
+	s.Sum += d
+	s.Max = max64(s.Max, d)
+}
+
+// LatencyStats breaks the latency of the application data sent by a connection down into the
+// stages of the write path
+type LatencyStats struct {
+	Queue  LatencyStat // From Write to being taken out of the write queue
+	Gate   LatencyStat // From being taken out of the write queue to being admitted by the CCID
+	Flight LatencyStat // From being sent to the arrival of the first Ack of the packet
+}
+
+// Latency returns the latency breakdown of the application data sent so far
+func (c *Conn) Latency() LatencyStats {
+	c.Lock()
+	defer c.Unlock()
+	return c.latency
+}
+
+// addLatency adds the duration d of a stage of the write path, given by its sample series, to
+// the latency breakdown
+func (c *Conn) addLatency(series string, d int64) {
+	c.Lock()
+	switch series {
+	case QueueDelaySample:
+		c.latency.Queue.add(d)
+	case GateDelaySample:
+		c.latency.Gate.add(d)
+	case FlightSample:
+		c.latency.Flight.add(d)
+	}
+	c.Unlock()
+	c.amb.E(EventInfo, "Latency", NewSample(series, float64(d)/1e6, "ms"))
+}
+
+// readFlight measures the flight of the sent packet that the received packet h acknowledges,
+// if h is its first Ack
+func (c *Conn) readFlight(h *Header, now int64) {
+	c.AssertLocked()
+	if !h.HasAckNo() {
+		return
+	}
+	m := &c.sent[h.AckNo%SentHistoryLen]
+	if m.SeqNo != h.AckNo || m.Time == 0 {
+		return
+	}
+	d := now - m.Time
+	m.Time = 0
+	c.latency.Flight.add(d)
+	c.amb.E(EventInfo, "Latency", NewSample(FlightSample, float64(d)/1e6, "ms"), h)
+}
@@ -0,0 +1,39 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+// Package ledbat implements an experimental scavenger congestion control for DCCP, in the
+// style of LEDBAT, RFC 6817. It is meant for bulk background transfers, which should use the
+// capacity that other traffic leaves idle and yield it as soon as that traffic needs it.
+//
+// The sender stamps its data packets with Timestamp options, and the receiver reports the
+// one-way delays of the packets in a One-Way Delay option, from which the sender estimates
+// the queueing delay along the path with dccp.OneWayDelay. The congestion window grows while
+// the queueing delay is below Target and shrinks in proportion as it exceeds it, so that the
+// flow backs off before loss-based congestion controls even notice the queue. Acknowledged
+// and lost packets are found from the Ack Vectors of the receiver, and the window is halved on
+// loss, at most once per round-trip time.
+//
+// The congestion control is registered under the experimental CCID dccp.CCID_LEDBAT and
+// requires both endpoints to run it.
+package ledbat
+
+import (
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// LEDBAT is the factory of the experimental scavenger congestion control. Importing this
+// package registers it with dccp.RegisterCCID.
+type LEDBAT struct{}
+
+func init() {
+	dccp.RegisterCCID(dccp.CCID_LEDBAT, LEDBAT{})
+}
+
+func (LEDBAT) NewSender(env *dccp.Env, amb *dccp.Amb) dccp.SenderCongestionControl {
+	return newSender(env, amb)
+}
+
+func (LEDBAT) NewReceiver(env *dccp.Env, amb *dccp.Amb) dccp.ReceiverCongestionControl {
+	return newReceiver(env, amb)
+}
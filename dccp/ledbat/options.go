@@ -0,0 +1,45 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package ledbat
+
+import (
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// LEDBAT-specific options
+const (
+	OptionOneWayDelay = 192
+)
+
+// OneWayDelayOption reports the smallest one-way delay sample, see dccp.OneWayDelaySample,
+// of the packets that the receiver has received since its previous acknowledgement. It is our
+// own extension, and travels from the HC-Receiver to the HC-Sender.
+type OneWayDelayOption struct {
+	Delay uint32 // Circular, in ten microsecond units
+}
+
+func DecodeOneWayDelayOption(opt *dccp.Option) *OneWayDelayOption {
+	if opt.Type != OptionOneWayDelay || len(opt.Data) != 4 {
+		return nil
+	}
+	return &OneWayDelayOption{ Delay: dccp.DecodeUint32(opt.Data[0:4]) }
+}
+
+func (opt *OneWayDelayOption) Encode() (*dccp.Option, error) {
+	d := make([]byte, 4)
+	dccp.EncodeUint32(opt.Delay, d)
+	return &dccp.Option{
+		Type:      OptionOneWayDelay,
+		Data:      d,
+		Mandatory: false,
+	}, nil
+}
+
+// Place places the option on the packet of ph, without allocating
+func (opt *OneWayDelayOption) Place(ph *dccp.PreHeader) {
+	var d [4]byte
+	dccp.EncodeUint32(opt.Delay, d[:])
+	ph.AddOption(OptionOneWayDelay, d[:], false)
+}
@@ -0,0 +1,24 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package ledbat
+
+import (
+	"testing"
+)
+
+func TestOneWayDelayOption(t *testing.T) {
+	opt, err := (&OneWayDelayOption{ Delay: 0xfffffff0 }).Encode()
+	if err != nil {
+		t.Fatalf("encode (%s)", err)
+	}
+	dec := DecodeOneWayDelayOption(opt)
+	if dec == nil || dec.Delay != 0xfffffff0 {
+		t.Errorf("decoded %v", dec)
+	}
+	opt.Data = opt.Data[:3]
+	if DecodeOneWayDelayOption(opt) != nil {
+		t.Errorf("decoded a short option")
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package ledbat
+
+import (
+	"github.com/petar/GoDCCP/dccp"
+)
+
+func newReceiver(env *dccp.Env, amb *dccp.Amb) *receiver {
+	return &receiver{ env: env, amb: amb.Refine("ledbat-receiver") }
+}
+
+// receiver implements the LEDBAT congestion control receiver. It acknowledges every Ack Ratio
+// data packets, and once every round-trip time of idleness, with the smallest one-way delay of
+// the packets received in between, an echo of the latest Timestamp of the sender, and an Ack
+// Vector when the Send Ack Vector feature is on, see dccp.AckReceiver.
+// It conforms to dccp.ReceiverCongestionControl.
+type receiver struct {
+	env *dccp.Env
+	amb *dccp.Amb
+	dccp.Mutex // Locks all fields below
+	acks    dccp.AckReceiver
+	delay   uint32 // Smallest one-way delay sample since the latest Ack was sent
+	delayed bool   // Whether delay holds a sample
+	open    bool   // Whether the CC is active
+}
+
+// GetID returns the CCID of this congestion control algorithm
+func (r *receiver) GetID() byte { return dccp.CCID_LEDBAT }
+
+func (r *receiver) Open() {
+	r.Lock()
+	defer r.Unlock()
+	if r.open {
+		panic("opening an open ledbat receiver")
+	}
+	r.acks.Open()
+	r.delayed = false
+	r.open = true
+}
+
+// SetAckRatio sets the number of data packets received per Ack
+func (r *receiver) SetAckRatio(ratio int) {
+	r.Lock()
+	defer r.Unlock()
+	r.acks.SetAckRatio(ratio)
+}
+
+// SetSendAckVector turns the Ack Vectors on or off
+func (r *receiver) SetSendAckVector(on bool) {
+	r.Lock()
+	defer r.Unlock()
+	r.acks.SetSendAckVector(on)
+}
+
+// OnWrite places a One-Way Delay option, a Timestamp Echo and an Ack Vector on
+// acknowledgements
+func (r *receiver) OnWrite(ph *dccp.PreHeader) {
+	r.Lock()
+	defer r.Unlock()
+	if !r.open || !r.acks.OnWrite(ph) {
+		return
+	}
+	if r.delayed {
+		(&OneWayDelayOption{ Delay: r.delay }).Place(ph)
+		r.delayed = false
+	}
+}
+
+// OnRead samples the one-way delay of packets that carry a Timestamp, records the packets for
+// the Ack Vectors, and asks for an Ack once Ack Ratio data packets have arrived
+func (r *receiver) OnRead(ff *dccp.FeedforwardHeader) error {
+	r.Lock()
+	defer r.Unlock()
+	if !r.open {
+		return nil
+	}
+	if ts := ff.Timestamp; ts != nil {
+		sample := dccp.OneWayDelaySample(ts.Timestamp, ff.Time)
+		if !r.delayed || int32(sample-r.delay) < 0 {
+			r.delay, r.delayed = sample, true
+		}
+	}
+	return r.acks.OnRead(ff)
+}
+
+// OnIdle asks for an Ack when data packets have gone unacknowledged
+func (r *receiver) OnIdle(now int64) error {
+	r.Lock()
+	defer r.Unlock()
+	if !r.open {
+		return nil
+	}
+	return r.acks.OnIdle()
+}
+
+func (r *receiver) Close() {
+	r.Lock()
+	defer r.Unlock()
+	r.open = false
+}
+
+// UnderstandsOption returns true for the options that the receiver processes
+func (r *receiver) UnderstandsOption(optionType byte) bool {
+	return optionType == dccp.OptionTimestamp
+}
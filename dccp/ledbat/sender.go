@@ -0,0 +1,250 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package ledbat
+
+import (
+	"fmt"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// Parameters of LEDBAT, RFC 6817, Section 2.5. Windows are in packets.
+const (
+	Target          = 100e6 // Queueing delay that the flow aims to induce, at most
+	Gain            = 1     // Rate at which the window follows the queueing delay
+	AllowedIncrease = 1     // Largest growth of the window beyond the flight
+	InitCwnd        = 2     // Initial congestion window
+	MinCwnd         = 2     // Smallest congestion window
+)
+
+// PollWait is the longest wait for the congestion window to open, before Strobe looks again
+const PollWait = 1e6
+
+func newSender(env *dccp.Env, amb *dccp.Amb) *sender {
+	return &sender{ env: env, amb: amb.Refine("ledbat-sender") }
+}
+
+// sender implements the LEDBAT congestion control sender.
+// It conforms to dccp.SenderCongestionControl.
+type sender struct {
+	env *dccp.Env
+	amb *dccp.Amb
+	dccp.Mutex // Locks all fields below
+	delay   dccp.OneWayDelay
+	cwnd    float64
+	flight  []flightPacket // Data packets in flight, in increasing order of sequence number
+	srtt    int64          // Smoothed round-trip time, or zero if not measured yet
+	lastCut int64          // Time of the latest halving of the window
+	lost    int64          // Number of data packets declared lost
+	open    bool           // Whether the CC is active
+}
+
+type flightPacket struct {
+	SeqNo int64
+	Sent  int64
+}
+
+// GetID returns the CCID of this congestion control algorithm
+func (s *sender) GetID() byte { return dccp.CCID_LEDBAT }
+
+// GetCCMPS returns the Congestion Control Maximum Packet Size. The window counts packets, so
+// it does not limit their size.
+func (s *sender) GetCCMPS() int32 { return 1e9 }
+
+// GetRTT returns the smoothed round-trip time
+func (s *sender) GetRTT() int64 {
+	s.Lock()
+	defer s.Unlock()
+	return s.rtt()
+}
+
+func (s *sender) rtt() int64 {
+	if s.srtt == 0 {
+		return dccp.RoundtripDefault
+	}
+	return s.srtt
+}
+
+// RequiresAckVector returns true, as acknowledged and lost packets are found from Ack Vectors
+func (s *sender) RequiresAckVector() bool { return true }
+
+func (s *sender) Open() {
+	s.Lock()
+	defer s.Unlock()
+	if s.open {
+		panic("opening an open ledbat sender")
+	}
+	s.delay = dccp.OneWayDelay{}
+	s.cwnd = InitCwnd
+	s.flight = nil
+	s.srtt = 0
+	s.lastCut = 0
+	s.lost = 0
+	s.open = true
+}
+
+// OnWrite stamps data packets with a Timestamp, from which the receiver measures their
+// one-way delay
+func (s *sender) OnWrite(ph *dccp.PreHeader) (ccval int8) {
+	s.Lock()
+	defer s.Unlock()
+	if !s.open || (ph.Type != dccp.Data && ph.Type != dccp.DataAck) {
+		return 0
+	}
+	s.flight = append(s.flight, flightPacket{ SeqNo: ph.SeqNo, Sent: ph.TimeWrite })
+	(&dccp.TimestampOption{ Timestamp: dccp.TimestampAt(ph.TimeWrite) }).Place(ph)
+	return 0
+}
+
+// OnRead adjusts the congestion window to the queueing delay, RFC 6817, Section 2.4.2, and
+// halves it on loss
+func (s *sender) OnRead(fb *dccp.FeedbackHeader) error {
+	s.Lock()
+	defer s.Unlock()
+	if !s.open || (fb.Type != dccp.Ack && fb.Type != dccp.DataAck) {
+		return nil
+	}
+	if echo := fb.TimestampEcho; echo != nil {
+		rtt := int64(dccp.TimestampAt(fb.Time)-echo.Timestamp)*dccp.TenMicroInNano - dccp.NanoFromTenMicro(echo.Elapsed)
+		s.onRTT(rtt)
+	}
+	for i := range fb.Options {
+		if owd := DecodeOneWayDelayOption(&fb.Options[i]); owd != nil {
+			s.delay.Add(owd.Delay, fb.Time)
+		}
+	}
+	av := fb.AckVector
+
+	// Remove the acknowledged packets from the flight
+	flightSize := len(s.flight)
+	var acked int
+	var highest int64 = -1
+	rest := s.flight[:0]
+	for _, p := range s.flight {
+		if av != nil && av.Received(fb.AckNo, p.SeqNo) || av == nil && p.SeqNo == fb.AckNo {
+			acked++
+			highest = p.SeqNo
+			continue
+		}
+		rest = append(rest, p)
+	}
+	s.flight = rest
+	if acked == 0 {
+		return nil
+	}
+
+	// Packets that dccp.DupThresh later packets have overtaken are lost
+	lost := dccp.FlightOvertaken(len(s.flight), highest, func(i int) int64 { return s.flight[i].SeqNo })
+	s.flight = append(s.flight[:0], s.flight[lost:]...)
+	s.lost += int64(lost)
+
+	if queueing, ok := s.delay.Queueing(); ok {
+		offTarget := float64(Target-queueing) / Target
+		s.cwnd += Gain * offTarget * float64(acked) / s.cwnd
+		if max := float64(flightSize + AllowedIncrease); s.cwnd > max {
+			s.cwnd = max
+		}
+	}
+	if lost > 0 {
+		s.cut(fb.Time, fmt.Sprintf("%d lost", lost))
+	}
+	if s.cwnd < MinCwnd {
+		s.cwnd = MinCwnd
+	}
+	return nil
+}
+
+// onRTT takes the round-trip time sample rtt
+func (s *sender) onRTT(rtt int64) {
+	if rtt <= 0 {
+		return
+	}
+	if s.srtt == 0 {
+		s.srtt = rtt
+	} else {
+		s.srtt = (7*s.srtt + rtt) / 8
+	}
+}
+
+// cut halves the congestion window at time now, unless it was halved within the latest
+// round-trip time, RFC 6817, Section 2.4.2
+func (s *sender) cut(now int64, why string) {
+	if s.lastCut != 0 && now-s.lastCut < s.rtt() {
+		return
+	}
+	s.lastCut = now
+	s.cwnd /= 2
+	if s.cwnd < MinCwnd {
+		s.cwnd = MinCwnd
+	}
+	s.amb.E(dccp.EventInfo, fmt.Sprintf("LEDBAT window halved to %.1f, %s", s.cwnd, why))
+}
+
+// expire declares the data packets that have been in flight for too long lost
+func (s *sender) expire(now int64) {
+	n := dccp.FlightExpired(len(s.flight), now, s.rtt(), func(i int) int64 { return s.flight[i].Sent })
+	if n > 0 {
+		s.flight = append(s.flight[:0], s.flight[n:]...)
+		s.lost += int64(n)
+		s.cut(now, fmt.Sprintf("%d timed out", n))
+	}
+}
+
+// Strobe blocks until the congestion window has room for another packet
+func (s *sender) Strobe() {
+	for {
+		s.Lock()
+		if !s.open {
+			s.Unlock()
+			return
+		}
+		s.expire(s.env.Now())
+		full := len(s.flight) >= int(s.cwnd)
+		s.Unlock()
+		if !full {
+			return
+		}
+		s.env.Sleep(PollWait)
+	}
+}
+
+func (s *sender) OnIdle(now int64) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.open {
+		s.expire(now)
+	}
+	return nil
+}
+
+func (s *sender) SetHeartbeat(interval int64) {}
+
+func (s *sender) Close() {
+	s.Lock()
+	defer s.Unlock()
+	s.open = false
+}
+
+// UnderstandsOption returns true for the options that the sender processes
+func (s *sender) UnderstandsOption(optionType byte) bool {
+	switch optionType {
+	case dccp.OptionTimestampEcho, dccp.OptionAckVectorNonce0, dccp.OptionAckVectorNonce1, OptionOneWayDelay:
+		return true
+	}
+	return false
+}
+
+// Status reports the congestion window, the queueing delay and the state of the flight
+func (s *sender) Status() map[string]float64 {
+	s.Lock()
+	defer s.Unlock()
+	queueing, _ := s.delay.Queueing()
+	return map[string]float64{
+		"Cwnd":           s.cwnd,
+		"Queueing-Delay": float64(queueing) / 1e6,
+		"RTT":            float64(s.rtt()) / 1e6,
+		"Inflight":       float64(len(s.flight)),
+		"Lost":           float64(s.lost),
+	}
+}
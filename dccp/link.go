@@ -28,7 +28,7 @@ type Link interface {
 	// SegmentConn.
 	ReadFrom(buf []byte) (n int, addr net.Addr, err error)
 
-	// WriteTo sends a packet of data
+	// WriteTo sends a packet of data. WriteTo must not retain buf after it returns.
 	WriteTo(buf []byte, addr net.Addr) (n int, err error)
 
 	// SetReadDeadline has the same meaning as net.Conn.SetReadDeadline
@@ -37,3 +37,46 @@ type Link interface {
 	// Close terminates the link gracefully
 	Close() error
 }
+
+// RebindLink is implemented by Link objects that can open another link of the same kind, bound
+// to a different local address. The Mux uses it to migrate flows, see PathConn.
+type RebindLink interface {
+	Link
+
+	// Rebind returns a new link bound to the local address laddr
+	Rebind(laddr net.Addr) (Link, error)
+}
+
+// Traffic classes for real-time media, after RFC 4594. A traffic class is the Type of Service
+// octet of IPv4 or the Traffic Class octet of IPv6: its upper six bits hold the DSCP, and its
+// lower two bits the ECN codepoint, which is left at ECNNotECT here.
+const (
+	TrafficClassBestEffort = 0       // Default forwarding, DSCP CS0
+	TrafficClassAF41       = 34 << 2 // Multimedia conferencing, DSCP AF41
+	TrafficClassEF         = 46 << 2 // Telephony, DSCP EF (Expedited Forwarding)
+)
+
+// TrafficClassLink is implemented by Link objects that can mark outgoing packets with an IP
+// traffic class, like UDPLink and IPLink on Linux. The Mux uses it to mark the packets of
+// individual flows, see TrafficClassConn.
+type TrafficClassLink interface {
+	Link
+
+	// SetTrafficClass sets the traffic class of the packets sent by WriteTo
+	SetTrafficClass(tos byte) error
+
+	// WriteToClass is like WriteTo, except that the packet is marked with traffic class tos
+	WriteToClass(buf []byte, addr net.Addr, tos byte) (n int, err error)
+}
+
+// BlockLink is implemented by Link objects that can hand over received packets without copying
+// them into a caller-supplied buffer. The Mux prefers ReadBlock over ReadFrom when available, so
+// that the payload returned by SegmentConn.Read is a slice of the very buffer that the link
+// received into.
+type BlockLink interface {
+	Link
+
+	// ReadBlock receives the next packet of data. Ownership of block passes to the caller,
+	// which may retain it indefinitely. Errors are returned as in ReadFrom.
+	ReadBlock() (block []byte, addr net.Addr, err error)
+}
@@ -0,0 +1,40 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+// Parameters of the loss detection of the sender CCIDs that keep track of their data packets
+// in flight and learn of the delivered ones from Ack Vectors
+const (
+	DupThresh   = 3     // Number of later data packets delivered, after which a packet is lost
+	LossTimeout = 200e6 // Minimum time after which an unacknowledged data packet is lost
+)
+
+// FlightOvertaken returns the number of leading packets of a flight of n data packets, in
+// increasing order of sequence number, that DupThresh later packets have overtaken, given that
+// highest is the greatest sequence number delivered. seqNo returns the sequence number of
+// the i-th packet. The packets overtaken are lost.
+func FlightOvertaken(n int, highest int64, seqNo func(i int) int64) int {
+	i := 0
+	for i < n && seqNo(i) < highest-DupThresh {
+		i++
+	}
+	return i
+}
+
+// FlightExpired returns the number of leading packets of a flight of n data packets, in
+// increasing order of sequence number, that have been unacknowledged at time now for longer
+// than twice the round-trip time rtt, and at least LossTimeout. sent returns the time of
+// sending of the i-th packet. The packets expired are lost.
+func FlightExpired(n int, now, rtt int64, sent func(i int) int64) int {
+	timeout := 2 * rtt
+	if timeout < LossTimeout {
+		timeout = LossTimeout
+	}
+	i := 0
+	for i < n && now-sent(i) > timeout {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,36 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"testing"
+)
+
+func TestFlightLoss(t *testing.T) {
+	seqNos := []int64{10, 11, 13, 14, 17}
+	sent := []int64{0, 50e6, 100e6, 250e6, 300e6}
+	seqNo := func(i int) int64 { return seqNos[i] }
+	for _, c := range []struct {
+		highest int64
+		want    int
+	}{
+		{ 12, 0 }, { 14, 1 }, { 16, 2 }, { 17, 3 }, { 30, 5 },
+	} {
+		if n := FlightOvertaken(len(seqNos), c.highest, seqNo); n != c.want {
+			t.Errorf("highest %d: %d packets overtaken, expecting %d", c.highest, n, c.want)
+		}
+	}
+	at := func(i int) int64 { return sent[i] }
+	for _, c := range []struct {
+		now, rtt int64
+		want     int
+	}{
+		{ 200e6, 10e6, 0 }, { 260e6, 10e6, 2 }, { 260e6, 120e6, 1 }, { 400e6, 120e6, 3 }, { 1e9, 10e6, 5 },
+	} {
+		if n := FlightExpired(len(sent), c.now, c.rtt, at); n != c.want {
+			t.Errorf("at %d with RTT %d: %d packets expired, expecting %d", c.now, c.rtt, n, c.want)
+		}
+	}
+}
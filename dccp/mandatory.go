@@ -0,0 +1,110 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+// Section 5.8.2: The option that follows a Mandatory option must be understood by the
+// receiver, or else the connection is reset with Reset Code 6, "Mandatory Error". Options of
+// unknown type are detected by the option parser. The options that parse, but that neither
+// the Conn nor its CCIDs process, are detected here.
+
+// understandsOption returns true if the Conn or one of its CCIDs processes options of type t
+func (c *Conn) understandsOption(t byte) bool {
+	switch t {
+	case OptionInitCookie, OptionDataDropped, OptionDataChecksum, OptionChangeL, OptionConfirmL, OptionChangeR, OptionConfirmR:
+		return true
+	}
+	if isOptionCCIDReceiverToSender(t) && understands(c.scc(), t) {
+		return true
+	}
+	if isOptionCCIDSenderToReceiver(t) && understands(c.rcc(), t) {
+		return true
+	}
+	return false
+}
+
+// understands returns true if the congestion control cc implements OptionUnderstander and
+// understands options of type t
+func understands(cc interface{}, t byte) bool {
+	u, ok := cc.(OptionUnderstander)
+	return ok && u.UnderstandsOption(t)
+}
+
+// checkMandatory records the first Mandatory option of h that is not understood as the
+// option fault of h, unless the option parser found a fault already
+func (c *Conn) checkMandatory(h *Header) {
+	if h.optionFault != optionFaultNone {
+		return
+	}
+	if o, found := h.findMandatory(c.understandsOption); found {
+		h.optionFault, h.optionFaultType = optionFaultMandatory, o.Type
+	}
+}
+
+// findMandatory returns the first Mandatory option of gh whose type does not satisfy
+// understood. Options that have not been parsed yet are decoded without allocating.
+func (gh *Header) findMandatory(understood func(byte) bool) (o Option, found bool) {
+	if gh.Options != nil || len(gh.rawOptions) == 0 {
+		for _, p := range gh.Options {
+			if p.Mandatory && !understood(p.Type) {
+				return p, true
+			}
+		}
+		return Option{}, false
+	}
+	r := optionReader{buf: gh.rawOptions, typ: gh.Type}
+	for r.next(&o) {
+		if o.Mandatory && !understood(o.Type) {
+			return o, true
+		}
+	}
+	return Option{}, false
+}
+
+// mandatoryErrorData returns the Reset Data of the Mandatory Error Reset sent in response to
+// gh, Section 5.6: The type of the offending option, followed by the first two bytes of its
+// data. The data is zero if it is shorter, or if the option could not be parsed.
+func (gh *Header) mandatoryErrorData() []byte {
+	o, found := gh.findMandatory(func(t byte) bool { return t != gh.optionFaultType })
+	if !found {
+		return []byte{gh.optionFaultType, 0, 0}
+	}
+	return mandatoryResetData(&o)
+}
+
+// mandatoryResetData returns the Reset Data that reports the Mandatory option o
+func mandatoryResetData(o *Option) []byte {
+	d := []byte{o.Type, 0, 0}
+	copy(d[1:], o.Data)
+	return d
+}
+
+// SetMandatory sets whether the options of type optionType that the Conn sends, including
+// those placed by its CCIDs, are marked Mandatory, Section 5.8.2, so that a peer that does
+// not understand them resets the connection rather than ignoring them. Options are never
+// marked on Data packets, which may not carry a Mandatory option.
+func (c *Conn) SetMandatory(optionType byte, mandatory bool) {
+	c.Lock()
+	defer c.Unlock()
+	// The map is replaced rather than modified, so that the write path can use it unlocked
+	m := make(map[byte]bool, len(c.mandatory)+1)
+	for t, v := range c.mandatory {
+		m[t] = v
+	}
+	m[optionType] = mandatory
+	c.mandatory = m
+}
+
+// placeMandatory marks the options of h whose types are set in mandatory, as read from the
+// Conn by the write path
+func placeMandatory(h *writeHeader, mandatory map[byte]bool) {
+	if len(mandatory) == 0 || h.Type == Data {
+		return
+	}
+	for i := range h.Options {
+		if o := &h.Options[i]; !o.Mandatory && mandatory[o.Type] {
+			o.Mandatory = true
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"bytes"
+	"testing"
+)
+
+var mandatoryTests = []struct {
+	opt       *Option
+	fault     bool
+	resetData []byte
+}{
+	{&Option{OptionDataDropped, []byte{0x20}, true}, false, nil},
+	{&Option{OptionDataDropped, []byte{0x20}, false}, false, nil},
+	{&Option{OptionElapsedTime, []byte{1, 2, 3, 4}, false}, false, nil},
+	{&Option{OptionElapsedTime, []byte{1, 2, 3, 4}, true}, true, []byte{OptionElapsedTime, 1, 2}},
+	{&Option{OptionChangeL, []byte{9}, true}, false, nil},
+	{&Option{OptionNDPCount, []byte{9}, true}, true, []byte{OptionNDPCount, 9, 0}},
+}
+
+// TestMandatory checks that Mandatory options that the Conn and its CCIDs do not understand
+// are detected, with the Reset Data that reports them
+func TestMandatory(t *testing.T) {
+	env := NewEnv(nil)
+	c := &Conn{}
+	c.ccids.Store(&ccidPair{ newFixedRateSenderControl(env, 1e6), newFixedRateReceiverControl(env) })
+	for i, x := range mandatoryTests {
+		gh := &Header{ Type: Ack, X: true, SeqNo: 5, AckNo: 3, Options: []Option{*x.opt} }
+		buf, err := gh.Write([]byte{1, 2, 3, 4}, []byte{5, 6, 7, 8}, 34, false)
+		if err != nil {
+			t.Fatalf("#%d: write (%s)", i, err)
+		}
+		if gh, err = ReadHeader(buf, []byte{1, 2, 3, 4}, []byte{5, 6, 7, 8}, 34, false); err != nil {
+			t.Fatalf("#%d: read (%s)", i, err)
+		}
+		c.checkMandatory(gh)
+		if (gh.optionFault == optionFaultMandatory) != x.fault {
+			t.Errorf("#%d: %s", i, gh.optionFaultString())
+			continue
+		}
+		if x.fault && !bytes.Equal(gh.mandatoryErrorData(), x.resetData) {
+			t.Errorf("#%d: reset data %v, expecting %v", i, gh.mandatoryErrorData(), x.resetData)
+		}
+	}
+
+	// Options are marked on Acks, but not on Data packets
+	c.SetMandatory(OptionElapsedTime, true)
+	for _, typ := range []byte{Ack, Data} {
+		opt := &Option{OptionElapsedTime, []byte{1, 2}, false}
+		h := &writeHeader{}
+		h.Type, h.Options = typ, []Option{*opt}
+		placeMandatory(h, c.mandatory)
+		if h.Options[0].Mandatory != (typ == Ack) || opt.Mandatory {
+			t.Errorf("%s: mandatory %v, original %v", TypeString(typ), h.Options[0].Mandatory, opt.Mandatory)
+		}
+	}
+}
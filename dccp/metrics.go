@@ -0,0 +1,153 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Metrics is a TraceWriter which derives counters and gauges from the traces of a DCCP
+// stack and exposes them in the Prometheus text format. It is optional: attach it to an Env,
+// usually alongside other TraceWriters via a MultiTraceWriter, and either mount it as an
+// http.Handler or call WriteTo from an existing /metrics handler.
+//
+// Counters are labeled with the first label of the Amb that emitted a trace, e.g. "client" or
+// "server". The dccp_connections gauge follows each connection by its number, Trace.Conn,
+// and stops following it once it reaches CLOSED.
+type Metrics struct {
+	sync.Mutex
+	state   map[uint64]string          // Latest DCCP state of each connection that is not CLOSED
+	values  map[string]map[string]float64 // Metric name -> label set -> value
+}
+
+type metricInfo struct {
+	kind string
+	help string
+}
+
+var metricInfos = map[string]metricInfo{
+	"dccp_connections":    { "gauge", "Number of connections in each DCCP state other than CLOSED." },
+	"dccp_packets_total":  { "counter", "Packets read and written, by direction and DCCP type." },
+	"dccp_drops_total":    { "counter", "Packets dropped." },
+	"dccp_resets_total":   { "counter", "Reset packets written." },
+	"dccp_sample":         { "gauge", "Latest value of each sample series, e.g. RTT, loss event rate and allowed sending rate." },
+}
+
+// NewMetrics creates an empty metrics registry
+func NewMetrics() *Metrics {
+	return &Metrics{
+		state:  make(map[uint64]string),
+		values: make(map[string]map[string]float64),
+	}
+}
+
+func metricLabels(pairs ...string) string {
+	var w []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		v := strings.Replace(pairs[i+1], `\`, `\\`, -1)
+		v = strings.Replace(v, `"`, `\"`, -1)
+		w = append(w, fmt.Sprintf(`%s="%s"`, pairs[i], v))
+	}
+	return "{" + strings.Join(w, ",") + "}"
+}
+
+func (t *Metrics) add(name, labels string, delta float64) {
+	m, ok := t.values[name]
+	if !ok {
+		m = make(map[string]float64)
+		t.values[name] = m
+	}
+	m[labels] += delta
+}
+
+func (t *Metrics) set(name, labels string, value float64) {
+	t.add(name, labels, value - t.values[name][labels])
+}
+
+// Write implements TraceWriter.Write
+func (t *Metrics) Write(r *Trace) {
+	if len(r.Labels) == 0 {
+		return
+	}
+	conn := r.Labels[0]
+	t.Lock()
+	defer t.Unlock()
+
+	if r.Conn != 0 && r.State != "" && t.state[r.Conn] != r.State {
+		if old, ok := t.state[r.Conn]; ok {
+			t.add("dccp_connections", metricLabels("state", old), -1)
+		}
+		// Connections start and end in CLOSED, which is not counted
+		if r.State == StateString(CLOSED) {
+			delete(t.state, r.Conn)
+		} else {
+			t.state[r.Conn] = r.State
+			t.add("dccp_connections", metricLabels("state", r.State), 1)
+		}
+	}
+	switch r.Event {
+	case EventRead, EventWrite:
+		if r.Type == "" {
+			break
+		}
+		t.add("dccp_packets_total", metricLabels("conn", conn, "dir", strings.ToLower(r.Event.String()), "type", r.Type), 1)
+		if r.Event == EventWrite && r.Type == TypeString(Reset) {
+			t.add("dccp_resets_total", metricLabels("conn", conn), 1)
+		}
+	case EventDrop:
+		t.add("dccp_drops_total", metricLabels("conn", conn), 1)
+	}
+	if sample, ok := r.Sample(); ok {
+		t.set("dccp_sample", metricLabels("conn", conn, "series", sample.Series, "unit", sample.Unit), sample.Value)
+	}
+}
+
+func (t *Metrics) Sync() error { return nil }
+
+func (t *Metrics) Close() error { return nil }
+
+// WriteTo writes all metrics to w in the Prometheus text exposition format
+func (t *Metrics) WriteTo(w io.Writer) (int64, error) {
+	t.Lock()
+	defer t.Unlock()
+	var names []string
+	for name := range t.values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var total int64
+	for _, name := range names {
+		info := metricInfos[name]
+		n, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, info.help, name, info.kind)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+		var labels []string
+		for l := range t.values[name] {
+			labels = append(labels, l)
+		}
+		sort.Strings(labels)
+		for _, l := range labels {
+			n, err = fmt.Fprintf(w, "%s%s %g\n", name, l, t.values[name][l])
+			total += int64(n)
+			if err != nil {
+				return total, err
+			}
+		}
+	}
+	return total, nil
+}
+
+// ServeHTTP serves the metrics in the Prometheus text exposition format
+func (t *Metrics) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	t.WriteTo(w)
+}
@@ -0,0 +1,119 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+)
+
+const (
+	MIGRATE_BACKOFF_FIRST      = 200e6    // Initial re-send period for Syncs probing a new path, 200 miliseconds in ns
+	MIGRATE_BACKOFF_FREQ       = 1e9      // Back-off Sync resend every sec, in ns
+	MIGRATE_BACKOFF_TIMEOUT    = 30e9     // Abort if the new path is not validated within 30 sec, in ns
+)
+
+// Migrate moves the local end of an established connection to the Link-level address laddr,
+// for instance when a mobile host moves from Wi-Fi to a cellular network. It requires that
+// the underlying HeaderConn implements PathConn, as the flows of a Mux over a UDPLink do, and
+// returns ErrUnsupported otherwise.
+//
+// The Conn then probes the new path with Syncs and holds back application data until the peer
+// answers one of them with a SyncAck. The peer switches to the new address once it receives
+// a valid packet from it. Both sides restart their congestion control, since its state
+// describes the old path. If the new path is not validated within MIGRATE_BACKOFF_TIMEOUT,
+// the connection is aborted.
+func (c *Conn) Migrate(laddr net.Addr) error {
+	pc, ok := c.hc.(PathConn)
+	if !ok {
+		return ErrUnsupported
+	}
+	if c.loadState() != OPEN {
+		return ErrBad
+	}
+	if err := pc.Migrate(laddr); err != nil {
+		return err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if c.socket.GetState() != OPEN {
+		return ErrBad
+	}
+	gss := c.socket.GetGSS()
+	c.migrateGSS = gss
+	atomic.StoreInt32(&c.validating, 1)
+	c.amb.E(EventInfo, fmt.Sprintf("Migrate to %s", laddr))
+	c.resetCCID()
+	c.inject(c.generateSync(c.socket.GetGSR()))
+
+	// Resend the Sync using exponential backoff, until a SyncAck validates the path
+	b := newBackOff(c.env, MIGRATE_BACKOFF_FIRST, MIGRATE_BACKOFF_TIMEOUT, MIGRATE_BACKOFF_FREQ)
+	b.Go(func(err error, _ int64) bool {
+		if c.loadState() != OPEN || !c.isValidating() {
+			return false
+		}
+		c.Lock()
+		// A later migration takes over
+		if c.migrateGSS != gss {
+			c.Unlock()
+			return false
+		}
+		// If the back-off timer has reached maximum wait, give up on the connection
+		if err != nil {
+			c.amb.E(EventWarn, "Path not validated")
+			c.Unlock()
+			c.abort()
+			return false
+		}
+		c.amb.E(EventTurn, "Migration Sync resend")
+		c.inject(c.generateSync(c.socket.GetGSR()))
+		c.Unlock()
+		return true
+	}, "Migrate")
+	return nil
+}
+
+// isValidating returns true while the path that the Conn migrated to is unconfirmed
+func (c *Conn) isValidating() bool { return atomic.LoadInt32(&c.validating) != 0 }
+
+// validatePath resumes the sending of application data if the SyncAck h answers a Sync sent
+// on the path that the Conn migrated to
+func (c *Conn) validatePath(h *Header) {
+	c.AssertLocked()
+	if !c.isValidating() || h.AckNo <= c.migrateGSS {
+		return
+	}
+	atomic.StoreInt32(&c.validating, 0)
+	c.amb.E(EventMatch, "Path validated", h)
+	c.inject(nil) // Unblocks the writeLoop select, so it can see the change
+}
+
+// confirmPath follows the peer to the Link-level address that the valid packet h was received
+// from, in case the peer has migrated. Packets older than the greatest sequence number received
+// do not move the path, so that late packets from the old address do not undo a migration.
+func (c *Conn) confirmPath(h *Header) {
+	c.AssertLocked()
+	pc, ok := c.hc.(PathConn)
+	if !ok || h.SeqNo < c.socket.GetGSR() {
+		return
+	}
+	if !pc.ConfirmPath() {
+		return
+	}
+	c.amb.E(EventInfo, "Peer migrated", h)
+	c.resetCCID()
+}
+
+// resetCCID restarts the congestion controls, whose state describes a path no longer in use
+func (c *Conn) resetCCID() {
+	c.AssertLocked()
+	if !c.ccidOpen {
+		return
+	}
+	c.closeCCID()
+	c.openCCID()
+}
@@ -6,30 +6,146 @@ package dccp
 
 import (
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
-// An instance of monotoneTime has the singular function of returning the time Now.
-// It has the property that consecutive invokations return strictly increasing numbers.
-// This may provide superfluous logic, but we use it for piece of mind.
-type monotoneTime struct {
-	sync.Mutex
-	env  *Env
-	last int64
+// Clock is the time of an Env, as seen by the DCCP logic. Its readings never decrease, even
+// if the underlying Time does, so that a step back of the clock cannot produce negative
+// round-trip times, elapsed times or timeouts. A Clock runs on real or on virtual time alike,
+// whichever Time its Env was created with.
+type Clock interface {
+	Time
+	PreciseTime
 }
 
-func (x *monotoneTime) Init(env *Env) {
-	x.env = env
-	x.last = 0
+// monoClock is the Clock of an Env. It reads the Time of the Env and holds its readings at the
+// latest one seen while the Time is behind it.
+type monoClock struct {
+	last    int64 // Latest reading, accessed atomically; first, to be 64-bit aligned
+	steps   int64 // Readings that were behind the latest one, accessed atomically
+	time    Time
+	sleeper sleepAlarm // Sets the alarms if time is not an AlarmTime
 }
 
-func (x *monotoneTime) Now() int64 {
-	x.Lock()
-	defer x.Unlock()
-	now := x.env.Now()
-	// TODO: If now - x.last is hugely negative we might want to report some sort of error
-	if now < x.last {
-		panic("negative time in mono")
+func (x *monoClock) Init(t Time) {
+	x.time = t
+	x.last = t.Now()
+	x.steps = 0
+}
+
+// Now implements Time.Now
+func (x *monoClock) Now() int64 {
+	now := x.time.Now()
+	for {
+		last := atomic.LoadInt64(&x.last)
+		if now < last {
+			atomic.AddInt64(&x.steps, 1)
+			return last
+		}
+		if atomic.CompareAndSwapInt64(&x.last, last, now) {
+			return now
+		}
+	}
+}
+
+// Sleep implements Time.Sleep
+func (x *monoClock) Sleep(ns int64) {
+	x.time.Sleep(ns)
+}
+
+// SleepUntil implements PreciseTime.SleepUntil. If the Time is not a PreciseTime, it sleeps
+// for the time remaining until t.
+func (x *monoClock) SleepUntil(t int64) {
+	if p, ok := x.time.(PreciseTime); ok {
+		p.SleepUntil(t)
+		return
 	}
-	x.last = max64(now, x.last)
-	return x.last
+	if d := t - x.Now(); d > 0 {
+		x.time.Sleep(d)
+	}
+}
+
+// Alarm implements AlarmTime.Alarm. If the Time is not an AlarmTime, the alarm is set on the
+// sleepAlarm of the clock.
+func (x *monoClock) Alarm(ns int64) (<-chan time.Time, func() bool) {
+	if a, ok := x.time.(AlarmTime); ok {
+		return a.Alarm(ns)
+	}
+	return x.sleeper.Alarm(ns)
+}
+
+// sleepAlarm sets alarms on a Time that is not an AlarmTime. Only one alarm is set at a time;
+// setting another replaces it. A single goroutine, started through the Env, sleeps on behalf
+// of one alarm after another, in steps of at most WheelTick, so that it notices within a tick
+// when an alarm is stopped or replaced by an earlier one. The goroutine exits once it has
+// slept a step without an alarm, so that the Env can be joined.
+type sleepAlarm struct {
+	env     *Env
+	lk      sync.Mutex
+	set     bool  // True while an alarm is set
+	due     int64 // Time at which the alarm goes off
+	running bool  // True while the sleeping goroutine is alive
+	ch      chan time.Time
+}
+
+// Alarm sets the alarm to go off after ns nanoseconds, replacing the alarm set before, if any
+func (a *sleepAlarm) Alarm(ns int64) (<-chan time.Time, func() bool) {
+	a.lk.Lock()
+	defer a.lk.Unlock()
+	if a.ch == nil {
+		a.ch = make(chan time.Time, 1)
+	}
+	// An alarm that went off after it was stopped must not wake up the receiver of this one
+	select {
+	case <-a.ch:
+	default:
+	}
+	a.set, a.due = true, a.env.Now()+ns
+	if !a.running {
+		a.running = true
+		a.env.Go(a.loop, "Env·sleepAlarm")
+	}
+	return a.ch, a.stop
+}
+
+// stop cancels the alarm. It returns false if the alarm had already gone off.
+func (a *sleepAlarm) stop() bool {
+	a.lk.Lock()
+	defer a.lk.Unlock()
+	set := a.set
+	a.set = false
+	return set
+}
+
+func (a *sleepAlarm) loop() {
+	idle := false
+	for {
+		a.lk.Lock()
+		step := int64(WheelTick)
+		if a.set {
+			idle = false
+			if d := a.due - a.env.Now(); d > 0 {
+				step = min64(d, step)
+			} else {
+				a.set = false
+				a.ch <- time.Time{}
+				a.lk.Unlock()
+				continue
+			}
+		} else if idle {
+			a.running = false
+			a.lk.Unlock()
+			return
+		} else {
+			idle = true
+		}
+		a.lk.Unlock()
+		a.env.Sleep(step)
+	}
+}
+
+// Steps returns the number of readings of the Time that were behind an earlier one
+func (x *monoClock) Steps() int64 {
+	return atomic.LoadInt64(&x.steps)
 }
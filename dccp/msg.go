@@ -0,0 +1,117 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+// ECN codepoints of the IP header, RFC 3168, as reported in Header.ECN and ReadMeta.ECN.
+// Links that do not report ECN leave the codepoint at ECNNotECT.
+const (
+	ECNNotECT = 0 // Not ECN-Capable Transport
+	ECNECT1   = 1 // ECN-Capable Transport, ECT(1)
+	ECNECT0   = 2 // ECN-Capable Transport, ECT(0)
+	ECNCE     = 3 // Congestion Experienced
+)
+
+// WriteMeta holds the metadata of a message written with WriteMsg
+type WriteMeta struct {
+	// CsCov is the checksum coverage of the packet carrying the message, Section 9.2. Zero
+	// covers the whole packet. Otherwise the checksum covers the header and the first
+	// (CsCov-1)*4 bytes of the message, so that a receiver can pass on messages whose
+	// uncovered tail was damaged in transit. Partial coverage below the Minimum Checksum
+	// Coverage feature of the peer, Section 9.2.1, is not accepted.
+	CsCov byte
+
+	// Deadline is the Env time, in nanoseconds, after which the message is no longer worth
+	// sending. A message that is still queued, or that the congestion control holds back, past
+	// its deadline is dropped and reported on Drops. Zero means no deadline.
+	Deadline int64
+
+	// Priority is the importance of the message relative to the other queued messages, with
+	// higher values being more important. It is used by the QueuePriority queue policy and
+	// ignored by the others.
+	Priority int
+
+	// PadTo is the wire size, in bytes, that the packet carrying the message is padded to
+	// with Padding options, overriding the size set by SetPadding. Zero leaves the packet to
+	// the padding of the Conn.
+	PadTo int
+}
+
+// ReadMeta holds the metadata of a message received with ReadMsg
+type ReadMeta struct {
+	SeqNo int64 // Sequence number of the packet that carried the message
+	Time  int64 // Env time at which the packet was received, in nanoseconds
+	CCVal int8  // CCVal of the packet, set by the sender's CCID, Section 5.1
+	CsCov byte  // Checksum coverage of the packet, see WriteMeta.CsCov
+	ECN   byte  // ECN codepoint of the packet, if reported by the link and the Conn is not ECN Incapable
+
+	// Corrupt is set if the message failed its Data Checksum, Section 9.3, and was delivered
+	// since SetDeliverCorrupt asked for it
+	Corrupt bool
+}
+
+// readMsg is a message passed from the read loop to ReadMsg
+type readMsg struct {
+	data []byte
+	meta ReadMeta
+}
+
+// WriteMsg is like Write, except that it attaches the metadata meta to the message. Each
+// message is sent in a packet of its own, so message boundaries are preserved. If the
+// checksum coverage of meta exceeds the length of data, or is below the Minimum Checksum
+// Coverage of the peer, WriteMsg returns ErrCsCov.
+func (c *Conn) WriteMsg(data []byte, meta WriteMeta) error {
+	if _, err := getChecksumAppCoverage(meta.CsCov, len(data)); err != nil {
+		return err
+	}
+	if err := c.checkSendCsCov(meta.CsCov); err != nil {
+		return err
+	}
+	return c.push(data, meta)
+}
+
+// push queues data with metadata meta for sending, and reports the queued message that the
+// queue policy drops to make room for it, if any
+func (c *Conn) push(data []byte, meta WriteMeta) error {
+	if max := c.GetMTU(); len(data) > max {
+		return TooLargeError{ Max: max }
+	}
+	evicted, err := c.writeQueue.pushMsg(data, meta)
+	if evicted != nil {
+		c.reportDrop(DropOverflow, evicted.Data, evicted.Meta)
+	}
+	if err == nil {
+		c.journalWrite(data, meta)
+	}
+	return err
+}
+
+// ReadMsg is like Read, except that it also returns the metadata of the packet that carried
+// the message
+func (c *Conn) ReadMsg() (b []byte, meta ReadMeta, err error) {
+	c.readAppLk.Lock()
+	readApp := c.readApp
+	c.readAppLk.Unlock()
+	if readApp == nil {
+		return nil, ReadMeta{}, c.readError()
+	}
+	m, ok := <-readApp
+	if !ok {
+		// The connection has been closed, or its reading half
+		return nil, ReadMeta{}, c.readError()
+	}
+	c.journalAdd(&JournalEntry{ Kind: JournalRead })
+	return m.data, m.meta, nil
+}
+
+// readError returns the error that ReadMsg returns once no more data is delivered
+func (c *Conn) readError() error {
+	if err := c.Error(); err != nil {
+		return err
+	}
+	if c.isReadClosed() {
+		return ErrEOF
+	}
+	panic("torn connection missing error\n" + c.Dump().String())
+}
@@ -0,0 +1,276 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+// Package multipath is an experimental implementation of multipath DCCP, after the
+// architecture of the MP-DCCP drafts of the IETF. A Conn bonds several DCCP connections,
+// called subflows, each over a path of its own, into a single connection.
+//
+// Each subflow is a dccp.Conn with CCID3 instances of its own, so congestion is controlled
+// per path. A Scheduler picks the subflow that carries each message written to the Conn. Every
+// message is preceded by a data sequence number, and a reordering module at the receiving end
+// puts the messages of all subflows back in order, giving up on missing ones after a while.
+//
+// The package departs from the drafts in that the data sequence number is carried at the
+// start of the payload, rather than in a DCCP option, and in that it does not establish
+// subflows itself: the application connects the subflows over the paths it chooses, with
+// NewClientSubflow and NewServerSubflow, and passes them to both ends in the same order. Lost
+// messages are not sent again on another path.
+package multipath
+
+import (
+	"encoding/binary"
+	"sync"
+	"github.com/petar/GoDCCP/dccp"
+	"github.com/petar/GoDCCP/dccp/ccid3"
+)
+
+// dsnLen is the length of the data sequence number at the start of each message
+const dsnLen = 8
+
+// NewClientSubflow creates the client end of a subflow over hc, with CCID3 congestion control
+func NewClientSubflow(env *dccp.Env, amb *dccp.Amb, hc dccp.HeaderConn, serviceCode uint32) *dccp.Conn {
+	ccid := ccid3.CCID3{}
+	return dccp.NewConnClient(env, amb, hc, ccid.NewSender(env, amb), ccid.NewReceiver(env, amb), serviceCode)
+}
+
+// NewServerSubflow creates the server end of a subflow over hc, with CCID3 congestion control
+func NewServerSubflow(env *dccp.Env, amb *dccp.Amb, hc dccp.HeaderConn) *dccp.Conn {
+	ccid := ccid3.CCID3{}
+	return dccp.NewConnServer(env, amb, hc, ccid.NewSender(env, amb), ccid.NewReceiver(env, amb))
+}
+
+// Conn is a multipath connection. Like a dccp.Conn, it delivers messages, not a byte stream,
+// and it does not retransmit lost messages. Read and Write can be called concurrently with
+// each other.
+type Conn struct {
+	env    *dccp.Env
+	in     chan received // Messages and errors passed from the read loops of the subflows to Read
+	closed chan struct{} // Closed by Close
+
+	wlk   sync.Mutex
+	sched Scheduler
+	next  uint64 // Data sequence number of the next message to be written
+
+	lk       sync.Mutex   // Protects the variables below
+	subflows []*dccp.Conn // Subflows that accept messages for sending
+	live     int          // Number of subflows whose read loop has not ended
+	err      error        // Error that ended the read loop of the last subflow
+	closing  bool
+
+	rlk     sync.Mutex
+	reorder reorder
+}
+
+// received is a message of a subflow, or the error that ended the subflow's read loop
+type received struct {
+	dsn  uint64
+	data []byte
+	err  error
+}
+
+// New creates a Conn that bonds subflows, which must be given in the same order at both ends.
+// The Conn takes over the subflows: the application must not read from or write to them
+// directly. If sched is nil, the MinRTT scheduler is used.
+func New(env *dccp.Env, sched Scheduler, subflows ...*dccp.Conn) *Conn {
+	if sched == nil {
+		sched = MinRTT{}
+	}
+	c := &Conn{
+		env:    env,
+		in:     make(chan received, ReorderWindow),
+		closed: make(chan struct{}),
+		sched:  sched,
+	}
+	c.reorder.Init()
+	for _, sf := range subflows {
+		c.AddSubflow(sf)
+	}
+	return c
+}
+
+// AddSubflow adds the subflow sf, for instance over a path that has just become available
+func (c *Conn) AddSubflow(sf *dccp.Conn) error {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	if c.closing {
+		return dccp.ErrBad
+	}
+	c.subflows = append(c.subflows, sf)
+	c.live++
+	c.env.Go(func() { c.readLoop(sf) }, "multipath·readLoop")
+	return nil
+}
+
+// Subflows returns the number of subflows that accept messages for sending
+func (c *Conn) Subflows() int {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	return len(c.subflows)
+}
+
+// Lost returns the number of messages that Read has given up on
+func (c *Conn) Lost() int64 {
+	c.rlk.Lock()
+	defer c.rlk.Unlock()
+	return c.reorder.lost
+}
+
+// GetMTU returns the largest message that can be sent on every subflow
+func (c *Conn) GetMTU() int {
+	c.lk.Lock()
+	subflows := c.subflows
+	c.lk.Unlock()
+	mtu := 0
+	for i, sf := range subflows {
+		if m := sf.GetMTU() - dsnLen; i == 0 || m < mtu {
+			mtu = m
+		}
+	}
+	return mtu
+}
+
+// Write sends data on the subflow chosen by the scheduler. A subflow that no longer accepts
+// data is removed, and the message is sent on another one. Write returns ErrBad once no
+// subflow is left.
+func (c *Conn) Write(data []byte) error {
+	c.wlk.Lock()
+	defer c.wlk.Unlock()
+	msg := make([]byte, dsnLen+len(data))
+	binary.BigEndian.PutUint64(msg, c.next)
+	copy(msg[dsnLen:], data)
+	for {
+		c.lk.Lock()
+		subflows := c.subflows
+		c.lk.Unlock()
+		if len(subflows) == 0 {
+			return dccp.ErrBad
+		}
+		paths := make([]Path, len(subflows))
+		for i, sf := range subflows {
+			paths[i] = Path{ RTT: sf.RTT(), Queued: sf.Queued() }
+		}
+		sf := subflows[c.sched.Pick(paths)]
+		if err := sf.Write(msg); err == nil {
+			c.next++
+			return nil
+		}
+		c.removeSubflow(sf)
+	}
+}
+
+// removeSubflow stops scheduling messages on sf
+func (c *Conn) removeSubflow(sf *dccp.Conn) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	for i, s := range c.subflows {
+		if s == sf {
+			c.subflows = append(c.subflows[:i:i], c.subflows[i+1:]...)
+			return
+		}
+	}
+}
+
+// Read returns the next message in the order written, skipping the messages given up on. Once
+// all subflows have ended and all messages have been read, Read returns the error that ended
+// the last subflow, which is dccp.ErrEOF if it was closed normally.
+func (c *Conn) Read() ([]byte, error) {
+	c.rlk.Lock()
+	defer c.rlk.Unlock()
+	for {
+		c.lk.Lock()
+		ended, err := c.live == 0, c.err
+		c.lk.Unlock()
+		now := c.env.Now()
+		if data, ok := c.reorder.Pop(now, ended); ok {
+			return data, nil
+		}
+		if ended {
+			if err == nil {
+				err = dccp.ErrBad
+			}
+			return nil, err
+		}
+
+		// Wait for a message, or for the time to give up on a missing one
+		var timer *dccp.Timer
+		var expired chan struct{}
+		if d := c.reorder.Deadline(); d >= 0 {
+			expired = make(chan struct{})
+			timer = c.env.AfterFunc(d-now, func() { close(expired) }, "multipath·Read")
+		}
+		select {
+		case r := <-c.in:
+			if r.err != nil {
+				c.lk.Lock()
+				c.live--
+				c.err = r.err
+				c.lk.Unlock()
+			} else {
+				c.reorder.Push(r.dsn, r.data, c.env.Now())
+			}
+		case <-expired:
+		case <-c.closed:
+			if timer != nil {
+				timer.Stop()
+			}
+			return nil, dccp.ErrBad
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// readLoop passes the messages received on sf to Read, until sf ends or the Conn is closed
+func (c *Conn) readLoop(sf *dccp.Conn) {
+	for {
+		b, err := sf.Read()
+		var r received
+		switch {
+		case err != nil:
+			r.err = err
+		case len(b) < dsnLen:
+			continue // Not a message of the Conn
+		default:
+			r.dsn, r.data = binary.BigEndian.Uint64(b), b[dsnLen:]
+		}
+		select {
+		case c.in <- r:
+		case <-c.closed:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Close closes all subflows, once the messages written so far have been sent. Read returns
+// ErrBad afterwards.
+func (c *Conn) Close() error {
+	c.wlk.Lock()
+	defer c.wlk.Unlock()
+	c.lk.Lock()
+	if c.closing {
+		c.lk.Unlock()
+		return dccp.ErrBad
+	}
+	c.closing = true
+	subflows := c.subflows
+	c.subflows = nil
+	c.lk.Unlock()
+	close(c.closed)
+
+	var err error
+	for _, sf := range subflows {
+		e := sf.Flush()
+		if e == nil {
+			e = sf.Close()
+		}
+		if e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
@@ -0,0 +1,96 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package multipath
+
+const (
+	// ReorderWindow is the number of messages that may arrive ahead of a missing message
+	// before the missing message is considered lost
+	ReorderWindow = 64
+
+	// ReorderTimeout is the time in nanoseconds that messages wait for a missing message
+	// that precedes them, before the missing message is considered lost. It should exceed
+	// the difference between the one-way delays of the paths.
+	ReorderTimeout = 500e6
+)
+
+// arrival is a received message waiting in the reorder buffer
+type arrival struct {
+	data []byte
+	time int64 // Env time of arrival, in nanoseconds
+}
+
+// reorder puts the messages received on all subflows back into the order in which they were
+// written. Since DCCP does not retransmit, a missing message is given up on, once
+// ReorderWindow messages are waiting behind it or the oldest of them has waited for
+// ReorderTimeout.
+type reorder struct {
+	expect  uint64             // Data sequence number of the next message to be delivered
+	pending map[uint64]arrival // Messages that arrived ahead of message expect
+	lost    int64              // Number of messages given up on
+}
+
+func (r *reorder) Init() {
+	r.expect = 0
+	r.pending = make(map[uint64]arrival)
+	r.lost = 0
+}
+
+// Push adds the message with data sequence number dsn, received at time now. Messages that
+// were delivered or given up on already are discarded.
+func (r *reorder) Push(dsn uint64, data []byte, now int64) {
+	if dsn < r.expect {
+		return
+	}
+	if _, ok := r.pending[dsn]; ok {
+		return
+	}
+	r.pending[dsn] = arrival{ data: data, time: now }
+}
+
+// Pop returns the next message in order, if it is available at time now. If flush is set,
+// because no more messages will arrive, the missing messages are given up on right away.
+func (r *reorder) Pop(now int64, flush bool) (data []byte, ok bool) {
+	if len(r.pending) == 0 {
+		return nil, false
+	}
+	if _, ok := r.pending[r.expect]; !ok {
+		first, oldest := r.first()
+		if !flush && len(r.pending) < ReorderWindow && now-oldest < ReorderTimeout {
+			return nil, false
+		}
+		r.lost += int64(first - r.expect)
+		r.expect = first
+	}
+	a := r.pending[r.expect]
+	delete(r.pending, r.expect)
+	r.expect++
+	return a.data, true
+}
+
+// Deadline returns the time at which the missing message that holds up the pending ones is
+// given up on, or -1 if no message is pending
+func (r *reorder) Deadline() int64 {
+	if len(r.pending) == 0 {
+		return -1
+	}
+	_, oldest := r.first()
+	return oldest + ReorderTimeout
+}
+
+// first returns the lowest data sequence number and the earliest arrival time among the
+// pending messages
+func (r *reorder) first() (dsn uint64, oldest int64) {
+	started := false
+	for k, a := range r.pending {
+		if !started || k < dsn {
+			dsn = k
+		}
+		if !started || a.time < oldest {
+			oldest = a.time
+		}
+		started = true
+	}
+	return dsn, oldest
+}
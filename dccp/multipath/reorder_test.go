@@ -0,0 +1,51 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package multipath
+
+import "testing"
+
+func TestReorder(t *testing.T) {
+	var r reorder
+	r.Init()
+	pop := func(now int64, flush bool, want int) {
+		data, ok := r.Pop(now, flush)
+		switch {
+		case want < 0 && ok:
+			t.Errorf("at %d: popped %v, expecting nothing", now, data)
+		case want >= 0 && (!ok || data[0] != byte(want)):
+			t.Errorf("at %d: popped %v (%v), expecting %d", now, data, ok, want)
+		}
+	}
+	// Messages that overtake a missing one wait for it
+	r.Push(1, []byte{1}, 0)
+	r.Push(2, []byte{2}, 10)
+	pop(20, false, -1)
+	r.Push(0, []byte{0}, 30)
+	r.Push(0, []byte{0}, 40) // Duplicate
+	pop(40, false, 0)
+	pop(40, false, 1)
+	pop(40, false, 2)
+	pop(40, false, -1)
+
+	// A missing message is given up on after ReorderTimeout
+	r.Push(5, []byte{5}, 100)
+	if d := r.Deadline(); d != 100+ReorderTimeout {
+		t.Errorf("deadline %d, expecting %d", d, int64(100+ReorderTimeout))
+	}
+	pop(99+ReorderTimeout, false, -1)
+	pop(100+ReorderTimeout, false, 5)
+	if r.lost != 2 {
+		t.Errorf("lost %d, expecting 2", r.lost)
+	}
+	r.Push(4, []byte{4}, 200) // Late
+	pop(200, false, -1)
+
+	// ... or right away when flushing
+	r.Push(7, []byte{7}, 300)
+	pop(300, true, 7)
+	if r.Deadline() != -1 {
+		t.Errorf("deadline with nothing pending")
+	}
+}
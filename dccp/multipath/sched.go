@@ -0,0 +1,55 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package multipath
+
+import "github.com/petar/GoDCCP/dccp"
+
+// Path describes the state of a subflow, as seen by a Scheduler
+type Path struct {
+	RTT    int64 // Round-trip time estimate of the subflow's CCID, in nanoseconds
+	Queued int   // Number of messages waiting in the write queue of the subflow
+}
+
+// Scheduler chooses the subflow that carries each message written to a Conn. Pick is called
+// with writes serialized, so a Scheduler may keep state without locking.
+type Scheduler interface {
+	// Pick returns the index of the subflow that sends the next message. paths is never
+	// empty. Writing to a subflow whose queue is full blocks until its CCID lets a packet out.
+	Pick(paths []Path) int
+}
+
+// MinRTT sends each message on the subflow of lowest RTT whose write queue is not full. If
+// all queues are full, it picks the subflow of lowest RTT. It is the default scheduler of
+// MP-DCCP, and the one that a Conn uses unless told otherwise.
+type MinRTT struct{}
+
+// Pick implements Scheduler.Pick
+func (MinRTT) Pick(paths []Path) int {
+	best, bestFree := 0, -1
+	for i, p := range paths {
+		if p.RTT < paths[best].RTT {
+			best = i
+		}
+		if p.Queued < dccp.WriteDataQueueLen && (bestFree < 0 || p.RTT < paths[bestFree].RTT) {
+			bestFree = i
+		}
+	}
+	if bestFree >= 0 {
+		return bestFree
+	}
+	return best
+}
+
+// RoundRobin sends messages on the subflows in turn, regardless of their state
+type RoundRobin struct {
+	next int
+}
+
+// Pick implements Scheduler.Pick
+func (r *RoundRobin) Pick(paths []Path) int {
+	i := r.next % len(paths)
+	r.next = i + 1
+	return i
+}
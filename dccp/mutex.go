@@ -5,21 +5,169 @@
 package dccp
 
 import (
+	"fmt"
 	"sync"
+	"sync/atomic"
 )
 
+// Mutex is a sync.Mutex which, when lock debugging is enabled with EnableLockDebug,
+// tracks acquisition order and hold times.
 type Mutex struct {
 	sync.Mutex
+	site     string // Source location of the current holder's Lock call
+	acquired int64  // Time when the current holder acquired the lock
 }
 
 func (m *Mutex) Lock() {
+	d := getLockDebug()
+	if d == nil {
+		m.Mutex.Lock()
+		return
+	}
+	sfile, sline := FetchCaller(1)
+	site := fmt.Sprintf("%s:%d", sfile, sline)
+	d.before(m, site)
 	m.Mutex.Lock()
+	d.after(m, site)
 }
 
+// AssertLocked reports an error via the lock debug Amb, if lock debugging is enabled and
+// the calling goroutine does not hold m.
 func (m *Mutex) AssertLocked() {
-	// TODO: Implement
+	if d := getLockDebug(); d != nil {
+		d.assertHeld(m)
+	}
 }
 
 func (m *Mutex) Unlock() {
+	if d := getLockDebug(); d != nil {
+		d.release(m)
+	}
 	m.Mutex.Unlock()
 }
+
+// lockDebug holds a *lockDebugger, which is non-nil when lock debugging is enabled. It is
+// accessed atomically, since every Mutex reads it.
+var lockDebug atomic.Value
+
+func getLockDebug() *lockDebugger {
+	d, _ := lockDebug.Load().(*lockDebugger)
+	return d
+}
+
+// EnableLockDebug turns on lock debugging for all Mutex objects. Every lock acquisition is
+// checked against the acquisition orders observed so far, and potential lock-order inversions,
+// recursive locking and locks held for longer than maxHold nanoseconds are reported as
+// EventWarn records via amb. EnableLockDebug can be called while Mutex objects are in use;
+// locks held at that moment are not tracked.
+func EnableLockDebug(amb *Amb, maxHold int64) {
+	lockDebug.Store(&lockDebugger{
+		amb:     amb,
+		maxHold: maxHold,
+		held:    make(map[int64][]*Mutex),
+		order:   make(map[lockPair]string),
+	})
+}
+
+// DisableLockDebug turns lock debugging off. It can be called while Mutex objects are in use.
+func DisableLockDebug() {
+	lockDebug.Store((*lockDebugger)(nil))
+}
+
+type lockDebugger struct {
+	amb     *Amb
+	maxHold int64
+
+	sync.Mutex                     // Locks the fields below
+	held    map[int64][]*Mutex     // Locks held by each goroutine, in order of acquisition
+	order   map[lockPair]string    // Observed acquisition orders and where they were observed
+}
+
+// lockPair records that lock first was held while lock second was acquired
+type lockPair struct {
+	first, second *Mutex
+}
+
+func (d *lockDebugger) now() int64 {
+	if d.amb.env == nil {
+		return RealTime.Now()
+	}
+	return d.amb.env.Now()
+}
+
+func (d *lockDebugger) before(m *Mutex, site string) {
+	gid := goroutineID()
+	var warn []string
+	d.Lock()
+	for _, h := range d.held[gid] {
+		if h == m {
+			warn = append(warn, fmt.Sprintf("Recursive lock at %s, held since %s", site, h.site))
+			continue
+		}
+		d.order[lockPair{h, m}] = h.site + " then " + site
+		if inverse, ok := d.order[lockPair{m, h}]; ok {
+			warn = append(warn, fmt.Sprintf("Lock order inversion: %s then %s, but earlier %s", h.site, site, inverse))
+		}
+	}
+	d.Unlock()
+	for _, w := range warn {
+		d.amb.EC(2, EventWarn, w)
+	}
+}
+
+func (d *lockDebugger) after(m *Mutex, site string) {
+	gid := goroutineID()
+	m.site = site
+	m.acquired = d.now()
+	d.Lock()
+	d.held[gid] = append(d.held[gid], m)
+	d.Unlock()
+}
+
+func (d *lockDebugger) release(m *Mutex) {
+	hold := d.now() - m.acquired
+	site := m.site
+	d.Lock()
+	tracked := d.forget(m)
+	d.Unlock()
+	// Locks acquired before lock debugging was enabled are not tracked
+	if tracked && d.maxHold > 0 && hold > d.maxHold {
+		d.amb.EC(2, EventWarn, fmt.Sprintf("Lock acquired at %s held for %s", site, Nstoa(hold)))
+	}
+}
+
+// forget removes m from the held set of the goroutine that holds it. Mutex objects can be
+// unlocked by a goroutine other than the one that locked them, so all goroutines are searched.
+// forget returns false if m was not found.
+func (d *lockDebugger) forget(m *Mutex) bool {
+	for gid, held := range d.held {
+		for i, h := range held {
+			if h == m {
+				held = append(held[:i], held[i+1:]...)
+				if len(held) == 0 {
+					delete(d.held, gid)
+				} else {
+					d.held[gid] = held
+				}
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (d *lockDebugger) assertHeld(m *Mutex) {
+	gid := goroutineID()
+	d.Lock()
+	held := false
+	for _, h := range d.held[gid] {
+		if h == m {
+			held = true
+			break
+		}
+	}
+	d.Unlock()
+	if !held {
+		d.amb.EC(2, EventError, "Lock not held")
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// traceRecorder is a TraceWriter that keeps all traces in memory
+type traceRecorder struct {
+	sync.Mutex
+	traces []*Trace
+}
+
+func (x *traceRecorder) Write(r *Trace) {
+	x.Lock()
+	defer x.Unlock()
+	x.traces = append(x.traces, r)
+}
+
+func (x *traceRecorder) Sync() error { return nil }
+
+func (x *traceRecorder) Close() error { return nil }
+
+func (x *traceRecorder) count(substr string) int {
+	x.Lock()
+	defer x.Unlock()
+	var n int
+	for _, r := range x.traces {
+		if strings.Contains(r.Comment, substr) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestLockDebug(t *testing.T) {
+	rec := &traceRecorder{}
+	EnableLockDebug(NewAmb("lock", NewEnv(rec)), 5e6)
+	defer DisableLockDebug()
+
+	var a, b Mutex
+	a.Lock()
+	b.Lock()
+	b.Unlock()
+	a.Unlock()
+	if rec.count("inversion") != 0 {
+		t.Fatalf("false lock order inversion")
+	}
+
+	b.Lock()
+	a.Lock()
+	a.Unlock()
+	b.Unlock()
+	if rec.count("inversion") != 1 {
+		t.Errorf("lock order inversion not detected")
+	}
+
+	a.Lock()
+	time.Sleep(10 * time.Millisecond)
+	a.Unlock()
+	if rec.count("held for") != 1 {
+		t.Errorf("long hold not detected")
+	}
+
+	a.AssertLocked()
+	if rec.count("not held") != 1 {
+		t.Errorf("unheld lock not detected")
+	}
+}
+
+// TestLockDebugToggle enables and disables lock debugging while other goroutines use
+// Mutex objects. It is meant to be run with -race.
+func TestLockDebugToggle(t *testing.T) {
+	defer DisableLockDebug()
+	var m Mutex
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 2000; i++ {
+			m.Lock()
+			m.Unlock()
+		}
+	}()
+	amb := NewAmb("lock", NewEnv(&traceRecorder{}))
+	for i := 0; i < 100; i++ {
+		EnableLockDebug(amb, 0)
+		DisableLockDebug()
+	}
+	<-done
+}
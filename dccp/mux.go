@@ -17,9 +17,24 @@ import (
 // one minute after their respective flow has been closed.
 //
 // Mux force-closes flows that have experienced no activity for 10 mins
+//
+// A single goroutine receives packets from the link and dispatches them to per-flow queues
+// of length MuxFlowQueueLen, so a burst of packets for one flow never stalls the others; the
+// packets that overflow the queue of a flow are dropped. Links that implement BlockLink, like
+// UDPLink, may receive several packets per system call. Flows implement SegmentNotifier: once
+// notified, a flow hands its packets to the notify function right from that goroutine, so that
+// the Conns on top of a Mux need no read loops of their own.
+//
+// If the link implements RebindLink, like UDPLink, flows can be migrated to other local
+// addresses. Each migrated flow gets a link of its own, which has a read loop of its own. If
+// the link implements TrafficClassLink, the packets of all flows, or of individual ones, can be
+// marked with an IP traffic class.
 type Mux struct {
 	Mutex
+	env          *Env   // Source of the random labels of flows
 	link         Link
+	links        []Link // Links opened by migrating flows
+	processLk    Mutex  // Serializes process, which is called by the read loop of every link
 	flowsLocal   map[uint64]*flow // Active flows hashed by local label
 	flowsRemote  map[uint64]*flow
 	lingerLocal  map[uint64]time.Time // Local labels of recently-closed flows mapped to time of closure
@@ -28,9 +43,10 @@ type Mux struct {
 }
 
 const (
-	MuxLingerTime = 60e9  // 1 min in nanoseconds
-	MuxExpireTime = 600e9 // 10 min in nanoseconds
-	MuxReadSafety = 5
+	MuxLingerTime   = 60e9  // 1 min in nanoseconds
+	MuxExpireTime   = 600e9 // 10 min in nanoseconds
+	MuxReadSafety   = 5
+	MuxFlowQueueLen = 16    // Number of received packets queued per flow
 )
 
 // muxHeader is an internal data structure that carries a parsed switch packet,
@@ -38,11 +54,18 @@ const (
 type muxHeader struct {
 	Msg   *muxMsg
 	Cargo []byte
+	Addr  net.Addr // Link-level address that the packet was received from
 }
 
 // NewMux creates a new Mux object, using the connection-less packet interface link
 func NewMux(link Link) *Mux {
+	return NewMuxEnv(NewEnv(nil), link)
+}
+
+// NewMuxEnv creates a new Mux object, which draws the labels of its flows from env
+func NewMuxEnv(env *Env, link Link) *Mux {
 	m := &Mux{
+		env:          env,
 		link:         link,
 		flowsLocal:   make(map[uint64]*flow),
 		flowsRemote:  make(map[uint64]*flow),
@@ -65,10 +88,17 @@ func (m *Mux) Accept() (c SegmentConn, err error) {
 	return f, nil
 }
 
-// Dial opens a packet-based connection to the Link-layer addr
+// Dial opens a packet-based connection to the Link-layer addr. If addr is a *DCCPAddr, the
+// connection is opened to its UDP address, or to its IP address over an IPLink.
 func (m *Mux) Dial(addr net.Addr) (c SegmentConn, err error) {
-	ch := make(chan muxHeader)
-	local := ChooseLabel()
+	if a, ok := addr.(*DCCPAddr); ok {
+		m.Lock()
+		link := m.link
+		m.Unlock()
+		addr = linkAddr(link, a)
+	}
+	ch := make(chan muxHeader, MuxFlowQueueLen)
+	local := ChooseLabel(m.env)
 	f := newFlow(addr, m, ch, m.cargoMaxLen(), local, nil)
 
 	m.Lock()
@@ -83,7 +113,9 @@ func (m *Mux) Dial(addr net.Addr) (c SegmentConn, err error) {
 func (m *Mux) Close() error {
 	m.Lock()
 	link := m.link
+	links := m.links
 	m.link = nil
+	m.links = nil
 	for _, f := range m.flowsLocal {
 		f.foreclose()
 	}
@@ -94,6 +126,9 @@ func (m *Mux) Close() error {
 	if link == nil {
 		return ErrBad
 	}
+	for _, l := range links {
+		l.Close()
+	}
 	return link.Close()
 }
 
@@ -106,26 +141,9 @@ func (m *Mux) readLoop() {
 		if link == nil {
 			break
 		}
-
-		// Read incoming packet
-		buf := make([]byte, m.link.GetMTU()+MuxReadSafety)
-		n, addr, err := link.ReadFrom(buf)
-		if err != nil {
+		if !m.readOne(link) {
 			break
 		}
-
-		// Check that packet is not oversized
-		if len(buf)-n < MuxReadSafety {
-			break
-		}
-
-		// Read mux header
-		msg, cargo, err := readMuxHeader(buf[:n])
-		if err != nil {
-			continue
-		}
-
-		m.process(msg, cargo, addr)
 	}
 	close(m.acceptChan)
 	m.Lock()
@@ -138,8 +156,62 @@ func (m *Mux) readLoop() {
 	m.Unlock()
 }
 
+// readLinkLoop dispatches the packets received on link, which was opened by migrating a flow,
+// until the link is closed
+func (m *Mux) readLinkLoop(link Link) {
+	for m.readOne(link) {
+	}
+}
+
+// readOne receives the next packet from link and dispatches it to its flow. It returns false
+// if the link is broken.
+func (m *Mux) readOne(link Link) bool {
+	// Read incoming packet
+	buf, addr, err := m.readBlock(link)
+	if err != nil {
+		return false
+	}
+
+	// Read mux header
+	msg, cargo, err := readMuxHeader(buf)
+	if err != nil {
+		return true
+	}
+
+	m.processLk.Lock()
+	m.process(msg, cargo, addr)
+	m.processLk.Unlock()
+	return true
+}
+
+// readBlock receives the next packet from link. The returned slice is owned by the caller and
+// the cargo inside it is passed on to the application without further copying.
+func (m *Mux) readBlock(link Link) (block []byte, addr net.Addr, err error) {
+	if bl, ok := link.(BlockLink); ok {
+		block, addr, err = bl.ReadBlock()
+		if err != nil {
+			return nil, nil, err
+		}
+		// Check that packet is not oversized
+		if len(block) > link.GetMTU() {
+			return nil, nil, ErrTooBig
+		}
+		return block, addr, nil
+	}
+	buf := make([]byte, link.GetMTU()+MuxReadSafety)
+	n, addr, err := link.ReadFrom(buf)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Check that packet is not oversized
+	if len(buf)-n < MuxReadSafety {
+		return nil, nil, ErrTooBig
+	}
+	return buf[:n], addr, nil
+}
+
 func (m *Mux) process(msg *muxMsg, cargo []byte, addr net.Addr) {
-	// REMARK: By design, only one copy of process() can run at a time (*)
+	// REMARK: By design, only one copy of process() can run at a time, see processLk (*)
 
 	// Every packet must have a source (remote) label
 	if msg.Source == nil {
@@ -151,6 +223,12 @@ func (m *Mux) process(msg *muxMsg, cargo []byte, addr net.Addr) {
 		return
 	}
 
+	// If we sent the packet ourselves, possibly on a flow closed since, drop it. Links such
+	// as IPLink receive the packets that they send over the loopback interface.
+	if m.findLocal(msg.Source) != nil || m.isLingering(msg.Source, nil) {
+		return
+	}
+
 	var f *flow
 	// Does the packet have a sink label?
 	if msg.Sink != nil {
@@ -177,7 +255,7 @@ func (m *Mux) process(msg *muxMsg, cargo []byte, addr net.Addr) {
 		}
 	}
 
-	f.ch <- muxHeader{msg, cargo}
+	f.deliver(muxHeader{msg, cargo, addr})
 }
 
 func (m *Mux) accept(remote *Label, addr net.Addr) *flow {
@@ -185,8 +263,8 @@ func (m *Mux) accept(remote *Label, addr net.Addr) *flow {
 		panic("remote == nil")
 	}
 
-	ch := make(chan muxHeader)
-	local := ChooseLabel()
+	ch := make(chan muxHeader, MuxFlowQueueLen)
+	local := ChooseLabel(m.env)
 	f := newFlow(addr, m, ch, m.cargoMaxLen(), local, remote)
 
 	m.Lock()
@@ -325,21 +403,114 @@ func (m *Mux) del(local *Label, remote *Label) {
 	}
 }
 
-func (m *Mux) cargoMaxLen() int { return m.link.GetMTU() - muxMsgFootprint }
+// migrate moves the flow f to a new link, bound to the local address laddr. The previous link
+// of f is closed, unless it is the link of the Mux.
+func (m *Mux) migrate(f *flow, laddr net.Addr) error {
+	m.Lock()
+	link := m.link
+	m.Unlock()
+	if link == nil {
+		return ErrBad
+	}
+	rl, ok := link.(RebindLink)
+	if !ok {
+		return ErrUnsupported
+	}
+	nl, err := rl.Rebind(laddr)
+	if err != nil {
+		return ErrIO
+	}
+	m.Lock()
+	if m.link == nil {
+		m.Unlock()
+		nl.Close()
+		return ErrBad
+	}
+	m.links = append(m.links, nl)
+	m.Unlock()
+	go m.readLinkLoop(nl)
+
+	if old := f.setLink(nl); old != nil {
+		m.closeLink(old)
+	}
+	return nil
+}
 
-func (m *Mux) write(msg *muxMsg, block []byte, addr net.Addr) error {
+// SetTrafficClass marks the packets of all flows with the IP traffic class tos, except for the
+// flows whose traffic class is set individually. It returns ErrUnsupported if the link of the
+// Mux does not implement TrafficClassLink.
+func (m *Mux) SetTrafficClass(tos byte) error {
 	m.Lock()
 	link := m.link
+	links := m.links
 	m.Unlock()
 	if link == nil {
 		return ErrBad
 	}
+	tl, ok := link.(TrafficClassLink)
+	if !ok {
+		return ErrUnsupported
+	}
+	if err := tl.SetTrafficClass(tos); err != nil {
+		return err
+	}
+	for _, l := range links {
+		if err := l.(TrafficClassLink).SetTrafficClass(tos); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// canSetTrafficClass returns true if the link of the Mux implements TrafficClassLink
+func (m *Mux) canSetTrafficClass() bool {
+	m.Lock()
+	defer m.Unlock()
+	_, ok := m.link.(TrafficClassLink)
+	return ok
+}
+
+// closeLink closes link, which was opened by migrating a flow
+func (m *Mux) closeLink(link Link) {
+	m.Lock()
+	for i, l := range m.links {
+		if l == link {
+			m.links = append(m.links[:i], m.links[i+1:]...)
+			break
+		}
+	}
+	m.Unlock()
+	link.Close()
+}
+
+func (m *Mux) cargoMaxLen() int { return m.link.GetMTU() - muxMsgFootprint }
+
+// write sends block on link, or on the link of the Mux if link is nil. The packet is marked
+// with traffic class tos, unless tos is negative.
+func (m *Mux) write(msg *muxMsg, block []byte, addr net.Addr, link Link, tos int) error {
+	m.Lock()
+	if m.link == nil {
+		m.Unlock()
+		return ErrBad
+	}
+	if link == nil {
+		link = m.link
+	}
+	m.Unlock()
 
-	buf := make([]byte, muxMsgFootprint+len(block))
+	b := getBuffer(muxMsgFootprint + len(block))
+	defer putBuffer(b)
+	buf := *b
 	msg.Write(buf)
 	copy(buf[muxMsgFootprint:], block)
 
-	n, err := link.WriteTo(buf, addr)
+	var n int
+	var err error
+	if tl, ok := link.(TrafficClassLink); ok && tos >= 0 {
+		n, err = tl.WriteToClass(buf, addr, byte(tos))
+	} else {
+		n, err = link.WriteTo(buf, addr)
+	}
 	if n != muxMsgFootprint+len(block) {
 		panic("block divided")
 	}
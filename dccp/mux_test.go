@@ -7,6 +7,7 @@ package dccp
 import (
 	"net"
 	"testing"
+	"time"
 )
 
 type endToEnd struct {
@@ -136,6 +137,110 @@ func TestMuxOverChan(t *testing.T) {
 	ee.Run()
 }
 
+// hubLink is a Link attached to a hub, which delivers every packet written by any of its links
+// to all of them, including the sender, like a raw socket on the loopback interface
+type hubLink struct {
+	hub    *[]*hubLink
+	ch     chan []byte
+	closed chan int
+}
+
+func newHub(n int) []*hubLink {
+	hub := make([]*hubLink, n)
+	for i := range hub {
+		hub[i] = &hubLink{hub: &hub, ch: make(chan []byte, 100), closed: make(chan int)}
+	}
+	return hub
+}
+
+func (l *hubLink) GetMTU() int { return 1500 }
+
+func (l *hubLink) SetReadDeadline(t time.Time) error { return nil }
+
+func (l *hubLink) ReadFrom(buf []byte) (n int, addr net.Addr, err error) {
+	select {
+	case p := <-l.ch:
+		return copy(buf, p), nil, nil
+	case <-l.closed:
+		return 0, nil, ErrBad
+	}
+}
+
+func (l *hubLink) WriteTo(buf []byte, addr net.Addr) (n int, err error) {
+	for _, m := range *l.hub {
+		select {
+		case m.ch <- append([]byte{}, buf...):
+		case <-m.closed:
+		}
+	}
+	return len(buf), nil
+}
+
+func (l *hubLink) Close() error {
+	close(l.closed)
+	return nil
+}
+
+// TestMuxOverHub checks that a Mux ignores the packets that it receives from itself
+func TestMuxOverHub(t *testing.T) {
+	hub := newHub(2)
+	ee := newEndToEnd(t, hub[0], hub[1], nil, 10)
+	ee.Run()
+}
+
+// TestMuxNotifyBacklog checks that a flow can be notified after more packets than its queue
+// holds arrived on it, and that the Mux keeps dispatching meanwhile
+func TestMuxNotifyBacklog(t *testing.T) {
+	alink, dlink := NewChanPipe()
+	am, dm := NewMux(alink), NewMux(dlink)
+	defer am.Close()
+	defer dm.Close()
+
+	const n = 2 * MuxFlowQueueLen
+	written := make(chan int)
+	go func() {
+		c, err := dm.Dial(nil)
+		if err != nil {
+			t.Errorf("dial: %s", err)
+		}
+		for i := 0; i < n; i++ {
+			if err = c.Write([]byte{byte(i)}); err != nil {
+				t.Errorf("write: %s", err)
+			}
+		}
+		close(written)
+	}()
+	c, err := am.Accept()
+	if err != nil {
+		t.Fatalf("accept: %s", err)
+	}
+	select {
+	case <-written:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Mux blocked on a full flow queue")
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	received := make(chan int, n)
+	notified := make(chan int)
+	go func() {
+		c.(SegmentNotifier).NotifyBlocks(func(block []byte, err error) {
+			if err == nil {
+				received <- 1
+			}
+		})
+		close(notified)
+	}()
+	select {
+	case <-notified:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("NotifyBlocks blocked on a full flow queue")
+	}
+	if len(received) != MuxFlowQueueLen {
+		t.Errorf("expecting %d queued blocks, got %d", MuxFlowQueueLen, len(received))
+	}
+}
+
 func _TestMuxOverUDP(t *testing.T) {
 	// Bind acceptor link
 	aaddr, err := net.ResolveUDPAddr("udp", "0.0.0.0:44000")
@@ -166,3 +271,55 @@ func _TestMuxOverUDP(t *testing.T) {
 	ee := newEndToEnd(t, alink, dlink, addr, 10)
 	ee.Run()
 }
+
+// copyLink hides the BlockLink implementation of the underlying link, forcing the Mux to
+// read every packet into a buffer of its own
+type copyLink struct {
+	Link
+}
+
+func benchmarkMuxRead(b *testing.B, alink, dlink Link) {
+	am, dm := NewMux(alink), NewMux(dlink)
+	defer am.Close()
+	defer dm.Close()
+
+	block := make([]byte, 1000)
+	go func() {
+		c, err := dm.Dial(nil)
+		if err != nil {
+			b.Errorf("dial: %s", err)
+			return
+		}
+		for i := 0; i < b.N; i++ {
+			if err := c.Write(block); err != nil {
+				b.Errorf("write: %s", err)
+				return
+			}
+		}
+	}()
+	c, err := am.Accept()
+	if err != nil {
+		b.Fatalf("accept: %s", err)
+	}
+	b.SetBytes(int64(len(block)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p, err := c.Read()
+		if err != nil {
+			b.Fatalf("read: %s", err)
+		}
+		if len(p) != len(block) {
+			b.Fatalf("read size: %d", len(p))
+		}
+	}
+}
+
+func BenchmarkMuxReadBlock(b *testing.B) {
+	alink, dlink := NewChanPipe()
+	benchmarkMuxRead(b, alink, dlink)
+}
+
+func BenchmarkMuxReadCopy(b *testing.B) {
+	alink, dlink := NewChanPipe()
+	benchmarkMuxRead(b, copyLink{alink}, copyLink{dlink})
+}
@@ -31,6 +31,48 @@ const (
 	// CCID-specific 128 to 255
 )
 
+// OptionPolicy determines how a Conn treats received packets whose options are malformed,
+// or which carry a Mandatory option followed by an option that is not understood
+type OptionPolicy int
+
+const (
+	// OptionsStrict drops packets with malformed options, and resets the connection with
+	// Reset Code "Mandatory Error" on unknown Mandatory options, as required by Section 5.8
+	OptionsStrict OptionPolicy = iota
+
+	// OptionsPermissive skips the faulty options and processes the rest of the packet
+	OptionsPermissive
+)
+
+// Treatments of received packets with faulty options
+const (
+	optionAccept = iota
+	optionDrop
+	optionReset
+)
+
+// judge returns the treatment of the received header h under policy. Section 5.8.2: A
+// Mandatory option that is not understood calls for a Reset, unless h is a Reset itself.
+func (policy OptionPolicy) judge(h *Header) int {
+	switch {
+	case h.optionFault == optionFaultNone || policy == OptionsPermissive:
+		return optionAccept
+	case h.optionFault == optionFaultMandatory && h.Type != Reset:
+		return optionReset
+	}
+	return optionDrop
+}
+
+// getOptionPolicy returns the option policy of the Conn, which is OptionsStrict in strict
+// RFC mode
+func (c *Conn) getOptionPolicy() OptionPolicy {
+	c.AssertLocked()
+	if c.env.StrictRFC() {
+		return OptionsStrict
+	}
+	return c.optionPolicy
+}
+
 func isOptionReserved(optionType byte) bool {
 	return (optionType >= 3 && optionType <= 31) ||
 		(optionType >= 45 && optionType <= 127)
@@ -40,11 +82,37 @@ func isOptionCCIDSpecific(optionType byte) bool {
 	return optionType >= 128 && optionType <= 255
 }
 
+// Section 10.3: CCID-specific options signal the half-connection to which they apply. Options
+// 128 to 191 are sent by the HC-Sender to the HC-Receiver, and options 192 to 255 by the
+// HC-Receiver to the HC-Sender, whatever the CCID. Of the generic options that CCIDs process,
+// Slow Receiver, Ack Vectors and Data Dropped report on received data and travel like options
+// 192 to 255, while Timestamp, Timestamp Echo and Elapsed Time serve either half-connection.
+
+// ccidOptionRoute returns whether options of type optionType travel from the HC-Sender CCID
+// to the HC-Receiver CCID of the peer, and whether they travel from the HC-Receiver CCID to
+// the HC-Sender CCID. A received option is handed to the CCID at the end of its route.
+func ccidOptionRoute(optionType byte) (senderToReceiver, receiverToSender bool) {
+	switch {
+	case optionType == OptionSlowReceiver:
+		return false, true
+	case optionType >= OptionAckVectorNonce0 && optionType <= OptionDataDropped:
+		return false, true
+	case optionType >= OptionTimestamp && optionType <= OptionElapsedTime:
+		return true, true
+	case optionType >= 128 && optionType <= 191:
+		return true, false
+	case optionType >= 192:
+		return false, true
+	}
+	return false, false
+}
+
 func isOptionCCIDSenderToReceiver(optionType byte) bool {
-	return (optionType >= 38 && optionType <= 43) || (optionType >= 128 && optionType <= 191)
+	s2r, _ := ccidOptionRoute(optionType)
+	return s2r
 }
 
-func validateCCIDSenderToReceiver(opts []*Option) bool {
+func validateCCIDSenderToReceiver(opts []Option) bool {
 	for _, o := range opts {
 		if !isOptionCCIDSenderToReceiver(o.Type) {
 			return false
@@ -53,23 +121,12 @@ func validateCCIDSenderToReceiver(opts []*Option) bool {
 	return true
 }
 
-func filterCCIDSenderToReceiverOptions(opts []*Option) []*Option {
-	r := make([]*Option, len(opts))
-	k := 0
-	for _, o := range opts {
-		if isOptionCCIDSenderToReceiver(o.Type) {
-			r[k] = o
-			k++
-		}
-	}
-	return r[:k]
-}
-
 func isOptionCCIDReceiverToSender(optionType byte) bool {
-	return (optionType >= 38 && optionType <= 43) || (optionType >= 192 && optionType <= 255)
+	_, r2s := ccidOptionRoute(optionType)
+	return r2s
 }
 
-func validateCCIDReceiverToSender(opts []*Option) bool {
+func validateCCIDReceiverToSender(opts []Option) bool {
 	for _, o := range opts {
 		if !isOptionCCIDReceiverToSender(o.Type) {
 			return false
@@ -78,18 +135,6 @@ func validateCCIDReceiverToSender(opts []*Option) bool {
 	return true
 }
 
-func filterCCIDReceiverToSenderOptions(opts []*Option) []*Option {
-	r := make([]*Option, len(opts))
-	k := 0
-	for _, o := range opts {
-		if isOptionCCIDReceiverToSender(o.Type) {
-			r[k] = o
-			k++
-		}
-	}
-	return r[:k]
-}
-
 func isOptionSingleByte(optionType byte) bool {
 	return optionType >= 0 && optionType <= 31
 }
@@ -0,0 +1,166 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"reflect"
+	"testing"
+)
+
+// optionTestWire returns the wire format of a header of type Type, whose options area holds
+// the raw bytes opts, padded to a multiple of four bytes
+func optionTestWire(t testing.TB, Type byte, opts []byte) []byte {
+	gh := &Header{Type: Type, X: true, SeqNo: 0x334455667788, AckNo: 0x112233445566}
+	if Type == Data || Type == DataAck {
+		gh.Data = []byte{1, 2, 3}
+	}
+	p, err := gh.Write(allocTestSourceIP, allocTestDestIP, 34, false)
+	if err != nil {
+		t.Fatalf("write (%s)", err)
+	}
+	fixed := getFixedHeaderSize(Type, true)
+	area := make([]byte, (len(opts)+3)&^3)
+	copy(area, opts)
+	w := append(append(append([]byte{}, p[:fixed]...), area...), p[fixed:]...)
+	dataOffset := fixed + len(area)
+	w[4] = byte(dataOffset >> 2)
+	w[6], w[7] = 0, 0
+	csum := csumSum(w[0:dataOffset])
+	csum = csumAdd(csum, csumPseudoIP(allocTestSourceIP, allocTestDestIP, 34, len(w)))
+	csum = csumAdd(csum, csumSum(w[dataOffset:]))
+	csumUint16ToBytes(csumDone(csum), w[6:8])
+	return w
+}
+
+var optionFaultTests = []struct {
+	Type      byte
+	opts      []byte
+	fault     byte
+	faultType byte
+}{
+	{Ack, []byte{OptionMandatory, OptionSlowReceiver}, optionFaultNone, 0},
+	{Ack, []byte{OptionTimestamp, 6, 0, 0, 0, 1}, optionFaultNone, 0},
+	{Ack, []byte{OptionTimestamp, 9, 0, 0, 0, 1}, optionFaultMalformed, OptionTimestamp},
+	{Ack, []byte{OptionElapsedTime, 1}, optionFaultMalformed, OptionElapsedTime},
+	{Ack, []byte{OptionMandatory, 50, 2}, optionFaultMandatory, 50},
+	{Ack, []byte{OptionMandatory, OptionMandatory, OptionSlowReceiver}, optionFaultMandatory, OptionMandatory},
+	{Ack, []byte{OptionSlowReceiver, OptionMandatory}, optionFaultMandatory, OptionPadding},
+	{Ack, []byte{OptionMandatory, 3}, optionFaultMandatory, 3},
+	{Data, []byte{OptionChangeL, 3, 1}, optionFaultNone, 0},
+}
+
+func TestOptionFaults(t *testing.T) {
+	for i, x := range optionFaultTests {
+		gh, err := ReadHeader(optionTestWire(t, x.Type, x.opts), allocTestSourceIP, allocTestDestIP, 34, false)
+		if err != nil {
+			t.Fatalf("#%d: read (%s)", i, err)
+		}
+		if gh.optionFault != x.fault || gh.optionFaultType != x.faultType {
+			t.Errorf("#%d: %s, expecting fault %d on option %d", i, gh.optionFaultString(), x.fault, x.faultType)
+		}
+		if (gh.OptionFault() == "") != (x.fault == optionFaultNone) {
+			t.Errorf("#%d: option fault %q", i, gh.OptionFault())
+		}
+		want := optionAccept
+		switch {
+		case x.fault == optionFaultMalformed:
+			want = optionDrop
+		case x.fault == optionFaultMandatory:
+			want = optionReset
+		}
+		if v := OptionsStrict.judge(gh); v != want {
+			t.Errorf("#%d: strict treatment %d, expecting %d", i, v, want)
+		}
+		if v := OptionsPermissive.judge(gh); v != optionAccept {
+			t.Errorf("#%d: permissive treatment %d, expecting accept", i, v)
+		}
+	}
+}
+
+// FuzzOptions checks the option parser and both option policies on arbitrary options areas
+func FuzzOptions(f *testing.F) {
+	for _, x := range optionFaultTests {
+		f.Add(x.Type, x.opts)
+	}
+	f.Fuzz(func(t *testing.T, Type byte, opts []byte) {
+		Type %= SyncAck + 1
+		if len(opts) > 900 {
+			opts = opts[:900]
+		}
+		gh, err := ReadHeader(optionTestWire(t, Type, opts), allocTestSourceIP, allocTestDestIP, 34, false)
+		if err != nil {
+			t.Fatalf("read (%s)", err)
+		}
+
+		// Both policies treat packets according to their fault
+		strict, permissive := OptionsStrict.judge(gh), OptionsPermissive.judge(gh)
+		if permissive != optionAccept {
+			t.Errorf("permissive policy did not accept %s", gh.optionFaultString())
+		}
+		switch {
+		case gh.optionFault == optionFaultNone && strict != optionAccept:
+			t.Errorf("strict policy did not accept faultless options")
+		case gh.optionFault != optionFaultNone && strict == optionAccept:
+			t.Errorf("strict policy accepted %s", gh.optionFaultString())
+		case gh.Type == Reset && strict == optionReset:
+			t.Errorf("strict policy resets on a Reset")
+		}
+
+		// The options that survive parsing are valid, and they survive a round trip intact
+		opts0 := gh.GetOptions()
+		for _, o := range opts0 {
+			if o.Type == OptionPadding || o.Type == OptionMandatory || !isOptionValidForType(o.Type, gh.Type) {
+				t.Fatalf("parser returned option %d on packet type %d", o.Type, gh.Type)
+			}
+		}
+		p, err := gh.Write(allocTestSourceIP, allocTestDestIP, 34, false)
+		if err != nil {
+			// Mandatory flags may add to the length of the options area
+			if err == ErrOptionsTooBig || err == ErrOversize {
+				return
+			}
+			t.Fatalf("rewrite (%s)", err)
+		}
+		gh2, err := ReadHeader(p, allocTestSourceIP, allocTestDestIP, 34, false)
+		if err != nil {
+			t.Fatalf("reread (%s)", err)
+		}
+		if gh2.optionFault != optionFaultNone {
+			t.Errorf("rewritten options have %s", gh2.optionFaultString())
+		}
+		if opts1 := gh2.GetOptions(); len(opts0) > 0 && !reflect.DeepEqual(opts0, opts1) {
+			t.Errorf("options %v changed to %v in round trip", opts0, opts1)
+		}
+	})
+}
+
+var ccidOptionRouteTests = []struct {
+	optionType                        byte
+	senderToReceiver, receiverToSender bool
+}{
+	{OptionSlowReceiver, false, true},
+	{OptionChangeL, false, false},
+	{OptionAckVectorNonce0, false, true},
+	{OptionAckVectorNonce1, false, true},
+	{OptionDataDropped, false, true},
+	{OptionTimestamp, true, true},
+	{OptionTimestampEcho, true, true},
+	{OptionElapsedTime, true, true},
+	{OptionDataChecksum, false, false},
+	{127, false, false},
+	{128, true, false},
+	{191, true, false},
+	{192, false, true},
+	{255, false, true},
+}
+
+func TestCCIDOptionRoute(t *testing.T) {
+	for _, x := range ccidOptionRouteTests {
+		s2r, r2s := ccidOptionRoute(x.optionType)
+		if s2r != x.senderToReceiver || r2s != x.receiverToSender {
+			t.Errorf("option %d: route %v/%v, expected %v/%v", x.optionType, s2r, r2s, x.senderToReceiver, x.receiverToSender)
+		}
+	}
+}
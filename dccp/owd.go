@@ -0,0 +1,83 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+// Parameters of the one-way delay estimation of LEDBAT, RFC 6817, Section 3.4.2
+const (
+	OneWayDelayBaseHistory   = 10   // Minutes over which the base delay is the minimum
+	OneWayDelayCurrentFilter = 4    // Number of latest samples over which the current delay is the minimum
+	OneWayDelayBaseInterval  = 60e9 // Length of an interval of the base delay history
+)
+
+// OneWayDelay estimates the queueing delay along a path from samples of its one-way delay, in
+// the manner of LEDBAT, RFC 6817, Section 3.4.2. A sample is the difference between the time of
+// arrival of a packet, by the clock of the receiver, and its Timestamp, by the clock of the
+// sender, see OneWayDelaySample. The clocks need not be synchronized: their offset cancels out
+// of the queueing delay, which is the current delay less the base delay. The current delay is
+// the minimum of the latest few samples, and the base delay the minimum of the samples of the
+// latest few minutes. Samples are circular, in ten microsecond units, like Timestamps.
+// The zero value is ready to use.
+type OneWayDelay struct {
+	base        [OneWayDelayBaseHistory]uint32 // Minimum sample of each interval, oldest first
+	baseLen     int
+	baseStart   int64 // Time when the latest interval of base began
+	current     [OneWayDelayCurrentFilter]uint32
+	currentLen  int
+	currentNext int
+}
+
+// OneWayDelaySample returns the one-way delay sample of a packet that carries the Timestamp
+// timestamp of its sender, and arrives at time arrival by the clock of the receiver
+func OneWayDelaySample(timestamp uint32, arrival int64) uint32 {
+	return TimestampAt(arrival) - timestamp
+}
+
+// Add takes the sample, received at time now
+func (x *OneWayDelay) Add(sample uint32, now int64) {
+	switch {
+	case x.baseLen == 0:
+		x.base[0], x.baseLen, x.baseStart = sample, 1, now
+	case now-x.baseStart >= OneWayDelayBaseInterval:
+		if x.baseLen == OneWayDelayBaseHistory {
+			copy(x.base[:], x.base[1:])
+			x.baseLen--
+		}
+		x.base[x.baseLen] = sample
+		x.baseLen++
+		x.baseStart = now
+	case circularLess(sample, x.base[x.baseLen-1]):
+		x.base[x.baseLen-1] = sample
+	}
+	x.current[x.currentNext] = sample
+	x.currentNext = (x.currentNext + 1) % OneWayDelayCurrentFilter
+	if x.currentLen < OneWayDelayCurrentFilter {
+		x.currentLen++
+	}
+}
+
+// Queueing returns the estimated queueing delay in nanoseconds, and false if there are no
+// samples yet
+func (x *OneWayDelay) Queueing() (int64, bool) {
+	if x.baseLen == 0 {
+		return 0, false
+	}
+	base := x.base[0]
+	for _, s := range x.base[1:x.baseLen] {
+		if circularLess(s, base) {
+			base = s
+		}
+	}
+	current := x.current[0]
+	for _, s := range x.current[1:x.currentLen] {
+		if circularLess(s, current) {
+			current = s
+		}
+	}
+	// The base delay includes every sample, the current ones too, so the difference is not negative
+	return NanoFromTenMicro(current - base), true
+}
+
+// circularLess returns true if the circular time a precedes b
+func circularLess(a, b uint32) bool { return int32(a-b) < 0 }
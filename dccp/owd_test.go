@@ -0,0 +1,37 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"testing"
+)
+
+func TestOneWayDelay(t *testing.T) {
+	var x OneWayDelay
+	if _, ok := x.Queueing(); ok {
+		t.Errorf("queueing delay without samples")
+	}
+	// The clock of the receiver is far ahead of that of the sender, so that the samples wrap
+	const offset = 1<<32 - 500
+	var now int64
+	sample := func(delay int64) {
+		x.Add(OneWayDelaySample(TimestampAt(now), now+offset*TenMicroInNano+delay), now)
+	}
+	for _, delay := range []int64{30e6, 20e6, 25e6, 60e6, 70e6, 65e6, 80e6} {
+		sample(delay)
+		now += 1e9
+	}
+	if q, _ := x.Queueing(); q != 40e6 {
+		t.Errorf("queueing delay %d, expecting 40ms", q)
+	}
+	// The base delay is forgotten after OneWayDelayBaseHistory intervals
+	for i := 0; i < OneWayDelayBaseHistory; i++ {
+		now += OneWayDelayBaseInterval
+		sample(50e6)
+	}
+	if q, _ := x.Queueing(); q != 0 {
+		t.Errorf("queueing delay %d after the base delay expired, expecting 0", q)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+// maxHeaderLen is the size of the largest header, whose Data Offset counts 255 32-bit words,
+// Section 5.1
+const maxHeaderLen = 255 * 4
+
+// padTo sets the Padding of gh, so that its wire size reaches size, as far as the largest
+// header allows. Since the header is a whole number of 32-bit words, the wire size may
+// exceed size by up to three bytes. A size that gh reaches already leaves it unpadded.
+func (gh *Header) padTo(size int) {
+	gh.Padding = 0
+	if size <= 0 {
+		return
+	}
+	n, err := gh.getOptionsLen()
+	if err != nil {
+		return
+	}
+	fixed := getFixedHeaderSize(gh.Type, gh.X)
+	opts := size - fixed - len(gh.Data)
+	if opts > maxHeaderLen-fixed {
+		opts = maxHeaderLen - fixed
+	}
+	if opts > n {
+		gh.Padding = opts - n
+	}
+}
+
+// SetPadding makes the Conn pad every packet it sends with Padding options, Section 5.8.1,
+// to the wire size size, for instance to send packets of constant size that do not reveal
+// the size of the messages to traffic analysis. A message whose WriteMeta has a PadTo of its
+// own is padded to that size instead. Zero turns padding off. Padding is limited by the
+// largest header of 1020 bytes, and by the maximum packet size.
+func (c *Conn) SetPadding(size int) {
+	c.Lock()
+	defer c.Unlock()
+	c.padTo = size
+}
+
+// placePadding pads h to the size requested for its message, or else to the size padTo set
+// by SetPadding, but not beyond the maximum packet size mps
+func placePadding(h *writeHeader, padTo, mps int) {
+	size := h.Meta.PadTo
+	if size == 0 {
+		size = padTo
+	}
+	// Padding may overshoot size by up to three bytes, see padTo
+	if size > mps-3 {
+		size = mps - 3
+	}
+	h.padTo(size)
+}
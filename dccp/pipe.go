@@ -5,47 +5,88 @@
 package dccp
 
 func (c *Conn) readHeader() (h *Header, err error) {
-	h, err = c.hc.Read()
+	return c.admitHeader(c.hc.Read())
+}
+
+// admitHeader prepares the header h, which was just received with error err, for processing
+func (c *Conn) admitHeader(h *Header, err error) (*Header, error) {
 	if err != nil {
 		if err != ErrTimeout {
 			c.amb.E(EventDrop, "Bad header", h)
 		}
 		return nil, err
 	}
-	// We don't support non-extended (short) SeqNo's 
-	if !h.X {
+	if h.ReadTime == 0 {
+		h.ReadTime = c.env.Now()
+	}
+	// Short sequence numbers are accepted only if the Allow Short Seqnos feature of the peer is 1
+	c.Lock()
+	ok := c.readShortSeqNo(h)
+	c.readECN(h)
+	c.Unlock()
+	if !ok {
+		c.amb.E(EventDrop, "Short sequence number", h)
 		return nil, ErrUnsupported
 	}
 	return h, nil
 }
 
-// idleLoop polls the congestion control OnIdle method at regular intervals
-// of approximately one RTT.
-func (c *Conn) idleLoop() {
-	for {
-		c.pollCongestionControl()
+// IdleTickSlack is the fraction of its interval by which an idle tick may fire late, so that
+// the idle ticks of the connections of an Env are fired together by its timer wheel
+const IdleTickSlack = 8
 
-		c.Lock()
-		c.syncWithCongestionControl()
-		rtt := c.socket.GetRTT()
-		state := c.socket.GetState()
-		c.Unlock()
+// idleTick polls the congestion control OnIdle method and reschedules itself on the Env's
+// timer wheel, so that polling occurs at regular intervals of approximately one RTT.
+func (c *Conn) idleTick() {
+	c.profiled(ProfileIdle, c.idle)
+}
 
-		if state == CLOSED {
-			break
-		}
-		// This emit prints very often. Use when really necessary
-		//c.amb.E(EventIdle, "")
-		c.env.Sleep(max64(RoundtripMin, min64(rtt, RoundtripDefault)))
+func (c *Conn) idle() {
+	c.journalAdd(&JournalEntry{ Kind: JournalTick })
+	c.pollCongestionControl()
+
+	c.Lock()
+	c.syncWithCongestionControl()
+	c.adjustSequenceWindow()
+	c.adjustAckRatio()
+	rtt := c.socket.GetRTT()
+	state := c.socket.GetState()
+	c.Unlock()
+
+	if state == CLOSED {
+		return
 	}
+	// This emit prints very often. Use when really necessary
+	//c.amb.E(EventIdle, "")
+	d := max64(RoundtripMin, min64(rtt, RoundtripDefault))
+	c.env.AfterFuncSlack(d, d/IdleTickSlack, c.idleTick, "idleTick")
+}
+
+// startReading arranges for the headers that c receives to be processed. If the HeaderConn is
+// a HeaderNotifier, like the flows of a Mux, it hands them over from a goroutine that it shares
+// with other connections, and the write loop remains the only goroutine of c. Otherwise, c
+// reads them in a read loop of its own.
+func (c *Conn) startReading(anno string) {
+	if hn, ok := c.hc.(HeaderNotifier); ok && hn.NotifyHeaders(c.notified) {
+		return
+	}
+	c.goConn(func() { c.profiled(ProfileRead, c.readLoop) }, "%s", anno)
+}
+
+// notified processes the header h, or the error err, handed over by a HeaderNotifier
+func (c *Conn) notified(h *Header, err error) {
+	if c.loadState() == CLOSED {
+		return
+	}
+	c.profiled(ProfileRead, func() {
+		c.process(c.admitHeader(h, err))
+	})
 }
 
 func (c *Conn) readLoop() {
 	for {
-		c.Lock()
-		state := c.socket.GetState()
-		rtt := c.socket.GetRTT()
-		c.Unlock()
+		state := c.loadState()
+		rtt := c.loadRTT()
 		if state == CLOSED {
 			break
 		}
@@ -58,80 +99,102 @@ func (c *Conn) readLoop() {
 		}
 
 		// Read next header
-		h, err := c.readHeader()
-		if err != nil {
-			_, ok := err.(ProtoError)
-			if ok {
-				// Drop packets that are unsupported. Intended for forward compatibility.
-				continue
-			} else if err == ErrTimeout {
-				// In the even of timeout, poll the congestion controls
-				c.pollCongestionControl()
-				continue
-			} else {
-				// Die if the underlying link is broken
-				c.abortQuietly()
-				return
-			}
-		}
-		c.amb.E(EventRead, "", h)
-
-		c.Lock()
-		c.syncWithCongestionControl()
-		if c.step2_ProcessTIMEWAIT(h) != nil {
-			goto Done
-		}
-		if c.step3_ProcessLISTEN(h) != nil {
-			goto Done
-		}
-		if c.step4_PrepSeqNoREQUEST(h) != nil {
-			goto Done
-		}
-		if c.step5_PrepSeqNoForSync(h) != nil {
-			goto Done
-		}
-		if c.step6_CheckSeqNo(h) != nil {
-			goto Done
-		}
-		if c.step7_CheckUnexpectedTypes(h) != nil {
-			goto Done
-		}
-		if c.step8_OptionsAndMarkAckbl(h) != nil {
-			goto Done
-		}
-		if c.step9_ProcessReset(h) != nil {
-			goto Done
-		}
-		if c.step10_ProcessREQUEST2(h) != nil {
-			goto Done
-		}
-		if c.step11_ProcessRESPOND(h) != nil {
-			goto Done
-		}
-		if c.step12_ProcessPARTOPEN(h) != nil {
-			goto Done
-		}
-		if c.step13_ProcessCloseReq(h) != nil {
-			goto Done
-		}
-		if c.step14_ProcessClose(h) != nil {
-			goto Done
-		}
-		if c.step15_ProcessSync(h) != nil {
-			goto Done
-		}
-		if c.step16_ProcessData(h) != nil {
-			goto Done
+		if !c.process(c.readHeader()) {
+			return
 		}
-	Done:
-		c.Unlock()
 	}
 	c.amb.E(EventInfo, "Read loop EXIT")
 }
 
+// process takes the header h, or the error err, that c received through the steps of
+// Section 8.5. It returns false if the underlying link is broken.
+func (c *Conn) process(h *Header, err error) bool {
+	if err != nil {
+		_, ok := err.(ProtoError)
+		if ok {
+			if err == ErrChecksum || err == ErrCsCov {
+				c.Lock()
+				c.violate(ViolationChecksum, nil, err.Error())
+				c.Unlock()
+			}
+			// Drop packets that are unsupported. Intended for forward compatibility.
+			return true
+		} else if err == ErrTimeout {
+			// In the even of timeout, poll the congestion controls
+			c.pollCongestionControl()
+			return true
+		}
+		// Die if the underlying link is broken
+		c.abortQuietly()
+		return false
+	}
+	c.amb.E(EventRead, "", h)
+	expCountHeader(h, "in")
+	c.callHooks(&c.readHooks, h)
+
+	c.Lock()
+	c.countRead(h)
+	c.syncWithCongestionControl()
+	if c.step1_CheckOptions(h) != nil {
+		goto Done
+	}
+	if c.step2_ProcessTIMEWAIT(h) != nil {
+		goto Done
+	}
+	if c.step3_ProcessLISTEN(h) != nil {
+		goto Done
+	}
+	if c.step4_PrepSeqNoREQUEST(h) != nil {
+		goto Done
+	}
+	if c.step5_PrepSeqNoForSync(h) != nil {
+		goto Done
+	}
+	if c.step6_CheckSeqNo(h) != nil {
+		goto Done
+	}
+	if c.dropDuplicate(h) {
+		goto Done
+	}
+	if c.step7_CheckUnexpectedTypes(h) != nil {
+		goto Done
+	}
+	c.confirmPath(h)
+	if c.step8_OptionsAndMarkAckbl(h) != nil {
+		goto Done
+	}
+	if c.step9_ProcessReset(h) != nil {
+		goto Done
+	}
+	if c.step10_ProcessREQUEST2(h) != nil {
+		goto Done
+	}
+	if c.step11_ProcessRESPOND(h) != nil {
+		goto Done
+	}
+	if c.step12_ProcessPARTOPEN(h) != nil {
+		goto Done
+	}
+	if c.step13_ProcessCloseReq(h) != nil {
+		goto Done
+	}
+	if c.step14_ProcessClose(h) != nil {
+		goto Done
+	}
+	if c.step15_ProcessSync(h) != nil {
+		goto Done
+	}
+	if c.step16_ProcessData(h) != nil {
+		goto Done
+	}
+Done:
+	c.Unlock()
+	return true
+}
+
 func (c *Conn) pollCongestionControl() {
 	now := c.env.Now()
-	if e := c.scc.OnIdle(now); e != nil {
+	if e := c.scc().OnIdle(now); e != nil {
 		if re, ok := e.(CongestionReset); ok {
 			c.abortWith(re.ResetCode())
 			return
@@ -144,7 +207,7 @@ func (c *Conn) pollCongestionControl() {
 		}
 		c.amb.E(EventError, "Sender CC unknown idle error")
 	}
-	if e := c.rcc.OnIdle(now); e != nil {
+	if e := c.rcc().OnIdle(now); e != nil {
 		if re, ok := e.(CongestionReset); ok {
 			c.abortWith(re.ResetCode())
 			return
@@ -161,8 +224,8 @@ func (c *Conn) pollCongestionControl() {
 
 func (c *Conn) syncWithCongestionControl() {
 	c.AssertLocked()
-	c.socket.SetRTT(c.scc.GetRTT())
-	c.socket.SetCCMPS(c.scc.GetCCMPS())
+	c.setRTT(c.scc().GetRTT())
+	c.socket.SetCCMPS(c.scc().GetCCMPS())
 }
 
 func (c *Conn) syncWithLink() {
@@ -0,0 +1,98 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"sync"
+)
+
+// Ownership rules for pooled objects:
+//
+// (1) Wire buffers obtained with getBuffer belong to the writer until the SegmentConn.Write or
+// Link.WriteTo call they are passed to returns. Implementations of SegmentConn and Link must
+// copy any bytes they wish to retain past the return of Write/WriteTo.
+//
+// (2) The PreHeader, FeedbackHeader and FeedforwardHeader objects handed to the CCIDs, as
+// well as the Options slices of the latter two, belong to the Conn. They are recycled as
+// soon as the respective OnWrite/OnRead call returns. CCIDs must copy whatever they retain.
+//
+// (3) The options that the CCIDs place on a PreHeader belong to the Conn, which reuses them
+// for its next packet. They are handed to HeaderConn.Write as part of the header, so
+// implementations of HeaderConn must copy the options of a header they retain past the
+// return of Write.
+
+// bufferPoolSize is the capacity of pooled wire buffers. It accommodates any UDP datagram.
+const bufferPoolSize = 1 << 16
+
+// Pools hold pointers, so that Put does not allocate
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, bufferPoolSize)
+		return &b
+	},
+}
+
+// getBuffer returns a pointer to a byte slice of length n, recycled from the pool when possible
+func getBuffer(n int) *[]byte {
+	if n > bufferPoolSize {
+		b := make([]byte, n)
+		return &b
+	}
+	p := bufferPool.Get().(*[]byte)
+	*p = (*p)[:n]
+	return p
+}
+
+// putBuffer returns a buffer obtained from getBuffer to the pool
+func putBuffer(p *[]byte) {
+	if cap(*p) != bufferPoolSize {
+		return
+	}
+	bufferPool.Put(p)
+}
+
+// Pooled FeedbackHeader and FeedforwardHeader objects keep their Options slices and decoded
+// option storage, cleared, so that filling in options does not allocate
+// once the slices have grown.
+
+// optionStoreCap is the number of received options a pooled header can hold without allocating
+const optionStoreCap = 16
+
+var feedbackHeaderPool = sync.Pool{
+	New: func() interface{} {
+		return &FeedbackHeader{Options: make([]Option, 0, optionStoreCap)}
+	},
+}
+
+func getFeedbackHeader() *FeedbackHeader { return feedbackHeaderPool.Get().(*FeedbackHeader) }
+
+func putFeedbackHeader(fb *FeedbackHeader) {
+	*fb = FeedbackHeader{Options: clearOptions(fb.Options), CCOptions: fb.CCOptions.recycle()}
+	feedbackHeaderPool.Put(fb)
+}
+
+var feedforwardHeaderPool = sync.Pool{
+	New: func() interface{} {
+		return &FeedforwardHeader{Options: make([]Option, 0, optionStoreCap)}
+	},
+}
+
+func getFeedforwardHeader() *FeedforwardHeader {
+	return feedforwardHeaderPool.Get().(*FeedforwardHeader)
+}
+
+func putFeedforwardHeader(ff *FeedforwardHeader) {
+	*ff = FeedforwardHeader{Options: clearOptions(ff.Options), CCOptions: ff.CCOptions.recycle()}
+	feedforwardHeaderPool.Put(ff)
+}
+
+// clearOptions drops the references to packet buffers held in opts, so that pooled slices do
+// not keep the buffers alive
+func clearOptions(opts []Option) []Option {
+	for i := range opts {
+		opts[i] = Option{}
+	}
+	return opts[:0]
+}
@@ -0,0 +1,102 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func poolTestHeader() *Header {
+	return &Header{
+		SourcePort: 1, DestPort: 2, Type: DataAck, X: true, SeqNo: 0x123456, AckNo: 0x654321,
+		Options: []Option{{Type: OptionElapsedTime, Data: []byte{1, 2, 3, 4}}},
+		Data:    []byte("pooled"),
+	}
+}
+
+// TestPooledHeaderWrite checks that encoding into a recycled, dirty buffer yields the same
+// wire format as encoding into a fresh one
+func TestPooledHeaderWrite(t *testing.T) {
+	h := poolTestHeader()
+	want, err := h.Write(LabelZero.Bytes(), LabelZero.Bytes(), AnyProto, false)
+	if err != nil {
+		t.Fatalf("write (%s)", err)
+	}
+	b := getBuffer(len(want))
+	for i := range *b {
+		(*b)[i] = 0xff
+	}
+	got, err := h.WriteInto((*b)[:0], LabelZero.Bytes(), LabelZero.Bytes(), AnyProto, false)
+	if err != nil {
+		t.Fatalf("pooled write (%s)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("pooled write differs:\n%x\n%x", got, want)
+	}
+	putBuffer(b)
+}
+
+func TestPooledHeaderWriteAllocs(t *testing.T) {
+	h := poolTestHeader()
+	n := testing.AllocsPerRun(100, func() {
+		b := getBuffer(0)
+		if _, err := h.WriteInto(*b, LabelZero.Bytes(), LabelZero.Bytes(), AnyProto, false); err != nil {
+			t.Fatalf("write (%s)", err)
+		}
+		putBuffer(b)
+	})
+	if n > 0 {
+		t.Errorf("pooled header write allocates %v times", n)
+	}
+}
+
+func TestPreHeaderOptions(t *testing.T) {
+	var ph PreHeader
+	av := &AckVectorOption{ Runs: []AckVectorRun{ { State: AckVectorReceived, Len: 3 } } }
+	place := func() {
+		ph.reset()
+		(&ElapsedTimeOption{ Elapsed: 1234 }).Place(&ph)
+		(&TimestampEchoOption{ Timestamp: 5678, Elapsed: 90 }).Place(&ph)
+		av.Place(&ph)
+	}
+	place()
+	// The placed options are the ones that Encode allocates
+	encoders := []interface{ Encode() (*Option, error) }{
+		&ElapsedTimeOption{ Elapsed: 1234 },
+		&TimestampEchoOption{ Timestamp: 5678, Elapsed: 90 },
+		av,
+	}
+	if len(ph.Options) != len(encoders) {
+		t.Fatalf("placed %d options", len(ph.Options))
+	}
+	for i, e := range encoders {
+		want, _ := e.Encode()
+		got := ph.Options[i]
+		if got.Type != want.Type || !bytes.Equal(got.Data, want.Data) || got.Mandatory != want.Mandatory {
+			t.Errorf("placed %v, want %v", got, want)
+		}
+	}
+	// Once the buffers have grown, placing the options of the next packet does not allocate
+	if n := testing.AllocsPerRun(100, place); n > 0 {
+		t.Errorf("placing options allocates %v times", n)
+	}
+}
+
+func BenchmarkHeaderWrite(b *testing.B) {
+	h := poolTestHeader()
+	for i := 0; i < b.N; i++ {
+		h.Write(LabelZero.Bytes(), LabelZero.Bytes(), AnyProto, false)
+	}
+}
+
+func BenchmarkPooledHeaderWrite(b *testing.B) {
+	h := poolTestHeader()
+	for i := 0; i < b.N; i++ {
+		p := getBuffer(0)
+		h.WriteInto(*p, LabelZero.Bytes(), LabelZero.Bytes(), AnyProto, false)
+		putBuffer(p)
+	}
+}
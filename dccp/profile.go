@@ -0,0 +1,46 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"context"
+	"runtime/pprof"
+)
+
+// The read loop, the write loop and the idle ticks of a Conn run with runtime/pprof labels,
+// so that CPU and goroutine profiles of a busy endpoint can be broken down per connection
+// and per subsystem:
+//
+//   conn       First label of the Amb of the connection, as in Metrics
+//   role       "client" or "server"
+//   subsystem  "read", "write" or "idle"
+//
+const (
+	ProfileRead  = "read"
+	ProfileWrite = "write"
+	ProfileIdle  = "idle"
+)
+
+// profileLabels returns the pprof labels of the goroutines of c that run subsystem
+func (c *Conn) profileLabels(subsystem string) pprof.LabelSet {
+	var conn string
+	if l := c.amb.Labels(); len(l) > 0 {
+		conn = l[0]
+	}
+	c.Lock()
+	role := "client"
+	if c.socket.IsServer() {
+		role = "server"
+	}
+	c.Unlock()
+	return pprof.Labels("conn", conn, "role", role, "subsystem", subsystem)
+}
+
+// profiled calls f with the calling goroutine labelled as running subsystem of c. The labels
+// that the goroutine had before are restored when f returns, so that goroutines shared between
+// connections, like the one of the Env's timer wheel, are attributed correctly.
+func (c *Conn) profiled(subsystem string, f func()) {
+	pprof.Do(context.Background(), c.profileLabels(subsystem), func(context.Context) { f() })
+}
@@ -0,0 +1,69 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+// QueuePolicy determines which of the messages in the write queue is sent next, and what
+// happens when the application writes while the queue is full, after the qpolicy framework
+// of Linux DCCP. The methods of a QueuePolicy are called with the write queue locked, so they
+// must not block, and must not retain the slice of queued metadata that they are passed.
+type QueuePolicy interface {
+	// Next returns the index of the message to send next, given the metadata of the queued
+	// messages in the order they were written. queued is never empty.
+	Next(queued []WriteMeta) int
+
+	// Evict is called when a message with metadata meta is written while the queue is full.
+	// It returns the index of a queued message to drop in favor of the new one, or -1 if the
+	// writer should block until a message has been sent.
+	Evict(queued []WriteMeta, meta WriteMeta) int
+}
+
+// QueueFIFO sends messages in the order they were written, and blocks writers while the
+// queue is full. It is the default queue policy.
+type QueueFIFO struct{}
+
+// Next implements QueuePolicy.Next
+func (QueueFIFO) Next(queued []WriteMeta) int { return 0 }
+
+// Evict implements QueuePolicy.Evict
+func (QueueFIFO) Evict(queued []WriteMeta, meta WriteMeta) int { return -1 }
+
+// QueueDropOldest sends messages in the order they were written. A message written while
+// the queue is full replaces the oldest queued message, so that writers never block and the
+// freshest data is sent when the congestion control rate is low.
+type QueueDropOldest struct{}
+
+// Next implements QueuePolicy.Next
+func (QueueDropOldest) Next(queued []WriteMeta) int { return 0 }
+
+// Evict implements QueuePolicy.Evict
+func (QueueDropOldest) Evict(queued []WriteMeta, meta WriteMeta) int { return 0 }
+
+// QueuePriority sends the queued message of highest WriteMeta.Priority first, and among
+// messages of equal priority the oldest one. A message written while the queue is full
+// replaces the queued message of lowest priority, the oldest one among equals, so that
+// writers never block.
+type QueuePriority struct{}
+
+// Next implements QueuePolicy.Next
+func (QueuePriority) Next(queued []WriteMeta) int {
+	best := 0
+	for i, m := range queued {
+		if m.Priority > queued[best].Priority {
+			best = i
+		}
+	}
+	return best
+}
+
+// Evict implements QueuePolicy.Evict
+func (QueuePriority) Evict(queued []WriteMeta, meta WriteMeta) int {
+	worst := 0
+	for i, m := range queued {
+		if m.Priority < queued[worst].Priority {
+			worst = i
+		}
+	}
+	return worst
+}
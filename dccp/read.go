@@ -4,7 +4,7 @@
 
 package dccp
 
-//"fmt"
+import "fmt"
 
 // verifyIPAndProto() checks that both sourceIP# and destIP# are valid for protoNo#
 func verifyIPAndProto(sourceIP, destIP []byte, protoNo byte) error {
@@ -22,15 +22,49 @@ func ReadHeader(buf []byte,
 	protoNo byte,
 	allowShortSeqNoFeature bool) (header *Header, err error) {
 
+	gh := &Header{}
+	if err = ReadHeaderInto(gh, buf, sourceIP, destIP, protoNo, allowShortSeqNoFeature); err != nil {
+		return nil, err
+	}
+	return gh, nil
+}
+
+// ReadHeaderInto is like ReadHeader, but it decodes into the caller-provided gh and does not
+// allocate. The options and the application data of gh are slices of buf. Options are
+// validated, but they are only parsed into gh.Options on demand by GetOptions.
+func ReadHeaderInto(gh *Header, buf []byte,
+	sourceIP, destIP []byte,
+	protoNo byte,
+	allowShortSeqNoFeature bool) (err error) {
+
 	err = verifyIPAndProto(sourceIP, destIP, protoNo)
 	if err != nil {
+		return err
+	}
+	return readHeaderInto(gh, buf, sourceIP, destIP, protoNo, allowShortSeqNoFeature, true)
+}
+
+// ReadHeaderNoChecksum is like ReadHeader, but it does not verify the checksum, whose
+// pseudo-header needs the IP addresses of the packet. It is meant for tools that decode
+// packets whose addresses are not known.
+func ReadHeaderNoChecksum(buf []byte, allowShortSeqNoFeature bool) (header *Header, err error) {
+	gh := &Header{}
+	if err = readHeaderInto(gh, buf, nil, nil, AnyProto, allowShortSeqNoFeature, false); err != nil {
 		return nil, err
 	}
+	return gh, nil
+}
+
+func readHeaderInto(gh *Header, buf []byte,
+	sourceIP, destIP []byte,
+	protoNo byte,
+	allowShortSeqNoFeature bool,
+	verifyChecksum bool) (err error) {
 
 	if len(buf) < 12 {
-		return nil, ErrSize
+		return ErrSize
 	}
-	gh := &Header{}
+	*gh = Header{}
 	k := 0
 
 	// Read (1a) Generic Header
@@ -60,7 +94,7 @@ func ReadHeader(buf []byte,
 	// Read Type
 	gh.Type = (buf[k] >> 1) & 0x0f
 	if !isTypeUnderstood(gh.Type) {
-		return nil, ErrUnknownType
+		return ErrUnknownType
 	}
 
 	// Read X
@@ -69,25 +103,27 @@ func ReadHeader(buf []byte,
 
 	// Check that X and Type are compatible
 	if !areTypeAndXCompatible(gh.Type, gh.X, allowShortSeqNoFeature) {
-		return nil, ErrSemantic
+		return ErrSemantic
 	}
 
 	// Check Data Offset bounds
 	if dataOffset < getFixedHeaderSize(gh.Type, gh.X) || dataOffset > len(buf) {
-		return nil, ErrNumeric
+		return ErrNumeric
 	}
 
 	// Verify checksum
 	appCov, err := getChecksumAppCoverage(gh.CsCov, len(buf)-dataOffset)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	csum := csumSum(buf[0:dataOffset])
-	csum = csumAdd(csum, csumPseudoIP(sourceIP, destIP, protoNo, len(buf)))
-	csum = csumAdd(csum, csumSum(buf[dataOffset:dataOffset+appCov]))
-	csum = csumDone(csum)
-	if csum != 0 {
-		return nil, ErrChecksum
+	if verifyChecksum {
+		csum := csumSum(buf[0:dataOffset])
+		csum = csumAdd(csum, csumPseudoIP(sourceIP, destIP, protoNo, len(buf)))
+		csum = csumAdd(csum, csumSum(buf[dataOffset:dataOffset+appCov]))
+		csum = csumDone(csum)
+		if csum != 0 {
+			return ErrChecksum
+		}
 	}
 
 	// Read SeqNo
@@ -99,7 +135,7 @@ func ReadHeader(buf []byte,
 		padding := DecodeUint8(buf[k : k+1])
 		k += 1
 		if padding != 0 {
-			return nil, ErrNumeric
+			return ErrNumeric
 		}
 		gh.SeqNo = int64(DecodeUint48(buf[k : k+6]))
 		k += 6
@@ -113,7 +149,7 @@ func ReadHeader(buf []byte,
 		padding := DecodeUint8(buf[k : k+1])
 		k += 1
 		if padding != 0 {
-			return nil, ErrNumeric
+			return ErrNumeric
 		}
 		gh.AckNo = int64(DecodeUint24(buf[k : k+3]))
 		k += 3
@@ -121,7 +157,7 @@ func ReadHeader(buf []byte,
 		padding := DecodeUint16(buf[k : k+2])
 		k += 2
 		if padding != 0 {
-			return nil, ErrNumeric
+			return ErrNumeric
 		}
 		gh.AckNo = int64(DecodeUint48(buf[k : k+6]))
 		k += 6
@@ -141,102 +177,133 @@ func ReadHeader(buf []byte,
 	}
 
 	// Read (2) Options and Padding
-	opts, err := readOptions(buf[k:dataOffset])
-	if err != nil {
-		return nil, err
-	}
-	opts, err = sanitizeOptionsAfterReading(gh.Type, opts)
-	if err != nil {
-		return nil, err
+	gh.rawOptions = buf[k:dataOffset]
+	if len(gh.rawOptions)&0x3 != 0 {
+		return ErrAlign
 	}
-	gh.Options = opts
+	gh.optionFault, gh.optionFaultType = scanOptions(gh.rawOptions, gh.Type)
 
 	// Read (3) Application Data
 	gh.Data = buf[dataOffset:]
 
-	return gh, nil
+	return nil
 }
 
-func readOptions(buf []byte) ([]*Option, error) {
-	if len(buf)&0x3 != 0 {
-		return nil, ErrAlign
+// Option faults are problems with the options of a received header, which the option parser
+// works around. Whether the header is processed regardless is up to the OptionPolicy of
+// the receiving Conn.
+const (
+	optionFaultNone      = iota
+	optionFaultMalformed // An option's length is less than 2 or runs past the options area
+	optionFaultMandatory // A Mandatory option precedes an unknown option, padding or no option at all
+)
+
+// optionFaultString describes the option fault of gh, e.g. for emitting
+func (gh *Header) optionFaultString() string {
+	switch gh.optionFault {
+	case optionFaultMalformed:
+		return fmt.Sprintf("malformed option %d", gh.optionFaultType)
+	case optionFaultMandatory:
+		return fmt.Sprintf("unknown mandatory option %d", gh.optionFaultType)
 	}
+	return "no option fault"
+}
 
-	opts := make([]*Option, len(buf))
-	j, k := 0, 0
-	for k < len(buf) {
-		o := &Option{}
-
-		// Read option type
-		t := buf[k]
-		k += 1
-
-		if isOptionSingleByte(t) {
-			o.Type = t
-			o.Data = make([]byte, 0)
-
-			opts[j] = o
-			j += 1
-			continue
-		}
-
-		// Read option length
-		if k+1 > len(buf) {
-			break
-		}
-		l := int(buf[k])
-		k += 1
-		if l < 2 || k+l-2 > len(buf) {
-			break
-		}
-
-		o.Type = t
-		o.Data = buf[k : k+l-2]
-		k += l - 2
-
-		opts[j] = o
-		j += 1
+// OptionFault describes the first fault that the option parser found in the options of gh,
+// which GetOptions works around. It returns the empty string if the options have no fault.
+func (gh *Header) OptionFault() string {
+	if gh.optionFault == optionFaultNone {
+		return ""
+	}
+	return gh.optionFaultString()
+}
 
+// scanOptions parses the wire-format options area buf and returns the first fault found in
+// it, along with the type of the option at fault
+func scanOptions(buf []byte, Type byte) (fault, faultType byte) {
+	r := optionReader{buf: buf, typ: Type}
+	var o Option
+	for r.next(&o) {
 	}
+	return r.fault, r.faultType
+}
 
-	return opts[0:j], nil
+// optionReader iterates over a wire-format options area. It skips padding, and it attaches
+// mandatory flags to the options they precede. Faulty options are skipped and the first
+// fault is recorded. Since a malformed length leaves the option boundaries unknown, the
+// options following a malformed one are skipped as well.
+type optionReader struct {
+	buf       []byte
+	k         int
+	typ       byte
+	fault     byte
+	faultType byte
 }
 
-func sanitizeOptionsAfterReading(Type byte, opts []*Option) ([]*Option, error) {
-	r := make([]*Option, len(opts))
-	j := 0
+func (r *optionReader) setFault(fault, optionType byte) {
+	if r.fault == optionFaultNone {
+		r.fault, r.faultType = fault, optionType
+	}
+}
 
+// next decodes the next option into o, whose Data is a slice of the underlying buffer.
+// It returns false when no options remain.
+func (r *optionReader) next(o *Option) bool {
 	nextIsMandatory := false
-	for i := 0; i < len(opts); i++ {
-		if !isOptionValidForType(opts[i].Type, Type) {
-			if nextIsMandatory {
-				return nil, ErrOption
+	for r.k < len(r.buf) {
+		// Read option type
+		t := r.buf[r.k]
+		r.k += 1
+
+		var data []byte
+		if isOptionSingleByte(t) {
+			data = r.buf[r.k:r.k]
+		} else {
+			// Read option length
+			if r.k+1 > len(r.buf) {
+				r.setFault(optionFaultMalformed, t)
+				r.k = len(r.buf)
+				break
 			}
+			l := int(r.buf[r.k])
+			r.k += 1
+			if l < 2 || r.k+l-2 > len(r.buf) {
+				r.setFault(optionFaultMalformed, t)
+				r.k = len(r.buf)
+				break
+			}
+			data = r.buf[r.k : r.k+l-2]
+			r.k += l - 2
+		}
+
+		valid := isOptionValidForType(t, r.typ)
+		if nextIsMandatory && (!valid || isOptionReserved(t)) {
+			// Section 5.8.2: The option following a Mandatory option must be understood
+			r.setFault(optionFaultMandatory, t)
 			nextIsMandatory = false
 			continue
 		}
-		switch opts[i].Type {
+		if !valid {
+			continue
+		}
+		switch t {
 		case OptionMandatory:
 			if nextIsMandatory {
-				return nil, ErrOption
+				r.setFault(optionFaultMandatory, t)
 			}
 			nextIsMandatory = true
 		case OptionPadding:
-			nextIsMandatory = false
-			continue
-		default:
-			r[j] = opts[i]
 			if nextIsMandatory {
-				r[j].Mandatory = true
-				nextIsMandatory = false
+				r.setFault(optionFaultMandatory, t)
 			}
-			j++
-			continue
+			nextIsMandatory = false
+		default:
+			*o = Option{Type: t, Data: data, Mandatory: nextIsMandatory}
+			return true
 		}
 	}
 	if nextIsMandatory {
-		return nil, ErrOption
+		r.setFault(optionFaultMandatory, OptionMandatory)
 	}
-
-	return r[0:j], nil
+	return false
 }
@@ -0,0 +1,60 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+// Received application data waits for ReadMsg in a bounded queue, so that a slow application
+// does not make the Conn buffer without bound. Data that arrives when the queue is full is
+// dropped and reported to the peer with Drop Code 2, "Receive Buffer", Section 11.7. Before it
+// comes to that, a queue that fills past its high-water mark asks the peer to hold its rate
+// with the Slow Receiver option, Section 11.6.
+const (
+	READ_QUEUE_MAX     = 64 // Capacity of the receive queue, and the largest limit of SetReadQueue
+	READ_QUEUE_DEFAULT = 5  // Receive queue limit of a new Conn
+)
+
+// SetReadQueue sets the number of received messages that wait for ReadMsg before further
+// application data is dropped, and the high-water mark beyond which every packet sent carries
+// a Slow Receiver option. A highWater of zero sends no Slow Receiver options.
+func (c *Conn) SetReadQueue(limit, highWater int) error {
+	if limit < 1 || limit > READ_QUEUE_MAX || highWater < 0 {
+		return ErrBad
+	}
+	c.readAppLk.Lock()
+	defer c.readAppLk.Unlock()
+	c.readLimit, c.readHighWater = limit, highWater
+	return nil
+}
+
+// pushRead queues a received message for ReadMsg. It returns false if the queue is full, and
+// true as the second value if the message takes the queue past its high-water mark.
+func (c *Conn) pushRead(m readMsg) (queued, slow bool) {
+	if len(c.readApp) >= c.readLimit {
+		return false, false
+	}
+	c.readApp <- m
+	return true, c.readHighWater > 0 && len(c.readApp) == c.readHighWater+1
+}
+
+// readQueued returns the number of received messages waiting for ReadMsg
+func (c *Conn) readQueued() int {
+	c.readAppLk.Lock()
+	defer c.readAppLk.Unlock()
+	return len(c.readApp)
+}
+
+// isSlowReceiver returns true if the receive queue is filled past its high-water mark
+func (c *Conn) isSlowReceiver() bool {
+	c.readAppLk.Lock()
+	defer c.readAppLk.Unlock()
+	return c.readApp != nil && c.readHighWater > 0 && len(c.readApp) > c.readHighWater
+}
+
+// placeSlowReceiver adds a Slow Receiver option to h while the receive queue is filled past
+// its high-water mark
+func (c *Conn) placeSlowReceiver(h *writeHeader) {
+	if c.isSlowReceiver() {
+		h.Options = append(h.Options, Option{ Type: OptionSlowReceiver })
+	}
+}
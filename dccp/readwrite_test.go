@@ -24,8 +24,8 @@ var testHeaders = []*Header{
 		ServiceCode: 0,
 		ResetCode:   0,
 		ResetData:   nil,
-		Options: []*Option{
-			&Option{OptionSlowReceiver, nil, true},
+		Options: []Option{
+			Option{OptionSlowReceiver, []byte{}, true},
 		},
 		Data: []byte{1, 2, 3, 0, 4, 5, 6, 7, 8, 9},
 	},
@@ -55,7 +55,14 @@ func TestReadWrite(t *testing.T) {
 		if err != nil {
 			t.Errorf("read error: %s", err)
 		} else {
+			gh2.GetOptions()
 			diff(t, "** ", gh2, gh)
+			if gh2.optionFault != 0 {
+				t.Errorf("read option fault %d in option %d", gh2.optionFault, gh2.optionFaultType)
+			}
+			if off := int(hd[4]) * 4; !bytes.Equal(gh2.rawOptions, hd[getFixedHeaderSize(gh.Type, gh.X):off]) {
+				t.Errorf("read raw options %v", gh2.rawOptions)
+			}
 		}
 	}
 }
@@ -75,6 +82,11 @@ func diff(t *testing.T, prefix string, have, want interface{}) {
 		t.Errorf("%s: type mismatch %v vs %v", prefix, hv.Type(), wv.Type())
 	}
 	for i := 0; i < hv.NumField(); i++ {
+		// Unexported fields keep the wire options of a received header, which a header built
+		// in memory lacks, so TestReadWrite checks them on their own
+		if hv.Type().Field(i).PkgPath != "" {
+			continue
+		}
 		hf := hv.Field(i).Interface()
 		wf := wv.Field(i).Interface()
 		if !reflect.DeepEqual(hf, wf) {
@@ -82,3 +94,136 @@ func diff(t *testing.T, prefix string, have, want interface{}) {
 		}
 	}
 }
+
+var (
+	allocTestSourceIP = []byte{1, 2, 3, 4}
+	allocTestDestIP   = []byte{5, 6, 7, 8}
+)
+
+func allocTestWire(t testing.TB) []byte {
+	gh := &Header{
+		SourcePort: 33, DestPort: 77, CCVal: 1, Type: DataAck, X: true,
+		SeqNo: 0x334455667788, AckNo: 0x112233445566,
+		Options: []Option{
+			Option{OptionElapsedTime, []byte{1, 2, 3, 4}, false},
+			Option{OptionSlowReceiver, []byte{}, true},
+			Option{OptionAckVectorNonce0, []byte{5, 6}, false},
+		},
+		Data: []byte{1, 2, 3},
+	}
+	p, err := gh.Write(allocTestSourceIP, allocTestDestIP, 34, false)
+	if err != nil {
+		t.Fatalf("write (%s)", err)
+	}
+	return p
+}
+
+// TestLazyOptions checks that options parsed on demand and options iterated without allocation
+// agree with each other
+func TestLazyOptions(t *testing.T) {
+	p := allocTestWire(t)
+	var gh Header
+	if err := ReadHeaderInto(&gh, p, allocTestSourceIP, allocTestDestIP, 34, false); err != nil {
+		t.Fatalf("read (%s)", err)
+	}
+	all := func(byte) bool { return true }
+	iter := gh.appendOptions(make([]Option, 0, optionStoreCap), all)
+	opts := gh.GetOptions()
+	if len(opts) != 3 || len(iter) != len(opts) {
+		t.Fatalf("option count %d, %d", len(opts), len(iter))
+	}
+	for i, o := range opts {
+		if !reflect.DeepEqual(o, iter[i]) {
+			t.Errorf("option %d: %v vs %v", i, o, iter[i])
+		}
+	}
+	if !opts[1].Mandatory || opts[0].Mandatory {
+		t.Errorf("mandatory flags misplaced")
+	}
+}
+
+// TestHeaderAllocs guards the allocation-free encode and decode paths
+func TestHeaderAllocs(t *testing.T) {
+	p := allocTestWire(t)
+	var gh Header
+	buf := make([]byte, 0, 1500)
+	dst := make([]Option, 0, optionStoreCap)
+	n := testing.AllocsPerRun(100, func() {
+		if err := ReadHeaderInto(&gh, p, allocTestSourceIP, allocTestDestIP, 34, false); err != nil {
+			t.Fatalf("read (%s)", err)
+		}
+		dst = gh.appendOptions(dst[:0], isOptionCCIDReceiverToSender)
+	})
+	if n > 0 {
+		t.Errorf("decode allocates %v times", n)
+	}
+	gh.GetOptions()
+	n = testing.AllocsPerRun(100, func() {
+		if _, err := gh.WriteInto(buf, allocTestSourceIP, allocTestDestIP, 34, false); err != nil {
+			t.Fatalf("write (%s)", err)
+		}
+	})
+	if n > 0 {
+		t.Errorf("encode allocates %v times", n)
+	}
+}
+
+func BenchmarkReadHeader(b *testing.B) {
+	p := allocTestWire(b)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		gh, _ := ReadHeader(p, allocTestSourceIP, allocTestDestIP, 34, false)
+		gh.GetOptions()
+	}
+}
+
+func BenchmarkReadHeaderInto(b *testing.B) {
+	p := allocTestWire(b)
+	var gh Header
+	dst := make([]Option, 0, optionStoreCap)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ReadHeaderInto(&gh, p, allocTestSourceIP, allocTestDestIP, 34, false)
+		dst = gh.appendOptions(dst[:0], isOptionCCIDReceiverToSender)
+	}
+}
+
+// TestPadding checks that Padding options bring a header to the requested wire size, and
+// that they are skipped when the header is read back
+func TestPadding(t *testing.T) {
+	for _, size := range []int{0, 20, 64, 101, 2000} {
+		gh := &Header{
+			Type:    DataAck,
+			X:       true,
+			SeqNo:   5,
+			AckNo:   3,
+			Options: []Option{{Type: OptionSlowReceiver, Data: nil, Mandatory: false}},
+			Data:    []byte{1, 2, 3, 4, 5, 6},
+		}
+		gh.padTo(size)
+		buf, err := gh.Write([]byte{1, 2, 3, 4}, []byte{5, 6, 7, 8}, 34, false)
+		if err != nil {
+			t.Fatalf("write %d (%s)", size, err)
+		}
+		want := size
+		if min := getFixedHeaderSize(DataAck, true) + 4 + len(gh.Data); want < min {
+			want = min
+		}
+		if max := maxHeaderLen + len(gh.Data); want > max {
+			want = max
+		}
+		if len(buf) < want || len(buf) > want+3 {
+			t.Errorf("padding to %d gave %d bytes", size, len(buf))
+		}
+		gh2, err := ReadHeader(buf, []byte{1, 2, 3, 4}, []byte{5, 6, 7, 8}, 34, false)
+		if err != nil {
+			t.Fatalf("read %d (%s)", size, err)
+		}
+		if opts := gh2.GetOptions(); len(opts) != 1 || opts[0].Type != OptionSlowReceiver {
+			t.Errorf("padding to %d read options %v", size, opts)
+		}
+		if !bytes.Equal(gh2.Data, gh.Data) {
+			t.Errorf("padding to %d read data %v", size, gh2.Data)
+		}
+	}
+}
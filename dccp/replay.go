@@ -0,0 +1,225 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"sync"
+)
+
+// Replay runs the inputs of a Journal against a fresh Conn. The Conn is connected to a
+// HeaderConn that delivers the recorded packets at their recorded times and keeps the packets
+// that the Conn sends, and the recorded application calls are made at their times. The Env
+// of the replay is seeded with the seed of the journal and made to choose the recorded ISS, so
+// that the sequence numbers of the replay match those of the recording. Ticks of the idle
+// timer are not replayed, since the Conn schedules them by itself. In an Env with DilatedTime,
+// a long journal replays faster than it was recorded.
+//
+// The replay is as deterministic as the Conn itself: its goroutines still race one another,
+// so a replay may depart from the recording where the recorded timing was tight. Divergence
+// tells where it did.
+
+// ReplayRun is a replay of a Journal, see Replay
+type ReplayRun struct {
+	Conn *Conn
+	j    *Journal
+	hc   *replayConn
+	done chan int
+}
+
+// Replay starts replaying the journal j against a new Conn in env, which uses the congestion
+// controls scc and rcc. The Env should be dedicated to the replay.
+func Replay(env *Env, amb *Amb, j *Journal, scc SenderCongestionControl, rcc ReceiverCongestionControl) *ReplayRun {
+	env.SetSeed(j.Seed)
+	if j.ISS != 0 {
+		env.SetISNFunc(func() int64 { return j.ISS })
+	}
+	r := &ReplayRun{
+		j:    j,
+		hc:   newReplayConn(env, j.MTU),
+		done: make(chan int),
+	}
+	start := env.Now()
+	if j.Server {
+		r.Conn = newConnServer(env, amb, r.hc, scc, rcc, j.ServiceCode)
+	} else {
+		r.Conn = NewConnClient(env, amb, r.hc, scc, rcc, j.ServiceCode)
+	}
+	reads := make(chan int, len(j.Entries))
+	env.Go(func() {
+		for _ = range reads {
+			if _, _, err := r.Conn.ReadMsg(); err != nil {
+				return
+			}
+		}
+	}, "Replay·read")
+	env.Go(func() {
+		defer close(r.done)
+		defer close(reads)
+		for _, e := range j.Entries {
+			if d := start + e.Time - env.Now(); d > 0 {
+				env.Sleep(d)
+			}
+			r.replay(e, start, reads)
+		}
+	}, "Replay·entries")
+	return r
+}
+
+// replay makes the input of entry e
+func (r *ReplayRun) replay(e *JournalEntry, start int64, reads chan<- int) {
+	switch e.Kind {
+	case JournalRecv:
+		r.hc.deliver(PacketView{ h: e.Header }.Copy())
+	case JournalWrite:
+		meta := WriteMeta{}
+		if e.Meta != nil {
+			meta = *e.Meta
+		}
+		if meta.Deadline != 0 {
+			meta.Deadline += start
+		}
+		r.Conn.push(e.Data, meta)
+	case JournalRead:
+		reads <- 1
+	case JournalFlush:
+		r.Conn.Flush()
+	case JournalClose:
+		r.Conn.Close()
+	case JournalCloseRead:
+		r.Conn.CloseRead()
+	case JournalCloseWrite:
+		r.Conn.CloseWrite()
+	case JournalAbort:
+		r.Conn.Abort()
+	}
+}
+
+// Wait blocks until all entries of the journal have been replayed. The Conn may still run
+// afterwards.
+func (r *ReplayRun) Wait() {
+	<-r.done
+}
+
+// Sent returns the packets that the Conn has sent so far
+func (r *ReplayRun) Sent() []*Header {
+	return r.hc.sentHeaders()
+}
+
+// Divergence returns the index of the first packet sent in the replay whose type, sequence
+// number or acknowledgement number differs from the packet sent at the same position in the
+// recording, or -1 if there is none
+func (r *ReplayRun) Divergence() int {
+	sent := r.Sent()
+	i := 0
+	for _, e := range r.j.Entries {
+		if e.Kind != JournalSent {
+			continue
+		}
+		if i >= len(sent) {
+			return i
+		}
+		h := sent[i]
+		if h.Type != e.Header.Type || h.SeqNo != e.Header.SeqNo || h.AckNo != e.Header.AckNo {
+			return i
+		}
+		i++
+	}
+	return -1
+}
+
+// replayConn is the HeaderConn of a replayed Conn
+type replayConn struct {
+	env *Env
+	mtu int
+	in  chan *Header
+
+	sync.Mutex
+	sent     []*Header
+	deadline int64
+	closed   bool
+}
+
+func newReplayConn(env *Env, mtu int) *replayConn {
+	return &replayConn{ env: env, mtu: mtu, in: make(chan *Header, 64) }
+}
+
+func (x *replayConn) deliver(h *Header) {
+	x.Lock()
+	closed := x.closed
+	x.Unlock()
+	if closed {
+		return
+	}
+	select {
+	case x.in <- h:
+	default:
+		// The replayed Conn does not keep up; a real link would lose the packet too
+	}
+}
+
+func (x *replayConn) sentHeaders() []*Header {
+	x.Lock()
+	defer x.Unlock()
+	return append([]*Header(nil), x.sent...)
+}
+
+func (x *replayConn) GetMTU() int { return x.mtu }
+
+func (x *replayConn) Read() (*Header, error) {
+	x.Lock()
+	closed, timeout := x.closed, x.deadline - x.env.Now()
+	x.Unlock()
+	if closed {
+		return nil, ErrEOF
+	}
+	select {
+	case h := <-x.in:
+		return h, nil
+	default:
+	}
+	if timeout <= 0 {
+		return nil, ErrTimeout
+	}
+	expire := make(chan int)
+	t := x.env.AfterFunc(timeout, func() { close(expire) }, "Replay·expire")
+	defer t.Stop()
+	select {
+	case h := <-x.in:
+		return h, nil
+	case <-expire:
+		return nil, ErrTimeout
+	}
+}
+
+func (x *replayConn) Write(h *Header) error {
+	x.Lock()
+	defer x.Unlock()
+	if x.closed {
+		return ErrBad
+	}
+	x.sent = append(x.sent, PacketView{ h: h }.Copy())
+	return nil
+}
+
+func (x *replayConn) LocalLabel() Bytes { return nil }
+
+func (x *replayConn) RemoteLabel() Bytes { return nil }
+
+func (x *replayConn) SetReadExpire(nsec int64) error {
+	if nsec < 0 {
+		return ErrInvalid
+	}
+	x.Lock()
+	defer x.Unlock()
+	x.deadline = x.env.Now() + nsec
+	return nil
+}
+
+func (x *replayConn) Close() error {
+	x.Lock()
+	defer x.Unlock()
+	x.closed = true
+	return nil
+}
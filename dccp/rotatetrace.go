@@ -0,0 +1,209 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// RotatingTraceWriter saves traces to a file that is rolled over once it grows past a size or
+// covers more than a span of trace time, so that long-running soak tests and deployments do not
+// accumulate unbounded trace files. On rollover, the current file is renamed to name.1, and
+// earlier ones move up to name.2, name.3 and so on, optionally compressed with gzip to
+// name.1.gz and so on. Every file starts a fresh encoding, so each can be decoded by itself.
+type RotatingTraceWriter struct {
+	sync.Mutex
+	name   string
+	policy RotatePolicy
+	newEnc func(io.Writer) TraceWriter
+	f      *countingFile
+	enc    TraceWriter
+	start  int64 // Trace time of the first record in the current file
+	empty  bool  // Set while the current file holds no records
+	err    error // First error encountered, reported by Sync and Close
+}
+
+// RotatePolicy decides when a RotatingTraceWriter rolls over, and which old files it keeps
+type RotatePolicy struct {
+	MaxSize  int64 // Size in bytes past which the file is rolled over; zero for no limit
+	MaxAge   int64 // Span of trace time after which the file is rolled over; zero for no limit
+	Keep     int   // Number of old files kept; zero keeps all of them
+	Compress bool  // Whether old files are compressed with gzip
+}
+
+// countingFile counts the bytes written to a file
+type countingFile struct {
+	*os.File
+	n int64
+}
+
+func (f *countingFile) Write(p []byte) (int, error) {
+	n, err := f.File.Write(p)
+	f.n += int64(n)
+	return n, err
+}
+
+// NewRotatingTraceWriter creates a RotatingTraceWriter that writes to the file name, with the
+// encoding made by newEnc, such as NewJSONTraceWriter. A nil newEnc selects JSON.
+func NewRotatingTraceWriter(name string, policy RotatePolicy, newEnc func(io.Writer) TraceWriter) (*RotatingTraceWriter, error) {
+	if newEnc == nil {
+		newEnc = func(w io.Writer) TraceWriter { return NewJSONTraceWriter(w) }
+	}
+	t := &RotatingTraceWriter{ name: name, policy: policy, newEnc: newEnc }
+	if err := t.open(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// open starts a new current file
+func (t *RotatingTraceWriter) open() error {
+	f, err := os.Create(t.name)
+	if err != nil {
+		return err
+	}
+	t.f = &countingFile{ File: f }
+	t.enc = t.newEnc(t.f)
+	t.empty = true
+	return nil
+}
+
+// Write implements TraceWriter.Write
+func (t *RotatingTraceWriter) Write(r *Trace) {
+	t.Lock()
+	defer t.Unlock()
+	if t.enc == nil {
+		return
+	}
+	if !t.empty && t.due(r) {
+		if err := t.rotate(); err != nil {
+			t.fail(err)
+			return
+		}
+	}
+	if t.empty {
+		t.start, t.empty = r.Time, false
+	}
+	t.enc.Write(r)
+}
+
+// due returns true if the current file must be rolled over before r is written to it
+func (t *RotatingTraceWriter) due(r *Trace) bool {
+	if t.policy.MaxSize > 0 && t.f.n >= t.policy.MaxSize {
+		return true
+	}
+	return t.policy.MaxAge > 0 && r.Time - t.start >= t.policy.MaxAge
+}
+
+func (t *RotatingTraceWriter) fail(err error) {
+	if t.err == nil {
+		t.err = err
+	}
+}
+
+// Rotate rolls the current file over, regardless of the policy
+func (t *RotatingTraceWriter) Rotate() error {
+	t.Lock()
+	defer t.Unlock()
+	if t.enc == nil {
+		return ErrBad
+	}
+	return t.rotate()
+}
+
+func (t *RotatingTraceWriter) rotate() error {
+	t.enc.Sync()
+	if err := t.f.Close(); err != nil {
+		return err
+	}
+	t.enc = nil
+
+	// Make room for name.1 by moving the older files up, dropping the oldest
+	n := 1
+	for t.policy.Keep == 0 || n < t.policy.Keep {
+		if _, err := os.Stat(t.oldName(n)); err != nil {
+			break
+		}
+		n++
+	}
+	os.Remove(t.oldName(n))
+	for i := n; i > 1; i-- {
+		if err := os.Rename(t.oldName(i-1), t.oldName(i)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := t.retire(); err != nil {
+		return err
+	}
+	return t.open()
+}
+
+// retire moves the current file to name.1, compressing it if so required
+func (t *RotatingTraceWriter) retire() error {
+	if !t.policy.Compress {
+		return os.Rename(t.name, t.oldName(1))
+	}
+	src, err := os.Open(t.name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(t.oldName(1))
+	if err != nil {
+		return err
+	}
+	z := gzip.NewWriter(dst)
+	if _, err = io.Copy(z, src); err == nil {
+		err = z.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Remove(t.name)
+}
+
+// oldName returns the name of the i-th most recent old file
+func (t *RotatingTraceWriter) oldName(i int) string {
+	s := fmt.Sprintf("%s.%d", t.name, i)
+	if t.policy.Compress {
+		s += ".gz"
+	}
+	return s
+}
+
+// Sync implements TraceWriter.Sync
+func (t *RotatingTraceWriter) Sync() error {
+	t.Lock()
+	defer t.Unlock()
+	if t.err != nil {
+		return t.err
+	}
+	if t.enc == nil {
+		return nil
+	}
+	return t.enc.Sync()
+}
+
+// Close implements TraceWriter.Close
+func (t *RotatingTraceWriter) Close() error {
+	t.Lock()
+	defer t.Unlock()
+	if t.enc == nil {
+		return t.err
+	}
+	t.enc.Sync()
+	t.enc = nil
+	if err := t.f.Close(); err != nil {
+		t.fail(err)
+	}
+	return t.err
+}
@@ -0,0 +1,95 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+)
+
+func TestRotatingTraceWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotatetrace")
+	if err != nil {
+		t.Fatalf("temp dir (%s)", err)
+	}
+	defer os.RemoveAll(dir)
+	name := path.Join(dir, "trace.bin")
+	w, err := NewRotatingTraceWriter(name, RotatePolicy{ MaxSize: 200, Keep: 3, Compress: true },
+		func(w io.Writer) TraceWriter { return NewBinaryTraceWriter(w) })
+	if err != nil {
+		t.Fatalf("create (%s)", err)
+	}
+	for i := 0; i < 100; i++ {
+		w.Write(&Trace{ Time: int64(i), Labels: []string{"client"}, Event: EventInfo, Comment: "Rotate" })
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close (%s)", err)
+	}
+	if _, err := os.Stat(name + ".4.gz"); err == nil {
+		t.Errorf("more than 3 old files kept")
+	}
+
+	// Each file decodes by itself, and the records continue from one file to the next
+	last := int64(100)
+	for _, f := range []string{name, name + ".1.gz", name + ".2.gz", name + ".3.gz"} {
+		file, err := os.Open(f)
+		if err != nil {
+			t.Fatalf("open (%s)", err)
+		}
+		var r io.Reader = file
+		if f != name {
+			if r, err = gzip.NewReader(file); err != nil {
+				t.Fatalf("gunzip %s (%s)", f, err)
+			}
+		}
+		br, err := NewBinaryTraceReader(r)
+		if err != nil {
+			t.Fatalf("read %s (%s)", f, err)
+		}
+		var times []int64
+		for {
+			tr, err := br.Read()
+			if err != nil {
+				break
+			}
+			times = append(times, tr.Time)
+		}
+		file.Close()
+		if len(times) == 0 || times[len(times)-1] != last-1 {
+			t.Fatalf("%s holds times %v, expected to end at %d", f, times, last-1)
+		}
+		last = times[0]
+	}
+}
+
+func TestRotatingTraceWriterAge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotatetrace")
+	if err != nil {
+		t.Fatalf("temp dir (%s)", err)
+	}
+	defer os.RemoveAll(dir)
+	name := path.Join(dir, "trace.emit")
+	w, err := NewRotatingTraceWriter(name, RotatePolicy{ MaxAge: 10e9 }, nil)
+	if err != nil {
+		t.Fatalf("create (%s)", err)
+	}
+	for i := int64(0); i < 50; i++ {
+		w.Write(&Trace{ Time: i * 1e9, Event: EventInfo })
+	}
+	w.Close()
+	for i := 1; i <= 4; i++ {
+		if _, err := os.Stat(name + "." + strconv.Itoa(i)); err != nil {
+			t.Errorf("old file %d missing (%s)", i, err)
+		}
+	}
+	if _, err := os.Stat(name + ".5"); err == nil {
+		t.Errorf("rolled over too often")
+	}
+}
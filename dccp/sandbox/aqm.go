@@ -0,0 +1,178 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"math"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// Queue is an active queue management discipline for the buffer of a link, which signals
+// congestion before the buffer overflows, as opposed to the tail-drop of SetWriteBandwidth. A
+// Queue keeps state about the link it is attached to, and must not be attached to another.
+//
+// The links of the sandbox do not hold packets in a queue, but compute the time when each
+// packet leaves the link as it arrives. A Queue therefore decides the fate of a packet as it
+// arrives, knowing how long the packet will wait and the time when it will leave the queue.
+type Queue interface {
+	// Admit decides the fate of a packet that arrives at time now and finds backlog bytes
+	// queued ahead of it, which keep it waiting for wait nanoseconds. Ect is set if the packet
+	// is ECN-capable.
+	Admit(now, wait, backlog int64, ect bool) Verdict
+}
+
+// Verdict is the fate of a packet that arrives at a Queue
+type Verdict int
+
+const (
+	QueuePass Verdict = iota // The packet is queued
+	QueueMark                // The packet is queued, marked Congestion Experienced
+	QueueDrop                // The packet is dropped
+)
+
+// signal returns QueueMark for an ECN-capable packet, if the queue marks packets, and
+// QueueDrop otherwise
+func signal(ecn, ect bool) Verdict {
+	if ecn && ect {
+		return QueueMark
+	}
+	return QueueDrop
+}
+
+// isECT returns true if the ECN codepoint ecn marks an ECN-capable packet
+func isECT(ecn byte) bool {
+	return ecn == dccp.ECNECT0 || ecn == dccp.ECNECT1
+}
+
+// RED is Random Early Detection, after Floyd and Jacobson, "Random Early Detection Gateways
+// for Congestion Avoidance", 1993. It signals congestion with a probability that grows with
+// the average backlog of the queue.
+type RED struct {
+	env      *dccp.Env
+	minTh    int64   // Average backlog in bytes below which no packet is signaled
+	maxTh    int64   // Average backlog in bytes above which every packet is dropped
+	maxP     float64 // Signaling probability as the average backlog reaches maxTh
+	ecn      bool    // Mark ECN-capable packets instead of dropping them
+	avg      float64 // Moving average of the backlog in bytes
+	count    int     // Packets queued since the last signal, or -1 while the average is below minTh
+	last     int64   // Time of the last arrival
+}
+
+// RED_WEIGHT is the weight of a new backlog sample in the moving average of RED
+const RED_WEIGHT = 0.002
+
+// NewRED creates a RED queue, which starts to signal congestion once the average backlog
+// exceeds minTh bytes, signals with probability up to maxP until the average reaches maxTh
+// bytes, and drops every packet beyond. If ecn is set, ECN-capable packets are marked rather
+// than dropped below maxTh.
+func NewRED(env *dccp.Env, minTh, maxTh int64, maxP float64, ecn bool) *RED {
+	return &RED{ env: env, minTh: minTh, maxTh: maxTh, maxP: maxP, ecn: ecn, count: -1 }
+}
+
+// Admit implements Queue.Admit
+func (q *RED) Admit(now, wait, backlog int64, ect bool) Verdict {
+	if backlog == 0 && q.last > 0 {
+		// The queue went idle since the last arrival, which decays the average as if an empty
+		// sample had arrived every millisecond
+		q.avg *= math.Pow(1-RED_WEIGHT, float64(now-q.last)/1e6)
+	}
+	q.avg = (1-RED_WEIGHT)*q.avg + RED_WEIGHT*float64(backlog)
+	q.last = now
+
+	switch {
+	case q.avg < float64(q.minTh):
+		q.count = -1
+		return QueuePass
+	case q.avg >= float64(q.maxTh):
+		q.count = 0
+		return QueueDrop
+	}
+	q.count++
+	pb := q.maxP * (q.avg - float64(q.minTh)) / float64(q.maxTh-q.minTh)
+	pa := 1.0
+	if d := 1 - float64(q.count)*pb; d > 0 {
+		pa = pb / d
+	}
+	if q.env.Float64() < pa {
+		q.count = 0
+		return signal(q.ecn, ect)
+	}
+	return QueuePass
+}
+
+// CoDel is Controlled Delay, RFC 8289. It signals congestion once the time that packets wait
+// in the queue has stayed above a target for an interval, at a pace that quickens with the
+// square root of the number of signals while the delay stays above the target.
+type CoDel struct {
+	target     int64 // Acceptable standing queue delay in ns
+	interval   int64 // Time in ns that the delay may exceed target before signaling begins
+	ecn        bool  // Mark ECN-capable packets instead of dropping them
+	firstAbove int64 // Time when the delay will have been above target for an interval, or zero
+	dropping   bool  // Set while in the signaling state
+	dropNext   int64 // Time of the next signal, in the signaling state
+	count      int   // Signals since entering the signaling state
+	lastCount  int   // Count when the signaling state was last entered
+}
+
+// NewCoDel creates a CoDel queue with the given target and interval in nanoseconds. RFC 8289
+// recommends 5ms and 100ms. If ecn is set, ECN-capable packets are marked rather than dropped.
+func NewCoDel(target, interval int64, ecn bool) *CoDel {
+	return &CoDel{ target: target, interval: interval, ecn: ecn }
+}
+
+// Admit implements Queue.Admit. The algorithm of RFC 8289 runs when the packet leaves the
+// queue, at time now+wait, and the time the packet waits is its sojourn time.
+func (q *CoDel) Admit(now, wait, backlog int64, ect bool) Verdict {
+	now += wait
+	okToSignal := false
+	if wait < q.target {
+		q.firstAbove = 0
+	} else if q.firstAbove == 0 {
+		q.firstAbove = now + q.interval
+	} else if now >= q.firstAbove {
+		okToSignal = true
+	}
+
+	if q.dropping {
+		if !okToSignal {
+			q.dropping = false
+			return QueuePass
+		}
+		if now >= q.dropNext {
+			q.count++
+			q.dropNext = q.controlLaw(q.dropNext)
+			return signal(q.ecn, ect)
+		}
+		return QueuePass
+	}
+	if !okToSignal {
+		return QueuePass
+	}
+	q.dropping = true
+	// Resume near the previous pace if the signaling state was left recently
+	if delta := q.count - q.lastCount; delta > 1 && now-q.dropNext < 16*q.interval {
+		q.count = delta
+	} else {
+		q.count = 1
+	}
+	q.lastCount = q.count
+	q.dropNext = q.controlLaw(now)
+	return signal(q.ecn, ect)
+}
+
+// controlLaw returns the time of the next signal after one at time t
+func (q *CoDel) controlLaw(t int64) int64 {
+	return t + int64(float64(q.interval)/math.Sqrt(float64(q.count)))
+}
+
+// linkAdmit asks q, if not nil, about a packet that arrives at time now at a link of bandwidth
+// bytes per second, which is busy until free
+func linkAdmit(q Queue, now, free, bandwidth int64, ect bool) Verdict {
+	if q == nil {
+		return QueuePass
+	}
+	wait := max64(free-now, 0)
+	return q.Admit(now, wait, (wait*bandwidth)/1e9, ect)
+}
@@ -0,0 +1,103 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// TestRED checks that RED passes packets while the average backlog is below its lower
+// threshold, marks ECN-capable packets and drops others between the thresholds, and drops all
+// packets beyond the upper threshold
+func TestRED(t *testing.T) {
+	env := dccp.NewEnv(nil)
+	q := NewRED(env, 10e3, 30e3, 0.1, true)
+	count := func(backlog int64, ect bool) (marked, dropped int) {
+		for i := 0; i < 5000; i++ {
+			switch q.Admit(int64(i)*1e6, 0, backlog, ect) {
+			case QueueMark:
+				marked++
+			case QueueDrop:
+				dropped++
+			}
+		}
+		return marked, dropped
+	}
+	if m, d := count(5e3, true); m != 0 || d != 0 {
+		t.Errorf("below threshold marked %d, dropped %d", m, d)
+	}
+	if m, d := count(20e3, true); m == 0 || d != 0 {
+		t.Errorf("ECN-capable between thresholds marked %d, dropped %d", m, d)
+	}
+	if m, d := count(20e3, false); m != 0 || d == 0 {
+		t.Errorf("between thresholds marked %d, dropped %d", m, d)
+	}
+	if m, d := count(40e3, true); d < 4000 {
+		t.Errorf("beyond threshold marked %d, dropped %d", m, d)
+	}
+}
+
+// TestCoDel checks that CoDel signals once the sojourn time has stayed above target for an
+// interval, signals at a quickening pace while it stays there, and stops once it falls below
+func TestCoDel(t *testing.T) {
+	q := NewCoDel(5e6, 100e6, false)
+	var signals []int64
+	for now := int64(0); now < 1e9; now += 1e6 {
+		if q.Admit(now, 10e6, 1000, false) == QueueDrop {
+			signals = append(signals, now+10e6)
+		}
+	}
+	if len(signals) < 3 || signals[0] != 110e6 {
+		t.Fatalf("signals at %v", signals)
+	}
+	for i := 2; i < len(signals); i++ {
+		if signals[i]-signals[i-1] > signals[i-1]-signals[i-2] {
+			t.Errorf("signal spacing grows at %v", signals)
+			break
+		}
+	}
+	if v := q.Admit(1e9, 1e6, 1000, false); v != QueuePass {
+		t.Errorf("verdict %d below target", v)
+	}
+}
+
+// TestScenarioCoDel checks that CoDel keeps the queueing delay of a link with an unbounded
+// buffer short, by dropping packets of a fixed-rate sender that offers twice what the link can
+// carry. Tail-drop lets the delay grow to seconds.
+func TestScenarioCoDel(t *testing.T) {
+	NewScenario("scenario-codel").
+		Fixed().
+		Dilate(4).
+		Payload(1000).
+		At(0, func(r *ScenarioRun) {
+			r.ClientToServer.SetWriteBandwidth(50e3, 0)
+			r.ClientToServer.SetWriteQueue(NewCoDel(5e6, 100e6, false))
+		}).
+		ClientSends(500, 10e6).
+		ExpectReceived(200, 400).
+		ExpectLatency(95, 400e6).
+		Run(t)
+}
+
+// TestScenarioCoDelECN checks that CoDel marks the packets of an ECN-capable sender instead of
+// dropping them, and that the marks reach the receiver. The fixed-rate sender does not react
+// to the marks, so the queue keeps growing.
+func TestScenarioCoDelECN(t *testing.T) {
+	NewScenario("scenario-codel-ecn").
+		Fixed().
+		Dilate(4).
+		Payload(1000).
+		At(0, func(r *ScenarioRun) {
+			r.Client.SetECN(true)
+			r.ClientToServer.SetWriteBandwidth(30e3, 0)
+			r.ClientToServer.SetWriteQueue(NewCoDel(5e6, 100e6, true))
+		}).
+		ClientSends(300, 20e6).
+		Settle(6e9).
+		ExpectReceived(300, 300).
+		ExpectMarked(200, 300).
+		Run(t)
+}
@@ -0,0 +1,34 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"testing"
+	"github.com/petar/GoDCCP/dccp/bbr"
+)
+
+// TestBBR checks that the experimental model-based congestion control finds the capacity of a
+// 50 KBps link with an unbounded buffer, while the client offers more than the link can carry.
+// The path takes about 80ms, with the transmission and the delayed Acks. The congestion window
+// of twice the estimated bandwidth-delay product bounds the queue, so the round-trip time stays
+// within about twice that of the path, however large the buffer. It runs on virtual time, so
+// that the load of the machine does not perturb the estimates of bandwidth and delay.
+func TestBBR(t *testing.T) {
+	NewScenario("bbr").
+		CCID(bbr.BBR{}).
+		Virtual().
+		Payload(1000).
+		At(0, func(r *ScenarioRun) {
+			r.ClientToServer.SetWriteLatency(25e6)
+			r.ServerToClient.SetWriteLatency(25e6)
+		}).
+		BandwidthAfter(0, 50e3, 0).
+		SampleRTT(100e6).
+		ClientSends(2000, 10e6).
+		ExpectRate(5e9, 20e9, 46, 50).
+		ExpectRTT(5e9, 20e9, 130e6, 0.4).
+		ExpectNoReset().
+		Run(t)
+}
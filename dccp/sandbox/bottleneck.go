@@ -0,0 +1,75 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"sync"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// Bottleneck is a link of limited capacity that is shared by the half pipes attached to it with
+// SetWriteBottleneck. The packets written from all of them are serialized onto the link one after
+// another, so that they compete for its capacity and its buffer, like flows that share a router
+// queue. Latency, loss and the other link characteristics remain those of the individual pipes.
+type Bottleneck struct {
+	sync.Mutex
+	bandwidth int64 // Capacity of the link in bytes per second
+	buffer    int64 // Bytes that can be queued up waiting for link capacity; zero means no limit
+	free      int64 // Time when the link finishes transmitting all packets queued so far
+	queue     Queue // Queue discipline of the buffer, or nil for tail-drop only
+}
+
+// NewBottleneck creates a link of bandwidth bytes per second, with a buffer of buffer bytes. A
+// buffer of zero makes the buffer unbounded.
+func NewBottleneck(bandwidth, buffer int64) *Bottleneck {
+	return &Bottleneck{ bandwidth: bandwidth, buffer: buffer }
+}
+
+// SetQueue makes the queue discipline q manage the buffer of the link, in addition to the
+// tail-drop of a full buffer. A nil q leaves tail-drop alone.
+func (b *Bottleneck) SetQueue(q Queue) {
+	b.Lock()
+	defer b.Unlock()
+	b.queue = q
+}
+
+// depart serializes h onto the link at time now, and returns the time when its last bit leaves
+// the link, or the reason why it is dropped
+func (b *Bottleneck) depart(now int64, h *dccp.Header) (int64, string) {
+	b.Lock()
+	defer b.Unlock()
+	drop := linkEnqueue(b.queue, now, &b.free, b.bandwidth, b.buffer, h)
+	return b.free, drop
+}
+
+// linkDepart returns the time when the last bit of a packet of size bytes, written at time now,
+// leaves a link of bandwidth bytes per second and buffer bytes of buffer, which is busy until
+// free. It returns free and false if the packet does not fit in the buffer.
+func linkDepart(now, free, bandwidth, buffer int64, size int) (int64, bool) {
+	start := max64(now, free)
+	if buffer > 0 && ((start-now)*bandwidth)/1e9 > buffer {
+		return free, false
+	}
+	return start + (int64(size)*1e9)/bandwidth, true
+}
+
+// linkEnqueue serializes h onto a link of bandwidth bytes per second and buffer bytes of
+// buffer, which is busy until *free and whose queue discipline is q. It moves *free on to the
+// time when the last bit of h leaves the link, and marks h Congestion Experienced if q says
+// so. It returns the reason why h is dropped, or the empty string.
+func linkEnqueue(q Queue, now int64, free *int64, bandwidth, buffer int64, h *dccp.Header) string {
+	depart, ok := linkDepart(now, *free, bandwidth, buffer, wireSize(h))
+	if !ok {
+		return "Link buffer overflow"
+	}
+	switch linkAdmit(q, now, *free, bandwidth, isECT(h.ECN)) {
+	case QueueDrop:
+		return "Queue drop"
+	case QueueMark:
+		h.ECN = dccp.ECNCE
+	}
+	*free = depart
+	return ""
+}
@@ -0,0 +1,203 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// Chaos injects randomly chosen faults into the half pipes of sandbox Pipes, one fault at a
+// time, separated by quiet periods. The faults are:
+//
+//   loss burst      A half pipe drops most packets for a short while
+//   delay spike     The latency of a half pipe jumps up, which also reorders packets
+//   duplication     A half pipe delivers many packets twice
+//   stall           All half pipes drop all packets for a longer while
+//
+// The schedule of faults is drawn from a generator of its own, seeded with the seed of the
+// Env, so that it does not depend on the order in which the goroutines of the Env draw from
+// the Env's generator. A chaos run is thus repeated by setting DCCPSEED to the seed that
+// NewEnv logs.
+type Chaos struct {
+	env   *dccp.Env
+	amb   *dccp.Amb
+	rand  *rand.Rand
+	pipes []*headerHalfPipe
+}
+
+// Parameters of the faults that Chaos injects. Durations are in nanoseconds.
+const (
+	chaosQuietMin = 2e9   // Range of the quiet period that precedes each fault
+	chaosQuietMax = 20e9
+
+	chaosBurstMin  = 50e6 // Range of the length of loss bursts
+	chaosBurstMax  = 500e6
+	chaosBurstLoss = 0.9  // Loss probability during a loss burst
+
+	chaosSpikeMin   = 500e6 // Range of the length of delay spikes
+	chaosSpikeMax   = 2e9
+	chaosSpikeDelay = 1e9   // Maximum latency added by a delay spike
+
+	chaosDupMin  = 1e9 // Range of the length of duplication periods
+	chaosDupMax  = 5e9
+	chaosDupProb = 0.5 // Duplication probability during a duplication period
+
+	chaosStallMin = 1e9 // Range of the length of stalls
+	chaosStallMax = 10e9
+)
+
+// NewChaos creates a Chaos driver for the given half pipes, which logs the faults it
+// injects to amb
+func NewChaos(env *dccp.Env, amb *dccp.Amb, pipes ...*headerHalfPipe) *Chaos {
+	return &Chaos{
+		env:   env,
+		amb:   amb,
+		rand:  rand.New(rand.NewSource(env.Seed())),
+		pipes: pipes,
+	}
+}
+
+// Run injects faults for duration nanoseconds and returns. Each fault is undone before the
+// next one is injected, and before Run returns.
+func (x *Chaos) Run(duration int64) {
+	end := x.env.Now() + duration
+	for {
+		x.sleep(x.between(chaosQuietMin, chaosQuietMax), end)
+		if x.env.Now() >= end {
+			return
+		}
+		p := x.pipes[x.rand.Intn(len(x.pipes))]
+		latency, loss, dup := p.writeFaults()
+		switch x.rand.Intn(4) {
+		case 0:
+			length := x.between(chaosBurstMin, chaosBurstMax)
+			x.amb.E(dccp.EventInfo, fmt.Sprintf("Loss burst on %s for %dms", p.name(), length/1e6))
+			p.SetWriteLoss(chaosBurstLoss)
+			x.sleep(length, end)
+			p.SetWriteLoss(loss)
+		case 1:
+			length, delay := x.between(chaosSpikeMin, chaosSpikeMax), x.between(0, chaosSpikeDelay)
+			x.amb.E(dccp.EventInfo, fmt.Sprintf("Delay spike of %dms on %s for %dms", delay/1e6, p.name(), length/1e6))
+			p.SetWriteLatency(latency + delay)
+			x.sleep(length, end)
+			p.SetWriteLatency(latency)
+		case 2:
+			length := x.between(chaosDupMin, chaosDupMax)
+			x.amb.E(dccp.EventInfo, fmt.Sprintf("Duplication on %s for %dms", p.name(), length/1e6))
+			p.SetWriteDuplication(chaosDupProb)
+			x.sleep(length, end)
+			p.SetWriteDuplication(dup)
+		case 3:
+			length := x.between(chaosStallMin, chaosStallMax)
+			x.amb.E(dccp.EventInfo, fmt.Sprintf("Stall for %dms", length/1e6))
+			losses := make([]float64, len(x.pipes))
+			for i, q := range x.pipes {
+				_, losses[i], _ = q.writeFaults()
+				q.SetWriteLoss(1)
+			}
+			x.sleep(length, end)
+			for i, q := range x.pipes {
+				q.SetWriteLoss(losses[i])
+			}
+		}
+	}
+}
+
+// between returns a duration in [min,max), drawn from the generator of the schedule
+func (x *Chaos) between(min, max int64) int64 {
+	return min + x.rand.Int63n(max-min)
+}
+
+// sleep sleeps for ns nanoseconds, but not past the time end
+func (x *Chaos) sleep(ns, end int64) {
+	if left := end - x.env.Now(); ns > left {
+		ns = left
+	}
+	if ns > 0 {
+		x.env.Sleep(ns)
+	}
+}
+
+// name returns the name that the half pipe was given by NewPipe
+func (x *headerHalfPipe) name() string {
+	labels := x.amb.Labels()
+	return labels[len(labels)-1]
+}
+
+// legalStates maps each state of a Conn to the states that the Conn may move to from it,
+// following the state diagram of RFC 4340, Section 8.4. In addition, a client whose Request
+// crosses the Request of its peer moves from REQUEST to RESPOND, and any state may be left for
+// TIMEWAIT by a Reset or for CLOSED by an abort.
+var legalStates = map[string][]string{
+	"":         {"LISTEN", "REQUEST"},
+	"LISTEN":   {"RESPOND"},
+	"REQUEST":  {"PARTOPEN", "RESPOND"},
+	"RESPOND":  {"OPEN"},
+	"PARTOPEN": {"OPEN", "CLOSING"},
+	"OPEN":     {"CLOSEREQ", "CLOSING"},
+	"CLOSEREQ": {"CLOSING"},
+	"CLOSING":  {},
+	"TIMEWAIT": {},
+}
+
+// legalState returns true if a Conn may move from state from to state to
+func legalState(from, to string) bool {
+	next, ok := legalStates[from]
+	if !ok {
+		return false
+	}
+	if from != "" && (to == "TIMEWAIT" || to == "CLOSED") {
+		return true
+	}
+	for _, s := range next {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// stateChecker is a dccp.TraceWriter that checks that the state changes of all Conns in its
+// Env are legal, see legalStates
+type stateChecker struct {
+	sync.Mutex
+	illegal []string
+	changes int
+}
+
+func (x *stateChecker) Write(r *dccp.Trace) {
+	a := r.ArgOfType(dccp.StateChange{})
+	if a == nil {
+		return
+	}
+	sc := a.(dccp.StateChange)
+	x.Lock()
+	defer x.Unlock()
+	x.changes++
+	if !legalState(sc.From, sc.To) {
+		x.illegal = append(x.illegal, fmt.Sprintf("%s moved from %q to %s at %dms", r.LabelString(), sc.From, sc.To, r.Time/1e6))
+	}
+}
+
+func (x *stateChecker) Sync() error { return nil }
+
+func (x *stateChecker) Close() error { return nil }
+
+// Illegal returns descriptions of the illegal state changes seen so far
+func (x *stateChecker) Illegal() []string {
+	x.Lock()
+	defer x.Unlock()
+	return append([]string{}, x.illegal...)
+}
+
+// Changes returns the number of state changes seen so far
+func (x *stateChecker) Changes() int {
+	x.Lock()
+	defer x.Unlock()
+	return x.changes
+}
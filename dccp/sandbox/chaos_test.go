@@ -0,0 +1,65 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"os"
+	"strconv"
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// chaosDuration is the default length of the chaos run of TestChaos, in simulated time
+const chaosDuration = 120e9
+
+// TestChaos sends data from a client to a server for a long simulated run, while a Chaos
+// driver injects faults into the pipe between them. Once the faults end, the client closes
+// the connection. The test checks that all state changes of both Conns are legal, and that no
+// goroutines are left running. Panics fail the test by crashing it.
+//
+// If the environment variable DCCPCHAOS is set, it gives the length of the chaos run in
+// seconds of simulated time. Set DCCPSEED to the seed logged by a failing run to repeat it.
+func TestChaos(t *testing.T) {
+	duration := int64(chaosDuration)
+	if sec, err := strconv.ParseInt(os.Getenv("DCCPCHAOS"), 10, 64); err == nil {
+		duration = sec * 1e9
+	}
+	states := &stateChecker{}
+	env, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "chaos", states)
+	clientConn, serverConn, clientToServer, serverToClient := NewClientServerPipe(env)
+
+	payload := []byte{1, 2, 3}
+	env.Go(func() {
+		for clientConn.Write(payload) == nil {
+		}
+	}, "test client")
+	env.Go(func() {
+		for {
+			if _, err := serverConn.Read(); err != nil {
+				break
+			}
+		}
+	}, "test server")
+
+	NewChaos(env, dccp.NewAmb("chaos", env), clientToServer, serverToClient).Run(duration)
+
+	// Give the close handshake time to complete before cutting TIMEWAIT short
+	clientConn.Close()
+	env.Sleep(5e9)
+	clientConn.Abort()
+	serverConn.Abort()
+	env.NewGoJoin("end-of-test", clientConn.Joiner(), serverConn.Joiner()).Join()
+
+	if states.Changes() == 0 {
+		t.Errorf("no state changes logged")
+	}
+	for _, s := range states.Illegal() {
+		t.Errorf("illegal state change: %s", s)
+	}
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Server and client done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+}
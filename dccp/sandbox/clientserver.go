@@ -5,33 +5,165 @@
 package sandbox
 
 import (
+	"fmt"
+	"io"
 	"os"
 	"path"
+	"strconv"
+	"sync/atomic"
 	"github.com/petar/GoDCCP/dccp"
 	"github.com/petar/GoDCCP/dccp/ccid3"
 )
 
+// leakGrace is the time that goroutines of a sandbox Env are given to exit after the test is over
+const leakGrace = 5e9
+
+// lockMaxHold is the lock hold time above which lock debugging reports a long hold
+const lockMaxHold = 10e6
+
 // NewEnv creates a dccp.Env for test purposes, whose dccp.TraceWriter writes to a file
 // and duplicates all emits to any number of additional guzzles, which are usually used to check
 // test conditions. The TraceWriterPlex is returned to facilitate adding further guzzles.
+//
+// If the environment variable DCCPSEED is set, it is used to seed the random number generator
+// of the Env, otherwise the seed chosen by the Env is. Either way, the Env draws its ISNs from
+// the seeded generator as well, and the seed in use is recorded in the log, so that a failing
+// run can be reproduced exactly by setting DCCPSEED to the logged value.
+//
+// If the environment variable DCCPLOGBIN is set, the log file is written in the compact binary
+// trace format, with extension ".bin" instead of ".emit".
+//
+// If the environment variable DCCPLOCKDEBUG is set, lock debugging is enabled and its reports
+// are logged under the label "lock".
+//
+// If the environment variable DCCPRFC is set to "report", an RFC conformance report is written
+// next to the log file, with extension ".rfc", when the Env is closed. If it is set to "strict",
+// strict RFC mode is enabled in addition.
+//
+// Leak detection is enabled on the returned Env, so that closing it returns an error listing
+// any goroutines that have not exited within leakGrace.
 func NewEnv(guzzleFilename string, guzzles ...dccp.TraceWriter) (env *dccp.Env, plex *TraceWriterPlex) {
-	fileTraceWriter := dccp.NewFileTraceWriter(path.Join(os.Getenv("DCCPLOG"), guzzleFilename + ".emit"))
-	plex = NewTraceWriterPlex(append(guzzles, fileTraceWriter)...)
-	return dccp.NewEnv(plex), plex
+	return NewEnvTime(dccp.RealTime, guzzleFilename, guzzles...)
+}
+
+// NewEnvTime is like NewEnv, except that the returned Env runs in the time framework t. Tests
+// that are dominated by protocol timeouts can pass a dccp.DilatedTime to complete faster.
+func NewEnvTime(t dccp.Time, guzzleFilename string, guzzles ...dccp.TraceWriter) (env *dccp.Env, plex *TraceWriterPlex) {
+	var report *conformanceReport
+	switch os.Getenv("DCCPRFC") {
+	case "report", "strict":
+		report = &conformanceReport{filename: path.Join(os.Getenv("DCCPLOG"), guzzleFilename + ".rfc")}
+		guzzles = append(guzzles, report)
+	}
+	plex = NewTraceWriterPlex(append(guzzles, newLogTraceWriter(guzzleFilename))...)
+	env = dccp.NewEnvTime(t, plex)
+	if report != nil {
+		report.env = env
+		env.SetStrictRFC(os.Getenv("DCCPRFC") == "strict")
+	}
+	env.SetLeakGrace(leakGrace)
+	// The Env is always seeded explicitly, so that its ISNs, too, are drawn from the generator
+	// whose seed is logged
+	seed := env.Seed()
+	if s, err := strconv.ParseInt(os.Getenv("DCCPSEED"), 10, 64); err == nil {
+		seed = s
+	}
+	env.SetSeed(seed)
+	dccp.NewAmb("line", env).E(dccp.EventInfo, fmt.Sprintf("Seed=%d", env.Seed()))
+	if os.Getenv("DCCPLOCKDEBUG") != "" {
+		dccp.EnableLockDebug(dccp.NewAmb("lock", env), lockMaxHold)
+	}
+	return env, plex
+}
+
+// newLogTraceWriter creates the TraceWriter that saves the log of a sandbox run to a file. If
+// the environment variable DCCPLOGMAX is set to a size in bytes, the log is rotated at that
+// size and the last few files are kept compressed, which suits long soak runs.
+func newLogTraceWriter(name string) dccp.TraceWriter {
+	if max, err := strconv.ParseInt(os.Getenv("DCCPLOGMAX"), 10, 64); err == nil && max > 0 {
+		return newRotatingLogTraceWriter(name, max)
+	}
+	if os.Getenv("DCCPLOGBIN") == "" {
+		return dccp.NewFileTraceWriter(path.Join(os.Getenv("DCCPLOG"), name + ".emit"))
+	}
+	filename := path.Join(os.Getenv("DCCPLOG"), name + ".bin")
+	os.Remove(filename)
+	f, err := os.Create(filename)
+	if err != nil {
+		panic(fmt.Sprintf("cannot create log file '%s'", filename))
+	}
+	return dccp.NewBinaryTraceWriter(f)
+}
+
+// LOG_ROTATE_KEEP is the number of old log files kept by a rotated sandbox log
+const LOG_ROTATE_KEEP = 4
+
+func newRotatingLogTraceWriter(name string, max int64) dccp.TraceWriter {
+	filename := path.Join(os.Getenv("DCCPLOG"), name + ".emit")
+	var newEnc func(io.Writer) dccp.TraceWriter
+	if os.Getenv("DCCPLOGBIN") != "" {
+		filename = path.Join(os.Getenv("DCCPLOG"), name + ".bin")
+		newEnc = func(w io.Writer) dccp.TraceWriter { return dccp.NewBinaryTraceWriter(w) }
+	}
+	policy := dccp.RotatePolicy{ MaxSize: max, Keep: LOG_ROTATE_KEEP, Compress: true }
+	w, err := dccp.NewRotatingTraceWriter(filename, policy, newEnc)
+	if err != nil {
+		panic(fmt.Sprintf("cannot create log file '%s'", filename))
+	}
+	return w
+}
+
+// pairSeq numbers the connection pairs created in the sandbox
+var pairSeq int64
+
+// newPairAmbs creates the Ambs of the line, the client and the server of a new connection
+// pair, stamped with a correlation ID of their own. The traces of both endpoints can then be
+// merged and matched packet for packet, see gauge.MatchPackets.
+func newPairAmbs(env *dccp.Env, client, server string) (line, clog, slog *dccp.Amb) {
+	corr := fmt.Sprintf("pair-%d", atomic.AddInt64(&pairSeq, 1))
+	line, clog, slog = dccp.NewAmb("line", env), dccp.NewAmb(client, env), dccp.NewAmb(server, env)
+	for _, amb := range []*dccp.Amb{line, clog, slog} {
+		amb.SetCorrelation(corr)
+	}
+	return line, clog, slog
 }
 
 // NewClientServerPipe creates a sandbox communication pipe and attaches a DCCP client and a DCCP
 // server to its endpoints. In addition to sending all emits to a standard DCCP log file, it sends a
 // copy of all emits to the dup TraceWriter.
 func NewClientServerPipe(env *dccp.Env) (clientConn, serverConn *dccp.Conn, clientToServer, serverToClient *headerHalfPipe) {
-	llog := dccp.NewAmb("line", env)
+	return NewCCIDClientServerPipe(env, ccid3.CCID3{})
+}
+
+// NewFixedClientServerPipe is like NewClientServerPipe, except that both endpoints use the
+// fixed-rate congestion control, sending a packet every millisecond. It suits tests of the
+// protocol machinery, which should not wait on the slow start of CCID 3.
+func NewFixedClientServerPipe(env *dccp.Env) (clientConn, serverConn *dccp.Conn, clientToServer, serverToClient *headerHalfPipe) {
+	return NewCCIDClientServerPipe(env, dccp.CCFixed{Every: 1e6})
+}
+
+// NewCCIDClientServerPipe is like NewClientServerPipe, except that both endpoints use the
+// congestion control ccid.
+func NewCCIDClientServerPipe(env *dccp.Env, ccid dccp.CCID) (clientConn, serverConn *dccp.Conn, clientToServer, serverToClient *headerHalfPipe) {
+	llog, clog, slog := newPairAmbs(env, "client", "server")
 	hca, hcb, _ := NewPipe(env, llog, "client", "server")
-	ccid := ccid3.CCID3{}
 
-	clog := dccp.NewAmb("client", env)
 	clientConn = dccp.NewConnClient(env, clog, hca, ccid.NewSender(env, clog), ccid.NewReceiver(env, clog), 0)
 
-	slog := dccp.NewAmb("server", env)
+	serverConn = dccp.NewConnServer(env, slog, hcb, ccid.NewSender(env, slog), ccid.NewReceiver(env, slog))
+
+	return clientConn, serverConn, hca, hcb
+}
+
+// NewFlowPipe is like NewClientServerPipe, except that both endpoints use the congestion control
+// ccid, and that their labels, "client-" and "server-" followed by name, tell them apart from the
+// endpoints of other flows that share the Env.
+func NewFlowPipe(env *dccp.Env, name string, ccid dccp.CCID) (clientConn, serverConn *dccp.Conn, clientToServer, serverToClient *headerHalfPipe) {
+	llog, clog, slog := newPairAmbs(env, "client-" + name, "server-" + name)
+	hca, hcb, _ := NewPipe(env, llog, "client-" + name, "server-" + name)
+
+	clientConn = dccp.NewConnClient(env, clog, hca, ccid.NewSender(env, clog), ccid.NewReceiver(env, clog), 0)
+
 	serverConn = dccp.NewConnServer(env, slog, hcb, ccid.NewSender(env, slog), ccid.NewReceiver(env, slog))
 
 	return clientConn, serverConn, hca, hcb
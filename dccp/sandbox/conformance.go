@@ -0,0 +1,33 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"os"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// conformanceReport is a dccp.TraceWriter that ignores all records, and writes the RFC
+// conformance report of its Env to a file when it is closed, at the end of a sandbox run
+type conformanceReport struct {
+	env      *dccp.Env
+	filename string
+}
+
+func (x *conformanceReport) Write(r *dccp.Trace) {}
+
+func (x *conformanceReport) Sync() error { return nil }
+
+func (x *conformanceReport) Close() error {
+	f, err := os.Create(x.filename)
+	if err != nil {
+		return err
+	}
+	if err = x.env.WriteConformanceReport(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
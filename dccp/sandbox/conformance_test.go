@@ -0,0 +1,47 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// TestStrictRFC exchanges data over a connection in strict RFC mode, with the server speaking
+// first, so that the client cannot leave PARTOPEN on a SyncAck. It checks that none of the
+// deviations that strict mode restores occur.
+func TestStrictRFC(t *testing.T) {
+	env, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "strictrfc")
+	env.SetStrictRFC(true)
+	clientConn, serverConn, _, _ := NewClientServerPipe(env)
+	payload := []byte{1, 2, 3}
+
+	if err := serverConn.Write(payload); err != nil {
+		t.Fatalf("server write (%s)", err)
+	}
+	if p, err := clientConn.Read(); err != nil || len(p) != len(payload) {
+		t.Fatalf("client read %v (%v)", p, err)
+	}
+	if err := clientConn.Write(payload); err != nil {
+		t.Fatalf("client write (%s)", err)
+	}
+	if p, err := serverConn.Read(); err != nil || len(p) != len(payload) {
+		t.Errorf("server read %v (%v)", p, err)
+	}
+
+	for _, d := range dccp.Deviations() {
+		if n := env.DeviationCount(d); d.Strict && n > 0 {
+			t.Errorf("%s occurred %d times in strict mode", d, n)
+		}
+	}
+
+	clientConn.Abort()
+	serverConn.Abort()
+	env.NewGoJoin("end-of-test", clientConn.Joiner(), serverConn.Joiner()).Join()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Server and client done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// contentionSendRate is the fixed send rate of BenchmarkConnContention, in packets per second.
+// It is high enough that the locks rather than the congestion control limit the packet rate.
+const contentionSendRate = 1e5
+
+// contentionWarmup is the number of packets received before timing starts
+const contentionWarmup = 100
+
+// BenchmarkConnContention sends packets from client to server at a high fixed rate, while the read, write and idle loops of both connections compete for the Conn locks.
+// Connection establishment, warm-up and teardown are not timed. Run it with -mutexprofile to inspect the
+// remaining lock contention.
+func BenchmarkConnContention(b *testing.B) {
+	env, _ := NewEnv("contention")
+	// Per-packet tracing would otherwise dominate the measurement
+	env.SetTraceFilter("", dccp.LevelWarn)
+	clientConn, serverConn, clientToServer, serverToClient := NewClientServerPipe(env)
+	clientToServer.SetWriteRate(1e9, contentionSendRate)
+	serverToClient.SetWriteRate(1e9, contentionSendRate)
+	clientConn.Amb().Flags().SetUint32("FixRate", contentionSendRate)
+	serverConn.Amb().Flags().SetUint32("FixRate", contentionSendRate)
+	buf := make([]byte, clientConn.GetMTU())
+
+	// Packets received before contentionWarmup, while the handshake completes and the
+	// fixed rate takes effect, are not timed. The client writes until the server has
+	// received enough packets, so that drops do not stall the benchmark.
+	started := make(chan int)
+	received := make(chan int)
+	written := make(chan int)
+	env.Go(func() {
+		for i := 0; ; i++ {
+			if _, err := serverConn.Read(); err != nil {
+				break
+			}
+			switch i {
+			case contentionWarmup:
+				close(started)
+			case contentionWarmup + b.N:
+				close(received)
+			}
+		}
+		serverConn.Close()
+	}, "bench server")
+
+	env.Go(func() {
+		for {
+			select {
+			case <-received:
+				close(written)
+				return
+			default:
+			}
+			if err := clientConn.Write(buf); err != nil {
+				b.Errorf("error writing (%s)", err)
+				break
+			}
+		}
+		close(written)
+	}, "bench client")
+
+	<-started
+	b.SetBytes(int64(len(buf)))
+	b.ResetTimer()
+	select {
+	case <-received:
+	case <-written:
+	}
+	b.StopTimer()
+
+	<-written
+	clientConn.Close()
+	clientConn.Abort()
+	serverConn.Abort()
+	env.NewGoJoin("end-of-bench", clientConn.Joiner(), serverConn.Joiner()).Join()
+	env.Close()
+}
@@ -0,0 +1,77 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+	"github.com/petar/GoDCCP/dccp/gauge"
+)
+
+// TestCorrelation checks that the endpoints of each connection pair share a correlation ID of
+// their own, by which the packets written by one endpoint are matched to those read by the other
+func TestCorrelation(t *testing.T) {
+	ring := dccp.NewRingTraceWriter(1 << 16)
+	env, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "correlation", ring)
+	fixed := dccp.CCFixed{Every: 1e6}
+	var conns []*dccp.Conn
+	for _, name := range []string{"a", "b"} {
+		clientConn, serverConn, _, _ := NewFlowPipe(env, name, fixed)
+		for i := 0; i < 10; i++ {
+			if err := clientConn.Write(make([]byte, 10)); err != nil {
+				t.Fatalf("client write (%s)", err)
+			}
+			if _, err := serverConn.Read(); err != nil {
+				t.Fatalf("server read (%s)", err)
+			}
+		}
+		conns = append(conns, clientConn, serverConn)
+	}
+	if ring.Total() > 1 << 16 {
+		t.Fatalf("trace buffer overflow")
+	}
+
+	corr := make(map[string]string)
+	for _, r := range ring.Traces() {
+		if len(r.Labels) == 0 || r.Labels[0] == "line" || r.Corr == "" {
+			continue
+		}
+		flow := r.Labels[0][len(r.Labels[0])-1:]
+		if c, ok := corr[flow]; ok && c != r.Corr {
+			t.Fatalf("flow %s carries correlation IDs %s and %s", flow, c, r.Corr)
+		}
+		corr[flow] = r.Corr
+	}
+	if len(corr) != 2 || corr["a"] == corr["b"] {
+		t.Fatalf("correlation IDs %v", corr)
+	}
+
+	data := make(map[string]int)
+	for _, m := range gauge.MatchPackets(ring.Traces()) {
+		if m.Read == nil || (m.Write.Type != "Data" && m.Write.Type != "DataAck") {
+			continue
+		}
+		if m.Read.Corr != m.Write.Corr || m.Read.SeqNo != m.Write.SeqNo || m.Latency() < 0 {
+			t.Errorf("mismatched packets %v and %v", m.Write, m.Read)
+		}
+		if m.Write.Labels[0][:6] == "client" {
+			data[m.Corr]++
+		}
+	}
+	for flow, c := range corr {
+		if data[c] != 10 {
+			t.Errorf("flow %s: %d data packets matched, expected 10", flow, data[c])
+		}
+	}
+
+	for _, c := range conns {
+		c.Abort()
+	}
+	env.NewGoJoin("end-of-test", conns[0].Joiner(), conns[1].Joiner(), conns[2].Joiner(), conns[3].Joiner()).Join()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Server and client done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+}
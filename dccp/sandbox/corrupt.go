@@ -0,0 +1,42 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// Regions of a packet where corruption may be injected
+const (
+	CorruptHeader  = 1 << iota // Bit flips may land in the DCCP header, including options
+	CorruptPayload             // Bit flips may land in the application data
+)
+
+// corruptHeader encodes h to its wire format, flips one randomly chosen bit within the
+// regions specified by where, and decodes the result. Since DCCP headers are passed through the
+// pipe in parsed form, this round trip is what subjects a corrupted packet to the checksum
+// verification and option parsing logic of the receiver. If the corrupted packet does not
+// parse, corruptHeader returns the parsing error.
+func corruptHeader(env *dccp.Env, h *dccp.Header, where int) (*dccp.Header, error) {
+	buf, err := h.Write(dccp.LabelZero.Bytes(), dccp.LabelZero.Bytes(), dccp.AnyProto, false)
+	if err != nil {
+		return nil, err
+	}
+	dataLen := len(h.Data)
+	var lo, hi int // Byte range eligible for corruption
+	switch {
+	case where&CorruptHeader != 0 && where&CorruptPayload != 0:
+		lo, hi = 0, len(buf)
+	case where&CorruptHeader != 0:
+		lo, hi = 0, len(buf)-dataLen
+	case where&CorruptPayload != 0:
+		lo, hi = len(buf)-dataLen, len(buf)
+	}
+	if hi > lo {
+		bit := env.Int63n(int64(8 * (hi - lo)))
+		buf[lo+int(bit/8)] ^= 1 << uint(bit%8)
+	}
+	return dccp.ReadHeader(buf, dccp.LabelZero.Bytes(), dccp.LabelZero.Bytes(), dccp.AnyProto, false)
+}
@@ -0,0 +1,104 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"bytes"
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// TestCorrupt checks that bit flips in the checksum-covered part of a packet are caught by
+// checksum verification, while flips outside the checksum coverage go through undetected.
+func TestCorrupt(t *testing.T) {
+	env := dccp.NewEnv(nil)
+	env.SetSeed(1)
+	payload := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	h := &dccp.Header{}
+	h.InitDataHeader(payload)
+	h.SeqNo = 7
+	for i := 0; i < 100; i++ {
+		if _, err := corruptHeader(env, h, CorruptHeader|CorruptPayload); err == nil {
+			t.Fatalf("corrupt packet with full checksum coverage passed")
+		}
+	}
+	h.CsCov = dccp.CsCovNoData
+	for i := 0; i < 100; i++ {
+		g, err := corruptHeader(env, h, CorruptPayload)
+		if err != nil {
+			t.Fatalf("payload corruption outside checksum coverage detected (%s)", err)
+		}
+		if g.SeqNo != h.SeqNo || bytes.Equal(g.Data, payload) {
+			t.Fatalf("expecting corruption confined to payload")
+		}
+	}
+}
+
+// TestDataChecksum checks that a receiver that negotiates the Check Data Checksum feature
+// detects payload corruption outside the checksum coverage, drops the corrupt data or
+// delivers it as corrupt, and reports it to the sender with the matching drop code
+func TestDataChecksum(t *testing.T) {
+	env, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "datachecksum")
+	// The CCID 3 receiver sends the Acks that carry the reports of the server
+	clientConn, serverConn, clientToServer, _ := NewClientServerPipe(env)
+	payload := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+	if err := clientConn.Write([]byte{1}); err != nil {
+		t.Fatalf("client write (%s)", err)
+	}
+	if _, err := serverConn.Read(); err != nil {
+		t.Fatalf("server read (%s)", err)
+	}
+	if err := serverConn.ChangeFeature(dccp.FeatureLocal, dccp.FeatureCheckDataChecksum, 1); err != nil {
+		t.Fatalf("change Check Data Checksum (%s)", err)
+	}
+	env.Sleep(5e9)
+	if v, _ := clientConn.Feature(dccp.FeatureRemote, dccp.FeatureCheckDataChecksum); v != 1 {
+		t.Fatalf("client Check Data Checksum of server %d, expected 1", v)
+	}
+
+	// Intact data checks out
+	if err := clientConn.WriteMsg(payload, dccp.WriteMeta{CsCov: dccp.CsCovNoData}); err != nil {
+		t.Fatalf("client write (%s)", err)
+	}
+	if p, meta, err := serverConn.ReadMsg(); err != nil || !bytes.Equal(p, payload) || meta.Corrupt {
+		t.Fatalf("server read %v %+v (%v)", p, meta, err)
+	}
+
+	// Corrupt data is dropped, and then delivered once the server asks for it
+	clientToServer.SetWriteCorruption(1, CorruptPayload)
+	for _, deliver := range []bool{false, true} {
+		serverConn.SetDeliverCorrupt(deliver)
+		if err := clientConn.WriteMsg(payload, dccp.WriteMeta{CsCov: dccp.CsCovNoData}); err != nil {
+			t.Fatalf("client write (%s)", err)
+		}
+		if deliver {
+			if p, meta, err := serverConn.ReadMsg(); err != nil || bytes.Equal(p, payload) || !meta.Corrupt {
+				t.Errorf("server read %v %+v (%v), expected corrupt data", p, meta, err)
+			}
+		}
+		env.Sleep(5e9)
+		state := byte(dccp.DropStateCorrupt)
+		if deliver {
+			state = dccp.DropStateDeliveredCorrupt
+		}
+		select {
+		case r := <-clientConn.Drops():
+			if r.Reason != dccp.DropRemote || r.State != state || !bytes.Equal(r.Data, payload) {
+				t.Errorf("drop report %+v, expected remote drop with state %d", r, state)
+			}
+		default:
+			t.Errorf("corrupt data not reported, deliver=%v", deliver)
+		}
+	}
+
+	clientConn.Abort()
+	serverConn.Abort()
+	env.NewGoJoin("end-of-test", clientConn.Joiner(), serverConn.Joiner()).Join()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Server and client done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+}
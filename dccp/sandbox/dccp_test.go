@@ -9,11 +9,14 @@ import (
 	"github.com/petar/GoDCCP/dccp"
 )
 
+// idleDilation is the factor by which time is accelerated in tests that mostly wait
+const idleDilation = 20
+
 // TestNop checks that no panics occur in the first 5 seconds of connection establishment
 func TestNop(t *testing.T) {
 	// dccp.InstallCtrlCPanic()
 	// dccp.InstallTimeout(10e9)
-	env, _ := NewEnv("nop")
+	env, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "nop")
 	NewClientServerPipe(env)
 	env.Sleep(5e9)
 }
@@ -28,7 +31,7 @@ func TestOpenClose(t *testing.T) {
 		env.Sleep(2e9)
 		_, err := clientConn.Read()
 		if err != dccp.ErrEOF {
-			t.Errorf("client read error (%s), expected EBADF", err)
+			t.Errorf("client read error (%s), expected EBADF\n%s", err, clientConn.Dump())
 		}
 		cchan <- 1
 		close(cchan)
@@ -38,7 +41,7 @@ func TestOpenClose(t *testing.T) {
 	env.Go(func() {
 		env.Sleep(1e9)
 		if err := serverConn.Close(); err != nil {
-			t.Errorf("server close error (%s)", err)
+			t.Errorf("server close error (%s)\n%s", err, serverConn.Dump())
 		}
 		schan <- 1
 		close(schan)
@@ -64,7 +67,7 @@ func TestOpenClose(t *testing.T) {
 // no unusual behavior occurs.
 func TestIdle(t *testing.T) {
 
-	env, _ := NewEnv("idle")
+	env, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "idle")
 	clientConn, serverConn, _, _ := NewClientServerPipe(env)
 	payload := []byte{1, 2, 3}
 
@@ -75,7 +78,7 @@ func TestIdle(t *testing.T) {
 		}
 		env.Sleep(10e9) // Stay idle for 10 sec
 		if err := clientConn.Close(); err != nil && err != dccp.ErrEOF {
-			t.Errorf("client close (%s)", err)
+			t.Errorf("client close (%s)\n%s", err, clientConn.Dump())
 		}
 		cchan <- 1
 		close(cchan)
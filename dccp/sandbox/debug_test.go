@@ -0,0 +1,73 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// TestDebugHandler checks that the debug handler lists an open connection pair, and that it
+// serves the page of each connection
+func TestDebugHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/dccp/", dccp.DebugHandler)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	env, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "debug")
+	clientConn, serverConn, _, _ := NewFlowPipe(env, "debug", dccp.CCFixed{Every: 1e6})
+	for i := 0; i < 5; i++ {
+		if err := clientConn.Write(make([]byte, 10)); err != nil {
+			t.Fatalf("client write (%s)", err)
+		}
+		if _, err := serverConn.Read(); err != nil {
+			t.Fatalf("server read (%s)", err)
+		}
+	}
+
+	index := debugGet(t, srv.URL + "/debug/dccp/")
+	rows := regexp.MustCompile(`<a href="(\d+)">\d+</a></td><td>(client|server)-debug</td>`).FindAllStringSubmatch(index, -1)
+	if len(rows) != 2 {
+		t.Fatalf("expecting two connections in the index, found %d:\n%s", len(rows), index)
+	}
+	for _, row := range rows {
+		page := debugGet(t, srv.URL + "/debug/dccp/" + row[1])
+		if !strings.Contains(page, row[2] + "-debug") || !strings.Contains(page, "OPEN") {
+			t.Errorf("connection page of %s-debug:\n%s", row[2], page)
+		}
+	}
+
+	clientConn.Abort()
+	serverConn.Abort()
+	env.NewGoJoin("end-of-test", clientConn.Joiner(), serverConn.Joiner()).Join()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Server and client done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+
+	// Closed connections leave the index
+	if index = debugGet(t, srv.URL + "/debug/dccp/"); strings.Contains(index, "-debug<") {
+		t.Errorf("closed connections in the index:\n%s", index)
+	}
+}
+
+func debugGet(t *testing.T, url string) string {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("get %s (%s)", url, err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("get %s: status %d (%v)", url, resp.StatusCode, err)
+	}
+	return string(body)
+}
@@ -0,0 +1,97 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"encoding/binary"
+	"sort"
+	"sync"
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// STAMP_LEN is the size of the send time that Stamp writes at the start of a payload
+const STAMP_LEN = 8
+
+// Stamp writes the current time of env at the start of payload, which must be at least
+// STAMP_LEN bytes long, so that the receiver can tell how long the payload took to arrive
+func Stamp(env *dccp.Env, payload []byte) {
+	binary.BigEndian.PutUint64(payload[:STAMP_LEN], uint64(env.Now()))
+}
+
+// Stamped returns the send time that Stamp wrote to payload, or false if payload is too
+// short to carry one
+func Stamped(payload []byte) (int64, bool) {
+	if len(payload) < STAMP_LEN {
+		return 0, false
+	}
+	return int64(binary.BigEndian.Uint64(payload[:STAMP_LEN])), true
+}
+
+// DeliveryRecorder collects the delivery latencies of stamped payloads, the times from
+// their Stamp to their reception, and answers for their distribution
+type DeliveryRecorder struct {
+	sync.Mutex
+	latencies []int64
+}
+
+// Add records the latency of payload, received at time received. It returns false if payload
+// carries no stamp.
+func (x *DeliveryRecorder) Add(payload []byte, received int64) bool {
+	sent, ok := Stamped(payload)
+	if !ok {
+		return false
+	}
+	x.Lock()
+	defer x.Unlock()
+	x.latencies = append(x.latencies, received-sent)
+	return true
+}
+
+// Len returns the number of latencies recorded
+func (x *DeliveryRecorder) Len() int {
+	x.Lock()
+	defer x.Unlock()
+	return len(x.latencies)
+}
+
+// Percentile returns the latency that p percent of the recorded latencies do not exceed, or
+// zero if none are recorded
+func (x *DeliveryRecorder) Percentile(p float64) int64 {
+	x.Lock()
+	sorted := append([]int64(nil), x.latencies...)
+	x.Unlock()
+	if len(sorted) == 0 {
+		return 0
+	}
+	sort.Sort(int64Slice(sorted))
+	// Nearest rank
+	k := int(p/100*float64(len(sorted)) + 0.5)
+	if k < 1 {
+		k = 1
+	}
+	if k > len(sorted) {
+		k = len(sorted)
+	}
+	return sorted[k-1]
+}
+
+// CheckPercentile fails t unless latencies were recorded and p percent of them do not
+// exceed max
+func (x *DeliveryRecorder) CheckPercentile(t *testing.T, p float64, max int64) {
+	if x.Len() == 0 {
+		t.Errorf("no delivery latencies recorded")
+		return
+	}
+	if l := x.Percentile(p); l > max {
+		t.Errorf("%g-th percentile delivery latency %dms, expected at most %dms", p, l/1e6, max/1e6)
+	}
+}
+
+type int64Slice []int64
+
+func (t int64Slice) Len() int           { return len(t) }
+func (t int64Slice) Less(i, j int) bool { return t[i] < t[j] }
+func (t int64Slice) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
@@ -0,0 +1,55 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"strings"
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+	"github.com/petar/GoDCCP/dccp/ccid3"
+)
+
+// TestDump checks that the dumps of the endpoints of an open connection agree on their
+// initial sequence numbers, and that they carry the status of the CCIDs
+func TestDump(t *testing.T) {
+	env, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "dump")
+	clientConn, serverConn, _, _ := NewFlowPipe(env, "dump", ccid3.CCID3{})
+	for i := 0; i < 5; i++ {
+		if err := clientConn.Write(make([]byte, 10)); err != nil {
+			t.Fatalf("client write (%s)\n%s", err, clientConn.Dump())
+		}
+		if _, err := serverConn.Read(); err != nil {
+			t.Fatalf("server read (%s)\n%s", err, serverConn.Dump())
+		}
+	}
+
+	c, s := clientConn.Dump(), serverConn.Dump()
+	if c.State != "OPEN" || s.State != "OPEN" || c.Server || !s.Server {
+		t.Errorf("state\n%s\n%s", c, s)
+	}
+	if c.ISS != s.ISR || c.ISR != s.ISS || c.GSS < c.ISS + 5 || s.GSR < s.ISR + 5 {
+		t.Errorf("sequence numbers\n%s\n%s", c, s)
+	}
+	if _, ok := c.Sender[dccp.StatusRate]; !ok {
+		t.Errorf("no sending rate in dump\n%s", c)
+	}
+	if _, ok := s.Receiver[dccp.StatusLoss]; !ok {
+		t.Errorf("no loss event rate in dump\n%s", s)
+	}
+	if !strings.Contains(c.String(), "GSS=") {
+		t.Errorf("dump string\n%s", c)
+	}
+
+	clientConn.Abort()
+	serverConn.Abort()
+	env.NewGoJoin("end-of-test", clientConn.Joiner(), serverConn.Joiner()).Join()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Server and client done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+	if c = clientConn.Dump(); c.State != "CLOSED" || c.Err == nil {
+		t.Errorf("aborted connection\n%s", c)
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"encoding/binary"
+	"sync"
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+	"github.com/petar/GoDCCP/dccp/ccid3"
+)
+
+const (
+	dupDuration = 10e9 // Duration of the experiment in ns
+	dupSendRate = 40   // Fixed sender rate in pps
+	dupPayload  = 100  // Size of the messages in bytes
+	dupProb     = 0.3  // Probability that a packet is delivered twice
+)
+
+// dupWatch is a dccp.TraceWriter that keeps the highest loss event rate estimated by the
+// receiver of the server, and the receive rates that the sender of the client is told
+type dupWatch struct {
+	sync.Mutex
+	loss  float64   // In percent
+	xRecv []float64 // In bytes per second
+}
+
+func (x *dupWatch) Write(r *dccp.Trace) {
+	s, ok := r.Sample()
+	if !ok || len(r.Labels) < 2 {
+		return
+	}
+	x.Lock()
+	defer x.Unlock()
+	switch {
+	case s.Series == ccid3.LossReceiverEstimateSample && r.Labels[0] == "server" && s.Value > x.loss:
+		x.loss = s.Value
+	case s.Series == ccid3.XRecvSample && r.Labels[0] == "client" && r.Time > 1e9:
+		x.xRecv = append(x.xRecv, s.Value)
+	}
+}
+
+func (x *dupWatch) Sync() error { return nil }
+
+func (x *dupWatch) Close() error { return nil }
+
+// TestDuplicate checks that packets that the link delivers twice, in either direction, are
+// dropped as duplicates before the application and the congestion controls see them: every
+// message is read once, the receiver of the server sees no loss, and the receive rate that the
+// sender of the client is told does not count the duplicates.
+func TestDuplicate(t *testing.T) {
+	Virtual(t, testDuplicate)
+}
+
+func testDuplicate(t *testing.T, tm dccp.Time) {
+	x := &dupWatch{}
+	env, _ := NewEnvTime(tm, "duplicate", x)
+	clientConn, serverConn, clientToServer, serverToClient := NewClientServerPipe(env)
+	clientConn.Amb().Flags().SetUint32("FixRate", dupSendRate)
+	serverConn.Amb().Flags().SetUint32("FixRate", dupSendRate)
+	clientToServer.SetWriteDuplication(dupProb)
+	serverToClient.SetWriteDuplication(dupProb)
+
+	cchan := make(chan int, 1)
+	env.Go(func() {
+		t0 := env.Now()
+		for i := uint32(0); env.Now() - t0 < dupDuration; i++ {
+			msg := make([]byte, dupPayload)
+			binary.BigEndian.PutUint32(msg, i)
+			if err := clientConn.Write(msg); err != nil {
+				break
+			}
+		}
+		clientConn.Close()
+		close(cchan)
+	}, "test client")
+
+	read := make(map[uint32]int)
+	schan := make(chan int, 1)
+	env.Go(func() {
+		for {
+			msg, err := serverConn.Read()
+			if err != nil {
+				break
+			}
+			read[binary.BigEndian.Uint32(msg)]++
+		}
+		close(schan)
+	}, "test server")
+
+	<-cchan
+	<-schan
+	cstats, sstats := clientConn.Stats(), serverConn.Stats()
+
+	clientConn.Abort()
+	serverConn.Abort()
+	env.NewGoJoin("end-of-test", clientConn.Joiner(), serverConn.Joiner()).Join()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Server and client done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+
+	for id, n := range read {
+		if n > 1 {
+			t.Errorf("message %d read %d times", id, n)
+		}
+	}
+	if cstats.Duplicates == 0 || sstats.Duplicates == 0 {
+		t.Errorf("duplicates dropped by client %d, by server %d", cstats.Duplicates, sstats.Duplicates)
+	}
+	x.Lock()
+	defer x.Unlock()
+	if x.loss > 0.01 {
+		t.Errorf("loss event rate %g%%", x.loss)
+	}
+	if len(x.xRecv) == 0 {
+		t.Fatalf("no receive rate reported")
+	}
+	var sum float64
+	for _, r := range x.xRecv {
+		sum += r
+	}
+	// The receive rate counts application data, which the server read once per message, so a
+	// receive rate above the rate of reading counts duplicates
+	mean, rate := sum / float64(len(x.xRecv)), float64(len(read) * dupPayload) / (dupDuration / 1e9)
+	if mean > 1.1 * rate {
+		t.Errorf("mean receive rate %g B/s, read %g B/s", mean, rate)
+	}
+}
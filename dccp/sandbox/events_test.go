@@ -0,0 +1,92 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"fmt"
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// TestConnEvents checks that each Conn keeps the recent events of its own and of its
+// congestion controls, apart from those of the other Conn in the same Env, and that once
+// more than ConnEventsLen events have been emitted, it keeps exactly the most recent
+// ConnEventsLen of them, oldest first
+func TestConnEvents(t *testing.T) {
+	env, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "events")
+	clientConn, serverConn, _, _ := NewClientServerPipe(env)
+
+	for i := 0; i < 10; i++ {
+		if err := clientConn.Write(make([]byte, 100)); err != nil {
+			t.Fatalf("client write (%s)", err)
+		}
+		if _, err := serverConn.Read(); err != nil {
+			t.Fatalf("server read (%s)", err)
+		}
+	}
+
+	for _, c := range []struct {
+		conn  *dccp.Conn
+		label string
+	}{
+		{ clientConn, "client" }, { serverConn, "server" },
+	} {
+		events := c.conn.Events()
+		if len(events) == 0 || len(events) > dccp.ConnEventsLen {
+			t.Errorf("%s kept %d events, expected up to %d", c.label, len(events), dccp.ConnEventsLen)
+		}
+		var cc bool
+		for _, r := range events {
+			if r.Labels[0] != c.label {
+				t.Fatalf("%s kept event of %v", c.label, r.Labels)
+			}
+			cc = cc || len(r.Labels) > 1
+		}
+		if !cc {
+			t.Errorf("%s kept no events of its congestion controls", c.label)
+		}
+	}
+
+	// Other events may interleave with the marks, but the marks kept must be the last ones
+	const marks = dccp.ConnEventsLen + 10
+	for i := 0; i < marks; i++ {
+		serverConn.Amb().E(dccp.EventInfo, fmt.Sprintf("mark %d", i))
+	}
+	events := serverConn.Events()
+	if len(events) != dccp.ConnEventsLen {
+		t.Errorf("server kept %d events, expected %d", len(events), dccp.ConnEventsLen)
+	}
+	next := -1
+	for i, r := range events {
+		if i > 0 && r.Time < events[i-1].Time {
+			t.Fatalf("server events out of order at %d", i)
+		}
+		var k int
+		if _, err := fmt.Sscanf(r.Comment, "mark %d", &k); err != nil {
+			continue
+		}
+		if next >= 0 && k != next {
+			t.Fatalf("server kept mark %d after mark %d", k, next-1)
+		}
+		next = k + 1
+	}
+	if next != marks {
+		t.Errorf("server kept marks up to %d, expected up to %d", next-1, marks-1)
+	}
+
+	clientConn.SetEventsLen(0)
+	clientConn.Write(make([]byte, 100))
+	if n := len(clientConn.Events()); n != 0 {
+		t.Errorf("client kept %d events after SetEventsLen(0)", n)
+	}
+
+	clientConn.Abort()
+	serverConn.Abort()
+	env.NewGoJoin("end-of-test", clientConn.Joiner(), serverConn.Joiner()).Join()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Server and client done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+	"github.com/petar/GoDCCP/dccp/ccid3"
+)
+
+// expSnapshot is the decoded "godccp" expvar map
+type expSnapshot struct {
+	PktsOut  int64 `json:"pkts_out"`
+	BytesIn  int64 `json:"bytes_in"`
+	State    map[string]int64
+	CCID     map[string]struct {
+		Label    string
+		Sender   map[string]float64
+		Receiver map[string]float64
+	}
+}
+
+func readExpvar(t *testing.T) *expSnapshot {
+	v := expvar.Get("godccp")
+	if v == nil {
+		t.Fatalf("godccp not published")
+	}
+	x := &expSnapshot{}
+	if err := json.Unmarshal([]byte(v.String()), x); err != nil {
+		t.Fatalf("decode godccp (%s):\n%s", err, v.String())
+	}
+	return x
+}
+
+// TestExpvar checks the statistics published via expvar after an exchange over a connection
+// pair, including the status of the congestion controls of both endpoints
+func TestExpvar(t *testing.T) {
+	before := readExpvar(t)
+	env, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "expvar")
+	clientConn, serverConn, _, _ := NewFlowPipe(env, "expvar", ccid3.CCID3{})
+	for i := 0; i < 5; i++ {
+		if err := clientConn.Write(make([]byte, 10)); err != nil {
+			t.Fatalf("client write (%s)", err)
+		}
+		if _, err := serverConn.Read(); err != nil {
+			t.Fatalf("server read (%s)", err)
+		}
+	}
+
+	x := readExpvar(t)
+	if x.PktsOut < before.PktsOut + 5 || x.BytesIn < before.BytesIn + 50 {
+		t.Errorf("counters did not advance: %+v, before %+v", x, before)
+	}
+	if x.State["OPEN"] < before.State["OPEN"] + 2 {
+		t.Errorf("open connections %d, before %d", x.State["OPEN"], before.State["OPEN"])
+	}
+	var client, server bool
+	for _, cc := range x.CCID {
+		switch cc.Label {
+		case "client-expvar":
+			_, client = cc.Sender[dccp.StatusRate]
+		case "server-expvar":
+			_, server = cc.Receiver[dccp.StatusLoss]
+		}
+	}
+	if !client || !server {
+		t.Errorf("congestion control status missing: %+v", x.CCID)
+	}
+
+	clientConn.Abort()
+	serverConn.Abort()
+	env.NewGoJoin("end-of-test", clientConn.Joiner(), serverConn.Joiner()).Join()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Server and client done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+
+	// Closed connections are no longer published or counted
+	after := readExpvar(t)
+	if after.State["CLOSED"] != 0 {
+		t.Errorf("closed connections counted: %d", after.State["CLOSED"])
+	}
+	for _, cc := range after.CCID {
+		if cc.Label == "client-expvar" || cc.Label == "server-expvar" {
+			t.Errorf("closed connection %s still published", cc.Label)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+	"github.com/petar/GoDCCP/dccp/ccid3"
+)
+
+const (
+	fairnessFlows     = 3
+	fairnessDuration  = 120e9 // Duration of the fairness test
+	fairnessWarmup    = 10e9  // Time after the last flow starts, before throughput is measured
+	fairnessStagger   = 2e9   // Time between the starts of consecutive flows
+	fairnessBandwidth = 30e3  // Capacity of the shared link in bytes per second
+	fairnessBuffer    = 3e3   // Buffer of the shared link in bytes
+	fairnessLatency   = 40e6  // One-way latency of each flow
+)
+
+// fairnessCCIDs are the congestion controls whose flows are checked for fairness, with the
+// lowest Jain fairness index of the throughputs that each is allowed.
+var fairnessCCIDs = []struct {
+	name     string
+	ccid     dccp.CCID
+	minIndex float64
+}{
+	{ "ccid3", ccid3.CCID3{}, 0.9 },
+}
+
+// TestFairness runs several flows of the same congestion control over one shared bottleneck
+// link, and checks that they share its capacity fairly in the long run. The flows start one
+// after another, so that the late ones must win their share from the early ones. The flows
+// run on virtual time, so that the load of the machine does not decide the outcome.
+func TestFairness(t *testing.T) {
+	for _, c := range fairnessCCIDs {
+		Virtual(t, func(t *testing.T, tm dccp.Time) {
+			testFairness(t, tm, c.name, c.ccid, c.minIndex)
+		})
+	}
+}
+
+func testFairness(t *testing.T, tm dccp.Time, name string, ccid dccp.CCID, minIndex float64) {
+	env, _ := NewEnvTime(tm, "fairness-" + name)
+	link := NewBottleneck(fairnessBandwidth, fairnessBuffer)
+	start := env.Now()
+	measureFrom := int64(fairnessStagger*(fairnessFlows-1) + fairnessWarmup)
+
+	var (
+		lk       sync.Mutex
+		received [fairnessFlows]int64 // Bytes received by each flow after measureFrom
+		joiners  []dccp.Joiner
+		conns    []*dccp.Conn
+	)
+	done := make(chan int)
+	for i := 0; i < fairnessFlows; i++ {
+		i := i
+		clientConn, serverConn, clientToServer, serverToClient := NewFlowPipe(env, fmt.Sprintf("%d", i), ccid)
+		clientToServer.SetWriteRate(1e9, 1e6)
+		clientToServer.SetWriteBottleneck(link)
+		clientToServer.SetWriteLatency(fairnessLatency)
+		serverToClient.SetWriteRate(1e9, 1e6)
+		serverToClient.SetWriteLatency(fairnessLatency)
+		conns = append(conns, clientConn, serverConn)
+		joiners = append(joiners, clientConn.Joiner(), serverConn.Joiner())
+
+		env.Go(func() {
+			for {
+				data, err := serverConn.Read()
+				if err != nil {
+					return
+				}
+				if env.Now()-start >= measureFrom {
+					lk.Lock()
+					received[i] += int64(len(data))
+					lk.Unlock()
+				}
+			}
+		}, "fairness server")
+		env.Go(func() {
+			env.Sleep(int64(i) * fairnessStagger)
+			buf := make([]byte, clientConn.GetMTU())
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if err := clientConn.Write(buf); err != nil {
+					return
+				}
+			}
+		}, "fairness client")
+	}
+
+	env.Sleep(fairnessDuration)
+	close(done)
+	for _, c := range conns {
+		c.Abort()
+	}
+	env.NewGoJoin("end-of-test", joiners...).Join()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Servers and clients done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+
+	// Jain's fairness index is 1 when all flows receive the same throughput, and 1/n when a
+	// single flow receives all of it
+	var sum, sumsq float64
+	for _, r := range received {
+		sum += float64(r)
+		sumsq += float64(r) * float64(r)
+	}
+	if sum == 0 {
+		t.Fatalf("%s: no data received", name)
+	}
+	index := sum * sum / (fairnessFlows * sumsq)
+	if index < minIndex {
+		t.Errorf("%s: fairness index %.3f, received %v bytes", name, index, received)
+		return
+	}
+	t.Logf("%s: fairness index %.3f, received %v bytes", name, index, received)
+}
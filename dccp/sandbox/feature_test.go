@@ -0,0 +1,607 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"sync"
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+	"github.com/petar/GoDCCP/dccp/ccid3"
+)
+
+// dropFirstWith returns a drop filter that drops the first n packets that carry an option of
+// type optionType
+func dropFirstWith(optionType byte, n int) func(*dccp.Header) bool {
+	var lk sync.Mutex
+	return func(h *dccp.Header) bool {
+		for _, o := range h.Options {
+			if o.Type == optionType {
+				lk.Lock()
+				defer lk.Unlock()
+				if n > 0 {
+					n--
+					return true
+				}
+				return false
+			}
+		}
+		return false
+	}
+}
+
+// TestFeature checks that feature negotiations converge when their Change and Confirm options
+// are lost, and that simultaneous negotiations of a server-priority feature from both ends
+// settle on the server's preference
+func TestFeature(t *testing.T) {
+	env, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "feature")
+	clientConn, serverConn, clientToServer, serverToClient := NewFixedClientServerPipe(env)
+
+	// Let the handshake complete
+	if err := clientConn.Write([]byte{1}); err != nil {
+		t.Fatalf("client write (%s)", err)
+	}
+	if _, err := serverConn.Read(); err != nil {
+		t.Fatalf("server read (%s)", err)
+	}
+
+	if err := clientConn.ChangeFeature(dccp.FeatureRemote, dccp.FeatureSequenceWindow, 1000); err != dccp.ErrBad {
+		t.Errorf("remote non-negotiable change gave %v, expected ErrBad", err)
+	}
+	if err := clientConn.ChangeFeature(dccp.FeatureLocal, dccp.FeatureSendAckVector, 1); err != dccp.ErrUnsupported {
+		t.Errorf("unsupported value gave %v, expected ErrUnsupported", err)
+	}
+
+	// The first two Changes of the client and the first Confirm of the server are lost
+	clientToServer.SetWriteDrop(dropFirstWith(dccp.OptionChangeL, 2))
+	serverToClient.SetWriteDrop(dropFirstWith(dccp.OptionConfirmR, 1))
+	if err := clientConn.ChangeFeature(dccp.FeatureLocal, dccp.FeatureSequenceWindow, 1000); err != nil {
+		t.Fatalf("change Sequence Window (%s)", err)
+	}
+	// Both ends negotiate ECN Incapable of the client at once
+	if err := clientConn.ChangeFeature(dccp.FeatureLocal, dccp.FeatureECNIncapable, 0, 1); err != nil {
+		t.Fatalf("client change ECN Incapable (%s)", err)
+	}
+	if err := serverConn.ChangeFeature(dccp.FeatureRemote, dccp.FeatureECNIncapable, 1, 0); err != nil {
+		t.Fatalf("server change ECN Incapable (%s)", err)
+	}
+	env.Sleep(10e9)
+
+	if v, _ := clientConn.Feature(dccp.FeatureLocal, dccp.FeatureSequenceWindow); v != 1000 {
+		t.Errorf("client Sequence Window %d, expected 1000", v)
+	}
+	if v, _ := serverConn.Feature(dccp.FeatureRemote, dccp.FeatureSequenceWindow); v != 1000 {
+		t.Errorf("server Sequence Window of client %d, expected 1000", v)
+	}
+	if f := clientConn.Features(); f.SWAF != 1000 || f.SWBF != dccp.SEQWIN_FIXED {
+		t.Errorf("client windows %d/%d", f.SWAF, f.SWBF)
+	}
+	if f := serverConn.Features(); f.SWBF != 1000 || f.SWAF != dccp.SEQWIN_FIXED {
+		t.Errorf("server windows %d/%d", f.SWAF, f.SWBF)
+	}
+	if v, _ := clientConn.Feature(dccp.FeatureLocal, dccp.FeatureECNIncapable); v != 1 {
+		t.Errorf("client ECN Incapable %d, expected the server's preference 1", v)
+	}
+	if v, _ := serverConn.Feature(dccp.FeatureRemote, dccp.FeatureECNIncapable); v != 1 {
+		t.Errorf("server ECN Incapable of client %d, expected 1", v)
+	}
+
+	// Data keeps flowing under the new windows
+	if err := clientConn.Write([]byte{2}); err != nil {
+		t.Fatalf("client write (%s)", err)
+	}
+	if p, err := serverConn.Read(); err != nil || len(p) != 1 || p[0] != 2 {
+		t.Errorf("server read %v (%v)", p, err)
+	}
+
+	clientConn.Abort()
+	serverConn.Abort()
+	env.NewGoJoin("end-of-test", clientConn.Joiner(), serverConn.Joiner()).Join()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Server and client done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+}
+
+// TestMinCsCov checks that a receiver declares its Minimum Checksum Coverage with a feature
+// negotiation, and that the sender refuses partial coverage below it
+func TestMinCsCov(t *testing.T) {
+	env, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "mincscov")
+	clientConn, serverConn, _, _ := NewFixedClientServerPipe(env)
+	payload := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+	// At the default of 0, strict RFC mode allows only full coverage
+	env.SetStrictRFC(true)
+	if err := clientConn.WriteMsg(payload, dccp.WriteMeta{CsCov: dccp.CsCov8}); err != dccp.ErrCsCov {
+		t.Errorf("partial coverage in strict mode gave %v, expected ErrCsCov", err)
+	}
+	env.SetStrictRFC(false)
+	if err := clientConn.Write([]byte{1}); err != nil {
+		t.Fatalf("client write (%s)", err)
+	}
+	if _, err := serverConn.Read(); err != nil {
+		t.Fatalf("server read (%s)", err)
+	}
+
+	if err := serverConn.ChangeFeature(dccp.FeatureLocal, dccp.FeatureMinCsCov, dccp.CsCov8); err != nil {
+		t.Fatalf("change Minimum Checksum Coverage (%s)", err)
+	}
+	env.Sleep(2e9)
+	if v, _ := clientConn.Feature(dccp.FeatureRemote, dccp.FeatureMinCsCov); v != dccp.CsCov8 {
+		t.Errorf("client knows Minimum Checksum Coverage %d, expected %d", v, dccp.CsCov8)
+	}
+	if v, _ := serverConn.Feature(dccp.FeatureLocal, dccp.FeatureMinCsCov); v != dccp.CsCov8 {
+		t.Errorf("server Minimum Checksum Coverage %d, expected %d", v, dccp.CsCov8)
+	}
+
+	if err := clientConn.WriteMsg(payload, dccp.WriteMeta{CsCov: dccp.CsCov4}); err != dccp.ErrCsCov {
+		t.Errorf("coverage below the minimum gave %v, expected ErrCsCov", err)
+	}
+	if err := clientConn.WriteMsg(payload, dccp.WriteMeta{CsCov: dccp.CsCov8}); err != nil {
+		t.Fatalf("client write (%s)", err)
+	}
+	if _, meta, err := serverConn.ReadMsg(); err != nil || meta.CsCov != dccp.CsCov8 {
+		t.Errorf("server read coverage %d (%v), expected %d", meta.CsCov, err, dccp.CsCov8)
+	}
+
+	clientConn.Abort()
+	serverConn.Abort()
+	env.NewGoJoin("end-of-test", clientConn.Joiner(), serverConn.Joiner()).Join()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Server and client done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+}
+
+// TestShortSeqNos checks that an endpoint sends short sequence numbers once the peer agrees
+// to its Allow Short Seqnos feature, and that the peer extends them and delivers the data
+func TestShortSeqNos(t *testing.T) {
+	env, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "shortseqnos")
+	clientConn, serverConn, clientToServer, serverToClient := NewFixedClientServerPipe(env)
+
+	var lk sync.Mutex
+	var clientShort, serverShort int
+	clientToServer.SetWriteDrop(func(h *dccp.Header) bool {
+		lk.Lock()
+		defer lk.Unlock()
+		if !h.X {
+			clientShort++
+		}
+		return false
+	})
+	serverToClient.SetWriteDrop(func(h *dccp.Header) bool {
+		lk.Lock()
+		defer lk.Unlock()
+		if !h.X {
+			serverShort++
+		}
+		return false
+	})
+
+	if err := clientConn.Write([]byte{0}); err != nil {
+		t.Fatalf("client write (%s)", err)
+	}
+	if _, err := serverConn.Read(); err != nil {
+		t.Fatalf("server read (%s)", err)
+	}
+	if err := clientConn.ChangeFeature(dccp.FeatureLocal, dccp.FeatureAllowShortSeqNos, 1); err != nil {
+		t.Fatalf("change Allow Short Seqnos (%s)", err)
+	}
+	env.Sleep(2e9)
+	if f := clientConn.Features(); !f.ShortSeqNosA || f.ShortSeqNosB {
+		t.Errorf("client short sequence numbers %v/%v, expected true/false", f.ShortSeqNosA, f.ShortSeqNosB)
+	}
+	if f := serverConn.Features(); f.ShortSeqNosA || !f.ShortSeqNosB {
+		t.Errorf("server short sequence numbers %v/%v, expected false/true", f.ShortSeqNosA, f.ShortSeqNosB)
+	}
+
+	for i := 1; i <= 10; i++ {
+		if err := clientConn.Write([]byte{byte(i)}); err != nil {
+			t.Fatalf("client write (%s)", err)
+		}
+		if p, err := serverConn.Read(); err != nil || len(p) != 1 || p[0] != byte(i) {
+			t.Fatalf("server read %v (%v), expected %d", p, err, i)
+		}
+	}
+	lk.Lock()
+	if clientShort == 0 || serverShort != 0 {
+		t.Errorf("%d short packets from client, %d from server", clientShort, serverShort)
+	}
+	lk.Unlock()
+
+	clientConn.Abort()
+	serverConn.Abort()
+	env.NewGoJoin("end-of-test", clientConn.Joiner(), serverConn.Joiner()).Join()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Server and client done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+}
+
+// TestSequenceWindowGrowth checks that a sender whose rate outgrows its Sequence Window
+// renegotiates a larger window mid-connection. The client sets its window to the minimum of
+// 32 packets, and then sends 50 packets per second with the assumed RTT of 200 ms of the
+// fixed-rate CCID, which calls for a window of 5×10 packets.
+func TestSequenceWindowGrowth(t *testing.T) {
+	env, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "seqwin")
+	llog := dccp.NewAmb("line", env)
+	hca, hcb, _ := NewPipe(env, llog, "client", "server")
+	fixed := dccp.CCFixed{Every: 20e6}
+	clog := dccp.NewAmb("client", env)
+	clientConn := dccp.NewConnClient(env, clog, hca, fixed.NewSender(env, clog), fixed.NewReceiver(env, clog), 0)
+	slog := dccp.NewAmb("server", env)
+	serverConn := dccp.NewConnServer(env, slog, hcb, fixed.NewSender(env, slog), fixed.NewReceiver(env, slog))
+
+	if err := clientConn.Write([]byte{0}); err != nil {
+		t.Fatalf("client write (%s)", err)
+	}
+	if _, err := serverConn.Read(); err != nil {
+		t.Fatalf("server read (%s)", err)
+	}
+	if err := clientConn.ChangeFeature(dccp.FeatureLocal, dccp.FeatureSequenceWindow, 32); err != nil {
+		t.Fatalf("change Sequence Window (%s)", err)
+	}
+	env.Sleep(1e9)
+	if f := clientConn.Features(); f.SWAF != 32 {
+		t.Fatalf("client window %d, expected 32", f.SWAF)
+	}
+
+	done := make(chan int)
+	env.Go(func() {
+		t0 := env.Now()
+		for env.Now()-t0 < 3e9 {
+			if err := clientConn.Write([]byte{1}); err != nil {
+				t.Errorf("client write (%s)", err)
+				break
+			}
+		}
+		close(done)
+	}, "test client")
+	env.Go(func() {
+		for {
+			if _, err := serverConn.Read(); err != nil {
+				break
+			}
+		}
+	}, "test server")
+	<-done
+	env.Sleep(1e9)
+
+	c, s := clientConn.Features(), serverConn.Features()
+	if c.SWAF <= 32 || c.SWBF != dccp.SEQWIN_FIXED {
+		t.Errorf("client windows %d/%d, expected growth beyond 32", c.SWAF, c.SWBF)
+	}
+	if s.SWBF != c.SWAF || s.SWAF != dccp.SEQWIN_FIXED {
+		t.Errorf("server windows %d/%d, expected %d/%d", s.SWAF, s.SWBF, dccp.SEQWIN_FIXED, c.SWAF)
+	}
+
+	clientConn.Abort()
+	serverConn.Abort()
+	env.NewGoJoin("end-of-test", clientConn.Joiner(), serverConn.Joiner()).Join()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Server and client done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+}
+
+// TestECN checks that an endpoint marks its packets ECN-capable only while its peer is not ECN
+// Incapable, and that an ECN Incapable endpoint ignores the ECN codepoints of its packets
+func TestECN(t *testing.T) {
+	env, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "ecn")
+	clientConn, serverConn, clientToServer, _ := NewFixedClientServerPipe(env)
+
+	if err := clientConn.SetECN(true); err != nil {
+		t.Fatalf("set ECN (%s)", err)
+	}
+	if err := clientConn.Write([]byte{1}); err != nil {
+		t.Fatalf("client write (%s)", err)
+	}
+	if _, meta, err := serverConn.ReadMsg(); err != nil || meta.ECN != dccp.ECNECT0 {
+		t.Errorf("server read ECN %d (%v), expected ECT(0)", meta.ECN, err)
+	}
+
+	if err := serverConn.ChangeFeature(dccp.FeatureLocal, dccp.FeatureECNIncapable, 1); err != nil {
+		t.Fatalf("change ECN Incapable (%s)", err)
+	}
+	env.Sleep(2e9)
+	if v, _ := clientConn.Feature(dccp.FeatureRemote, dccp.FeatureECNIncapable); v != 1 {
+		t.Fatalf("client ECN Incapable of server %d, expected 1", v)
+	}
+	if err := clientConn.Write([]byte{2}); err != nil {
+		t.Fatalf("client write (%s)", err)
+	}
+	if _, meta, err := serverConn.ReadMsg(); err != nil || meta.ECN != dccp.ECNNotECT {
+		t.Errorf("server read ECN %d (%v), expected Not-ECT", meta.ECN, err)
+	}
+	if tos := clientToServer.TrafficClass(); tos&3 != dccp.ECNNotECT {
+		t.Errorf("client marks ECN codepoint %d, expected Not-ECT", tos&3)
+	}
+
+	// Congestion Experienced marks are ignored by the ECN Incapable server
+	clientToServer.SetWriteDrop(func(h *dccp.Header) bool {
+		h.ECN = dccp.ECNCE
+		return false
+	})
+	if err := clientConn.Write([]byte{3}); err != nil {
+		t.Fatalf("client write (%s)", err)
+	}
+	if _, meta, err := serverConn.ReadMsg(); err != nil || meta.ECN != dccp.ECNNotECT {
+		t.Errorf("server read ECN %d (%v), expected Not-ECT", meta.ECN, err)
+	}
+
+	clientConn.Abort()
+	serverConn.Abort()
+	env.NewGoJoin("end-of-test", clientConn.Joiner(), serverConn.Joiner()).Join()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Server and client done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+}
+
+// ackRatioSender is a CCFixed sender that asks for an Ack Ratio set by the test
+type ackRatioSender struct {
+	dccp.SenderCongestionControl
+	sync.Mutex
+	ratio int
+}
+
+func (s *ackRatioSender) AckRatio() int {
+	s.Lock()
+	defer s.Unlock()
+	return s.ratio
+}
+
+func (s *ackRatioSender) SetRatio(ratio int) {
+	s.Lock()
+	defer s.Unlock()
+	s.ratio = ratio
+}
+
+// ackRatioReceiver is a CCFixed receiver that records the Ack Ratios it is told
+type ackRatioReceiver struct {
+	dccp.ReceiverCongestionControl
+	sync.Mutex
+	ratios []int
+}
+
+func (r *ackRatioReceiver) SetAckRatio(ratio int) {
+	r.Lock()
+	defer r.Unlock()
+	r.ratios = append(r.ratios, ratio)
+}
+
+func (r *ackRatioReceiver) Ratios() []int {
+	r.Lock()
+	defer r.Unlock()
+	return append([]int(nil), r.ratios...)
+}
+
+// TestAckRatio checks that the Ack Ratio wished by the sender CCID is negotiated and passed
+// on to the receiver CCID of the peer
+func TestAckRatio(t *testing.T) {
+	env, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "ackratio")
+	llog := dccp.NewAmb("line", env)
+	hca, hcb, _ := NewPipe(env, llog, "client", "server")
+	fixed := dccp.CCFixed{Every: 1e6}
+	clog := dccp.NewAmb("client", env)
+	scc := &ackRatioSender{SenderCongestionControl: fixed.NewSender(env, clog)}
+	clientConn := dccp.NewConnClient(env, clog, hca, scc, fixed.NewReceiver(env, clog), 0)
+	slog := dccp.NewAmb("server", env)
+	rcc := &ackRatioReceiver{ReceiverCongestionControl: fixed.NewReceiver(env, slog)}
+	serverConn := dccp.NewConnServer(env, slog, hcb, fixed.NewSender(env, slog), rcc)
+
+	if err := clientConn.Write([]byte{0}); err != nil {
+		t.Fatalf("client write (%s)", err)
+	}
+	if _, err := serverConn.Read(); err != nil {
+		t.Fatalf("server read (%s)", err)
+	}
+	if r := rcc.Ratios(); len(r) != 1 || r[0] != 2 {
+		t.Fatalf("server receiver told %v, expected the default [2]", r)
+	}
+
+	scc.SetRatio(7)
+	env.Sleep(2e9)
+	if v, _ := clientConn.Feature(dccp.FeatureLocal, dccp.FeatureAckRatio); v != 7 {
+		t.Errorf("client Ack Ratio %d, expected 7", v)
+	}
+	if v, _ := serverConn.Feature(dccp.FeatureRemote, dccp.FeatureAckRatio); v != 7 {
+		t.Errorf("server peer Ack Ratio %d, expected 7", v)
+	}
+	if r := rcc.Ratios(); len(r) != 2 || r[1] != 7 {
+		t.Errorf("server receiver told %v, expected [2 7]", r)
+	}
+
+	clientConn.Abort()
+	serverConn.Abort()
+	env.NewGoJoin("end-of-test", clientConn.Joiner(), serverConn.Joiner()).Join()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Server and client done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+}
+
+// ackVectorSender is a CCFixed sender that claims to process Ack Vectors
+type ackVectorSender struct {
+	dccp.SenderCongestionControl
+	requires bool
+}
+
+func (s *ackVectorSender) RequiresAckVector() bool { return s.requires }
+
+// ackVectorReceiver is a CCFixed receiver that records whether it is told to send Ack Vectors
+type ackVectorReceiver struct {
+	dccp.ReceiverCongestionControl
+	sync.Mutex
+	on bool
+}
+
+func (r *ackVectorReceiver) SetSendAckVector(on bool) {
+	r.Lock()
+	defer r.Unlock()
+	r.on = on
+}
+
+func (r *ackVectorReceiver) SendAckVector() bool {
+	r.Lock()
+	defer r.Unlock()
+	return r.on
+}
+
+// TestSendAckVector checks that a sender CCID that requires Ack Vectors turns them on at a
+// peer that can send them
+func TestSendAckVector(t *testing.T) {
+	env, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "sendackvector")
+	llog := dccp.NewAmb("line", env)
+	hca, hcb, _ := NewPipe(env, llog, "client", "server")
+	fixed := dccp.CCFixed{Every: 1e6}
+	clog := dccp.NewAmb("client", env)
+	scc := &ackVectorSender{SenderCongestionControl: fixed.NewSender(env, clog), requires: true}
+	clientConn := dccp.NewConnClient(env, clog, hca, scc, fixed.NewReceiver(env, clog), 0)
+	slog := dccp.NewAmb("server", env)
+	rcc := &ackVectorReceiver{ReceiverCongestionControl: fixed.NewReceiver(env, slog)}
+	serverConn := dccp.NewConnServer(env, slog, hcb, fixed.NewSender(env, slog), rcc)
+
+	if err := clientConn.Write([]byte{0}); err != nil {
+		t.Fatalf("client write (%s)", err)
+	}
+	if _, err := serverConn.Read(); err != nil {
+		t.Fatalf("server read (%s)", err)
+	}
+	env.Sleep(1e9)
+	if v, _ := clientConn.Feature(dccp.FeatureRemote, dccp.FeatureSendAckVector); v != 1 {
+		t.Errorf("client peer Send Ack Vector %d, expected 1", v)
+	}
+	if v, _ := serverConn.Feature(dccp.FeatureLocal, dccp.FeatureSendAckVector); v != 1 {
+		t.Errorf("server Send Ack Vector %d, expected 1", v)
+	}
+	if !rcc.SendAckVector() {
+		t.Errorf("server receiver not told to send Ack Vectors")
+	}
+	if v, _ := serverConn.Feature(dccp.FeatureRemote, dccp.FeatureSendAckVector); v != 0 {
+		t.Errorf("server peer Send Ack Vector %d, expected 0", v)
+	}
+
+	clientConn.Abort()
+	serverConn.Abort()
+	env.NewGoJoin("end-of-test", clientConn.Joiner(), serverConn.Joiner()).Join()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Server and client done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+}
+
+// TestSendAckVectorMandatory checks that a peer that cannot send the Ack Vectors required by
+// the sender CCID resets the connection
+func TestSendAckVectorMandatory(t *testing.T) {
+	env, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "sendackvectormandatory")
+	llog := dccp.NewAmb("line", env)
+	hca, hcb, _ := NewPipe(env, llog, "client", "server")
+	fixed := dccp.CCFixed{Every: 1e6}
+	clog := dccp.NewAmb("client", env)
+	scc := &ackVectorSender{SenderCongestionControl: fixed.NewSender(env, clog), requires: true}
+	clientConn := dccp.NewConnClient(env, clog, hca, scc, fixed.NewReceiver(env, clog), 0)
+	slog := dccp.NewAmb("server", env)
+	serverConn := dccp.NewConnServer(env, slog, hcb, fixed.NewSender(env, slog), fixed.NewReceiver(env, slog))
+
+	if _, err := clientConn.Read(); err == nil {
+		t.Errorf("client read succeeded, expected reset")
+	}
+	if _, err := serverConn.Read(); err == nil {
+		t.Errorf("server read succeeded, expected reset")
+	}
+
+	env.NewGoJoin("end-of-test", clientConn.Joiner(), serverConn.Joiner()).Join()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Server and client done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+}
+
+// TestCCIDNegotiation checks that a client that prefers the fixed-rate CCID switches both of
+// its half-connections to CCID3, which the server prefers
+func TestCCIDNegotiation(t *testing.T) {
+	env, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "ccidneg")
+	llog := dccp.NewAmb("line", env)
+	hca, hcb, _ := NewPipe(env, llog, "client", "server")
+	fixed, tfrc := dccp.CCFixed{Every: 1e6}, ccid3.CCID3{}
+	clog, slog := dccp.NewAmb("client", env), dccp.NewAmb("server", env)
+	clientConn := dccp.NewConnClient(env, clog, hca, fixed.NewSender(env, clog), fixed.NewReceiver(env, clog), 0)
+	serverConn := dccp.NewConnServer(env, slog, hcb, tfrc.NewSender(env, slog), tfrc.NewReceiver(env, slog))
+
+	if err := clientConn.Write([]byte{1}); err != nil {
+		t.Fatalf("client write (%s)", err)
+	}
+	if _, err := serverConn.Read(); err != nil {
+		t.Fatalf("server read (%s)", err)
+	}
+	for _, c := range []*dccp.Conn{clientConn, serverConn} {
+		if f := c.Features(); f.CCIDA != dccp.CCID3 || f.CCIDB != dccp.CCID3 {
+			t.Errorf("CCIDs %d/%d, expected CCID3\n%s", f.CCIDA, f.CCIDB, c.Dump())
+		}
+		if v, _ := c.Feature(dccp.FeatureLocal, dccp.FeatureCCID); v != dccp.CCID3 {
+			t.Errorf("CCID feature %d, expected CCID3", v)
+		}
+	}
+	if _, ok := clientConn.Dump().Sender[dccp.StatusRate]; !ok {
+		t.Errorf("client sender is not CCID3\n%s", clientConn.Dump())
+	}
+
+	clientConn.Abort()
+	serverConn.Abort()
+	env.NewGoJoin("end-of-test", clientConn.Joiner(), serverConn.Joiner()).Join()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Server and client done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+}
+
+// TestHalfCCIDs checks that a server with different CCIDs on its two half-connections has the
+// client switch only the half-connection where they disagree, and that data flows both ways
+func TestHalfCCIDs(t *testing.T) {
+	env, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "halfccids")
+	llog := dccp.NewAmb("line", env)
+	hca, hcb, _ := NewPipe(env, llog, "client", "server")
+	fixed, tfrc := dccp.CCFixed{Every: 1e6}, ccid3.CCID3{}
+	half := dccp.HalfCCIDs{Sender: tfrc, Receiver: fixed}
+	clog, slog := dccp.NewAmb("client", env), dccp.NewAmb("server", env)
+	clientConn := dccp.NewConnClient(env, clog, hca, tfrc.NewSender(env, clog), tfrc.NewReceiver(env, clog), 0)
+	serverConn := dccp.NewConnServer(env, slog, hcb, half.NewSender(env, slog), half.NewReceiver(env, slog))
+
+	for i := 0; i < 3; i++ {
+		if err := clientConn.Write([]byte{byte(i)}); err != nil {
+			t.Fatalf("client write (%s)", err)
+		}
+		if _, err := serverConn.Read(); err != nil {
+			t.Fatalf("server read (%s)", err)
+		}
+		if err := serverConn.Write([]byte{byte(i)}); err != nil {
+			t.Fatalf("server write (%s)", err)
+		}
+		if _, err := clientConn.Read(); err != nil {
+			t.Fatalf("client read (%s)", err)
+		}
+	}
+	if f := clientConn.Features(); f.CCIDA != dccp.CCID_FIXED || f.CCIDB != dccp.CCID3 {
+		t.Errorf("client CCIDs %d/%d, expected %d/%d\n%s", f.CCIDA, f.CCIDB, dccp.CCID_FIXED, dccp.CCID3, clientConn.Dump())
+	}
+	if f := serverConn.Features(); f.CCIDA != dccp.CCID3 || f.CCIDB != dccp.CCID_FIXED {
+		t.Errorf("server CCIDs %d/%d, expected %d/%d\n%s", f.CCIDA, f.CCIDB, dccp.CCID3, dccp.CCID_FIXED, serverConn.Dump())
+	}
+	d := clientConn.Dump()
+	if _, ok := d.Sender[dccp.StatusRate]; ok {
+		t.Errorf("client sender is still CCID3\n%s", d)
+	}
+	if _, ok := d.Receiver[dccp.StatusLoss]; !ok {
+		t.Errorf("client receiver is not CCID3\n%s", d)
+	}
+
+	clientConn.Abort()
+	serverConn.Abort()
+	env.NewGoJoin("end-of-test", clientConn.Joiner(), serverConn.Joiner()).Join()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Server and client done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"sync"
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+	"github.com/petar/GoDCCP/dccp/ccid3"
+)
+
+// forgedResets is the number of Resets injected by TestForgedReset
+const forgedResets = 20
+
+// lastWrite is a dccp.TraceWriter that remembers the sequence and acknowledgement numbers of
+// the latest packet written by the server. It lets a test forge packets, whose sequence
+// numbers are as close a guess as an attacker can make.
+type lastWrite struct {
+	sync.Mutex
+	seqNo, ackNo int64
+}
+
+func (x *lastWrite) Write(r *dccp.Trace) {
+	if r.Event != dccp.EventWrite || r.Type == "" || len(r.Labels) == 0 || r.Labels[0] != "server" {
+		return
+	}
+	x.Lock()
+	defer x.Unlock()
+	x.seqNo, x.ackNo = r.SeqNo, r.AckNo
+}
+
+func (x *lastWrite) Sync() error { return nil }
+
+func (x *lastWrite) Close() error { return nil }
+
+// TestForgedReset injects Resets towards the client, whose sequence numbers are within the
+// client's window but are not the next expected one. It checks that the connection survives,
+// that the Resets are counted as suspect and that the Syncs sent in reply are rate limited.
+func TestForgedReset(t *testing.T) {
+	last := &lastWrite{}
+	env, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "forgedreset", last)
+	clientConn, serverConn, _, serverToClient := NewClientServerPipe(env)
+	payload := []byte{1, 2, 3}
+
+	rchan := make(chan int, forgedResets)
+	env.Go(func() {
+		for {
+			if _, err := serverConn.Read(); err != nil {
+				break
+			}
+			rchan <- 1
+		}
+		close(rchan)
+	}, "test server")
+
+	if err := clientConn.Write(payload); err != nil {
+		t.Fatalf("client write (%s)", err)
+	}
+	<-rchan
+	env.Sleep(1e9)
+
+	for i := 0; i < forgedResets; i++ {
+		last.Lock()
+		h := &dccp.Header{}
+		h.InitResetHeader(dccp.ResetAborted)
+		h.SeqNo, h.AckNo = last.seqNo+3, last.ackNo
+		last.Unlock()
+		serverToClient.Write(h)
+		env.Sleep(10e6)
+	}
+	env.Sleep(1e9)
+
+	if err := clientConn.Write(payload); err != nil {
+		t.Errorf("client write after forged resets (%s)", err)
+	} else if _, ok := <-rchan; !ok {
+		t.Errorf("server read after forged resets")
+	}
+	stats := clientConn.Stats()
+	if stats.SuspectResets != forgedResets {
+		t.Errorf("counted %d suspect resets, expecting %d", stats.SuspectResets, forgedResets)
+	}
+	if stats.SyncsLimited == 0 {
+		t.Errorf("expecting rate-limited syncs")
+	}
+
+	clientConn.Abort()
+	serverConn.Abort()
+	env.NewGoJoin("end-of-test", clientConn.Joiner(), serverConn.Joiner()).Join()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Server and client done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+}
+
+// TestInitCookie checks that a connection opens when the server protects its Responses with
+// Init Cookies, which the client must echo in PARTOPEN
+func TestInitCookie(t *testing.T) {
+	env, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "initcookie")
+	env.SetCookieJar(dccp.NewCookieJar(env, dccp.CookieKeyLifetime))
+	clientConn, serverConn, _, _ := NewClientServerPipe(env)
+	payload := []byte{1, 2, 3}
+
+	if err := clientConn.Write(payload); err != nil {
+		t.Fatalf("client write (%s)", err)
+	}
+	if p, err := serverConn.Read(); err != nil || len(p) != len(payload) {
+		t.Errorf("server read %v (%v)", p, err)
+	}
+	if n := serverConn.Stats().AmplifyLimited; n != 0 {
+		t.Errorf("server withheld %d handshake packets due to the amplification limit", n)
+	}
+
+	clientConn.Abort()
+	serverConn.Abort()
+	env.NewGoJoin("end-of-test", clientConn.Joiner(), serverConn.Joiner()).Join()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Server and client done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+}
+
+// TestResetStorm connects a client to a confused peer, played by the test, which answers each
+// of the client's Syncs with a Reset whose sequence number is in the window but inexact. The
+// client considers such Resets invalid and answers them with Syncs. It checks that the client
+// stops answering after ResetChainLimit Resets, and that it never answers a Reset with a Reset.
+func TestResetStorm(t *testing.T) {
+	env, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "resetstorm")
+	hc, peer, _ := NewPipe(env, dccp.NewAmb("line", env), "client", "peer")
+	ccid := ccid3.CCID3{}
+	clog := dccp.NewAmb("client", env)
+	clientConn := dccp.NewConnClient(env, clog, hc, ccid.NewSender(env, clog), ccid.NewReceiver(env, clog), 0)
+	// The peer sends no feedback, so the send rate is fixed to keep the client's replies prompt
+	clientConn.Amb().Flags().SetUint32("FixRate", 100)
+
+	const peerISS = 1e6
+	syncs, resets := 0, 0
+	for t0 := env.Now(); env.Now()-t0 < 4e9; {
+		peer.SetReadExpire(500e6)
+		h, err := peer.Read()
+		if err == dccp.ErrTimeout {
+			continue
+		}
+		if err != nil {
+			t.Fatalf("peer read (%s)", err)
+		}
+		switch h.Type {
+		case dccp.Request:
+			if syncs > 0 {
+				break
+			}
+			// A Reset that acknowledges no Request is not answered with a Reset
+			g := &dccp.Header{}
+			g.InitResetHeader(dccp.ResetAborted)
+			g.SeqNo, g.AckNo = peerISS-10, h.SeqNo+1000
+			peer.Write(g)
+			// Answer the Request, so that the client enters PARTOPEN
+			g = &dccp.Header{Type: dccp.Response, X: true, ServiceCode: h.ServiceCode}
+			g.SeqNo, g.AckNo = peerISS, h.SeqNo
+			peer.Write(g)
+		case dccp.Sync:
+			syncs++
+			// Leave enough time between Resets, so that the client's Syncs are not rate limited
+			env.Sleep(1e9 / dccp.SyncRateLimit * 2)
+			g := &dccp.Header{}
+			g.InitResetHeader(dccp.ResetAborted)
+			g.SeqNo, g.AckNo = peerISS+3, h.SeqNo
+			peer.Write(g)
+		case dccp.Reset:
+			resets++
+		}
+	}
+
+	// The first Sync is the client's own, sent on entering PARTOPEN
+	if syncs != 1+dccp.ResetChainLimit {
+		t.Errorf("client sent %d Syncs, expecting %d", syncs, 1+dccp.ResetChainLimit)
+	}
+	if resets != 0 {
+		t.Errorf("client answered Resets with %d Resets", resets)
+	}
+	if stats := clientConn.Stats(); stats.ResetStorms != 1 || stats.SyncsLimited != 0 {
+		t.Errorf("counted %d suppressed and %d rate-limited replies, expecting 1 and 0", stats.ResetStorms, stats.SyncsLimited)
+	}
+
+	clientConn.Abort()
+	env.NewGoJoin("end-of-test", clientConn.Joiner()).Join()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Client done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+}
+
+// TestViolationPolicy injects a Response into an open connection, which violates the protocol,
+// and checks that the client treats it according to its ViolationPolicy. It runs on virtual
+// time, so that the packets that the client sends before the forgery arrives do not depend on
+// the load of the machine.
+func TestViolationPolicy(t *testing.T) {
+	for _, policy := range []dccp.ViolationPolicy{dccp.ViolationsRFC, dccp.ViolationsDrop, dccp.ViolationsReset} {
+		Virtual(t, func(t *testing.T, tm dccp.Time) {
+			testViolationPolicy(t, tm, policy)
+		})
+	}
+}
+
+func testViolationPolicy(t *testing.T, tm dccp.Time, policy dccp.ViolationPolicy) {
+	last := &lastWrite{}
+	env, _ := NewEnvTime(tm, "violation", last)
+	clientConn, serverConn, _, serverToClient := NewClientServerPipe(env)
+	var kinds []int
+	clientConn.SetViolationPolicy(policy, func(v *dccp.Violation) { kinds = append(kinds, v.Kind) })
+	payload := []byte{1, 2, 3}
+
+	if err := clientConn.Write(payload); err != nil {
+		t.Fatalf("client write (%s)", err)
+	}
+	if _, err := serverConn.Read(); err != nil {
+		t.Fatalf("server read (%s)", err)
+	}
+
+	last.Lock()
+	h := &dccp.Header{Type: dccp.Response, X: true}
+	h.SeqNo, h.AckNo = last.seqNo+1, last.ackNo
+	last.Unlock()
+	serverToClient.Write(h)
+	env.Sleep(1e9)
+
+	if stats := clientConn.Stats(); stats.Violations != 1 || len(kinds) != 1 || kinds[0] != dccp.ViolationType {
+		t.Errorf("policy %d: %d violations, callback kinds %v", policy, stats.Violations, kinds)
+	}
+	if err := clientConn.Error(); (err != nil) != (policy == dccp.ViolationsReset) {
+		t.Errorf("policy %d: connection error %v", policy, err)
+	}
+
+	clientConn.Abort()
+	serverConn.Abort()
+	env.NewGoJoin("end-of-test", clientConn.Joiner(), serverConn.Joiner()).Join()
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+}
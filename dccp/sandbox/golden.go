@@ -0,0 +1,189 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// GoldenTrace is a dccp.TraceWriter that records a normalized trace of the Conns of its Env,
+// for comparison with a golden file from an earlier run. It keeps what a change of protocol
+// behavior would alter, and drops what varies from run to run:
+//
+//   - the packets that each Conn writes, with their type, options, and sequence and
+//     acknowledgement numbers relative to the first packet of the respective Conn
+//   - the state changes of each Conn
+//   - the packets that each Conn drops, with the reason
+//
+// Times, random initial sequence numbers and the interleaving of the Conns are not recorded,
+// and neither is anything after Stop, which leaves the teardown of a test out. The state
+// changes of a Conn are kept apart from its packets, since the read and write loops of the Conn
+// race one another.
+// Consecutive records that only differ in their sequence numbers are written once, with a
+// repeat count instead of the numbers, so that retransmissions and Acks whose numbers depend
+// on timing do not break the comparison.
+type GoldenTrace struct {
+	sync.Mutex
+	base    map[string]int64    // Sequence number of the first packet written by each Conn
+	records map[string][]golden // Records of each section, in order
+	names   []string            // Sections in order of appearance
+	stopped bool                // Set by Stop
+}
+
+type golden struct {
+	kind  string // Normalized record, without sequence numbers
+	seqs  string // Normalized sequence numbers of the first occurrence
+	count int
+}
+
+// GOLDEN_DIR is the directory of the golden files, relative to the package directory
+const GOLDEN_DIR = "testdata"
+
+// NewGoldenTrace creates an empty GoldenTrace
+func NewGoldenTrace() *GoldenTrace {
+	return &GoldenTrace{ base: make(map[string]int64), records: make(map[string][]golden) }
+}
+
+// Write implements dccp.TraceWriter.Write
+func (x *GoldenTrace) Write(r *dccp.Trace) {
+	// Records of the Conns themselves carry a single label, like "client" or "server"
+	if len(r.Labels) != 1 {
+		return
+	}
+	conn := r.Labels[0]
+	x.Lock()
+	defer x.Unlock()
+	if x.stopped {
+		return
+	}
+	if a := r.ArgOfType(dccp.StateChange{}); a != nil {
+		sc := a.(dccp.StateChange)
+		x.add(conn + " states", fmt.Sprintf("%s -> %s", sc.From, sc.To), "")
+		return
+	}
+	switch r.Event {
+	case dccp.EventWrite:
+		if _, ok := x.base[conn]; !ok {
+			x.base[conn] = r.SeqNo
+		}
+		kind := "write " + r.Type
+		if len(r.Options) > 0 {
+			kind += " [" + strings.Join(r.Options, ",") + "]"
+		}
+		x.add(conn + " packets", kind, x.seqs(conn, r))
+	case dccp.EventDrop:
+		x.add(conn + " packets", fmt.Sprintf("drop %s (%s)", r.Type, r.Comment), x.seqs(conn, r))
+	}
+}
+
+// seqs returns the sequence and acknowledgement numbers of r, relative to the first packets
+// of the Conn that sent them
+func (x *GoldenTrace) seqs(conn string, r *dccp.Trace) string {
+	if r.Type == "" {
+		return ""
+	}
+	seq, ack := "?", "?"
+	for c, b := range x.base {
+		if c == conn && r.Event == dccp.EventWrite {
+			seq = fmt.Sprintf("%d", r.SeqNo-b)
+		} else if c != conn && r.Event == dccp.EventWrite {
+			ack = fmt.Sprintf("%d", r.AckNo-b)
+		}
+	}
+	return fmt.Sprintf("seq=%s ack=%s", seq, ack)
+}
+
+// add appends a record to section, or counts it as a repeat of the last one
+func (x *GoldenTrace) add(section, kind, seqs string) {
+	recs, ok := x.records[section]
+	if !ok {
+		x.names = append(x.names, section)
+	}
+	if n := len(recs); n > 0 && recs[n-1].kind == kind {
+		recs[n-1].count++
+		return
+	}
+	x.records[section] = append(recs, golden{ kind: kind, seqs: seqs, count: 1 })
+}
+
+// Stop ends the recording
+func (x *GoldenTrace) Stop() {
+	x.Lock()
+	defer x.Unlock()
+	x.stopped = true
+}
+
+// Sync implements dccp.TraceWriter.Sync
+func (x *GoldenTrace) Sync() error { return nil }
+
+// Close implements dccp.TraceWriter.Close
+func (x *GoldenTrace) Close() error { return nil }
+
+// Bytes returns the normalized trace, with the states and packets of each Conn in sections of
+// their own
+func (x *GoldenTrace) Bytes() []byte {
+	x.Lock()
+	defer x.Unlock()
+	var w bytes.Buffer
+	names := append([]string(nil), x.names...)
+	sort.Strings(names)
+	for _, section := range names {
+		fmt.Fprintf(&w, "[%s]\n", section)
+		for _, g := range x.records[section] {
+			fmt.Fprintf(&w, "%s", g.kind)
+			if g.count > 1 {
+				fmt.Fprintf(&w, " x%d", g.count)
+			} else if g.seqs != "" {
+				fmt.Fprintf(&w, " %s", g.seqs)
+			}
+			fmt.Fprintln(&w)
+		}
+	}
+	return w.Bytes()
+}
+
+// Check compares the normalized trace with the golden file GOLDEN_DIR/name.golden, and fails
+// t on the first line that differs. If the environment variable DCCPGOLDEN is set to
+// "update", the golden file is written instead.
+func (x *GoldenTrace) Check(t *testing.T, name string) {
+	file := path.Join(GOLDEN_DIR, name + ".golden")
+	got := x.Bytes()
+	if os.Getenv("DCCPGOLDEN") == "update" {
+		if err := os.MkdirAll(GOLDEN_DIR, 0755); err != nil {
+			t.Fatalf("golden directory (%s)", err)
+		}
+		if err := ioutil.WriteFile(file, got, 0644); err != nil {
+			t.Fatalf("golden write (%s)", err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("golden read (%s); set DCCPGOLDEN=update to record it", err)
+	}
+	gotLines, wantLines := strings.Split(string(got), "\n"), strings.Split(string(want), "\n")
+	for i := 0; i < len(gotLines) || i < len(wantLines); i++ {
+		var g, w string
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if g != w {
+			t.Errorf("%s:%d: trace %q, golden %q", file, i+1, g, w)
+			return
+		}
+	}
+}
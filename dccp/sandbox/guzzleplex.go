@@ -8,15 +8,16 @@ import (
 	"github.com/petar/GoDCCP/dccp"
 )
 
-// TraceWriterPlex is a dccp.TraceWriter that replicates TraceWriter method invocations to a set of TraceWriters
+// TraceWriterPlex is a dccp.TraceWriter that replicates TraceWriter method invocations to a set of
+// TraceWriters, highlighting records that carry samples of interest along the way
 type TraceWriterPlex struct {
-	guzzles   []dccp.TraceWriter
+	*dccp.MultiTraceWriter
 	highlight []string
 }
 
 func NewTraceWriterPlex(guzzles ...dccp.TraceWriter) *TraceWriterPlex {
 	return &TraceWriterPlex{
-		guzzles: guzzles,
+		MultiTraceWriter: dccp.NewMultiTraceWriter(guzzles...),
 	}
 }
 
@@ -25,11 +26,6 @@ func (t *TraceWriterPlex) HighlightSamples(samples ...string) {
 	t.highlight = samples
 }
 
-// Add adds an additional guzzle to the plex
-func (t *TraceWriterPlex) Add(g dccp.TraceWriter) {
-	t.guzzles = append(t.guzzles, g)
-}
-
 func (t *TraceWriterPlex) Write(r *dccp.Trace) {
 	sample, ok := r.Sample()
 	if ok {
@@ -40,31 +36,5 @@ func (t *TraceWriterPlex) Write(r *dccp.Trace) {
 			}
 		}
 	}
-	for _, g := range t.guzzles {
-		g.Write(r)
-	}
-}
-
-// Sync syncs all the guzzles in the plex
-func (t *TraceWriterPlex) Sync() error {
-	var err error
-	for _, g := range t.guzzles {
-		e := g.Sync()
-		if err != nil {
-			err = e
-		}
-	}
-	return err
-}
-
-// Close closes all the guzzles in the plex
-func (t *TraceWriterPlex) Close() error {
-	var err error
-	for _, g := range t.guzzles {
-		e := g.Close()
-		if err != nil {
-			err = e
-		}
-	}
-	return err
+	t.MultiTraceWriter.Write(r)
 }
@@ -0,0 +1,168 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+	"github.com/petar/GoDCCP/dccp/ccid3"
+)
+
+// flakyLink is a dccp.Link that drops the first few packets written to it, and sends each of
+// the following ones twice, the second copy after the next packet
+type flakyLink struct {
+	dccp.Link
+	sync.Mutex
+	drop int    // Number of packets still to be dropped
+	held []byte // Second copy of the previous packet
+}
+
+func (l *flakyLink) WriteTo(buf []byte, addr net.Addr) (n int, err error) {
+	l.Lock()
+	defer l.Unlock()
+	if l.drop > 0 {
+		l.drop--
+		return len(buf), nil
+	}
+	for _, p := range [][]byte{buf, l.held} {
+		if p == nil {
+			continue
+		}
+		if _, err = l.Link.WriteTo(p, addr); err != nil {
+			return 0, err
+		}
+	}
+	l.held = append([]byte{}, buf...)
+	return len(buf), nil
+}
+
+// TestLossyHandshake connects a client to a server through a pair of Muxes, over a link that
+// loses the first Response, and duplicates and reorders all other packets. It checks that the
+// retransmitted, duplicated and stale Requests yield a single server connection, which opens.
+func TestLossyHandshake(t *testing.T) {
+	env, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "lossyhandshake")
+	alink, dlink := dccp.NewChanPipe()
+	am := dccp.NewMux(&flakyLink{Link: alink, drop: 1})
+	dm := dccp.NewMux(&flakyLink{Link: dlink})
+	ccid := ccid3.CCID3{}
+
+	// Accept all flows, so that a spurious second one would be noticed
+	accepted := make(chan *dccp.Conn, 2)
+	go func() {
+		for {
+			f, err := am.Accept()
+			if err != nil {
+				break
+			}
+			slog := dccp.NewAmb("server", env)
+			hc := dccp.NewHeaderConn(f)
+			accepted <- dccp.NewConnServer(env, slog, hc, ccid.NewSender(env, slog), ccid.NewReceiver(env, slog))
+		}
+		close(accepted)
+	}()
+
+	f, err := dm.Dial(nil)
+	if err != nil {
+		t.Fatalf("dial (%s)", err)
+	}
+	clog := dccp.NewAmb("client", env)
+	clientConn := dccp.NewConnClient(env, clog, dccp.NewHeaderConn(f), ccid.NewSender(env, clog), ccid.NewReceiver(env, clog), 0)
+	serverConn := <-accepted
+
+	payload := []byte{1, 2, 3}
+	if err := clientConn.Write(payload); err != nil {
+		t.Fatalf("client write (%s)", err)
+	}
+	if p, err := serverConn.Read(); err != nil || len(p) != len(payload) {
+		t.Errorf("server read %v (%v)", p, err)
+	}
+	if err := serverConn.Write(payload); err != nil {
+		t.Fatalf("server write (%s)", err)
+	}
+	if p, err := clientConn.Read(); err != nil || len(p) != len(payload) {
+		t.Errorf("client read %v (%v)", p, err)
+	}
+
+	clientConn.Abort()
+	serverConn.Abort()
+	env.NewGoJoin("end-of-test", clientConn.Joiner(), serverConn.Joiner()).Join()
+	dm.Close()
+	am.Close()
+	for c := range accepted {
+		t.Errorf("duplicate Request created a second server connection")
+		c.Abort()
+	}
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+}
+
+// TestMuxConnGoroutines checks that Conns over a Mux read on the goroutine of the Mux, and
+// run no goroutines of their own besides their write loops
+func TestMuxConnGoroutines(t *testing.T) {
+	env, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "muxgoroutines")
+	alink, dlink := dccp.NewChanPipe()
+	am, dm := dccp.NewMux(alink), dccp.NewMux(dlink)
+	ccid := ccid3.CCID3{}
+
+	const n = 4
+	accepted := make(chan *dccp.Conn, n)
+	go func() {
+		for i := 0; i < n; i++ {
+			f, err := am.Accept()
+			if err != nil {
+				break
+			}
+			slog := dccp.NewAmb("server", env)
+			accepted <- dccp.NewConnServer(env, slog, dccp.NewHeaderConn(f), ccid.NewSender(env, slog), ccid.NewReceiver(env, slog))
+		}
+	}()
+	var conns []*dccp.Conn
+	payload := []byte{1, 2, 3}
+	for i := 0; i < n; i++ {
+		f, err := dm.Dial(nil)
+		if err != nil {
+			t.Fatalf("dial (%s)", err)
+		}
+		clog := dccp.NewAmb("client", env)
+		clientConn := dccp.NewConnClient(env, clog, dccp.NewHeaderConn(f), ccid.NewSender(env, clog), ccid.NewReceiver(env, clog), 0)
+		if err := clientConn.Write(payload); err != nil {
+			t.Fatalf("client write (%s)", err)
+		}
+		serverConn := <-accepted
+		if p, err := serverConn.Read(); err != nil || len(p) != len(payload) {
+			t.Errorf("server read %v (%v)", p, err)
+		}
+		conns = append(conns, clientConn, serverConn)
+	}
+
+	var loops int
+	for _, g := range env.Joiner().(*dccp.GoJoin).Pending() {
+		switch s := g.String(); {
+		case strings.Contains(s, "readLoop"):
+			t.Errorf("read loop running, %s", s)
+		case strings.Contains(s, "Conn"):
+			loops++
+		}
+	}
+	if loops != len(conns) {
+		t.Errorf("%d goroutines for %d connections", loops, len(conns))
+	}
+
+	for _, c := range conns {
+		c.Abort()
+	}
+	for _, c := range conns {
+		c.Joiner().Join()
+	}
+	dm.Close()
+	am.Close()
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+}
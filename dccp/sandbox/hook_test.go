@@ -0,0 +1,73 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"sync"
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// TestPacketHooks checks that the packet hooks of a Conn see the packets it sends and
+// receives, and that a hook can enforce a policy by aborting the connection
+func TestPacketHooks(t *testing.T) {
+	env, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "hooks")
+	clientConn, serverConn, _, _ := NewFixedClientServerPipe(env)
+
+	var lk sync.Mutex
+	var sent, received []*dccp.Header
+	clientConn.OnPacketSent(func(p dccp.PacketView) {
+		lk.Lock()
+		defer lk.Unlock()
+		sent = append(sent, p.Copy())
+	})
+	serverConn.OnPacketReceived(func(p dccp.PacketView) {
+		lk.Lock()
+		received = append(received, p.Copy())
+		lk.Unlock()
+		// The server does not accept messages of more than 100 bytes
+		if p.Type() == dccp.DataAck && p.DataLen() > 100 {
+			serverConn.Abort()
+		}
+	})
+
+	for i := 0; i < 5; i++ {
+		if err := clientConn.Write(make([]byte, 10)); err != nil {
+			t.Fatalf("client write (%s)", err)
+		}
+		if _, err := serverConn.Read(); err != nil {
+			t.Fatalf("server read (%s)", err)
+		}
+	}
+	clientConn.Write(make([]byte, 200))
+	if _, err := serverConn.Read(); err == nil {
+		t.Errorf("server read oversize message")
+	}
+
+	lk.Lock()
+	if len(sent) == 0 || sent[0].Type != dccp.Request {
+		t.Errorf("client sent %d packets, the first not a Request", len(sent))
+	}
+	if len(received) == 0 || received[0].Type != dccp.Request {
+		t.Errorf("server received %d packets, the first not a Request", len(received))
+	}
+	var data int
+	for _, h := range received {
+		if h.Type == dccp.DataAck || h.Type == dccp.Data {
+			data++
+		}
+	}
+	if data != 6 {
+		t.Errorf("server received %d data packets, expected 6", data)
+	}
+	lk.Unlock()
+
+	clientConn.Abort()
+	env.NewGoJoin("end-of-test", clientConn.Joiner(), serverConn.Joiner()).Join()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Server and client done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+}
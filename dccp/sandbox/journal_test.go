@@ -0,0 +1,77 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"bytes"
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// TestJournalReplay records the journal of a client that sends a few messages and closes, and
+// replays it against a fresh client. The replay must open the connection with the recorded
+// ISS, and send the recorded messages in the same order.
+func TestJournalReplay(t *testing.T) {
+	env, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "journal")
+	clientConn, serverConn, _, _ := NewFixedClientServerPipe(env)
+	journal := clientConn.StartJournal()
+	for i := 0; i < 10; i++ {
+		if err := clientConn.Write([]byte{byte(i)}); err != nil {
+			t.Fatalf("client write (%s)", err)
+		}
+		if _, err := serverConn.Read(); err != nil {
+			t.Fatalf("server read (%s)", err)
+		}
+	}
+	clientConn.Flush()
+	clientConn.Close()
+	if _, err := serverConn.Read(); err == nil {
+		t.Errorf("server read after close")
+	}
+	clientConn.Abort()
+	serverConn.Abort()
+	env.NewGoJoin("end-of-test", clientConn.Joiner(), serverConn.Joiner()).Join()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Server and client done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+
+	var buf bytes.Buffer
+	if err := journal.Save(&buf); err != nil {
+		t.Fatalf("save (%s)", err)
+	}
+	j, err := dccp.LoadJournal(&buf)
+	if err != nil {
+		t.Fatalf("load (%s)", err)
+	}
+	if j.ISS == 0 || j.Server || len(j.Entries) != journal.Len() {
+		t.Fatalf("journal of %d entries loaded as %d, ISS %d", journal.Len(), len(j.Entries), j.ISS)
+	}
+
+	renv, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "journal-replay")
+	amb := dccp.NewAmb("replay", renv)
+	fixed := dccp.CCFixed{Every: 1e6}
+	run := dccp.Replay(renv, amb, j, fixed.NewSender(renv, amb), fixed.NewReceiver(renv, amb))
+	run.Wait()
+	run.Conn.Abort()
+	renv.NewGoJoin("end-of-replay", run.Conn.Joiner()).Join()
+	if err := renv.Close(); err != nil {
+		t.Errorf("error closing replay runtime (%s)", err)
+	}
+
+	sent := run.Sent()
+	var data []byte
+	for _, h := range sent {
+		if h.Type == dccp.Data || h.Type == dccp.DataAck {
+			data = append(data, h.Data...)
+		}
+	}
+	if !bytes.Equal(data, []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}) {
+		t.Errorf("replay sent messages %v", data)
+	}
+	if d := run.Divergence(); d >= 0 && d < 3 {
+		t.Errorf("replay departs from the recording at packet %d", d)
+	}
+}
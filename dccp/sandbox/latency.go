@@ -38,6 +38,11 @@ func (x *latencyQueue) DeleteMin() *pipeHeader {
 	return ph
 }
 
+// Len returns the number of items in the queue
+func (x *latencyQueue) Len() int {
+	return len(x.queue)
+}
+
 // TimeToMin returns the duration of time from now until the timestamp of the
 // earliest item in the queue
 func (x *latencyQueue) TimeToMin() (dur int64, present bool) {
@@ -0,0 +1,144 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"sync"
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+	"github.com/petar/GoDCCP/dccp/ledbat"
+)
+
+// TestLEDBAT checks that the scavenger congestion control fills a 50 KBps link with an
+// unbounded buffer on its own, while holding the queueing delay near ledbat.Target. The path
+// takes about 80ms, with the transmission and the delayed Acks, so the round-trip time settles
+// near 180ms. Now and then a burst of the window overruns the pipe, and the halving of the
+// window on the loss drains the queue for a while.
+// It runs on virtual time, so that the load of the machine does not add to the delays that
+// LEDBAT measures.
+func TestLEDBAT(t *testing.T) {
+	NewScenario("ledbat").
+		CCID(ledbat.LEDBAT{}).
+		Virtual().
+		Payload(1000).
+		At(0, func(r *ScenarioRun) {
+			r.ClientToServer.SetWriteLatency(25e6)
+			r.ServerToClient.SetWriteLatency(25e6)
+		}).
+		BandwidthAfter(0, 50e3, 0).
+		SampleRTT(100e6).
+		ClientSends(2000, 10e6).
+		ExpectRate(5e9, 20e9, 46, 50).
+		ExpectRTT(5e9, 20e9, 180e6, 0.15).
+		ExpectNoReset().
+		Run(t)
+}
+
+const (
+	yieldBandwidth = 50e3 // Capacity of the shared link in bytes per second
+	yieldLatency   = 25e6 // One-way latency of each flow
+	yieldSpacing   = 40e6 // Time between the messages of the foreground flow
+	yieldStart     = 10e9 // Time when the foreground flow starts
+	yieldMeasure   = 20e9 // Time when throughput measurement starts
+	yieldDuration  = 40e9 // Duration of the test
+	yieldPayload   = 1000 // Size of the messages of both flows
+)
+
+// TestLEDBATYields runs a bulk transfer over LEDBAT across a shared bottleneck with an unbounded
+// buffer, and starts a foreground flow of half the capacity of the link after a while. The
+// foreground flow does not react to congestion at all, so it keeps its rate only if LEDBAT
+// yields the capacity that it needs, and its messages arrive in time only if LEDBAT keeps the
+// queue short. It runs on virtual time, so that the load of the machine does not slow down the
+// foreground flow or add to the delays that LEDBAT measures.
+func TestLEDBATYields(t *testing.T) {
+	Virtual(t, testLEDBATYields)
+}
+
+func testLEDBATYields(t *testing.T, tm dccp.Time) {
+	env, _ := NewEnvTime(tm, "ledbat-yields")
+	link := NewBottleneck(yieldBandwidth, 0)
+	start := env.Now()
+
+	var (
+		lk         sync.Mutex
+		received   [2]int // Messages received by each flow after yieldMeasure
+		foreground DeliveryRecorder
+		joiners    []dccp.Joiner
+		conns      []*dccp.Conn
+	)
+	done := make(chan int)
+	for i, ccid := range []dccp.CCID{ ledbat.LEDBAT{}, dccp.CCUnlimited{} } {
+		i := i
+		clientConn, serverConn, clientToServer, serverToClient := NewFlowPipe(env, []string{"background", "foreground"}[i], ccid)
+		clientToServer.SetWriteRate(1e9, 1e6)
+		clientToServer.SetWriteBottleneck(link)
+		clientToServer.SetWriteLatency(yieldLatency)
+		serverToClient.SetWriteRate(1e9, 1e6)
+		serverToClient.SetWriteLatency(yieldLatency)
+		conns = append(conns, clientConn, serverConn)
+		joiners = append(joiners, clientConn.Joiner(), serverConn.Joiner())
+
+		env.Go(func() {
+			for {
+				data, err := serverConn.Read()
+				if err != nil {
+					return
+				}
+				if env.Now()-start < yieldMeasure {
+					continue
+				}
+				lk.Lock()
+				received[i]++
+				if i == 1 {
+					foreground.Add(data, env.Now())
+				}
+				lk.Unlock()
+			}
+		}, "yield server")
+		env.Go(func() {
+			if i == 1 {
+				env.Sleep(yieldStart)
+			}
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				// The Conn holds on to the buffer until the message leaves
+				buf := make([]byte, yieldPayload)
+				Stamp(env, buf)
+				if err := clientConn.Write(buf); err != nil {
+					return
+				}
+				if i == 1 {
+					env.Sleep(yieldSpacing)
+				}
+			}
+		}, "yield client")
+	}
+
+	env.Sleep(yieldDuration)
+	close(done)
+	for _, c := range conns {
+		c.Abort()
+	}
+	env.NewGoJoin("end-of-test", joiners...).Join()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Servers and clients done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+
+	// The foreground flow offers 25 messages per second
+	window := float64(yieldDuration-yieldMeasure) / 1e9
+	background, fg := float64(received[0])/window, float64(received[1])/window
+	if fg < 24 {
+		t.Errorf("foreground rate %.1f/s, background rate %.1f/s", fg, background)
+	}
+	if background < 20 || background > 30 {
+		t.Errorf("background rate %.1f/s, expecting the remaining capacity", background)
+	}
+	foreground.CheckPercentile(t, 95, yieldLatency+ledbat.Target+100e6)
+}
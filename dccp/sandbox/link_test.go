@@ -0,0 +1,170 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// TestAsymmetricLink checks that the two directions of a pipe deliver and lose packets
+// according to their own bandwidth, latency and loss settings. It runs on virtual time, so
+// that the delivery times are exact.
+func TestAsymmetricLink(t *testing.T) {
+	Virtual(t, testAsymmetricLink)
+}
+
+func testAsymmetricLink(t *testing.T, tm dccp.Time) {
+	env := dccp.NewEnvTime(tm, nil)
+	env.SetLeakGrace(leakGrace)
+	defer closeEnv(t, env)
+	a, b, _ := NewPipe(env, dccp.NoLogging, "a", "b")
+
+	// Direction a—>b is slow and far, direction b—>a is fast and near
+	a.SetWriteBandwidth(100e3, 0)
+	a.SetWriteLatency(100e6)
+	b.SetWriteBandwidth(10e6, 0)
+	b.SetWriteLatency(10e6)
+
+	payload := make([]byte, 1000)
+	ab, ba := measureDelivery(t, env, a, b, payload), measureDelivery(t, env, b, a, payload)
+
+	// About 1000 bytes at 100 KBps takes 10ms, and at 10 MBps it takes 0.1ms
+	if ab < 110e6 || ab > 115e6 {
+		t.Errorf("a—>b delivery took %d ns", ab)
+	}
+	if ba < 10e6 || ba > 11e6 {
+		t.Errorf("b—>a delivery took %d ns", ba)
+	}
+
+	// Direction a—>b also loses half of its packets, while direction b—>a loses none
+	a.SetWriteLoss(0.5)
+	const n = 100
+	var nab, nba int
+	for i := 0; i < n; i++ {
+		if _, ok := deliver(t, env, a, b, payload); ok {
+			nab++
+		}
+		if _, ok := deliver(t, env, b, a, payload); ok {
+			nba++
+		}
+	}
+	if nab < 35 || nab > 65 {
+		t.Errorf("a—>b delivered %d of %d packets, expecting about half", nab, n)
+	}
+	if nba != n {
+		t.Errorf("b—>a delivered %d of %d packets, expecting all", nba, n)
+	}
+}
+
+// closeEnv closes env, which waits for the read timers of the pipes to expire, since they
+// must not outlive a run on virtual time
+func closeEnv(t *testing.T, env *dccp.Env) {
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+}
+
+func measureDelivery(t *testing.T, env *dccp.Env, w, r *headerHalfPipe, payload []byte) int64 {
+	d, ok := deliver(t, env, w, r, payload)
+	if !ok {
+		t.Fatalf("packet not delivered")
+	}
+	return d
+}
+
+// deliver writes a packet with payload to w and reads it from r. It returns the time that
+// the delivery took, or false if the packet did not arrive within a second.
+func deliver(t *testing.T, env *dccp.Env, w, r *headerHalfPipe, payload []byte) (int64, bool) {
+	h := &dccp.Header{}
+	h.InitDataHeader(payload)
+	t0 := env.Now()
+	if err := w.Write(h); err != nil {
+		t.Fatalf("write (%s)", err)
+	}
+	// Read returns ErrTimeout when it wakes up for a queued packet, so keep reading
+	for env.Now()-t0 < 1e9 {
+		r.SetReadExpire(1e9 - (env.Now() - t0))
+		_, err := r.Read()
+		if err == nil {
+			return env.Now() - t0, true
+		}
+		if err != dccp.ErrTimeout {
+			t.Fatalf("read (%s)", err)
+		}
+	}
+	return 0, false
+}
+
+// TestSharedBottleneck checks that packets written to two pipes that share a bottleneck wait
+// for one another. It runs on virtual time, so that the delivery time is exact.
+func TestSharedBottleneck(t *testing.T) {
+	Virtual(t, testSharedBottleneck)
+}
+
+func testSharedBottleneck(t *testing.T, tm dccp.Time) {
+	env := dccp.NewEnvTime(tm, nil)
+	env.SetLeakGrace(leakGrace)
+	defer closeEnv(t, env)
+	a1, _, _ := NewPipe(env, dccp.NoLogging, "a1", "b1")
+	a2, b2, _ := NewPipe(env, dccp.NoLogging, "a2", "b2")
+	link := NewBottleneck(100e3, 0)
+	a1.SetWriteBottleneck(link)
+	a2.SetWriteBottleneck(link)
+
+	// The packet written to the second pipe leaves the link after the one written to the first
+	h := &dccp.Header{}
+	h.InitDataHeader(make([]byte, 1000))
+	if err := a1.Write(h); err != nil {
+		t.Fatalf("write (%s)", err)
+	}
+	if d := measureDelivery(t, env, a2, b2, make([]byte, 1000)); d < 20e6 || d > 21e6 {
+		t.Errorf("delivery behind another flow took %d ns", d)
+	}
+}
+
+// TestProfiles checks the capacities of the step, ramp and oscillating profiles
+func TestProfiles(t *testing.T) {
+	step := StepProfile(ProfileStep{ 1e9, 10e3 }, ProfileStep{ 2e9, 40e3 })
+	ramp := RampProfile(10e3, 30e3, 1e9, 2e9)
+	wave := OscillateProfile(20e3, 10e3, 4e9)
+	for _, c := range []struct {
+		p    Profile
+		t    int64
+		want int64
+	}{
+		{ step, 0, 0 }, { step, 1e9, 10e3 }, { step, 1999e6, 10e3 }, { step, 5e9, 40e3 },
+		{ ramp, 0, 10e3 }, { ramp, 2e9, 20e3 }, { ramp, 3e9, 30e3 }, { ramp, 9e9, 30e3 },
+		{ wave, 0, 20e3 }, { wave, 1e9, 30e3 }, { wave, 3e9, 10e3 }, { wave, 5e9, 30e3 },
+	} {
+		if b := c.p(c.t); b != c.want {
+			t.Errorf("profile %d at %dms, expected %d", b, c.t/1e6, c.want)
+		}
+	}
+}
+
+// TestProfileLink checks that a pipe delivers packets at the capacity of its profile at the
+// time of writing. It runs on virtual time, so that the delivery times are exact.
+func TestProfileLink(t *testing.T) {
+	Virtual(t, testProfileLink)
+}
+
+func testProfileLink(t *testing.T, tm dccp.Time) {
+	env := dccp.NewEnvTime(tm, nil)
+	env.SetLeakGrace(leakGrace)
+	defer closeEnv(t, env)
+	a, b, _ := NewPipe(env, dccp.NoLogging, "a", "b")
+	a.SetWriteProfile(StepProfile(ProfileStep{ 0, 100e3 }, ProfileStep{ 100e6, 10e6 }), 0)
+
+	// About 1000 bytes at 100 KBps takes 10ms, and at 10 MBps it takes 0.1ms
+	payload := make([]byte, 1000)
+	if d := measureDelivery(t, env, a, b, payload); d < 10e6 || d > 11e6 {
+		t.Errorf("delivery at low capacity took %d ns", d)
+	}
+	env.Sleep(100e6)
+	if d := measureDelivery(t, env, a, b, payload); d > 1e6 {
+		t.Errorf("delivery at high capacity took %d ns", d)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+	"github.com/petar/GoDCCP/dccp/ccid3"
+)
+
+// TestMandatory checks that a connection is reset when one endpoint marks an option Mandatory
+// that the other does not understand. The client runs CCID3, whose receiver sends the Receive
+// Rate option, while the server runs a fixed-rate CCID that does not process it. The server's
+// CCIDs pass for CCID3, so that CCID negotiation leaves them in place.
+func TestMandatory(t *testing.T) {
+	env, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "mandatory")
+	llog := dccp.NewAmb("line", env)
+	hca, hcb, _ := NewPipe(env, llog, "client", "server")
+	ccid := ccid3.CCID3{}
+	fixed := dccp.CCFixed{Every: 1e6}
+
+	clog := dccp.NewAmb("client", env)
+	clientConn := dccp.NewConnClient(env, clog, hca, ccid.NewSender(env, clog), ccid.NewReceiver(env, clog), 0)
+	clientConn.SetMandatory(ccid3.OptionReceiveRate, true)
+	slog := dccp.NewAmb("server", env)
+	serverConn := dccp.NewConnServer(env, slog, hcb, disguisedSender{fixed.NewSender(env, slog)}, disguisedReceiver{fixed.NewReceiver(env, slog)})
+
+	// The server's data makes the client send Acks with Receive Rate options
+	for i := 0; i < 10; i++ {
+		if err := serverConn.Write([]byte{byte(i)}); err != nil {
+			break
+		}
+		env.Sleep(100e6)
+	}
+	env.Sleep(2e9)
+	if _, err := serverConn.Read(); err != dccp.ErrAbort {
+		t.Errorf("server read gave %v, expected ErrAbort", err)
+	}
+	if err := serverConn.Error(); err != dccp.ErrAbort {
+		t.Errorf("server error %v, expected ErrAbort", err)
+	}
+
+	clientConn.Abort()
+	serverConn.Abort()
+	env.NewGoJoin("end-of-test", clientConn.Joiner(), serverConn.Joiner()).Join()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Server and client done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+}
+
+// disguisedSender and disguisedReceiver report CCID3 in place of the CCID of the congestion
+// control they wrap
+type disguisedSender struct {
+	dccp.SenderCongestionControl
+}
+
+func (disguisedSender) GetID() byte { return dccp.CCID3 }
+
+type disguisedReceiver struct {
+	dccp.ReceiverCongestionControl
+}
+
+func (disguisedReceiver) GetID() byte { return dccp.CCID3 }
@@ -0,0 +1,84 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"net"
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+	"github.com/petar/GoDCCP/dccp/ccid3"
+)
+
+// TestMigrate connects a client to a server through a pair of Muxes over UDP, and moves the
+// client to a new local port twice. The first port is closed by the second migration, so the
+// data exchanged after it shows that the server followed the client.
+func TestMigrate(t *testing.T) {
+	env, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "migrate")
+	loopback := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}
+	alink, err := dccp.BindUDPLink("udp", loopback)
+	if err != nil {
+		t.Fatalf("bind (%s)", err)
+	}
+	dlink, err := dccp.BindUDPLink("udp", loopback)
+	if err != nil {
+		t.Fatalf("bind (%s)", err)
+	}
+	am, dm := dccp.NewMux(alink), dccp.NewMux(dlink)
+	ccid := ccid3.CCID3{}
+
+	accepted := make(chan *dccp.Conn, 1)
+	go func() {
+		f, err := am.Accept()
+		if err != nil {
+			close(accepted)
+			return
+		}
+		slog := dccp.NewAmb("server", env)
+		accepted <- dccp.NewConnServer(env, slog, dccp.NewHeaderConn(f), ccid.NewSender(env, slog), ccid.NewReceiver(env, slog))
+	}()
+
+	f, err := dm.Dial(alink.LocalAddr())
+	if err != nil {
+		t.Fatalf("dial (%s)", err)
+	}
+	clog := dccp.NewAmb("client", env)
+	clientConn := dccp.NewConnClient(env, clog, dccp.NewHeaderConn(f), ccid.NewSender(env, clog), ccid.NewReceiver(env, clog), 0)
+	serverConn := <-accepted
+	if serverConn == nil {
+		t.Fatalf("accept failed")
+	}
+
+	exchange := func(round byte) {
+		if err := clientConn.Write([]byte{round}); err != nil {
+			t.Fatalf("client write (%s)", err)
+		}
+		if p, err := serverConn.Read(); err != nil || len(p) != 1 || p[0] != round {
+			t.Fatalf("round %d: server read %v (%v)", round, p, err)
+		}
+		if err := serverConn.Write([]byte{round}); err != nil {
+			t.Fatalf("server write (%s)", err)
+		}
+		if p, err := clientConn.Read(); err != nil || len(p) != 1 || p[0] != round {
+			t.Fatalf("round %d: client read %v (%v)", round, p, err)
+		}
+	}
+	exchange(0)
+	for round := byte(1); round <= 2; round++ {
+		if err := clientConn.Migrate(loopback); err != nil {
+			t.Fatalf("migrate (%s)", err)
+		}
+		exchange(round)
+	}
+
+	clientConn.Abort()
+	serverConn.Abort()
+	env.NewGoJoin("end-of-test", clientConn.Joiner(), serverConn.Joiner()).Join()
+	dm.Close()
+	am.Close()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Server and client done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+}
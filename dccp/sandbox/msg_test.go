@@ -0,0 +1,284 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// TestMsg checks that the metadata passed to WriteMsg takes effect and that ReadMsg returns
+// the metadata of the received packets
+func TestMsg(t *testing.T) {
+	env, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "msg")
+	clientConn, serverConn, _, _ := NewClientServerPipe(env)
+	payload := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+	if err := clientConn.WriteMsg(payload, dccp.WriteMeta{CsCov: 4}); err != dccp.ErrCsCov {
+		t.Errorf("coverage beyond the message gave %v, expected ErrCsCov", err)
+	}
+	if err := clientConn.WriteMsg(payload, dccp.WriteMeta{CsCov: dccp.CsCov4}); err != nil {
+		t.Fatalf("client write (%s)", err)
+	}
+	p, meta, err := serverConn.ReadMsg()
+	if err != nil || !bytes.Equal(p, payload) {
+		t.Fatalf("server read %v (%v)", p, err)
+	}
+	if meta.CsCov != dccp.CsCov4 || meta.SeqNo == 0 || meta.Time == 0 {
+		t.Errorf("unexpected receive metadata %+v", meta)
+	}
+
+	// A message past its deadline is dropped and reported, while the one that follows it is
+	// delivered
+	late := dccp.WriteMeta{Deadline: env.Now() - 1}
+	if err := clientConn.WriteMsg([]byte{1}, late); err != nil {
+		t.Fatalf("client write (%s)", err)
+	}
+	if err := clientConn.WriteMsg([]byte{2}, dccp.WriteMeta{}); err != nil {
+		t.Fatalf("client write (%s)", err)
+	}
+	if p, next, err := serverConn.ReadMsg(); err != nil || len(p) != 1 || p[0] != 2 {
+		t.Errorf("server read %v (%v), expected the message without deadline", p, err)
+	} else if next.SeqNo <= meta.SeqNo {
+		t.Errorf("sequence number %d does not follow %d", next.SeqNo, meta.SeqNo)
+	}
+	select {
+	case r := <-clientConn.Drops():
+		if r.Reason != dccp.DropExpired || len(r.Data) != 1 || r.Data[0] != 1 || r.Meta != late {
+			t.Errorf("unexpected drop report %+v", r)
+		}
+	default:
+		t.Errorf("late message not reported")
+	}
+
+	clientConn.Abort()
+	serverConn.Abort()
+	env.NewGoJoin("end-of-test", clientConn.Joiner(), serverConn.Joiner()).Join()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Server and client done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+}
+
+// TestDrops checks that messages dropped by the queue policy of the sender, and messages
+// dropped by the receiver because its application does not read, are reported on the Drops
+// channel of the sender
+func TestDrops(t *testing.T) {
+	Virtual(t, testDrops)
+}
+
+func testDrops(t *testing.T, tm dccp.Time) {
+	env, _ := NewEnvTime(tm, "drops")
+	clientConn, serverConn, _, _ := NewClientServerPipe(env)
+	clientConn.SetQueuePolicy(dccp.QueueDropOldest{})
+
+	reported := make(map[dccp.DropReason]int)
+	stop := make(chan int)
+	env.Go(func() {
+		for {
+			select {
+			case r := <-clientConn.Drops():
+				reported[r.Reason]++
+				if r.Reason == dccp.DropRemote && r.State != dccp.DropStateReceiveBuffer {
+					t.Errorf("unexpected drop state %d", r.State)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}, "test drops")
+
+	// The server does not read, so that its read queue fills up and further data is dropped
+	const n = 80
+	for i := 0; i < n; i++ {
+		if err := clientConn.Write([]byte{byte(i)}); err != nil {
+			t.Fatalf("client write (%s)", err)
+		}
+		env.Sleep(300e6)
+	}
+	env.Sleep(2e9)
+	stop <- 1
+
+	if reported[dccp.DropOverflow] == 0 {
+		t.Errorf("no overflow drops reported")
+	}
+	if reported[dccp.DropRemote] == 0 {
+		t.Errorf("no remote drops reported")
+	}
+	if reported[dccp.DropExpired] > 0 {
+		t.Errorf("unexpected expiry reports")
+	}
+
+	clientConn.Abort()
+	serverConn.Abort()
+	env.NewGoJoin("end-of-test", clientConn.Joiner(), serverConn.Joiner()).Join()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Server and client done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+}
+
+// TestHalfClose checks that CloseWrite and CloseRead shut down one direction of the
+// connection, while data keeps flowing in the other one
+func TestHalfClose(t *testing.T) {
+	env, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "halfclose")
+	clientConn, serverConn, _, _ := NewClientServerPipe(env)
+
+	if err := clientConn.Write([]byte{1}); err != nil {
+		t.Fatalf("client write (%s)", err)
+	}
+	if err := clientConn.CloseWrite(); err != nil {
+		t.Fatalf("client close write (%s)", err)
+	}
+	if err := clientConn.Write([]byte{2}); err != dccp.ErrBad {
+		t.Errorf("client write after close write gave %v, expected ErrBad", err)
+	}
+	if p, err := serverConn.Read(); err != nil || len(p) != 1 || p[0] != 1 {
+		t.Fatalf("server read %v (%v)", p, err)
+	}
+
+	// The direction from the server to the client is still open
+	if err := serverConn.Write([]byte{3}); err != nil {
+		t.Fatalf("server write (%s)", err)
+	}
+	if p, err := clientConn.Read(); err != nil || len(p) != 1 || p[0] != 3 {
+		t.Fatalf("client read %v (%v)", p, err)
+	}
+
+	// Data written after the client stopped reading is dropped and reported to the server
+	if err := clientConn.CloseRead(); err != nil {
+		t.Fatalf("client close read (%s)", err)
+	}
+	if _, err := clientConn.Read(); err != dccp.ErrEOF {
+		t.Errorf("client read after close read gave %v, expected ErrEOF", err)
+	}
+	if err := serverConn.Write([]byte{4}); err != nil {
+		t.Fatalf("server write (%s)", err)
+	}
+	env.Sleep(2e9)
+	select {
+	case r := <-serverConn.Drops():
+		if r.Reason != dccp.DropRemote || r.State != dccp.DropStateNotListening {
+			t.Errorf("unexpected drop report %+v", r)
+		}
+	default:
+		t.Errorf("data to a closed reader not reported")
+	}
+
+	clientConn.Close()
+	if _, err := serverConn.Read(); err != dccp.ErrEOF {
+		t.Errorf("server read after close gave %v, expected ErrEOF", err)
+	}
+	env.NewGoJoin("end-of-test", clientConn.Joiner(), serverConn.Joiner()).Join()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Server and client done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+}
+
+// TestSlowReceiver checks that a receiver whose application does not read sends Slow Receiver
+// options once its read queue passes the high-water mark, and drops data beyond its limit
+func TestSlowReceiver(t *testing.T) {
+	env, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "slowreceiver")
+	clientConn, serverConn, _, serverToClient := NewFixedClientServerPipe(env)
+	if err := serverConn.SetReadQueue(dccp.READ_QUEUE_MAX+1, 0); err != dccp.ErrBad {
+		t.Errorf("read queue beyond maximum, expected ErrBad, got %v", err)
+	}
+	if err := serverConn.SetReadQueue(4, 2); err != nil {
+		t.Fatalf("set read queue (%s)", err)
+	}
+	var slowLk sync.Mutex
+	slow := 0
+	serverToClient.SetWriteDrop(func(h *dccp.Header) bool {
+		for _, o := range h.GetOptions() {
+			if o.Type == dccp.OptionSlowReceiver {
+				slowLk.Lock()
+				slow++
+				slowLk.Unlock()
+			}
+		}
+		return false
+	})
+
+	// The server does not read until all data is sent
+	const n = 10
+	for i := 0; i < n; i++ {
+		if err := clientConn.Write([]byte{byte(i)}); err != nil {
+			t.Fatalf("client write (%s)", err)
+		}
+		env.Sleep(100e6)
+	}
+	env.Sleep(1e9)
+	slowLk.Lock()
+	if slow == 0 {
+		t.Errorf("no Slow Receiver options sent")
+	}
+	slowLk.Unlock()
+	for i := 0; i < 4; i++ {
+		if _, err := serverConn.Read(); err != nil {
+			t.Fatalf("server read (%s)", err)
+		}
+	}
+
+	clientConn.Abort()
+	serverConn.Abort()
+	if _, err := serverConn.Read(); err == nil {
+		t.Errorf("server read more than its read queue limit")
+	}
+	env.NewGoJoin("end-of-test", clientConn.Joiner(), serverConn.Joiner()).Join()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Server and client done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+}
+
+// TestTooLarge checks that Write refuses blocks that exceed the maximum packet size, and that
+// the limit follows the MTU of the link
+func TestTooLarge(t *testing.T) {
+	env, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "toolarge")
+	clientConn, serverConn, clientToServer, _ := NewFixedClientServerPipe(env)
+
+	max := clientConn.GetMTU()
+	err := clientConn.Write(make([]byte, max+1))
+	if e, ok := err.(dccp.TooLargeError); !ok || e.Max != max {
+		t.Errorf("oversize write returned %v, expected TooLargeError with max %d", err, max)
+	}
+	if !errors.Is(err, dccp.ErrTooLarge) {
+		t.Errorf("oversize write returned %v, which is not ErrTooLarge", err)
+	}
+	if err := clientConn.Write(make([]byte, max)); err != nil {
+		t.Fatalf("client write (%s)", err)
+	}
+	if b, err := serverConn.Read(); err != nil || len(b) != max {
+		t.Fatalf("server read %d bytes (%v), expected %d", len(b), err, max)
+	}
+	// Padding stops at the maximum packet size, rather than fail the message
+	if err := clientConn.WriteMsg(make([]byte, max), dccp.WriteMeta{ PadTo: 4096 }); err != nil {
+		t.Fatalf("client padded write (%s)", err)
+	}
+	if b, err := serverConn.Read(); err != nil || len(b) != max {
+		t.Fatalf("server read %d padded bytes (%v), expected %d", len(b), err, max)
+	}
+
+	clientToServer.SetMTU(576)
+	if m := clientConn.GetMTU(); m >= 576 {
+		t.Errorf("MTU %d after PMTU drop to 576", m)
+	}
+	err = clientConn.WriteMsg(make([]byte, max), dccp.WriteMeta{})
+	if e, ok := err.(dccp.TooLargeError); !ok || e.Max != clientConn.GetMTU() {
+		t.Errorf("oversize write returned %v, expected TooLargeError with max %d", err, clientConn.GetMTU())
+	}
+
+	clientConn.Abort()
+	serverConn.Abort()
+	env.NewGoJoin("end-of-test", clientConn.Joiner(), serverConn.Joiner()).Join()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Server and client done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+}
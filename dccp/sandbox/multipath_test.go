@@ -0,0 +1,73 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+	"github.com/petar/GoDCCP/dccp/multipath"
+)
+
+// TestMultipath bonds two subflows, each over a pipe of its own, and sends messages across
+// them in turn. It checks that the messages are read in the order they were written.
+func TestMultipath(t *testing.T) {
+	env, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "multipath")
+	llog := dccp.NewAmb("line", env)
+	var clientSubflows, serverSubflows []*dccp.Conn
+	for _, name := range []string{"a", "b"} {
+		hca, hcb, _ := NewPipe(env, llog, "client-" + name, "server-" + name)
+		clientSubflows = append(clientSubflows, multipath.NewClientSubflow(env, dccp.NewAmb("client-" + name, env), hca, 0))
+		serverSubflows = append(serverSubflows, multipath.NewServerSubflow(env, dccp.NewAmb("server-" + name, env), hcb))
+	}
+	client := multipath.New(env, &multipath.RoundRobin{}, clientSubflows...)
+	server := multipath.New(env, nil, serverSubflows...)
+
+	const n = 40
+	env.Go(func() {
+		for i := 0; i < n; i++ {
+			if err := client.Write([]byte{byte(i)}); err != nil {
+				t.Errorf("client write (%s)", err)
+				break
+			}
+			env.Sleep(100e6)
+		}
+		if err := client.Close(); err != nil {
+			t.Errorf("client close (%s)", err)
+		}
+	}, "test writer")
+
+	last, count := -1, 0
+	for {
+		p, err := server.Read()
+		if err != nil {
+			if err != dccp.ErrEOF {
+				t.Errorf("server read (%s)", err)
+			}
+			break
+		}
+		if len(p) != 1 || int(p[0]) <= last {
+			t.Fatalf("read %v after %d", p, last)
+		}
+		last = int(p[0])
+		count++
+	}
+	if count < n/2 || int64(count)+server.Lost() != int64(last+1) {
+		t.Errorf("read %d messages and lost %d, up to %d", count, server.Lost(), last)
+	}
+	if count < n {
+		t.Logf("read %d messages out of %d", count, n)
+	}
+
+	var joiners []dccp.Joiner
+	for _, c := range append(clientSubflows, serverSubflows...) {
+		c.Abort()
+		joiners = append(joiners, c.Joiner())
+	}
+	env.NewGoJoin("end-of-test", joiners...).Join()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Server and client done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+}
@@ -11,8 +11,10 @@ import (
 )
 
 // Pipe is an in-process commincation channel, whose two ends implement dccp.HeaderConn.
-// It supports rate limiting, latency emulation and receive buffer emulation (in order to
-// capture slow readers).
+// It supports rate limiting, latency emulation, bandwidth and loss emulation, and receive
+// buffer emulation (in order to capture slow readers). All link characteristics are set
+// independently for each direction of the pipe, so asymmetric paths can be emulated by
+// configuring the two half pipes differently.
 type Pipe struct {
 	amb *dccp.Amb
 	ha, hb headerHalfPipe
@@ -20,8 +22,8 @@ type Pipe struct {
 
 // NewPipe creates a new pipe with a given runtime shared by both endpoints, and a root amb
 func NewPipe(env *dccp.Env, amb *dccp.Amb, namea, nameb string) (a, b *headerHalfPipe, line *Pipe) {
-	ab := make(chan *pipeHeader, pipeBufferLen)
-	ba := make(chan *pipeHeader, pipeBufferLen)
+	ab := make(chan *pipeHeader, pipeBufferLen + pipeReorderRoom)
+	ba := make(chan *pipeHeader, pipeBufferLen + pipeReorderRoom)
 	line = &Pipe{}
 	line.amb = amb
 	line.ha.Init(env, line.amb.Refine(namea), ba, ab)
@@ -34,7 +36,10 @@ const (
 	DefaultRatePacketsPerInterval = 100
 )
 
-const pipeBufferLen = 2
+const (
+	pipeBufferLen   = 2 // Packets waiting for the reader, beyond which written packets are dropped
+	pipeReorderRoom = 8 // Additional room for the packets passed on by the reordering element
+)
 
 // headerHalfPipe implements HeaderConn. It enforces rate-limiting on its write side.
 type headerHalfPipe struct {
@@ -46,6 +51,9 @@ type headerHalfPipe struct {
 	writeLk                sync.Mutex
 	write                  chan<- *pipeHeader
 
+	// reorderHeld are the packets held back for reordering, guarded by writeLk
+	reorderHeld            []*reorderedHeader
+
 	// rateLk is used to lock on all rate* variables below as well as readDeadline
 	rateLk                 sync.Mutex
 
@@ -61,7 +69,8 @@ type headerHalfPipe struct {
 	// rateIntervalCounter-th time interval
 	rateIntervalFill       uint32
 
-	// readDeadline is the absolute time deadline for the reads on this side of the connection
+	// readDeadline is the absolute time deadline for the reads on this side of the connection.
+	// Zero means no deadline.
 	readDeadlineLk         sync.Mutex
 	readDeadline           int64
 
@@ -71,6 +80,62 @@ type headerHalfPipe struct {
 
 	latencyQueueLk         sync.Mutex
 	latencyQueue
+
+	// linkLk is used to lock on all link* variables below
+	linkLk                 sync.Mutex
+
+	// linkBandwidth is the capacity of the link in bytes per second. Packets written from this
+	// endpoint are serialized onto the link one after another, so that a packet cannot depart
+	// before the packets written ahead of it. Zero means unlimited capacity.
+	linkBandwidth          int64
+
+	// linkProfile, if set, replaces linkBandwidth with a capacity that varies over the time
+	// since linkProfileStart
+	linkProfile            Profile
+	linkProfileStart       int64
+
+	// linkBuffer is the maximum number of bytes that can be queued up, waiting for link
+	// capacity. Packets that would overflow the buffer are dropped. Zero means no limit.
+	linkBuffer             int64
+
+	// linkFree is the time when the link finishes transmitting all packets queued so far
+	linkFree               int64
+
+	// linkQueue, if set, is the queue discipline of the link buffer, see SetWriteQueue
+	linkQueue              Queue
+
+	// linkShared, if set, is a bottleneck that replaces linkBandwidth and linkBuffer, and
+	// that packets written from this endpoint share with those of other pipes
+	linkShared             *Bottleneck
+
+	// linkLoss is the probability that a packet written from this endpoint is lost
+	linkLoss               float64
+
+	// linkDup is the probability that a packet written from this endpoint is delivered twice
+	linkDup                float64
+
+	// linkReorder is the probability that a packet written from this endpoint is held back,
+	// until up to linkReorderDepth of the packets written after it have overtaken it
+	linkReorder            float64
+	linkReorderDepth       int
+
+	// linkMTU is the MTU reported by GetMTU. Zero means 1500 bytes.
+	linkMTU                int
+
+	// corruptProb is the probability that a packet written from this endpoint has one of its
+	// bits flipped, within the packet regions given by corruptWhere
+	corruptLk              sync.Mutex
+	corruptProb            float64
+	corruptWhere           int
+
+	// dropFilter, if set, selects the packets written from this endpoint that are dropped
+	dropLk                 sync.Mutex
+	dropFilter             func(*dccp.Header) bool
+
+	// tclass is the traffic class that the packets written from this endpoint are marked
+	// with, whose ECN codepoint is reported to the other endpoint
+	tclassLk               sync.Mutex
+	tclass                 byte
 }
 
 type pipeHeader struct {
@@ -85,7 +150,7 @@ func (x *headerHalfPipe) Init(env *dccp.Env, amb *dccp.Amb, r <-chan *pipeHeader
 	x.read = r
 	x.write = w
 	x.SetWriteRate(DefaultRateInterval, DefaultRatePacketsPerInterval)
-	x.readDeadline = x.env.Now() - 1e9
+	x.readDeadline = 0
 	x.writeLatency = 0
 	x.latencyQueue.Init(env, amb)
 }
@@ -97,6 +162,106 @@ func (x *headerHalfPipe) SetWriteLatency(latency int64) {
 	x.writeLatency = latency
 }
 
+// SetWriteBandwidth sets the capacity of this direction of the pipe to bandwidth bytes per
+// second, with a bottleneck buffer of buffer bytes. A bandwidth of zero removes the capacity
+// limit, and a buffer of zero makes the bottleneck buffer unbounded. It replaces the profile
+// set by SetWriteProfile.
+func (x *headerHalfPipe) SetWriteBandwidth(bandwidth, buffer int64) {
+	x.linkLk.Lock()
+	defer x.linkLk.Unlock()
+	x.linkBandwidth = bandwidth
+	x.linkBuffer = buffer
+	x.linkProfile = nil
+}
+
+// SetWriteProfile makes the capacity of this direction of the pipe follow the profile p, from
+// now on, with a bottleneck buffer of buffer bytes. Each packet is serialized onto the link at
+// the capacity that p gives for the time when its transmission starts.
+func (x *headerHalfPipe) SetWriteProfile(p Profile, buffer int64) {
+	now := x.env.Now()
+	x.linkLk.Lock()
+	defer x.linkLk.Unlock()
+	x.linkProfile, x.linkProfileStart = p, now
+	x.linkBuffer = buffer
+}
+
+// SetWriteQueue makes the queue discipline q manage the buffer of this direction of the pipe,
+// in addition to the tail-drop of a full buffer. A nil q leaves tail-drop alone. A shared
+// bottleneck has a queue discipline of its own, see Bottleneck.SetQueue.
+func (x *headerHalfPipe) SetWriteQueue(q Queue) {
+	x.linkLk.Lock()
+	defer x.linkLk.Unlock()
+	x.linkQueue = q
+}
+
+// SetWriteBottleneck makes the packets written from this endpoint pass through the bottleneck
+// b, which they share with the packets of the other pipes attached to b. A nil b restores the
+// capacity set by SetWriteBandwidth.
+func (x *headerHalfPipe) SetWriteBottleneck(b *Bottleneck) {
+	x.linkLk.Lock()
+	defer x.linkLk.Unlock()
+	x.linkShared = b
+}
+
+// SetWriteLoss sets the probability that a packet written from this endpoint is lost
+func (x *headerHalfPipe) SetWriteLoss(prob float64) {
+	x.linkLk.Lock()
+	defer x.linkLk.Unlock()
+	x.linkLoss = prob
+}
+
+// SetWriteDuplication sets the probability that a packet written from this endpoint is
+// delivered twice
+func (x *headerHalfPipe) SetWriteDuplication(prob float64) {
+	x.linkLk.Lock()
+	defer x.linkLk.Unlock()
+	x.linkDup = prob
+}
+
+// SetWriteReordering makes this endpoint hold back each packet it writes with probability
+// prob, and deliver it behind between one and depth of the packets written after it. A prob
+// of zero stops the reordering of further packets.
+func (x *headerHalfPipe) SetWriteReordering(prob float64, depth int) {
+	x.linkLk.Lock()
+	defer x.linkLk.Unlock()
+	x.linkReorder = prob
+	x.linkReorderDepth = depth
+}
+
+// SetWriteCorruption sets the probability that a packet written from this endpoint is corrupted
+// in transit by a single bit flip. The argument where is a bitmask of CorruptHeader and
+// CorruptPayload, which specifies the regions of the packet that bit flips may land in.
+func (x *headerHalfPipe) SetWriteCorruption(prob float64, where int) {
+	x.corruptLk.Lock()
+	defer x.corruptLk.Unlock()
+	x.corruptProb = prob
+	x.corruptWhere = where
+}
+
+// SetWriteDrop makes this endpoint drop the packets it writes for which f returns true, in
+// order to target the loss at specific packets. A nil f drops no packets.
+func (x *headerHalfPipe) SetWriteDrop(f func(*dccp.Header) bool) {
+	x.dropLk.Lock()
+	defer x.dropLk.Unlock()
+	x.dropFilter = f
+}
+
+// SetTrafficClass implements dccp.TrafficClassConn.SetTrafficClass. The ECN codepoint of
+// tos is reported in the Header.ECN of the packets delivered to the other endpoint.
+func (x *headerHalfPipe) SetTrafficClass(tos byte) error {
+	x.tclassLk.Lock()
+	defer x.tclassLk.Unlock()
+	x.tclass = tos
+	return nil
+}
+
+// TrafficClass returns the traffic class set by SetTrafficClass
+func (x *headerHalfPipe) TrafficClass() byte {
+	x.tclassLk.Lock()
+	defer x.tclassLk.Unlock()
+	return x.tclass
+}
+
 // SetWriteRate sets the transmission rate of this side of the pipe to ratePacketsPerInterval packets for each
 // interval of rateInterval nanoseconds
 func (x *headerHalfPipe) SetWriteRate(rateInterval int64, ratePacketsPerInterval uint32) {
@@ -108,9 +273,33 @@ func (x *headerHalfPipe) SetWriteRate(rateInterval int64, ratePacketsPerInterval
 	x.rateIntervalFill = 0
 }
 
+// writeFaults returns the latency, loss probability and duplication probability of this
+// direction of the pipe
+func (x *headerHalfPipe) writeFaults() (latency int64, loss, dup float64) {
+	x.writeLatencyLk.Lock()
+	latency = x.writeLatency
+	x.writeLatencyLk.Unlock()
+	x.linkLk.Lock()
+	defer x.linkLk.Unlock()
+	return latency, x.linkLoss, x.linkDup
+}
+
 // GetMTU implements dccp.HeaderConn.GetMTU
 func (x *headerHalfPipe) GetMTU() int {
-	return 1500
+	x.linkLk.Lock()
+	defer x.linkLk.Unlock()
+	if x.linkMTU == 0 {
+		return 1500
+	}
+	return x.linkMTU
+}
+
+// SetMTU sets the MTU that this endpoint reports, as if path MTU discovery had found it. It
+// does not drop larger packets.
+func (x *headerHalfPipe) SetMTU(mtu int) {
+	x.linkLk.Lock()
+	defer x.linkLk.Unlock()
+	x.linkMTU = mtu
 }
 
 // Read implements dccp.HeaderConn.Read
@@ -132,8 +321,16 @@ func (x *headerHalfPipe) Read() (h *dccp.Header, err error) {
 			return ph.Header, nil
 		}
 		
-		// Calculate time to wait until either queued packet is available or read timeout is reached
-		timeout := readDeadline - x.env.Now()
+		// Calculate time to wait until either queued packet is available or read timeout is
+		// reached. A deadline that has passed while the reader was busy times out right away,
+		// rather than leave the reader blocked until the next packet arrives.
+		var timeout int64
+		if readDeadline > 0 {
+			timeout = readDeadline - x.env.Now()
+			if timeout <= 0 {
+				return nil, dccp.ErrTimeout
+			}
+		}
 		if existQueued {
 			if timeout == 0 {
 				timeout = timeToQueued
@@ -148,7 +345,7 @@ func (x *headerHalfPipe) Read() (h *dccp.Header, err error) {
 		select {
 		case ph, ok := <-x.read:
 			if !ok {
-				x.amb.E(dccp.EventWarn, "Read EOF", ph.Header)
+				x.amb.E(dccp.EventWarn, "Read EOF")
 				return nil, dccp.ErrEOF
 			}
 			x.latencyQueueLk.Lock()
@@ -161,8 +358,8 @@ func (x *headerHalfPipe) Read() (h *dccp.Header, err error) {
 	panic("un")
 }
 
-var sleepingChan = make(chan int64)
-
+// makeTimeoutChan returns a channel that is closed once timeout has elapsed. Without a timeout,
+// it returns a nil channel, which blocks forever.
 func (x *headerHalfPipe) makeTimeoutChan(timeout int64) (<-chan int64) {
 	var ch chan int64
 	if timeout > 0 {
@@ -171,12 +368,18 @@ func (x *headerHalfPipe) makeTimeoutChan(timeout int64) (<-chan int64) {
 			x.env.Sleep(timeout)
 			close(ch)
 		}, "pipe timeout")
-	} else {
-		ch = sleepingChan
 	}
 	return ch
 }
 
+// QueueLen returns the number of packets written to the other end of the pipe that have not
+// yet been read on this end
+func (x *headerHalfPipe) QueueLen() int {
+	x.latencyQueueLk.Lock()
+	defer x.latencyQueueLk.Unlock()
+	return x.latencyQueue.Len() + len(x.read)
+}
+
 // Write implements dccp.HeaderConn.Write
 func (x *headerHalfPipe) Write(h *dccp.Header) (err error) {
 	x.writeLk.Lock()
@@ -187,16 +390,37 @@ func (x *headerHalfPipe) Write(h *dccp.Header) (err error) {
 		return dccp.ErrBad
 	}
 
+	h.ECN = x.TrafficClass() & 3
 	if x.rateFilter() {
-		if len(x.write) >= cap(x.write) {
+		if len(x.write) >= pipeBufferLen {
 			x.amb.E(dccp.EventDrop, "Slow reader", h)
+		} else if x.lossFilter() {
+			x.amb.E(dccp.EventDrop, "Lossy link", h)
+		} else if x.dropFilterMatch(h) {
+			x.amb.E(dccp.EventDrop, "Drop filter", h)
+		} else if h, err = x.corruptFilter(h); err != nil {
+			x.amb.E(dccp.EventDrop, fmt.Sprintf("Corrupt (%s)", err), h)
+		} else if departTime, drop := x.linkFilter(h); drop != "" {
+			x.amb.E(dccp.EventDrop, drop, h)
 		} else {
+			// The writer reuses the options of h once Write returns
+			h = h.Copy()
 			x.amb.E(dccp.EventWrite, "", h)
 			x.writeLatencyLk.Lock()
 			latency := x.writeLatency
 			x.writeLatencyLk.Unlock()
-			now := x.env.Now()
-			x.write <- &pipeHeader{ Header: h, DeliverTime: now + latency }
+			ph := &pipeHeader{ Header: h, DeliverTime: departTime + latency }
+			if x.reorderFilter(ph) {
+				x.amb.E(dccp.EventInfo, "Held back", h)
+			} else {
+				x.write <- ph
+				x.releaseHeld(ph)
+			}
+			if x.dupFilter() && len(x.write) < pipeBufferLen {
+				dup := *h
+				x.amb.E(dccp.EventWrite, "Duplicate", &dup)
+				x.write <- &pipeHeader{ Header: &dup, DeliverTime: departTime + latency }
+			}
 		}
 	} else {
 		x.amb.E(dccp.EventDrop, "Fast writer", h)
@@ -204,6 +428,78 @@ func (x *headerHalfPipe) Write(h *dccp.Header) (err error) {
 	return nil
 }
 
+// lossFilter returns true if the next packet is to be lost, according to SetWriteLoss
+func (x *headerHalfPipe) lossFilter() bool {
+	x.linkLk.Lock()
+	prob := x.linkLoss
+	x.linkLk.Unlock()
+	return prob > 0 && x.env.Float64() < prob
+}
+
+// dropFilterMatch returns true if h is to be dropped, according to SetWriteDrop
+func (x *headerHalfPipe) dropFilterMatch(h *dccp.Header) bool {
+	x.dropLk.Lock()
+	f := x.dropFilter
+	x.dropLk.Unlock()
+	return f != nil && f(h)
+}
+
+// dupFilter returns true if the packet just written is to be duplicated, according to
+// SetWriteDuplication
+func (x *headerHalfPipe) dupFilter() bool {
+	x.linkLk.Lock()
+	prob := x.linkDup
+	x.linkLk.Unlock()
+	return prob > 0 && x.env.Float64() < prob
+}
+
+// linkFilter serializes h onto the link, according to SetWriteBandwidth, SetWriteProfile,
+// SetWriteQueue or SetWriteBottleneck. It returns the time when the last bit of h leaves the
+// link, or the reason why h is dropped.
+func (x *headerHalfPipe) linkFilter(h *dccp.Header) (departTime int64, drop string) {
+	now := x.env.Now()
+	x.linkLk.Lock()
+	defer x.linkLk.Unlock()
+	if x.linkShared != nil {
+		return x.linkShared.depart(now, h)
+	}
+	bandwidth := x.linkBandwidth
+	if x.linkProfile != nil {
+		bandwidth = x.linkProfile(max64(now, x.linkFree) - x.linkProfileStart)
+	}
+	if bandwidth <= 0 {
+		return now, ""
+	}
+	drop = linkEnqueue(x.linkQueue, now, &x.linkFree, bandwidth, x.linkBuffer, h)
+	return x.linkFree, drop
+}
+
+// wireSize returns the size of the wire format of h in bytes
+func wireSize(h *dccp.Header) int {
+	buf, err := h.Write(dccp.LabelZero.Bytes(), dccp.LabelZero.Bytes(), dccp.AnyProto, true)
+	if err != nil {
+		return len(h.Data)
+	}
+	return len(buf)
+}
+
+// corruptFilter corrupts h with the probability set by SetWriteCorruption. It returns the
+// header that the receiver would parse from the (possibly corrupted) wire format of h, or an
+// error if the corruption renders the packet invalid.
+func (x *headerHalfPipe) corruptFilter(h *dccp.Header) (*dccp.Header, error) {
+	x.corruptLk.Lock()
+	prob, where := x.corruptProb, x.corruptWhere
+	x.corruptLk.Unlock()
+	if prob <= 0 || x.env.Float64() >= prob {
+		return h, nil
+	}
+	g, err := corruptHeader(x.env, h, where)
+	if err != nil {
+		return h, err
+	}
+	return g, nil
+}
+
 // rateFilter returns true if another packet can be sent now without violating the rate
 // limit set by SetWriteRate
 func (x *headerHalfPipe) rateFilter() bool {
@@ -0,0 +1,58 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"math"
+)
+
+// Profile gives the capacity of a link, in bytes per second, as a function of the time in
+// nanoseconds since the profile was set with SetWriteProfile. A capacity of zero or less
+// means unlimited capacity.
+type Profile func(t int64) int64
+
+// ProfileStep is a capacity that a step profile changes to at time At
+type ProfileStep struct {
+	At        int64
+	Bandwidth int64
+}
+
+// StepProfile returns a profile that changes the capacity abruptly at each of the steps, which
+// are in order of time. Before the first step the capacity is unlimited.
+func StepProfile(steps ...ProfileStep) Profile {
+	return func(t int64) int64 {
+		var bandwidth int64
+		for _, s := range steps {
+			if s.At > t {
+				break
+			}
+			bandwidth = s.Bandwidth
+		}
+		return bandwidth
+	}
+}
+
+// RampProfile returns a profile whose capacity is from until time start, changes linearly to
+// to over the following duration nanoseconds, and remains to thereafter
+func RampProfile(from, to, start, duration int64) Profile {
+	return func(t int64) int64 {
+		switch {
+		case t <= start:
+			return from
+		case t >= start+duration:
+			return to
+		}
+		return from + int64(float64(to-from)*float64(t-start)/float64(duration))
+	}
+}
+
+// OscillateProfile returns a profile whose capacity swings sinusoidally around mean, by
+// amplitude to either side, once every period nanoseconds. The amplitude must be less than
+// mean, so that the capacity remains positive.
+func OscillateProfile(mean, amplitude, period int64) Profile {
+	return func(t int64) int64 {
+		return mean + int64(float64(amplitude)*math.Sin(2*math.Pi*float64(t)/float64(period)))
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"bytes"
+	"runtime/pprof"
+	"strings"
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// TestProfileLabels checks that the loops of both endpoints of a connection appear in the
+// goroutine profile labelled with their connection, role and subsystem
+func TestProfileLabels(t *testing.T) {
+	env, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "profile")
+	clientConn, serverConn, _, _ := NewFlowPipe(env, "p", dccp.CCFixed{Every: 1e6})
+	if err := clientConn.Write(make([]byte, 10)); err != nil {
+		t.Fatalf("client write (%s)", err)
+	}
+	if _, err := serverConn.Read(); err != nil {
+		t.Fatalf("server read (%s)", err)
+	}
+
+	var buf bytes.Buffer
+	pprof.Lookup("goroutine").WriteTo(&buf, 1)
+	profile := buf.String()
+	for _, conn := range []string{"client-p", "server-p"} {
+		role := conn[:6]
+		for _, sub := range []string{dccp.ProfileRead, dccp.ProfileWrite} {
+			l := `"conn":"` + conn + `", "role":"` + role + `", "subsystem":"` + sub + `"`
+			if !strings.Contains(profile, l) {
+				t.Errorf("no goroutine labelled %s", l)
+			}
+		}
+	}
+
+	clientConn.Abort()
+	serverConn.Abort()
+	env.NewGoJoin("end-of-test", clientConn.Joiner(), serverConn.Joiner()).Join()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Server and client done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+}
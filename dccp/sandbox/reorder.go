@@ -0,0 +1,61 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// A half pipe reorders the packets written from its endpoint by holding some of them back,
+// each until a given number of the packets written after it have been passed on, see
+// SetWriteReordering. The number of packets that overtake a held-back packet is its
+// displacement. Packets that are still held back when the pipe closes are lost.
+
+// reorderedHeader is a packet held back for reordering
+type reorderedHeader struct {
+	*pipeHeader
+	behind int // Number of packets that are yet to overtake this one
+}
+
+// reorderFilter holds ph back with the probability set by SetWriteReordering, and returns
+// true if it did. The displacement of ph is chosen uniformly between one and the depth set by
+// SetWriteReordering.
+func (x *headerHalfPipe) reorderFilter(ph *pipeHeader) bool {
+	x.linkLk.Lock()
+	prob, depth := x.linkReorder, x.linkReorderDepth
+	x.linkLk.Unlock()
+	if prob <= 0 || depth < 1 || x.env.Float64() >= prob {
+		return false
+	}
+	x.reorderHeld = append(x.reorderHeld, &reorderedHeader{ pipeHeader: ph, behind: 1 + int(x.env.Int63n(int64(depth))) })
+	return true
+}
+
+// releaseHeld counts the packet ph, which has just been passed on, towards the displacement of
+// the packets held back, and passes on those that have been overtaken by enough packets. They
+// are delivered right after ph, and count towards the displacement of the packets still held
+// back in turn. Packets that find no room in the pipe wait for the next release.
+func (x *headerHalfPipe) releaseHeld(ph *pipeHeader) {
+	for _, r := range x.reorderHeld {
+		r.behind--
+	}
+	var n int64
+	for i := 0; i < len(x.reorderHeld) && len(x.write) < cap(x.write); {
+		r := x.reorderHeld[i]
+		if r.behind > 0 {
+			i++
+			continue
+		}
+		x.reorderHeld = append(x.reorderHeld[:i], x.reorderHeld[i+1:]...)
+		for _, q := range x.reorderHeld {
+			q.behind--
+		}
+		n++
+		r.DeliverTime = max64(r.DeliverTime, ph.DeliverTime + n)
+		x.amb.E(dccp.EventInfo, "Reordered", r.Header)
+		x.write <- r.pipeHeader
+		i = 0
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"sync"
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+	"github.com/petar/GoDCCP/dccp/ccid3"
+)
+
+const (
+	reorderDuration = 10e9 // Duration of each experiment in ns
+	reorderSendRate = 40   // Fixed sender rate in pps
+	reorderProb     = 0.2  // Probability that a packet is held back
+	reorderLatency  = 25e6 // One-way latency of the pipe in ns
+)
+
+// reorderWatch is a dccp.TraceWriter that keeps the highest loss event rate estimated by the
+// receiver of the server, and counts the packets that the pipe delivers out of order
+type reorderWatch struct {
+	sync.Mutex
+	loss      float64 // In percent
+	reordered int
+}
+
+func (x *reorderWatch) Write(r *dccp.Trace) {
+	x.Lock()
+	defer x.Unlock()
+	if r.Event == dccp.EventInfo && r.Comment == "Reordered" {
+		x.reordered++
+	}
+	if s, ok := r.Sample(); ok && s.Series == ccid3.LossReceiverEstimateSample && r.Labels[0] == "server" && s.Value > x.loss {
+		x.loss = s.Value
+	}
+}
+
+func (x *reorderWatch) Sync() error { return nil }
+
+func (x *reorderWatch) Close() error { return nil }
+
+// TestReorder checks that the receiver of CCID 3 tolerates packets that are overtaken by fewer
+// than NDUPACK others, and declares lost the packets that are overtaken by NDUPACK or more,
+// RFC 4342, Section 6.1. The link loses no packets. The experiments run on virtual time, so
+// that the pipe does not overflow when the machine is loaded, and the receiver must see no loss
+// at all below NDUPACK. The pipe has some latency, since the RTT of a pipe without latency is
+// next to nothing on virtual time.
+func TestReorder(t *testing.T) {
+	for _, c := range []struct {
+		depth int
+		lossy bool
+	}{
+		{ ccid3.NDUPACK - 1, false },
+		{ 2 * ccid3.NDUPACK, true },
+	} {
+		var x *reorderWatch
+		Virtual(t, func(t *testing.T, tm dccp.Time) {
+			x = testReorder(t, tm, c.depth)
+		})
+		if x.reordered == 0 {
+			t.Errorf("depth %d: no packets reordered", c.depth)
+		}
+		if c.lossy && x.loss <= 0.01 {
+			t.Errorf("depth %d: loss event rate %g%% with %d packets reordered", c.depth, x.loss, x.reordered)
+		}
+		// The receiver reports the absence of loss events as a loss event rate of
+		// 1/UnknownLossEventRateInv, rather than zero
+		if !c.lossy && x.loss > ccid3.LossSample("", ccid3.UnknownLossEventRateInv).Value {
+			t.Errorf("depth %d: loss event rate %g%% with %d packets reordered, expecting none", c.depth, x.loss, x.reordered)
+		}
+	}
+}
+
+func testReorder(t *testing.T, tm dccp.Time, depth int) *reorderWatch {
+	x := &reorderWatch{}
+	env, _ := NewEnvTime(tm, "reorder", x)
+	clientConn, serverConn, clientToServer, serverToClient := NewClientServerPipe(env)
+	clientConn.Amb().Flags().SetUint32("FixRate", reorderSendRate)
+	serverConn.Amb().Flags().SetUint32("FixRate", reorderSendRate)
+	clientToServer.SetWriteLatency(reorderLatency)
+	serverToClient.SetWriteLatency(reorderLatency)
+	clientToServer.SetWriteReordering(reorderProb, depth)
+
+	cchan := make(chan int, 1)
+	env.Go(func() {
+		t0 := env.Now()
+		for env.Now() - t0 < reorderDuration {
+			if err := clientConn.Write([]byte{1, 2, 3}); err != nil {
+				break
+			}
+		}
+		clientConn.Close()
+		close(cchan)
+	}, "test client")
+
+	schan := make(chan int, 1)
+	env.Go(func() {
+		for {
+			if _, err := serverConn.Read(); err != nil {
+				break
+			}
+		}
+		close(schan)
+	}, "test server")
+
+	<-cchan
+	<-schan
+
+	clientConn.Abort()
+	serverConn.Abort()
+	env.NewGoJoin("end-of-test", clientConn.Joiner(), serverConn.Joiner()).Join()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Server and client done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+	x.Lock()
+	defer x.Unlock()
+	return x
+}
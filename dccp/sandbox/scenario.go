@@ -0,0 +1,450 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// Scenario describes a sandbox experiment declaratively, sparing tests the goroutines and
+// channels that drive the client and the server, and the teardown that ends the experiment.
+// For example, a client that sends 100 packets at 1ms spacing over a link that starts losing
+// 2% of the packets at 2s, and whose delivery rate must halve within 4 RTTs of it:
+//
+//	NewScenario("halve").
+//		ClientSends(100, 1e6).
+//		LossAfter(2e9, 0.02).
+//		ExpectRateFall(2e9, 4*rtt, 0.5).
+//		Run(t)
+//
+// Times are in nanoseconds since the connection was created.
+type Scenario struct {
+	name     string
+	dilation int64
+	ccid     dccp.CCID
+	golden   bool
+	settle   int64
+	size     int
+	sampling int64
+	sends    []scenarioSend
+	events   []scenarioEvent
+	expects  []scenarioExpect
+	inOrder  [][]*dccp.Matcher
+	never    []*dccp.Matcher
+	virtual  bool
+}
+
+type scenarioSend struct {
+	n       int
+	spacing int64
+}
+
+type scenarioEvent struct {
+	at int64
+	f  func(*ScenarioRun)
+}
+
+type scenarioExpect struct {
+	what string
+	f    func(*ScenarioRun) error
+}
+
+const (
+	SCENARIO_DILATION = 20  // Default factor by which the time of a scenario is accelerated
+	SCENARIO_SETTLE   = 1e9 // Time that a scenario runs on after the client has sent everything
+)
+
+// NewScenario creates an empty scenario, whose traces go to a file called name. It runs over
+// the CCID 3 client-server pipe, with time dilated by SCENARIO_DILATION, unless told otherwise.
+func NewScenario(name string) *Scenario {
+	return &Scenario{ name: name, dilation: SCENARIO_DILATION, settle: SCENARIO_SETTLE, size: STAMP_LEN }
+}
+
+// Fixed makes the scenario run over the fixed-rate client-server pipe
+func (x *Scenario) Fixed() *Scenario {
+	x.ccid = dccp.CCFixed{Every: 1e6}
+	return x
+}
+
+// CCID makes both endpoints of the scenario run the congestion control ccid
+func (x *Scenario) CCID(ccid dccp.CCID) *Scenario {
+	x.ccid = ccid
+	return x
+}
+
+// Dilate sets the factor by which the scenario's time is accelerated
+func (x *Scenario) Dilate(dilation int64) *Scenario {
+	x.dilation = dilation
+	return x
+}
+
+// Virtual makes the scenario run on virtual time, see Virtual. The dilation is then ignored.
+func (x *Scenario) Virtual() *Scenario {
+	x.virtual = true
+	return x
+}
+
+// Golden makes the scenario compare its normalized trace with its golden file, see GoldenTrace
+func (x *Scenario) Golden() *Scenario {
+	x.golden = true
+	return x
+}
+
+// Settle sets the time that the scenario runs on after the client has sent everything
+func (x *Scenario) Settle(settle int64) *Scenario {
+	x.settle = settle
+	return x
+}
+
+// Payload sets the size of the messages that the client writes, which is STAMP_LEN bytes
+// unless told otherwise
+func (x *Scenario) Payload(size int) *Scenario {
+	if size < STAMP_LEN {
+		panic("scenario payload too short for stamp")
+	}
+	x.size = size
+	return x
+}
+
+// ClientSends makes the client write n messages, spacing nanoseconds apart, after the messages
+// of the preceding ClientSends. Each message is stamped with the time at which it is written.
+// The server reads all messages as they arrive.
+func (x *Scenario) ClientSends(n int, spacing int64) *Scenario {
+	x.sends = append(x.sends, scenarioSend{ n: n, spacing: spacing })
+	return x
+}
+
+// At calls f at time at, with the run of the scenario
+func (x *Scenario) At(at int64, f func(*ScenarioRun)) *Scenario {
+	x.events = append(x.events, scenarioEvent{ at: at, f: f })
+	return x
+}
+
+// LossAfter makes the client-to-server link lose packets with probability prob from time at
+func (x *Scenario) LossAfter(at int64, prob float64) *Scenario {
+	return x.At(at, func(r *ScenarioRun) { r.ClientToServer.SetWriteLoss(prob) })
+}
+
+// LatencyAfter sets the latency of the client-to-server link to latency from time at
+func (x *Scenario) LatencyAfter(at int64, latency int64) *Scenario {
+	return x.At(at, func(r *ScenarioRun) { r.ClientToServer.SetWriteLatency(latency) })
+}
+
+// BandwidthAfter sets the capacity and the buffer of the client-to-server link from time at,
+// see SetWriteBandwidth
+func (x *Scenario) BandwidthAfter(at int64, bandwidth, buffer int64) *Scenario {
+	return x.At(at, func(r *ScenarioRun) { r.ClientToServer.SetWriteBandwidth(bandwidth, buffer) })
+}
+
+// ProfileAfter makes the capacity of the client-to-server link follow the profile p from time
+// at, with a buffer of buffer bytes, see SetWriteProfile. Times in p are relative to at.
+func (x *Scenario) ProfileAfter(at int64, p Profile, buffer int64) *Scenario {
+	return x.At(at, func(r *ScenarioRun) { r.ClientToServer.SetWriteProfile(p, buffer) })
+}
+
+// HandoverAfter moves the connection to a path of different latency and capacity at time at,
+// as a mobile host does when it hands over between networks. The latency of both links is set
+// to latency, and the capacity and buffer of the client-to-server link to bandwidth and buffer.
+func (x *Scenario) HandoverAfter(at, latency, bandwidth, buffer int64) *Scenario {
+	return x.At(at, func(r *ScenarioRun) {
+		r.ClientToServer.SetWriteLatency(latency)
+		r.ServerToClient.SetWriteLatency(latency)
+		r.ClientToServer.SetWriteBandwidth(bandwidth, buffer)
+	})
+}
+
+// SampleRTT makes the scenario record the round-trip time estimate of the client every
+// interval nanoseconds, until the client has sent everything
+func (x *Scenario) SampleRTT(interval int64) *Scenario {
+	x.sampling = interval
+	return x
+}
+
+// Expect adds an expectation, which is checked once the scenario has run. A non-nil error
+// from f fails the test.
+func (x *Scenario) Expect(what string, f func(*ScenarioRun) error) *Scenario {
+	x.expects = append(x.expects, scenarioExpect{ what: what, f: f })
+	return x
+}
+
+// ExpectEvents expects trace events that match m, in the given order, see dccp.Expectations
+func (x *Scenario) ExpectEvents(m ...*dccp.Matcher) *Scenario {
+	x.inOrder = append(x.inOrder, m)
+	return x
+}
+
+// NeverEvents expects no trace events that match any of m
+func (x *Scenario) NeverEvents(m ...*dccp.Matcher) *Scenario {
+	x.never = append(x.never, m...)
+	return x
+}
+
+// ExpectRateFall expects the rate at which the server receives, over the window that starts
+// window after time at, to be no more than fraction of its rate over the window before at
+func (x *Scenario) ExpectRateFall(at, window int64, fraction float64) *Scenario {
+	return x.Expect(fmt.Sprintf("rate falls to %g at %dms", fraction, at/1e6), func(r *ScenarioRun) error {
+		before, after := r.Rate(at-window, at), r.Rate(at+window, at+2*window)
+		if before == 0 {
+			return fmt.Errorf("no packets received before %dms", at/1e6)
+		}
+		if after > fraction*before {
+			return fmt.Errorf("rate %g/s after, %g/s before", after, before)
+		}
+		return nil
+	})
+}
+
+// ExpectReceived expects the server to receive between min and max messages
+func (x *Scenario) ExpectReceived(min, max int) *Scenario {
+	return x.Expect(fmt.Sprintf("received %d to %d", min, max), func(r *ScenarioRun) error {
+		if n := len(r.Received()); n < min || n > max {
+			return fmt.Errorf("received %d", n)
+		}
+		return nil
+	})
+}
+
+// ExpectMarked expects the server to receive between min and max messages marked Congestion
+// Experienced, see SetWriteQueue
+func (x *Scenario) ExpectMarked(min, max int) *Scenario {
+	return x.Expect(fmt.Sprintf("marked %d to %d", min, max), func(r *ScenarioRun) error {
+		if n := r.Marked(); n < min || n > max {
+			return fmt.Errorf("marked %d", n)
+		}
+		return nil
+	})
+}
+
+// ExpectRate expects the rate at which the server receives, in messages per second, to be
+// between min and max over the window from time from to time to
+func (x *Scenario) ExpectRate(from, to int64, min, max float64) *Scenario {
+	return x.Expect(fmt.Sprintf("rate of %g/s to %g/s from %dms to %dms", min, max, from/1e6, to/1e6), func(r *ScenarioRun) error {
+		if rate := r.Rate(from, to); rate < min || rate > max {
+			return fmt.Errorf("rate %g/s", rate)
+		}
+		return nil
+	})
+}
+
+// ExpectRTT expects every round-trip time estimate of the client that is sampled between the
+// times from and to to be within the fraction tolerance of rtt, see SampleRTT
+func (x *Scenario) ExpectRTT(from, to, rtt int64, tolerance float64) *Scenario {
+	return x.Expect(fmt.Sprintf("RTT of %dms from %dms to %dms", rtt/1e6, from/1e6, to/1e6), func(r *ScenarioRun) error {
+		n := 0
+		for _, s := range r.RTTs() {
+			if s.At < from || s.At >= to {
+				continue
+			}
+			n++
+			if dev := float64(s.RTT-rtt) / float64(rtt); dev > tolerance || dev < -tolerance {
+				return fmt.Errorf("RTT %dms at %dms", s.RTT/1e6, s.At/1e6)
+			}
+		}
+		if n == 0 {
+			return fmt.Errorf("no RTT samples")
+		}
+		return nil
+	})
+}
+
+// ExpectNoReset expects both Conns to be open when the scenario ends, before its teardown
+func (x *Scenario) ExpectNoReset() *Scenario {
+	return x.Expect("no reset", func(r *ScenarioRun) error {
+		if r.ClientErr != nil || r.ServerErr != nil {
+			return fmt.Errorf("client %v, server %v", r.ClientErr, r.ServerErr)
+		}
+		return nil
+	})
+}
+
+// ExpectLatency expects p percent of the messages that the server receives to arrive within
+// max nanoseconds of being written, see DeliveryRecorder
+func (x *Scenario) ExpectLatency(p float64, max int64) *Scenario {
+	return x.Expect(fmt.Sprintf("%g-th percentile latency of %dms", p, max/1e6), func(r *ScenarioRun) error {
+		if r.Delivery.Len() == 0 {
+			return fmt.Errorf("nothing received")
+		}
+		if l := r.Delivery.Percentile(p); l > max {
+			return fmt.Errorf("latency %dms", l/1e6)
+		}
+		return nil
+	})
+}
+
+// ScenarioRun is a scenario in progress, and the record of what happened once it is done
+type ScenarioRun struct {
+	Env            *dccp.Env
+	Client, Server *dccp.Conn
+	ClientToServer *headerHalfPipe
+	ServerToClient *headerHalfPipe
+	Delivery       DeliveryRecorder // Latencies of the messages received by the server
+	ClientErr      error            // Error of the client just before teardown
+	ServerErr      error            // Error of the server just before teardown
+
+	start    int64
+	lk       sync.Mutex
+	received []int64     // Times at which the server received messages, since start
+	marked   int         // Messages received marked Congestion Experienced
+	rtts     []RTTSample // Round-trip time estimates of the client, see SampleRTT
+}
+
+// RTTSample is a round-trip time estimate of the client, sampled At nanoseconds since the
+// start of a scenario
+type RTTSample struct {
+	At  int64
+	RTT int64
+}
+
+// RTTs returns the round-trip time estimates of the client that were sampled
+func (r *ScenarioRun) RTTs() []RTTSample {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	return append([]RTTSample(nil), r.rtts...)
+}
+
+// Received returns the times, since the start of the scenario, at which the server received
+// messages
+func (r *ScenarioRun) Received() []int64 {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	return append([]int64(nil), r.received...)
+}
+
+// Marked returns the number of messages that the server received marked Congestion Experienced
+func (r *ScenarioRun) Marked() int {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	return r.marked
+}
+
+// Rate returns the rate, in messages per second, at which the server received messages
+// between the times from and to
+func (r *ScenarioRun) Rate(from, to int64) float64 {
+	n := 0
+	for _, t := range r.Received() {
+		if t >= from && t < to {
+			n++
+		}
+	}
+	return float64(n) * 1e9 / float64(to-from)
+}
+
+// Run runs the scenario to its end, tears the connection down, and checks the expectations
+func (x *Scenario) Run(t *testing.T) *ScenarioRun {
+	if !x.virtual {
+		return x.run(t, dccp.NewDilatedTime(x.dilation))
+	}
+	var r *ScenarioRun
+	Virtual(t, func(t *testing.T, tm dccp.Time) {
+		r = x.run(t, tm)
+	})
+	return r
+}
+
+// run runs the scenario on the Time tm
+func (x *Scenario) run(t *testing.T, tm dccp.Time) *ScenarioRun {
+	var guzzles []dccp.TraceWriter
+	var gt *GoldenTrace
+	if x.golden {
+		gt = NewGoldenTrace()
+		guzzles = append(guzzles, gt)
+	}
+	env, _ := NewEnvTime(tm, x.name, guzzles...)
+	r := &ScenarioRun{ Env: env }
+	if len(x.inOrder) > 0 || len(x.never) > 0 {
+		for _, m := range x.inOrder {
+			env.Expect().InOrder(m...)
+		}
+		env.Expect().Never(x.never...)
+	}
+	if x.ccid != nil {
+		r.Client, r.Server, r.ClientToServer, r.ServerToClient = NewCCIDClientServerPipe(env, x.ccid)
+	} else {
+		r.Client, r.Server, r.ClientToServer, r.ServerToClient = NewClientServerPipe(env)
+	}
+	r.start = env.Now()
+
+	for _, e := range x.events {
+		e := e
+		env.Go(func() {
+			if d := r.start + e.at - env.Now(); d > 0 {
+				env.Sleep(d)
+			}
+			e.f(r)
+		}, "scenario event")
+	}
+	env.Go(func() {
+		for {
+			data, meta, err := r.Server.ReadMsg()
+			if err != nil {
+				return
+			}
+			r.Delivery.Add(data, meta.Time)
+			r.lk.Lock()
+			r.received = append(r.received, env.Now()-r.start)
+			if meta.ECN == dccp.ECNCE {
+				r.marked++
+			}
+			r.lk.Unlock()
+		}
+	}, "scenario server")
+	sent := make(chan int)
+	if x.sampling > 0 {
+		env.Go(func() {
+			for {
+				select {
+				case <-sent:
+					return
+				default:
+				}
+				r.lk.Lock()
+				r.rtts = append(r.rtts, RTTSample{ At: env.Now()-r.start, RTT: r.Client.RTT() })
+				r.lk.Unlock()
+				env.Sleep(x.sampling)
+			}
+		}, "scenario sampler")
+	}
+	env.Go(func() {
+		defer close(sent)
+		for _, s := range x.sends {
+			for i := 0; i < s.n; i++ {
+				msg := make([]byte, x.size)
+				Stamp(env, msg)
+				if err := r.Client.Write(msg); err != nil {
+					t.Errorf("client write (%s)", err)
+					return
+				}
+				env.Sleep(s.spacing)
+			}
+		}
+	}, "scenario client")
+	<-sent
+	env.Sleep(x.settle)
+
+	if gt != nil {
+		gt.Stop()
+	}
+	r.ClientErr, r.ServerErr = r.Client.Error(), r.Server.Error()
+	r.Client.Abort()
+	r.Server.Abort()
+	env.NewGoJoin("end-of-test", r.Client.Joiner(), r.Server.Joiner()).Join()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Server and client done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+
+	if gt != nil {
+		gt.Check(t, x.name)
+	}
+	for _, e := range x.expects {
+		if err := e.f(r); err != nil {
+			t.Errorf("%s: expected %s (%s)", x.name, e.what, err)
+		}
+	}
+	return r
+}
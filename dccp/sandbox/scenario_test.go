@@ -0,0 +1,193 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"fmt"
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// TestScenarioDelivery checks that the messages of a loss-free scenario are received, and
+// that the CCIDs of both ends open before and close during the teardown. The pipe may drop a
+// few of the packets sent in a burst as the connection opens.
+func TestScenarioDelivery(t *testing.T) {
+	NewScenario("scenario-delivery").
+		Fixed().
+		ClientSends(100, 10e6).
+		ExpectReceived(95, 100).
+		ExpectEvents(
+			dccp.MatchComment("client", "CCID open"),
+			dccp.MatchComment("client", "CCID close"),
+			dccp.MatchComment("line", "Server and client done."),
+		).
+		ExpectEvents(dccp.MatchComment("server", "CCID open"), dccp.MatchComment("server", "CCID close")).
+		NeverEvents(dccp.MatchState("client", "RESPOND"), dccp.MatchState("server", "REQUEST")).
+		Run(t)
+}
+
+// TestScenarioLoss checks that the delivery rate of a fixed-rate sender falls with the loss
+// that the link starts after two seconds. Time is dilated little, so that the rates are not
+// skewed by the granularity of sleeps.
+func TestScenarioLoss(t *testing.T) {
+	NewScenario("scenario-loss").
+		Fixed().
+		Dilate(4).
+		ClientSends(800, 5e6).
+		LossAfter(2e9, 0.5).
+		ExpectRateFall(2e9, 1e9, 0.7).
+		Run(t)
+}
+
+// TestGoldenExchange checks the packets and state changes of a short exchange over the
+// fixed-rate pipe against its golden trace. Run with DCCPGOLDEN=update to record it anew after
+// an intended change of protocol behavior. Time is dilated little, so that a busy machine
+// does not make timers fire that would not otherwise.
+func TestGoldenExchange(t *testing.T) {
+	NewScenario("golden-exchange").
+		Fixed().
+		Dilate(2).
+		ClientSends(5, 200e6).
+		Golden().
+		Run(t)
+}
+
+// TestScenarioLatency checks that CCID 3 keeps the queueing delay of a rate-limited link with
+// an unbounded buffer in check, even though the client offers more than the link can carry.
+// The latencies include the wait in the send queue of the client. A few messages of the slow
+// start wait much longer, so the tail of the distribution is left out.
+func TestScenarioLatency(t *testing.T) {
+	NewScenario("scenario-latency").
+		Virtual().
+		Payload(1000).
+		BandwidthAfter(0, 20e3, 0).
+		ClientSends(400, 10e6).
+		ExpectLatency(95, 1e9).
+		Run(t)
+}
+
+// TestDeliveryRecorder checks the percentiles of stamped delivery latencies
+func TestDeliveryRecorder(t *testing.T) {
+	env := dccp.NewEnv(nil)
+	var x DeliveryRecorder
+	payload := make([]byte, STAMP_LEN)
+	Stamp(env, payload)
+	sent, _ := Stamped(payload)
+	for i := int64(1); i <= 100; i++ {
+		x.Add(payload, sent+i*1e6)
+	}
+	if x.Add(payload[:STAMP_LEN-1], sent) {
+		t.Errorf("unstamped payload recorded")
+	}
+	for _, c := range []struct {
+		p    float64
+		want int64
+	}{
+		{ 0, 1e6 }, { 50, 50e6 }, { 95, 95e6 }, { 100, 100e6 },
+	} {
+		if l := x.Percentile(c.p); l != c.want {
+			t.Errorf("%g-th percentile %d, expected %d", c.p, l, c.want)
+		}
+	}
+	x.CheckPercentile(t, 90, 90e6)
+}
+
+// TestScenarioHandover checks that the round-trip time estimate of CCID 3 settles on the new
+// path within 20 of its RTTs after a handover, in which the RTT of the path grows from 50ms to
+// 300ms and its capacity shrinks, and that the connection survives the handover without a
+// reset. CCID 3 takes a while to get going on the old path, so the handover comes late. The
+// RTT estimate runs some tens of milliseconds above the RTT of the path. The rate after the
+// handover is checked by TestScenarioHandoverRate. The scenario runs on virtual time, so that
+// the load of the machine does not perturb the estimate.
+func TestScenarioHandover(t *testing.T) {
+	NewScenario("scenario-handover").
+		Virtual().
+		Payload(1000).
+		At(0, func(r *ScenarioRun) {
+			r.ClientToServer.SetWriteLatency(25e6)
+			r.ServerToClient.SetWriteLatency(25e6)
+		}).
+		HandoverAfter(30e9, 150e6, 30e3, 10e3).
+		SampleRTT(100e6).
+		ClientSends(500, 50e6).
+		ExpectRTT(36e9, 68e9, 320e6, 0.1).
+		ExpectNoReset().
+		Run(t)
+}
+
+// TestScenarioHandoverRate checks that the rate of CCID 3 returns to the 20 messages per second
+// that the client offers, within 20 RTTs of a handover to a path whose capacity of 30 messages
+// per second still carries them. No packets are lost, so the rate is limited by the receive
+// rate, which currently holds it at the floor of two segments per RTT instead.
+func TestScenarioHandoverRate(t *testing.T) {
+	t.Skip("the rate settles at the floor of two segments per RTT, see the Segment size item in ccid3/TODO")
+	NewScenario("scenario-handover-rate").
+		Virtual().
+		Payload(1000).
+		At(0, func(r *ScenarioRun) {
+			r.ClientToServer.SetWriteLatency(25e6)
+			r.ServerToClient.SetWriteLatency(25e6)
+		}).
+		HandoverAfter(30e9, 150e6, 30e3, 10e3).
+		ClientSends(1500, 50e6).
+		ExpectRate(36e9, 68e9, 18, 21).
+		ExpectNoReset().
+		Run(t)
+}
+
+// TestScenarioProfile checks how CCID 3 tracks a link whose capacity steps up from 20 KBps to
+// 40 KBps at 25s, and down to 10 KBps at 40s, while the client offers more than the link can
+// carry. The buffer of the link is unbounded, so the sender must find the decrease from the
+// growing delay alone: the receive rate falls to the new capacity, and the round-trip time
+// returns close to that of a link with a short queue within a few seconds. The increase is
+// used only slowly, see the Segment size item in ccid3/TODO: five seconds after the step up,
+// the rate must exceed the 20 messages per second of the old capacity, but it stays well short
+// of the 40 of the new one. The scenario runs on virtual time, so that the load of the machine
+// does not perturb the rates.
+func TestScenarioProfile(t *testing.T) {
+	NewScenario("scenario-profile").
+		Virtual().
+		Payload(1000).
+		At(0, func(r *ScenarioRun) {
+			r.ClientToServer.SetWriteLatency(25e6)
+			r.ServerToClient.SetWriteLatency(25e6)
+		}).
+		ProfileAfter(0, StepProfile(ProfileStep{ 0, 20e3 }, ProfileStep{ 25e9, 40e3 }, ProfileStep{ 40e9, 10e3 }), 0).
+		SampleRTT(100e6).
+		ClientSends(5500, 10e6).
+		ExpectRate(30e9, 40e9, 22, 40).
+		ExpectRate(42e9, 55e9, 7, 11).
+		ExpectRTT(48e9, 55e9, 200e6, 0.5).
+		ExpectNoReset().
+		Run(t)
+}
+
+// TestScenarioLatencyBreakdown checks the stages of the write path that the latency of the
+// client's messages is broken down into. The client writes faster than CCID 3 sends in slow
+// start, so its messages wait in the write queue, and the link takes 50ms in each direction.
+// The scenario runs on virtual time, so that the load of the machine does not add to the
+// flight times.
+func TestScenarioLatencyBreakdown(t *testing.T) {
+	NewScenario("scenario-breakdown").
+		Virtual().
+		At(0, func(r *ScenarioRun) {
+			r.ClientToServer.SetWriteLatency(50e6)
+			r.ServerToClient.SetWriteLatency(50e6)
+		}).
+		ClientSends(50, 0).
+		Expect("latency breakdown", func(r *ScenarioRun) error {
+			l := r.Client.Latency()
+			switch {
+			case l.Queue.Count != 50 || l.Queue.Max <= 0:
+				return fmt.Errorf("queue %+v", l.Queue)
+			case l.Gate.Count != 50:
+				return fmt.Errorf("gate %+v", l.Gate)
+			case l.Flight.Count == 0 || l.Flight.Mean() < 100e6 || l.Flight.Mean() > 150e6:
+				return fmt.Errorf("flight %+v", l.Flight)
+			}
+			return nil
+		}).
+		Run(t)
+}
@@ -0,0 +1,192 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// SeriesRecorder samples the dynamics of a sandbox run at regular intervals and produces time
+// series suitable for plotting. It is a dccp.TraceWriter which retains the latest value of every
+// sample series (such as X, X_recv, RTT and the loss event rate p) emitted by each connection,
+// and it also polls any number of probes (such as pipe queue depths). Columns are named
+// "connection/series", where connection is the first label of the emitting Amb.
+type SeriesRecorder struct {
+	env      *dccp.Env
+	interval int64
+
+	sync.Mutex
+	latest   map[string]float64
+	probes   map[string]func() float64
+	rows     []seriesRow
+	stop     chan int
+}
+
+type seriesRow struct {
+	Time   int64              `json:"t"`
+	Values map[string]float64 `json:"v"`
+}
+
+// NewSeriesRecorder creates a recorder that takes a snapshot every interval nanoseconds,
+// once started
+func NewSeriesRecorder(env *dccp.Env, interval int64) *SeriesRecorder {
+	return &SeriesRecorder{
+		env:      env,
+		interval: interval,
+		latest:   make(map[string]float64),
+		probes:   make(map[string]func() float64),
+	}
+}
+
+// AddProbe adds a column whose value is obtained by calling probe at every snapshot
+func (x *SeriesRecorder) AddProbe(name string, probe func() float64) {
+	x.Lock()
+	defer x.Unlock()
+	x.probes[name] = probe
+}
+
+// Start begins taking snapshots in a goroutine of the Env
+func (x *SeriesRecorder) Start() {
+	x.Lock()
+	defer x.Unlock()
+	if x.stop != nil {
+		panic("series recorder already started")
+	}
+	stop := make(chan int)
+	x.stop = stop
+	x.env.Go(func() {
+		for {
+			x.env.Sleep(x.interval)
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			x.snapshot()
+		}
+	}, "SeriesRecorder")
+}
+
+// Stop stops taking snapshots
+func (x *SeriesRecorder) Stop() {
+	x.Lock()
+	defer x.Unlock()
+	if x.stop != nil {
+		close(x.stop)
+		x.stop = nil
+	}
+}
+
+func (x *SeriesRecorder) snapshot() {
+	x.Lock()
+	defer x.Unlock()
+	row := seriesRow{ Time: x.env.Now(), Values: make(map[string]float64) }
+	for k, v := range x.latest {
+		row.Values[k] = v
+	}
+	for k, probe := range x.probes {
+		row.Values[k] = probe()
+	}
+	x.rows = append(x.rows, row)
+}
+
+// Write implements dccp.TraceWriter.Write
+func (x *SeriesRecorder) Write(r *dccp.Trace) {
+	sample, ok := r.Sample()
+	if !ok || len(r.Labels) == 0 {
+		return
+	}
+	x.Lock()
+	defer x.Unlock()
+	x.latest[r.Labels[0] + "/" + sample.Series] = sample.Value
+}
+
+func (x *SeriesRecorder) Sync() error { return nil }
+
+func (x *SeriesRecorder) Close() error {
+	x.Stop()
+	return nil
+}
+
+// columns returns the sorted names of all columns that start with prefix
+func (x *SeriesRecorder) columns(prefix string) []string {
+	seen := make(map[string]bool)
+	for _, row := range x.rows {
+		for k := range row.Values {
+			if strings.HasPrefix(k, prefix) {
+				seen[k] = true
+			}
+		}
+	}
+	var cols []string
+	for k := range seen {
+		cols = append(cols, k)
+	}
+	sort.Strings(cols)
+	return cols
+}
+
+// WriteCSV writes the recorded time series of connection conn as CSV, with a header row and
+// one row per snapshot. The first column is the time in nanoseconds. Values that were not yet
+// known at a snapshot are left empty. An empty conn selects all columns.
+func (x *SeriesRecorder) WriteCSV(w io.Writer, conn string) error {
+	x.Lock()
+	defer x.Unlock()
+	prefix := ""
+	if conn != "" {
+		prefix = conn + "/"
+	}
+	cols := x.columns(prefix)
+	cw := csv.NewWriter(w)
+	if err := cw.Write(append([]string{"time"}, cols...)); err != nil {
+		return err
+	}
+	for _, row := range x.rows {
+		rec := []string{ strconv.FormatInt(row.Time, 10) }
+		for _, c := range cols {
+			v, ok := row.Values[c]
+			if !ok {
+				rec = append(rec, "")
+				continue
+			}
+			rec = append(rec, strconv.FormatFloat(v, 'g', -1, 64))
+		}
+		if err := cw.Write(rec); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSON writes the recorded time series of connection conn as a JSON object, mapping each
+// column name to its list of [time, value] points. An empty conn selects all columns.
+func (x *SeriesRecorder) WriteJSON(w io.Writer, conn string) error {
+	x.Lock()
+	defer x.Unlock()
+	prefix := ""
+	if conn != "" {
+		prefix = conn + "/"
+	}
+	series := make(map[string][][2]float64)
+	for _, c := range x.columns(prefix) {
+		series[c] = [][2]float64{}
+	}
+	for _, row := range x.rows {
+		for c, v := range row.Values {
+			if _, ok := series[c]; ok {
+				series[c] = append(series[c], [2]float64{ float64(row.Time), v })
+			}
+		}
+	}
+	return json.NewEncoder(w).Encode(series)
+}
@@ -0,0 +1,44 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+func TestSeriesRecorder(t *testing.T) {
+	env := dccp.NewEnv(nil)
+	rec := NewSeriesRecorder(env, 1e6)
+	depth := 0.0
+	rec.AddProbe("client/queue", func() float64 { return depth })
+
+	rec.snapshot()
+	rec.Write(&dccp.Trace{
+		Labels: []string{"client", "sender"},
+		Args:   map[string]interface{}{ dccp.SampleType: dccp.NewSample("RTT", 20, "ms") },
+	})
+	depth = 3
+	rec.snapshot()
+
+	var w bytes.Buffer
+	if err := rec.WriteCSV(&w, "client"); err != nil {
+		t.Fatalf("csv (%s)", err)
+	}
+	lines := strings.Split(strings.TrimSpace(w.String()), "\n")
+	if len(lines) != 3 || lines[0] != "time,client/RTT,client/queue" {
+		t.Fatalf("unexpected csv:\n%s", w.String())
+	}
+	if !strings.HasSuffix(lines[1], ",,0") || !strings.HasSuffix(lines[2], ",20,3") {
+		t.Errorf("unexpected csv rows:\n%s", w.String())
+	}
+
+	w.Reset()
+	if err := rec.WriteCSV(&w, "server"); err != nil || !strings.HasPrefix(w.String(), "time\n") {
+		t.Errorf("server should have no columns:\n%s", w.String())
+	}
+}
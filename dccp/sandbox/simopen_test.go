@@ -0,0 +1,58 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"sync"
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+	"github.com/petar/GoDCCP/dccp/ccid3"
+)
+
+// TestSimultaneousOpen connects two clients to each other, so that their Requests cross. The
+// ISNs are fixed, so that the crossing is resolved by comparing them, or, if the first ones
+// are equal, by retrying.
+func TestSimultaneousOpen(t *testing.T) {
+	for _, isns := range [][]int64{{1e6, 2e6}, {2e6, 1e6}, {1e6, 1e6, 5e6, 3e6}} {
+		testSimultaneousOpen(t, isns)
+	}
+}
+
+func testSimultaneousOpen(t *testing.T, isns []int64) {
+	env, _ := NewEnvTime(dccp.NewDilatedTime(idleDilation), "simopen")
+	var lk sync.Mutex
+	env.SetISNFunc(func() int64 {
+		lk.Lock()
+		defer lk.Unlock()
+		iss := isns[0]
+		if len(isns) > 1 {
+			isns = isns[1:]
+		}
+		return iss
+	})
+	llog := dccp.NewAmb("line", env)
+	hca, hcb, _ := NewPipe(env, llog, "a", "b")
+	ccid := ccid3.CCID3{}
+	alog, blog := dccp.NewAmb("a", env), dccp.NewAmb("b", env)
+	a := dccp.NewConnClient(env, alog, hca, ccid.NewSender(env, alog), ccid.NewReceiver(env, alog), 0)
+	b := dccp.NewConnClient(env, blog, hcb, ccid.NewSender(env, blog), ccid.NewReceiver(env, blog), 0)
+
+	payload := []byte{1, 2, 3}
+	for _, x := range [][2]*dccp.Conn{{a, b}, {b, a}} {
+		if err := x[0].Write(payload); err != nil {
+			t.Fatalf("write (%s)", err)
+		}
+		if p, err := x[1].Read(); err != nil || len(p) != len(payload) {
+			t.Errorf("read %v (%v)", p, err)
+		}
+	}
+
+	a.Abort()
+	b.Abort()
+	env.NewGoJoin("end-of-test", a.Joiner(), b.Joiner()).Join()
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+	"github.com/petar/GoDCCP/dccp/stream"
+)
+
+// streamLen is the number of bytes copied by TestStream
+const streamLen = 64*1024
+
+// pacedReader reads from r at most 1KB at a time, and sleeps before each read, so that the
+// receiving end is not swamped
+type pacedReader struct {
+	env *dccp.Env
+	r   io.Reader
+}
+
+func (p *pacedReader) Read(b []byte) (int, error) {
+	if len(b) > 1024 {
+		b = b[:1024]
+	}
+	p.env.Sleep(10e6)
+	return p.r.Read(b)
+}
+
+// TestStream copies a byte stream from the client to the server through a stream.Stream on
+// each end, and checks that the server reads all bytes followed by io.EOF. The stream does
+// not survive loss, so the test keeps the path lossless: it runs on virtual time, where the
+// server reads its link as fast as packets arrive, the client writes at a pace that the pipe
+// carries without overflowing, and the read queue of the server holds as many frames as a
+// Conn allows.
+func TestStream(t *testing.T) {
+	Virtual(t, testStream)
+}
+
+func testStream(t *testing.T, tm dccp.Time) {
+	env, _ := NewEnvTime(tm, "stream")
+	clientConn, serverConn, clientToServer, serverToClient := NewClientServerPipe(env)
+	clientToServer.SetWriteLatency(10e6)
+	serverToClient.SetWriteLatency(10e6)
+	if err := serverConn.SetReadQueue(dccp.READ_QUEUE_MAX, 0); err != nil {
+		t.Fatalf("read queue (%s)", err)
+	}
+
+	sent := make([]byte, streamLen)
+	for i := range sent {
+		sent[i] = byte(env.Int63n(256))
+	}
+	done := make(chan int)
+	env.Go(func() {
+		defer close(done)
+		s := stream.New(clientConn)
+		if _, err := io.Copy(s, &pacedReader{env, bytes.NewReader(sent)}); err != nil {
+			t.Errorf("client copy (%s)", err)
+		}
+		if err := s.Close(); err != nil {
+			t.Errorf("client close (%s)", err)
+		}
+	}, "test client")
+
+	// ReadAll returns a nil error once Read returns io.EOF
+	received, err := ioutil.ReadAll(stream.New(serverConn))
+	<-done
+	switch {
+	case err != nil:
+		t.Errorf("server read %d of %d bytes (%s)", len(received), len(sent), err)
+	case !bytes.Equal(received, sent):
+		t.Errorf("server read %d bytes that differ from the %d sent", len(received), len(sent))
+	}
+
+	clientConn.Abort()
+	serverConn.Abort()
+	env.NewGoJoin("end-of-test", clientConn.Joiner(), serverConn.Joiner()).Join()
+	dccp.NewAmb("line", env).E(dccp.EventMatch, "Server and client done.")
+	if err := env.Close(); err != nil {
+		t.Errorf("error closing runtime (%s)", err)
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"testing"
+	"testing/synctest"
+	"time"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// Virtual runs f in a testing/synctest bubble and passes it a Time for its Envs, which runs on
+// the virtual clock of the bubble. Virtual time advances only once every goroutine of the
+// bubble is blocked, so a run takes as long as its computation, and its outcome does not
+// depend on the load of the machine the way that of a run on dilated time does. The
+// goroutines that f starts must block on channels, sleeps and timers of the bubble, rather
+// than spin, and they must all have exited when f returns.
+func Virtual(t *testing.T, f func(t *testing.T, tm dccp.Time)) {
+	synctest.Test(t, func(t *testing.T) {
+		f(t, newBubbleTime())
+	})
+}
+
+// bubbleTime is a Time that reads and sleeps on the clock of the time package, which is
+// virtual inside a synctest bubble. Unlike dccp.RealTime, it does not implement PreciseTime:
+// a precise sleep spins for its last stretch, and the clock of a bubble stands still while a
+// goroutine spins.
+type bubbleTime struct {
+	zero  time.Time
+	start int64
+}
+
+func newBubbleTime() *bubbleTime {
+	now := time.Now()
+	return &bubbleTime{ zero: now, start: now.UnixNano() }
+}
+
+func (x *bubbleTime) Now() int64 { return x.start + int64(time.Since(x.zero)) }
+
+func (x *bubbleTime) Sleep(ns int64) { time.Sleep(time.Duration(ns)) }
+
+// Alarm implements dccp.AlarmTime.Alarm
+func (x *bubbleTime) Alarm(ns int64) (<-chan time.Time, func() bool) {
+	t := time.NewTimer(time.Duration(ns))
+	return t.C, t.Stop
+}
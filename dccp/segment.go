@@ -20,10 +20,12 @@ type SegmentConn interface {
 	GetMTU() int
 
 	// Read returns an ErrTimeout in the event of a timeout. See SetReadExpire.
+	// The returned block is owned by the caller. It may be a slice of the buffer that the
+	// underlying link received into, so implementations must not reuse it.
 	Read() (block []byte, err error)
 
 	// If the user attempts to write a block that is too big, an ErrTooBig is returned
-	// and the block is not sent.
+	// and the block is not sent. Write must not retain block after it returns.
 	Write(block []byte) (err error)
 
 	LocalLabel() Bytes
@@ -47,6 +49,58 @@ type SegmentDialAccepter interface {
 	Close() error
 }
 
+// PathConn is implemented by SegmentConn and HeaderConn objects whose Link-level path can change
+// while the connection is established, like the flows of a Mux over a RebindLink.
+type PathConn interface {
+	// Migrate moves the local end of the connection to the Link-level address laddr. It
+	// returns ErrUnsupported if the underlying link cannot be rebound.
+	Migrate(laddr net.Addr) error
+
+	// ConfirmPath is called once the last packet read has been validated. If that packet
+	// was received from a Link-level address other than the current remote address, the
+	// peer has migrated: the remote address is updated and ConfirmPath returns true.
+	ConfirmPath() bool
+}
+
+// AddrConn is implemented by SegmentConn and HeaderConn objects that know the Link-level
+// addresses of their ends, like the flows of a Mux over a UDPLink or an IPLink
+type AddrConn interface {
+	// LocalAddr returns the Link-level address of the local end, or nil if it is unknown
+	LocalAddr() net.Addr
+
+	// RemoteAddr returns the Link-level address of the remote end, or nil if it is unknown
+	RemoteAddr() net.Addr
+}
+
+// TrafficClassConn is implemented by SegmentConn and HeaderConn objects that can mark their
+// outgoing packets with an IP traffic class, like the flows of a Mux over a TrafficClassLink
+type TrafficClassConn interface {
+	// SetTrafficClass marks the packets subsequently written with traffic class tos. It
+	// returns ErrUnsupported if the underlying link cannot mark packets.
+	SetTrafficClass(tos byte) error
+}
+
+// SegmentNotifier is implemented by SegmentConns that can hand the blocks they receive to a
+// function as they arrive, instead of having a goroutine block in Read, like the flows of a Mux
+type SegmentNotifier interface {
+	// NotifyBlocks makes the SegmentConn call f with every block that it receives from now on,
+	// including the ones already waiting to be read, in order of arrival. Once the underlying
+	// link is broken, f is called one last time with a nil block and an error. The calls are
+	// made from a goroutine that is shared with other connections, so f must not block. Read
+	// must not be called after NotifyBlocks.
+	NotifyBlocks(f func(block []byte, err error))
+}
+
+// HeaderNotifier is implemented by HeaderConns that can hand the headers they receive to a
+// function as they arrive, instead of having a goroutine block in Read
+type HeaderNotifier interface {
+	// NotifyHeaders behaves like SegmentNotifier.NotifyBlocks, except that f is called with
+	// headers. Headers that fail to decode are passed on as their error. NotifyHeaders returns
+	// false, and does nothing, if the HeaderConn cannot notify after all, in which case the
+	// headers must be read with Read.
+	NotifyHeaders(f func(h *Header, err error)) bool
+}
+
 // Implementors of this interface MUST only return i/o errors defined in the dccp package (ErrEOF,
 // ErrBad, ErrTimeout, etc.)
 type HeaderConn interface {
@@ -57,7 +111,9 @@ type HeaderConn interface {
 	// Read returns ErrTimeout in the event of timeout. See SetReadExpire.
 	Read() (h *Header, err error)
 
-	// Write can return ErrTooBig, if the wire-format of h exceeds the MTU
+	// Write can return ErrTooBig, if the wire-format of h exceeds the MTU. The Conn reuses the
+	// options of h for its next packet, so Write must copy h, see Header.Copy, to retain it
+	// after it returns.
 	Write(h *Header) (err error)
 
 	LocalLabel() Bytes
@@ -86,18 +142,38 @@ func (hc *headerConn) GetMTU() int {
 
 // Since a SegmentConn already has the notion of a flow, both Read
 // and Write pass zero labels for the Source and Dest IPs
-// to the DCCP header's read and write functions.
+// to the DCCP header's read and write functions. Short sequence
+// numbers pass, since the Conn decides whether they are allowed.
 
 func (hc *headerConn) Read() (h *Header, err error) {
 	p, err := hc.bc.Read()
 	if err != nil {
 		return nil, err
 	}
-	return ReadHeader(p, LabelZero.Bytes(), LabelZero.Bytes(), AnyProto, false)
+	return ReadHeader(p, LabelZero.Bytes(), LabelZero.Bytes(), AnyProto, true)
+}
+
+// NotifyHeaders implements HeaderNotifier.NotifyHeaders, if the underlying SegmentConn is a
+// SegmentNotifier
+func (hc *headerConn) NotifyHeaders(f func(h *Header, err error)) bool {
+	sn, ok := hc.bc.(SegmentNotifier)
+	if !ok {
+		return false
+	}
+	sn.NotifyBlocks(func(p []byte, err error) {
+		if err != nil {
+			f(nil, err)
+			return
+		}
+		f(ReadHeader(p, LabelZero.Bytes(), LabelZero.Bytes(), AnyProto, true))
+	})
+	return true
 }
 
 func (hc *headerConn) Write(h *Header) (err error) {
-	p, err := h.Write(LabelZero.Bytes(), LabelZero.Bytes(), AnyProto, false)
+	b := getBuffer(0)
+	defer putBuffer(b)
+	p, err := h.WriteInto(*b, LabelZero.Bytes(), LabelZero.Bytes(), AnyProto, true)
 	if err != nil {
 		return err
 	}
@@ -119,3 +195,44 @@ func (hc *headerConn) SetReadExpire(nsec int64) error {
 func (hc *headerConn) Close() error {
 	return hc.bc.Close()
 }
+
+// Migrate implements PathConn.Migrate, if the underlying SegmentConn is a PathConn
+func (hc *headerConn) Migrate(laddr net.Addr) error {
+	pc, ok := hc.bc.(PathConn)
+	if !ok {
+		return ErrUnsupported
+	}
+	return pc.Migrate(laddr)
+}
+
+// LocalAddr implements AddrConn.LocalAddr, if the underlying SegmentConn is an AddrConn
+func (hc *headerConn) LocalAddr() net.Addr {
+	if ac, ok := hc.bc.(AddrConn); ok {
+		return ac.LocalAddr()
+	}
+	return nil
+}
+
+// RemoteAddr implements AddrConn.RemoteAddr, if the underlying SegmentConn is an AddrConn
+func (hc *headerConn) RemoteAddr() net.Addr {
+	if ac, ok := hc.bc.(AddrConn); ok {
+		return ac.RemoteAddr()
+	}
+	return nil
+}
+
+// SetTrafficClass implements TrafficClassConn.SetTrafficClass, if the underlying SegmentConn
+// is a TrafficClassConn
+func (hc *headerConn) SetTrafficClass(tos byte) error {
+	tc, ok := hc.bc.(TrafficClassConn)
+	if !ok {
+		return ErrUnsupported
+	}
+	return tc.SetTrafficClass(tos)
+}
+
+// ConfirmPath implements PathConn.ConfirmPath
+func (hc *headerConn) ConfirmPath() bool {
+	pc, ok := hc.bc.(PathConn)
+	return ok && pc.ConfirmPath()
+}
@@ -24,6 +24,7 @@ const (
 	seqAckNormal = iota + 1
 	seqAckAbnormal
 	seqAckSyncAck
+	seqAckSync
 )
 
 func (c *Conn) WriteSeqAck(h *writeHeader) {
@@ -33,6 +34,10 @@ func (c *Conn) WriteSeqAck(h *writeHeader) {
 		c.takeSeqAck(&h.Header)
 	case seqAckAbnormal:
 		c.takeAbnormalSeqAck(&h.Header, h.InResponseTo)
+	case seqAckSync:
+		ackNo := h.Header.AckNo
+		c.takeSeqAck(&h.Header)
+		h.Header.AckNo = ackNo
 	case seqAckSyncAck:
 		c.takeSeqAck(&h.Header)
 		if h.InResponseTo.Type != Sync {
@@ -0,0 +1,54 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import "fmt"
+
+// Section 7.5.2: The Sequence Window of an endpoint should be about 5 times the number of
+// packets it sends in a round-trip time, so that a burst of losses does not push the peer out
+// of sync. A Conn measures its sending rate about once per RTT, and when the rate outgrows
+// the window, it renegotiates its Sequence Window to SEQWIN_SAFETY times the recommended
+// size. The window only grows, up to SEQWIN_GROW_MAX.
+const (
+	SEQWIN_PACKETS_PER_RTT = 5       // Recommended Sequence Window, in packets sent per RTT
+	SEQWIN_SAFETY          = 2       // Headroom of a grown window over the recommended size
+	SEQWIN_GROW_MAX        = 1 << 22 // Largest grown window, which leaves short sequence numbers unambiguous
+)
+
+// adjustSequenceWindow measures the number of packets sent per RTT since its last call, and
+// grows the local Sequence Window if it is less than the recommended size
+func (c *Conn) adjustSequenceWindow() {
+	c.AssertLocked()
+	now, gss := c.env.Now(), c.socket.GetGSS()
+	if c.socket.GetState() != OPEN {
+		c.seqWinTime, c.seqWinGSS = 0, 0
+		return
+	}
+	if c.seqWinTime == 0 {
+		c.seqWinTime, c.seqWinGSS = now, gss
+		return
+	}
+	rtt, elapsed := c.socket.GetRTT(), now-c.seqWinTime
+	if elapsed < rtt {
+		return
+	}
+	perRTT := ((gss-c.seqWinGSS)*rtt + elapsed - 1) / elapsed
+	c.seqWinTime, c.seqWinGSS = now, gss
+
+	k := featureKey{FeatureLocal, FeatureSequenceWindow}
+	f := c.feature(k)
+	current := f.value
+	if f.state != featureStable {
+		// A pending change settles first
+		current = f.prefs[0]
+	}
+	want := uint64(SEQWIN_PACKETS_PER_RTT * perRTT)
+	if want <= current || current >= SEQWIN_GROW_MAX {
+		return
+	}
+	w := min64(SEQWIN_SAFETY*int64(want), SEQWIN_GROW_MAX)
+	c.amb.E(EventInfo, fmt.Sprintf("Sequence Window %d short of %d packets per RTT, growing to %d", current, perRTT, w))
+	c.changeFeature(k, []uint64{uint64(w)})
+}
@@ -4,6 +4,12 @@
 
 package dccp
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 // After '8.1.2. Service Codes'
 
 func isValidServiceCode(sc uint32) bool { return sc != 4294967295 }
@@ -34,9 +40,9 @@ func isASCIIServiceCodeChar(c byte) bool {
 
 func serviceCodeToSlice(u uint32) []byte {
 	p := make([]byte, 4)
-	p[0] = byte(u >> 3 * 8)
-	p[1] = byte((u >> 2 * 8) & 0xff)
-	p[2] = byte((u >> 1 * 8) & 0xff)
+	p[0] = byte(u >> (3 * 8))
+	p[1] = byte((u >> (2 * 8)) & 0xff)
+	p[2] = byte((u >> (1 * 8)) & 0xff)
 	p[3] = byte(u & 0xff)
 	return p
 }
@@ -53,18 +59,39 @@ func sliceToServiceCode(p []byte) uint32 {
 	return s
 }
 
-// TODO: Implement additional string representations according to '8.1.2. Service Codes'
-
+// ServiceCodeString returns the text form of a Service Code, '8.1.2. Service Codes'. Codes
+// whose bytes are all displayable characters are written as "SC:" followed by the
+// characters, with trailing spaces omitted. Other codes are written as "SC=" followed by
+// the code in decimal.
 func ServiceCodeString(code uint32) string {
-	return "SC:" + string(serviceCodeToSlice(code))
+	p := serviceCodeToSlice(code)
+	for _, c := range p {
+		if !isASCIIServiceCodeChar(c) {
+			return fmt.Sprintf("SC=%d", code)
+		}
+	}
+	return "SC:" + strings.TrimRight(string(p), " ")
 }
 
+// ParseServiceCode parses the text form of a Service Code, as written by ServiceCodeString
 func ParseServiceCode(p []byte) (uint32, error) {
-	if len(p) != 7 {
+	if len(p) <= 3 {
 		return 0, ErrSyntax
 	}
-	if string(p[:3]) != "SC:" {
-		return 0, ErrSyntax
+	switch string(p[:3]) {
+	case "SC:":
+		if len(p) > 7 {
+			return 0, ErrSyntax
+		}
+		q := []byte("    ")
+		copy(q, p[3:])
+		return sliceToServiceCode(q), nil
+	case "SC=":
+		code, err := strconv.ParseUint(string(p[3:]), 10, 32)
+		if err != nil {
+			return 0, ErrSyntax
+		}
+		return uint32(code), nil
 	}
-	return sliceToServiceCode(p[3:7]), nil
+	return 0, ErrSyntax
 }
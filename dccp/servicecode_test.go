@@ -0,0 +1,31 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"testing"
+)
+
+var serviceCodeTests = []struct {
+	code uint32
+	text string
+}{
+	{0x50494e47, "SC:PING"},
+	{0x48545450, "SC:HTTP"},
+	{0x52545020, "SC:RTP"},
+	{0, "SC=0"},
+	{0x12345678, "SC=305419896"},
+}
+
+func TestServiceCodeString(t *testing.T) {
+	for _, x := range serviceCodeTests {
+		if s := ServiceCodeString(x.code); s != x.text {
+			t.Errorf("code %#x: %s, expecting %s", x.code, s, x.text)
+		}
+		if code, err := ParseServiceCode([]byte(x.text)); err != nil || code != x.code {
+			t.Errorf("parse %s: %#x (%v), expecting %#x", x.text, code, err, x.code)
+		}
+	}
+}
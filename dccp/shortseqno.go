@@ -0,0 +1,57 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+// Section 7.6: Data, Ack and DataAck packets may carry short, 24-bit sequence and
+// acknowledgement numbers, if the Allow Short Seqnos feature of their sender is 1. The
+// feature is located at the sender, Section 7.6.1, so the local value permits the Conn to
+// send short sequence numbers, while the remote value permits the peer to.
+
+const shortSeqNoLen = 1 << 24
+
+// extendSeqNo returns the 48-bit sequence number whose low 24 bits are those of s, and which
+// is closest to ref, circularly, Section 7.6.1
+func extendSeqNo(s, ref int64) int64 {
+	x := ref&^(shortSeqNoLen-1) | s&(shortSeqNoLen-1)
+	switch {
+	case x-ref > shortSeqNoLen/2:
+		x -= shortSeqNoLen
+	case ref-x > shortSeqNoLen/2:
+		x += shortSeqNoLen
+	}
+	return x & (1<<48 - 1)
+}
+
+// allowsShortSeqNos returns true if the Allow Short Seqnos feature at loc is 1
+func (c *Conn) allowsShortSeqNos(loc FeatureLocation) bool {
+	return c.feature(featureKey{loc, FeatureAllowShortSeqNos}).value != 0
+}
+
+// placeShortSeqNo makes h carry short sequence numbers, if h is allowed to
+func (c *Conn) placeShortSeqNo(h *writeHeader) {
+	c.AssertLocked()
+	switch h.Type {
+	case Data, Ack, DataAck:
+		h.X = !c.allowsShortSeqNos(FeatureLocal)
+	}
+}
+
+// readShortSeqNo extends the short sequence and acknowledgement numbers of h to 48 bits,
+// relative to GSR and GSS. It returns false if the peer is not allowed to send short
+// sequence numbers, in which case h is to be dropped.
+func (c *Conn) readShortSeqNo(h *Header) bool {
+	c.AssertLocked()
+	if h.X {
+		return true
+	}
+	if !c.allowsShortSeqNos(FeatureRemote) {
+		return false
+	}
+	h.SeqNo = extendSeqNo(h.SeqNo, c.socket.GetGSR())
+	if h.HasAckNo() {
+		h.AckNo = extendSeqNo(h.AckNo, c.socket.GetGSS())
+	}
+	return true
+}
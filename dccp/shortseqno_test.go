@@ -0,0 +1,27 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import "testing"
+
+var extendSeqNoTests = []struct {
+	s, ref, x int64
+}{
+	{0x000005, 0x123000004, 0x123000005},
+	{0xfffffe, 0x123000004, 0x122fffffe},
+	{0x000002, 0x122fffffe, 0x123000002},
+	{0x7fffff, 0x100000000, 0x1007fffff},
+	{0x800001, 0x100000000, 0x0ff800001},
+	{0x000001, 0xfffffffffffe, 0x000000000001},
+	{0xfffffe, 0x000000000001, 0xfffffffffffe},
+}
+
+func TestExtendSeqNo(t *testing.T) {
+	for i, x := range extendSeqNoTests {
+		if e := extendSeqNo(x.s, x.ref); e != x.x {
+			t.Errorf("#%d: extended %06x near %012x to %012x, expected %012x", i, x.s, x.ref, e, x.x)
+		}
+	}
+}
@@ -7,7 +7,6 @@ package dccp
 import (
 	"bytes"
 	"fmt"
-	"math/rand"
 )
 
 // socket is a data structure, maintaining the DCCP socket variables.
@@ -70,7 +69,7 @@ func (s *socket) String() string {
 
 const (
 	SEQWIN_INIT             = 100      // Initial value for SWAF and SWBF, Section 7.5.2
-	SEQWIN_FIXED            = 700      // Large enough constant for SWAF/SWBF until the feature is implemented
+	SEQWIN_FIXED            = 700      // Initial SWAF/SWBF, until the Sequence Window feature is negotiated
 	SEQWIN_MAX              = 2^46 - 1 // Maximum acceptable SWAF and SWBF value
 	RoundtripDefault        = 2e8      // 0.2 sec, default Round-Trip Time when no measurement is available
 	RoundtripMin                 = 2e6      // ...
@@ -123,7 +122,9 @@ func ServerString(isServer bool) string {
 }
 
 func (s *socket) SetCCIDA(v byte) { s.CCIDA = v }
+func (s *socket) GetCCIDA() byte  { return s.CCIDA }
 func (s *socket) SetCCIDB(v byte) { s.CCIDB = v }
+func (s *socket) GetCCIDB() byte  { return s.CCIDB }
 
 func (s *socket) GetMPS() int32 { return min32(s.CCMPS, s.PMTU) }
 
@@ -145,9 +146,10 @@ func (s *socket) SetState(v int) { s.State = v }
 func (s *socket) SetServiceCode(v uint32) { s.ServiceCode = v }
 func (s *socket) GetServiceCode() uint32  { return s.ServiceCode }
 
-// ChooseISS chooses a safe Initial Sequence Number
-func (s *socket) ChooseISS() int64 {
-	iss := rand.Int63n(0xffffff-1) + 1
+// ChooseISS chooses a safe Initial Sequence Number for a connection between the local and
+// remote endpoints, using env's ISN selection
+func (s *socket) ChooseISS(env *Env, local, remote Bytes) int64 {
+	iss := env.ChooseISN(local, remote)
 	s.ISS = iss
 	return iss
 }
@@ -4,17 +4,55 @@
 
 package dccp
 
-import "fmt"
+import (
+	"bytes"
+	"fmt"
+)
+
+// Step 1, Section 8.5: Check header basics
+// The header has been parsed and its checksum verified already. What remains is to apply the
+// option and violation policies, so that packets with faulty options are dropped before they
+// can affect the connection state. Resets due to faulty options wait until Step 8, when the
+// sequence numbers of the packet have been verified.
+func (c *Conn) step1_CheckOptions(h *Header) error {
+	c.checkMandatory(h)
+	if h.optionFault == optionFaultNone {
+		return nil
+	}
+	verdict := c.getOptionPolicy().judge(h)
+	if verdict == optionAccept {
+		c.env.Deviate(c.amb, devOptionPolicy, h)
+		c.amb.E(EventWarn, "Skipped "+h.optionFaultString(), h)
+		return nil
+	}
+	switch c.violate(ViolationOptions, h, h.optionFaultString()) {
+	case ViolationsRFC:
+		if verdict == optionReset {
+			return nil
+		}
+	case ViolationsReset:
+		return nil
+	}
+	c.amb.E(EventDrop, "Strict on "+h.optionFaultString(), h)
+	return ErrDrop
+}
 
 // Step 2, Section 8.5: Check ports and process TIMEWAIT state
+// A CLOSED Conn has no socket left, so its packets are dropped as well. It sends no Resets,
+// since its write loop is gone.
 func (c *Conn) step2_ProcessTIMEWAIT(h *Header) error {
-	if c.socket.GetState() != TIMEWAIT {
+	switch c.socket.GetState() {
+	case CLOSED:
+		c.amb.E(EventDrop, "CLOSED", h)
+		return ErrDrop
+	case TIMEWAIT:
+	default:
 		return nil
 	}
 	if h.Type != Reset {
 		// In TIMEWAIT, the conn keeps responding with Reset until
 		// TIMEWAIT ends as scheduled by gotoTIMEWAIT
-		c.inject(c.generateAbnormalReset(ResetNoConnection, h))
+		c.injectReply(c.generateAbnormalReset(ResetNoConnection, h), h)
 	}
 	return ErrDrop
 }
@@ -25,6 +63,14 @@ func (c *Conn) step3_ProcessLISTEN(h *Header) error {
 		return nil
 	}
 	if h.Type == Request {
+		// A server that listens on a Service Code rejects the Requests for other services,
+		// Section 8.1.2
+		if sc := c.socket.GetServiceCode(); sc != 0 && h.ServiceCode != sc {
+			c.amb.E(EventWarn, "Bad Service Code", h)
+			c.inject(c.generateAbnormalReset(ResetBadServiceCode, h))
+			c.gotoCLOSED()
+			return ErrDrop
+		}
 		c.gotoRESPOND(h.ServiceCode, h.SeqNo)
 		return nil
 	}
@@ -32,7 +78,7 @@ func (c *Conn) step3_ProcessLISTEN(h *Header) error {
 	// we respond with with a Reset (unless the received packet was a Reset)
 	// without aborting the connection.
 	if h.Type != Reset {
-		c.inject(c.generateAbnormalReset(ResetNoConnection, h))
+		c.injectReply(c.generateAbnormalReset(ResetNoConnection, h), h)
 	}
 	return ErrDrop
 }
@@ -48,10 +94,17 @@ func (c *Conn) step4_PrepSeqNoREQUEST(h *Header) error {
 		c.PlaceSeqAck(h)
 		return nil
 	}
+	if h.Type == Request && h.ServiceCode == c.socket.GetServiceCode() && !c.env.StrictRFC() {
+		c.env.Deviate(c.amb, devSimultaneousOpen, h)
+		return c.resolveSimultaneousOpen(h)
+	}
+	if h.HasAckNo() && !inAckWindow {
+		c.suspectInjection(h, "acknowledges unsent Request")
+	}
 	// For forward compatibility, even though the client expects only Response
 	// packets in REQUEST mode, it responds to other packets with a ResetPacketError
 	// and does not abort the connection.
-	c.inject(c.generateReset(ResetPacketError))
+	c.injectReply(c.generateReset(ResetPacketError), h)
 	return ErrDrop
 }
 
@@ -61,49 +114,70 @@ func (c *Conn) step5_PrepSeqNoForSync(h *Header) error {
 		return nil
 	}
 	swl, _ := c.socket.GetSWLH()
-	if c.socket.InAckWindow(h.AckNo) && h.SeqNo >= swl {
+	inAckWindow := c.socket.InAckWindow(h.AckNo)
+	if inAckWindow && h.SeqNo >= swl {
 		c.socket.UpdateGSR(h.SeqNo)
 		return nil
 	}
+	if !inAckWindow {
+		c.suspectInjection(h, "Sync acknowledges unsent packet")
+	}
 	return ErrDrop
 }
 
 // Step 6, Section 8.5: Check sequence numbers
 func (c *Conn) step6_CheckSeqNo(h *Header) error {
-	// We don't support short sequence numbers
-	if !h.X {
-		return ErrDrop
-	}
-
+	// Short sequence numbers were extended to 48 bits when h was read
 	swl, swh := c.socket.GetSWLH()
 	awl, awh := c.socket.GetAWLH()
 	lswl, lawl := swl, awl
 
 	gsr := c.socket.GetGSR()
 	gar := c.socket.GetGAR()
-	if h.Type == CloseReq || h.Type == Close || h.Type == Reset {
+	// In REQUEST, a Reset was matched to our Request by its AckNo in Step 4, which set GSR to
+	// its SeqNo
+	answersRequest := h.Type == Reset && c.socket.GetState() == REQUEST
+	if (h.Type == CloseReq || h.Type == Close || h.Type == Reset) && !answersRequest {
 		lswl, lawl = gsr+1, gar
 	}
 
 	hasAckNo := h.HasAckNo()
-	if (lswl <= h.SeqNo && h.SeqNo <= swh) && (!hasAckNo || (lawl <= h.AckNo && h.AckNo <= awh)) {
+	ackValid := !hasAckNo || (lawl <= h.AckNo && h.AckNo <= awh)
+	if (lswl <= h.SeqNo && h.SeqNo <= swh) && ackValid {
+		// Section 7.5.5: A valid Reset tears the connection down, so an attacker who guesses
+		// a sequence number within the window could do so too. Resets are therefore honored
+		// only if they carry exactly the next expected sequence number. A peer in TIMEWAIT
+		// answers the Sync below with a Reset that does. Strict mode honors them all.
+		if h.Type == Reset && !answersRequest && h.SeqNo != gsr+1 && !c.env.StrictRFC() {
+			c.env.Deviate(c.amb, devInexactReset, h)
+			c.suspectInjection(h, "inexact Reset")
+			c.injectReply(c.generateSync(gsr), h)
+			return ErrDrop
+		}
 		c.socket.UpdateGSR(h.SeqNo)
 		if h.Type != Sync {
 			if hasAckNo {
 				c.socket.UpdateGAR(h.AckNo)
 			}
 		}
+		if h.Type != Reset {
+			c.resetChain = 0
+		}
 		return nil
 	} else {
-		var g *writeHeader = c.generateSync()
+		switch {
+		case h.Type == Reset:
+			c.suspectInjection(h, "Reset outside window")
+		case !ackValid:
+			c.suspectInjection(h, "acknowledges unsent packet")
+		}
 		if h.Type == Reset {
 			// Send Sync packet acknowledging S.GSR
-			g.AckNo = gsr
+			c.injectReply(c.generateSync(gsr), h)
 		} else {
 			// Send Sync packet acknowledging P.seqno
-			g.AckNo = h.SeqNo
+			c.injectReply(c.generateSync(h.SeqNo), h)
 		}
-		c.inject(g)
 		return ErrDrop
 	}
 	panic("unreach")
@@ -120,9 +194,12 @@ func (c *Conn) step7_CheckUnexpectedTypes(h *Header) error {
 		(state >= OPEN && h.Type == Request && h.SeqNo >= osr) ||
 		(state >= OPEN && h.Type == Response && h.SeqNo >= osr) ||
 		(state == RESPOND && h.Type == Data) {
-		g := c.generateSync()
-		g.AckNo = h.SeqNo
-		c.inject(g)
+		switch c.violate(ViolationType, h, "Unexpected packet type") {
+		case ViolationsRFC:
+			c.injectReply(c.generateSync(h.SeqNo), h)
+		case ViolationsReset:
+			c.reset(ResetPacketError, ErrAbort)
+		}
 		return ErrDrop
 	}
 	return nil
@@ -132,17 +209,43 @@ func (c *Conn) step7_CheckUnexpectedTypes(h *Header) error {
 // Section 7.4: A received packet becomes acknowledgeable when Step 8 is reached.
 func (c *Conn) step8_OptionsAndMarkAckbl(h *Header) error {
 
+	// Only packets with faulty options that call for a Reset pass Step 1
+	if c.getOptionPolicy().judge(h) != optionAccept {
+		c.amb.E(EventWarn, "Strict on "+h.optionFaultString(), h)
+		if h.optionFault == optionFaultMalformed {
+			c.reset(ResetOptionError, ErrAbort)
+		} else {
+			g := c.generateReset(ResetMandatoryError)
+			g.ResetData = h.mandatoryErrorData()
+			c.resetWith(g, ErrAbort)
+		}
+		return ErrDrop
+	}
+	if o := c.readFeatures(h); o != nil {
+		// Section 6.6.9: A Mandatory Change that cannot be honored resets the connection
+		g := c.generateReset(ResetMandatoryError)
+		g.ResetData = mandatoryResetData(o)
+		c.resetWith(g, ErrAbort)
+		return ErrDrop
+	}
+	c.readDataDropped(h)
+
 	defer c.syncWithCongestionControl()
 	now := c.env.Now()
-	rsopts := filterCCIDReceiverToSenderOptions(h.Options)
-	if err := c.scc.OnRead(&FeedbackHeader{
-		Type:    h.Type, 
-		X:       h.X, 
-		SeqNo:   h.SeqNo, 
-		Options: rsopts, 
-		AckNo:   h.AckNo, 
-		Time:    now,
-	}); err != nil {
+	c.readFlight(h, now)
+	readTime := h.ReadTime
+	if readTime == 0 {
+		readTime = now
+	}
+	fb := getFeedbackHeader()
+	fb.Type, fb.X, fb.SeqNo, fb.AckNo, fb.ECN, fb.Time = h.Type, h.X, h.SeqNo, h.AckNo, h.ECN, readTime
+	// Section 10.3: Each CCID is handed the options that the peer's other half-connection
+	// sends its way, see ccidOptionRoute
+	fb.Options = h.appendOptions(fb.Options, isOptionCCIDReceiverToSender)
+	fb.CCOptions.Decode(fb.Options, h.AckNo)
+	err := c.scc().OnRead(fb)
+	putFeedbackHeader(fb)
+	if err != nil {
 		if re, ok := err.(CongestionReset); ok {
 			c.reset(re.ResetCode(), ErrAbort)
 			return ErrDrop
@@ -156,16 +259,13 @@ func (c *Conn) step8_OptionsAndMarkAckbl(h *Header) error {
 			c.amb.E(EventError, fmt.Sprintf("S·CC read error (%s)", err), h)
 		}
 	}
-	sropts := filterCCIDSenderToReceiverOptions(h.Options)
-	if err := c.rcc.OnRead(&FeedforwardHeader{
-		Type:    h.Type, 
-		X:       h.X, 
-		SeqNo:   h.SeqNo, 
-		CCVal:   h.CCVal, 
-		Options: sropts, 
-		Time:    now, 
-		DataLen: len(h.Data),
-	}); err != nil {
+	ff := getFeedforwardHeader()
+	ff.Type, ff.X, ff.SeqNo, ff.CCVal, ff.ECN, ff.Time, ff.DataLen = h.Type, h.X, h.SeqNo, h.CCVal, h.ECN, readTime, len(h.Data)
+	ff.Options = h.appendOptions(ff.Options, isOptionCCIDSenderToReceiver)
+	ff.CCOptions.Decode(ff.Options, h.AckNo)
+	err = c.rcc().OnRead(ff)
+	putFeedforwardHeader(ff)
+	if err != nil {
 		if re, ok := err.(CongestionReset); ok {
 			c.reset(re.ResetCode(), ErrAbort)
 			return ErrDrop
@@ -198,6 +298,9 @@ func (c *Conn) step10_ProcessREQUEST2(h *Header) error {
 	if c.socket.GetState() != REQUEST {
 		return nil
 	}
+	if cookie := findInitCookie(h); cookie != nil {
+		c.initCookie = append([]byte(nil), cookie...)
+	}
 	c.gotoPARTOPEN()
 
 	return nil
@@ -209,15 +312,38 @@ func (c *Conn) step11_ProcessRESPOND(h *Header) error {
 		return nil
 	}
 	if h.Type == Request {
-		if c.socket.GetGSR() != h.SeqNo {
-			panic("GSR != h.SeqNo")
+		// A retransmitted Request carries a new sequence number and is answered with a new
+		// Response. A Request that is older than the latest one, like a duplicate of the
+		// first Request delayed in the network, has been answered already.
+		if h.SeqNo != c.socket.GetGSR() {
+			c.amb.E(EventDrop, "Stale Request", h)
+			return ErrDrop
 		}
 		serviceCode := c.socket.GetServiceCode()
 		if h.ServiceCode != serviceCode {
 			return ErrDrop
 		}
-		c.inject(c.generateResponse(serviceCode))
+		g := c.generateResponse(serviceCode)
+		if jar := c.env.CookieJar(); jar != nil {
+			cookie := jar.Make(c.initCookieParams(), c.hc.LocalLabel(), c.hc.RemoteLabel())
+			g.Options = append(g.Options, Option{Type: OptionInitCookie, Data: cookie})
+		}
+		c.inject(g)
 	} else {
+		// Section 8.1.4: Enter OPEN only if the client returns a valid Init Cookie. Only Acks
+		// and DataAcks carry it, so the server waits for one of those, which the client
+		// keeps sending in PARTOPEN.
+		if jar := c.env.CookieJar(); jar != nil {
+			if h.Type != Ack && h.Type != DataAck {
+				c.amb.E(EventDrop, "Awaiting Init Cookie", h)
+				return ErrDrop
+			}
+			if !c.verifyInitCookie(jar, h) {
+				c.amb.E(EventWarn, "Bad Init Cookie", h)
+				c.reset(ResetBadInitCookie, ErrAbort)
+				return ErrDrop
+			}
+		}
 		if h.Type != Ack && h.Type != DataAck {
 			// This is not unusual. Our modification of DCCP has the client send a pair
 			// Ack, SyncAck to the server, after the server's Response.  If the Ack is
@@ -236,10 +362,13 @@ func (c *Conn) step12_ProcessPARTOPEN(h *Header) error {
 	}
 	if h.Type == Response {
 		c.inject(c.generateAck())
-		// XXX: This is a deviation from the RFC. The Sync packet necessitates a SyncAck
-		// response, which moves the client from PARTOPEN to OPEN in the lack of DataAck
-		// packets sent from the server to the client.
-		c.inject(c.generateSync())
+		// The Sync packet necessitates a SyncAck response, which moves the client from
+		// PARTOPEN to OPEN in the lack of DataAck packets sent from the server to the client.
+		// In strict mode, the client waits for the server's first packet instead.
+		if !c.env.StrictRFC() {
+			c.env.Deviate(c.amb, devPARTOPENSync, h)
+			c.inject(c.generateSync(c.socket.GetGSR()))
+		}
 		return nil
 	}
 	if h.Type != Response && h.Type != Reset && h.Type != Sync {
@@ -265,8 +394,8 @@ func (c *Conn) step14_ProcessClose(h *Header) error {
 	}
 	c.setError(ErrEOF) 
 	c.teardownUser()
-	c.gotoCLOSED()
 	c.inject(c.generateReset(ResetClosed))
+	c.gotoCLOSED()
 	c.teardownWriteLoop()
 	return ErrDrop
 }
@@ -276,6 +405,9 @@ func (c *Conn) step15_ProcessSync(h *Header) error {
 	if h.Type == Sync {
 		c.inject(c.generateSyncAck(h))
 	}
+	if h.Type == SyncAck {
+		c.validatePath(h)
+	}
 	return nil
 }
 
@@ -293,16 +425,68 @@ func (c *Conn) step16_ProcessData(h *Header) error {
 	// DCCP-Data, DCCP-DataAck, and DCCP-Ack packets received in CLOSEREQ or
 	// CLOSING states MAY be either processed or ignored.
 
+	if !c.readCsCov(h) {
+		return nil
+	}
+	deliver, corrupt := c.readDataChecksum(h)
+	if !deliver {
+		return nil
+	}
+
 	// Drop data packets if application does not read them fast enough
 	c.readAppLk.Lock()
 	if c.readApp != nil {
-		if len(c.readApp) < cap(c.readApp) {
-			c.readApp <- h.Data
-		} else {
+		queued, slow := c.pushRead(readMsg{
+			data: h.Data,
+			meta: ReadMeta{SeqNo: h.SeqNo, Time: c.env.Now(), CCVal: h.CCVal, CsCov: h.CsCov, ECN: h.ECN, Corrupt: corrupt},
+		})
+		if slow {
+			// An Ack tells the peer right away to slow down, see placeSlowReceiver
+			c.amb.E(EventInfo, "Slow receiver", h)
+			c.inject(c.generateAck())
+		}
+		if !queued {
 			c.amb.E(EventDrop, "Slow app", h)
+			c.markDataDropped(h, DropStateReceiveBuffer)
 		}
+	} else if c.readClosed {
+		// The receiver CCID is closed, so the Ack that reports the drop is sent here
+		c.amb.E(EventDrop, "Read closed", h)
+		c.markDataDropped(h, DropStateNotListening)
+		c.inject(c.generateAck())
 	}
 	c.readAppLk.Unlock()
 
 	return nil
 }
+
+// resolveSimultaneousOpen handles a Request received in REQUEST, which means that both
+// endpoints have sent Requests to each other at the same time. RFC 4340 does not provide for
+// this case, so the endpoints resolve it without communication: The one whose ISS is greater,
+// with ties broken by comparing addresses, becomes the server and proceeds as if it had
+// received the Request in LISTEN. The other one ignores the Request and remains a client,
+// awaiting the Response. If neither can be told apart, both retry with a new ISS.
+func (c *Conn) resolveSimultaneousOpen(h *Header) error {
+	iss := c.socket.GetISS()
+	order := 1
+	switch {
+	case iss < h.SeqNo:
+		order = -1
+	case iss == h.SeqNo:
+		order = bytes.Compare(c.hc.LocalLabel().Bytes(), c.hc.RemoteLabel().Bytes())
+	}
+	if order == 0 {
+		c.amb.E(EventWarn, "Simultaneous open, tie", h)
+		serviceCode := c.socket.GetServiceCode()
+		c.socket.SetGAR(c.socket.ChooseISS(c.env, c.hc.LocalLabel(), c.hc.RemoteLabel()))
+		c.inject(c.generateRequest(serviceCode))
+		return ErrDrop
+	}
+	if order < 0 {
+		c.amb.E(EventInfo, "Simultaneous open, remaining client", h)
+		return ErrDrop
+	}
+	c.amb.E(EventInfo, "Simultaneous open, becoming server", h)
+	c.gotoRESPONDFromREQUEST(h.SeqNo)
+	return nil
+}
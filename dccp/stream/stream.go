@@ -0,0 +1,166 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+// Package stream carries a byte stream over a DCCP connection, so that code written against
+// io.Reader and io.Writer, such as io.Copy pipelines, can run over DCCP.
+//
+// The stream is cut into frames, each sent in a datagram of its own and numbered in order.
+// A frame without bytes marks the end of the stream. The receiving end buffers frames that
+// arrive out of order and passes the bytes on in order. DCCP does not retransmit lost
+// packets, and neither does the stream, so a lost frame breaks the stream: once the gap it
+// leaves is certain, Read returns ErrLost. A gap is certain once ReorderWindow frames have
+// arrived after it, or once the connection ends. Read cannot tell a lost frame from a late
+// one before that, so if the peer falls silent after a gap, Read waits for the connection to
+// end: an application that needs to bound the wait must close or abort the connection on a
+// timeout of its own, which makes a blocked Read return ErrLost. Note that a Conn drops packets that arrive while
+// its read queue is full, so the reading application must keep up with the writing one. The
+// stream is thus appropriate where loss is rare and an application can recover from a broken
+// stream, for instance by reconnecting.
+package stream
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// ErrLost is returned by Read once a frame of the stream is known to have been lost
+var ErrLost = errors.New("stream data lost")
+
+// ReorderWindow is the number of frames that may arrive ahead of a missing frame before the
+// missing frame is considered lost
+const ReorderWindow = 64
+
+// frameHeaderLen is the length of the frame number at the start of each frame
+const frameHeaderLen = 8
+
+// Conn is the part of a *dccp.Conn that a Stream uses
+type Conn interface {
+	GetMTU() int
+	Read() ([]byte, error)
+	Write([]byte) error
+	Flush() error
+	Close() error
+}
+
+// Stream implements io.Reader and io.Writer over a DCCP connection. Read and Write can be
+// called concurrently with each other.
+type Stream struct {
+	conn Conn
+
+	wlk  sync.Mutex
+	next uint64 // Number of the next frame to be written
+
+	rlk     sync.Mutex
+	expect  uint64            // Number of the next frame to be read
+	pending map[uint64][]byte // Frames that arrived ahead of frame expect
+	buf     []byte            // Unread bytes of frame expect-1
+	err     error             // Sticky read error
+	end     bool              // Set once the frame that ends the stream has been read
+}
+
+// New creates a Stream over conn. The Stream takes over conn: the application must not read
+// from or write to conn directly.
+func New(conn Conn) *Stream {
+	return &Stream{ conn: conn, pending: make(map[uint64][]byte) }
+}
+
+// Write implements io.Writer. It cuts p into frames that fit into the MTU of the connection,
+// and blocks while the connection's write queue is full.
+func (s *Stream) Write(p []byte) (n int, err error) {
+	s.wlk.Lock()
+	defer s.wlk.Unlock()
+	size := s.conn.GetMTU() - frameHeaderLen
+	if size <= 0 {
+		return 0, dccp.ErrSize
+	}
+	for n < len(p) {
+		chunk := p[n:]
+		if len(chunk) > size {
+			chunk = chunk[:size]
+		}
+		if err = s.writeFrame(chunk); err != nil {
+			return n, err
+		}
+		n += len(chunk)
+	}
+	return n, nil
+}
+
+// writeFrame sends chunk in the next frame
+func (s *Stream) writeFrame(chunk []byte) error {
+	frame := make([]byte, frameHeaderLen+len(chunk))
+	binary.BigEndian.PutUint64(frame, s.next)
+	copy(frame[frameHeaderLen:], chunk)
+	if err := s.conn.Write(frame); err != nil {
+		return err
+	}
+	s.next++
+	return nil
+}
+
+// Read implements io.Reader. It returns io.EOF once the whole stream has been read, and
+// ErrLost if a frame is missing or the connection ended before the stream did. Read blocks
+// while a missing frame may still arrive, see the package documentation.
+func (s *Stream) Read(p []byte) (n int, err error) {
+	s.rlk.Lock()
+	defer s.rlk.Unlock()
+	for len(s.buf) == 0 {
+		if s.end {
+			return 0, io.EOF
+		}
+		if frame, ok := s.pending[s.expect]; ok {
+			delete(s.pending, s.expect)
+			s.expect++
+			s.buf, s.end = frame, len(frame) == 0
+			continue
+		}
+		if s.err != nil {
+			return 0, s.err
+		}
+		s.receive()
+	}
+	n = copy(p, s.buf)
+	s.buf = s.buf[n:]
+	return n, nil
+}
+
+// receive reads the next frame from the connection into pending, or sets the sticky error
+func (s *Stream) receive() {
+	b, err := s.conn.Read()
+	switch {
+	case err == dccp.ErrEOF || err != nil && len(s.pending) > 0:
+		s.err = ErrLost // Frames are missing for good
+		return
+	case err != nil:
+		s.err = err
+		return
+	case len(b) < frameHeaderLen:
+		return // Not a frame of the stream
+	}
+	k := binary.BigEndian.Uint64(b)
+	if k < s.expect {
+		return // Duplicate
+	}
+	s.pending[k] = b[frameHeaderLen:]
+	if len(s.pending) > ReorderWindow {
+		s.err = ErrLost
+	}
+}
+
+// Close ends the stream and closes the underlying connection, once the frames written so
+// far have been sent
+func (s *Stream) Close() error {
+	s.wlk.Lock()
+	defer s.wlk.Unlock()
+	if err := s.writeFrame(nil); err != nil {
+		return err
+	}
+	if err := s.conn.Flush(); err != nil {
+		return err
+	}
+	return s.conn.Close()
+}
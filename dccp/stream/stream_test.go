@@ -0,0 +1,118 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package stream
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"github.com/petar/GoDCCP/dccp"
+)
+
+// fakeConn is a Conn that keeps the frames written to it, and reads the frames that the test
+// passes it on in. Read returns dccp.ErrEOF once in is closed.
+type fakeConn struct {
+	out [][]byte
+	in  chan []byte
+}
+
+func newFakeConn() *fakeConn { return &fakeConn{ in: make(chan []byte, 4*ReorderWindow) } }
+
+func (c *fakeConn) GetMTU() int { return frameHeaderLen + 10 }
+
+func (c *fakeConn) Read() ([]byte, error) {
+	b, ok := <-c.in
+	if !ok {
+		return nil, dccp.ErrEOF
+	}
+	return b, nil
+}
+
+func (c *fakeConn) Write(b []byte) error {
+	c.out = append(c.out, append([]byte(nil), b...))
+	return nil
+}
+
+func (c *fakeConn) Flush() error { return nil }
+
+func (c *fakeConn) Close() error { return nil }
+
+// frames writes a stream of n bytes, cut into frames of 10 bytes, and returns the bytes and
+// the frames, the last of which ends the stream
+func frames(t *testing.T, n int) ([]byte, [][]byte) {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	c := newFakeConn()
+	s := New(c)
+	if _, err := s.Write(data); err != nil {
+		t.Fatalf("write (%s)", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("close (%s)", err)
+	}
+	return data, c.out
+}
+
+// readFrames passes the frames f, in that order, to a Stream and reads it to the end. It
+// closes the connection after the frames if end is set.
+func readFrames(f [][]byte, end bool) ([]byte, error) {
+	c := newFakeConn()
+	for _, b := range f {
+		c.in <- b
+	}
+	if end {
+		close(c.in)
+	}
+	return ioutil.ReadAll(New(c))
+}
+
+func TestInOrder(t *testing.T) {
+	data, f := frames(t, 95)
+	if len(f) != 11 {
+		t.Fatalf("%d frames, expecting 11", len(f))
+	}
+	if got, err := readFrames(f, false); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("read %d bytes (%v), expecting %d", len(got), err, len(data))
+	}
+}
+
+func TestReorderDuplicate(t *testing.T) {
+	data, f := frames(t, 95)
+	// Each pair of frames swapped, and every third frame delivered twice
+	var g [][]byte
+	for i := 0; i+1 < len(f); i += 2 {
+		g = append(g, f[i+1], f[i])
+	}
+	g = append(g, f[len(f)-1])
+	for i := 0; i < len(f); i += 3 {
+		g = append(g, f[i])
+	}
+	if got, err := readFrames(g, false); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("read %d bytes (%v), expecting %d", len(got), err, len(data))
+	}
+}
+
+func TestLost(t *testing.T) {
+	data, f := frames(t, 10*(ReorderWindow+10))
+
+	// A gap is certain once ReorderWindow frames have overtaken it
+	g := append(append([][]byte(nil), f[:5]...), f[6:]...)
+	if got, err := readFrames(g, false); err != ErrLost || !bytes.Equal(got, data[:50]) {
+		t.Errorf("read %d bytes (%v), expecting 50 and ErrLost", len(got), err)
+	}
+
+	// ... or once the connection ends
+	g = append(append([][]byte(nil), f[:5]...), f[6:10]...)
+	if got, err := readFrames(g, true); err != ErrLost || !bytes.Equal(got, data[:50]) {
+		t.Errorf("read %d bytes (%v), expecting 50 and ErrLost", len(got), err)
+	}
+
+	// A connection that ends before the stream breaks it
+	if got, err := readFrames(f[:5], true); err != ErrLost || !bytes.Equal(got, data[:50]) {
+		t.Errorf("read %d bytes (%v), expecting 50 and ErrLost", len(got), err)
+	}
+}
@@ -19,46 +19,47 @@ func (h *Header) String() string {
 	switch h.Type {
 	case Request:
 		fmt.Fprintf(&w, "T:%s X:%d SeqNo:%d SC:%d ··· SP:%2d DP:%2d",
-			typeString(h.Type), x, h.SeqNo, h.ServiceCode,
+			TypeString(h.Type), x, h.SeqNo, h.ServiceCode,
 			h.SourcePort, h.DestPort)
 	case Response:
 		fmt.Fprintf(&w, "T:%s X:%d SeqNo:%d AckNo:%d SC:%d ··· SP:%2d DP:%2d",
-			typeString(h.Type), x, h.SeqNo, h.AckNo, h.ServiceCode,
+			TypeString(h.Type), x, h.SeqNo, h.AckNo, h.ServiceCode,
 			h.SourcePort, h.DestPort)
 	case Data:
 		fmt.Fprintf(&w, "T:%s X:%d SeqNo:%d ··· #D:%d",
-			typeString(h.Type), x, h.SeqNo,
+			TypeString(h.Type), x, h.SeqNo,
 			len(h.Data))
 	case Ack:
 		fmt.Fprintf(&w, "T:%s X:%d SeqNo:%d AckNo:%d",
-			typeString(h.Type), x, h.SeqNo, h.AckNo)
+			TypeString(h.Type), x, h.SeqNo, h.AckNo)
 	case DataAck:
 		fmt.Fprintf(&w, "T:%s X:%d SeqNo:%d AckNo:%d ··· #D:%d",
-			typeString(h.Type), x, h.SeqNo, h.AckNo,
+			TypeString(h.Type), x, h.SeqNo, h.AckNo,
 			len(h.Data))
 	case CloseReq:
 		fmt.Fprintf(&w, "T:%s X:%d SeqNo:%d AckNo:%d",
-			typeString(h.Type), x, h.SeqNo, h.AckNo)
+			TypeString(h.Type), x, h.SeqNo, h.AckNo)
 	case Close:
 		fmt.Fprintf(&w, "T:%s X:%d SeqNo:%d AckNo:%d",
-			typeString(h.Type), x, h.SeqNo, h.AckNo)
+			TypeString(h.Type), x, h.SeqNo, h.AckNo)
 	case Reset:
 		fmt.Fprintf(&w, "T:%s X:%d SeqNo:%d AckNo:%d ··· RC: %s #RD:%d",
-			typeString(h.Type), x, h.SeqNo, h.AckNo,
-			resetCodeString(h.ResetCode), len(h.ResetData))
+			TypeString(h.Type), x, h.SeqNo, h.AckNo,
+			ResetCodeString(h.ResetCode), len(h.ResetData))
 	case Sync:
 		fmt.Fprintf(&w, "T:%s X:%d SeqNo:%d AckNo:%d",
-			typeString(h.Type), x, h.SeqNo, h.AckNo)
+			TypeString(h.Type), x, h.SeqNo, h.AckNo)
 	case SyncAck:
 		fmt.Fprintf(&w, "T:%s X:%d SeqNo:%d AckNo:%d",
-			typeString(h.Type), x, h.SeqNo, h.AckNo)
+			TypeString(h.Type), x, h.SeqNo, h.AckNo)
 	default:
 		panic("unknown packet type")
 	}
 	return string(w.Bytes())
 }
 
-func typeString(typ byte) string {
+// TypeString returns the name of the packet type typ
+func TypeString(typ byte) string {
 	switch typ {
 	case Request:
 		return "Request"
@@ -84,7 +85,62 @@ func typeString(typ byte) string {
 	panic("un")
 }
 
-func resetCodeString(resetCode byte) string {
+// OptionString returns the name of the option type typ
+func OptionString(typ byte) string {
+	switch typ {
+	case OptionPadding:
+		return "Padding"
+	case OptionMandatory:
+		return "Mandatory"
+	case OptionSlowReceiver:
+		return "SlowReceiver"
+	case OptionChangeL:
+		return "ChangeL"
+	case OptionConfirmL:
+		return "ConfirmL"
+	case OptionChangeR:
+		return "ChangeR"
+	case OptionConfirmR:
+		return "ConfirmR"
+	case OptionInitCookie:
+		return "InitCookie"
+	case OptionNDPCount:
+		return "NDPCount"
+	case OptionAckVectorNonce0:
+		return "AckVector0"
+	case OptionAckVectorNonce1:
+		return "AckVector1"
+	case OptionDataDropped:
+		return "DataDropped"
+	case OptionTimestamp:
+		return "Timestamp"
+	case OptionTimestampEcho:
+		return "TimestampEcho"
+	case OptionElapsedTime:
+		return "ElapsedTime"
+	case OptionDataChecksum:
+		return "DataChecksum"
+	}
+	if isOptionCCIDSpecific(typ) {
+		return fmt.Sprintf("CCID(%d)", typ)
+	}
+	return fmt.Sprintf("Option(%d)", typ)
+}
+
+// optionStrings returns the names of the types of the options opts
+func optionStrings(opts []Option) []string {
+	if len(opts) == 0 {
+		return nil
+	}
+	s := make([]string, len(opts))
+	for i, opt := range opts {
+		s[i] = OptionString(opt.Type)
+	}
+	return s
+}
+
+// ResetCodeString returns the name of the Reset Code resetCode
+func ResetCodeString(resetCode byte) string {
 	switch resetCode {
 	case ResetUnspecified:
 		return "Unspecified"
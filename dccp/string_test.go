@@ -0,0 +1,53 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOptionString(t *testing.T) {
+	for typ, s := range map[byte]string{
+		OptionPadding:         "Padding",
+		OptionSlowReceiver:    "SlowReceiver",
+		OptionAckVectorNonce1: "AckVector1",
+		OptionDataChecksum:    "DataChecksum",
+		100:                   "Option(100)",
+		193:                   "CCID(193)",
+	} {
+		if OptionString(typ) != s {
+			t.Errorf("option %d is %q, expecting %q", typ, OptionString(typ), s)
+		}
+	}
+	if optionStrings(nil) != nil {
+		t.Errorf("no options formatted as non-nil")
+	}
+}
+
+func TestTraceOptions(t *testing.T) {
+	rec := &traceRecorder{}
+	env := NewEnv(rec)
+	env.Expect()
+	amb := NewAmb("test", env)
+	h := &Header{ Type: Ack, rawOptions: []byte{ OptionSlowReceiver, OptionPadding } }
+
+	// A filtered event, seen only by the expectations, leaves the options unparsed
+	env.SetTraceFilter("", LevelWarn)
+	amb.E(EventRead, "Filtered", h)
+	if h.Options != nil || len(rec.traces) != 0 {
+		t.Fatalf("options of a filtered event were parsed")
+	}
+
+	env.SetTraceFilter("", LevelDetail)
+	amb.E(EventRead, "Admitted", h)
+	if len(rec.traces) != 1 {
+		t.Fatalf("admitted event not written")
+	}
+	// Padding is dropped by the option parser
+	if opts := rec.traces[0].Options; !reflect.DeepEqual(opts, []string{"SlowReceiver"}) {
+		t.Errorf("options %v", opts)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package dccp
+
+import (
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+// setTrafficClass sets the traffic class of the packets sent on the socket behind rc. On an
+// AF_INET6 socket, the IPv4 option is set as well, for the packets sent to IPv4-mapped
+// addresses; its failure is ignored.
+func setTrafficClass(rc syscall.RawConn, tos byte) error {
+	v6, err := isSocketInet6(rc)
+	if err != nil {
+		return err
+	}
+	cerr := rc.Control(func(fd uintptr) {
+		if v6 {
+			err = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS, int(tos))
+			syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TOS, int(tos))
+			return
+		}
+		err = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TOS, int(tos))
+	})
+	if cerr != nil {
+		return cerr
+	}
+	return err
+}
+
+// trafficClassOOB returns the control message that marks a packet to ip with traffic class tos
+func trafficClassOOB(ip net.IP, tos byte) ([]byte, error) {
+	oob := make([]byte, syscall.CmsgSpace(4))
+	h := (*syscall.Cmsghdr)(unsafe.Pointer(&oob[0]))
+	if ip.To4() != nil {
+		h.Level, h.Type = syscall.IPPROTO_IP, syscall.IP_TOS
+	} else {
+		h.Level, h.Type = syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS
+	}
+	h.SetLen(syscall.CmsgLen(4))
+	*(*int32)(unsafe.Pointer(&oob[syscall.CmsgLen(0)])) = int32(tos)
+	return oob, nil
+}
+
+// isSocketInet6 returns true if the socket behind rc belongs to the AF_INET6 family
+func isSocketInet6(rc syscall.RawConn) (v6 bool, err error) {
+	cerr := rc.Control(func(fd uintptr) {
+		var sa syscall.Sockaddr
+		if sa, err = syscall.Getsockname(int(fd)); err == nil {
+			_, v6 = sa.(*syscall.SockaddrInet6)
+		}
+	})
+	if cerr != nil {
+		return false, cerr
+	}
+	return v6, err
+}
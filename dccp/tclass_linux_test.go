@@ -0,0 +1,91 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// readTrafficClass receives a packet on u and returns its first byte and traffic class
+func readTrafficClass(t *testing.T, u *UDPLink) (byte, byte) {
+	buf, oob := make([]byte, 100), make([]byte, 100)
+	n, oobn, _, _, err := u.c.ReadMsgUDP(buf, oob)
+	if err != nil || n == 0 {
+		t.Fatalf("read (%v)", err)
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		t.Fatalf("control message (%s)", err)
+	}
+	for _, m := range msgs {
+		if m.Header.Level == syscall.IPPROTO_IP && m.Header.Type == syscall.IP_TOS && len(m.Data) > 0 {
+			return buf[0], m.Data[0]
+		}
+	}
+	t.Fatalf("no traffic class received")
+	return 0, 0
+}
+
+func TestUDPLinkTrafficClass(t *testing.T) {
+	a, b := bindLoopbackPair(t)
+	defer a.Close()
+	defer b.Close()
+	rc, err := b.c.SyscallConn()
+	if err != nil {
+		t.Fatalf("syscall conn (%s)", err)
+	}
+	rc.Control(func(fd uintptr) {
+		err = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_RECVTOS, 1)
+	})
+	if err != nil {
+		t.Fatalf("IP_RECVTOS (%s)", err)
+	}
+	b.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	if err := a.SetTrafficClass(TrafficClassAF41); err != nil {
+		t.Fatalf("set traffic class (%s)", err)
+	}
+	// Packets marked individually keep their class within a batch of the link's default class
+	a.SetWriteBatch(4, 10e9)
+	a.WriteTo([]byte{0}, b.LocalAddr())
+	a.WriteToClass([]byte{1}, b.LocalAddr(), TrafficClassEF)
+	a.WriteTo([]byte{2}, b.LocalAddr())
+	if err := a.Flush(); err != nil {
+		t.Fatalf("flush (%s)", err)
+	}
+	for _, want := range []byte{TrafficClassAF41, TrafficClassEF, TrafficClassAF41} {
+		if i, tos := readTrafficClass(t, b); tos != want {
+			t.Errorf("packet %d: traffic class %#x, expecting %#x", i, tos, want)
+		}
+	}
+}
+
+// TestUDPLinkFamily checks that the address family of the socket, which batched writes need, is
+// told correctly from the local address found when the link was bound
+func TestUDPLinkFamily(t *testing.T) {
+	for _, x := range []struct {
+		netw  string
+		laddr *net.UDPAddr
+	}{
+		{"udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}},
+		{"udp4", nil},
+		{"udp", nil},
+		{"udp6", &net.UDPAddr{IP: net.IPv6loopback}},
+	} {
+		u, err := BindUDPLink(x.netw, x.laddr)
+		if err != nil {
+			t.Logf("%s %v: bind (%s)", x.netw, x.laddr, err)
+			continue
+		}
+		rc, _ := u.c.SyscallConn()
+		if v6, _ := isSocketInet6(rc); u.v6 != v6 {
+			t.Errorf("%s %v: bound to %s, v6 %v, expecting %v", x.netw, x.laddr, u.LocalAddr(), u.v6, v6)
+		}
+		u.Close()
+	}
+}
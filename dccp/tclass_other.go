@@ -0,0 +1,23 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package dccp
+
+import (
+	"net"
+	"syscall"
+)
+
+// setTrafficClass fails, on platforms where traffic classes are not supported
+func setTrafficClass(rc syscall.RawConn, tos byte) error {
+	return ErrUnsupported
+}
+
+// trafficClassOOB fails, on platforms where traffic classes are not supported
+func trafficClassOOB(ip net.IP, tos byte) ([]byte, error) {
+	return nil, ErrUnsupported
+}
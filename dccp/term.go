@@ -8,8 +8,12 @@ package dccp
 func (c *Conn) abortWith(resetCode byte) {
 	c.Lock()
 	c.setError(ErrAbort)
+	// The Reset is queued before the write loop is torn down, which lets it drain. A
+	// connection in TIMEWAIT has ended already, so it is closed without one.
+	if c.socket.GetState() != TIMEWAIT {
+		c.inject(c.generateReset(resetCode))
+	}
 	c.gotoCLOSED()
-	c.inject(c.generateReset(resetCode))
 	c.Unlock()
 	c.teardownUser()
 	c.teardownWriteLoop()
@@ -20,6 +24,8 @@ func (c *Conn) abort() { c.abortWith(ResetAborted) }
 
 func (c *Conn) setError(err error) {
 	c.AssertLocked()
+	c.errLk.Lock()
+	defer c.errLk.Unlock()
 	if c.err != nil {
 		return
 	}
@@ -27,10 +33,15 @@ func (c *Conn) setError(err error) {
 }
 
 func (c *Conn) reset(resetCode byte, err error) {
+	c.resetWith(c.generateReset(resetCode), err)
+}
+
+// resetWith is like reset, except that it sends the Reset h, which may carry Reset Data
+func (c *Conn) resetWith(h *writeHeader, err error) {
 	c.AssertLocked()
 	c.setError(err)
+	c.inject(h)
 	c.gotoCLOSED()
-	c.inject(c.generateReset(resetCode))
 	c.teardownUser()
 	c.teardownWriteLoop()
 }
@@ -53,22 +64,12 @@ func (c *Conn) teardownUser() {
 		c.readApp = nil
 	}
 	c.readAppLk.Unlock()
-	c.writeDataLk.Lock()
-	if c.writeData != nil {
-		close(c.writeData)
-		c.writeData = nil
-	}
-	c.writeDataLk.Unlock()
+	c.writeQueue.closeData()
 }
 
 // teardownWriteLoop MUST be idempotent. It may be called with or without lock on c.
 func (c *Conn) teardownWriteLoop() {
-	c.writeNonDataLk.Lock()
-	defer c.writeNonDataLk.Unlock()
-	if c.writeNonData != nil {
-		close(c.writeNonData)
-		c.writeNonData = nil
-	}
-	c.scc.Close()
-	c.rcc.Close()
+	c.writeQueue.close()
+	c.scc().Close()
+	c.rcc().Close()
 }
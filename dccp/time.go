@@ -0,0 +1,123 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"runtime"
+	"time"
+)
+
+// Time is an interface to a time framework. All time measurements and waits performed by
+// the DCCP logic go through the Time of its Env, which allows for the use of real as well as
+// synthetic (accelerated) time. Times are given in nanoseconds.
+type Time interface {
+	// Now returns the current time in nanoseconds
+	Now() int64
+
+	// Sleep blocks for ns nanoseconds of this Time
+	Sleep(ns int64)
+}
+
+// PreciseTime is implemented by Times that can wake up at an exact time. Sleep is subject to
+// the granularity of the timers of the system and to scheduling latency, which can add up to
+// a millisecond or more, too much to space the packets of a fast flow.
+type PreciseTime interface {
+	// SleepUntil blocks until time t of this Time
+	SleepUntil(t int64)
+}
+
+// AlarmTime is implemented by Times that can signal on a channel once a duration has elapsed.
+// Unlike a Sleep, such a wait can be abandoned, which lets the timer wheel of an Env wait for
+// its next due timer and for timers added meanwhile at once.
+type AlarmTime interface {
+	// Alarm returns a channel that receives once ns nanoseconds of this Time have elapsed, and
+	// a function that cancels the alarm
+	Alarm(ns int64) (<-chan time.Time, func() bool)
+}
+
+// PreciseSpin is how long before its wake-up time, in real nanoseconds, a precise sleep stops
+// sleeping and yields the processor in a loop instead
+const PreciseSpin = 200e3
+
+// sleepUntil blocks until the wall clock reaches t, sleeping for all but the last PreciseSpin
+// nanoseconds and spinning for the rest
+func sleepUntil(t time.Time) {
+	if d := time.Until(t) - PreciseSpin; d > 0 {
+		time.Sleep(d)
+	}
+	for time.Now().Before(t) {
+		runtime.Gosched()
+	}
+}
+
+// RealTime is a Time which follows the wall clock. It reads the wall clock once, when the
+// program starts, and measures the time elapsed since on the monotonic clock of the system, so
+// that adjustments of the wall clock, such as the steps of NTP, do not affect it.
+var RealTime Time = newRealTime()
+
+type realTime struct {
+	zero  time.Time // Carries a monotonic clock reading
+	start int64
+}
+
+func newRealTime() *realTime {
+	now := time.Now()
+	return &realTime{ zero: now, start: now.UnixNano() }
+}
+
+func (x *realTime) Now() int64 { return x.start + int64(time.Since(x.zero)) }
+
+func (x *realTime) Sleep(ns int64) { time.Sleep(time.Duration(ns)) }
+
+func (x *realTime) SleepUntil(t int64) { sleepUntil(x.zero.Add(time.Duration(t - x.start))) }
+
+func (x *realTime) Alarm(ns int64) (<-chan time.Time, func() bool) {
+	t := time.NewTimer(time.Duration(ns))
+	return t.C, t.Stop
+}
+
+// DilatedTime is a Time that runs a constant factor faster than real time. It is intended
+// for tests that wait on long protocol timeouts: with a factor of 100, a 10 second idle
+// period completes in 100 milliseconds. Since the passage of time is scaled uniformly, the
+// relative ordering of events is preserved.
+type DilatedTime struct {
+	zero   time.Time
+	start  int64
+	factor int64
+}
+
+// NewDilatedTime creates a new DilatedTime, which runs factor times faster than real time
+func NewDilatedTime(factor int64) *DilatedTime {
+	if factor <= 0 {
+		panic("non-positive time dilation factor")
+	}
+	now := time.Now()
+	return &DilatedTime{
+		zero:   now,
+		start:  now.UnixNano(),
+		factor: factor,
+	}
+}
+
+// Now implements Time.Now
+func (x *DilatedTime) Now() int64 {
+	return x.start + int64(time.Since(x.zero))*x.factor
+}
+
+// Sleep implements Time.Sleep
+func (x *DilatedTime) Sleep(ns int64) {
+	time.Sleep(time.Duration(ns / x.factor))
+}
+
+// SleepUntil implements PreciseTime.SleepUntil
+func (x *DilatedTime) SleepUntil(t int64) {
+	sleepUntil(x.zero.Add(time.Duration((t - x.start) / x.factor)))
+}
+
+// Alarm implements AlarmTime.Alarm
+func (x *DilatedTime) Alarm(ns int64) (<-chan time.Time, func() bool) {
+	t := time.NewTimer(time.Duration(ns / x.factor))
+	return t.C, t.Stop
+}
@@ -19,6 +19,12 @@ func (opt *TimestampOption) Encode() (*Option, error) {
 	}, nil
 }
 
+// Place places the option on the packet of ph, without allocating
+func (opt *TimestampOption) Place(ph *PreHeader) {
+	var d [4]byte
+	ph.AddOption(OptionTimestamp, encodeTimestamp(opt.Timestamp, d[:]), false)
+}
+
 // d must be a 4-byte slice
 func encodeTimestamp(t uint32, d []byte) []byte {
 	EncodeUint32(t, d)
@@ -26,10 +32,20 @@ func encodeTimestamp(t uint32, d []byte) []byte {
 }
 
 func DecodeTimestampOption(opt *Option) *TimestampOption {
-	if opt.Type != OptionTimestamp || len(opt.Data) != 4 {
+	r := &TimestampOption{}
+	if !decodeTimestampOption(opt, r) {
 		return nil
 	}
-	return &TimestampOption{Timestamp: decodeTimestamp(opt.Data[0:4])}
+	return r
+}
+
+// decodeTimestampOption decodes opt into r, and returns false if opt is not a valid Timestamp
+func decodeTimestampOption(opt *Option, r *TimestampOption) bool {
+	if opt.Type != OptionTimestamp || len(opt.Data) != 4 {
+		return false
+	}
+	r.Timestamp = decodeTimestamp(opt.Data[0:4])
+	return true
 }
 
 func decodeTimestamp(d []byte) uint32 {
@@ -64,6 +80,12 @@ func (opt *ElapsedTimeOption) Encode() (*Option, error) {
 	}, nil
 }
 
+// Place places the option on the packet of ph, without allocating
+func (opt *ElapsedTimeOption) Place(ph *PreHeader) {
+	var d [4]byte
+	ph.AddOption(OptionElapsedTime, encodeElapsed(opt.Elapsed, d[:]), false)
+}
+
 // d must be a 4-byte slice
 func encodeElapsed(elapsed uint32, d []byte) []byte {
 	if elapsed >= MaxElapsedInTenMicro {
@@ -81,16 +103,25 @@ func encodeElapsed(elapsed uint32, d []byte) []byte {
 }
 
 func DecodeElapsedTimeOption(opt *Option) *ElapsedTimeOption {
-	if opt.Type != OptionElapsedTime || (len(opt.Data) != 2 && len(opt.Data) != 4) {
+	r := &ElapsedTimeOption{}
+	if !decodeElapsedTimeOption(opt, r) {
 		return nil
 	}
+	return r
+}
+
+// decodeElapsedTimeOption decodes opt into r, and returns false if opt is not a valid Elapsed
+// Time option
+func decodeElapsedTimeOption(opt *Option, r *ElapsedTimeOption) bool {
+	if opt.Type != OptionElapsedTime || (len(opt.Data) != 2 && len(opt.Data) != 4) {
+		return false
+	}
 	elapsed, err := decodeElapsed(opt.Data)
 	if err != nil {
-		return nil
-	}
-	return &ElapsedTimeOption{
-		Elapsed: elapsed,
+		return false
 	}
+	r.Elapsed = elapsed
+	return true
 }
 
 func decodeElapsed(d []byte) (uint32, error) {
@@ -117,46 +148,66 @@ type TimestampEchoOption struct {
 }
 
 func (opt *TimestampEchoOption) Encode() (*Option, error) {
-	d := make([]byte, 8)
-	encodeTimestamp(opt.Timestamp, d[0:4])
-	if opt.Elapsed == 0 {
-		d = d[0:4]
-	} else {
-		l := len(encodeElapsed(opt.Elapsed, d[4:]))
-		d = d[0 : 4+l]
-	}
-	// The size of d can be 4, 6 or 8
 	return &Option{
 		Type:      OptionTimestampEcho,
-		Data:      d,
+		Data:      opt.encode(make([]byte, 8)),
 		Mandatory: false,
 	}, nil
 }
 
+// Place places the option on the packet of ph, without allocating
+func (opt *TimestampEchoOption) Place(ph *PreHeader) {
+	var d [8]byte
+	ph.AddOption(OptionTimestampEcho, opt.encode(d[:]), false)
+}
+
+// d must be an 8-byte slice
+func (opt *TimestampEchoOption) encode(d []byte) []byte {
+	encodeTimestamp(opt.Timestamp, d[0:4])
+	if opt.Elapsed == 0 {
+		return d[0:4]
+	}
+	// The size of the data can be 4, 6 or 8
+	l := len(encodeElapsed(opt.Elapsed, d[4:]))
+	return d[0 : 4+l]
+}
+
 func DecodeTimestampEchoOption(opt *Option) *TimestampEchoOption {
+	r := &TimestampEchoOption{}
+	if !decodeTimestampEchoOption(opt, r) {
+		return nil
+	}
+	return r
+}
+
+// decodeTimestampEchoOption decodes opt into r, and returns false if opt is not a valid
+// Timestamp Echo
+func decodeTimestampEchoOption(opt *Option, r *TimestampEchoOption) bool {
 	if opt.Type != OptionTimestampEcho ||
 		(len(opt.Data) != 4 && len(opt.Data) != 6 && len(opt.Data) != 8) {
 
-		return nil
+		return false
 	}
 	var elapsed uint32
 	if len(opt.Data) > 4 {
 		var err error
 		elapsed, err = decodeElapsed(opt.Data[4:])
 		if err != nil {
-			return nil
+			return false
 		}
 	}
-	return &TimestampEchoOption{
-		Timestamp: decodeTimestamp(opt.Data[0:4]),
-		Elapsed:   elapsed,
-	}
+	r.Timestamp, r.Elapsed = decodeTimestamp(opt.Data[0:4]), elapsed
+	return true
 }
 
 // TenMicroDiff returns the circular difference between t0 an t1.
 // The arguments and the result are in ten microsecond units.
 func TenMicroDiff(t0, t1 uint32) uint32 { return minu32(t0-t1, t1-t0) }
 
+// TimestampAt returns the circular Timestamp, in ten microsecond units, of the time t given
+// in nanoseconds
+func TimestampAt(t int64) uint32 { return uint32(t / TenMicroInNano) }
+
 // TenMicroFromNano converts a time length given in nanoseconds into 
 // units of 10 microseconds, capped by MaxTenMicro.
 func TenMicroFromNano(ns int64) uint32 {
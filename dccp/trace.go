@@ -6,9 +6,12 @@ package dccp
 
 import (
 	"bytes"
+	"encoding/json"
 )
 
-// TraceWriter is a type that consumes log entries.
+// TraceWriter is a type that consumes log entries. Write must not block: it is called from the
+// loops of the Conns, including the read loop of a Mux, with its processLk held, which
+// processes the packets of every connection of the Mux.
 type TraceWriter interface {
 	Write(*Trace)
 	Sync() error
@@ -30,6 +33,14 @@ type Trace struct {
 	// filled in automatically upon calls to the Amb's E method.
 	Labels    []string `json:"l"`
 
+	// Corr is the correlation ID of the emitting Amb, shared by the endpoints of a connection,
+	// see Amb.SetCorrelation
+	Corr      string   `json:"co,omitempty"`
+
+	// Conn is the number of the connection that emitted the trace, unique within the process,
+	// or zero if the trace was not emitted on behalf of a connection
+	Conn      uint64   `json:"cn,omitempty"`
+
 	// Event is an identifier representing the type of event that this trace represents. It
 	// can be something like "Warn", "Info", etc.
 	Event     Event   `json:"e"`
@@ -55,6 +66,9 @@ type Trace struct {
 	// this header.
 	AckNo     int64    `json:"ha"`
 
+	// If this trace pertains to a DCCP header, Options lists the types of the options of this header.
+	Options   []string `json:"ho,omitempty"`
+
 	// SourceFile is the name of the source file where this trace was emitted.
 	SourceFile string  `json:"sf"`
 
@@ -114,6 +128,13 @@ func (x *Trace) IsHighlighted() bool {
 	return x.Highlight
 }
 
+// A StateChange argument is attached to the log that a Conn emits when it changes state.
+// From is empty for the initial state of the Conn.
+type StateChange struct {
+	From string
+	To   string
+}
+
 // One Sample argument can be attached to a log. The inspector interprets it as a data point
 // in a time series where: 
 //   (i)   The time series name is given by the label stack of the amb
@@ -175,6 +196,39 @@ func (e Event) String() string {
 	panic("unknown event")
 }
 
+// eventByName maps the textual representation of events back to events
+var eventByName = map[string]Event{}
+
+func init() {
+	for e := EventTurn; e <= EventWrite; e++ {
+		eventByName[e.String()] = e
+	}
+}
+
+// MarshalJSON encodes the event by name, so that JSON traces are self-describing
+func (e Event) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.String())
+}
+
+// UnmarshalJSON decodes an event given by name, or by number as in older traces
+func (e *Event) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err != nil {
+		var n int
+		if err = json.Unmarshal(b, &n); err != nil {
+			return err
+		}
+		*e = Event(n)
+		return nil
+	}
+	v, ok := eventByName[name]
+	if !ok {
+		return ErrSyntax
+	}
+	*e = v
+	return nil
+}
+
 func indentEvent(event Event) string {
 	s := event.String()
 	switch s {
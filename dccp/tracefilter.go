@@ -0,0 +1,186 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"strings"
+	"sync/atomic"
+)
+
+// Level is the verbosity level of an Event. Trace filters admit events at or above a
+// minimum level.
+type Level int
+
+const (
+	LevelDetail = Level(iota) // Per-packet and per-loop events: Turn, Idle, Read, Write
+	LevelInfo                 // Noteworthy events: Info, Match, Catch, Drop
+	LevelWarn                 // Warn events
+	LevelError                // Error events
+	LevelOff                  // Admits no events
+)
+
+// Level returns the verbosity level of the event
+func (e Event) Level() Level {
+	switch e {
+	case EventInfo, EventMatch, EventCatch, EventDrop:
+		return LevelInfo
+	case EventWarn:
+		return LevelWarn
+	case EventError:
+		return LevelError
+	}
+	return LevelDetail
+}
+
+// traceFilter admits events of at least level min, emitted by Ambs whose label stack
+// starts with labels. A label of "*" matches any label.
+type traceFilter struct {
+	labels []string
+	min    Level
+}
+
+func (f *traceFilter) match(labels []string) bool {
+	if len(labels) < len(f.labels) {
+		return false
+	}
+	for i, l := range f.labels {
+		if l != "*" && l != labels[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// SetTraceFilter sets the minimum level of events emitted by Ambs whose label stack starts
+// with labelPath, a "/"-separated list of labels where "*" matches any label. For example,
+// "*/receiver" matches the receivers of both client and server connections. When several
+// filters match an Amb, the one with the longest label path applies. The empty path matches
+// all Ambs. Filters can be changed at any time, and take effect on the next emit.
+func (t *Env) SetTraceFilter(labelPath string, min Level) {
+	var labels []string
+	if labelPath != "" {
+		labels = strings.Split(labelPath, "/")
+	}
+	t.traceFilterLk.Lock()
+	defer t.traceFilterLk.Unlock()
+	defer t.updateTraceFiltered()
+	for i, f := range t.traceFilters {
+		if strings.Join(f.labels, "/") == labelPath {
+			t.traceFilters[i].min = min
+			return
+		}
+	}
+	t.traceFilters = append(t.traceFilters, traceFilter{labels: labels, min: min})
+}
+
+// ClearTraceFilters removes all trace filters, so that all events are emitted
+func (t *Env) ClearTraceFilters() {
+	t.traceFilterLk.Lock()
+	defer t.traceFilterLk.Unlock()
+	t.traceFilters = nil
+	t.updateTraceFiltered()
+}
+
+// updateTraceFiltered records whether any filter or limit is set, so that admits can skip
+// the lock of the filters in the usual case that none is
+func (t *Env) updateTraceFiltered() {
+	var filtered int32
+	for _, f := range t.traceFilters {
+		if f.min > LevelDetail {
+			filtered = 1
+		}
+	}
+	for _, l := range t.traceLimits {
+		if l.sample > 1 || l.rate > 0 {
+			filtered = 1
+		}
+	}
+	atomic.StoreInt32(&t.traceFiltered, filtered)
+}
+
+// traceLimit thins out the events of one type by sampling and rate limiting
+type traceLimit struct {
+	sample   int64 // Admit one in every sample events; zero or one admits all
+	seen     int64 // Number of events seen, for sampling purposes
+	rate     int64 // Maximum number of events admitted per second; zero means unlimited
+	window   int64 // Start time of the current one-second rate window
+	admitted int64 // Number of events admitted in the current rate window
+}
+
+func (t *Env) traceLimit(event Event) *traceLimit {
+	if t.traceLimits == nil {
+		t.traceLimits = make(map[Event]*traceLimit)
+	}
+	l, ok := t.traceLimits[event]
+	if !ok {
+		l = &traceLimit{}
+		t.traceLimits[event] = l
+	}
+	return l
+}
+
+// SetTraceSampling makes the Env emit only one in every n events of the given type. A value
+// of n less than two disables sampling. Warn and Error events are never sampled out.
+func (t *Env) SetTraceSampling(event Event, n int64) {
+	t.traceFilterLk.Lock()
+	defer t.traceFilterLk.Unlock()
+	l := t.traceLimit(event)
+	l.sample, l.seen = n, 0
+	t.updateTraceFiltered()
+}
+
+// SetTraceRateLimit makes the Env emit at most perSecond events of the given type in any
+// one-second window. A value of zero removes the limit. Warn and Error events are never
+// rate limited.
+func (t *Env) SetTraceRateLimit(event Event, perSecond int64) {
+	t.traceFilterLk.Lock()
+	defer t.traceFilterLk.Unlock()
+	l := t.traceLimit(event)
+	l.rate, l.admitted = perSecond, 0
+	t.updateTraceFiltered()
+}
+
+// admits returns true if an event emitted by an Amb with the given label stack passes the
+// trace filters, sampling and rate limits
+func (t *Env) admits(labels []string, event Event) bool {
+	if atomic.LoadInt32(&t.traceFiltered) == 0 {
+		return true
+	}
+	t.traceFilterLk.Lock()
+	defer t.traceFilterLk.Unlock()
+	min, depth := LevelDetail, -1
+	for _, f := range t.traceFilters {
+		if len(f.labels) > depth && f.match(labels) {
+			min, depth = f.min, len(f.labels)
+		}
+	}
+	if event.Level() < min {
+		return false
+	}
+	if event.Level() >= LevelWarn {
+		return true
+	}
+	l, ok := t.traceLimits[event]
+	if !ok {
+		return true
+	}
+	if l.sample > 1 {
+		l.seen++
+		if (l.seen-1) % l.sample != 0 {
+			return false
+		}
+	}
+	if l.rate > 0 {
+		now := t.Now()
+		if now - l.window >= 1e9 {
+			l.window, l.admitted = now, 0
+		}
+		if l.admitted >= l.rate {
+			return false
+		}
+		l.admitted++
+	}
+	return true
+}
@@ -0,0 +1,164 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"sync"
+)
+
+// MultiTraceWriter is a TraceWriter that replicates all traces to a set of TraceWriters
+type MultiTraceWriter struct {
+	sync.Mutex
+	writers []TraceWriter
+}
+
+// NewMultiTraceWriter creates a TraceWriter that fans out to writers
+func NewMultiTraceWriter(writers ...TraceWriter) *MultiTraceWriter {
+	return &MultiTraceWriter{ writers: writers }
+}
+
+// Add adds w to the set of TraceWriters that receive traces
+func (t *MultiTraceWriter) Add(w TraceWriter) {
+	t.Lock()
+	defer t.Unlock()
+	t.writers = append(t.writers, w)
+}
+
+func (t *MultiTraceWriter) snapshot() []TraceWriter {
+	t.Lock()
+	defer t.Unlock()
+	return t.writers
+}
+
+func (t *MultiTraceWriter) Write(r *Trace) {
+	for _, w := range t.snapshot() {
+		w.Write(r)
+	}
+}
+
+// Sync syncs all writers and returns the first error encountered
+func (t *MultiTraceWriter) Sync() error {
+	var err error
+	for _, w := range t.snapshot() {
+		if e := w.Sync(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Close closes all writers and returns the first error encountered
+func (t *MultiTraceWriter) Close() error {
+	var err error
+	for _, w := range t.snapshot() {
+		if e := w.Close(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// RingTraceWriter is a TraceWriter that keeps the most recent traces in memory. It is useful
+// for capturing the events leading up to a failure without the cost of logging to a file.
+type RingTraceWriter struct {
+	sync.Mutex
+	ring  []*Trace
+	next  int   // Index in ring where the next trace goes
+	total int64 // Total number of traces written
+}
+
+// NewRingTraceWriter creates a RingTraceWriter that retains the last size traces
+func NewRingTraceWriter(size int) *RingTraceWriter {
+	if size <= 0 {
+		panic("ring size must be positive")
+	}
+	return &RingTraceWriter{ ring: make([]*Trace, size) }
+}
+
+func (t *RingTraceWriter) Write(r *Trace) {
+	t.Lock()
+	defer t.Unlock()
+	t.ring[t.next] = r
+	t.next = (t.next + 1) % len(t.ring)
+	t.total++
+}
+
+// Traces returns the retained traces, oldest first
+func (t *RingTraceWriter) Traces() []*Trace {
+	t.Lock()
+	defer t.Unlock()
+	n := int(min64(t.total, int64(len(t.ring))))
+	traces := make([]*Trace, 0, n)
+	for i := 0; i < n; i++ {
+		traces = append(traces, t.ring[(t.next-n+i+len(t.ring))%len(t.ring)])
+	}
+	return traces
+}
+
+// Total returns the number of traces written so far, including ones no longer retained
+func (t *RingTraceWriter) Total() int64 {
+	t.Lock()
+	defer t.Unlock()
+	return t.total
+}
+
+func (t *RingTraceWriter) Sync() error { return nil }
+
+func (t *RingTraceWriter) Close() error { return nil }
+
+// ChanTraceWriter is a TraceWriter that delivers traces over a channel. Write never blocks:
+// traces that do not fit in the channel buffer are dropped and counted, so that a slow
+// consumer cannot stall the emitting DCCP stack.
+type ChanTraceWriter struct {
+	sync.Mutex
+	ch      chan *Trace
+	closed  bool
+	dropped int64
+}
+
+// NewChanTraceWriter creates a ChanTraceWriter whose channel has the given buffer length
+func NewChanTraceWriter(buflen int) *ChanTraceWriter {
+	return &ChanTraceWriter{ ch: make(chan *Trace, buflen) }
+}
+
+// Chan returns the channel on which traces are delivered. It is closed when the writer is closed.
+func (t *ChanTraceWriter) Chan() <-chan *Trace {
+	return t.ch
+}
+
+// Write sends r on the channel, or drops it if the channel buffer is full. Traces written
+// after Close are discarded.
+func (t *ChanTraceWriter) Write(r *Trace) {
+	t.Lock()
+	defer t.Unlock()
+	if t.closed {
+		return
+	}
+	select {
+	case t.ch <- r:
+	default:
+		t.dropped++
+	}
+}
+
+// Dropped returns the number of traces dropped so far because the channel buffer was full
+func (t *ChanTraceWriter) Dropped() int64 {
+	t.Lock()
+	defer t.Unlock()
+	return t.dropped
+}
+
+func (t *ChanTraceWriter) Sync() error { return nil }
+
+func (t *ChanTraceWriter) Close() error {
+	t.Lock()
+	defer t.Unlock()
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+	close(t.ch)
+	return nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTraceWriters(t *testing.T) {
+	ring := NewRingTraceWriter(3)
+	ch := NewChanTraceWriter(10)
+	env := NewEnv(NewMultiTraceWriter(ring, ch))
+	amb := NewAmb("test", env)
+	for _, c := range []string{"a", "b", "c", "d", "e"} {
+		amb.E(EventInfo, c)
+	}
+	if err := env.Close(); err != nil {
+		t.Fatalf("close (%s)", err)
+	}
+
+	traces := ring.Traces()
+	if len(traces) != 3 || ring.Total() != 5 {
+		t.Fatalf("ring retained %d of %d traces", len(traces), ring.Total())
+	}
+	for i, c := range []string{"c", "d", "e"} {
+		if traces[i].Comment != c {
+			t.Errorf("ring trace %d is %q, expecting %q", i, traces[i].Comment, c)
+		}
+	}
+
+	var n int
+	for r := range ch.Chan() {
+		if r.Labels[0] != "test" {
+			t.Errorf("unexpected labels %v", r.Labels)
+		}
+		n++
+	}
+	if n != 5 {
+		t.Errorf("channel delivered %d traces, expecting 5", n)
+	}
+}
+
+func TestChanTraceWriterFull(t *testing.T) {
+	ch := NewChanTraceWriter(2)
+	for i := 0; i < 5; i++ {
+		ch.Write(&Trace{})
+	}
+	if ch.Dropped() != 3 {
+		t.Errorf("dropped %d traces, expecting 3", ch.Dropped())
+	}
+	// Close must not wait for the consumer
+	ch.Close()
+	var n int
+	for _ = range ch.Chan() {
+		n++
+	}
+	if n != 2 {
+		t.Errorf("channel delivered %d traces, expecting 2", n)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics()
+	m.Write(&Trace{ Labels: []string{"client"}, Conn: 1, State: "REQUEST", Event: EventWrite, Type: "Request" })
+	m.Write(&Trace{ Labels: []string{"client"}, Conn: 2, State: "REQUEST", Event: EventWrite, Type: "Request" })
+	m.Write(&Trace{ Labels: []string{"client"}, Conn: 1, State: "OPEN", Event: EventRead, Type: "Ack" })
+	m.Write(&Trace{ Labels: []string{"client", "sender"}, Conn: 1, Event: EventInfo,
+		Args: map[string]interface{}{ SampleType: NewSample("RTT", 12.5, "ms") } })
+	m.Write(&Trace{ Labels: []string{"client"}, Conn: 1, State: "CLOSED", Event: EventWrite, Type: "Reset" })
+	m.Write(&Trace{ Labels: []string{"client"}, Conn: 1, State: "CLOSED", Event: EventInfo })
+	if len(m.state) != 1 {
+		t.Errorf("following %d connections, expecting 1", len(m.state))
+	}
+
+	var w bytes.Buffer
+	m.WriteTo(&w)
+	for _, line := range []string{
+		`dccp_connections{state="OPEN"} 0`,
+		`dccp_connections{state="REQUEST"} 1`,
+		`dccp_packets_total{conn="client",dir="write",type="Reset"} 1`,
+		`dccp_resets_total{conn="client"} 1`,
+		`dccp_sample{conn="client",series="RTT",unit="ms"} 12.5`,
+		`# TYPE dccp_packets_total counter`,
+	} {
+		if !strings.Contains(w.String(), line + "\n") {
+			t.Errorf("missing %q in:\n%s", line, w.String())
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+//go:build (linux && amd64) || (linux && arm64)
+// +build linux,amd64 linux,arm64
+
+package dccp
+
+import (
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+// mmsghdr mirrors struct mmsghdr from <sys/socket.h>
+type mmsghdr struct {
+	hdr syscall.Msghdr
+	len uint32
+	_   [4]byte
+}
+
+// writeBatch sends the packets in msgs with as few sendmmsg system calls as possible. v6
+// tells whether the socket belongs to the AF_INET6 family.
+func writeBatch(c *net.UDPConn, v6 bool, msgs []udpMessage) error {
+	rc, err := c.SyscallConn()
+	if err != nil {
+		return err
+	}
+	hdrs := make([]mmsghdr, len(msgs))
+	iovs := make([]syscall.Iovec, len(msgs))
+	names := make([]syscall.RawSockaddrInet6, len(msgs))
+	for i, m := range msgs {
+		buf := *m.buf
+		if len(buf) > 0 {
+			iovs[i].Base = &buf[0]
+		}
+		iovs[i].SetLen(len(buf))
+		hdrs[i].hdr.Iov = &iovs[i]
+		hdrs[i].hdr.Iovlen = 1
+		hdrs[i].hdr.Name = (*byte)(unsafe.Pointer(&names[i]))
+		if hdrs[i].hdr.Namelen, err = putSockaddr(&names[i], m.addr, v6); err != nil {
+			return err
+		}
+		if len(m.oob) > 0 {
+			hdrs[i].hdr.Control = &m.oob[0]
+			hdrs[i].hdr.SetControllen(len(m.oob))
+		}
+	}
+	var serr error
+	werr := rc.Write(func(fd uintptr) bool {
+		for len(hdrs) > 0 {
+			n, _, errno := syscall.Syscall6(sysSENDMMSG, fd,
+				uintptr(unsafe.Pointer(&hdrs[0])), uintptr(len(hdrs)), 0, 0, 0)
+			switch errno {
+			case 0:
+			case syscall.EINTR:
+				continue
+			case syscall.EAGAIN:
+				return false
+			default:
+				serr = errno
+				return true
+			}
+			hdrs = hdrs[n:]
+		}
+		return true
+	})
+	if werr != nil {
+		return werr
+	}
+	return serr
+}
+
+// putSockaddr writes addr in raw form to sa and returns its length. IPv4 addresses are
+// written in their IPv4-mapped form if v6 is set.
+func putSockaddr(sa *syscall.RawSockaddrInet6, addr *net.UDPAddr, v6 bool) (uint32, error) {
+	port := uint16(addr.Port)
+	if ip4 := addr.IP.To4(); ip4 != nil && !v6 {
+		sa4 := (*syscall.RawSockaddrInet4)(unsafe.Pointer(sa))
+		sa4.Family = syscall.AF_INET
+		sa4.Port = port>>8 | port<<8
+		copy(sa4.Addr[:], ip4)
+		return syscall.SizeofSockaddrInet4, nil
+	}
+	ip16 := addr.IP.To16()
+	if ip16 == nil || !v6 {
+		return 0, syscall.EAFNOSUPPORT
+	}
+	sa.Family = syscall.AF_INET6
+	sa.Port = port>>8 | port<<8
+	copy(sa.Addr[:], ip16)
+	return syscall.SizeofSockaddrInet6, nil
+}
+
+// getSockaddr converts the raw address sa, written by the kernel, to a UDP address
+func getSockaddr(sa *syscall.RawSockaddrInet6) *net.UDPAddr {
+	switch sa.Family {
+	case syscall.AF_INET:
+		sa4 := (*syscall.RawSockaddrInet4)(unsafe.Pointer(sa))
+		ip := net.IPv4(sa4.Addr[0], sa4.Addr[1], sa4.Addr[2], sa4.Addr[3])
+		return &net.UDPAddr{IP: ip, Port: int(sa4.Port>>8 | sa4.Port<<8)}
+	case syscall.AF_INET6:
+		ip := make(net.IP, net.IPv6len)
+		copy(ip, sa.Addr[:])
+		return &net.UDPAddr{IP: ip, Port: int(sa.Port>>8 | sa.Port<<8)}
+	}
+	return nil
+}
+
+// readBatch receives as many packets as are available, up to one per buffer in bufs, with a
+// single recvmmsg system call, blocking until at least one packet arrives. The received
+// packets are appended to queue in order, using the first buffers of bufs.
+func readBatch(c *net.UDPConn, bufs [][]byte, queue []udpPacket) ([]udpPacket, error) {
+	rc, err := c.SyscallConn()
+	if err != nil {
+		return queue, err
+	}
+	hdrs := make([]mmsghdr, len(bufs))
+	iovs := make([]syscall.Iovec, len(bufs))
+	names := make([]syscall.RawSockaddrInet6, len(bufs))
+	for i, buf := range bufs {
+		iovs[i].Base = &buf[0]
+		iovs[i].SetLen(len(buf))
+		hdrs[i].hdr.Iov = &iovs[i]
+		hdrs[i].hdr.Iovlen = 1
+		hdrs[i].hdr.Name = (*byte)(unsafe.Pointer(&names[i]))
+		hdrs[i].hdr.Namelen = syscall.SizeofSockaddrInet6
+	}
+	var n uintptr
+	var serr error
+	rerr := rc.Read(func(fd uintptr) bool {
+		for {
+			var errno syscall.Errno
+			n, _, errno = syscall.Syscall6(syscall.SYS_RECVMMSG, fd,
+				uintptr(unsafe.Pointer(&hdrs[0])), uintptr(len(hdrs)), 0, 0, 0)
+			switch errno {
+			case 0:
+				return true
+			case syscall.EINTR:
+				continue
+			case syscall.EAGAIN:
+				return false
+			default:
+				serr = errno
+				return true
+			}
+		}
+	})
+	if rerr != nil {
+		return queue, rerr
+	}
+	if serr != nil {
+		return queue, serr
+	}
+	for i := 0; i < int(n); i++ {
+		queue = append(queue, udpPacket{bufs[i][:hdrs[i].len], getSockaddr(&names[i])})
+	}
+	return queue, nil
+}
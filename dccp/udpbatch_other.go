@@ -0,0 +1,32 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+//go:build !linux || (!amd64 && !arm64)
+// +build !linux !amd64,!arm64
+
+package dccp
+
+import (
+	"net"
+)
+
+// writeBatch sends the packets in msgs one at a time, on platforms without sendmmsg support
+func writeBatch(c *net.UDPConn, v6 bool, msgs []udpMessage) error {
+	for _, m := range msgs {
+		if _, _, err := c.WriteMsgUDP(*m.buf, m.oob, m.addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readBatch receives a single packet into bufs[0] and appends it to queue, on platforms
+// without recvmmsg support
+func readBatch(c *net.UDPConn, bufs [][]byte, queue []udpPacket) ([]udpPacket, error) {
+	n, addr, err := c.ReadFromUDP(bufs[0])
+	if err != nil {
+		return queue, err
+	}
+	return append(queue, udpPacket{bufs[0][:n], addr}), nil
+}
@@ -6,12 +6,45 @@ package dccp
 
 import (
 	"net"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
 // UDPLink binds to a UDP port and acts as a Link.
 type UDPLink struct {
-	c *net.UDPConn
+	c     *net.UDPConn
+	netw  string
+	laddr *net.UDPAddr // Address the socket is bound to, as found when it was bound
+	v6    bool         // Whether the socket belongs to the AF_INET6 family, judging by laddr
+
+	batching   int32         // Non-zero while batchSize is over 1, accessed atomically
+	batchLk    Mutex
+	batchSize  int           // Maximum number of packets per batch; batching is off if at most 1
+	batchFlush int64         // Maximum time in nanoseconds a packet waits in a partial batch
+	batch      []udpMessage  // Packets waiting to be sent
+	batchTimer *time.Timer   // Flushes a partial batch
+	batchErr   error         // Error from the last batch send, reported by the next WriteTo
+	tos        int           // Traffic class set by SetTrafficClass, or -1 if none
+
+	readLk     Mutex
+	readBatch  int           // Maximum number of packets received per system call
+	readBufs   [][]byte      // Receive buffers; those handed out by ReadBlock are replaced
+	readQueue  []udpPacket   // Packets received by the last batch
+	readNext   int           // Index in readQueue of the next packet to be returned by ReadBlock
+}
+
+// udpPacket is a received packet waiting to be returned by ReadBlock
+type udpPacket struct {
+	block []byte
+	addr  *net.UDPAddr
+}
+
+// udpMessage is an outgoing packet waiting in a batch. The buffer is owned by the batch.
+type udpMessage struct {
+	buf  *[]byte
+	addr *net.UDPAddr
+	oob  []byte // Control message marking the packet with a traffic class, if any
 }
 
 func BindUDPLink(netw string, laddr *net.UDPAddr) (link *UDPLink, err error) {
@@ -19,11 +52,75 @@ func BindUDPLink(netw string, laddr *net.UDPAddr) (link *UDPLink, err error) {
 	if err != nil {
 		return nil, err
 	}
-	return &UDPLink{c}, nil
+	u := &UDPLink{c: c, netw: netw, tos: -1}
+	u.laddr, _ = c.LocalAddr().(*net.UDPAddr)
+	// An AF_INET6 socket reports an IPv6 address, even if it is bound to all IPv4 addresses
+	u.v6 = u.laddr != nil && u.laddr.IP.To4() == nil
+	return u, nil
+}
+
+// Rebind implements RebindLink.Rebind. The new link is bound to the UDP address laddr, and it
+// batches writes and sets the traffic class like u. Its reads are not batched until
+// SetReadBatch is called on it.
+func (u *UDPLink) Rebind(laddr net.Addr) (Link, error) {
+	uaddr, ok := laddr.(*net.UDPAddr)
+	if !ok {
+		return nil, syscall.EINVAL
+	}
+	v, err := BindUDPLink(u.netw, uaddr)
+	if err != nil {
+		return nil, err
+	}
+	u.batchLk.Lock()
+	v.setBatchSize(u.batchSize)
+	v.batchFlush = u.batchFlush
+	tos := u.tos
+	u.batchLk.Unlock()
+	if tos >= 0 {
+		if err = v.SetTrafficClass(byte(tos)); err != nil {
+			v.Close()
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// SetWriteBatch makes WriteTo queue outgoing packets and send them in batches of up to size
+// packets. On Linux, each batch is sent with a single sendmmsg system call. A partial batch is
+// sent at most flush nanoseconds after its first packet was queued. A size of 1 or less turns
+// batching off. While batching, send errors are returned by the next call to WriteTo or Flush.
+func (u *UDPLink) SetWriteBatch(size int, flush int64) error {
+	u.batchLk.Lock()
+	defer u.batchLk.Unlock()
+	err := u.flush()
+	u.setBatchSize(size)
+	u.batchFlush = flush
+	return err
+}
+
+// setBatchSize sets the maximum number of packets per batch
+func (u *UDPLink) setBatchSize(size int) {
+	var batching int32
+	if size > 1 {
+		batching = 1
+	}
+	u.batchSize = size
+	atomic.StoreInt32(&u.batching, batching)
+}
+
+// SetReadBatch makes ReadBlock receive up to size packets at a time. On Linux, each batch is
+// received with a single recvmmsg system call. A size of 1 or less turns batching off.
+func (u *UDPLink) SetReadBatch(size int) {
+	u.readLk.Lock()
+	defer u.readLk.Unlock()
+	u.readBatch = size
 }
 
 func (u *UDPLink) GetMTU() int { return 1500 }
 
+// LocalAddr returns the UDP address the link is bound to
+func (u *UDPLink) LocalAddr() net.Addr { return u.laddr }
+
 func (u *UDPLink) SetReadDeadline(t time.Time) error {
 	return u.c.SetReadDeadline(t)
 }
@@ -32,10 +129,149 @@ func (u *UDPLink) ReadFrom(buf []byte) (n int, addr net.Addr, err error) {
 	return u.c.ReadFrom(buf)
 }
 
+// ReadBlock implements BlockLink.ReadBlock. Packets longer than GetMTU() are truncated to
+// GetMTU()+MuxReadSafety bytes, so the caller can recognize them.
+func (u *UDPLink) ReadBlock() (block []byte, addr net.Addr, err error) {
+	u.readLk.Lock()
+	defer u.readLk.Unlock()
+	if u.readNext >= len(u.readQueue) {
+		size := u.readBatch
+		if size < 1 {
+			size = 1
+		}
+		for len(u.readBufs) < size {
+			u.readBufs = append(u.readBufs, nil)
+		}
+		u.readBufs = u.readBufs[:size]
+		for i, buf := range u.readBufs {
+			if buf == nil {
+				u.readBufs[i] = make([]byte, u.GetMTU()+MuxReadSafety)
+			}
+		}
+		u.readNext = 0
+		if u.readQueue, err = readBatch(u.c, u.readBufs, u.readQueue[:0]); err != nil {
+			return nil, nil, err
+		}
+		// Buffers handed out to the caller must not be reused
+		for i := range u.readQueue {
+			u.readBufs[i] = nil
+		}
+	}
+	p := u.readQueue[u.readNext]
+	u.readQueue[u.readNext] = udpPacket{}
+	u.readNext++
+	return p.block, p.addr, nil
+}
+
+// SetTrafficClass implements TrafficClassLink.SetTrafficClass, by setting the IP_TOS or
+// IPV6_TCLASS option of the socket. Packets waiting in a partial batch are sent first. Traffic
+// classes are only supported on Linux.
+func (u *UDPLink) SetTrafficClass(tos byte) error {
+	rc, err := u.c.SyscallConn()
+	if err != nil {
+		return err
+	}
+	u.batchLk.Lock()
+	defer u.batchLk.Unlock()
+	if err = u.flush(); err != nil {
+		return err
+	}
+	if err = setTrafficClass(rc, tos); err != nil {
+		return err
+	}
+	u.tos = int(tos)
+	return nil
+}
+
+// WriteToClass implements TrafficClassLink.WriteToClass. The traffic class is carried by a
+// control message of the packet, so it does not affect other packets, even in the same batch.
+func (u *UDPLink) WriteToClass(buf []byte, addr net.Addr, tos byte) (n int, err error) {
+	uaddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return 0, syscall.EINVAL
+	}
+	oob, err := trafficClassOOB(uaddr.IP, tos)
+	if err != nil {
+		return 0, err
+	}
+	return u.writeTo(buf, uaddr, oob)
+}
+
 func (u *UDPLink) WriteTo(buf []byte, addr net.Addr) (n int, err error) {
-	return u.c.WriteTo(buf, addr)
+	uaddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return 0, syscall.EINVAL
+	}
+	return u.writeTo(buf, uaddr, nil)
+}
+
+// writeTo sends buf to addr, with the control message oob if it is not nil. Unbatched writes
+// go straight to the socket, without locking the batch.
+func (u *UDPLink) writeTo(buf []byte, addr *net.UDPAddr, oob []byte) (n int, err error) {
+	if atomic.LoadInt32(&u.batching) == 0 {
+		if oob == nil {
+			return u.c.WriteToUDP(buf, addr)
+		}
+		n, _, err = u.c.WriteMsgUDP(buf, oob, addr)
+		return n, err
+	}
+	u.batchLk.Lock()
+	defer u.batchLk.Unlock()
+	if err = u.batchErr; err != nil {
+		u.batchErr = nil
+		return 0, err
+	}
+	p := getBuffer(len(buf))
+	copy(*p, buf)
+	u.batch = append(u.batch, udpMessage{p, addr, oob})
+	if len(u.batch) >= u.batchSize {
+		u.batchErr = u.flush()
+	} else if len(u.batch) == 1 {
+		u.batchTimer = time.AfterFunc(time.Duration(u.batchFlush), u.flushTimer)
+	}
+	return len(buf), nil
+}
+
+// Flush sends any packets waiting in a partial batch
+func (u *UDPLink) Flush() error {
+	u.batchLk.Lock()
+	defer u.batchLk.Unlock()
+	err := u.batchErr
+	u.batchErr = nil
+	if ferr := u.flush(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+func (u *UDPLink) flushTimer() {
+	u.batchLk.Lock()
+	defer u.batchLk.Unlock()
+	if err := u.flush(); err != nil && u.batchErr == nil {
+		u.batchErr = err
+	}
+}
+
+// flush sends the pending batch and recycles its buffers
+func (u *UDPLink) flush() error {
+	u.batchLk.AssertLocked()
+	if u.batchTimer != nil {
+		u.batchTimer.Stop()
+		u.batchTimer = nil
+	}
+	if len(u.batch) == 0 {
+		return nil
+	}
+	err := writeBatch(u.c, u.v6, u.batch)
+	for i, m := range u.batch {
+		putBuffer(m.buf)
+		u.batch[i] = udpMessage{}
+	}
+	u.batch = u.batch[:0]
+	return err
 }
 
 func (u *UDPLink) Close() error {
+	u.Flush()
 	return u.c.Close()
 }
@@ -0,0 +1,188 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func bindLoopbackPair(t testing.TB) (a, b *UDPLink) {
+	var err error
+	if a, err = BindUDPLink("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}); err != nil {
+		t.Fatalf("bind (%s)", err)
+	}
+	if b, err = BindUDPLink("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}); err != nil {
+		t.Fatalf("bind (%s)", err)
+	}
+	return a, b
+}
+
+func TestUDPLinkWriteBatch(t *testing.T) {
+	a, b := bindLoopbackPair(t)
+	defer a.Close()
+	defer b.Close()
+	// A long flush interval ensures that the partial last batch is sent by Flush
+	a.SetWriteBatch(8, 10e9)
+
+	const count = 20
+	for i := 0; i < count; i++ {
+		if _, err := a.WriteTo([]byte{byte(i), 1, 2, 3}, b.c.LocalAddr()); err != nil {
+			t.Fatalf("write (%s)", err)
+		}
+	}
+	if err := a.Flush(); err != nil {
+		t.Fatalf("flush (%s)", err)
+	}
+
+	b.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 100)
+	for i := 0; i < count; i++ {
+		n, addr, err := b.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("read %d (%s)", i, err)
+		}
+		if n != 4 || buf[0] != byte(i) {
+			t.Errorf("packet %d: got % x", i, buf[:n])
+		}
+		if addr.String() != a.c.LocalAddr().String() {
+			t.Errorf("packet %d: from %s", i, addr)
+		}
+	}
+}
+
+func TestUDPLinkFlushInterval(t *testing.T) {
+	a, b := bindLoopbackPair(t)
+	defer a.Close()
+	defer b.Close()
+	a.SetWriteBatch(8, 1e6)
+
+	if _, err := a.WriteTo([]byte{7}, b.c.LocalAddr()); err != nil {
+		t.Fatalf("write (%s)", err)
+	}
+	b.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 100)
+	if n, _, err := b.ReadFrom(buf); err != nil || n != 1 || buf[0] != 7 {
+		t.Fatalf("partial batch not flushed (%d, %v)", n, err)
+	}
+}
+
+func TestUDPLinkReadBatch(t *testing.T) {
+	a, b := bindLoopbackPair(t)
+	defer a.Close()
+	defer b.Close()
+	a.SetWriteBatch(8, 1e6)
+	b.SetReadBatch(8)
+
+	const count = 20
+	for i := 0; i < count; i++ {
+		if _, err := a.WriteTo([]byte{byte(i), 1, 2, 3}, b.c.LocalAddr()); err != nil {
+			t.Fatalf("write (%s)", err)
+		}
+	}
+	if err := a.Flush(); err != nil {
+		t.Fatalf("flush (%s)", err)
+	}
+
+	b.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var blocks [][]byte
+	for i := 0; i < count; i++ {
+		block, addr, err := b.ReadBlock()
+		if err != nil {
+			t.Fatalf("read %d (%s)", i, err)
+		}
+		if len(block) != 4 || block[0] != byte(i) {
+			t.Errorf("packet %d: got % x", i, block)
+		}
+		if addr.String() != a.c.LocalAddr().String() {
+			t.Errorf("packet %d: from %s", i, addr)
+		}
+		blocks = append(blocks, block)
+	}
+	// Blocks handed out earlier must not have been overwritten by later receives
+	for i, block := range blocks {
+		if block[0] != byte(i) {
+			t.Errorf("packet %d overwritten with % x", i, block)
+		}
+	}
+}
+
+func TestUDPLinkReadOversized(t *testing.T) {
+	a, b := bindLoopbackPair(t)
+	defer a.Close()
+	defer b.Close()
+	b.SetReadBatch(4)
+
+	if _, err := a.WriteTo(make([]byte, b.GetMTU()+100), b.c.LocalAddr()); err != nil {
+		t.Fatalf("write (%s)", err)
+	}
+	b.SetReadDeadline(time.Now().Add(5 * time.Second))
+	block, _, err := b.ReadBlock()
+	if err != nil {
+		t.Fatalf("read (%s)", err)
+	}
+	if len(block) <= b.GetMTU() {
+		t.Errorf("oversized packet not recognizable, got %d bytes", len(block))
+	}
+}
+
+func benchmarkUDPLinkWrite(b *testing.B, batch int) {
+	src, dst := bindLoopbackPair(b)
+	defer src.Close()
+	defer dst.Close()
+	src.SetWriteBatch(batch, 1e6)
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			if _, _, err := dst.ReadFrom(buf); err != nil {
+				return
+			}
+		}
+	}()
+	payload := make([]byte, 1000)
+	addr := dst.c.LocalAddr()
+	b.SetBytes(int64(len(payload)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := src.WriteTo(payload, addr); err != nil {
+			b.Fatalf("write (%s)", err)
+		}
+	}
+	src.Flush()
+}
+
+func BenchmarkUDPLinkWrite(b *testing.B)      { benchmarkUDPLinkWrite(b, 1) }
+func BenchmarkUDPLinkWriteBatch(b *testing.B) { benchmarkUDPLinkWrite(b, 32) }
+
+func benchmarkUDPLinkRead(b *testing.B, batch int) {
+	src, dst := bindLoopbackPair(b)
+	defer src.Close()
+	defer dst.Close()
+	src.SetWriteBatch(32, 1e6)
+	dst.SetReadBatch(batch)
+	payload := make([]byte, 1000)
+	addr := dst.c.LocalAddr()
+	b.SetBytes(int64(len(payload)))
+	b.ResetTimer()
+	received := 0
+	for received < b.N {
+		// Send in rounds that fit comfortably into the socket receive buffer
+		for i := 0; i < 64; i++ {
+			src.WriteTo(payload, addr)
+		}
+		src.Flush()
+		dst.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		for i := 0; i < 64; i++ {
+			if _, _, err := dst.ReadBlock(); err != nil {
+				break
+			}
+			received++
+		}
+	}
+}
+
+func BenchmarkUDPLinkRead(b *testing.B)      { benchmarkUDPLinkRead(b, 1) }
+func BenchmarkUDPLinkReadBatch(b *testing.B) { benchmarkUDPLinkRead(b, 32) }
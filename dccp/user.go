@@ -6,6 +6,7 @@ package dccp
 
 import (
 	"fmt"
+	"net"
 )
 
 // This is an approximate upper bound on the size of options that are
@@ -13,8 +14,14 @@ import (
 const maxDataOptionSize = 24
 
 // GetMTU() returns the maximum size of an application-level data block that can be passed
-// to Write This is an informative number. Packets are sent anyway, but they may be
-// dropped by the link layer or a router.
+// to Write. It follows the maximum packet size, which is the lesser of the PMTU of the link
+// and the limit of the sender CCID, Section 14. Write returns a TooLargeError for larger
+// blocks, rather than send packets that would be dropped or fragmented on the way.
+//
+// GetMTU leaves room for maxDataOptionSize bytes of options, which is usually enough, but
+// not a guarantee: a packet may carry more, like an Init Cookie, Data Dropped options or the
+// options of the CCIDs. A message whose packet turns out larger than the maximum packet size
+// once its options are placed is not sent, and it is reported on Drops with DropTooLarge.
 func (c *Conn) GetMTU() int {
 	c.Lock()
 	defer c.Unlock()
@@ -22,55 +29,94 @@ func (c *Conn) GetMTU() int {
 	return int(c.socket.GetMPS()) - maxDataOptionSize - getFixedHeaderSize(DataAck, true)
 }
 
-// Write blocks until the slice b is sent.
+// Write queues the slice data for sending. If WriteDataQueueLen blocks are already queued,
+// Write blocks until there is space, which is how the congestion control rate limit pushes
+// back on the application, unless the queue policy drops a queued block instead. Data that
+// is still queued when the connection starts closing is discarded. Write must not modify
+// data after it has returned.
 func (c *Conn) Write(data []byte) error {
+	return c.push(data, WriteMeta{})
+}
 
-	//?
+// Flush blocks until the write loop has taken all queued application data for sending, so
+// that a Close that follows does not discard it. Flush returns ErrBad if the connection
+// stopped accepting data before then.
+func (c *Conn) Flush() error {
+	c.journalAdd(&JournalEntry{ Kind: JournalFlush })
+	return c.writeQueue.flush()
+}
 
-	c.writeDataLk.Lock()
-	defer c.writeDataLk.Unlock()
-	if c.writeData == nil {
-		return ErrBad
+// LocalAddr returns the address of the local end of the connection, a *DCCPAddr that carries
+// the Service Code of the connection. Its IP and port are those of the underlying link, if
+// the HeaderConn implements AddrConn, as the flows of a Mux do.
+func (c *Conn) LocalAddr() net.Addr {
+	var addr net.Addr
+	if ac, ok := c.hc.(AddrConn); ok {
+		addr = ac.LocalAddr()
 	}
-	c.writeData <- data
-	return nil
+	return newDCCPAddr(addr, c.serviceCode())
 }
 
+// RemoteAddr returns the address of the remote end of the connection, see LocalAddr
+func (c *Conn) RemoteAddr() net.Addr {
+	var addr net.Addr
+	if ac, ok := c.hc.(AddrConn); ok {
+		addr = ac.RemoteAddr()
+	}
+	return newDCCPAddr(addr, c.serviceCode())
+}
+
+// serviceCode returns the Service Code of the connection
+func (c *Conn) serviceCode() uint32 {
+	c.Lock()
+	defer c.Unlock()
+	return c.socket.GetServiceCode()
+}
+
+// SetTrafficClass marks the packets of the connection with the IP traffic class tos, such as
+// TrafficClassEF for telephony, so that networks that honor the DSCP can prioritize them. The
+// lower two bits of tos are replaced by the ECN codepoint, see SetECN. It returns
+// ErrUnsupported unless the underlying HeaderConn implements TrafficClassConn, as the flows
+// of a Mux over a UDPLink or an IPLink on Linux do.
+func (c *Conn) SetTrafficClass(tos byte) error {
+	if _, ok := c.hc.(TrafficClassConn); !ok {
+		return ErrUnsupported
+	}
+	c.Lock()
+	c.tclass = tos
+	tos, _ = c.placeTrafficClass()
+	c.Unlock()
+	return c.markTrafficClass(tos)
+}
+
+// RTT returns the current round-trip time estimate of the sender CCID, in nanoseconds
+func (c *Conn) RTT() int64 { return c.loadRTT() }
+
+// Queued returns the number of application data blocks waiting in the write queue. Write
+// blocks, or the queue policy drops data, while WriteDataQueueLen blocks are queued.
+func (c *Conn) Queued() int { return c.writeQueue.dataQueued() }
+
 // Read blocks until the next packet of application data is received. Successfuly read data
 // is returned in a slice. The error returned by Read behaves according to io.Reader. If the
 // connection was never established or was aborted, Read returns ErrIO. If the connection
 // was closed normally, Read returns io.EOF. In the event of a non-nil error, successive
-// calls to Read return the same error.
+// calls to Read return the same error. The returned slice belongs to the caller; it refers
+// directly to the packet buffer received from the link, without an intermediate copy.
 func (c *Conn) Read() (b []byte, err error) {
-	c.readAppLk.Lock()
-	readApp := c.readApp
-	c.readAppLk.Unlock()
-	if readApp == nil {
-		if c.Error() == nil {
-			panic("torn connection missing error")
-		}
-		return nil, c.Error()
-	}
-	b, ok := <-readApp
-	if !ok {
-		if c.Error() == nil {
-			panic("torn connection missing error")
-		}
-		// The connection has been closed
-		return nil, c.Error()
-	}
-	return b, nil
+	b, _, err = c.ReadMsg()
+	return b, err
 }
 
 func (c *Conn) Error() error {
-	c.Lock()
-	defer c.Unlock()
+	c.errLk.Lock()
+	defer c.errLk.Unlock()
 	return c.err
 }
 
 // Close implements SegmentConn.Close.
 // It closes the connection, Section 8.3.
 func (c *Conn) Close() error {
+	c.journalAdd(&JournalEntry{ Kind: JournalClose })
 	c.Lock()
 	defer c.Unlock()
 	state := c.socket.GetState()
@@ -89,17 +135,130 @@ func (c *Conn) Close() error {
 		return nil
 	case CLOSEREQ, CLOSING, TIMEWAIT, CLOSED:
 		if c.err == nil {
-			panic(fmt.Sprintf("%s without error", StateString(state)))
+			panic(fmt.Sprintf("%s without error\n%s", StateString(state), c.dump()))
 		}
 		return c.err
 	}
 	panic("unknown state")
 }
 
+// CloseRead shuts down the half-connection from the remote to the local endpoint, while
+// data can still be written until Close. Data that was received but not yet read is
+// discarded, and Read returns ErrEOF. Data that arrives afterwards is dropped and reported
+// to the peer in the Data Dropped option as not listened to. The HC-Receiver CCID is closed.
+func (c *Conn) CloseRead() error {
+	c.journalAdd(&JournalEntry{ Kind: JournalCloseRead })
+	c.Lock()
+	defer c.Unlock()
+	if err := c.Error(); err != nil {
+		return err
+	}
+	c.readAppLk.Lock()
+	defer c.readAppLk.Unlock()
+	if c.readClosed {
+		return ErrBad
+	}
+	c.readClosed = true
+	if c.readApp != nil {
+		close(c.readApp)
+		c.readApp = nil
+	}
+	if c.ccidOpen {
+		c.rcc().Close()
+	}
+	return nil
+}
+
+// CloseWrite shuts down the half-connection from the local to the remote endpoint, while
+// data can still be read until Close. Like Flush, it blocks until the data queued so far has
+// been taken for sending. Afterwards Write returns ErrBad and the HC-Sender CCID is closed.
+// The packets that acknowledge received data are still sent.
+func (c *Conn) CloseWrite() error {
+	c.journalAdd(&JournalEntry{ Kind: JournalCloseWrite })
+	if err := c.writeQueue.flush(); err != nil {
+		return err
+	}
+	c.Lock()
+	defer c.Unlock()
+	if c.writeClosed {
+		return ErrBad
+	}
+	c.writeClosed = true
+	c.writeQueue.closeData()
+	if c.ccidOpen {
+		c.scc().Close()
+	}
+	return nil
+}
+
+// isReadClosed returns true if CloseRead has been called
+func (c *Conn) isReadClosed() bool {
+	c.readAppLk.Lock()
+	defer c.readAppLk.Unlock()
+	return c.readClosed
+}
+
 func (c *Conn) Abort() {
+	c.journalAdd(&JournalEntry{ Kind: JournalAbort })
 	c.abortWith(ResetAborted)
 }
 
+// SetOptionPolicy sets the treatment of received packets with faulty options. The default
+// is OptionsStrict. Faulty options are reported to the Conn's Amb in either case.
+func (c *Conn) SetOptionPolicy(policy OptionPolicy) {
+	c.Lock()
+	defer c.Unlock()
+	c.optionPolicy = policy
+}
+
+// SetQueuePolicy sets the policy of the queue of application data waiting to be sent. The
+// default is QueueFIFO.
+func (c *Conn) SetQueuePolicy(policy QueuePolicy) {
+	c.writeQueue.setPolicy(policy)
+}
+
+// SetViolationPolicy sets the treatment of received packets that violate the protocol. The
+// default is ViolationsRFC. If f is not nil, it is called with each violation. It is called
+// while the Conn is locked, so it must not call the methods of the Conn.
+func (c *Conn) SetViolationPolicy(policy ViolationPolicy, f func(*Violation)) {
+	c.Lock()
+	defer c.Unlock()
+	c.violationPolicy = policy
+	c.violationFunc = f
+}
+
+// Features holds the feature values in effect on a connection, Section 6, as negotiated with
+// ChangeFeature, or else as both endpoints assume them
+type Features struct {
+	ServiceCode  uint32
+	CCIDA        byte  // CCID of the half-connection from the local to the remote endpoint, as negotiated, Section 10
+	CCIDB        byte  // CCID of the half-connection from the remote to the local endpoint
+	SWAF         int64 // Sequence Window/A, Section 7.5.2
+	SWBF         int64 // Sequence Window/B
+	ShortSeqNosA bool  // Allow Short Seqnos/A: the local endpoint may send short sequence numbers, Section 7.6.1
+	ShortSeqNosB bool  // Allow Short Seqnos/B: the remote endpoint may send short sequence numbers
+	MPS          int32 // Maximum packet size, the lesser of the path MTU and the CCMPS
+	RTT          int64 // Round-trip time estimate in nanoseconds
+}
+
+// Features returns the feature values in effect on the connection
+func (c *Conn) Features() Features {
+	c.Lock()
+	defer c.Unlock()
+	c.syncWithLink()
+	return Features{
+		ServiceCode:  c.socket.GetServiceCode(),
+		CCIDA:        c.socket.GetCCIDA(),
+		CCIDB:        c.socket.GetCCIDB(),
+		SWAF:         c.socket.SWAF,
+		SWBF:         c.socket.SWBF,
+		ShortSeqNosA: c.allowsShortSeqNos(FeatureLocal),
+		ShortSeqNosB: c.allowsShortSeqNos(FeatureRemote),
+		MPS:          c.socket.GetMPS(),
+		RTT:          c.socket.GetRTT(),
+	}
+}
+
 // LocalLabel implements SegmentConn.LocalLabel
 func (c *Conn) LocalLabel() Bytes { return c.hc.LocalLabel() }
 
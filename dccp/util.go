@@ -39,6 +39,13 @@ func min32(x, y int32) int32 {
 	return y
 }
 
+func max8(x, y int8) int8 {
+	if x > y {
+		return x
+	}
+	return y
+}
+
 func min64(x, y int64) int64 {
 	if x < y {
 		return x
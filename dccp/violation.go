@@ -0,0 +1,60 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+// Kinds of protocol violations by received packets
+const (
+	ViolationChecksum = iota + 1 // Bad checksum or checksum coverage
+	ViolationType                // Packet type unexpected in the state or role of the connection
+	ViolationOptions             // Malformed options, or a Mandatory option that is not understood
+)
+
+// Violation describes a received packet that violates the protocol
+type Violation struct {
+	Kind   int
+	Header *Header // The offending packet, or nil for ViolationChecksum
+	Reason string
+}
+
+// ViolationPolicy determines how a Conn treats received packets that violate the protocol.
+// Packets with a bad checksum are always dropped, since none of their contents can be trusted.
+// Likewise, Resets are never answered with a Reset.
+type ViolationPolicy int
+
+const (
+	// ViolationsRFC treats violations as Section 8.5 prescribes: Packets of unexpected types
+	// are answered with a Sync, packets with malformed options are dropped, and Mandatory
+	// options that are not understood reset the connection
+	ViolationsRFC ViolationPolicy = iota
+
+	// ViolationsDrop drops violating packets silently. It suits servers that are exposed
+	// to noise from the Internet.
+	ViolationsDrop
+
+	// ViolationsReset resets the connection with the Reset Code that matches the violation
+	ViolationsReset
+)
+
+// violate reports a violation by the received header h, which is nil if it could not be
+// read, and returns the policy that applies to it. In strict RFC mode, this is ViolationsRFC.
+func (c *Conn) violate(kind int, h *Header, reason string) ViolationPolicy {
+	c.AssertLocked()
+	c.stats.Violations++
+	c.amb.E(EventWarn, "Violation: "+reason, h)
+	if c.violationFunc != nil {
+		c.violationFunc(&Violation{Kind: kind, Header: h, Reason: reason})
+	}
+	policy := c.violationPolicy
+	switch {
+	case c.env.StrictRFC():
+		policy = ViolationsRFC
+	case policy != ViolationsRFC:
+		c.env.Deviate(c.amb, devViolationPolicy, h)
+	}
+	if policy == ViolationsReset && (h == nil || h.Type == Reset) {
+		return ViolationsDrop
+	}
+	return policy
+}
@@ -0,0 +1,235 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"fmt"
+	"sync"
+)
+
+const (
+	WheelTick  = 1e6 // Resolution of Env timers, 1 ms in ns
+	wheelSlots = 512 // Number of slots in the timer wheel; one revolution lasts 512 ticks
+)
+
+// Timer is a pending call scheduled with Env.AfterFunc
+type Timer struct {
+	wheel      *timerWheel
+	f          func()
+	rounds     int64  // Remaining revolutions of the wheel before the timer is due
+	slot       int    // Slot of the wheel holding the timer
+	queued     bool   // True while the timer is in the wheel
+	prev, next *Timer // Neighbours in the slot list
+
+	fmt_       string
+	args_      []interface{}
+}
+
+// Stop prevents the timer from firing. It returns false if the timer has already fired or
+// has been stopped.
+func (t *Timer) Stop() bool {
+	w := t.wheel
+	w.lk.Lock()
+	defer w.lk.Unlock()
+	if !t.queued {
+		return false
+	}
+	w.unlink(t)
+	return true
+}
+
+// String returns the annotation of the timer
+func (t *Timer) String() string {
+	return fmt.Sprintf(t.fmt_, t.args_...)
+}
+
+// timerWheel is a hashed timer wheel. Timers are hashed into slots by the tick at which they
+// are due, and a single goroutine advances through the slots, firing due timers. The goroutine
+// waits until the next tick at which a timer falls due, or for one revolution at most, and
+// fires all the timers of a tick in one batch, so the timers of an Env cost one wake-up per
+// occupied tick, however many connections they belong to. The goroutine runs while timers are
+// pending, including timers that the fired ones schedule anew, and it runs as part of the Env's
+// GoJoin, so that joining an Env waits for its pending timers, just as it waits for sleeping
+// goroutines.
+//
+// A timer added to fall due before the goroutine wakes up wakes it up through the kick
+// channel. If the Time of the Env is not an AlarmTime, the goroutine is woken up by a goroutine
+// that sleeps on its behalf, see sleepAlarm.
+type timerWheel struct {
+	env      *Env
+	lk       sync.Mutex
+	slots    [wheelSlots]*Timer
+	tick     int64 // Last tick processed, counted in WheelTick units since time zero
+	count    int   // Number of queued timers
+	running  bool  // True while the wheel goroutine is alive
+	wake     int64 // Tick at which the wheel goroutine wakes up next
+	kick     chan struct{} // Wakes up the wheel goroutine before tick wake
+	wakes    int64 // Number of wake-ups of the wheel goroutine
+	starts   int64 // Number of wheel goroutines started
+}
+
+// AfterFunc calls f, after at least ns nanoseconds have elapsed, on the goroutine of the Env's
+// timer wheel. Timers are accurate to within WheelTick. All timers of an Env are fired by a
+// single goroutine, so f must not block. fmt_ and args_ annotate the timer for debugging.
+func (t *Env) AfterFunc(ns int64, f func(), fmt_ string, args_ ...interface{}) *Timer {
+	return t.AfterFuncSlack(ns, 0, f, fmt_, args_...)
+}
+
+// AfterFuncSlack is like AfterFunc, except that f may be called up to slack nanoseconds late.
+// The timer falls due at a multiple of the largest power of two of ticks that fits in slack,
+// so that the timers of many connections that fall due at about the same time, like their
+// idle ticks, are fired together, in one wake-up of the wheel.
+func (t *Env) AfterFuncSlack(ns, slack int64, f func(), fmt_ string, args_ ...interface{}) *Timer {
+	tm := &Timer{
+		wheel: &t.wheel,
+		f:     f,
+		fmt_:  fmt_,
+		args_: args_,
+	}
+	t.wheel.add(tm, ns, slack)
+	return tm
+}
+
+func (w *timerWheel) add(t *Timer, ns, slack int64) {
+	w.lk.Lock()
+	defer w.lk.Unlock()
+	now := w.env.Now()
+	if !w.running {
+		w.tick = now / WheelTick
+	}
+	due := (now + max64(ns, 0) + WheelTick - 1) / WheelTick
+	if align := alignTicks(slack); align > 1 {
+		due = (due + align - 1) / align * align
+	}
+	delta := max64(due-w.tick, 1)
+	t.rounds = (delta - 1) / wheelSlots
+	t.slot = int((w.tick + delta) % wheelSlots)
+	t.prev, t.next = nil, w.slots[t.slot]
+	if t.next != nil {
+		t.next.prev = t
+	}
+	w.slots[t.slot] = t
+	t.queued = true
+	w.count++
+	switch at := w.tick + min64(delta, wheelSlots); {
+	case !w.running:
+		w.running = true
+		w.wake = at
+		w.starts++
+		if w.kick == nil {
+			w.kick = make(chan struct{}, 1)
+		}
+		w.env.Go(w.loop, "Env·timerWheel")
+	case at < w.wake:
+		w.wake = at
+		select {
+		case w.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// alignTicks returns the largest power of two of ticks that fits in slack nanoseconds
+func alignTicks(slack int64) int64 {
+	align := int64(1)
+	for 2*align*WheelTick <= slack {
+		align *= 2
+	}
+	return align
+}
+
+func (w *timerWheel) unlink(t *Timer) {
+	if t.prev != nil {
+		t.prev.next = t.next
+	} else {
+		w.slots[t.slot] = t.next
+	}
+	if t.next != nil {
+		t.next.prev = t.prev
+	}
+	t.prev, t.next = nil, nil
+	t.queued = false
+	w.count--
+}
+
+// next returns the earliest tick after the last one processed at which a timer falls due, or
+// the tick one revolution ahead if there is none before
+func (w *timerWheel) next() int64 {
+	for d := int64(1); d < wheelSlots; d++ {
+		for t := w.slots[(w.tick+d)%wheelSlots]; t != nil; t = t.next {
+			if t.rounds == 0 {
+				return w.tick + d
+			}
+		}
+	}
+	return w.tick + wheelSlots
+}
+
+// loop runs the wheel goroutine. It exits once no timers are left after firing a batch.
+func (w *timerWheel) loop() {
+	var due []*Timer
+	for {
+		w.lk.Lock()
+		wake := w.wake
+		w.lk.Unlock()
+		if d := wake*WheelTick - w.env.Now(); d > 0 {
+			alarm, stop := w.env.clock.Alarm(d)
+			select {
+			case <-alarm:
+			case <-w.kick:
+				stop()
+			}
+		}
+		now := w.env.Now()
+		w.lk.Lock()
+		// A kick may be left over from a timer that fell due with the ones about to be fired
+		select {
+		case <-w.kick:
+		default:
+		}
+		w.wakes++
+		// Slots that the goroutine slept over are processed in order, so that the rounds of
+		// the timers in them count down
+		for w.tick < now/WheelTick {
+			w.tick++
+			k := len(due)
+			for t := w.slots[w.tick%wheelSlots]; t != nil; {
+				next := t.next
+				if t.rounds > 0 {
+					t.rounds--
+				} else {
+					w.unlink(t)
+					due = append(due, t)
+				}
+				t = next
+			}
+			// Timers are prepended to their slot; fire them in the order they were scheduled
+			for i, j := k, len(due)-1; i < j; i, j = i+1, j-1 {
+				due[i], due[j] = due[j], due[i]
+			}
+		}
+		w.wake = w.next()
+		w.lk.Unlock()
+		for i, t := range due {
+			t.f()
+			due[i] = nil
+		}
+		due = due[:0]
+		// Fired timers often schedule themselves anew, like the idle ticks of connections, so
+		// the goroutine keeps running as long as any timers are left after the batch. The
+		// timers added meanwhile have already moved wake, so their kicks are spurious.
+		w.lk.Lock()
+		select {
+		case <-w.kick:
+		default:
+		}
+		if w.count == 0 {
+			w.running = false
+			w.lk.Unlock()
+			return
+		}
+		w.lk.Unlock()
+	}
+}
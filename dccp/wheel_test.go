@@ -0,0 +1,183 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestTimerOrder(t *testing.T) {
+	env := NewEnvTime(NewDilatedTime(100), nil)
+	var lk sync.Mutex
+	var fired []int64
+	// Delays are several ticks apart and span several revolutions of the wheel
+	delays := []int64{5e9, 10e6, 600e6, 2e9, 50e6, 0}
+	t0 := env.Now()
+	for _, d := range delays {
+		d := d
+		env.AfterFunc(d, func() {
+			if env.Now()-t0 < d {
+				t.Errorf("timer %d fired early, after %d", d, env.Now()-t0)
+			}
+			lk.Lock()
+			fired = append(fired, d)
+			lk.Unlock()
+		}, "timer %d", d)
+	}
+	env.Joiner().Join()
+	want := []int64{0, 10e6, 50e6, 600e6, 2e9, 5e9}
+	if len(fired) != len(want) {
+		t.Fatalf("fired %v, want %v", fired, want)
+	}
+	for i := range want {
+		if fired[i] != want[i] {
+			t.Fatalf("fired %v, want %v", fired, want)
+		}
+	}
+}
+
+func TestTimerStop(t *testing.T) {
+	env := NewEnvTime(NewDilatedTime(100), nil)
+	stopped := env.AfterFunc(100e6, func() { t.Errorf("stopped timer fired") }, "stopped")
+	done := make(chan int)
+	env.AfterFunc(200e6, func() { close(done) }, "done")
+	if !stopped.Stop() {
+		t.Errorf("pending timer not stopped")
+	}
+	if stopped.Stop() {
+		t.Errorf("timer stopped twice")
+	}
+	<-done
+	env.Joiner().Join()
+}
+
+func TestTimerGoroutines(t *testing.T) {
+	env := NewEnv(nil)
+	const n = 5000
+	var wg sync.WaitGroup
+	wg.Add(n)
+	before := runtime.NumGoroutine()
+	for i := 0; i < n; i++ {
+		env.AfterFunc(int64(i%100)*1e6, wg.Done, "timer")
+	}
+	if k := runtime.NumGoroutine() - before; k > 2 {
+		t.Errorf("%d timers started %d goroutines", n, k)
+	}
+	wg.Wait()
+	env.Joiner().Join()
+}
+
+func TestTimerCoalesce(t *testing.T) {
+	env := NewEnvTime(NewDilatedTime(10), nil)
+	const slack = 16e6
+	t0 := env.Now()
+	// Timers of many connections, spread over 100 ms, fall due at the 7 or 8 multiples of 16 ms
+	for i := int64(0); i < 200; i++ {
+		d := i * 5e5
+		env.AfterFuncSlack(d, slack, func() {
+			if env.Now()-t0 < d {
+				t.Errorf("timer %d fired early, after %d", d, env.Now()-t0)
+			}
+		}, "timer %d", d)
+	}
+	env.Joiner().Join()
+	env.wheel.lk.Lock()
+	defer env.wheel.lk.Unlock()
+	if env.wheel.wakes > 8 {
+		t.Errorf("200 timers took %d wake-ups", env.wheel.wakes)
+	}
+}
+
+func TestTimerSleep(t *testing.T) {
+	env := NewEnvTime(NewDilatedTime(10), nil)
+	t0 := env.Now()
+	far := make(chan int64, 1)
+	env.AfterFunc(300e6, func() { far <- env.Now() - t0 }, "far")
+	// A timer that falls due while the wheel goroutine sleeps wakes the wheel up in time
+	env.Sleep(10e6)
+	near := make(chan int64, 1)
+	env.AfterFunc(20e6, func() { near <- env.Now() - t0 }, "near")
+	if d := <-near; d < 30e6 || d > 200e6 {
+		t.Errorf("near timer fired after %d", d)
+	}
+	if d := <-far; d < 300e6 {
+		t.Errorf("far timer fired after %d", d)
+	}
+	env.Joiner().Join()
+	// The wheel sleeps through the ticks at which no timer falls due
+	env.wheel.lk.Lock()
+	defer env.wheel.lk.Unlock()
+	if env.wheel.wakes > 4 {
+		t.Errorf("2 timers took %d wake-ups", env.wheel.wakes)
+	}
+}
+
+// plainTime hides the Alarm method of a Time
+type plainTime struct {
+	Time
+}
+
+func TestTimerSleepAlarm(t *testing.T) {
+	env := NewEnvTime(plainTime{NewDilatedTime(10)}, nil)
+	t0 := env.Now()
+	far := make(chan int64, 1)
+	env.AfterFunc(300e6, func() { far <- env.Now() - t0 }, "far")
+	before := runtime.NumGoroutine()
+	// Timers that fall due before the wheel goroutine wakes up replace its alarm, which one
+	// goroutine sleeps on
+	near := make(chan int64, 10)
+	for i := int64(10); i > 0; i-- {
+		env.AfterFunc(i*20e6, func() { near <- env.Now() - t0 }, "near")
+	}
+	if k := runtime.NumGoroutine() - before; k > 1 {
+		t.Errorf("10 alarms started %d goroutines", k)
+	}
+	if d := <-near; d < 20e6 || d > 200e6 {
+		t.Errorf("near timer fired after %d", d)
+	}
+	if d := <-far; d < 300e6 {
+		t.Errorf("far timer fired after %d", d)
+	}
+	env.Joiner().Join()
+}
+
+func TestTimerRearm(t *testing.T) {
+	env := NewEnvTime(NewDilatedTime(10), nil)
+	const n = 200
+	done := make(chan int)
+	k := 0
+	// A timer that schedules itself anew, like the idle tick of a connection, keeps the one
+	// wheel goroutine running
+	var tick func()
+	tick = func() {
+		if k++; k == n {
+			close(done)
+			return
+		}
+		env.AfterFunc(1e6, tick, "rearm")
+	}
+	env.AfterFunc(1e6, tick, "rearm")
+	<-done
+	env.Joiner().Join()
+	env.wheel.lk.Lock()
+	starts := env.wheel.starts
+	env.wheel.lk.Unlock()
+	if starts != 1 {
+		t.Errorf("%d re-armed timers started %d wheel goroutines", n, starts)
+	}
+	// Joiners that completed are forgotten
+	if p := env.gojoin.Pending(); len(p) != 0 {
+		t.Errorf("%d joiners pending after join", len(p))
+	}
+}
+
+func BenchmarkAfterFunc(b *testing.B) {
+	env := NewEnv(nil)
+	for i := 0; i < b.N; i++ {
+		env.AfterFunc(10e9, func() {}, "bench").Stop()
+	}
+}
@@ -2,12 +2,13 @@
 // Use of this source code is governed by a 
 // license that can be found in the LICENSE file.
 
-package ccid3
+package dccp
 
 // —————
-// senderWindowCounter maintains the window counter (WC) logic of the sender.
-// It's logic is described in RFC 4342, Section 8.1.
-type senderWindowCounter struct {
+// WindowCounter maintains the window counter (WC) logic of a sender that uses CCVal as a
+// window counter, like CCID 3. Its logic is described in RFC 4342, Section 8.1. Any CCID can
+// embed a WindowCounter, and compare received CCVals with DiffWindowCounter.
+type WindowCounter struct {
 	lastAckNoPresent bool   // Whether there have been any acks
 	lastAckNo        int64  // The sequence number of the last acknowledged packet
 	lastSeqNoPresent bool   // True if at least one packet has been sent
@@ -29,21 +30,21 @@ const (
 	WindowCounterNil = WindowCounterMod
 )
 
-// isNilWindowCounter returns true if and only if -WindowCounterMod < ccval and
-// ccval < WindowCounterMod.
-func isNilWindowCounter(ccval int8) bool {
+// IsNilWindowCounter returns true if and only if ccval is not strictly between
+// -WindowCounterMod and WindowCounterMod.
+func IsNilWindowCounter(ccval int8) bool {
 	return ccval % WindowCounterMod != ccval
 }
 
-// diffWindowCounter returns the smallest non-negative integer than needs to be added to y
+// DiffWindowCounter returns the smallest non-negative integer that needs to be added to y
 // to result in x, in the integers modulo WindowCounterMod.
-func diffWindowCounter(x, y int8) int8 {
+func DiffWindowCounter(x, y int8) int8 {
 	x, y = x % WindowCounterMod, y % WindowCounterMod
 	return (2*WindowCounterMod + x - y) % WindowCounterMod
 }
 
-// Init resets the senderWindowCounter instance for new use
-func (wc *senderWindowCounter) Init() {
+// Init resets the WindowCounter instance for new use
+func (wc *WindowCounter) Init() {
 	wc.lastAckNoPresent = false
 	wc.lastAckNo = 0
 	wc.lastSeqNoPresent = false
@@ -54,7 +55,7 @@ func (wc *senderWindowCounter) Init() {
 // The sender calls OnWrite in order to obtain the WC value to be included in the next
 // outgoing packet
 // TODO: Use RTT estimates from the sender's better estimator?
-func (wc *senderWindowCounter) OnWrite(rtt int64, seqNo int64, now int64) int8 {
+func (wc *WindowCounter) OnWrite(rtt int64, seqNo int64, now int64) int8 {
 	// Update sequence number fields
 	if wc.lastSeqNoPresent {
 		if seqNo <= wc.lastSeqNo {
@@ -92,7 +93,7 @@ func (wc *senderWindowCounter) OnWrite(rtt int64, seqNo int64, now int64) int8 {
 	return ccval
 }
 
-func (wc *senderWindowCounter) getAckBound(now int64) (ccvalInc int8) {
+func (wc *WindowCounter) getAckBound(now int64) (ccvalInc int8) {
 	if !wc.lastAckNoPresent {
 		return 0
 	}
@@ -107,12 +108,18 @@ func (wc *senderWindowCounter) getAckBound(now int64) (ccvalInc int8) {
 // getTimeBound returns the least increase in ccval that the next packet must have,
 // considering how much time has passed since the last window started.
 // The returned value is never bigger than WindowCounterMaxInc.
-func (wc *senderWindowCounter) getTimeBound(rtt int64, now int64) (ccvalInc int8) {
+func (wc *WindowCounter) getTimeBound(rtt int64, now int64) (ccvalInc int8) {
 	latest := wc.windowHistory.Latest()
 	if latest == nil {
 		panic("no window history")
 	}
-	quarterRTTs := (now - latest.StartTime) / (rtt / 4)
+	// An RTT of a few nanoseconds, as measured over a pipe without latency on virtual time,
+	// still makes for a quarter of one nanosecond
+	quarter := rtt / 4
+	if quarter <= 0 {
+		quarter = 1
+	}
+	quarterRTTs := (now - latest.StartTime) / quarter
 	if quarterRTTs < 0 {
 		panic("time reversal")
 	}
@@ -126,7 +133,7 @@ func (wc *senderWindowCounter) getTimeBound(rtt int64, now int64) (ccvalInc int8
 
 // Sender calls OnRead every time it receives an Ack or DataAck packet.
 // OnRead simply keeps track of the highest acknowledged sequence number.
-func (wc *senderWindowCounter) OnRead(ackNo int64) {
+func (wc *WindowCounter) OnRead(ackNo int64) {
 	// Discard acknowledgements of unsent packets
 	if !wc.lastSeqNoPresent || ackNo > wc.lastSeqNo {
 		return
@@ -177,7 +184,7 @@ func (t *windowHistory) Add(startSeqNo int64, startTime int64, ccval int8) {
 			panic("non-increasing time")
 		}
 		// ccvals cannot increase faster than 5 units at a time
-		if diffWindowCounter(ccval, lastRec.CCVal) > 5 {
+		if DiffWindowCounter(ccval, lastRec.CCVal) > 5 {
 			panic("ccvals increase too fast")
 		}
 	}
@@ -197,7 +204,7 @@ func (t *windowHistory) Lookup(seqNo int64, ccvalDepth int) (ccvalDiff int8, ok
 			return 0, false
 		}
 		if prev != nil {
-			ccvalDiff += diffWindowCounter(prev.CCVal, w.CCVal)
+			ccvalDiff += DiffWindowCounter(prev.CCVal, w.CCVal)
 		}
 		if w.StartSeqNo <= seqNo {
 			return ccvalDiff, true
@@ -0,0 +1,59 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"testing"
+)
+
+var diffWindowCounterTests = []struct {
+	x, y, diff int8
+}{
+	{0, 0, 0},
+	{1, 0, 1},
+	{0, 15, 1},
+	{3, 14, 5},
+	{15, 0, 15},
+	{4, 12, 8},
+	{12, 4, 8},
+}
+
+func TestDiffWindowCounter(t *testing.T) {
+	for _, x := range diffWindowCounterTests {
+		if d := DiffWindowCounter(x.x, x.y); d != x.diff {
+			t.Errorf("DiffWindowCounter(%d, %d) = %d, expected %d", x.x, x.y, d, x.diff)
+		}
+	}
+}
+
+// TestWindowCounter follows the rules of RFC 4342 Section 8.1: the counter grows by one every
+// quarter RTT, by no more than WindowCounterMaxInc at once, and reaches at least
+// WindowCounterAckInc past the window of an acknowledged packet
+func TestWindowCounter(t *testing.T) {
+	const rtt = 100e6
+	var wc WindowCounter
+	wc.Init()
+	steps := []struct {
+		seqNo, now int64
+		ackNo      int64 // Acknowledged before the write, if positive
+		ccval      int8
+	}{
+		{1, 1e6, 0, 0},
+		{2, 11e6, 0, 0},     // Within the first quarter RTT
+		{3, 26e6, 0, 1},     // One quarter RTT after the window of packet 1
+		{4, 76e6, 0, 3},     // Two quarter RTTs after the window of packet 3
+		{5, 1076e6, 0, 8},   // Long idle time, capped at WindowCounterMaxInc
+		{6, 1077e6, 5, 12},  // Acknowledgement of packet 5, whose window is 8
+		{7, 1277e6, 0, 1},   // Capped increase, wrapping around WindowCounterMod
+	}
+	for _, s := range steps {
+		if s.ackNo > 0 {
+			wc.OnRead(s.ackNo)
+		}
+		if ccval := wc.OnWrite(rtt, s.seqNo, s.now); ccval != s.ccval {
+			t.Errorf("packet %d: window counter %d, expected %d", s.seqNo, ccval, s.ccval)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"sync"
+)
+
+const (
+	WriteNonDataQueueLen = 5 // Capacity of the non-Data packet queue; further non-Data packets are dropped
+	WriteDataQueueLen    = 4 // Capacity of the application data queue; further writes block
+)
+
+// WriteQueueSample is the name of the sample series carrying the number of application data
+// blocks left in the write queue, each time the write loop takes one out
+const WriteQueueSample = "Write-Queue"
+
+// writeQueue hands outgoing packets from the Conn to its writeLoop. It holds two bounded
+// buffers: a ring of wire-format non-Data packets, which take priority and are dropped when
+// their ring is full, and a queue of blocks of application data. The QueuePolicy of the
+// queue picks the block that is sent next, and decides whether Write blocks while the queue
+// is full, which applies backpressure, or drops a queued block. A single condition variable
+// is signalled only on transitions that a blocked party can act on, so an uncontended packet
+// incurs no goroutine wakeups beyond the one that dequeues it.
+type writeQueue struct {
+	Mutex
+	cond        sync.Cond
+
+	nonData     [WriteNonDataQueueLen]*writeHeader
+	nonDataHead int
+	nonDataLen  int
+
+	data        [][]byte    // Queued application data, in the order it was written
+	dataMeta    []WriteMeta // Metadata of the blocks in data
+	dataTime    []int64     // Times when the blocks in data were queued
+	policy      QueuePolicy
+	now         func() int64 // Clock of dataTime; nil leaves the times at zero
+
+	waitPop     int  // Number of goroutines blocked in pop
+	waitData    int  // Number of goroutines blocked in pushData
+	waitFlush   int  // Number of goroutines blocked in flush
+	dataClosed  bool // Set when application data is no longer accepted
+	closed      bool // Set when the queue is closed altogether
+}
+
+func newWriteQueue() *writeQueue {
+	q := &writeQueue{
+		data:     make([][]byte, 0, WriteDataQueueLen),
+		dataMeta: make([]WriteMeta, 0, WriteDataQueueLen),
+		dataTime: make([]int64, 0, WriteDataQueueLen),
+		policy:   QueueFIFO{},
+	}
+	q.cond.L = &q.Mutex
+	return q
+}
+
+// pushNonData adds h to the non-Data ring without blocking. If the queue is closed, it
+// returns ErrBad. If the ring is full, h is dropped and pushNonData returns ErrDrop.
+func (q *writeQueue) pushNonData(h *writeHeader) error {
+	q.Lock()
+	defer q.Unlock()
+	if q.closed {
+		return ErrBad
+	}
+	if q.nonDataLen == WriteNonDataQueueLen {
+		return ErrDrop
+	}
+	q.nonData[(q.nonDataHead+q.nonDataLen)%WriteNonDataQueueLen] = h
+	q.nonDataLen++
+	q.wake(q.waitPop > 0)
+	return nil
+}
+
+// pushData adds the application data block b to the data queue. While the queue is full,
+// pushData blocks or drops a queued block, as decided by the queue policy. It returns ErrBad
+// if application data is not accepted any longer.
+func (q *writeQueue) pushData(b []byte) error {
+	_, err := q.pushMsg(b, WriteMeta{})
+	return err
+}
+
+// evictedMsg is a block of application data that the queue policy dropped, along with its
+// metadata
+type evictedMsg struct {
+	Data []byte
+	Meta WriteMeta
+}
+
+// pushMsg is like pushData, except that it queues the metadata meta along with b. If the
+// queue policy dropped a queued block to make room for b, the block is returned in evicted.
+func (q *writeQueue) pushMsg(b []byte, meta WriteMeta) (evicted *evictedMsg, err error) {
+	q.Lock()
+	defer q.Unlock()
+	for !q.dataClosed && len(q.data) == WriteDataQueueLen {
+		if i := q.policy.Evict(q.dataMeta, meta); i >= 0 {
+			evicted = &evictedMsg{ Data: q.data[i], Meta: q.dataMeta[i] }
+			q.remove(i)
+			break
+		}
+		q.waitData++
+		q.cond.Wait()
+		q.waitData--
+	}
+	if q.dataClosed {
+		return evicted, ErrBad
+	}
+	q.data, q.dataMeta, q.dataTime = append(q.data, b), append(q.dataMeta, meta), append(q.dataTime, q.time())
+	q.wake(q.waitPop > 0)
+	return evicted, nil
+}
+
+// remove removes the i-th block from the data queue
+func (q *writeQueue) remove(i int) {
+	n := len(q.data) - 1
+	copy(q.data[i:], q.data[i+1:])
+	copy(q.dataMeta[i:], q.dataMeta[i+1:])
+	copy(q.dataTime[i:], q.dataTime[i+1:])
+	q.data[n] = nil
+	q.data, q.dataMeta, q.dataTime = q.data[:n], q.dataMeta[:n], q.dataTime[:n]
+}
+
+// time returns the current time of the clock of the queue, or zero if it has none
+func (q *writeQueue) time() int64 {
+	if q.now == nil {
+		return 0
+	}
+	return q.now()
+}
+
+// setPolicy replaces the queue policy. Writers that are blocked on a full queue reconsider
+// under the new policy.
+func (q *writeQueue) setPolicy(policy QueuePolicy) {
+	q.Lock()
+	defer q.Unlock()
+	q.policy = policy
+	q.wake(q.waitData > 0)
+}
+
+// pop blocks until a packet is available and removes it from the queue. Non-Data packets
+// are returned in h and take precedence over application data. Application data, the block
+// picked by the queue policy, is returned in b, with isData set, only if acceptData is true. pop returns ok equal to false once the
+// queue has been closed.
+func (q *writeQueue) pop(acceptData bool) (h *writeHeader, b []byte, isData bool, ok bool) {
+	h, b, _, _, isData, ok = q.popMsg(acceptData)
+	return h, b, isData, ok
+}
+
+// popMsg is like pop, except that it also returns the metadata queued with application data,
+// and the time the data spent in the queue
+func (q *writeQueue) popMsg(acceptData bool) (h *writeHeader, b []byte, meta WriteMeta, queued int64, isData bool, ok bool) {
+	q.Lock()
+	defer q.Unlock()
+	for {
+		if q.closed && q.nonDataLen == 0 {
+			return nil, nil, WriteMeta{}, 0, false, false
+		}
+		if q.nonDataLen > 0 {
+			h = q.nonData[q.nonDataHead]
+			q.nonData[q.nonDataHead] = nil
+			q.nonDataHead = (q.nonDataHead + 1) % WriteNonDataQueueLen
+			q.nonDataLen--
+			return h, nil, WriteMeta{}, 0, false, true
+		}
+		if acceptData && !q.closed && len(q.data) > 0 {
+			i := q.policy.Next(q.dataMeta)
+			b, meta, queued = q.data[i], q.dataMeta[i], q.time()-q.dataTime[i]
+			q.remove(i)
+			q.wake(q.waitData > 0 || (q.waitFlush > 0 && len(q.data) == 0))
+			return nil, b, meta, queued, true, true
+		}
+		q.waitPop++
+		q.cond.Wait()
+		q.waitPop--
+	}
+}
+
+// closeData makes the queue reject application data. Data that is already queued is
+// discarded. closeData is idempotent.
+func (q *writeQueue) closeData() {
+	q.Lock()
+	defer q.Unlock()
+	if q.dataClosed {
+		return
+	}
+	q.dataClosed = true
+	for i := range q.data {
+		q.data[i] = nil
+	}
+	q.data, q.dataMeta, q.dataTime = q.data[:0], q.dataMeta[:0], q.dataTime[:0]
+	q.wake(true)
+}
+
+// flush blocks until the data queue is empty. It returns ErrBad if application data stopped
+// being accepted first, in which case queued data may have been discarded.
+func (q *writeQueue) flush() error {
+	q.Lock()
+	defer q.Unlock()
+	for !q.dataClosed && len(q.data) > 0 {
+		q.waitFlush++
+		q.cond.Wait()
+		q.waitFlush--
+	}
+	if q.dataClosed {
+		return ErrBad
+	}
+	return nil
+}
+
+// dataQueued returns the number of application data blocks in the queue
+func (q *writeQueue) dataQueued() int {
+	q.Lock()
+	defer q.Unlock()
+	return len(q.data)
+}
+
+// close closes the queue. The non-Data packets that are already queued, such as the Reset
+// that ends a connection, are still returned by pop. Once they are gone, blocked and future
+// calls to pop return ok equal to false. close is idempotent.
+func (q *writeQueue) close() {
+	q.Lock()
+	defer q.Unlock()
+	q.dataClosed = true
+	q.closed = true
+	q.wake(true)
+}
+
+// wake wakes up the goroutines blocked on the queue, if there are any
+func (q *writeQueue) wake(waiting bool) {
+	if waiting {
+		q.cond.Broadcast()
+	}
+}
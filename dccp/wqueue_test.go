@@ -0,0 +1,200 @@
+// Copyright 2011-2013 GoDCCP Authors. All rights reserved.
+// Use of this source code is governed by a 
+// license that can be found in the LICENSE file.
+
+package dccp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWriteQueuePriority(t *testing.T) {
+	q := newWriteQueue()
+	q.pushData([]byte{1})
+	h := &writeHeader{}
+	if err := q.pushNonData(h); err != nil {
+		t.Fatalf("push non-Data (%s)", err)
+	}
+	if g, _, isData, _ := q.pop(true); isData || g != h {
+		t.Errorf("non-Data packet does not take priority")
+	}
+	if _, b, isData, _ := q.pop(true); !isData || b[0] != 1 {
+		t.Errorf("expecting data")
+	}
+	// Application data is held back until it is accepted
+	q.pushData([]byte{2})
+	q.pushNonData(nil)
+	if g, _, isData, ok := q.pop(false); !ok || isData || g != nil {
+		t.Errorf("expecting nil non-Data packet")
+	}
+}
+
+func TestWriteQueueBackpressure(t *testing.T) {
+	q := newWriteQueue()
+	for i := 0; i < WriteDataQueueLen; i++ {
+		if err := q.pushData([]byte{byte(i)}); err != nil {
+			t.Fatalf("push data (%s)", err)
+		}
+	}
+	pushed := make(chan error)
+	go func() {
+		pushed <- q.pushData([]byte{WriteDataQueueLen})
+	}()
+	select {
+	case <-pushed:
+		t.Fatalf("push into full queue did not block")
+	case <-time.After(50 * time.Millisecond):
+	}
+	for i := 0; i <= WriteDataQueueLen; i++ {
+		if _, b, _, _ := q.pop(true); b[0] != byte(i) {
+			t.Errorf("expecting block %d, got %d", i, b[0])
+		}
+		if i == 0 {
+			if err := <-pushed; err != nil {
+				t.Errorf("blocked push (%s)", err)
+			}
+		}
+	}
+}
+
+func TestWriteQueueClose(t *testing.T) {
+	q := newWriteQueue()
+	for i := 0; i < WriteNonDataQueueLen; i++ {
+		q.pushNonData(nil)
+	}
+	if err := q.pushNonData(nil); err != ErrDrop {
+		t.Errorf("expecting drop, got %v", err)
+	}
+	for i := 0; i < WriteDataQueueLen; i++ {
+		q.pushData(nil)
+	}
+	pushed := make(chan error)
+	go func() {
+		pushed <- q.pushData(nil)
+	}()
+	q.closeData()
+	if err := <-pushed; err != ErrBad {
+		t.Errorf("blocked push after closeData returned %v", err)
+	}
+	popped := make(chan bool)
+	go func() {
+		for {
+			if _, _, isData, ok := q.pop(true); isData {
+				t.Errorf("data popped after closeData")
+			} else if !ok {
+				break
+			}
+		}
+		popped <- true
+	}()
+	q.close()
+	<-popped
+	if err := q.pushNonData(nil); err != ErrBad {
+		t.Errorf("push after close returned %v", err)
+	}
+}
+
+func BenchmarkWriteQueue(b *testing.B) {
+	q := newWriteQueue()
+	go func() {
+		for i := 0; i < b.N; i++ {
+			q.pushData(nil)
+		}
+	}()
+	for i := 0; i < b.N; i++ {
+		q.pop(true)
+	}
+}
+
+func BenchmarkWriteChan(b *testing.B) {
+	ch := make(chan []byte)
+	go func() {
+		for i := 0; i < b.N; i++ {
+			ch <- nil
+		}
+	}()
+	for i := 0; i < b.N; i++ {
+		<-ch
+	}
+}
+
+func TestWriteQueueFlush(t *testing.T) {
+	q := newWriteQueue()
+	q.pushData([]byte{1})
+	q.pushData([]byte{2})
+	flushed := make(chan error)
+	go func() {
+		flushed <- q.flush()
+	}()
+	q.pop(true)
+	select {
+	case <-flushed:
+		t.Fatalf("flush returned with data queued")
+	case <-time.After(50 * time.Millisecond):
+	}
+	q.pop(true)
+	if err := <-flushed; err != nil {
+		t.Errorf("flush (%s)", err)
+	}
+	q.pushData([]byte{3})
+	go func() {
+		flushed <- q.flush()
+	}()
+	q.closeData()
+	if err := <-flushed; err != ErrBad {
+		t.Errorf("flush after closeData returned %v", err)
+	}
+}
+
+func TestWriteQueuePolicy(t *testing.T) {
+	// Drop-oldest replaces the oldest block of a full queue, without blocking
+	q := newWriteQueue()
+	q.setPolicy(QueueDropOldest{})
+	for i := 0; i <= WriteDataQueueLen; i++ {
+		evicted, err := q.pushMsg([]byte{byte(i)}, WriteMeta{})
+		if err != nil || (evicted != nil) != (i == WriteDataQueueLen) {
+			t.Fatalf("push %d evicted %v (%v)", i, evicted, err)
+		}
+		if evicted != nil && evicted.Data[0] != 0 {
+			t.Errorf("evicted block %d, expecting the oldest", evicted.Data[0])
+		}
+	}
+	for i := 1; i <= WriteDataQueueLen; i++ {
+		if _, b, _, _ := q.pop(true); b[0] != byte(i) {
+			t.Errorf("expecting block %d, got %d", i, b[0])
+		}
+	}
+
+	// Strict priority sends the most important block first and evicts the least important one
+	q = newWriteQueue()
+	q.setPolicy(QueuePriority{})
+	prio := []int{1, 3, 0, 3, 2}
+	for i, p := range prio {
+		q.pushMsg([]byte{byte(i)}, WriteMeta{Priority: p})
+	}
+	for _, i := range []byte{1, 3, 4, 0} {
+		if _, b, meta, _, _, _ := q.popMsg(true); b[0] != i || meta.Priority != prio[i] {
+			t.Errorf("expecting block %d, got %d", i, b[0])
+		}
+	}
+
+	// Switching a full queue away from FIFO releases a blocked writer
+	q = newWriteQueue()
+	for i := 0; i < WriteDataQueueLen; i++ {
+		q.pushData(nil)
+	}
+	pushed := make(chan error)
+	go func() {
+		pushed <- q.pushData(nil)
+	}()
+	select {
+	case <-pushed:
+		t.Fatalf("push into full FIFO queue did not block")
+	case <-time.After(50 * time.Millisecond):
+	}
+	q.setPolicy(QueueDropOldest{})
+	if err := <-pushed; err != nil {
+		t.Errorf("blocked push (%s)", err)
+	}
+}
@@ -38,26 +38,42 @@ func (opt *Option) getFootprint() (int, error) {
 // while not including any space for options whose type is not compatible with
 // the type of the header
 func (gh *Header) getOptionsFootprint() (int, error) {
-	if gh.Options == nil {
+	r, err := gh.getOptionsLen()
+	if err != nil {
+		return 0, err
+	}
+	r += gh.Padding
+	if r%4 != 0 {
+		r += 4 - (r % 4)
+	}
+	return r, nil
+}
+
+// getOptionsLen() returns the size of the options of the header, before the Padding
+// options that follow them
+func (gh *Header) getOptionsLen() (int, error) {
+	opts := gh.GetOptions()
+	if opts == nil {
 		return 0, nil
 	}
 	r := 0
-	for _, opt := range gh.Options {
+	for _, opt := range opts {
 		if !isOptionValidForType(opt.Type, gh.Type) {
 			if opt.Mandatory {
 				return 0, ErrOption
 			}
 			continue
 		}
+		// Section 5.8: Data packets may not carry a Mandatory option
+		if opt.Mandatory && !isOptionValidForType(OptionMandatory, gh.Type) {
+			return 0, ErrOption
+		}
 		s, err := opt.getFootprint()
 		if err != nil {
 			return 0, err
 		}
 		r += s
 	}
-	if r%4 != 0 {
-		r += 4 - (r % 4)
-	}
 	return r, nil
 }
 
@@ -93,6 +109,15 @@ func (gh *Header) Write(sourceIP, destIP []byte,
 	protoNo byte,
 	allowShortSeqNoFeature bool) (header []byte, err error) {
 
+	return gh.WriteInto(nil, sourceIP, destIP, protoNo, allowShortSeqNoFeature)
+}
+
+// WriteInto is like Write, but it encodes into buf, without allocating, whenever buf has
+// sufficient capacity. The returned slice shares its underlying array with buf in that case.
+func (gh *Header) WriteInto(buf []byte, sourceIP, destIP []byte,
+	protoNo byte,
+	allowShortSeqNoFeature bool) (header []byte, err error) {
+
 	err = verifyIPAndProto(sourceIP, destIP, protoNo)
 	if err != nil {
 		return nil, err
@@ -102,7 +127,10 @@ func (gh *Header) Write(sourceIP, destIP []byte,
 	if err != nil {
 		return nil, err
 	}
-	buf := make([]byte, dataOffset+len(gh.Data))
+	if cap(buf) < dataOffset+len(gh.Data) {
+		buf = make([]byte, dataOffset+len(gh.Data))
+	}
+	buf = buf[:dataOffset+len(gh.Data)]
 
 	k := 0
 
@@ -188,7 +216,7 @@ func (gh *Header) Write(sourceIP, destIP []byte,
 	}
 
 	// Write (2) Options and Padding
-	writeOptions(gh.Options, buf[k:dataOffset], gh.Type)
+	writeOptions(gh.GetOptions(), buf[k:dataOffset], gh.Type, gh.Padding)
 
 	// Write checksum
 	dlen := len(gh.Data)
@@ -210,7 +238,7 @@ func (gh *Header) Write(sourceIP, destIP []byte,
 	return buf, nil
 }
 
-func writeOptions(opts []*Option, buf []byte, Type byte) {
+func writeOptions(opts []Option, buf []byte, Type byte, padding int) {
 	if len(buf)&0x3 != 0 {
 		panic("logic")
 	}
@@ -241,7 +269,7 @@ func writeOptions(opts []*Option, buf []byte, Type byte) {
 		}
 		k += len(opt.Data)
 	}
-	if len(buf)-k >= 4 {
+	if len(buf)-k >= 4+padding {
 		panic("opt padding len")
 	}
 	for i := 0; i < len(buf)-k; i++ {